@@ -0,0 +1,46 @@
+// Per-thread error messages and status names, kept in C so subl_last_error
+// works like errno for callers on any thread.
+
+#include <string.h>
+
+#include "sublation.h"
+
+static _Thread_local char last_error[1024];
+
+void subl_set_error(const char *msg, size_t len) {
+    if (len >= sizeof(last_error)) {
+        len = sizeof(last_error) - 1;
+    }
+    memcpy(last_error, msg, len);
+    last_error[len] = '\0';
+}
+
+const char *subl_last_error(void) {
+    return last_error;
+}
+
+const char *subl_status_string(subl_status status) {
+    switch (status) {
+    case SUBL_OK:
+        return "ok";
+    case SUBL_ERR_INVALID_ARGUMENT:
+        return "invalid argument";
+    case SUBL_ERR_INVALID_HANDLE:
+        return "invalid handle";
+    case SUBL_ERR_IO:
+        return "i/o error";
+    case SUBL_ERR_INVALID_MODEL:
+        return "invalid model";
+    case SUBL_ERR_SIGNATURE:
+        return "signature verification failed";
+    case SUBL_ERR_INPUT_TOO_LARGE:
+        return "input too large";
+    case SUBL_ERR_OUTPUT_TOO_SMALL:
+        return "output buffer too small";
+    case SUBL_ERR_ARENA_EXHAUSTED:
+        return "arena exhausted";
+    case SUBL_ERR_EXECUTION:
+        return "execution failed";
+    }
+    return "unknown status";
+}
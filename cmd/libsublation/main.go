@@ -0,0 +1,198 @@
+// Command libsublation builds the Sublation runtime as a C shared library.
+//
+//	go build -buildmode=c-shared -o libsublation.so ./cmd/libsublation
+//
+// The API is declared in sublation.h, which documents error codes, arena
+// sizing and thread safety. Models are referred to by integer handles so no
+// Go pointer ever crosses into C.
+package main
+
+/*
+#define SUBL_NO_PROTOTYPES
+#include "sublation.h"
+
+void subl_set_error(const char *msg, size_t len);
+*/
+import "C"
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"io/fs"
+	"sync"
+	"unsafe"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+// handles maps the handles given to C to their engines
+var handles = struct {
+	mu      sync.RWMutex
+	next    uint64
+	engines map[uint64]*runtime.Engine
+}{engines: make(map[uint64]*runtime.Engine)}
+
+// engine returns the engine of a handle, or nil
+func engine(h C.subl_handle) *runtime.Engine {
+	handles.mu.RLock()
+	defer handles.mu.RUnlock()
+	return handles.engines[uint64(h)]
+}
+
+// fail records msg as the calling thread's last error and returns status
+func fail(status C.subl_status, msg string) C.subl_status {
+	C.subl_set_error((*C.char)(unsafe.Pointer(unsafe.StringData(msg))), C.size_t(len(msg)))
+	return status
+}
+
+// failErr records err and returns its status, or fallback when err matches
+// none of the specific codes
+func failErr(err error, fallback C.subl_status) C.subl_status {
+	status := fallback
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, runtime.ErrClosed):
+		status = C.SUBL_ERR_INVALID_HANDLE
+	case errors.As(err, &pathErr):
+		status = C.SUBL_ERR_IO
+	case errors.Is(err, model.ErrUnsigned), errors.Is(err, model.ErrSignature):
+		status = C.SUBL_ERR_SIGNATURE
+	case errors.Is(err, runtime.ErrInputTooLarge):
+		status = C.SUBL_ERR_INPUT_TOO_LARGE
+	case errors.Is(err, runtime.ErrInputTooShort):
+		status = C.SUBL_ERR_INVALID_ARGUMENT
+	case errors.Is(err, runtime.ErrArenaExhausted):
+		status = C.SUBL_ERR_ARENA_EXHAUSTED
+	}
+	return fail(status, err.Error())
+}
+
+//export subl_abi_version
+func subl_abi_version() C.uint32_t {
+	return C.SUBL_ABI_VERSION
+}
+
+//export subl_load
+func subl_load(path *C.char, opts *C.subl_options, out *C.subl_handle) C.subl_status {
+	if path == nil || out == nil {
+		return fail(C.SUBL_ERR_INVALID_ARGUMENT, "path and out must not be NULL")
+	}
+	*out = 0
+
+	engineOpts := runtime.DefaultEngineOptions()
+	engineOpts.Streaming = true
+	var key []byte
+	if opts != nil {
+		if uintptr(opts.struct_size) < unsafe.Sizeof(*opts) {
+			return fail(C.SUBL_ERR_INVALID_ARGUMENT, "options struct_size is smaller than subl_options")
+		}
+		if opts.reserved != 0 || opts.flags&^(C.SUBL_FLAG_DETERMINISTIC|C.SUBL_FLAG_CHUNKED_INPUT) != 0 {
+			return fail(C.SUBL_ERR_INVALID_ARGUMENT, "unknown option flags")
+		}
+		if opts.workers > 0 {
+			engineOpts.Workers = int(opts.workers)
+		}
+		engineOpts.ArenaSize = uintptr(opts.arena_bytes)
+		engineOpts.StreamingBytes = runtime.RegionBytes(uintptr(opts.input_bytes))
+		engineOpts.Deterministic = opts.flags&C.SUBL_FLAG_DETERMINISTIC != 0
+		engineOpts.ChunkedInput = opts.flags&C.SUBL_FLAG_CHUNKED_INPUT != 0
+		if opts.public_key_pem != nil {
+			key = []byte(C.GoString(opts.public_key_pem))
+		}
+	}
+
+	var pub ed25519.PublicKey
+	if key != nil {
+		var err error
+		if pub, err = model.ParsePublicKey(key); err != nil {
+			return fail(C.SUBL_ERR_INVALID_ARGUMENT, "public key: "+err.Error())
+		}
+	}
+	graph, err := runtime.ReadGraph(C.GoString(path), pub)
+	if err != nil {
+		return failErr(err, C.SUBL_ERR_INVALID_MODEL)
+	}
+	e, err := runtime.NewEngine(graph, &engineOpts)
+	if err != nil {
+		return failErr(err, C.SUBL_ERR_INVALID_MODEL)
+	}
+
+	handles.mu.Lock()
+	handles.next++
+	h := handles.next
+	handles.engines[h] = e
+	handles.mu.Unlock()
+	*out = C.subl_handle(h)
+	return C.SUBL_OK
+}
+
+//export subl_execute
+func subl_execute(h C.subl_handle, input unsafe.Pointer, inputLen C.size_t, output unsafe.Pointer, outputCap C.size_t, outputLen *C.size_t) C.subl_status {
+	e := engine(h)
+	if e == nil {
+		return fail(C.SUBL_ERR_INVALID_HANDLE, "invalid handle")
+	}
+	if (input == nil && inputLen > 0) || (output == nil && outputCap > 0) || outputLen == nil {
+		return fail(C.SUBL_ERR_INVALID_ARGUMENT, "NULL buffer with a non-zero size or NULL output_len")
+	}
+	size := e.OutputSize()
+	*outputLen = C.size_t(size)
+	if int(outputCap) < size {
+		return fail(C.SUBL_ERR_OUTPUT_TOO_SMALL, "output buffer is smaller than subl_output_bytes")
+	}
+
+	var in, out []byte
+	if inputLen > 0 {
+		in = unsafe.Slice((*byte)(input), int(inputLen))
+	}
+	if size > 0 {
+		out = unsafe.Slice((*byte)(output), size)
+	}
+	if err := e.ExecuteStreaming(in, out); err != nil {
+		return failErr(err, C.SUBL_ERR_EXECUTION)
+	}
+	return C.SUBL_OK
+}
+
+//export subl_arena_bytes
+func subl_arena_bytes(h C.subl_handle) C.size_t {
+	if e := engine(h); e != nil {
+		return C.size_t(e.ArenaBytes())
+	}
+	return 0
+}
+
+//export subl_input_bytes
+func subl_input_bytes(h C.subl_handle) C.size_t {
+	if e := engine(h); e != nil {
+		return C.size_t(e.InputSize())
+	}
+	return 0
+}
+
+//export subl_output_bytes
+func subl_output_bytes(h C.subl_handle) C.size_t {
+	if e := engine(h); e != nil {
+		return C.size_t(e.OutputSize())
+	}
+	return 0
+}
+
+//export subl_free
+func subl_free(h C.subl_handle) C.subl_status {
+	handles.mu.Lock()
+	e := handles.engines[uint64(h)]
+	delete(handles.engines, uint64(h))
+	handles.mu.Unlock()
+	if e == nil {
+		return fail(C.SUBL_ERR_INVALID_HANDLE, "invalid handle")
+	}
+	if err := e.Close(context.Background()); err != nil {
+		return failErr(err, C.SUBL_ERR_EXECUTION)
+	}
+	return C.SUBL_OK
+}
+
+func main() {}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// TestExecuteDeclaredIO builds the library and a C program linked against
+// it, and checks the values subl_execute returns for y = relu(add(x, b))
+// and s = sum(y), with x and b given as input and y and s read back.
+func TestExecuteDeclaredIO(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the shared library")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	run := func(name string, args ...string) string {
+		out, err := exec.Command(name, args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s %s failed: %v\n%s", name, strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	run("go", "build", "-buildmode=c-shared", "-o", filepath.Join(dir, "libsublation.so"), ".")
+	driver := filepath.Join(dir, "execute")
+	run(cc, "-o", driver, "-I.", filepath.Join("testdata", "execute.c"), "-L"+dir, "-lsublation", "-Wl,-rpath,"+dir)
+
+	g := &model.Graph{
+		Payload: make([]byte, 96),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: kernels.OpNoop, In: 0, Out: 16},
+			{ID: 1, Kernel: kernels.OpNoop, In: 16, Out: 32},
+			{ID: 2, Kernel: kernels.OpAdd, In: 32, Out: 64, Topo: []uint32{0, 1}},
+			{ID: 3, Kernel: kernels.OpReLU, In: 64, Out: 80, Topo: []uint32{2}},
+			{ID: 4, Kernel: kernels.OpSum, In: 80, Out: 96, Topo: []uint32{3}},
+		},
+		IO: []model.IOSpec{
+			{Name: "x", Kind: model.Input, NodeID: 0, DType: model.Float32, Shape: []int{4}},
+			{Name: "b", Kind: model.Input, NodeID: 1, DType: model.Float32, Shape: []int{4}},
+			{Name: "y", Kind: model.Output, NodeID: 3, DType: model.Float32, Shape: []int{4}},
+			{Name: "s", Kind: model.Output, NodeID: 4, DType: model.Float32, Shape: []int{1}},
+		},
+	}
+	// The model payload is not the input: executions must read x and b
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(g.Payload[4*i:], math.Float32bits(100))
+	}
+	data, err := g.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	path := filepath.Join(dir, "m.subl")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// x = [1, -2, 3, -4] and b = [0.5, 0.5, -4, 1]: y = [1.5, 0, 0, 0], s = 1.5
+	got := run(driver, path, "1", "-2", "3", "-4", "0.5", "0.5", "-4", "1")
+	if want := "1.5\n0\n0\n0\n1.5\n"; got != want {
+		t.Errorf("Expected y and s\n%s, got\n%s", want, got)
+	}
+	out, err := exec.Command(driver, path, "1", "2").CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "invalid argument") {
+		t.Errorf("Expected an invalid argument error for input shorter than x and b, got %v: %s", err, out)
+	}
+}
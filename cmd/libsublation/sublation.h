@@ -0,0 +1,140 @@
+/*
+ * sublation.h - C ABI of the Sublation runtime.
+ *
+ * Build the shared library with `make lib`, which runs
+ *
+ *     go build -buildmode=c-shared -o bin/libsublation.so ./cmd/libsublation
+ *
+ * and link against it with -lsublation. The library embeds the Go runtime;
+ * applications need no Go toolchain to use it.
+ *
+ * Lifecycle
+ *
+ *     subl_options opts = SUBL_OPTIONS_INIT;
+ *     subl_handle model;
+ *     if (subl_load("model.subl", &opts, &model) != SUBL_OK)
+ *         fprintf(stderr, "load: %s\n", subl_last_error());
+ *     size_t n;
+ *     subl_execute(model, in, in_len, out, out_cap, &n);
+ *     subl_free(model);
+ *
+ * Arena sizing
+ *
+ *     Every model runs in one arena allocated at load time; executions do
+ *     not allocate from the C heap. With arena_bytes 0 the arena is sized
+ *     from the model. subl_arena_bytes reports the size chosen, so it can be
+ *     pinned in later deployments. input_bytes sizes the streaming window
+ *     that receives each input; subl_input_bytes reports it.
+ *
+ * Thread safety
+ *
+ *     Every function may be called from any thread. Executions on one handle
+ *     are serialized inside the library, so concurrent callers of the same
+ *     handle queue rather than race; load one handle per thread to run in
+ *     parallel. subl_free waits for executions in flight on the handle and
+ *     must not race with new calls using it: afterwards the handle is
+ *     invalid and calls return SUBL_ERR_INVALID_HANDLE.
+ *
+ * Stability
+ *
+ *     Functions, status codes and flags are only ever added. subl_options
+ *     starts with its own size, so fields appended in later versions keep
+ *     older callers working; SUBL_ABI_VERSION changes only when that is no
+ *     longer possible.
+ */
+#ifndef SUBLATION_H
+#define SUBLATION_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define SUBL_ABI_VERSION 1
+
+/* Status codes returned by every fallible function. */
+typedef enum subl_status {
+    SUBL_OK = 0,
+    SUBL_ERR_INVALID_ARGUMENT = 1, /* NULL pointer, bad size or option */
+    SUBL_ERR_INVALID_HANDLE = 2,   /* Unknown or freed handle */
+    SUBL_ERR_IO = 3,               /* Model file could not be read */
+    SUBL_ERR_INVALID_MODEL = 4,    /* Corrupt or unsupported model file */
+    SUBL_ERR_SIGNATURE = 5,        /* Model unsigned or signature invalid */
+    SUBL_ERR_INPUT_TOO_LARGE = 6,  /* Input exceeds subl_input_bytes */
+    SUBL_ERR_OUTPUT_TOO_SMALL = 7, /* Output buffer below subl_output_bytes */
+    SUBL_ERR_ARENA_EXHAUSTED = 8,  /* arena_bytes too small for the model */
+    SUBL_ERR_EXECUTION = 9         /* Any other engine failure */
+} subl_status;
+
+/* Handle of a loaded model; 0 is never a valid handle. */
+typedef uint64_t subl_handle;
+
+/* subl_options flags. */
+#define SUBL_FLAG_DETERMINISTIC 0x1u /* One worker, bit-identical runs */
+#define SUBL_FLAG_CHUNKED_INPUT 0x2u /* Run inputs larger than the window in chunks */
+
+/* Engine configuration; zero fields select defaults. */
+typedef struct subl_options {
+    uint32_t struct_size;       /* sizeof(subl_options) */
+    uint32_t workers;           /* Worker threads; 0 = one per CPU */
+    uint64_t arena_bytes;       /* Arena size; 0 = sized from the model */
+    uint64_t input_bytes;       /* Streaming window; 0 = sized from the model */
+    uint32_t flags;             /* SUBL_FLAG_* */
+    uint32_t reserved;          /* Must be 0 */
+    const char *public_key_pem; /* Ed25519 key models must be signed by; NULL accepts unsigned */
+} subl_options;
+
+#define SUBL_OPTIONS_INIT { sizeof(subl_options), 0, 0, 0, 0, 0, NULL }
+
+/* Returns SUBL_ABI_VERSION of the library, to check against the header. */
+uint32_t subl_abi_version(void);
+
+/* Returns a static description of a status code. */
+const char *subl_status_string(subl_status status);
+
+/*
+ * Returns the message of the last failed call made on the calling thread,
+ * or "" if there is none. The string is owned by the library and valid
+ * until the next call on the thread. Successful calls leave it unchanged.
+ */
+const char *subl_last_error(void);
+
+#ifndef SUBL_NO_PROTOTYPES
+
+/*
+ * Loads a .subl model and builds its engine, verifying section checksums
+ * and, when opts->public_key_pem is set, the signature. opts may be NULL.
+ * On success *out receives the handle.
+ */
+subl_status subl_load(const char *path, const subl_options *opts, subl_handle *out);
+
+/*
+ * Runs the model on input_len bytes of input and copies the output into
+ * output. The input holds the data of the inputs the model declares back to
+ * back, in declaration order; a shorter input fails with
+ * SUBL_ERR_INVALID_ARGUMENT. The output holds the declared outputs the same
+ * way, or the output of the last node of a model declaring none.
+ * *output_len receives the output size, also when the call fails with
+ * SUBL_ERR_OUTPUT_TOO_SMALL, so passing a NULL output with capacity 0
+ * queries it.
+ */
+subl_status subl_execute(subl_handle model, const void *input, size_t input_len,
+                         void *output, size_t output_cap, size_t *output_len);
+
+/* Arena size, streaming window size and output size of a model; 0 for an invalid handle. */
+size_t subl_arena_bytes(subl_handle model);
+size_t subl_input_bytes(subl_handle model);
+size_t subl_output_bytes(subl_handle model);
+
+/* Waits for executions in flight, then releases the model and its arena. */
+subl_status subl_free(subl_handle model);
+
+#endif /* SUBL_NO_PROTOTYPES */
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* SUBLATION_H */
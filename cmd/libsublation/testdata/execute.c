@@ -0,0 +1,39 @@
+// Runs a model on the float32 values given after its path and prints the
+// float32 values of its output, one per line.
+
+#include <stdio.h>
+#include <stdlib.h>
+
+#include "sublation.h"
+
+int main(int argc, char **argv) {
+    if (argc < 2) {
+        fprintf(stderr, "usage: execute model.subl [value...]\n");
+        return 2;
+    }
+    subl_handle model;
+    if (subl_load(argv[1], NULL, &model) != SUBL_OK) {
+        fprintf(stderr, "load: %s\n", subl_last_error());
+        return 1;
+    }
+
+    size_t n = argc - 2;
+    float *input = calloc(n + 1, sizeof(float));
+    for (size_t i = 0; i < n; i++) {
+        input[i] = strtof(argv[i + 2], NULL);
+    }
+    size_t output_len = subl_output_bytes(model);
+    float *output = calloc(output_len / sizeof(float) + 1, sizeof(float));
+    subl_status status = subl_execute(model, input, n * sizeof(float), output, output_len, &output_len);
+    if (status != SUBL_OK) {
+        fprintf(stderr, "execute: %s: %s\n", subl_status_string(status), subl_last_error());
+        return 1;
+    }
+    for (size_t i = 0; i < output_len / sizeof(float); i++) {
+        printf("%g\n", output[i]);
+    }
+
+    free(input);
+    free(output);
+    return subl_free(model) == SUBL_OK ? 0 : 1;
+}
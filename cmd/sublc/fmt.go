@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sbl8/sublation/compiler"
+)
+
+// runFmt implements "sublc fmt [-l] [-w] [file...]", which formats .subs
+// files with compiler.FormatSpec like gofmt: to stdout by default, stdin
+// when no file is given. It returns the exit code.
+func runFmt(args []string) int {
+	fs := flag.NewFlagSet("sublc fmt", flag.ContinueOnError)
+	list := fs.Bool("l", false, "List files whose formatting differs instead of printing them")
+	write := fs.Bool("w", false, "Write the result to the source file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s fmt [-l] [-w] [file.subs...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "sublc fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = formatFile("<standard input>", src, *list, false)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sublc fmt: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	code := 0
+	for _, path := range fs.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = formatFile(path, src, *list, *write)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sublc fmt: %v\n", err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// formatFile formats the contents of path, listing, rewriting or printing
+// the result
+func formatFile(path string, src []byte, list, write bool) error {
+	out, err := compiler.FormatSpec(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	changed := !bytes.Equal(src, out)
+	if list && changed {
+		fmt.Println(path)
+	}
+	switch {
+	case write && changed:
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, out, info.Mode().Perm())
+	case !list && !write:
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	return nil
+}
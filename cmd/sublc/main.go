@@ -1,47 +1,438 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/internal/config"
+	"github.com/sbl8/sublation/internal/exit"
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/model"
 )
 
-func main() {
-	var (
-		optimize = flag.Bool("O", false, "Enable layout optimizations")
-		validate = flag.Bool("validate", true, "Validate graph structure")
-		debug    = flag.Bool("debug", false, "Include debug symbols")
-		version  = flag.Bool("version", false, "Show version information")
-	)
+// metaFlags collects repeated -meta key=value flags.
+type metaFlags model.Metadata
+
+func (m metaFlags) String() string {
+	pairs := make([]string, 0, len(m))
+	for _, k := range model.Metadata(m).Keys() {
+		pairs = append(pairs, k+"="+m[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m metaFlags) Set(value string) error {
+	key, v, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("want key=value, got %q", value)
+	}
+	m[key] = v
+	return nil
+}
+
+// warningFlags collects repeated -W flags into warning severities.
+type warningFlags map[compiler.WarningClass]compiler.Severity
+
+func (w warningFlags) String() string { return "" }
+
+func (w warningFlags) Set(value string) error {
+	return compiler.ParseWarningFlag(value, w)
+}
+
+// compileFlags holds the command line flags of a compilation
+type compileFlags struct {
+	meta       metaFlags
+	severities warningFlags
+	optimize   bool
+	optimize2  bool
+	verbose    bool
+	report     string
+	validate   bool
+	werror     bool
+	strict     bool
+	debug      bool
+	sign       string
+	compress   string
+	dot        string
+	mermaid    string
+	prune      string
+	weights    string
+	from       string
+	emit       string
+	quantize   string
+	calib      string
+	target     string
+	plan       bool
+	watch      bool
+	extract    string
+	apply      string
+	config     string
+	errFormat  string
+	version    bool
+}
+
+// parseFlags registers the flags of sublc and parses the command line
+func parseFlags() *compileFlags {
+	f := &compileFlags{meta: metaFlags{}, severities: warningFlags{}}
+	flag.Var(f.meta, "meta", "Metadata key=value to record in the model (repeatable)")
+	flag.Var(f.severities, "W", "Warning class to enable, no-<class> to disable or error=<class> to fail on; all for every class (repeatable)")
+	flag.BoolVar(&f.optimize, "O", false, "Enable optimizations: constant folding, algebraic simplification, dead code elimination and node layout")
+	flag.BoolVar(&f.optimize2, "O2", false, "Like -O, and also fuse kernel chains such as matmul+add+relu into fused kernels")
+	flag.BoolVar(&f.verbose, "verbose", false, "Report each compilation step and what -O changed, like -report text")
+	flag.StringVar(&f.report, "report", "", "Print the compile report, each step with its timing and effect: text or json")
+	flag.BoolVar(&f.validate, "validate", true, "Validate graph structure")
+	flag.BoolVar(&f.werror, "Werror", false, "Treat warnings about the source as errors")
+	flag.BoolVar(&f.strict, "strict", false, "Same as -Werror")
+	flag.BoolVar(&f.debug, "debug", false, "Include debug symbols")
+	flag.StringVar(&f.sign, "sign", "", "Sign the output with this PEM Ed25519 private key")
+	flag.StringVar(&f.compress, "compress", "none", "Section compression: none, lz4, deflate or zstd")
+	flag.StringVar(&f.dot, "dot", "", "Also write the compiled graph in Graphviz DOT format to this file")
+	flag.StringVar(&f.mermaid, "mermaid", "", "Also write the compiled graph as a Mermaid flowchart to this file")
+	flag.StringVar(&f.prune, "prune-outputs", "", "Keep only these comma-separated output node IDs and their dependencies")
+	flag.StringVar(&f.weights, "weights", "", "Fill the named payload segments from this .safetensors file")
+	flag.StringVar(&f.from, "from", "native", "Source format: native (.subs), json or gguf")
+	flag.StringVar(&f.emit, "emit", "native", "Output format: native (.subl), json or onnx")
+	flag.StringVar(&f.quantize, "quantize", "", "Quantize matmul weights: int8")
+	flag.StringVar(&f.calib, "calib", "", "With -quantize, calibrate activation ranges on the samples of this .npy or .npz file")
+	flag.StringVar(&f.target, "target", "generic", "ISA profile selecting kernel variants and alignment: generic, avx2, avx512 or neon")
+	flag.BoolVar(&f.plan, "plan", false, "Print the resolved graph, payload layout, arena size and scheduler levels instead of writing output")
+	flag.BoolVar(&f.watch, "watch", false, "Recompile whenever the source, a file it includes or reads, or the -weights file changes")
+	flag.StringVar(&f.extract, "extract-weights", "", "Instead of compiling, write the weight and bias segments of the compiled <model.subl> to this checkpoint file")
+	flag.StringVar(&f.apply, "apply-weights", "", "Instead of compiling, load this checkpoint into the compiled <model.subl> and write the result to <out.subl>")
+	flag.StringVar(&f.config, "config", "", "Take defaults for -target, -O and -O2 from this file instead of the sublation.toml or sublation.yaml found from the working directory; none for no file")
+	flag.StringVar(&f.errFormat, "error-format", "text", "Report the error sublc exits on as text, or as a JSON object on stderr with its exit code, kind and diagnostics")
+	flag.BoolVar(&f.version, "version", false, "Show version information")
 	flag.Parse()
+	return f
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(runFmt(os.Args[2:]))
+	}
 
-	if *version {
-		fmt.Println("sublc - Sublation Compiler v1.0.0")
-		fmt.Println("Built with Go", "1.22.2")
+	f := parseFlags()
+	if f.version {
+		version.Print(os.Stdout, "sublc")
 		return
 	}
 
+	if err := exit.SetFormat(f.errFormat); err != nil {
+		exit.Fatalf(exit.Usage, "invalid -error-format: %v", err)
+	}
+	if err := applyConfig(f.config); err != nil {
+		exit.Fatalf(exit.Classify(err, exit.Usage), "Invalid config: %v", err)
+	}
+
 	args := flag.Args()
-	if len(args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <src.subs> <out.subl>\n", os.Args[0])
-		flag.PrintDefaults()
-		os.Exit(1)
+	if len(args) < 2 && !((f.plan || f.extract != "") && len(args) == 1) {
+		usage()
 	}
+	srcFile := args[0]
+	opts, reportFormat := f.options()
 
-	srcFile, outFile := args[0], args[1]
+	if f.extract != "" || f.apply != "" {
+		f.runWeights(args, opts)
+		return
+	}
+
+	if f.plan {
+		g, rep, err := compiler.Build(srcFile, opts)
+		printReport(rep, reportFormat)
+		if err != nil {
+			fatalCompile(err, rep)
+		}
+		if err := writePlan(os.Stdout, srcFile, g); err != nil {
+			exit.Fatalf(exit.IO, "failed to plan %s: %v", srcFile, err)
+		}
+		return
+	}
+
+	outFile := args[1]
+	if f.watch {
+		watchSource(srcFile, outFile, opts, reportFormat, func() error { return writeDiagrams(outFile, opts.Emit, f.dot, f.mermaid) })
+		return
+	}
+	rep, err := compiler.CompileWithOptions(srcFile, outFile, opts)
+	printReport(rep, reportFormat)
+	if err != nil {
+		fatalCompile(err, rep)
+	}
+
+	if reportFormat != "json" {
+		fmt.Printf("Successfully compiled %s -> %s\n", srcFile, outFile)
+	}
+
+	if err := writeDiagrams(outFile, opts.Emit, f.dot, f.mermaid); err != nil {
+		exit.Fatal(exit.Classify(err, exit.Failure), err.Error())
+	}
+}
+
+// usage prints how to call sublc and exits with the usage code
+func usage() {
+	if exit.JSON() {
+		exit.Fatalf(exit.Usage, "want <src.subs> <out.subl> arguments, <src.subs> with -plan or <model.subl> with -extract-weights")
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <src.subs> <out.subl>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -plan [options] <src.subs>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -watch [options] <src.subs> <out.subl>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -extract-weights <out.sublw> <model.subl>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -apply-weights <in.sublw> [-compress c] [-sign key] <model.subl> <out.subl>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s fmt [-l] [-w] [file.subs...]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(int(exit.Usage))
+}
+
+// options checks the flags and returns the compile options they select
+// and the -report format, text for -verbose
+func (f *compileFlags) options() (compiler.CompileOptions, string) {
+	compression, err := model.ParseCompression(f.compress)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "invalid -compress: %v", err)
+	}
+
+	pruneOutputs, err := parseNodeIDs(f.prune)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "invalid -prune-outputs: %v", err)
+	}
+	fromFormat, err := compiler.ParseFormat(f.from)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "invalid -from: %v", err)
+	}
+	emitFormat, err := compiler.ParseFormat(f.emit)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "invalid -emit: %v", err)
+	}
+	targetProfile, err := model.ParseTarget(f.target)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "invalid -target: %v", err)
+	}
+	if emitFormat == compiler.FormatONNX && (f.dot != "" || f.mermaid != "") {
+		exit.Fatalf(exit.Usage, "-dot and -mermaid cannot be used with -emit onnx")
+	}
 
 	opts := compiler.CompileOptions{
-		OptimizeLayout: *optimize,
-		ValidateGraph:  *validate,
-		DebugOutput:    *debug,
+		OptimizeLayout: f.optimize || f.optimize2,
+		FoldConstants:  f.optimize || f.optimize2,
+		FuseKernels:    f.optimize2,
+		EliminateDead:  f.optimize || f.optimize2,
+		Strict:         f.werror || f.strict,
+		Severities:     f.severities,
+		Warnings:       os.Stderr,
+		ValidateGraph:  f.validate,
+		DebugOutput:    f.debug,
+		Compression:    compression,
+		Metadata:       model.Metadata(f.meta),
+		PruneOutputs:   pruneOutputs,
+		Weights:        f.weights,
+		From:           fromFormat,
+		Emit:           emitFormat,
+		Target:         targetProfile,
+	}
+	reportFormat := f.report
+	if reportFormat == "" && f.verbose {
+		reportFormat = "text"
 	}
+	if reportFormat != "" && reportFormat != "text" && reportFormat != "json" {
+		exit.Fatalf(exit.Usage, "invalid -report %q, want text or json", reportFormat)
+	}
+	if f.watch && f.plan {
+		exit.Fatalf(exit.Usage, "-watch cannot be used with -plan")
+	}
+	if f.calib != "" && f.quantize == "" {
+		exit.Fatalf(exit.Usage, "-calib requires -quantize")
+	}
+	if f.quantize != "" {
+		pass, err := quantizePass(f.quantize, f.calib, quantizeLog(f.verbose))
+		if err != nil {
+			exit.Fatalf(exit.Usage, "invalid -quantize: %v", err)
+		}
+		opts.ExtraPasses = append(opts.ExtraPasses, pass)
+	}
+	if _, ok := f.meta[model.MetaCreated]; !ok {
+		f.meta[model.MetaCreated] = buildTime().Format(time.RFC3339)
+	}
+	if f.sign != "" {
+		pemData, err := os.ReadFile(f.sign)
+		if err != nil {
+			exit.Fatalf(exit.IO, "failed to read signing key: %v", err)
+		}
+		if opts.SigningKey, err = model.ParsePrivateKey(pemData); err != nil {
+			exit.Fatalf(exit.Parse, "invalid signing key %s: %v", f.sign, err)
+		}
+	}
+	return opts, reportFormat
+}
+
+// runWeights runs -extract-weights or -apply-weights on the compiled
+// model args[0]
+func (f *compileFlags) runWeights(args []string, opts compiler.CompileOptions) {
+	if (f.extract != "" && f.apply != "") || f.plan || f.watch {
+		exit.Fatalf(exit.Usage, "-extract-weights, -apply-weights, -plan and -watch cannot be combined")
+	}
+	var err error
+	if f.extract != "" {
+		err = extractWeights(args[0], f.extract)
+	} else {
+		err = applyWeights(f.apply, args[0], args[1], model.SerializeOptions{Compression: opts.Compression, SigningKey: opts.SigningKey})
+	}
+	if err != nil {
+		exit.Fatal(exit.Classify(err, exit.Validation), err.Error())
+	}
+}
 
-	if err := compiler.CompileWithOptions(srcFile, outFile, opts); err != nil {
-		log.Fatalf("compilation failed: %v", err)
+// writeDiagrams renders the model compiled to outFile as the -dot and
+// -mermaid diagrams, when set
+func writeDiagrams(outFile string, emit compiler.Format, dot, mermaid string) error {
+	if dot == "" && mermaid == "" {
+		return nil
 	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", outFile, err)
+	}
+	graph := new(model.Graph)
+	if emit == compiler.FormatJSON {
+		err = json.Unmarshal(data, graph)
+	} else {
+		graph, err = model.Deserialize(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", outFile, err)
+	}
+	if err := writeDiagram(dot, graph.ToDOT); err != nil {
+		return fmt.Errorf("failed to write DOT graph: %w", err)
+	}
+	if err := writeDiagram(mermaid, graph.ToMermaid); err != nil {
+		return fmt.Errorf("failed to write Mermaid graph: %w", err)
+	}
+	return nil
+}
 
-	fmt.Printf("Successfully compiled %s -> %s\n", srcFile, outFile)
+// printReport prints the compile report in the -report format, if any
+func printReport(r *compiler.CompileReport, format string) {
+	var err error
+	switch format {
+	case "":
+		return
+	case "json":
+		err = r.WriteJSON(os.Stdout)
+	default:
+		err = r.WriteText(os.Stdout)
+	}
+	if err != nil {
+		exit.Fatalf(exit.IO, "failed to print the compile report: %v", err)
+	}
+}
+
+// quantizeLog returns where the quantization pass reports, stdout in
+// verbose mode
+func quantizeLog(verbose bool) io.Writer {
+	if verbose {
+		return os.Stdout
+	}
+	return io.Discard
+}
+
+// fatalCompile reports a compilation error, syntax errors with excerpts,
+// and exits with the code of the step that failed
+func fatalCompile(err error, rep *compiler.CompileReport) {
+	var syntax compiler.ErrorList
+	isSyntax := errors.As(err, &syntax)
+	code := exit.Validation
+	switch rep.FailedStep {
+	case "parse":
+		code = exit.Classify(err, exit.Parse)
+	case "write", "weights":
+		code = exit.Classify(err, exit.Validation)
+	case "":
+		// Warnings made errors by -W or -strict fail between the steps
+		code = exit.Parse
+		if !isSyntax {
+			code = exit.Classify(err, exit.Failure)
+		}
+	}
+	if !isSyntax {
+		exit.Fatalf(code, "compilation failed: %v", err)
+	}
+	if !exit.JSON() {
+		compiler.PrintErrors(os.Stderr, err)
+	}
+	diags := make([]exit.Diagnostic, len(syntax))
+	for i, e := range syntax {
+		diags[i] = exit.Diagnostic{File: e.File, Line: e.Line, Col: e.Col, Message: e.Msg}
+	}
+	exit.Fatal(code, fmt.Sprintf("compilation failed: %d errors", len(syntax)), diags...)
+}
+
+// buildTime returns the time recorded as the model creation time:
+// SOURCE_DATE_EPOCH when set, for reproducible builds, or now
+func buildTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Now().UTC()
+}
+
+// parseNodeIDs parses a comma-separated list of node IDs; "" is none
+func parseNodeIDs(list string) ([]uint32, error) {
+	var ids []uint32
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node ID %q", f)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
+
+// writeDiagram renders a graph diagram to path, if path is set
+func writeDiagram(path string, render func(io.Writer) error) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := render(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// applyConfig sets the flags not given on the command line from the
+// project config file: target, and opt_level as -O (1) or -O2 (2)
+func applyConfig(path string) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Apply(flag.CommandLine, map[string]string{"target": "target"}); err != nil {
+		return err
+	}
+	level, ok := cfg.Get("opt_level")
+	if set := config.Explicit(flag.CommandLine); !ok || set["O"] || set["O2"] {
+		return nil
+	}
+	switch level {
+	case "1":
+		return flag.Set("O", "true")
+	case "2":
+		return flag.Set("O2", "true")
+	}
+	return nil
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+// payloadRange is a byte range of the payload and the nodes computing on it
+type payloadRange struct {
+	in, out uint32
+	label   string
+	nodes   []string
+}
+
+// writePlan prints what the compiler decided for g: the node table with
+// kernel names and shapes, the payload layout, the arena size the runtime
+// would allocate with default options and the scheduler levels
+func writePlan(w io.Writer, src string, g *model.Graph) error {
+	levels, err := g.Levels()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "plan for %s: %d nodes, %d bytes payload, %d segments, %d levels\n",
+		src, len(g.Nodes), len(g.Payload), len(g.Segments), len(levels))
+	fmt.Fprintf(w, "target: %v, %d-byte alignment\n", g.Target, g.Target.Profile().Align)
+	fmt.Fprintf(w, "arena: %d bytes with default engine options\n", runtime.EstimateArenaSize(g, nil))
+
+	fmt.Fprintln(w, "\nnodes:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  ID\tKERNEL\tPAYLOAD\tSHAPE\tFLAGS\tDEPS")
+	for _, n := range g.Nodes {
+		shape := "?"
+		if s, ok := g.Shapes[n.ID]; ok {
+			shape = fmt.Sprint(s)
+		}
+		fmt.Fprintf(tw, "  %d\t%s\t[%d, %d)\t%s\t0x%02x\t%s\n",
+			n.ID, kernels.OpName(n.Kernel), n.In, n.Out, shape, n.Flags, nodeDeps(n))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\npayload layout:")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, r := range payloadRanges(g) {
+		fmt.Fprintf(tw, "  [%d, %d)\t%d B\t%s\t%s\n", r.in, r.out, r.out-r.in, r.label, strings.Join(r.nodes, " "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nlevels:")
+	for l, indices := range levels {
+		ids := make([]string, len(indices))
+		for k, i := range indices {
+			ids[k] = fmt.Sprint(g.Nodes[i].ID)
+		}
+		fmt.Fprintf(w, "  %d: %s\n", l, strings.Join(ids, " "))
+	}
+	return nil
+}
+
+// nodeDeps lists the IDs a node consumes, or "-"
+func nodeDeps(n model.Node) string {
+	var deps []string
+	for _, d := range n.Topo {
+		if d != model.NoNeighbor {
+			deps = append(deps, fmt.Sprint(d))
+		}
+	}
+	if len(deps) == 0 {
+		return "-"
+	}
+	return strings.Join(deps, ",")
+}
+
+// payloadRanges returns the segments and the raw node ranges of the
+// payload, ordered by offset, each with the nodes using it
+func payloadRanges(g *model.Graph) []payloadRange {
+	var ranges []payloadRange
+	index := make(map[string]int)
+	add := func(key string, r payloadRange) int {
+		i, ok := index[key]
+		if !ok {
+			i = len(ranges)
+			index[key] = i
+			ranges = append(ranges, r)
+		}
+		return i
+	}
+	for _, s := range g.Segments {
+		label := fmt.Sprintf("segment %d %v %v", s.ID, s.Role, s.DType)
+		if s.Name != "" {
+			label += " " + s.Name
+		}
+		add(fmt.Sprint("s", s.ID), payloadRange{in: s.Offset, out: s.End(), label: label})
+	}
+	for _, n := range g.Nodes {
+		key := fmt.Sprint("s", n.Segment)
+		if _, ok := index[key]; n.Segment == 0 || !ok {
+			if n.Out <= n.In {
+				continue
+			}
+			key = fmt.Sprintf("r%d-%d", n.In, n.Out)
+			add(key, payloadRange{in: n.In, out: n.Out, label: "raw"})
+		}
+		i := index[key]
+		ranges[i].nodes = append(ranges[i].nodes, fmt.Sprintf("node %d", n.ID))
+	}
+	slices.SortStableFunc(ranges, func(a, b payloadRange) int {
+		return cmp.Or(cmp.Compare(a.in, b.in), cmp.Compare(a.out, b.out))
+	})
+	return ranges
+}
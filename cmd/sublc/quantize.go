@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// quantizePass returns the pass -quantize adds after the compiler's own:
+// it runs the float graph over the samples of calib, when set, and
+// rewrites its matmuls to int8 with the observed activation ranges,
+// reporting what it did to log
+func quantizePass(mode, calib string, log io.Writer) (compiler.Pass, error) {
+	if mode != "int8" {
+		return nil, fmt.Errorf("unknown mode %q (want int8)", mode)
+	}
+	var batch map[string]ioutil.Tensor
+	if calib != "" {
+		var err error
+		if batch, err = ioutil.ReadFile(calib); err != nil {
+			return nil, fmt.Errorf("calibration data: %w", err)
+		}
+	}
+	return compiler.NewPass("quantize-int8", func(g *model.Graph) error {
+		var ranges map[uint32]model.Range
+		if batch != nil {
+			var samples int
+			var err error
+			if ranges, samples, err = ioutil.Calibrate(g, batch); err != nil {
+				return err
+			}
+			fmt.Fprintf(log, "Calibrated %d node ranges over %d samples of %s\n", len(ranges), samples, calib)
+		}
+		n, err := g.QuantizeInt8(ranges)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(log, "Quantized %d matmul nodes to int8\n", n)
+		return nil
+	}), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/sbl8/sublation/compiler"
+)
+
+// watchInterval is how often -watch polls the source files for changes
+const watchInterval = 500 * time.Millisecond
+
+// fileState is what -watch compares to notice that a file changed
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// watchSource compiles src to out, then again whenever one of the files
+// the compilation reads changes, until interrupted. Errors are reported
+// and the previous output is left in place; the report of each build is
+// printed in the -report format, and after runs after each successful
+// build.
+func watchSource(src, out string, opts compiler.CompileOptions, reportFormat string, after func() error) {
+	for {
+		// Stat before compiling, so edits made during the build are
+		// picked up by the next one
+		files, _ := compiler.SourceFiles(src, opts)
+		states := statFiles(files)
+
+		rep, err := compiler.CompileWithOptions(src, out, opts)
+		printReport(rep, reportFormat)
+		if err != nil {
+			reportWatchError(err)
+		} else if err := after(); err != nil {
+			log.Print(err)
+		} else {
+			log.Printf("Compiled %s -> %s in %v", src, out, rep.Duration.Round(time.Microsecond))
+		}
+		log.Printf("Watching %d files for changes", len(files))
+
+		for !changed(files, states) {
+			time.Sleep(watchInterval)
+		}
+	}
+}
+
+// reportWatchError prints a failed build, syntax errors with excerpts
+func reportWatchError(err error) {
+	var syntax compiler.ErrorList
+	if errors.As(err, &syntax) {
+		compiler.PrintErrors(os.Stderr, err)
+		log.Printf("compilation failed: %d errors", len(syntax))
+		return
+	}
+	log.Printf("compilation failed: %v", err)
+}
+
+// statFiles records the state of each file
+func statFiles(files []string) []fileState {
+	states := make([]fileState, len(files))
+	for i, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			states[i] = fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+		}
+	}
+	return states
+}
+
+// changed reports whether a file differs from its recorded state
+func changed(files []string, states []fileState) bool {
+	now := statFiles(files)
+	for i := range now {
+		if now[i] != states[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// readModel reads a compiled .subl model
+func readModel(path string) (*model.Graph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := model.Deserialize(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return g, nil
+}
+
+// extractWeights writes the parameter segments of the compiled model at
+// modelPath to a weights checkpoint at out
+func extractWeights(modelPath, out string) error {
+	g, err := readModel(modelPath)
+	if err != nil {
+		return err
+	}
+	w, err := g.ExtractWeights()
+	if err != nil {
+		return err
+	}
+	data, err := w.Serialize()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Extracted %d weight segments of %s -> %s\n", len(w.Tensors), modelPath, out)
+	return nil
+}
+
+// applyWeights loads the weights checkpoint at weightsPath into the
+// compiled model at modelPath and writes the result to out
+func applyWeights(weightsPath, modelPath, out string, opts model.SerializeOptions) error {
+	g, err := readModel(modelPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(weightsPath)
+	if err != nil {
+		return err
+	}
+	w, err := model.ReadWeights(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", weightsPath, err)
+	}
+	if err := g.ApplyWeights(w); err != nil {
+		return fmt.Errorf("%s: %w", weightsPath, err)
+	}
+	serialized, err := g.SerializeWithOptions(opts)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, serialized, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Applied %d weight segments of %s to %s -> %s\n", len(w.Tensors), weightsPath, modelPath, out)
+	return nil
+}
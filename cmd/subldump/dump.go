@@ -0,0 +1,275 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// dump is what subldump prints about a model, as text tables or as JSON
+type dump struct {
+	File     string         `json:"file"`
+	Size     int            `json:"size"`
+	Version  int            `json:"version"` // 0 for the headerless legacy layout
+	Flags    uint16         `json:"flags"`
+	Target   string         `json:"target"`
+	Payload  int            `json:"payload_size"`
+	Sections []dumpSection  `json:"sections,omitempty"` // Version 2 files only
+	Nodes    []dumpNode     `json:"nodes"`
+	Levels   [][]uint32     `json:"levels,omitempty"` // Node IDs the scheduler runs together
+	Segments []dumpSegment  `json:"segments,omitempty"`
+	IO       []dumpIO       `json:"io,omitempty"`
+	Metadata model.Metadata `json:"metadata,omitempty"`
+
+	levelsErr error // Why levels is empty, such as a cycle
+	graph     *model.Graph
+}
+
+type dumpSection struct {
+	Tag         string `json:"tag"`
+	Offset      int    `json:"offset"`
+	Size        int    `json:"size"`
+	RawSize     int    `json:"raw_size"`
+	Compression string `json:"compression"`
+}
+
+type dumpNode struct {
+	ID      uint32   `json:"id"`
+	Kernel  uint8    `json:"kernel"`
+	Op      string   `json:"op"`
+	In      uint32   `json:"in"`
+	Out     uint32   `json:"out"`
+	Segment uint32   `json:"segment,omitempty"`
+	Flags   uint32   `json:"flags,omitempty"`
+	Deps    []uint32 `json:"deps,omitempty"`
+	Shape   []int    `json:"shape,omitempty"`
+	Name    string   `json:"name,omitempty"`   // Debug symbol
+	Source  string   `json:"source,omitempty"` // Debug symbol, file:line
+	FLOPs   uint64   `json:"flops,omitempty"`
+	Nanos   uint64   `json:"nanos,omitempty"`
+}
+
+type dumpSegment struct {
+	ID     uint32 `json:"id"`
+	Offset uint32 `json:"offset"`
+	Length uint32 `json:"length"`
+	Role   string `json:"role"`
+	DType  string `json:"dtype"`
+	Name   string `json:"name,omitempty"`
+	Source string `json:"source,omitempty"` // Debug symbol, file:line
+}
+
+type dumpIO struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Node  uint32 `json:"node"`
+	DType string `json:"dtype"`
+	Shape []int  `json:"shape"`
+}
+
+// newDump collects what there is to print about g, read from a file of
+// size bytes in the given format version
+func newDump(file string, size, version int, sections []model.SectionInfo, g *model.Graph) *dump {
+	d := &dump{
+		File:     file,
+		Size:     size,
+		Version:  version,
+		Flags:    g.Flags,
+		Target:   g.Target.String(),
+		Payload:  len(g.Payload),
+		Metadata: g.Metadata(),
+		graph:    g,
+	}
+	for _, s := range sections {
+		d.Sections = append(d.Sections, dumpSection{Tag: s.Tag, Offset: s.Offset, Size: s.Size, RawSize: s.RawSize, Compression: s.Compression.String()})
+	}
+
+	var symbols model.DebugInfo
+	if g.Debug != nil {
+		symbols = *g.Debug
+	}
+	for _, n := range g.Nodes {
+		cost := g.Costs[n.ID]
+		dn := dumpNode{
+			ID:      n.ID,
+			Kernel:  n.Kernel,
+			Op:      kernels.OpName(n.Kernel),
+			In:      n.In,
+			Out:     n.Out,
+			Segment: n.Segment,
+			Flags:   n.Flags,
+			Shape:   g.Shapes[n.ID],
+			Name:    symbols.Nodes[n.ID].Name,
+			Source:  symbols.Nodes[n.ID].Pos(),
+			FLOPs:   cost.FLOPs,
+			Nanos:   cost.Nanos,
+		}
+		for _, dep := range n.Topo {
+			if dep != model.NoNeighbor {
+				dn.Deps = append(dn.Deps, dep)
+			}
+		}
+		d.Nodes = append(d.Nodes, dn)
+	}
+
+	levels, err := g.Levels()
+	d.levelsErr = err
+	for _, indices := range levels {
+		ids := make([]uint32, len(indices))
+		for k, i := range indices {
+			ids[k] = g.Nodes[i].ID
+		}
+		d.Levels = append(d.Levels, ids)
+	}
+
+	for _, s := range g.Segments {
+		name := s.Name
+		if name == "" {
+			name = symbols.Segments[s.ID].Name
+		}
+		d.Segments = append(d.Segments, dumpSegment{
+			ID:     s.ID,
+			Offset: s.Offset,
+			Length: s.Length,
+			Role:   s.Role.String(),
+			DType:  s.DType.String(),
+			Name:   name,
+			Source: symbols.Segments[s.ID].Pos(),
+		})
+	}
+	slices.SortStableFunc(d.Segments, func(a, b dumpSegment) int {
+		return cmp.Or(cmp.Compare(a.Offset, b.Offset), cmp.Compare(a.ID, b.ID))
+	})
+
+	for _, s := range g.IO {
+		d.IO = append(d.IO, dumpIO{Name: s.Name, Kind: s.Kind.String(), Node: s.NodeID, DType: s.DType.String(), Shape: s.Shape})
+	}
+	return d
+}
+
+// writeSummary prints the header and how many of everything the model has
+func (d *dump) writeSummary(w io.Writer) {
+	g := d.graph
+	fmt.Fprintf(w, "file:     %s, %d bytes\n", d.File, d.Size)
+	if d.Version == 0 {
+		fmt.Fprintln(w, "format:   headerless legacy layout")
+	} else {
+		fmt.Fprintf(w, "format:   version %d, flags 0x%04x, target %v\n", d.Version, d.Flags, d.Target)
+	}
+	fmt.Fprintf(w, "nodes:    %d\n", len(g.Nodes))
+	fmt.Fprintf(w, "payload:  %d bytes\n", len(g.Payload))
+	fmt.Fprintf(w, "io:       %d inputs, %d outputs\n", len(g.Inputs()), len(g.Outputs()))
+	fmt.Fprintf(w, "metadata: %d keys\n", len(g.Meta))
+	fmt.Fprintf(w, "segments: %d\n", len(g.Segments))
+	measured := 0
+	for _, c := range g.Costs {
+		if c.Nanos > 0 {
+			measured++
+		}
+	}
+	fmt.Fprintf(w, "costs:    %d nodes, %d measured\n", len(g.Costs), measured)
+	if g.Debug != nil {
+		fmt.Fprintf(w, "debug:    %d nodes, %d segments\n", len(g.Debug.Nodes), len(g.Debug.Segments))
+	}
+}
+
+// writeTables prints the sections, nodes, levels, segments, IO specs and
+// metadata of the model, leaving out empty tables
+func (d *dump) writeTables(w io.Writer) error {
+	if len(d.Sections) > 0 {
+		fmt.Fprintln(w, "\nsections:")
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  TAG\tOFFSET\tSIZE\tRAW\tCOMPRESSION")
+		for _, s := range d.Sections {
+			fmt.Fprintf(tw, "  %s\t%d\t%d\t%d\t%s\n", s.Tag, s.Offset, s.Size, s.RawSize, s.Compression)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(w, "\nnodes:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  ID\tKERNEL\tPAYLOAD\tSEGMENT\tSHAPE\tFLAGS\tDEPS\tNAME\tSOURCE")
+	for _, n := range d.Nodes {
+		fmt.Fprintf(tw, "  %d\t%s\t[%d, %d)\t%s\t%s\t0x%02x\t%s\t%s\t%s\n", n.ID, n.Op, n.In, n.Out,
+			orDash(n.Segment), shapeText(n.Shape), n.Flags, joinIDs(n.Deps, ","), cmp.Or(n.Name, "-"), cmp.Or(n.Source, "-"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nlevels:")
+	if d.levelsErr != nil {
+		fmt.Fprintf(w, "  %v\n", d.levelsErr)
+	}
+	for l, ids := range d.Levels {
+		fmt.Fprintf(w, "  %d: %s\n", l, joinIDs(ids, " "))
+	}
+
+	if len(d.Segments) > 0 {
+		fmt.Fprintln(w, "\nsegments:")
+		tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  ID\tRANGE\tBYTES\tROLE\tDTYPE\tNAME\tSOURCE")
+		for _, s := range d.Segments {
+			fmt.Fprintf(tw, "  %d\t[%d, %d)\t%d\t%s\t%s\t%s\t%s\n", s.ID, s.Offset, s.Offset+s.Length, s.Length,
+				s.Role, s.DType, cmp.Or(s.Name, "-"), cmp.Or(s.Source, "-"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.IO) > 0 {
+		fmt.Fprintln(w, "\nio:")
+		tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, s := range d.IO {
+			fmt.Fprintf(tw, "  %s\t%s\t%s%s\tnode %d\n", s.Kind, s.Name, s.DType, shapeText(s.Shape), s.Node)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(d.Metadata) > 0 {
+		fmt.Fprintln(w, "\nmetadata:")
+		for _, k := range d.Metadata.Keys() {
+			fmt.Fprintf(w, "  %s: %s\n", k, d.Metadata[k])
+		}
+	}
+	return nil
+}
+
+// orDash formats a segment ID, or "-" for none
+func orDash(id uint32) string {
+	if id == 0 {
+		return "-"
+	}
+	return fmt.Sprint(id)
+}
+
+// shapeText formats a shape as [d0 d1 ...], or "?" when unknown
+func shapeText(shape []int) string {
+	if shape == nil {
+		return "?"
+	}
+	return fmt.Sprint(shape)
+}
+
+// joinIDs joins node IDs with sep, or returns "-" for none
+func joinIDs(ids []uint32, sep string) string {
+	if len(ids) == 0 {
+		return "-"
+	}
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = fmt.Sprint(id)
+	}
+	return strings.Join(s, sep)
+}
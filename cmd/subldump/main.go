@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/model"
+)
+
+func main() {
+	meta := flag.Bool("meta", false, "Print the model metadata only")
+	summary := flag.Bool("summary", false, "Print the header and counts only, without the tables")
+	asJSON := flag.Bool("json", false, "Print the dump as JSON, for scripts")
+	showVer := flag.Bool("version", false, "Show version information")
+	flag.Parse()
+
+	if *showVer {
+		version.Print(os.Stdout, "subldump")
+		return
+	}
+
+	args := flag.Args()
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <model.subl>\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		log.Fatalf("Failed to read model: %v", err)
+	}
+	var graph *model.Graph
+	var sections []model.SectionInfo
+	fileVersion := 0
+	if len(data) >= 6 && binary.LittleEndian.Uint32(data) == model.Magic {
+		fileVersion = int(binary.LittleEndian.Uint16(data[4:]))
+		graph, err = model.Deserialize(data)
+		if err == nil && fileVersion == model.Version2 {
+			sections, err = model.Sections(data)
+		}
+	} else {
+		graph, err = model.DeserializeLegacy(data)
+	}
+	if err != nil {
+		log.Fatalf("Invalid model %s: %v", args[0], err)
+	}
+
+	if *meta {
+		m := graph.Metadata()
+		for _, k := range m.Keys() {
+			fmt.Printf("%s: %s\n", k, m[k])
+		}
+		return
+	}
+
+	d := newDump(args[0], len(data), fileVersion, sections, graph)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			log.Fatalf("Failed to write JSON: %v", err)
+		}
+		return
+	}
+	d.writeSummary(os.Stdout)
+	if !*summary {
+		if err := d.writeTables(os.Stdout); err != nil {
+			log.Fatalf("Failed to write the dump: %v", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/model"
+)
+
+func main() {
+	var (
+		output   = flag.String("o", "", "Write the linked model to this file")
+		verbose  = flag.Bool("verbose", false, "Report what was linked")
+		validate = flag.Bool("validate", true, "Validate the linked graph")
+		emit     = flag.String("emit", "native", "Output format: native (.subl), json or onnx")
+		compress = flag.String("compress", "none", "Section compression: none, lz4, deflate or zstd")
+		sign     = flag.String("sign", "", "Sign the output with this PEM Ed25519 private key")
+		showVer  = flag.Bool("version", false, "Show version information")
+	)
+	args := parseInterspersed(os.Args[1:])
+
+	if *showVer {
+		version.Print(os.Stdout, "subllink")
+		return
+	}
+	if len(args) == 0 || *output == "" {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <a.subl> [b.subl ...] -o <combined.subl>\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	emitFormat, err := compiler.ParseFormat(*emit)
+	if err != nil {
+		log.Fatalf("invalid -emit: %v", err)
+	}
+	compression, err := model.ParseCompression(*compress)
+	if err != nil {
+		log.Fatalf("invalid -compress: %v", err)
+	}
+	opts := compiler.CompileOptions{
+		Verbose:       *verbose,
+		ValidateGraph: *validate,
+		Compression:   compression,
+		Emit:          emitFormat,
+	}
+	if *sign != "" {
+		pemData, err := os.ReadFile(*sign)
+		if err != nil {
+			log.Fatalf("failed to read signing key: %v", err)
+		}
+		if opts.SigningKey, err = model.ParsePrivateKey(pemData); err != nil {
+			log.Fatalf("invalid signing key %s: %v", *sign, err)
+		}
+	}
+
+	if err := compiler.Link(args, *output, opts); err != nil {
+		log.Fatalf("Linking failed: %v", err)
+	}
+	fmt.Printf("Successfully linked %d modules -> %s\n", len(args), *output)
+}
+
+// parseInterspersed parses the flags in args, which may follow the input
+// files as in "subllink a.subl b.subl -o out.subl", and returns the files
+func parseInterspersed(args []string) []string {
+	var files []string
+	for {
+		if err := flag.CommandLine.Parse(args); err != nil {
+			os.Exit(2)
+		}
+		args = flag.Args()
+		if len(args) == 0 {
+			return files
+		}
+		files = append(files, args[0])
+		args = args[1:]
+	}
+}
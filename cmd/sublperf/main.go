@@ -6,25 +6,51 @@ import (
 	"math/rand"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 	"unsafe"
 
+	"github.com/sbl8/sublation/internal/version"
 	"github.com/sbl8/sublation/kernels"
 )
 
 var (
-	testType = flag.String("test", "all", "Test type: all, vector, matrix, activation")
+	testType = flag.String("test", "all", "Test type: all, vector, matrix, activation, memory")
 	size     = flag.Int("size", 1024, "Test data size")
 	iter     = flag.Int("iter", 1000, "Number of iterations")
 	verbose  = flag.Bool("verbose", false, "Verbose output")
+	jsonOut  = flag.String("json", "", "Write the results as JSON to this file")
+	baseline = flag.String("baseline", "", "Compare the results with those of an earlier -json file, exiting with status 2 on regressions")
+	modelArg = flag.String("model", "", "Benchmark full executions of this compiled model instead of the kernels")
+	input    = flag.Int("input", 0, "Bytes of random input per streaming execution with -model (0 uses the engine's streaming window)")
+	thresh   = flag.Float64("threshold", 10, "Percent slowdown against -baseline that counts as a regression")
+	cpuProf  = flag.String("cpuprofile", "", "Write a CPU profile of the benchmarks to this file, for go tool pprof")
+	memProf  = flag.String("memprofile", "", "Write an allocation profile to this file after the benchmarks, for go tool pprof")
+	peakBW   = flag.Float64("peak-bw", 0, "Theoretical memory bandwidth in GB/s (channels x MT/s x 8 bytes / 1000) to compare the memory tests with")
+	showVer  = flag.Bool("version", false, "Show version information")
+	traceOut = flag.String("trace", "", "Write an execution trace of the benchmarks to this file, for go tool trace")
 )
 
 func main() {
 	flag.Parse()
 
+	if *showVer {
+		version.Print(os.Stdout, "sublperf")
+		return
+	}
+
+	var base *benchFile
+	if *baseline != "" {
+		var err error
+		if base, err = readBenchFile(*baseline); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read baseline: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	fmt.Printf("Sublation Performance Analysis Tool\n")
 	fmt.Printf("===================================\n")
-	fmt.Printf("Go Version: %s\n", runtime.Version())
+	fmt.Printf("Version: %v\n", version.Get())
 	fmt.Printf("OS/Arch: %s/%s\n", runtime.GOOS, runtime.GOARCH)
 	fmt.Printf("CPUs: %d\n", runtime.NumCPU())
 	fmt.Printf("Test Size: %d elements\n", *size)
@@ -32,19 +58,55 @@ func main() {
 	fmt.Printf("Assembly Support: %t\n", kernels.UseASM())
 	fmt.Printf("\n")
 
-	switch *testType {
-	case "all":
+	prof, err := startProfiles(*cpuProf, *memProf, *traceOut)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start profiling: %v\n", err)
+		os.Exit(1)
+	}
+	switch {
+	case *modelArg != "":
+		err = runModelTests(*modelArg, *input)
+	case *testType == "all":
 		runAllTests()
-	case "vector":
+	case *testType == "vector":
 		runVectorTests()
-	case "matrix":
+	case *testType == "matrix":
 		runMatrixTests()
-	case "activation":
+	case *testType == "activation":
 		runActivationTests()
+	case *testType == "memory":
+		runMemoryTests()
 	default:
-		fmt.Printf("Unknown test type: %s\n", *testType)
+		err = fmt.Errorf("unknown test type: %s", *testType)
+	}
+	if err := prof.stop(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write profiles: %v\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Benchmark failed: %v\n", err)
 		os.Exit(1)
 	}
+
+	cur := newBenchFile()
+	if *jsonOut != "" {
+		if err := writeBenchFile(*jsonOut, cur); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write results: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if base != nil {
+		fmt.Printf("Comparison with %s\n", *baseline)
+		fmt.Printf("----------------------------\n")
+		regressions, err := compareBaseline(os.Stdout, base, cur, *thresh)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compare results: %v\n", err)
+			os.Exit(1)
+		}
+		if regressions > 0 {
+			os.Exit(2)
+		}
+	}
 }
 
 func runAllTests() {
@@ -52,6 +114,7 @@ func runAllTests() {
 	runVectorTests()
 	runMatrixTests()
 	runActivationTests()
+	runMemoryTests()
 }
 
 func runVectorTests() {
@@ -102,6 +165,11 @@ func runVectorTests() {
 		return float64(*size*(*iter)) / duration.Seconds()
 	}
 
+	record("vector", "add", *iter, vectorAddTime, elementsPerSecond(vectorAddTime)/1e6, "Mops/s")
+	record("vector", "add-inplace", *iter, vectorAddInPlaceTime, elementsPerSecond(vectorAddInPlaceTime)/1e6, "Mops/s")
+	record("vector", "mul", *iter, vectorMulTime, elementsPerSecond(vectorMulTime)/1e6, "Mops/s")
+	record("vector", "dot", *iter, dotProductTime, elementsPerSecond(dotProductTime)/1e6, "Mops/s")
+
 	fmt.Printf("Vector Add (allocating):     %v (%.2f Mops/s)\n",
 		vectorAddTime, elementsPerSecond(vectorAddTime)/1e6)
 	fmt.Printf("Vector Add (in-place):       %v (%.2f Mops/s)\n",
@@ -142,6 +210,8 @@ func runMatrixTests() {
 		operations := int64(matSize) * int64(matSize) * int64(matSize) * 2 * int64(*iter/10) // 2 ops per multiply-add
 		gflops := float64(operations) / matMulTime.Seconds() / 1e9
 
+		record("matrix", fmt.Sprintf("matmul-%dx%d", matSize, matSize), *iter/10, matMulTime, gflops, "GFLOPS")
+
 		fmt.Printf("Matrix Multiply %dx%d:       %v (%.2f GFLOPS)\n",
 			matSize, matSize, matMulTime, gflops)
 	}
@@ -182,6 +252,7 @@ func runActivationTests() {
 		duration := time.Since(start)
 
 		elementsPerSecond := float64(*size*(*iter)) / duration.Seconds()
+		record("activation", strings.ToLower(test.name), *iter, duration, elementsPerSecond/1e6, "Mops/s")
 
 		fmt.Printf("%-15s:             %v (%.2f Mops/s)\n",
 			test.name, duration, elementsPerSecond/1e6)
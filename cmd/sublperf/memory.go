@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+)
+
+// cacheLine is the unit the strided and random patterns touch
+const cacheLine = 64
+
+// memoryMinTraffic is how many bytes each measurement moves at least,
+// passing over small working sets several times
+const memoryMinTraffic = 64 << 20
+
+// memoryWorkingSets sweeps from within L1 to well past the last-level cache
+var memoryWorkingSets = []int{16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+
+// memoryPattern walks a working set of 8-byte words and returns how many
+// cache lines it touched
+type memoryPattern struct {
+	name string
+	walk func(data []uint64, passes int) int
+}
+
+var memoryPatterns = []memoryPattern{
+	// sequential reads every word in order, into independent sums so the
+	// additions do not limit the loads
+	{"sequential", func(data []uint64, passes int) int {
+		var s0, s1, s2, s3 uint64
+		for p := 0; p < passes; p++ {
+			for i := 0; i+3 < len(data); i += 4 {
+				s0 += data[i]
+				s1 += data[i+1]
+				s2 += data[i+2]
+				s3 += data[i+3]
+			}
+		}
+		sink = s0 + s1 + s2 + s3
+		return passes * len(data) * 8 / cacheLine
+	}},
+	// strided reads the first word of every cache line in order
+	{"strided", func(data []uint64, passes int) int {
+		var sum uint64
+		for p := 0; p < passes; p++ {
+			for i := 0; i < len(data); i += cacheLine / 8 {
+				sum += data[i]
+			}
+		}
+		sink = sum
+		return passes * len(data) * 8 / cacheLine
+	}},
+	// random chases the pointers chainLines stored, one dependent load per
+	// cache line, which defeats the prefetchers
+	{"random", func(data []uint64, passes int) int {
+		lines := len(data) * 8 / cacheLine
+		next := uint64(0)
+		for n := passes * lines; n > 0; n-- {
+			next = data[next]
+		}
+		sink = next
+		return passes * lines
+	}},
+}
+
+// sink keeps the walks from being optimized away
+var sink uint64
+
+// chainLines links the cache lines of data into a single random cycle:
+// the first word of each line holds the index of the next line's first
+// word. The other patterns only sum the words, so the chain does not
+// disturb them.
+func chainLines(data []uint64) {
+	step := cacheLine / 8
+	order := rand.Perm(len(data) / step)
+	for i, line := range order {
+		data[line*step] = uint64(order[(i+1)%len(order)] * step)
+	}
+}
+
+// runMemoryTests measures the read bandwidth of each access pattern over
+// working sets from 16 KiB to 64 MiB, counting every touched cache line as
+// 64 bytes moved. On Linux it also counts cycles and last-level cache
+// misses per cache line, when the kernel allows it. With -peak-bw set the
+// bandwidth is given as a share of it, which only means something for
+// working sets larger than the last-level cache.
+func runMemoryTests() {
+	fmt.Printf("Memory Subsystem Performance\n")
+	fmt.Printf("----------------------------\n")
+
+	// Counters follow the OS thread, so the walks must stay on it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	counters, err := openPerfCounters()
+	if err != nil {
+		fmt.Printf("Perf counters unavailable: %v\n", err)
+	} else {
+		defer counters.close()
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "PATTERN\tWORKING SET\tGB/s\tNS/LINE\tCYCLES/LINE\tLLC MISSES/LINE\tOF PEAK\t")
+	for _, p := range memoryPatterns {
+		for _, ws := range memoryWorkingSets {
+			data := make([]uint64, ws/8)
+			chainLines(data)
+			passes := max(memoryMinTraffic/ws, 1)
+			p.walk(data, 1) // Fault the pages in and warm the caches
+
+			if counters != nil {
+				if err := counters.start(); err != nil {
+					fmt.Printf("Perf counters failed: %v\n", err)
+					counters.close()
+					counters = nil
+				}
+			}
+			start := time.Now()
+			lines := p.walk(data, passes)
+			elapsed := time.Since(start)
+			cycles, misses := "-", "-"
+			if counters != nil {
+				c, m, err := counters.stop()
+				if err == nil {
+					cycles = fmt.Sprintf("%.1f", float64(c)/float64(lines))
+					misses = fmt.Sprintf("%.3f", float64(m)/float64(lines))
+				}
+			}
+
+			gbps := float64(lines*cacheLine) / elapsed.Seconds() / 1e9
+			ofPeak := "-"
+			if *peakBW > 0 {
+				ofPeak = fmt.Sprintf("%.0f%%", 100*gbps / *peakBW)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%s\t%s\t%s\t\n", p.name, formatBytes(ws), gbps,
+				float64(elapsed.Nanoseconds())/float64(lines), cycles, misses, ofPeak)
+			record("memory", fmt.Sprintf("%s-%s", p.name, formatBytes(ws)), lines, elapsed, gbps, "GB/s")
+		}
+	}
+	tw.Flush()
+	fmt.Printf("\n")
+}
+
+// formatBytes formats a power-of-two size in KiB or MiB
+func formatBytes(n int) string {
+	if n >= 1<<20 {
+		return fmt.Sprintf("%dMiB", n>>20)
+	}
+	return fmt.Sprintf("%dKiB", n>>10)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+)
+
+// modelConfig is one way of running a model that runModelTests times
+type modelConfig struct {
+	name      string
+	streaming bool
+	scheduler sublation_runtime.SchedulerKind
+	workers   int
+}
+
+// modelConfigs runs the model sequentially through Execute and through
+// both streaming schedulers, each with 1, 2, 4 and all CPUs as workers
+func modelConfigs() []modelConfig {
+	workers := []int{1, 2, 4, runtime.NumCPU()}
+	slices.Sort(workers)
+	workers = slices.Compact(workers)
+
+	var configs []modelConfig
+	for _, w := range workers {
+		configs = append(configs, modelConfig{name: fmt.Sprintf("execute/w%d", w), workers: w})
+	}
+	for _, sched := range []sublation_runtime.SchedulerKind{sublation_runtime.SchedulerLevels, sublation_runtime.SchedulerWorkSteal} {
+		for _, w := range workers {
+			configs = append(configs, modelConfig{name: fmt.Sprintf("streaming-%s/w%d", sched, w), streaming: true, scheduler: sched, workers: w})
+		}
+	}
+	return configs
+}
+
+// modelResult is the latency of one configuration and how much of it the
+// kernels account for
+type modelResult struct {
+	latency sublation_runtime.LatencyReport
+	kernel  time.Duration // Kernel time per execution, summed over workers
+}
+
+// runModelTests benchmarks full executions of the model at path in every
+// configuration, streaming random inputs of inputSize bytes (the engine's
+// streaming window when zero), and breaks the mean latency down into kernel
+// time and scheduler overhead. With several workers kernels overlap, so
+// their summed time can exceed the latency; the overhead is then shown as
+// zero.
+func runModelTests(path string, inputSize int) error {
+	fmt.Printf("Model Execution Performance: %s\n", path)
+	fmt.Printf("----------------------------\n")
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONFIG\tMEAN\tP50\tP99\tKERNEL\tOVERHEAD\tALLOCS/RUN")
+	for _, cfg := range modelConfigs() {
+		r, err := runModel(path, cfg, inputSize)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cfg.name, err)
+		}
+		overhead := max(r.latency.Mean-r.kernel, 0)
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%v\t%v (%.0f%%)\t%d\n", cfg.name, r.latency.Mean, r.latency.P50, r.latency.P99,
+			r.kernel, overhead, 100*float64(overhead)/float64(max(r.latency.Mean, 1)), r.latency.AllocsPerRun)
+		record("model", cfg.name, r.latency.Runs, r.latency.Mean*time.Duration(r.latency.Runs),
+			float64(time.Second)/float64(max(r.latency.Mean, 1)), "exec/s")
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n")
+	return nil
+}
+
+// runModel loads the model afresh, warms an engine configured as cfg up
+// and times -iter executions
+func runModel(path string, cfg modelConfig, inputSize int) (modelResult, error) {
+	graph, err := sublation_runtime.ReadGraph(path, nil)
+	if err != nil {
+		return modelResult{}, err
+	}
+	engine, err := sublation_runtime.NewEngine(graph, &sublation_runtime.EngineOptions{
+		Workers:   cfg.workers,
+		Streaming: cfg.streaming,
+		Scheduler: cfg.scheduler,
+		// Every run streams the same input, which would otherwise let
+		// the engine reuse the outputs instead of running the kernels
+		DisableMemo: true,
+	})
+	if err != nil {
+		return modelResult{}, err
+	}
+	defer engine.Close(context.Background())
+
+	var kernelNanos atomic.Int64
+	engine.AddObserver(sublation_runtime.ObserverFuncs{
+		After: func(ev sublation_runtime.NodeEvent) { kernelNanos.Add(int64(ev.Duration)) },
+	})
+
+	run := func() error { return engine.Execute(sublation_runtime.NewExecutionContext(len(graph.Nodes))) }
+	if cfg.streaming {
+		size := inputSize
+		if size == 0 {
+			size = engine.InputSize()
+		}
+		input := make([]byte, size)
+		rand.Read(input)
+		output := make([]byte, engine.OutputSize())
+		run = func() error { return engine.ExecuteStreaming(input, output) }
+	}
+
+	if err := engine.Warmup(max(*iter/10, 1)); err != nil {
+		return modelResult{}, err
+	}
+	kernelNanos.Store(0)
+	latency, err := sublation_runtime.MeasureLatency(*iter, run)
+	if err != nil {
+		return modelResult{}, err
+	}
+	return modelResult{latency: latency, kernel: time.Duration(kernelNanos.Load() / int64(latency.Runs))}, nil
+}
@@ -0,0 +1,116 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// perf_event_open constants from <linux/perf_event.h>.
+const (
+	perfTypeHardware     = 0
+	perfCountCPUCycles   = 0
+	perfCountCacheMisses = 3 // Last-level cache misses on most CPUs
+
+	perfFlagDisabled      = 1 << 0
+	perfFlagExcludeKernel = 1 << 5
+	perfFlagExcludeHV     = 1 << 6
+
+	perfIocEnable  = 0x2400
+	perfIocDisable = 0x2401
+	perfIocReset   = 0x2403
+)
+
+// perfEventAttr is the first, 64-byte version of struct perf_event_attr,
+// which every kernel accepts
+type perfEventAttr struct {
+	Type         uint32
+	Size         uint32
+	Config       uint64
+	SamplePeriod uint64
+	SampleType   uint64
+	ReadFormat   uint64
+	Flags        uint64
+	WakeupEvents uint32
+	BPType       uint32
+	BPAddr       uint64
+}
+
+// perfCounters counts CPU cycles and last-level cache misses of the
+// calling thread in user space
+type perfCounters struct {
+	cycles, misses int
+}
+
+// openPerfCounters opens the counters, which needs a PMU the kernel
+// exposes (often not the case in VMs) and a perf_event_paranoid setting
+// of 2 or lower
+func openPerfCounters() (*perfCounters, error) {
+	cycles, err := openPerfEvent(perfCountCPUCycles)
+	if err != nil {
+		return nil, fmt.Errorf("perf cycles counter: %w", err)
+	}
+	misses, err := openPerfEvent(perfCountCacheMisses)
+	if err != nil {
+		syscall.Close(cycles)
+		return nil, fmt.Errorf("perf cache-misses counter: %w", err)
+	}
+	return &perfCounters{cycles: cycles, misses: misses}, nil
+}
+
+func openPerfEvent(config uint64) (int, error) {
+	attr := perfEventAttr{
+		Type:   perfTypeHardware,
+		Config: config,
+		Flags:  perfFlagDisabled | perfFlagExcludeKernel | perfFlagExcludeHV,
+	}
+	attr.Size = uint32(unsafe.Sizeof(attr))
+	// pid 0 and cpu -1 count the calling thread on any CPU
+	fd, _, errno := syscall.Syscall6(syscall.SYS_PERF_EVENT_OPEN, uintptr(unsafe.Pointer(&attr)), 0, ^uintptr(0), ^uintptr(0), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// start resets and enables the counters. The caller must stay on its OS
+// thread until stop.
+func (p *perfCounters) start() error {
+	for _, fd := range []int{p.cycles, p.misses} {
+		if err := perfIoctl(fd, perfIocReset); err != nil {
+			return err
+		}
+		if err := perfIoctl(fd, perfIocEnable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stop disables the counters and returns what they counted since start
+func (p *perfCounters) stop() (cycles, misses uint64, err error) {
+	var counts [2]uint64
+	for i, fd := range []int{p.cycles, p.misses} {
+		if err := perfIoctl(fd, perfIocDisable); err != nil {
+			return 0, 0, err
+		}
+		if _, err := syscall.Read(fd, (*[8]byte)(unsafe.Pointer(&counts[i]))[:]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return counts[0], counts[1], nil
+}
+
+func (p *perfCounters) close() {
+	syscall.Close(p.cycles)
+	syscall.Close(p.misses)
+}
+
+func perfIoctl(fd int, req uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
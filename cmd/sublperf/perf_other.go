@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// perfCounters is not available outside Linux.
+type perfCounters struct{}
+
+func openPerfCounters() (*perfCounters, error) {
+	return nil, errors.New("perf counters are only available on Linux")
+}
+
+func (p *perfCounters) start() error { return nil }
+
+func (p *perfCounters) stop() (cycles, misses uint64, err error) { return 0, 0, nil }
+
+func (p *perfCounters) close() {}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// profiles captures the profiles the -cpuprofile, -memprofile and -trace
+// flags ask for over the benchmarks
+type profiles struct {
+	cpu, trace *os.File
+	memPath    string
+}
+
+// startProfiles starts the CPU profile and the execution trace, writing
+// them to the given paths; empty paths leave them off
+func startProfiles(cpuPath, memPath, tracePath string) (*profiles, error) {
+	p := &profiles{memPath: memPath}
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("cpu profile: %w", err)
+		}
+		p.cpu = f
+	}
+	if tracePath != "" {
+		f, err := os.Create(tracePath)
+		if err != nil {
+			p.stop()
+			return nil, err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			p.stop()
+			return nil, fmt.Errorf("trace: %w", err)
+		}
+		p.trace = f
+	}
+	return p, nil
+}
+
+// stop ends the CPU profile and the trace and writes the allocation
+// profile, whose samples cover every allocation since the program started
+func (p *profiles) stop() error {
+	var errs []error
+	if p.cpu != nil {
+		pprof.StopCPUProfile()
+		errs = append(errs, p.cpu.Close())
+		p.cpu = nil
+	}
+	if p.trace != nil {
+		trace.Stop()
+		errs = append(errs, p.trace.Close())
+		p.trace = nil
+	}
+	if p.memPath != "" {
+		errs = append(errs, writeAllocProfile(p.memPath))
+		p.memPath = ""
+	}
+	return errors.Join(errs...)
+}
+
+// writeAllocProfile writes the allocs profile to path after a garbage
+// collection, so its in-use figures are up to date
+func writeAllocProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+		f.Close()
+		return fmt.Errorf("memory profile: %w", err)
+	}
+	return f.Close()
+}
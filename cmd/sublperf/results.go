@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+// benchFile is what -json writes and -baseline reads: the machine and the
+// settings of a run along with its results
+type benchFile struct {
+	GoVersion  string        `json:"go_version"`
+	OS         string        `json:"os"`
+	Arch       string        `json:"arch"`
+	CPUs       int           `json:"cpus"`
+	ASM        bool          `json:"asm"`
+	Size       int           `json:"size"`
+	Iterations int           `json:"iterations"`
+	Results    []benchResult `json:"results"`
+}
+
+// benchResult is one timed operation
+type benchResult struct {
+	Suite      string  `json:"suite"`
+	Name       string  `json:"name"`
+	Iterations int     `json:"iterations"`
+	NsPerOp    float64 `json:"ns_per_op"`
+	Rate       float64 `json:"rate"` // Throughput in Unit
+	Unit       string  `json:"unit"`
+}
+
+// results collects every operation the tests time, in run order
+var results []benchResult
+
+// record adds the result of timing iterations runs of an operation
+func record(suite, name string, iterations int, d time.Duration, rate float64, unit string) {
+	results = append(results, benchResult{
+		Suite:      suite,
+		Name:       name,
+		Iterations: iterations,
+		NsPerOp:    float64(d.Nanoseconds()) / float64(max(iterations, 1)),
+		Rate:       rate,
+		Unit:       unit,
+	})
+}
+
+// newBenchFile describes this run and its results
+func newBenchFile() *benchFile {
+	return &benchFile{
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		ASM:        kernels.UseASM(),
+		Size:       *size,
+		Iterations: *iter,
+		Results:    results,
+	}
+}
+
+// writeBenchFile writes f to path as indented JSON
+func writeBenchFile(path string, f *benchFile) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// readBenchFile reads results written by -json
+func readBenchFile(path string) (*benchFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f benchFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// compareBaseline prints how each result's time per operation changed from
+// the baseline, flagging those more than threshold percent slower, and
+// returns how many regressed. Results missing from either side are listed
+// but never regressions.
+func compareBaseline(w io.Writer, base, cur *benchFile, threshold float64) (int, error) {
+	if base.Size != cur.Size || base.Iterations != cur.Iterations {
+		fmt.Fprintf(w, "warning: baseline ran -size=%d -iter=%d, this run -size=%d -iter=%d\n",
+			base.Size, base.Iterations, cur.Size, cur.Iterations)
+	}
+	if base.OS != cur.OS || base.Arch != cur.Arch || base.ASM != cur.ASM {
+		fmt.Fprintf(w, "warning: baseline ran on %s/%s (asm %t), this run on %s/%s (asm %t)\n",
+			base.OS, base.Arch, base.ASM, cur.OS, cur.Arch, cur.ASM)
+	}
+
+	key := func(r benchResult) string { return r.Suite + "/" + r.Name }
+	old := make(map[string]benchResult, len(base.Results))
+	for _, r := range base.Results {
+		old[key(r)] = r
+	}
+
+	regressions := 0
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "BENCHMARK\tBASELINE\tCURRENT\tDELTA\t")
+	for _, r := range cur.Results {
+		b, ok := old[key(r)]
+		if !ok {
+			fmt.Fprintf(tw, "%s\t-\t%.0f ns/op\tnew\t\n", key(r), r.NsPerOp)
+			continue
+		}
+		delete(old, key(r))
+		delta := 0.0
+		if b.NsPerOp > 0 {
+			delta = (r.NsPerOp - b.NsPerOp) / b.NsPerOp * 100
+		}
+		mark := ""
+		if delta > threshold {
+			mark = "REGRESSION"
+			regressions++
+		}
+		fmt.Fprintf(tw, "%s\t%.0f ns/op\t%.0f ns/op\t%+.1f%%\t%s\n", key(r), b.NsPerOp, r.NsPerOp, delta, mark)
+	}
+	for _, b := range base.Results {
+		if _, ok := old[key(b)]; ok {
+			fmt.Fprintf(tw, "%s\t%.0f ns/op\t-\tmissing\t\n", key(b), b.NsPerOp)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(w, "%d regressions beyond %g%%\n", regressions, threshold)
+	return regressions, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+)
+
+func main() {
+	verify := flag.String("verify", "", "Only load models signed by this PEM Ed25519 public key")
+	showVer := flag.Bool("version", false, "Show version information")
+	determ := flag.Bool("deterministic", false, "Run nodes in the fixed order and with the seeded randomness of deterministic replays")
+	flag.Parse()
+
+	if *showVer {
+		version.Print(os.Stdout, "sublrepl")
+		return
+	}
+
+	args := flag.Args()
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <model.subl>\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	var key ed25519.PublicKey
+	if *verify != "" {
+		pemData, err := os.ReadFile(*verify)
+		if err != nil {
+			log.Fatalf("Failed to read public key: %v", err)
+		}
+		if key, err = model.ParsePublicKey(pemData); err != nil {
+			log.Fatalf("Invalid public key %s: %v", *verify, err)
+		}
+	}
+	graph, err := sublation_runtime.ReadGraph(args[0], key)
+	if err != nil {
+		log.Fatalf("Failed to load model: %v", err)
+	}
+	engine, err := sublation_runtime.NewEngine(graph, &sublation_runtime.EngineOptions{Workers: 1, Deterministic: *determ})
+	if err != nil {
+		log.Fatalf("Failed to create engine: %v", err)
+	}
+
+	r := newREPL(engine, os.Stdout)
+	fmt.Printf("Loaded %s: %d nodes, %d inputs, %d outputs. Type help for commands.\n",
+		args[0], len(graph.Nodes), len(graph.Inputs()), len(graph.Outputs()))
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("(subl) ")
+		if !in.Scan() {
+			fmt.Println()
+			break
+		}
+		if err := r.exec(in.Text()); err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+	}
+	if err := in.Err(); err != nil {
+		log.Fatalf("Failed to read commands: %v", err)
+	}
+}
+
+// fields splits a command line into words, treating commas as spaces so
+// values can be typed as 1,2,3
+func fields(line string) []string {
+	return strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' })
+}
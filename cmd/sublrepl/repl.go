@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// printLimit is how many values print shows before cutting a buffer short
+const printLimit = 1024
+
+const helpText = `Commands:
+  nodes                      List the nodes in execution order, marking the next one
+  inputs                     List the declared inputs and outputs
+  set <node> <values...>     Write values into a node's buffers, such as set x 1,2,3
+  step [n]                   Run the next node, or the next n
+  continue                   Run the remaining nodes
+  run                        Run every node again from the first
+  reset                      Go back to the first node, keeping the buffers
+  print <node> [prev|prop]   Show a node's committed output (prev) or next kernel input (prop)
+  dump <node> <file.npy>     Write a node's committed output as .npy
+  dump all <dir>             Write every node's committed output to <dir>/<node>.npy
+  help                       Show this help
+  quit                       Leave
+Nodes are named by ID, debug name or declared input or output name.`
+
+// repl is the state of an interactive session
+type repl struct {
+	engine  *sublation_runtime.Engine
+	graph   *model.Graph
+	stepper *sublation_runtime.Stepper
+	w       io.Writer
+}
+
+func newREPL(engine *sublation_runtime.Engine, w io.Writer) *repl {
+	return &repl{engine: engine, graph: engine.Graph(), stepper: engine.NewStepper(), w: w}
+}
+
+// exec runs one command line, returning io.EOF for quit
+func (r *repl) exec(line string) error {
+	args := fields(line)
+	if len(args) == 0 {
+		return nil
+	}
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "help", "h", "?":
+		fmt.Fprintln(r.w, helpText)
+	case "quit", "exit", "q":
+		return io.EOF
+	case "nodes":
+		return r.nodes()
+	case "inputs":
+		return r.inputs()
+	case "set":
+		return r.set(args)
+	case "step", "s":
+		return r.step(args)
+	case "continue", "c":
+		return r.run(false)
+	case "run":
+		return r.run(true)
+	case "reset":
+		r.stepper.Reset()
+		r.printNext()
+	case "print", "p":
+		return r.print(args)
+	case "dump":
+		return r.dump(args)
+	default:
+		return fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return nil
+}
+
+func (r *repl) nodes() error {
+	next, more := r.stepper.Next()
+	tw := tabwriter.NewWriter(r.w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tID\tNAME\tKERNEL\tSHAPE\tIO")
+	for _, n := range r.executionOrder() {
+		mark := ""
+		if more && n.ID == next {
+			mark = "=>"
+		}
+		var io []string
+		for _, s := range r.graph.IO {
+			if s.NodeID == n.ID {
+				io = append(io, fmt.Sprintf("%v %s", s.Kind, s.Name))
+			}
+		}
+		shape := "?"
+		if s, ok := r.graph.Shapes[n.ID]; ok {
+			shape = fmt.Sprint(s)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", mark, n.ID, orDash(r.graph.NodeName(n.ID)), kernels.OpName(n.Kernel), shape, orDash(strings.Join(io, ", ")))
+	}
+	return tw.Flush()
+}
+
+// executionOrder lists the nodes in the order the stepper runs them
+func (r *repl) executionOrder() []model.Node {
+	ids := r.stepper.Order()
+	nodes := make([]model.Node, len(ids))
+	for k, id := range ids {
+		nodes[k] = r.graph.Nodes[slices.IndexFunc(r.graph.Nodes, func(n model.Node) bool { return n.ID == id })]
+	}
+	return nodes
+}
+
+func (r *repl) inputs() error {
+	if len(r.graph.IO) == 0 {
+		fmt.Fprintln(r.w, "The model declares no inputs or outputs")
+		return nil
+	}
+	tw := tabwriter.NewWriter(r.w, 0, 8, 2, ' ', 0)
+	for _, s := range r.graph.IO {
+		fmt.Fprintf(tw, "%v\t%s\t%v\t%s\n", s.Kind, s.Name, ioutil.Tensor{DType: s.DType, Shape: s.Shape}, r.graph.NodeLabel(s.NodeID))
+	}
+	return tw.Flush()
+}
+
+// resolve finds the node a command names by ID, debug name or declared
+// input or output name
+func (r *repl) resolve(name string) (model.Node, error) {
+	for _, s := range r.graph.IO {
+		if s.Name == name {
+			name = strconv.FormatUint(uint64(s.NodeID), 10)
+			break
+		}
+	}
+	id, err := strconv.ParseUint(name, 10, 32)
+	for _, n := range r.graph.Nodes {
+		if (err == nil && uint64(n.ID) == id) || (err != nil && r.graph.NodeName(n.ID) == name) {
+			return n, nil
+		}
+	}
+	return model.Node{}, fmt.Errorf("no node %q", name)
+}
+
+// tensor views a node buffer as a tensor: declared inputs and outputs
+// with their dtype and shape, other nodes as float32 of the inferred shape,
+// or flat when there is none or it does not fit the buffer
+func (r *repl) tensor(n model.Node, data []byte) ioutil.Tensor {
+	for _, s := range r.graph.IO {
+		if s.NodeID == n.ID && s.Bytes() <= len(data) {
+			return ioutil.Tensor{DType: s.DType, Shape: slices.Clone(s.Shape), Data: data[:s.Bytes()]}
+		}
+	}
+	if shape, ok := r.graph.Shapes[n.ID]; ok && kernels.Elements(shape)*4 <= len(data) {
+		return ioutil.Tensor{DType: model.Float32, Shape: slices.Clone(shape), Data: data[:kernels.Elements(shape)*4]}
+	}
+	return ioutil.Tensor{DType: model.Float32, Shape: []int{len(data) / 4}, Data: data[:len(data)/4*4]}
+}
+
+func (r *repl) set(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: set <node> <values...>")
+	}
+	n, err := r.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	values := make([]float64, len(args)-1)
+	for i, a := range args[1:] {
+		if values[i], err = strconv.ParseFloat(a, 64); err != nil {
+			return fmt.Errorf("invalid number %q", a)
+		}
+	}
+	spec := model.IOSpec{Name: args[0], DType: model.Float32, Shape: []int{len(values)}}
+	for _, s := range r.graph.Inputs() {
+		if s.NodeID == n.ID {
+			spec = s
+		}
+	}
+	t, err := ioutil.FromValues(spec, values)
+	if err != nil {
+		return err
+	}
+	if err := r.engine.SetNodeData(n.ID, t.Data); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.w, "%s = %v\n", r.graph.NodeLabel(n.ID), t)
+	return nil
+}
+
+func (r *repl) step(args []string) error {
+	count := 1
+	if len(args) > 0 {
+		var err error
+		if count, err = strconv.Atoi(args[0]); err != nil || count < 1 {
+			return fmt.Errorf("invalid step count %q", args[0])
+		}
+	}
+	for ; count > 0; count-- {
+		id, err := r.stepper.Step()
+		if err == io.EOF {
+			fmt.Fprintln(r.w, "All nodes have run; use run or reset to start over")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.w, "Ran %s\n", r.describe(id))
+	}
+	r.printNext()
+	return nil
+}
+
+// run runs the remaining nodes, or all of them again when restart is set
+func (r *repl) run(restart bool) error {
+	if restart {
+		r.stepper.Reset()
+	}
+	if err := r.stepper.Continue(); err != nil {
+		return err
+	}
+	fmt.Fprintln(r.w, "Ran to the end")
+	for _, s := range r.graph.Outputs() {
+		n, err := r.resolve(s.Name)
+		if err != nil {
+			return err
+		}
+		if err := r.printBuffer(n, "prev"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printNext says which node runs next
+func (r *repl) printNext() {
+	if id, ok := r.stepper.Next(); ok {
+		fmt.Fprintf(r.w, "Next: %s\n", r.describe(id))
+	} else {
+		fmt.Fprintln(r.w, "Next: end of graph")
+	}
+}
+
+// describe names a node and its kernel
+func (r *repl) describe(id uint32) string {
+	for _, n := range r.graph.Nodes {
+		if n.ID == id {
+			return fmt.Sprintf("%s (%s)", r.graph.NodeLabel(id), kernels.OpName(n.Kernel))
+		}
+	}
+	return r.graph.NodeLabel(id)
+}
+
+func (r *repl) print(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: print <node> [prev|prop]")
+	}
+	n, err := r.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	which := "prev"
+	if len(args) == 2 {
+		which = args[1]
+	}
+	return r.printBuffer(n, which)
+}
+
+// printBuffer prints one of the buffers of n, cutting long ones short
+func (r *repl) printBuffer(n model.Node, which string) error {
+	prev, prop, err := r.engine.NodeBuffers(n.ID)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch which {
+	case "prev":
+		data = prev
+	case "prop":
+		data = prop
+	default:
+		return fmt.Errorf("unknown buffer %q, want prev or prop", which)
+	}
+	t := r.tensor(n, data)
+	fmt.Fprintf(r.w, "%s %s %v:\n", r.graph.NodeLabel(n.ID), which, t)
+	if t.Elements() > printLimit {
+		flat := ioutil.Tensor{DType: t.DType, Shape: []int{printLimit}, Data: t.Data[:printLimit*t.DType.Size()]}
+		if err := ioutil.WriteCSV(r.w, flat); err != nil {
+			return err
+		}
+		fmt.Fprintf(r.w, "... %d more values, dump the node to see them all\n", t.Elements()-printLimit)
+		return nil
+	}
+	return ioutil.WriteCSV(r.w, t)
+}
+
+func (r *repl) dump(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: dump <node> <file.npy> or dump all <dir>")
+	}
+	if args[0] != "all" {
+		n, err := r.resolve(args[0])
+		if err != nil {
+			return err
+		}
+		return r.dumpNode(n, args[1])
+	}
+	if err := os.MkdirAll(args[1], 0o755); err != nil {
+		return err
+	}
+	for _, n := range r.graph.Nodes {
+		name := r.graph.NodeName(n.ID)
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			name = strconv.FormatUint(uint64(n.ID), 10)
+		}
+		if err := r.dumpNode(n, filepath.Join(args[1], name+".npy")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpNode writes the committed output of n to path as .npy
+func (r *repl) dumpNode(n model.Node, path string) error {
+	prev, _, err := r.engine.NodeBuffers(n.ID)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	t := r.tensor(n, prev)
+	if err := ioutil.WriteNPY(f, t); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.w, "Wrote %s %v to %s\n", r.graph.NodeLabel(n.ID), t, path)
+	return nil
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
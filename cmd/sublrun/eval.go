@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sbl8/sublation/metrics"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// evaluator scores the first declared output of every execution against
+// the next line of an -eval labels file
+type evaluator struct {
+	spec      model.IOSpec
+	labels    [][]float64
+	scores    metrics.Set
+	collector *ioutil.OutputCollector
+	n         int
+}
+
+// newEvaluator reads the labels at path and observes engine for the
+// outputs to score with the metrics of names
+func newEvaluator(engine *sublation_runtime.Engine, path, names string) (*evaluator, error) {
+	outputs := engine.Graph().Outputs()
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("-eval needs the model to declare outputs")
+	}
+	scores, err := metrics.Parse(names)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("no metrics")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	labels, err := metrics.ReadLabels(f)
+	if err != nil {
+		return nil, err
+	}
+	e := &evaluator{spec: outputs[0], labels: labels, scores: scores, collector: ioutil.NewOutputCollector(engine.Graph())}
+	engine.AddObserver(e.collector)
+	return e, nil
+}
+
+// add scores the output of the latest execution against its label
+func (e *evaluator) add() error {
+	if e == nil {
+		return nil
+	}
+	if e.n >= len(e.labels) {
+		return fmt.Errorf("execution %d has no label: the labels file holds %d", e.n+1, len(e.labels))
+	}
+	tensors, err := e.collector.Outputs()
+	if err != nil {
+		return err
+	}
+	pred, err := tensors[e.spec.Name].Values()
+	if err != nil {
+		return err
+	}
+	if err := e.scores.Add(pred, e.labels[e.n]); err != nil {
+		return fmt.Errorf("execution %d: %w", e.n+1, err)
+	}
+	e.n++
+	return nil
+}
+
+// report prints the scores to stderr, keeping stdout for the results
+func (e *evaluator) report() {
+	if e == nil {
+		return
+	}
+	if e.n < len(e.labels) {
+		fmt.Fprintf(os.Stderr, "Warning: scored %d of %d labels\n", e.n, len(e.labels))
+	}
+	fmt.Fprintf(os.Stderr, "Eval of %q over %d executions: %v\n", e.spec.Name, e.n, e.scores)
+}
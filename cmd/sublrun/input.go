@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// Input formats of -input-format. Raw bytes replace the payload of single
+// executions and are the streaming input as they are; the other formats
+// are parsed into the inputs the model declares and checked against their
+// dtypes and shapes. Auto reads .npy and .npz files as NumPy and anything
+// else as raw.
+const (
+	inputAuto    = "auto"
+	inputRaw     = "raw"
+	inputCSV     = "csv"
+	inputJSON    = "json"
+	inputNPY     = "npy"
+	inputFloat32 = "raw-f32"
+)
+
+// checkInputFormat checks an -input-format and that g declares the inputs
+// a typed format needs
+func checkInputFormat(format string, g *model.Graph) error {
+	switch format {
+	case inputAuto, inputRaw:
+		return nil
+	case inputCSV, inputJSON, inputNPY, inputFloat32:
+	default:
+		return fmt.Errorf("unknown format %q, want auto, raw, csv, json, npy or raw-f32", format)
+	}
+	if len(g.Inputs()) == 0 {
+		return fmt.Errorf("%s input needs the model to declare inputs", format)
+	}
+	return nil
+}
+
+// inputFormat resolves the auto format for the input at path, "" for
+// stdin
+func inputFormat(format, path string) string {
+	if format != inputAuto {
+		return format
+	}
+	if path != "" && isNumPy(path) {
+		return inputNPY
+	}
+	return inputRaw
+}
+
+// parseInput parses data in a typed format into tensors for the inputs g
+// declares. name keys a lone .npy array, which binds to a lone input
+// whatever its name.
+func parseInput(format string, data []byte, name string, g *model.Graph) (map[string]ioutil.Tensor, error) {
+	switch format {
+	case inputCSV:
+		return ioutil.ParseCSV(data, g.Inputs())
+	case inputJSON:
+		return ioutil.ParseJSON(data, g.Inputs())
+	case inputFloat32:
+		return ioutil.ParseFloat32(data, g.Inputs())
+	}
+	if bytes.HasPrefix(data, []byte("PK")) {
+		return ioutil.ReadNPZ(bytes.NewReader(data), int64(len(data)))
+	}
+	t, err := ioutil.ReadNPY(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]ioutil.Tensor{strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)): t}, nil
+}
+
+// streamingInput parses data in a typed format and returns the data of
+// the inputs g declares back to back in declaration order, after checking
+// them as BindInputs does
+func streamingInput(format string, data []byte, name string, g *model.Graph) ([]byte, error) {
+	tensors, err := parseInput(format, data, name, g)
+	if err != nil {
+		return nil, err
+	}
+	inputs := g.Inputs()
+	if len(inputs) == 1 && len(tensors) == 1 {
+		for _, t := range tensors {
+			tensors = map[string]ioutil.Tensor{inputs[0].Name: t}
+		}
+	}
+	var input []byte
+	for _, s := range inputs {
+		t, ok := tensors[s.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %q", s.Name)
+		}
+		if err := ioutil.Check(s, t); err != nil {
+			return nil, err
+		}
+		input = append(input, t.Data...)
+	}
+	return input, nil
+}
@@ -2,85 +2,558 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
 
+	"github.com/sbl8/sublation/internal/config"
+	"github.com/sbl8/sublation/internal/exit"
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
 	sublation_runtime "github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/ioutil"
 )
 
-func main() {
-	var (
-		workers   = flag.Int("workers", runtime.NumCPU(), "Number of worker goroutines")
-		streaming = flag.Bool("streaming", false, "Enable streaming input processing")
-		verbose   = flag.Bool("verbose", false, "Enable verbose output")
-		version   = flag.Bool("version", false, "Show version information")
-	)
+// runFlags holds the command line flags
+type runFlags struct {
+	arenaSize     config.Size
+	workers       int
+	streaming     bool
+	scheduler     string
+	deterministic bool
+	seed          uint64
+	warmup        int
+	repeat        int
+	percentiles   bool
+	chunked       bool
+	speculative   bool
+	guard         bool
+	ipc           string
+	record        string
+	replay        string
+	memcheck      string
+	verify        string
+	profile       string
+	trace         string
+	npyOut        string
+	inFormat      string
+	outFormat     string
+	outFile       string
+	eval          string
+	metrics       string
+	config        string
+	errFormat     string
+	verbose       bool
+	version       bool
+}
+
+// parseFlags defines and parses the command line flags
+func parseFlags() *runFlags {
+	f := new(runFlags)
+	flag.Var(&f.arenaSize, "arena-size", "Arena size in bytes or with a KiB, MiB or GiB suffix (0 sizes it from the model)")
+	flag.IntVar(&f.workers, "workers", runtime.NumCPU(), "Number of worker goroutines")
+	flag.BoolVar(&f.streaming, "streaming", false, "Enable streaming input processing")
+	flag.StringVar(&f.scheduler, "scheduler", "levels", "Streaming scheduler: levels or worksteal")
+	flag.BoolVar(&f.deterministic, "deterministic", false, "Run nodes sequentially in a fixed order for bit-identical replays")
+	flag.Uint64Var(&f.seed, "seed", 0, "Random seed for deterministic runs (0 selects the default)")
+	flag.IntVar(&f.warmup, "warmup", 0, "Number of warmup executions before processing input")
+	flag.IntVar(&f.repeat, "repeat", 1, "Execute a single input this many times, writing the results of the last execution")
+	flag.BoolVar(&f.percentiles, "percentiles", false, "Print the min, mean, max, p50, p90 and p99 latency and allocations per execution of the -repeat runs to stderr")
+	flag.BoolVar(&f.chunked, "chunked", false, "Process streaming inputs larger than the window in chunks")
+	flag.BoolVar(&f.speculative, "speculative", false, "Roll back node outputs containing NaN or Inf instead of committing them")
+	flag.BoolVar(&f.guard, "guard", false, "Fail as soon as a kernel outputs NaN or Inf")
+	flag.StringVar(&f.ipc, "ipc", "", "Serve shared-memory producers on this unix socket instead of reading input")
+	flag.StringVar(&f.record, "record", "", "Append each streaming execution to this replay log; needs -streaming")
+	flag.StringVar(&f.replay, "replay", "", "Re-execute the recorded executions of this replay log and report differences")
+	flag.StringVar(&f.memcheck, "memcheck", "off", "Check each execution returns its memory: off, log or panic")
+	flag.StringVar(&f.verify, "verify", "", "Only load models signed by this PEM Ed25519 public key")
+	flag.StringVar(&f.profile, "profile-costs", "", "Measure per-node kernel times and write the model annotated with them to this file")
+	flag.StringVar(&f.trace, "trace", "", "Record every kernel call and write the trace to this file, for subltrace")
+	flag.StringVar(&f.npyOut, "npy-out", "", "Write each declared output of the last execution to <name>.npy in this directory")
+	flag.StringVar(&f.inFormat, "input-format", "auto", "Read inputs as raw payload bytes, or parse them into the model's declared inputs from csv, json, npy or raw-f32 (little-endian float32); auto reads .npy/.npz files as npy and anything else as raw")
+	flag.StringVar(&f.outFormat, "output-format", "raw", "Write each execution's results as the raw output bytes of streaming executions, or its declared outputs as float32, json, npy or csv")
+	flag.StringVar(&f.outFile, "output-file", "", "Write the results to this file instead of stdout")
+	flag.StringVar(&f.eval, "eval", "", "Score the first declared output of every execution against the next line of this labels file, one label per line, and print the scores to stderr")
+	flag.StringVar(&f.metrics, "metrics", "accuracy", "Comma-separated -eval metrics: accuracy, top<k>, precision, recall, f1, auc, mse or mae")
+	flag.StringVar(&f.config, "config", "", "Take defaults for -workers, -arena-size and -output-format from this file instead of the sublation.toml or sublation.yaml found from the working directory; none for no file")
+	flag.StringVar(&f.errFormat, "error-format", "text", "Report the error sublrun exits on as text, or as a JSON object on stderr with its exit code and kind")
+	flag.BoolVar(&f.verbose, "verbose", false, "Enable verbose output")
+	flag.BoolVar(&f.version, "version", false, "Show version information")
 	flag.Parse()
+	return f
+}
 
-	if *version {
-		fmt.Println("sublrun - Sublation Runtime v1.0.0")
-		fmt.Printf("Built with Go %s\n", runtime.Version())
+func main() {
+	f := parseFlags()
+	if f.version {
+		version.Print(os.Stdout, "sublrun")
 		return
 	}
+	f.applyConfig()
 
 	args := flag.Args()
 	if len(args) < 1 {
+		if exit.JSON() {
+			exit.Fatalf(exit.Usage, "want a <model.subl> argument")
+		}
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] <model.subl> [input]\n", os.Args[0])
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(int(exit.Usage))
 	}
+	memCheck := f.validate()
+	graph := loadModel(args[0], f.verify, f.verbose)
 
-	modelPath := args[0]
+	opts := f.engineOptions(memCheck)
+	var recorder *sublation_runtime.TraceRecorder
+	if f.trace != "" {
+		recorder = sublation_runtime.NewTraceRecorder(traceLimit)
+		opts.Tracer = recorder
+	}
+	if f.ipc != "" {
+		serveIPC(graph, &opts, f.ipc, f.verbose)
+		return
+	}
+	if f.replay != "" {
+		opts.Streaming = true
+		os.Exit(runReplay(graph, &opts, f.replay, f.verbose))
+	}
+	if f.record != "" {
+		rw, err := sublation_runtime.OpenReplayLog(f.record, nil)
+		if err != nil {
+			exit.Fatalf(exit.IO, "Failed to open replay log: %v", err)
+		}
+		defer func() {
+			if err := rw.Close(); err != nil {
+				log.Printf("Replay log: %v", err)
+			}
+		}()
+		opts.Replay = rw
+	}
 
-	// Load the compiled model
-	graph, err := sublation_runtime.LoadFromFile(modelPath)
+	engine, err := sublation_runtime.NewEngine(graph, &opts)
 	if err != nil {
-		log.Fatalf("Failed to load model: %v", err)
+		exit.Fatalf(exit.Runtime, "Failed to create engine: %v", err)
+	}
+	if f.verbose {
+		fmt.Printf("Engine configured with %d workers\n", f.workers)
+		fmt.Print(engine.ArenaReport())
+	}
+	var profiler *sublation_runtime.CostProfiler
+	if f.profile != "" {
+		profiler = sublation_runtime.NewCostProfiler()
+		engine.AddObserver(profiler)
+	}
+
+	dest := bufio.NewWriter(os.Stdout)
+	if f.outFile != "" {
+		out, err := os.Create(f.outFile)
+		if err != nil {
+			exit.Fatalf(exit.IO, "Failed to create output file: %v", err)
+		}
+		defer out.Close()
+		dest.Reset(out)
 	}
+	results := f.newResults(engine, dest)
+	eval, outputs := f.newCollectors(engine)
 
-	if *verbose {
+	if f.warmup > 0 {
+		if err := engine.Warmup(f.warmup); err != nil {
+			exit.Fatalf(exit.Runtime, "Warmup failed: %v", err)
+		}
+	}
+	if f.streaming {
+		runStreaming(engine, args[1:], f.inFormat, results, eval, f.verbose)
+	} else {
+		runSingle(engine, args[1:], f.inFormat, results, eval, f.repeat, f.percentiles, f.verbose)
+	}
+	if err := dest.Flush(); err != nil {
+		exit.Fatalf(exit.IO, "Failed to write results: %v", err)
+	}
+	eval.report()
+
+	f.writeArtifacts(graph, recorder, outputs, profiler)
+	if f.verbose {
+		printStats(engine, memCheck)
+	}
+}
+
+// applyConfig sets the error format and takes the flag defaults from the
+// config file
+func (f *runFlags) applyConfig() {
+	if err := exit.SetFormat(f.errFormat); err != nil {
+		exit.Fatalf(exit.Usage, "Invalid -error-format: %v", err)
+	}
+	cfg, err := config.Load(f.config)
+	if err == nil {
+		err = cfg.Apply(flag.CommandLine, map[string]string{
+			"workers":       "workers",
+			"arena_size":    "arena-size",
+			"output_format": "output-format",
+		})
+	}
+	if err != nil {
+		exit.Fatalf(exit.Classify(err, exit.Usage), "Invalid config: %v", err)
+	}
+}
+
+// validate rejects flag combinations that cannot run together and returns
+// the -memcheck mode
+func (f *runFlags) validate() sublation_runtime.MemCheckMode {
+	if f.repeat < 1 {
+		exit.Fatalf(exit.Usage, "Invalid -repeat %d: want at least 1", f.repeat)
+	}
+	if f.streaming && (f.repeat > 1 || f.percentiles) {
+		exit.Fatalf(exit.Usage, "-repeat and -percentiles measure single executions and cannot be used with -streaming")
+	}
+	if f.record != "" && (!f.streaming || f.ipc != "" || f.replay != "") {
+		exit.Fatalf(exit.Usage, "-record logs the executions of -streaming and cannot be used without it or with -ipc or -replay")
+	}
+	if f.eval != "" && f.repeat > 1 {
+		exit.Fatalf(exit.Usage, "-eval scores each execution once and cannot be used with -repeat")
+	}
+	memCheck, err := sublation_runtime.ParseMemCheckMode(f.memcheck)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "Invalid -memcheck: %v", err)
+	}
+	return memCheck
+}
+
+// loadModel reads the compiled model at path, checking its signature
+// against the public key in verify when set
+func loadModel(path, verify string, verbose bool) *model.Graph {
+	var key ed25519.PublicKey
+	if verify != "" {
+		pemData, err := os.ReadFile(verify)
+		if err != nil {
+			exit.Fatalf(exit.IO, "Failed to read public key: %v", err)
+		}
+		if key, err = model.ParsePublicKey(pemData); err != nil {
+			exit.Fatalf(exit.Parse, "Invalid public key %s: %v", verify, err)
+		}
+	}
+	graph, err := sublation_runtime.ReadGraph(path, key)
+	if err != nil {
+		code := exit.Classify(err, exit.Parse)
+		if errors.Is(err, model.ErrSignature) || errors.Is(err, model.ErrUnsigned) {
+			code = exit.Validation
+		}
+		exit.Fatalf(code, "Failed to load model: %v", err)
+	}
+
+	if verbose {
 		fmt.Printf("Loaded model with %d nodes and %d bytes payload\n",
 			len(graph.Nodes), len(graph.Payload))
+		for _, spec := range graph.IO {
+			fmt.Printf("  %v %v\n", spec.Kind, spec)
+		}
 	}
+	return graph
+}
 
-	// Configure engine options
-	opts := sublation_runtime.EngineOptions{
-		Workers:     *workers,
-		ArenaSize:   0, // Auto-calculate
-		EnableStats: *verbose,
-		Streaming:   *streaming,
+// engineOptions returns the engine configuration the flags select
+func (f *runFlags) engineOptions(memCheck sublation_runtime.MemCheckMode) sublation_runtime.EngineOptions {
+	return sublation_runtime.EngineOptions{
+		Workers:     f.workers,
+		ArenaSize:   uintptr(f.arenaSize), // 0 auto-calculates
+		EnableStats: f.verbose,
+		Streaming:   f.streaming,
+		Scheduler:   sublation_runtime.SchedulerKind(f.scheduler),
+
+		ChunkedInput:   f.chunked,
+		Deterministic:  f.deterministic,
+		Seed:           f.seed,
+		MemCheck:       memCheck,
+		Speculative:    f.speculative,
+		GuardNonFinite: f.guard,
 	}
+}
 
-	// Create runtime engine
-	engine, err := sublation_runtime.NewEngine(graph, &opts) // Pass address of opts
+// newResults checks the input and output formats against the model and
+// returns the writer of the results to dest
+func (f *runFlags) newResults(engine *sublation_runtime.Engine, dest io.Writer) *outputWriter {
+	graph := engine.Graph()
+	if err := checkInputFormat(f.inFormat, graph); err != nil {
+		exit.Fatalf(exit.Usage, "Invalid -input-format: %v", err)
+	}
+	results, err := newOutputWriter(graph, f.outFormat, dest)
 	if err != nil {
-		log.Fatalf("Failed to create engine: %v", err)
+		exit.Fatalf(exit.Usage, "Invalid -output-format: %v", err)
+	}
+	if f.streaming && f.outFormat == outputNPY && len(results.specs) > 1 {
+		exit.Fatalf(exit.Usage, "Invalid -output-format: npy output of streaming executions needs a single model output")
 	}
+	if results.collector != nil {
+		engine.AddObserver(results.collector)
+	}
+	return results
+}
 
-	if *verbose {
-		fmt.Printf("Engine configured with %d workers\n", *workers)
+// newCollectors returns the -eval scorer and the -npy-out collector, nil
+// when the flag is unset
+func (f *runFlags) newCollectors(engine *sublation_runtime.Engine) (*evaluator, *ioutil.OutputCollector) {
+	var eval *evaluator
+	if f.eval != "" {
+		var err error
+		if eval, err = newEvaluator(engine, f.eval, f.metrics); err != nil {
+			exit.Fatalf(exit.Classify(err, exit.Usage), "Invalid -eval: %v", err)
+		}
 	}
+	var outputs *ioutil.OutputCollector
+	if f.npyOut != "" {
+		outputs = ioutil.NewOutputCollector(engine.Graph())
+		engine.AddObserver(outputs)
+	}
+	return eval, outputs
+}
 
-	if *streaming {
-		runStreaming(engine, args[1:], *verbose)
-	} else {
-		runSingle(engine, args[1:], *verbose)
+// writeArtifacts writes the trace, the -npy-out outputs and the profiled
+// model the run collected
+func (f *runFlags) writeArtifacts(graph *model.Graph, recorder *sublation_runtime.TraceRecorder, outputs *ioutil.OutputCollector, profiler *sublation_runtime.CostProfiler) {
+	if recorder != nil {
+		if err := writeTrace(recorder, f.trace); err != nil {
+			exit.Fatalf(exit.IO, "Failed to write trace: %v", err)
+		}
+	}
+	if outputs != nil {
+		if err := writeOutputs(outputs, f.npyOut, f.verbose); err != nil {
+			exit.Fatalf(exit.IO, "Failed to write outputs: %v", err)
+		}
+	}
+	if profiler != nil {
+		if err := writeProfiledModel(graph, profiler, f.profile); err != nil {
+			exit.Fatalf(exit.IO, "Failed to write profiled model: %v", err)
+		}
+		if f.verbose {
+			printNodeCosts(graph, profiler)
+			fmt.Printf("Wrote measured node costs to %s\n", f.profile)
+		}
+	}
+}
+
+// printStats prints the latency of the run and, with -memcheck, its memory
+func printStats(engine *sublation_runtime.Engine, memCheck sublation_runtime.MemCheckMode) {
+	stats := engine.Stats()
+	if stats.WarmupExecutions > 0 {
+		fmt.Printf("Warmup latency (%d runs): %v\n", stats.WarmupExecutions, stats.WarmupPercentiles)
+	}
+	fmt.Printf("Steady-state latency (%d runs): %v\n", stats.TotalExecutions, stats.Percentiles)
+	if memCheck != sublation_runtime.MemCheckOff {
+		fmt.Printf("Memory (last run): %v, %d violations\n", stats.Memory, stats.MemCheckViolations)
+	}
+}
+
+// traceLimit caps the events -trace keeps, so a long stream cannot exhaust
+// memory
+const traceLimit = 1 << 20
+
+// writeTrace writes the recorded kernel calls to path
+func writeTrace(recorder *sublation_runtime.TraceRecorder, path string) error {
+	if n := recorder.Dropped(); n > 0 {
+		log.Printf("Trace kept the first %d kernel calls and dropped %d", traceLimit, n)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := recorder.WriteTrace(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// printNodeCosts prints the mean kernel time of every profiled node, by
+// name when the model carries debug symbols
+func printNodeCosts(graph *model.Graph, profiler *sublation_runtime.CostProfiler) {
+	fmt.Println("Node costs:")
+	for _, n := range graph.Nodes {
+		if mean, ok := profiler.Mean(n.ID); ok {
+			fmt.Printf("  %s (%s): %v\n", graph.NodeLabel(n.ID), kernels.OpName(n.Kernel), mean)
+		}
+	}
+}
+
+// writeProfiledModel records the profiler's measurements in graph and
+// writes it to path
+func writeProfiledModel(graph *model.Graph, profiler *sublation_runtime.CostProfiler, path string) error {
+	if profiler.Apply(graph) == 0 {
+		return errors.New("no node executed")
+	}
+	data, err := graph.Serialize()
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// isNumPy reports whether path names a .npy or .npz file
+func isNumPy(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".npy" || ext == ".npz"
 }
 
-// runSingle processes a single input or uses stdin
-func runSingle(engine *sublation_runtime.Engine, inputs []string, verbose bool) {
+// writeOutputs writes the collected outputs to dir as .npy files
+func writeOutputs(c *ioutil.OutputCollector, dir string, verbose bool) error {
+	tensors, err := c.Outputs()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, t := range tensors {
+		path := filepath.Join(dir, name+".npy")
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteNPY(f, t)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if verbose {
+			fmt.Printf("Wrote output %s %v to %s\n", name, t, path)
+		}
+	}
+	return nil
+}
+
+// serveIPC backs the engine with a shared memory segment named after the
+// process and serves producers on socketPath until interrupted.
+func serveIPC(graph *model.Graph, opts *sublation_runtime.EngineOptions, socketPath string, verbose bool) {
+	name := fmt.Sprintf("sublrun-%d", os.Getpid())
+	engine, err := sublation_runtime.NewSharedEngine(graph, opts, name)
+	if err != nil {
+		exit.Fatalf(exit.Runtime, "Failed to create shared engine: %v", err)
+	}
+	defer engine.Close(context.Background())
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		exit.Fatalf(exit.IO, "Failed to listen on %s: %v", socketPath, err)
+	}
+	if verbose {
+		fmt.Printf("Serving shared memory segment %s on %s\n", name, socketPath)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := engine.ServeIPC(ctx, l); err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("IPC server stopped: %v", err)
+	}
+}
+
+// runReplay re-executes every record of a replay log, each session on a
+// fresh engine, and returns the exit status: 0 when all reproduced, 1
+// otherwise.
+func runReplay(graph *model.Graph, opts *sublation_runtime.EngineOptions, path string, verbose bool) int {
+	f, err := os.Open(path)
+	if err != nil {
+		exit.Fatalf(exit.IO, "Failed to open replay log: %v", err)
+	}
+	defer f.Close()
+	rr, err := sublation_runtime.NewReplayReader(bufio.NewReader(f))
+	if err != nil {
+		exit.Fatalf(exit.Classify(err, exit.Parse), "Failed to read replay log: %v", err)
+	}
+
+	var engine *sublation_runtime.Engine
+	var session int64
+	defer func() {
+		if engine != nil {
+			engine.Close(context.Background())
+		}
+	}()
+
+	replayed, mismatched := 0, 0
+	for {
+		rec, err := rr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			exit.Fatalf(exit.Classify(err, exit.Parse), "Failed to read replay log: %v", err)
+		}
+		// Each session was recorded by its own engine, starting from the model
+		if engine == nil || rec.Session != session {
+			if engine != nil {
+				engine.Close(context.Background())
+			}
+			if engine, err = sublation_runtime.NewEngine(graph, opts); err != nil {
+				exit.Fatalf(exit.Runtime, "Failed to create engine: %v", err)
+			}
+			session = rec.Session
+		}
+		res, err := engine.Replay(rec)
+		if err != nil {
+			exit.Fatalf(exit.Runtime, "Replay of record %d failed: %v", rec.Seq, err)
+		}
+		replayed++
+		if !res.Matches(rec) {
+			mismatched++
+			fmt.Printf("Record %d: output match %v, node mismatches %v, error %v (recorded %q)\n",
+				rec.Seq, res.OutputMatch, res.NodeMismatches, res.Err, rec.Err)
+		} else if verbose {
+			fmt.Printf("Record %d reproduced in %v (recorded %v)\n", rec.Seq, res.Duration, rec.Duration)
+		}
+	}
+
+	fmt.Printf("Replayed %d executions, %d differed\n", replayed, mismatched)
+	if mismatched > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runSingle processes a single input or uses stdin, executing it repeat
+// times and printing the latency report when percentiles is set
+func runSingle(engine *sublation_runtime.Engine, inputs []string, format string, results *outputWriter, eval *evaluator, repeat int, percentiles, verbose bool) {
 	var inputData []byte
 	var err error
 
+	path := ""
 	if len(inputs) > 0 {
+		path = inputs[0]
+	}
+	if format = inputFormat(format, path); format != inputRaw {
+		// Typed inputs are checked against the model and placed in the
+		// payloads of their nodes
+		if path != "" {
+			inputData, err = os.ReadFile(path)
+		} else {
+			inputData, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			exit.Fatalf(exit.IO, "Failed to read input: %v", err)
+		}
+		tensors, err := parseInput(format, inputData, path, engine.Graph())
+		if err != nil {
+			exit.Fatalf(exit.Parse, "Invalid input: %v", err)
+		}
+		if err := ioutil.BindInputs(engine.Graph(), tensors); err != nil {
+			exit.Fatalf(exit.Validation, "Invalid input: %v", err)
+		}
+		inputData = engine.Graph().Payload
+	} else if len(inputs) > 0 {
 		// Read from file
 		inputData, err = os.ReadFile(inputs[0])
 		if err != nil {
-			log.Fatalf("Failed to read input file: %v", err)
+			exit.Fatalf(exit.IO, "Failed to read input file: %v", err)
 		}
 	} else {
 		// Read from stdin
@@ -90,7 +563,7 @@ func runSingle(engine *sublation_runtime.Engine, inputs []string, verbose bool)
 			inputData = append(inputData, '\n') // Preserve newlines if reading line by line
 		}
 		if err := scanner.Err(); err != nil {
-			log.Fatalf("Failed to read from stdin: %v", err)
+			exit.Fatalf(exit.IO, "Failed to read from stdin: %v", err)
 		}
 	}
 
@@ -111,23 +584,34 @@ func runSingle(engine *sublation_runtime.Engine, inputs []string, verbose bool)
 	// Create an execution context for this run.
 	ctx := sublation_runtime.NewExecutionContext(len(engine.Graph().Nodes))
 
-	if err := engine.Execute(ctx); err != nil {
+	report, err := sublation_runtime.MeasureLatency(repeat, func() error { return engine.Execute(ctx) })
+	if err != nil {
 		engine.Graph().Payload = originalPayload // Restore payload on error
-		log.Fatalf("Engine execution failed: %v", err)
+		exit.Fatalf(exit.Runtime, "Engine execution failed: %v", err)
 	}
 
 	engine.Graph().Payload = originalPayload // Restore original payload after successful execution
 
-	// Note: The output of engine.Execute(ctx) is implicitly in the sublates within the context's arena.
-	// If specific output needs to be written to os.Stdout, further logic to extract it would be needed here.
+	if percentiles {
+		fmt.Fprintf(os.Stderr, "Latency over %v\n", report)
+	}
+	if err := eval.add(); err != nil {
+		exit.Fatalf(exit.Validation, "Eval failed: %v", err)
+	}
+
+	if err := results.write(nil); err != nil {
+		exit.Fatalf(exit.IO, "Failed to write results: %v", err)
+	}
 
 	if verbose {
 		fmt.Println("Execution completed")
 	}
 }
 
-// runStreaming processes continuous input in streaming mode
-func runStreaming(engine *sublation_runtime.Engine, inputs []string, verbose bool) {
+// runStreaming processes continuous input in streaming mode. Typed
+// formats take one input per file or stdin line, the data of the model's
+// inputs back to back being the streaming input.
+func runStreaming(engine *sublation_runtime.Engine, inputs []string, format string, results *outputWriter, eval *evaluator, verbose bool) {
 	if len(inputs) > 0 {
 		// Process multiple input files sequentially
 		for _, filename := range inputs {
@@ -136,9 +620,15 @@ func runStreaming(engine *sublation_runtime.Engine, inputs []string, verbose boo
 				log.Printf("Warning: failed to read %s: %v", filename, err)
 				continue
 			}
+			if f := inputFormat(format, filename); f != inputRaw {
+				if data, err = streamingInput(f, data, filename, engine.Graph()); err != nil {
+					log.Printf("Invalid input %s: %v", filename, err)
+					continue
+				}
+			}
 
 			// Execute with this input
-			output := make([]byte, engine.ArenaBytes())
+			output := make([]byte, engine.OutputSize())
 			if err := engine.ExecuteStreaming(data, output); err != nil {
 				log.Printf("Streaming execution error: %v", err)
 				continue
@@ -149,18 +639,28 @@ func runStreaming(engine *sublation_runtime.Engine, inputs []string, verbose boo
 					filename, len(data), len(output))
 			}
 
-			// Write output
-			os.Stdout.Write(output)
-			os.Stdout.Write([]byte("\n"))
+			if err := results.write(output); err != nil {
+				exit.Fatalf(exit.IO, "Failed to write results: %v", err)
+			}
+			if err := eval.add(); err != nil {
+				exit.Fatalf(exit.Validation, "Eval failed: %v", err)
+			}
 		}
 	} else {
 		// Read from stdin line by line
 		scanner := bufio.NewScanner(os.Stdin)
 		for scanner.Scan() {
 			inputData := scanner.Bytes()
+			if f := inputFormat(format, ""); f != inputRaw {
+				var err error
+				if inputData, err = streamingInput(f, inputData, "", engine.Graph()); err != nil {
+					log.Printf("Invalid input line: %v", err)
+					continue
+				}
+			}
 
 			// Execute with this input
-			output := make([]byte, engine.ArenaBytes())
+			output := make([]byte, engine.OutputSize())
 			if err := engine.ExecuteStreaming(inputData, output); err != nil {
 				log.Printf("Streaming execution error: %v", err)
 				continue
@@ -171,9 +671,12 @@ func runStreaming(engine *sublation_runtime.Engine, inputs []string, verbose boo
 					len(inputData), len(output))
 			}
 
-			// Write output
-			os.Stdout.Write(output)
-			os.Stdout.Write([]byte("\n"))
+			if err := results.write(output); err != nil {
+				exit.Fatalf(exit.IO, "Failed to write results: %v", err)
+			}
+			if err := eval.add(); err != nil {
+				exit.Fatalf(exit.Validation, "Eval failed: %v", err)
+			}
 		}
 		if err := scanner.Err(); err != nil {
 			log.Printf("Error reading stdin: %v", err)
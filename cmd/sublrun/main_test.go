@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/metrics"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/ioutil"
+	"github.com/sbl8/sublation/training"
+)
+
+// sublrun is the command built for the tests
+var sublrun string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "sublrun")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	sublrun = filepath.Join(dir, "sublrun")
+	if out, err := exec.Command("go", "build", "-o", sublrun, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Building sublrun failed: %v\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// chainSpec computes y = relu(add(x, b)) and z = sigmoid(y) of an input x
+// with b = [0.5, 0.5, -4, 1] read from b.bin
+const chainSpec = `tensor x f32[4] input
+tensor b f32[4] = @b.bin
+node h = add(x, b)
+node y = relu(h)
+node z = sigmoid(y)
+output y z
+`
+
+// compileChain compiles chainSpec in dir and returns the model path
+func compileChain(t *testing.T, dir string) string {
+	t.Helper()
+	var b []byte
+	for _, v := range []float32{0.5, 0.5, -4, 1} {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	src := filepath.Join(dir, "chain.subs")
+	if err := os.WriteFile(filepath.Join(dir, "b.bin"), b, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(src, []byte(chainSpec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "chain.subl")
+	if err := compiler.Compile(src, out); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	return out
+}
+
+// runSublrun runs sublrun with args and stdin and returns its stdout
+func runSublrun(t *testing.T, stdin string, args ...string) []byte {
+	t.Helper()
+	out, _ := runSublrunStderr(t, stdin, args...)
+	return out
+}
+
+// runSublrunStderr is runSublrun also returning stderr
+func runSublrunStderr(t *testing.T, stdin string, args ...string) (stdout, stderr []byte) {
+	t.Helper()
+	cmd := exec.Command(sublrun, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var errOut bytes.Buffer
+	cmd.Stderr = &errOut
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("sublrun %s failed: %v\n%s", strings.Join(args, " "), err, errOut.Bytes())
+	}
+	return out, errOut.Bytes()
+}
+
+// equalFloats reports whether got and want agree within float32 rounding
+func equalFloats(got []float64, want []float32) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if math.Abs(got[i]-float64(want[i])) > 1e-6 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCSVInputJSONOutput(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	model := compileChain(t, dir)
+	input := filepath.Join(dir, "x.csv")
+	if err := os.WriteFile(input, []byte("1,-2,3,-4\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// x + b = [1.5, -1.5, -1, -3]; sigmoid is the kernel's y / (1 + |y|)
+	want := map[string][]float32{"y": {1.5, 0, 0, 0}, "z": {0.6, 0, 0, 0}}
+	for mode, args := range map[string][]string{
+		"single":    {model, input},
+		"streaming": {"-streaming", "-workers", "4", model, input},
+	} {
+		out := runSublrun(t, "", append([]string{"-input-format", "csv", "-output-format", "json"}, args...)...)
+		var got map[string]struct {
+			DType string    `json:"dtype"`
+			Shape []int     `json:"shape"`
+			Data  []float64 `json:"data"`
+		}
+		if err := json.Unmarshal(out, &got); err != nil {
+			t.Fatalf("%s: invalid JSON output %q: %v", mode, out, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: expected outputs y and z, got %s", mode, out)
+		}
+		for name, w := range want {
+			if g := got[name]; g.DType != "float32" || len(g.Shape) != 1 || g.Shape[0] != 4 || !equalFloats(g.Data, w) {
+				t.Errorf("%s: expected %s = float32[4] %v, got %s", mode, name, w, out)
+			}
+		}
+	}
+}
+
+func TestStreamingRawOutput(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	model := compileChain(t, dir)
+	// Each line is one execution, returning y then z as float32
+	out := runSublrun(t, "1,-2,3,-4\n-1,2,-3,4\n", "-streaming", "-input-format", "csv", model)
+	var want []byte
+	for _, v := range []float32{1.5, 0, 0, 0, 0.6, 0, 0, 0} {
+		want = binary.LittleEndian.AppendUint32(want, math.Float32bits(v))
+	}
+	want = append(want, '\n')
+	for _, v := range []float32{0, 2.5, 0, 5, 0, 2.5 / 3.5, 0, 5.0 / 6} {
+		want = binary.LittleEndian.AppendUint32(want, math.Float32bits(v))
+	}
+	want = append(want, '\n')
+	if !bytes.Equal(out, want) {
+		t.Errorf("Expected y and z of each line\n%v, got\n%v", want, out)
+	}
+}
+
+func TestStreamingNPYOut(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	model := compileChain(t, dir)
+	want := map[string][]float32{"y": {1.5, 0, 0, 0}, "z": {0.6, 0, 0, 0}}
+	for _, scheduler := range []string{"levels", "worksteal"} {
+		npy := filepath.Join(dir, scheduler)
+		runSublrun(t, "1,-2,3,-4\n", "-streaming", "-workers", "4", "-scheduler", scheduler, "-input-format", "csv", "-npy-out", npy, model)
+		for name, w := range want {
+			f, err := os.Open(filepath.Join(npy, name+".npy"))
+			if err != nil {
+				t.Fatalf("%s: Open failed: %v", scheduler, err)
+			}
+			tensor, err := ioutil.ReadNPY(f)
+			f.Close()
+			if err != nil {
+				t.Fatalf("%s: ReadNPY of %s failed: %v", scheduler, name, err)
+			}
+			if got, err := tensor.Values(); err != nil || !equalFloats(got, w) {
+				t.Errorf("%s: expected %s = %v, got %v (%v)", scheduler, name, w, got, err)
+			}
+		}
+	}
+}
+
+func TestEvalMatchesTrainingForward(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	modelPath := compileChain(t, dir)
+	inputs := []string{"1,-2,3,-4", "-1,2,-3,4", "0.25,0.5,4,-1"}
+	labels := "1,0,0,0\n0,2,0,5\n1,1,0,0\n"
+	labelsPath := filepath.Join(dir, "labels.csv")
+	if err := os.WriteFile(labelsPath, []byte(labels), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Score y, the first declared output, as the training forward pass
+	// computes it, with z as the loss
+	graph, err := sublation_runtime.ReadGraph(modelPath, nil)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+	outputs := graph.Outputs()
+	want, err := metrics.Parse("mse,mae")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLabels, err := metrics.ReadLabels(strings.NewReader(labels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range inputs {
+		tensors, err := ioutil.ParseCSV([]byte(line), graph.Inputs())
+		if err != nil {
+			t.Fatalf("ParseCSV failed: %v", err)
+		}
+		g := *graph
+		g.Payload = slices.Clone(graph.Payload)
+		if err := ioutil.BindInputs(&g, tensors); err != nil {
+			t.Fatalf("BindInputs failed: %v", err)
+		}
+		b, err := training.Differentiate(&g, outputs[1].NodeID)
+		if err != nil {
+			t.Fatalf("Differentiate failed: %v", err)
+		}
+		buf := make([]byte, b.Size)
+		if _, err := b.Forward(buf); err != nil {
+			t.Fatalf("Forward failed: %v", err)
+		}
+		y, _ := b.Value(buf, outputs[0].NodeID)
+		pred := make([]float64, len(y))
+		for j, v := range y {
+			pred[j] = float64(v)
+		}
+		if err := want.Add(pred, wantLabels[i]); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	_, stderr := runSublrunStderr(t, strings.Join(inputs, "\n")+"\n", "-streaming", "-workers", "4", "-input-format", "csv",
+		"-eval", labelsPath, "-metrics", "mse,mae", "-output-file", filepath.Join(dir, "out"), modelPath)
+	if line := fmt.Sprintf("Eval of %q over 3 executions: %v", "y", want); !strings.Contains(string(stderr), line) {
+		t.Errorf("Expected %q, got %s", line, stderr)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// Output formats of -output-format. Raw writes the output each streaming
+// execution returns, the others the declared outputs.
+const (
+	outputRaw     = "raw"
+	outputFloat32 = "float32"
+	outputJSON    = "json"
+	outputNPY     = "npy"
+	outputCSV     = "csv"
+)
+
+// outputWriter writes what each execution produced in one of the
+// -output-format formats
+type outputWriter struct {
+	format    string
+	w         io.Writer
+	specs     []model.IOSpec
+	collector *ioutil.OutputCollector // Observes the engine, nil for raw
+}
+
+// newOutputWriter checks that g declares outputs to write in format
+func newOutputWriter(g *model.Graph, format string, w io.Writer) (*outputWriter, error) {
+	switch format {
+	case outputRaw:
+		return &outputWriter{format: format, w: w}, nil
+	case outputFloat32, outputJSON, outputNPY, outputCSV:
+	default:
+		return nil, fmt.Errorf("unknown format %q, want raw, float32, json, npy or csv", format)
+	}
+	specs := g.Outputs()
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%s output needs the model to declare outputs", format)
+	}
+	return &outputWriter{format: format, w: w, specs: specs, collector: ioutil.NewOutputCollector(g)}, nil
+}
+
+// write writes the results of the last execution. Raw writes output, what
+// a streaming execution returns, and a newline; single executions have
+// none. The other formats write the declared outputs: float32 values back
+// to back in declaration order, a JSON object per line keyed by output
+// name, a .npy array, or a .npz archive for several outputs, or CSV rows
+// under a "# name dtype[shape]" line per output.
+func (o *outputWriter) write(output []byte) error {
+	if o.format == outputRaw {
+		if output == nil {
+			return nil
+		}
+		_, err := o.w.Write(append(output, '\n'))
+		return err
+	}
+	tensors, err := o.collector.Outputs()
+	if err != nil {
+		return err
+	}
+	switch o.format {
+	case outputJSON:
+		data, err := json.Marshal(tensors)
+		if err != nil {
+			return err
+		}
+		_, err = o.w.Write(append(data, '\n'))
+		return err
+	case outputNPY:
+		if len(tensors) == 1 {
+			return ioutil.WriteNPY(o.w, tensors[o.specs[0].Name])
+		}
+		return ioutil.WriteNPZ(o.w, tensors)
+	}
+	for _, s := range o.specs {
+		t := tensors[s.Name]
+		if o.format == outputFloat32 {
+			err = ioutil.WriteFloat32(o.w, t)
+		} else if _, err = fmt.Fprintf(o.w, "# %s %v\n", s.Name, t); err == nil {
+			err = ioutil.WriteCSV(o.w, t)
+		}
+		if err != nil {
+			return fmt.Errorf("output %q: %w", s.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// Command subls is a language server for the .subs model DSL. It speaks
+// the Language Server Protocol over stdin and stdout and checks documents
+// with the compiler's parser: diagnostics when a document is opened or
+// saved, go-to-definition for named nodes, tensors, constants, modules and
+// segments, hover documentation for kernels from the kernel registry and
+// for declared names, and completion of kernel names.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/sbl8/sublation/internal/version"
+)
+
+func main() {
+	showVersion := flag.Bool("version", false, "Show version information")
+	flag.Parse()
+	if *showVersion {
+		version.Print(os.Stdout, "subls")
+		return
+	}
+
+	// stdout carries the protocol, so logs go to stderr
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("subls: ")
+	os.Exit(newServer(os.Stdin, os.Stdout).run())
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/kernels"
+)
+
+// server answers the requests of one editor
+type server struct {
+	conn *conn
+
+	mu        sync.Mutex
+	docs      map[string]string   // Open documents by URI
+	published map[string][]string // URIs each document published diagnostics for
+	shutdown  bool
+}
+
+func newServer(r io.Reader, w io.Writer) *server {
+	return &server{conn: newConn(r, w), docs: make(map[string]string), published: make(map[string][]string)}
+}
+
+// run serves requests until the client exits, returning the exit code:
+// 0 after a shutdown request, 1 otherwise
+func (s *server) run() int {
+	for {
+		msg, err := s.conn.read()
+		if err != nil {
+			if rerr, ok := err.(*rpcError); ok {
+				s.reply(nil, nil, rerr)
+				continue
+			}
+			if err != io.EOF {
+				log.Printf("read: %v", err)
+			}
+			return 1
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, rerr := s.handle(msg)
+		if msg.ID != nil {
+			s.reply(msg.ID, result, rerr)
+		}
+	}
+}
+
+// reply answers the request with id
+func (s *server) reply(id json.RawMessage, result any, rerr *rpcError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	msg := &message{ID: id, Result: result, Error: rerr}
+	if rerr == nil && result == nil {
+		msg.Result = json.RawMessage("null")
+	}
+	if err := s.conn.write(msg); err != nil {
+		log.Printf("write: %v", err)
+	}
+}
+
+// notify sends a notification to the client
+func (s *server) notify(method string, params any) {
+	data, err := json.Marshal(params)
+	if err == nil {
+		err = s.conn.write(&message{Method: method, Params: data})
+	}
+	if err != nil {
+		log.Printf("write %s: %v", method, err)
+	}
+}
+
+// handle dispatches a request or notification
+func (s *server) handle(msg *message) (any, *rpcError) {
+	decode := func(v any) *rpcError {
+		if err := json.Unmarshal(msg.Params, v); err != nil {
+			return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    1, // Full documents
+					"save":      map[string]any{"includeText": true},
+				},
+				"definitionProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]any{},
+			},
+			"serverInfo": map[string]string{"name": "subls", "version": version.Get().Version},
+		}, nil
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		s.setText(p.TextDocument.URI, p.TextDocument.Text)
+		s.diagnose(p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.setText(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		var p didSaveParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		if p.Text != nil {
+			s.setText(p.TextDocument.URI, *p.Text)
+		}
+		s.diagnose(p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didClose":
+		var p struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		s.close(p.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.definition(p), nil
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.hover(p), nil
+	case "textDocument/completion":
+		return completions(), nil
+	}
+	if msg.ID == nil {
+		return nil, nil // Notifications the server does not handle
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not supported", msg.Method)}
+}
+
+func (s *server) setText(uri, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[uri] = text
+}
+
+func (s *server) text(uri string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text, ok := s.docs[uri]
+	return text, ok
+}
+
+// close forgets a document and clears its diagnostics
+func (s *server) close(uri string) {
+	s.mu.Lock()
+	delete(s.docs, uri)
+	stale := s.published[uri]
+	delete(s.published, uri)
+	s.mu.Unlock()
+	for _, u := range stale {
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: u, Diagnostics: []diagnostic{}})
+	}
+}
+
+// analyze checks the open document at uri with the compiler's parser
+func (s *server) analyze(uri string) (*compiler.Analysis, string, bool) {
+	text, ok := s.text(uri)
+	if !ok {
+		return nil, "", false
+	}
+	path := uriPath(uri)
+	return compiler.Analyze([]byte(text), path), path, true
+}
+
+// diagnose publishes the errors and warnings of the document at uri, those
+// in files it includes under their own URIs, and clears the files that
+// had some the last time and no longer do
+func (s *server) diagnose(uri string) {
+	a, path, ok := s.analyze(uri)
+	if !ok {
+		return
+	}
+	byURI := map[string][]diagnostic{uri: {}}
+	order := []string{uri}
+	for _, e := range a.Diagnostics {
+		target := uri
+		if e.File != "" && filepath.Clean(e.File) != filepath.Clean(path) {
+			target = pathURI(e.File)
+		}
+		if _, seen := byURI[target]; !seen {
+			order = append(order, target)
+		}
+		byURI[target] = append(byURI[target], s.diagnostic(target, e))
+	}
+
+	s.mu.Lock()
+	stale := s.published[uri]
+	s.published[uri] = order
+	s.mu.Unlock()
+	for _, u := range stale {
+		if _, ok := byURI[u]; !ok {
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: u, Diagnostics: []diagnostic{}})
+		}
+	}
+	for _, u := range order {
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: u, Diagnostics: byURI[u]})
+	}
+}
+
+// diagnostic converts a compiler error in the document at uri, marking
+// the word at its column or, without one, its whole line
+func (s *server) diagnostic(uri string, e *compiler.SyntaxError) diagnostic {
+	d := diagnostic{Severity: severityError, Source: "subls", Message: e.Msg}
+	if e.Warning {
+		d.Severity, d.Code = severityWarning, string(e.Class)
+	}
+	if e.Line < 1 {
+		return d // The start of the file
+	}
+	line := e.Source
+	if text, ok := s.text(uri); ok {
+		line = lineAt(text, e.Line-1)
+	}
+	start, end := 0, len(line)
+	if e.Col > 0 {
+		start = min(e.Col-1, len(line))
+		end = start
+		for end < len(line) && wordByte(line[end]) {
+			end++
+		}
+		end = max(end, min(start+1, len(line)))
+	}
+	d.Range = lspRange{
+		Start: position{Line: e.Line - 1, Character: utf16Col(line, start)},
+		End:   position{Line: e.Line - 1, Character: utf16Col(line, end)},
+	}
+	return d
+}
+
+// definition returns where the name under the cursor is declared
+func (s *server) definition(p textDocumentPositionParams) any {
+	a, _, ok := s.analyze(p.TextDocument.URI)
+	if !ok {
+		return nil
+	}
+	text, _ := s.text(p.TextDocument.URI)
+	word, _ := wordAt(lineAt(text, p.Position.Line), p.Position.Character)
+	sym, ok := a.Lookup(strings.TrimPrefix(word, "@"))
+	if !ok {
+		return nil
+	}
+	return s.symbolLocation(sym)
+}
+
+// symbolLocation returns the range of a symbol's name in its declaration
+func (s *server) symbolLocation(sym compiler.Symbol) location {
+	uri := pathURI(sym.Pos.File)
+	line := sym.Decl
+	if text, ok := s.text(uri); ok {
+		line = lineAt(text, sym.Pos.Line-1)
+	}
+	start := max(sym.Pos.Col-1, 0)
+	return location{URI: uri, Range: lspRange{
+		Start: position{Line: sym.Pos.Line - 1, Character: utf16Col(line, start)},
+		End:   position{Line: sym.Pos.Line - 1, Character: utf16Col(line, start+len(sym.Name))},
+	}}
+}
+
+// hover documents the kernel or declared name under the cursor
+func (s *server) hover(p textDocumentPositionParams) any {
+	text, ok := s.text(p.TextDocument.URI)
+	if !ok {
+		return nil
+	}
+	line := lineAt(text, p.Position.Line)
+	word, start := wordAt(line, p.Position.Character)
+	if word == "" {
+		return nil
+	}
+	r := &lspRange{
+		Start: position{Line: p.Position.Line, Character: utf16Col(line, start)},
+		End:   position{Line: p.Position.Line, Character: utf16Col(line, start+len(word))},
+	}
+	if doc, ok := kernelDoc(word); ok {
+		return hover{Contents: markupContent{Kind: "markdown", Value: doc}, Range: r}
+	}
+	a, _, _ := s.analyze(p.TextDocument.URI)
+	sym, ok := a.Lookup(strings.TrimPrefix(word, "@"))
+	if !ok {
+		return nil
+	}
+	value := fmt.Sprintf("%s **%s**, declared at %v\n\n```subs\n%s\n```", sym.Kind, sym.Name, sym.Pos, sym.Decl)
+	return hover{Contents: markupContent{Kind: "markdown", Value: value}, Range: r}
+}
+
+// kernelDoc documents the kernel called name from the kernel registry
+func kernelDoc(name string) (string, bool) {
+	op, ok := kernels.Lookup(name)
+	if !ok {
+		return "", false
+	}
+	info, _ := kernels.Info(op)
+	doc := fmt.Sprintf("kernel **%s** (opcode 0x%02x)", info.Name, op)
+	switch info.Arity {
+	case 0:
+	case 1:
+		doc += ", 1 input"
+	default:
+		doc += fmt.Sprintf(", %d inputs", info.Arity)
+	}
+	if info.Doc != "" {
+		doc += "\n\n" + info.Doc
+	}
+	return doc, true
+}
+
+// completions lists the kernels of the registry
+func completions() []completionItem {
+	names := kernels.Names()
+	items := make([]completionItem, len(names))
+	for i, name := range names {
+		op, _ := kernels.Lookup(name)
+		info, _ := kernels.Info(op)
+		items[i] = completionItem{Label: name, Kind: completionFunction, Detail: fmt.Sprintf("kernel 0x%02x", op)}
+		if info.Doc != "" {
+			items[i].Documentation = &markupContent{Kind: "markdown", Value: info.Doc}
+		}
+	}
+	return items
+}
+
+// wordAt returns the name, segment reference or kernel at a UTF-16 column
+// of line, and its byte offset
+func wordAt(line string, col int) (string, int) {
+	i := byteCol(line, col)
+	start, end := i, i
+	for start > 0 && wordByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && wordByte(line[end]) {
+		end++
+	}
+	return line[start:end], start
+}
+
+// wordByte reports whether c can be part of a name or "@" reference
+func wordByte(c byte) bool {
+	return c == '_' || c == '.' || c == '@' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// uriPath returns the file path of a file URI, or the URI when it is not one
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathURI returns the file URI of a path
+func pathURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
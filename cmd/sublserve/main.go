@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sbl8/sublation/internal/config"
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/serve"
+)
+
+// modelFlags collects repeated -model name=path flags.
+type modelFlags map[string]string
+
+func (m modelFlags) String() string {
+	pairs := make([]string, 0, len(m))
+	for name, path := range m {
+		pairs = append(pairs, name+"="+path)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m modelFlags) Set(value string) error {
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" || path == "" {
+		return fmt.Errorf("want name=path, got %q", value)
+	}
+	m[name] = path
+	return nil
+}
+
+func main() {
+	models := modelFlags{}
+	flag.Var(models, "model", "Model to serve as name=path.subl (repeatable)")
+	var (
+		workers = flag.Int("workers", runtime.NumCPU(), "Size of the shared worker pool")
+		listen  = flag.String("http", ":8080", "Listen address of the REST predict endpoint")
+		admin   = flag.String("admin", ":8081", "Listen address of the health and stats endpoint")
+		grpc    = flag.String("grpc", "", "Listen address of the gRPC service of serve.proto, which needs -tls-cert and -tls-key; empty for none")
+		tlsCert = flag.String("tls-cert", "", "PEM certificate file of the gRPC listener")
+		tlsKey  = flag.String("tls-key", "", "PEM private key file of the gRPC listener")
+		drain   = flag.Duration("drain", 10*time.Second, "How long to wait for in-flight requests on shutdown")
+		verify  = flag.String("verify", "", "Only load models signed by this PEM Ed25519 public key")
+		cfgPath = flag.String("config", "", "Take the default for -workers from this file instead of the sublation.toml or sublation.yaml found from the working directory; none for no file")
+		verbose = flag.Bool("verbose", false, "Enable verbose output")
+		showVer = flag.Bool("version", false, "Show version information")
+	)
+	flag.Parse()
+
+	if *showVer {
+		version.Print(os.Stdout, "sublserve")
+		return
+	}
+
+	cfg, err := config.Load(*cfgPath)
+	if err == nil {
+		err = cfg.Apply(flag.CommandLine, map[string]string{"workers": "workers"})
+	}
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	if *grpc != "" && (*tlsCert == "" || *tlsKey == "") {
+		log.Fatalf("-grpc needs -tls-cert and -tls-key: gRPC runs on HTTP/2, served over TLS")
+	}
+
+	if len(models) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s -model name=model.subl [-model ...] [options]\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	host := newHost(models, *workers, *verify, *verbose)
+
+	service := serve.NewService(host)
+	api := http.NewServeMux()
+	for _, name := range host.Models() {
+		engine, _ := host.Engine(name)
+		api.Handle("/v1/models/"+name+"/predict", serve.NewHTTPHandler(engine))
+	}
+	servers := []*http.Server{
+		{Addr: *listen, Handler: api},
+		{Addr: *admin, Handler: serve.NewAdminHandler(service)},
+	}
+
+	grpcServer := &http.Server{Addr: *grpc, Handler: serve.NewGRPCHandler(service)}
+	if *grpc != "" {
+		servers = append(servers, grpcServer)
+	}
+
+	listenAll(servers, grpcServer, *tlsCert, *tlsKey)
+	if *verbose {
+		fmt.Printf("Serving %d models on %s, admin endpoint on %s\n", len(models), *listen, *admin)
+		if *grpc != "" {
+			fmt.Printf("gRPC service on %s\n", *grpc)
+		}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	// Fail health checks first so balancers stop routing, then drain
+	service.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), *drain)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Listener on %s shutdown: %v", server.Addr, err)
+		}
+	}
+	if err := host.Close(ctx); err != nil {
+		log.Fatalf("Failed to drain models: %v", err)
+	}
+}
+
+// newHost loads models into a host with a worker pool of the given size,
+// verifying their signatures against the public key file verify unless it
+// is empty
+func newHost(models modelFlags, workers int, verify string, verbose bool) *sublation_runtime.Host {
+	hostOpts := sublation_runtime.HostOptions{
+		Workers:     workers,
+		EnableStats: true,
+		Streaming:   true,
+	}
+	if verify != "" {
+		pemData, err := os.ReadFile(verify)
+		if err != nil {
+			log.Fatalf("Failed to read public key: %v", err)
+		}
+		if hostOpts.VerifyKey, err = model.ParsePublicKey(pemData); err != nil {
+			log.Fatalf("Invalid public key %s: %v", verify, err)
+		}
+	}
+	host := sublation_runtime.NewHost(&hostOpts)
+	for name, path := range models {
+		if err := host.Load(name, path); err != nil {
+			log.Fatalf("Failed to load model: %v", err)
+		}
+		if verbose {
+			fmt.Printf("Loaded model %q from %s\n", name, path)
+		}
+	}
+	return host
+}
+
+// listenAll starts every server in the background, tlsServer with the
+// certificate and key files, and exits when one fails
+func listenAll(servers []*http.Server, tlsServer *http.Server, cert, key string) {
+	for _, server := range servers {
+		go func(server *http.Server) {
+			var err error
+			if server == tlsServer {
+				err = server.ListenAndServeTLS(cert, key)
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Listener on %s failed: %v", server.Addr, err)
+			}
+		}(server)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+)
+
+// analysis is what subltrace derives from a trace. A trace may cover many
+// executions: the n-th call of each node is taken to belong to the n-th
+// execution.
+type analysis struct {
+	runs    [][]sublation_runtime.TraceEvent // Events of each execution, by start
+	wall    time.Duration                    // Sum of the executions' spans
+	nodes   map[uint32]*nodeStats
+	workers map[int]*workerStats
+}
+
+type nodeStats struct {
+	id     uint32
+	name   string
+	kernel uint8
+	calls  int
+	total  time.Duration
+	max    time.Duration
+}
+
+func (n *nodeStats) mean() time.Duration { return n.total / time.Duration(n.calls) }
+
+type workerStats struct {
+	calls int
+	busy  time.Duration
+}
+
+func analyze(events []sublation_runtime.TraceEvent) *analysis {
+	events = slices.Clone(events)
+	slices.SortStableFunc(events, func(a, b sublation_runtime.TraceEvent) int { return a.Start.Compare(b.Start) })
+
+	a := &analysis{nodes: make(map[uint32]*nodeStats), workers: make(map[int]*workerStats)}
+	for _, ev := range events {
+		n := a.nodes[ev.NodeID]
+		if n == nil {
+			n = &nodeStats{id: ev.NodeID, name: ev.NodeName, kernel: ev.KernelID}
+			a.nodes[ev.NodeID] = n
+		}
+		if n.calls == len(a.runs) {
+			a.runs = append(a.runs, nil)
+		}
+		a.runs[n.calls] = append(a.runs[n.calls], ev)
+		n.calls++
+		n.total += ev.Duration()
+		n.max = max(n.max, ev.Duration())
+
+		w := a.workers[ev.Worker]
+		if w == nil {
+			w = &workerStats{}
+			a.workers[ev.Worker] = w
+		}
+		w.calls++
+		w.busy += ev.Duration()
+	}
+	for _, run := range a.runs {
+		start, end := span(run)
+		a.wall += end.Sub(start)
+	}
+	return a
+}
+
+// span returns when the first of events started and the last ended
+func span(events []sublation_runtime.TraceEvent) (start, end time.Time) {
+	for i, ev := range events {
+		if i == 0 || ev.Start.Before(start) {
+			start = ev.Start
+		}
+		if i == 0 || ev.End.After(end) {
+			end = ev.End
+		}
+	}
+	return start, end
+}
+
+// meanRun returns the mean span of an execution
+func (a *analysis) meanRun() time.Duration {
+	return a.wall / time.Duration(len(a.runs))
+}
+
+func (a *analysis) writeSummary(w io.Writer, file string) {
+	var kernel time.Duration
+	calls := 0
+	for _, n := range a.nodes {
+		kernel += n.total
+		calls += n.calls
+	}
+	fmt.Fprintf(w, "trace:      %s\n", file)
+	fmt.Fprintf(w, "events:     %d kernel calls of %d nodes on %d workers\n", calls, len(a.nodes), len(a.workers))
+	fmt.Fprintf(w, "executions: %d, mean %v\n", len(a.runs), a.meanRun())
+	fmt.Fprintf(w, "kernels:    %v in total, %v per execution\n", kernel, kernel/time.Duration(len(a.runs)))
+}
+
+// writeWorkers prints how busy each worker was while executions ran
+func (a *analysis) writeWorkers(w io.Writer) error {
+	ids := make([]int, 0, len(a.workers))
+	for id := range a.workers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	fmt.Fprintln(w, "\nworkers:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  WORKER\tCALLS\tBUSY\tUTILIZATION")
+	for _, id := range ids {
+		s := a.workers[id]
+		fmt.Fprintf(tw, "  %d\t%d\t%v\t%.1f%%\n", id, s.calls, s.busy, percent(s.busy, a.wall))
+	}
+	return tw.Flush()
+}
+
+// writeLevels prints when each scheduler level of graph ran within an
+// execution, on average, as a bar over the mean execution
+func (a *analysis) writeLevels(w io.Writer, graph *model.Graph, width int) error {
+	levels, err := graph.Levels()
+	if err != nil {
+		return err
+	}
+	type levelTime struct{ offset, length time.Duration }
+	times := make([]levelTime, len(levels))
+	var end time.Duration
+	for l, indices := range levels {
+		ids := make(map[uint32]bool, len(indices))
+		for _, i := range indices {
+			ids[graph.Nodes[i].ID] = true
+		}
+		var offset, length time.Duration
+		seen := 0
+		for _, run := range a.runs {
+			runStart, _ := span(run)
+			var level []sublation_runtime.TraceEvent
+			for _, ev := range run {
+				if ids[ev.NodeID] {
+					level = append(level, ev)
+				}
+			}
+			if len(level) == 0 {
+				continue
+			}
+			start, stop := span(level)
+			offset += start.Sub(runStart)
+			length += stop.Sub(start)
+			seen++
+		}
+		if seen > 0 {
+			times[l] = levelTime{offset / time.Duration(seen), length / time.Duration(seen)}
+		}
+		end = max(end, times[l].offset+times[l].length)
+	}
+
+	fmt.Fprintln(w, "\nlevels (mean per execution):")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  LEVEL\tNODES\tSTART\tSPAN\tTIMELINE")
+	for l, t := range times {
+		fmt.Fprintf(tw, "  %d\t%d\t%v\t%v\t|%s|\n", l, len(levels[l]), t.offset, t.length, bar(t.offset, t.length, end, width))
+	}
+	return tw.Flush()
+}
+
+// bar draws the interval [offset, offset+length) of total as width
+// characters, with at least one mark for a non-empty interval
+func bar(offset, length, total time.Duration, width int) string {
+	if total <= 0 {
+		return strings.Repeat(" ", width)
+	}
+	from := int(int64(offset) * int64(width) / int64(total))
+	to := int(int64(offset+length) * int64(width) / int64(total))
+	to = min(max(to, from+1), width)
+	from = min(from, to-1)
+	return strings.Repeat(" ", from) + strings.Repeat("#", to-from) + strings.Repeat(" ", width-to)
+}
+
+// writeCriticalPath prints the chain of dependent nodes with the longest
+// total mean kernel time, which bounds an execution however many workers
+// run it
+func (a *analysis) writeCriticalPath(w io.Writer, graph *model.Graph) error {
+	order, err := graph.TopologicalOrder()
+	if err != nil {
+		return err
+	}
+	cost := make(map[uint32]time.Duration, len(order))
+	prev := make(map[uint32]uint32, len(order))
+	var last uint32
+	var longest time.Duration
+	for _, i := range order {
+		n := graph.Nodes[i]
+		var best time.Duration
+		bestDep, hasDep := uint32(0), false
+		for _, dep := range n.Topo {
+			if c, ok := cost[dep]; ok && dep != model.NoNeighbor && (!hasDep || c > best) {
+				best, bestDep, hasDep = c, dep, true
+			}
+		}
+		if hasDep {
+			prev[n.ID] = bestDep
+		}
+		if s := a.nodes[n.ID]; s != nil {
+			best += s.mean()
+		}
+		cost[n.ID] = best
+		if best > longest || i == order[0] {
+			longest, last = best, n.ID
+		}
+	}
+
+	path := []uint32{last}
+	for {
+		p, ok := prev[path[len(path)-1]]
+		if !ok {
+			break
+		}
+		path = append(path, p)
+	}
+	slices.Reverse(path)
+
+	fmt.Fprintf(w, "\ncritical path: %v of the mean %v execution (%.1f%%)\n", longest, a.meanRun(), percent(longest, a.meanRun()))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NODE\tKERNEL\tMEAN")
+	for _, id := range path {
+		mean := "-"
+		kernel := "-"
+		if s := a.nodes[id]; s != nil {
+			mean = s.mean().String()
+			kernel = kernels.OpName(s.kernel)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", graph.NodeLabel(id), kernel, mean)
+	}
+	return tw.Flush()
+}
+
+// writeSlowest prints the n nodes with the longest mean kernel time
+func (a *analysis) writeSlowest(w io.Writer, n int) error {
+	stats := make([]*nodeStats, 0, len(a.nodes))
+	var total time.Duration
+	for _, s := range a.nodes {
+		stats = append(stats, s)
+		total += s.total
+	}
+	slices.SortFunc(stats, func(a, b *nodeStats) int {
+		return cmp.Or(cmp.Compare(b.mean(), a.mean()), cmp.Compare(a.id, b.id))
+	})
+	stats = stats[:min(n, len(stats))]
+
+	fmt.Fprintf(w, "\nslowest %d nodes:\n", len(stats))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NODE\tKERNEL\tCALLS\tMEAN\tMAX\tSHARE")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%v\t%v\t%.1f%%\n", model.NodeLabel(s.id, s.name), kernels.OpName(s.kernel),
+			s.calls, s.mean(), s.max, percent(s.total, total))
+	}
+	return tw.Flush()
+}
+
+// percent returns part as a percentage of whole, 0 for an empty whole
+func percent(part, whole time.Duration) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(whole)
+}
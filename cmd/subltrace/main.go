@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+)
+
+func main() {
+	modelPath := flag.String("model", "", "The traced model, for the per-level timeline and the critical path")
+	chrome := flag.String("chrome", "", "Write the trace in Chrome trace format to this file, for chrome://tracing or Perfetto")
+	top := flag.Int("top", 10, "Number of slowest nodes to list")
+	width := flag.Int("width", 50, "Width of the timeline bars in characters")
+	showVer := flag.Bool("version", false, "Show version information")
+	flag.Parse()
+
+	if *showVer {
+		version.Print(os.Stdout, "subltrace")
+		return
+	}
+
+	args := flag.Args()
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <trace.jsonl>\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		log.Fatalf("Failed to open trace: %v", err)
+	}
+	events, err := sublation_runtime.ReadTrace(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("Invalid trace %s: %v", args[0], err)
+	}
+	if len(events) == 0 {
+		log.Fatalf("Trace %s holds no events", args[0])
+	}
+
+	if *chrome != "" {
+		if err := writeChrome(*chrome, events); err != nil {
+			log.Fatalf("Failed to write Chrome trace: %v", err)
+		}
+	}
+
+	var graph *model.Graph
+	if *modelPath != "" {
+		if graph, err = sublation_runtime.ReadGraph(*modelPath, nil); err != nil {
+			log.Fatalf("Failed to load model: %v", err)
+		}
+	}
+
+	a := analyze(events)
+	a.writeSummary(os.Stdout, args[0])
+	if err := a.writeWorkers(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	if graph != nil {
+		if err := a.writeLevels(os.Stdout, graph, *width); err != nil {
+			log.Fatalf("Per-level timeline: %v", err)
+		}
+		if err := a.writeCriticalPath(os.Stdout, graph); err != nil {
+			log.Fatalf("Critical path: %v", err)
+		}
+	} else {
+		fmt.Println("\nPass -model for the per-level timeline and the critical path.")
+	}
+	if err := a.writeSlowest(os.Stdout, *top); err != nil {
+		log.Fatal(err)
+	}
+	if *chrome != "" {
+		fmt.Printf("\nWrote Chrome trace to %s\n", *chrome)
+	}
+}
+
+// writeChrome exports events to path in Chrome trace format
+func writeChrome(path string, events []sublation_runtime.TraceEvent) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := sublation_runtime.WriteChromeTrace(f, events); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
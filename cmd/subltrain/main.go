@@ -0,0 +1,316 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/internal/config"
+	"github.com/sbl8/sublation/internal/exit"
+	"github.com/sbl8/sublation/internal/version"
+	"github.com/sbl8/sublation/metrics"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/data"
+	"github.com/sbl8/sublation/runtime/trainer"
+	"github.com/sbl8/sublation/training"
+)
+
+// trainFlags holds the command line flags
+type trainFlags struct {
+	loss        string
+	epochs      int
+	rate        float64
+	batch       int
+	optimizer   string
+	shuffle     bool
+	seed        uint64
+	dropLast    bool
+	holdout     float64
+	metrics     string
+	predict     string
+	label       string
+	teacher     string
+	teacherAt   string
+	target      string
+	temperature float64
+	output      string
+	workers     int
+	replicas    int
+	config      string
+	errFormat   string
+	verbose     bool
+	version     bool
+}
+
+// parseFlags defines and parses the command line flags
+func parseFlags() *trainFlags {
+	f := new(trainFlags)
+	flag.StringVar(&f.loss, "loss", "", "Node ID or output name of the scalar loss to minimize")
+	flag.IntVar(&f.epochs, "epochs", 10, "Number of passes over the dataset")
+	flag.Float64Var(&f.rate, "lr", 0.01, "Learning rate")
+	flag.IntVar(&f.batch, "batch", 32, "Samples per optimizer step")
+	flag.StringVar(&f.optimizer, "optimizer", "sgd", "Optimizer: sgd, momentum or adam")
+	flag.BoolVar(&f.shuffle, "shuffle", true, "Visit the samples in a new random order every epoch")
+	flag.Uint64Var(&f.seed, "seed", 1, "Seed of the shuffle")
+	flag.BoolVar(&f.dropLast, "drop-last", false, "Skip the last batch of an epoch when it is short")
+	flag.Float64Var(&f.holdout, "holdout", 0, "Validate on this fraction of the dataset, taken from its end, after every epoch instead of training on it")
+	flag.StringVar(&f.metrics, "metrics", "", "Comma-separated validation metrics: accuracy, top<k>, precision, recall, f1, auc, mse or mae")
+	flag.StringVar(&f.predict, "predict", "", "Node ID or output name of the prediction the validation metrics score")
+	flag.StringVar(&f.label, "label", "", "Input holding the label the validation metrics score against")
+	flag.StringVar(&f.teacher, "teacher", "", "Distill from this trained model: its prediction on every sample is fed to the -target input instead of the dataset's")
+	flag.StringVar(&f.teacherAt, "teacher-output", "", "Node ID or output name of the teacher's prediction (default its first declared output)")
+	flag.StringVar(&f.target, "target", "", "Input of the model receiving the teacher's prediction as its soft target")
+	flag.Float64Var(&f.temperature, "temperature", 0, "Soften the teacher's logits into softmax(logits / temperature); 0 passes them on as they are")
+	flag.StringVar(&f.output, "o", "", "Write the trained model to this file (default <model>.trained.subl)")
+	flag.IntVar(&f.workers, "workers", runtime.NumCPU(), "Number of worker goroutines")
+	flag.IntVar(&f.replicas, "replicas", 1, "Train data-parallel on this many model replicas, each running a shard of every batch on its own goroutine")
+	flag.StringVar(&f.config, "config", "", "Take the default for -workers from this file instead of the sublation.toml or sublation.yaml found from the working directory; none for no file")
+	flag.StringVar(&f.errFormat, "error-format", "text", "Report the error subltrain exits on as text, or as a JSON object on stderr with its exit code and kind")
+	flag.BoolVar(&f.verbose, "verbose", false, "Enable verbose output")
+	flag.BoolVar(&f.version, "version", false, "Show version information")
+	flag.Parse()
+	return f
+}
+
+func main() {
+	f := parseFlags()
+	if f.version {
+		version.Print(os.Stdout, "subltrain")
+		return
+	}
+	f.applyConfig()
+
+	args := flag.Args()
+	if len(args) < 2 || f.loss == "" {
+		if exit.JSON() {
+			exit.Fatalf(exit.Usage, "want -loss, a <model.subl> and dataset arguments")
+		}
+		fmt.Fprintf(os.Stderr, "Usage: %s -loss <node> [options] <model.subl> <data.csv|data.bin|input.npy...>\n", os.Args[0])
+		flag.PrintDefaults()
+		os.Exit(int(exit.Usage))
+	}
+	kind, scores := f.validate()
+
+	modelPath := args[0]
+	graph, err := sublation_runtime.ReadGraph(modelPath, nil)
+	if err != nil {
+		exit.Fatalf(exit.Classify(err, exit.Parse), "Failed to load model: %v", err)
+	}
+	lossID, err := resolveNode(graph, f.loss)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "Invalid -loss: %v", err)
+	}
+	var predictID uint32
+	if f.predict != "" {
+		if predictID, err = resolveNode(graph, f.predict); err != nil {
+			exit.Fatalf(exit.Usage, "Invalid -predict: %v", err)
+		}
+	}
+	inputs, distill, targetSpec := f.setupTeacher(graph)
+
+	dataset, err := data.Open(inputs, args[1:]...)
+	if err != nil {
+		exit.Fatalf(exit.Classify(err, exit.Validation), "Failed to open dataset: %v", err)
+	}
+	defer dataset.Close()
+
+	// Batches are read into the streaming window, sized to hold one
+	window := f.batch * data.RecordSize(dataset.Fields())
+	replicated, err := trainer.NewReplicas(graph, &sublation_runtime.EngineOptions{
+		Workers:        f.workers,
+		Streaming:      true,
+		StreamingBytes: sublation_runtime.RegionBytes(uintptr(window)),
+		Training: &sublation_runtime.TrainingOptions{
+			Loss:      lossID,
+			Optimizer: training.Optimizer{Kind: kind},
+		},
+	}, f.replicas)
+	if err != nil {
+		exit.Fatalf(exit.Runtime, "Failed to create engine: %v", err)
+	}
+	train, held := data.Split(dataset, f.holdout)
+	trainData, validData := f.newLoaders(replicated.Primary(), train, held)
+	if distill != nil {
+		trainData, validData = distill.Distill(trainData, targetSpec), distill.Distill(validData, targetSpec)
+	}
+	if f.verbose {
+		if distill != nil {
+			fmt.Printf("Distilling from %s into input %q\n", f.teacher, f.target)
+		}
+		fmt.Printf("Training node %d of %s on %d samples, validating on %d, with %v on %d replicas\n", lossID, modelPath, train.Len(), held.Len(), kind, f.replicas)
+	}
+
+	for epoch := 1; epoch <= f.epochs; epoch++ {
+		f.trainEpoch(replicated, epoch, trainData, validData, held.Len() > 0, predictID, scores)
+	}
+	f.writeModel(graph, modelPath)
+}
+
+// applyConfig sets the error format and takes the flag defaults from the
+// config file
+func (f *trainFlags) applyConfig() {
+	if err := exit.SetFormat(f.errFormat); err != nil {
+		exit.Fatalf(exit.Usage, "Invalid -error-format: %v", err)
+	}
+	cfg, err := config.Load(f.config)
+	if err == nil {
+		err = cfg.Apply(flag.CommandLine, map[string]string{"workers": "workers"})
+	}
+	if err != nil {
+		exit.Fatalf(exit.Classify(err, exit.Usage), "Invalid config: %v", err)
+	}
+}
+
+// validate checks the flag values and returns the optimizer and the
+// validation metrics they select
+func (f *trainFlags) validate() (training.OptimizerKind, metrics.Set) {
+	if f.epochs < 1 || f.batch < 1 || f.replicas < 1 {
+		exit.Fatalf(exit.Usage, "Invalid -epochs %d, -batch %d or -replicas %d: want at least 1", f.epochs, f.batch, f.replicas)
+	}
+	kind, err := training.ParseOptimizer(f.optimizer)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "Invalid -optimizer: %v", err)
+	}
+	if f.holdout < 0 || f.holdout >= 1 {
+		exit.Fatalf(exit.Usage, "Invalid -holdout %v: want a fraction in [0, 1)", f.holdout)
+	}
+	scores, err := metrics.Parse(f.metrics)
+	if err != nil {
+		exit.Fatalf(exit.Usage, "Invalid -metrics: %v", err)
+	}
+	if len(scores) > 0 && (f.holdout == 0 || f.predict == "" || f.label == "") {
+		exit.Fatalf(exit.Usage, "-metrics needs -holdout, -predict and -label")
+	}
+	if (f.teacher == "") != (f.target == "") || (f.teacher == "" && (f.teacherAt != "" || f.temperature != 0)) {
+		exit.Fatalf(exit.Usage, "-teacher and -target go together, and -teacher-output and -temperature need them")
+	}
+	if f.temperature < 0 {
+		exit.Fatalf(exit.Usage, "Invalid -temperature %v: want at least 0", f.temperature)
+	}
+	return kind, scores
+}
+
+// setupTeacher loads the -teacher model and returns the inputs the dataset
+// holds, the teacher and the input it feeds; a distilled target comes from
+// the teacher instead of the dataset
+func (f *trainFlags) setupTeacher(graph *model.Graph) ([]model.IOSpec, *trainer.Teacher, model.IOSpec) {
+	inputs := graph.Inputs()
+	if f.teacher == "" {
+		return inputs, nil, model.IOSpec{}
+	}
+	i := slices.IndexFunc(inputs, func(s model.IOSpec) bool { return s.Name == f.target })
+	if i < 0 {
+		exit.Fatalf(exit.Usage, "Invalid -target: model has no input %q", f.target)
+	}
+	targetSpec := inputs[i]
+	inputs = slices.Delete(inputs, i, i+1)
+	distill, err := openTeacher(f.teacher, f.teacherAt)
+	if err != nil {
+		exit.Fatalf(exit.Classify(err, exit.Parse), "Failed to load teacher: %v", err)
+	}
+	distill.Temperature = float32(f.temperature)
+	return inputs, distill, targetSpec
+}
+
+// newLoaders returns the loaders of the training and validation samples,
+// which take turns reading into the streaming window of engine
+func (f *trainFlags) newLoaders(engine *sublation_runtime.Engine, train, held data.Source) (trainer.Dataset, trainer.Dataset) {
+	buf, err := engine.StreamingWindow()
+	if err != nil {
+		exit.Fatalf(exit.Runtime, "Failed to create engine: %v", err)
+	}
+	loader, err := data.NewLoader(train, data.Options{
+		BatchSize: f.batch,
+		Shuffle:   f.shuffle,
+		Seed:      f.seed,
+		DropLast:  f.dropLast,
+		Buffer:    buf,
+	})
+	if err != nil {
+		exit.Fatalf(exit.Runtime, "Failed to create loader: %v", err)
+	}
+	validation, err := data.NewLoader(held, data.Options{BatchSize: f.batch, Buffer: buf})
+	if err != nil {
+		exit.Fatalf(exit.Runtime, "Failed to create loader: %v", err)
+	}
+	return loader, validation
+}
+
+// trainEpoch runs one epoch and prints its loss, followed by the
+// validation loss and scores when validate is set
+func (f *trainFlags) trainEpoch(replicated *trainer.Replicas, epoch int, trainData, validData trainer.Dataset, validate bool, predictID uint32, scores metrics.Set) {
+	e, err := replicated.TrainEpoch(trainData, float32(f.rate))
+	if err != nil {
+		exit.Fatalf(exit.Runtime, "Training failed: epoch %d: %v", epoch, err)
+	}
+	fmt.Printf("epoch %d/%d: loss %.6g, %d samples in %d batches, %v", epoch, f.epochs, e.Loss, e.Samples, e.Batches, e.Duration)
+	if validate {
+		scores.Reset()
+		loss, err := trainer.Evaluate(replicated.Primary(), validData, predictID, f.label, scores)
+		if err != nil {
+			exit.Fatalf(exit.Runtime, "Validation failed: epoch %d: %v", epoch, err)
+		}
+		fmt.Printf("; validation loss %.6g", loss)
+		if len(scores) > 0 {
+			fmt.Printf(", %v", scores)
+		}
+	}
+	fmt.Println()
+}
+
+// writeModel writes the trained model to -o, by default next to modelPath
+func (f *trainFlags) writeModel(graph *model.Graph, modelPath string) {
+	output := f.output
+	if output == "" {
+		output = strings.TrimSuffix(modelPath, ".subl") + ".trained.subl"
+	}
+	serialized, err := graph.Serialize()
+	if err != nil {
+		exit.Fatalf(exit.Failure, "Failed to serialize model: %v", err)
+	}
+	if err := os.WriteFile(output, serialized, 0o644); err != nil {
+		exit.Fatalf(exit.IO, "Failed to write model: %v", err)
+	}
+	if f.verbose {
+		fmt.Printf("Wrote the trained model to %s\n", output)
+	}
+}
+
+// openTeacher loads the teacher model and resolves its prediction node,
+// by default its first declared output
+func openTeacher(path, ref string) (*trainer.Teacher, error) {
+	graph, err := sublation_runtime.ReadGraph(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var output uint32
+	if ref != "" {
+		if output, err = resolveNode(graph, ref); err != nil {
+			return nil, fmt.Errorf("-teacher-output: %w", err)
+		}
+	} else if outputs := graph.Outputs(); len(outputs) > 0 {
+		output = outputs[0].NodeID
+	} else {
+		return nil, fmt.Errorf("%s declares no outputs; name the prediction with -teacher-output", path)
+	}
+	return trainer.NewTeacher(graph, output)
+}
+
+// resolveNode returns the node a numeric ID or the name of a declared
+// output refers to
+func resolveNode(g *model.Graph, ref string) (uint32, error) {
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	for _, spec := range g.Outputs() {
+		if spec.Name == ref {
+			return spec.NodeID, nil
+		}
+	}
+	return 0, fmt.Errorf("no node ID or output named %q", ref)
+}
@@ -0,0 +1,87 @@
+//go:build js && wasm
+
+// Command sublwasm exposes the runtime to JavaScript when built for js/wasm.
+//
+//	GOOS=js GOARCH=wasm go build -o sublation.wasm ./cmd/sublwasm
+//
+// Running the module defines a global sublation object:
+//
+//	const model = sublation.load(bytes)  // Uint8Array holding a .subl file
+//	const out = model.run(input)         // Float32Array in, Float32Array out
+//	model.inputBytes, model.outputBytes  // Streaming window and output sizes
+//	model.free()
+//
+// load and run return an Error instead of throwing. The engine runs with one
+// worker, as browsers give a wasm module a single thread.
+package main
+
+import (
+	"context"
+	"syscall/js"
+
+	"github.com/sbl8/sublation/runtime"
+)
+
+func main() {
+	js.Global().Set("sublation", js.ValueOf(map[string]any{
+		"load": js.FuncOf(load),
+	}))
+	select {}
+}
+
+// jsError converts err into a JavaScript Error
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
+
+// bytesOf copies the bytes of a typed array into Go memory
+func bytesOf(v js.Value) []byte {
+	view := js.Global().Get("Uint8Array").New(v.Get("buffer"), v.Get("byteOffset"), v.Get("byteLength"))
+	b := make([]byte, view.Length())
+	js.CopyBytesToGo(b, view)
+	return b
+}
+
+// load implements sublation.load(bytes)
+func load(_ js.Value, args []js.Value) any {
+	if len(args) != 1 || args[0].Get("buffer").IsUndefined() {
+		return js.Global().Get("Error").New("load expects a Uint8Array")
+	}
+	graph, err := runtime.DecodeGraph(bytesOf(args[0]), nil)
+	if err != nil {
+		return jsError(err)
+	}
+	engine, err := runtime.NewEngine(graph, &runtime.EngineOptions{Workers: 1, Streaming: true})
+	if err != nil {
+		return jsError(err)
+	}
+
+	var run, free js.Func
+	run = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) != 1 || args[0].Get("buffer").IsUndefined() {
+			return js.Global().Get("Error").New("run expects a typed array")
+		}
+		output := make([]byte, engine.OutputSize())
+		if err := engine.ExecuteStreaming(bytesOf(args[0]), output); err != nil {
+			return jsError(err)
+		}
+		view := js.Global().Get("Uint8Array").New(len(output))
+		js.CopyBytesToJS(view, output)
+		return js.Global().Get("Float32Array").New(view.Get("buffer"))
+	})
+	free = js.FuncOf(func(js.Value, []js.Value) any {
+		err := engine.Close(context.Background())
+		run.Release()
+		free.Release()
+		if err != nil {
+			return jsError(err)
+		}
+		return nil
+	})
+	return js.ValueOf(map[string]any{
+		"run":         run,
+		"free":        free,
+		"inputBytes":  engine.InputSize(),
+		"outputBytes": engine.OutputSize(),
+	})
+}
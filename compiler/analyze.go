@@ -0,0 +1,87 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// SymbolKind is what a name in a spec declares
+type SymbolKind int
+
+const (
+	SymbolNode     SymbolKind = iota // Named node
+	SymbolTensor                     // Tensor
+	SymbolConstant                   // Constant from "let"
+	SymbolModule                     // Module definition
+	SymbolSegment                    // Named segment
+)
+
+var symbolKindNames = [...]string{"node", "tensor", "constant", "module", "segment"}
+
+func (k SymbolKind) String() string {
+	if int(k) < len(symbolKindNames) {
+		return symbolKindNames[k]
+	}
+	return fmt.Sprintf("SymbolKind(%d)", int(k))
+}
+
+// Symbol is a name a spec, or a spec it includes, declares
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	Pos  Pos    // Where the name is declared
+	Decl string // The declaring line
+}
+
+// Analysis is what checking a spec found, for editors and other tools
+type Analysis struct {
+	Diagnostics ErrorList // Errors, or warnings when the spec compiles
+	Symbols     []Symbol  // Declared names, in source order
+}
+
+// Analyze parses src as the spec at file, reading the files it includes
+// relative to it, and validates the graph when the parse succeeds, without
+// running passes or writing anything. Errors the parser cannot place, such
+// as validation errors, are reported at the file without a line.
+func Analyze(src []byte, file string) *Analysis {
+	rec := new(parseRecord)
+	g, warnings, err := parseSpec(src, file, rec)
+	if err == nil && len(g.Nodes) > 0 {
+		err = validateGraph(&g)
+	}
+	a := &Analysis{Diagnostics: warnings, Symbols: rec.symbols}
+	if err != nil {
+		var list ErrorList
+		var one *SyntaxError
+		switch {
+		case errors.As(err, &list):
+			a.Diagnostics = list
+		case errors.As(err, &one):
+			a.Diagnostics = ErrorList{one}
+		default:
+			a.Diagnostics = append(ErrorList{{Pos: Pos{File: file}, Msg: err.Error()}}, warnings...)
+		}
+	}
+	return a
+}
+
+// Lookup returns the declaration of name, the first when iterate blocks
+// declared it more than once
+func (a *Analysis) Lookup(name string) (Symbol, bool) {
+	i := slices.IndexFunc(a.Symbols, func(s Symbol) bool { return s.Name == name })
+	if i < 0 {
+		return Symbol{}, false
+	}
+	return a.Symbols[i], true
+}
+
+// declare records a name the line being parsed declares
+func (p *dslParser) declare(name string, kind SymbolKind) {
+	if p.record == nil {
+		return
+	}
+	pos := p.line.pos
+	pos.Col = tokenColumn(p.line.raw, name)
+	p.record.symbols = append(p.record.symbols, Symbol{Name: name, Kind: kind, Pos: pos, Decl: p.line.text})
+}
@@ -0,0 +1,69 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	consts := filepath.Join(dir, "consts.subs")
+	if err := os.WriteFile(consts, []byte("let W = 8\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	file := filepath.Join(dir, "m.subs")
+	spec := `include "consts.subs"
+segment 1 0 32 weight float32 Wt
+module block {
+    node 0 relu 0 32
+    output 0
+}
+tensor x f32[W] input
+node h = relu(x)
+`
+	a := Analyze([]byte(spec), file)
+	if len(a.Diagnostics) != 1 || !a.Diagnostics[0].Warning || !strings.Contains(a.Diagnostics[0].Msg, "module block is never used") {
+		t.Errorf("Expected only the unused module warning, got %v", a.Diagnostics)
+	}
+	want := map[string]struct {
+		kind SymbolKind
+		pos  Pos
+	}{
+		"W":     {SymbolConstant, Pos{File: consts, Line: 1, Col: 5}},
+		"Wt":    {SymbolSegment, Pos{File: file, Line: 2, Col: 31}},
+		"block": {SymbolModule, Pos{File: file, Line: 3, Col: 8}},
+		"x":     {SymbolTensor, Pos{File: file, Line: 7, Col: 8}},
+		"h":     {SymbolNode, Pos{File: file, Line: 8, Col: 6}},
+	}
+	if len(a.Symbols) != len(want) {
+		t.Errorf("Expected %d symbols, got %+v", len(want), a.Symbols)
+	}
+	for name, w := range want {
+		s, ok := a.Lookup(name)
+		if !ok || s.Kind != w.kind || s.Pos != w.pos {
+			t.Errorf("Expected %s %s at %v, got %+v", w.kind, name, w.pos, s)
+		}
+	}
+
+	a = Analyze([]byte("node y = sigmoid(hh)\n"), file)
+	if len(a.Diagnostics) != 1 || a.Diagnostics[0].Line != 1 || a.Diagnostics[0].Col != 18 {
+		t.Errorf("Expected an error at 1:18, got %v", a.Diagnostics)
+	}
+	// Errors without a position are reported at the file
+	a = Analyze([]byte("node 0 relu 0 32\nnode 1 relu 32 64 <- 7\npayload "+strings.Repeat("00", 96)+"\n"), file)
+	if len(a.Diagnostics) != 1 || a.Diagnostics[0].File != file || !strings.Contains(a.Diagnostics[0].Msg, "undefined node 7") {
+		t.Errorf("Expected the validation error at %s, got %v", file, a.Diagnostics)
+	}
+
+	for _, name := range kernels.Names() {
+		op, _ := kernels.Lookup(name)
+		if info, _ := kernels.Info(op); info.Doc == "" {
+			t.Errorf("Kernel %s has no documentation", name)
+		}
+	}
+}
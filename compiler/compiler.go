@@ -13,7 +13,7 @@
 // Supported optimizations:
 //   - Topological reordering for execution efficiency
 //   - Memory layout optimization for cache performance
-//   - Dead code elimination and kernel fusion analysis
+//   - Dead code elimination from declared outputs and kernel fusion
 //   - Payload compaction and alignment
 //
 // The compiler produces self-contained .subl files that include all model data,
@@ -21,18 +21,45 @@
 //
 // DSL features:
 //   - Node declarations with kernel opcodes and memory offsets
-//   - Hexadecimal payload data for weights and parameters
-//   - Iteration constructs for batch processing
+//   - Hexadecimal payload data for weights and parameters, float32
+//     literals, "payload @floats(1.0, 0.5)", and byte ranges of binary
+//     files, "payload @file("w.bin", 64, 1024)"
+//   - Iteration constructs for batch processing, with integer expressions
+//     on the loop variable, "node (i+10) 1 (i*64) (i*64+64)"
+//   - Named constants, "let HIDDEN = 256", in integer fields and shapes
 //   - Flexible topology specification for complex architectures
+//   - Tied payload segments shared by several nodes
+//   - A segment table of typed payload ranges nodes reference by ID
+//   - Named nodes, "node h = relu(x)", with compiler-assigned IDs and
+//     payload ranges sized from their shapes
+//   - Typed tensors, "tensor w f32[4, 8] = @w.bin", laid out and loaded by
+//     the compiler, and model inputs, "tensor x f32[8] input"
+//   - Parameterized includes of other specs, "include "layer.subs" n=64"
+//   - Errors and warnings with file:line:col positions and source
+//     excerpts, several per compile; see ErrorList
+//
+// Models can also be read from and written to the canonical JSON
+// interchange format, exported to ONNX and imported from GGUF weight files;
+// see Format.
+//   - Reusable modules instantiated any number of times
 package compiler
 
 import (
-	"encoding/binary"
+	"bytes"
+	"cmp"
+	"crypto/ed25519"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
+	"math"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sbl8/sublation/core"
 	"github.com/sbl8/sublation/model"
@@ -45,7 +72,7 @@ func Compile(src, out string) error {
 		return err
 	}
 
-	return writeSimpleGraph(&g, out)
+	return writeGraph(&g, out)
 }
 
 // loadAndParseSpec reads and parses a source file
@@ -55,234 +82,576 @@ func loadAndParseSpec(src string) (model.Graph, error) {
 		return model.Graph{}, err
 	}
 
-	return parseSpec(spec)
+	g, _, err := parseSpec(spec, src, nil)
+	return g, err
 }
 
-// writeSimpleGraph writes a graph in the simple binary format
-func writeSimpleGraph(g *model.Graph, out string) error {
-	f, err := os.Create(out)
+// writeGraph serializes g in the canonical model format and writes it to out
+func writeGraph(g *model.Graph, out string) error {
+	data, err := g.Serialize()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	writer := &simpleWriter{f: f}
-	return writer.writeGraph(g)
+	return os.WriteFile(out, data, 0o644)
 }
 
-// simpleWriter handles the original simple binary format
-type simpleWriter struct {
-	f *os.File
-}
-
-// writeGraph writes graph in simple format
-func (w *simpleWriter) writeGraph(g *model.Graph) error {
-	if err := w.writeSimpleHeader(g); err != nil {
-		return err
-	}
-
-	if err := w.writeSimpleNodes(g.Nodes); err != nil {
-		return err
-	}
-
-	return w.writeSimplePayload(g.Payload)
-}
+// --- DSL parser with support for node, payload, iterate and module blocks ---
+// parseSpec parses the DSL read from file and returns a Graph and the
+// warnings of the parse, or an ErrorList of every error found; files the
+// spec refers to are relative to its directory. When rec is set, it
+// collects the files the spec includes or reads and the names it declares.
+func parseSpec(src []byte, file string, rec *parseRecord) (model.Graph, ErrorList, error) {
+	var nodes []model.Node
+	var payload []byte
+	meta := model.Metadata{}
 
-// writeSimpleHeader writes the simple format header
-func (w *simpleWriter) writeSimpleHeader(g *model.Graph) error {
-	// Header: node count (uint32), payload length (uint32)
-	headers := []uint32{
-		uint32(len(g.Nodes)),
-		uint32(len(g.Payload)),
+	diag := &diagnostics{unusedModules: map[string]srcLine{}}
+	parser := &dslParser{nodes: &nodes, payload: &payload, meta: meta, modules: map[string]*model.Module{}, dir: filepath.Dir(file), diag: diag, consts: map[string]int64{}, record: rec}
+	parser.parseLines(specLines(string(src), file))
+	if len(diag.errs) > 0 {
+		return model.Graph{}, nil, diag.errs
 	}
+	parser.warnUnused()
 
-	for _, header := range headers {
-		if err := binary.Write(w.f, binary.LittleEndian, header); err != nil {
-			return err
+	// Zeros back named weight and bias segments past the payload, which
+	// are loaded at compile time; Validate wants node offsets inside the
+	// payload
+	for _, s := range parser.segments {
+		if s.Name == "" || s.Role == model.RoleActivation {
+			continue
 		}
-	}
-
-	return nil
-}
-
-// writeSimpleNodes writes nodes in simple format
-func (w *simpleWriter) writeSimpleNodes(nodes []model.Node) error {
-	for _, node := range nodes {
-		if err := w.writeSimpleNode(node); err != nil {
-			return err
+		if end := uint64(s.Offset) + uint64(s.Length); end > uint64(len(payload)) && end < math.MaxUint32 {
+			payload = append(payload, make([]byte, core.Align32(int(end)+1)-len(payload))...)
 		}
 	}
-	return nil
-}
 
-// writeSimpleNode writes a single node in simple format
-func (w *simpleWriter) writeSimpleNode(node model.Node) error {
-	// Write basic fields
-	fields := []interface{}{
-		node.ID,
-		node.Kernel,
-		node.In,
-		node.Out,
-		node.Flags,
+	// align payload
+	payload = alignPayload(payload)
+	graph := model.Graph{Nodes: nodes, Payload: payload, Segments: parser.segments}
+	if err := parser.markOutputs(); err != nil {
+		return model.Graph{}, nil, err
 	}
-
-	for _, field := range fields {
-		if err := binary.Write(w.f, binary.LittleEndian, field); err != nil {
-			return err
-		}
+	if err := resolveNamedNodes(&graph, parser.named); err != nil {
+		return model.Graph{}, nil, err
 	}
-
-	// Apply padding to NodeSize
-	return w.writeSimpleNodePadding()
-}
-
-// writeSimpleNodePadding pads node to fixed size
-func (w *simpleWriter) writeSimpleNodePadding() error {
-	pad := model.NodeSize() - (2 + 1 + 2 + 2 + 4) // ID+Kernel+In+Out+Flags
-	if pad > 0 {
-		padBytes := make([]byte, pad)
-		_, err := w.f.Write(padBytes)
-		return err
+	if err := resolveSegmentNames(&graph, parser.segmentRefs); err != nil {
+		return model.Graph{}, nil, err
 	}
-	return nil
-}
-
-// writeSimplePayload writes aligned payload
-func (w *simpleWriter) writeSimplePayload(payload []byte) error {
-	pad := core.Align32(len(payload)) - len(payload)
-
-	if _, err := w.f.Write(payload); err != nil {
-		return err
+	if err := graph.ResolveSegments(); err != nil {
+		return model.Graph{}, nil, err
 	}
-
-	if pad > 0 {
-		padBytes := make([]byte, pad)
-		_, err := w.f.Write(padBytes)
-		return err
+	if err := applyTies(graph.Nodes, parser.ties); err != nil {
+		return model.Graph{}, nil, err
 	}
-
-	return nil
+	if err := resolveNumberedOutputs(&graph, parser.outputs); err != nil {
+		return model.Graph{}, nil, err
+	}
+	graph.Debug = parser.debugInfo(&graph)
+	if len(meta) > 0 {
+		graph.Meta = meta
+	}
+	return graph, diag.warnings, nil
 }
 
-// --- DSL parser with support for node, payload, and iterate blocks ---
-// parseSpec parses the DSL and returns a Graph or an error on invalid syntax
-func parseSpec(src []byte) (model.Graph, error) {
-	lines := strings.Split(string(src), "\n")
-	var nodes []model.Node
-	var payload []byte
+// dslParser handles DSL parsing state
+type dslParser struct {
+	nodes    *[]model.Node
+	payload  *[]byte
+	meta     model.Metadata
+	ties     [][]uint32               // Node IDs of each "tie" directive
+	segments []model.Segment          // Segment table from "segment" directives
+	modules  map[string]*model.Module // Modules defined so far, by name
+	module   *model.Module            // Module being defined, nil at the top level
+	named    []namedNode              // Named node declarations, in source order
+	outputs  []outputDecl             // Model outputs from top-level "output" directives
+
+	// Segments numbered nodes reference by name, the directory of the spec
+	// being parsed, which file paths are relative to, and the absolute
+	// paths of the specs including it
+	segmentRefs []segmentRef
+	dir         string
+	includes    []string
+
+	// Files read and names declared so far, recorded when set
+	record *parseRecord
+
+	// Errors and warnings so far, and the line being parsed, where
+	// declarations record their position
+	diag *diagnostics
+	line srcLine
+
+	// Declaration of each node in nodes and of each segment directive, for
+	// the debug section
+	nodePos    []Pos
+	segmentPos []Pos
+
+	// Constants from "let" directives, shared with modules and included
+	// specs, and while an iterate block is expanded, the constants and its
+	// variable
+	consts map[string]int64
+	vars   map[string]int64
+}
 
-	parser := &dslParser{nodes: &nodes, payload: &payload}
+// exprDirectives are the directives whose integer fields may be constant
+// names or parenthesized expressions, such as "node (i+10) 1 (i*W) 0"
+var exprDirectives = map[string]bool{"node": true, "segment": true, "tie": true, "use": true, "input": true, "output": true}
 
+// parseLines parses every line, collecting errors with their positions
+// and going on with the next line, until there are too many
+func (p *dslParser) parseLines(lines []srcLine) {
 	for i := 0; i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
-		if line == "" || strings.HasPrefix(line, "#") {
+		if lines[i].text == "" || strings.HasPrefix(lines[i].text, "#") {
 			continue
 		}
+		if p.diag.full(lines[i]) {
+			return
+		}
 
-		var err error
-		i, err = parser.parseLine(lines, i)
+		next, err := p.parseLine(lines, i)
 		if err != nil {
-			return model.Graph{}, fmt.Errorf("line %d: %v", i+1, err)
+			p.diag.report(lines[i], err)
 		}
+		i = next
 	}
-
-	// align payload
-	payload = alignPayload(payload)
-	return model.Graph{Nodes: nodes, Payload: payload}, nil
 }
 
-// dslParser handles DSL parsing state
-type dslParser struct {
-	nodes   *[]model.Node
-	payload *[]byte
+// warnUnused warns about tensors nothing computes on and modules never
+// instantiated
+func (p *dslParser) warnUnused() {
+	used := make(map[string]bool)
+	for _, d := range p.named {
+		for _, dep := range d.deps {
+			used[dep] = true
+		}
+	}
+	for _, r := range p.segmentRefs {
+		used[r.name] = true
+	}
+	for _, d := range p.named {
+		if d.tensor && !d.input && !used[d.name] {
+			p.diag.warn(WarnUnused, d.src, d.name, "tensor %s is never used", d.name)
+		}
+	}
+
+	var unused []srcLine
+	for _, l := range p.diag.unusedModules {
+		unused = append(unused, l)
+	}
+	slices.SortFunc(unused, func(a, b srcLine) int {
+		return cmp.Or(strings.Compare(a.pos.File, b.pos.File), a.pos.Line-b.pos.Line)
+	})
+	for _, l := range unused {
+		name := strings.Fields(l.text)[1]
+		p.diag.warn(WarnUnused, l, name, "module %s is never used", name)
+	}
 }
 
-// parseLine processes a single line and returns the next line index
-func (p *dslParser) parseLine(lines []string, idx int) (int, error) {
-	line := strings.TrimSpace(lines[idx])
-	fields := strings.Fields(line)
+// parseLine processes a single line and returns the index of the last line
+// it consumed
+func (p *dslParser) parseLine(lines []srcLine, idx int) (int, error) {
+	p.line = lines[idx]
+	fields := strings.Fields(p.line.text)
 
 	switch fields[0] {
 	case "iterate":
 		return p.parseIterateBlock(lines, idx, fields)
+	case "module":
+		return p.parseModuleBlock(lines, idx, fields)
 	default:
-		return idx, p.processSimpleLine(line, fields)
+		return idx, p.processSimpleLine(p.line.text, fields)
 	}
 }
 
-// parseIterateBlock handles iterate constructs
-func (p *dslParser) parseIterateBlock(lines []string, idx int, fields []string) (int, error) {
+// parseIterateBlock handles iterate constructs. The block is skipped when
+// the directive is invalid, so its lines cause no further errors.
+func (p *dslParser) parseIterateBlock(lines []srcLine, idx int, fields []string) (int, error) {
+	block, blockEnd, err := findBlock(lines, idx, fields)
+	if err != nil {
+		return blockEnd, err
+	}
+	if _, fields, err = p.expandFields(strings.Join(fields, " ")); err != nil {
+		return blockEnd, err
+	}
 	if len(fields) < 4 {
-		return idx, fmt.Errorf("invalid iterate spec: %s", strings.Join(fields, " "))
+		return blockEnd, fmt.Errorf("invalid iterate spec: %s", strings.Join(fields, " "))
 	}
 
 	varName, start, end, err := parseIterateParams(fields)
 	if err != nil {
-		return idx, err
+		return blockEnd, err
+	}
+	if _, ok := p.consts[varName]; ok {
+		return blockEnd, atToken(varName, fmt.Errorf("iterate variable %s shadows a constant", varName))
+	}
+	if start > end {
+		p.diag.warn(WarnEmptyIterate, lines[idx], fields[3], "iterate %s from %d to %d expands to nothing", varName, start, end)
 	}
 
-	// Find opening brace and collect block
-	blockStart := idx
-	if !strings.HasSuffix(strings.Join(fields, " "), "{") {
-		blockStart++
-		for blockStart < len(lines) && strings.TrimSpace(lines[blockStart]) == "" {
-			blockStart++
-		}
-		if blockStart >= len(lines) || strings.TrimSpace(lines[blockStart]) != "{" {
-			return idx, fmt.Errorf("missing '{' after iterate")
-		}
+	// Expand and process block
+	p.expandIterateBlock(block, varName, start, end)
+	return blockEnd, nil
+}
+
+// parseModuleBlock handles module definitions:
+//
+//	module <name> {
+//	    node ...
+//	    payload ...
+//	    input <id>...
+//	    output <id>...
+//	}
+//
+// IDs and payload offsets inside are local to the module
+func (p *dslParser) parseModuleBlock(lines []srcLine, idx int, fields []string) (int, error) {
+	if p.module != nil {
+		return idx, fmt.Errorf("module definitions cannot be nested")
+	}
+	if len(fields) < 2 || fields[1] == "{" {
+		return idx, fmt.Errorf("invalid module spec: missing name")
+	}
+	name := fields[1]
+	if _, dup := p.modules[name]; dup {
+		return idx, atToken(name, fmt.Errorf("duplicate module %q", name))
 	}
 
-	block, blockEnd, err := collectBlockLines(lines, blockStart)
+	block, blockEnd, err := findBlock(lines, idx, fields)
 	if err != nil {
-		return idx, err
+		return blockEnd, err
 	}
 
-	// Expand and process block
-	if err := p.expandIterateBlock(block, varName, start, end); err != nil {
-		return idx, err
+	// A module with errors is recorded as nil, so uses of it do not
+	// report it undefined
+	p.modules[name] = nil
+	p.diag.unusedModules[name] = lines[idx]
+	p.declare(name, SymbolModule)
+	m := &model.Module{Name: name}
+	sub := &dslParser{nodes: &m.Nodes, payload: &m.Payload, modules: p.modules, module: m, dir: p.dir, includes: p.includes, diag: p.diag, consts: p.consts, record: p.record}
+	errs := len(p.diag.errs)
+	sub.parseLines(block)
+	if len(p.diag.errs) > errs {
+		return blockEnd, nil
 	}
-
+	if err := applyTies(m.Nodes, sub.ties); err != nil {
+		return blockEnd, fmt.Errorf("module %s: %v", name, err)
+	}
+	m.Payload = alignPayload(m.Payload)
+	if err := m.Validate(); err != nil {
+		return blockEnd, err
+	}
+	p.modules[name] = m
 	return blockEnd, nil
 }
 
+// findBlock returns the lines of the brace-delimited block opened by the
+// directive on line idx, either at its end or on the next line, and the
+// index of the closing brace
+func findBlock(lines []srcLine, idx int, fields []string) ([]srcLine, int, error) {
+	blockStart := idx
+	if !strings.HasSuffix(strings.Join(fields, " "), "{") {
+		blockStart++
+		for blockStart < len(lines) && lines[blockStart].text == "" {
+			blockStart++
+		}
+		if blockStart >= len(lines) || lines[blockStart].text != "{" {
+			return nil, idx, fmt.Errorf("missing '{' after %s", fields[0])
+		}
+	}
+	return collectBlockLines(lines, blockStart)
+}
+
 // processSimpleLine handles node and payload directives
 func (p *dslParser) processSimpleLine(line string, fields []string) error {
+	defer p.recordPositions()
+	if exprDirectives[fields[0]] && (fields[0] != "node" || !isNamedNode(fields)) && (fields[0] != "output" || p.module != nil) {
+		var err error
+		if line, fields, err = p.expandFields(line); err != nil {
+			return err
+		}
+	}
+
 	switch fields[0] {
 	case "node":
+		if isNamedNode(fields) {
+			return p.parseNamedNodeLine(line)
+		}
 		return p.parseNodeLine(fields)
+	case "tensor":
+		return p.parseTensorLine(line)
+	case "include":
+		return p.parseIncludeLine(line)
+	case "let":
+		return p.parseLetLine(line)
 	case "payload":
-		return p.parsePayloadLine(fields)
+		return p.parsePayloadLine(line, fields)
+	case "meta":
+		if p.module != nil {
+			return fmt.Errorf("meta is not allowed in a module")
+		}
+		return p.parseMetaLine(line, fields)
+	case "segment":
+		if p.module != nil {
+			return fmt.Errorf("segment is not allowed in a module")
+		}
+		return p.parseSegmentLine(fields)
+	case "tie":
+		return p.parseTieLine(fields)
+	case "use":
+		return p.parseUseLine(fields)
+	case "output":
+		if p.module == nil {
+			return p.parseOutputLine(fields)
+		}
+		return p.parsePortLine(fields)
+	case "input":
+		return p.parsePortLine(fields)
 	default:
-		return fmt.Errorf("unknown directive: %s", fields[0])
+		return atToken(fields[0], fmt.Errorf("unknown directive: %s", fields[0]))
+	}
+}
+
+// depend records that the spec reads path, which need not exist
+func (p *dslParser) depend(path string) {
+	if p.record != nil && !slices.Contains(p.record.files, path) {
+		p.record.files = append(p.record.files, path)
+	}
+}
+
+// recordPositions attributes the nodes and segments added since the last
+// call to the line being parsed; nodes instantiated by "use" get its line
+func (p *dslParser) recordPositions() {
+	for len(p.nodePos) < len(*p.nodes) {
+		p.nodePos = append(p.nodePos, p.line.pos)
+	}
+	for len(p.segmentPos) < len(p.segments) {
+		p.segmentPos = append(p.segmentPos, p.line.pos)
 	}
 }
 
 // parseNodeLine parses a node directive
 func (p *dslParser) parseNodeLine(fields []string) error {
-	if len(fields) < 5 {
-		return fmt.Errorf("invalid node spec: needs at least 5 fields")
+	if len(fields) < 4 {
+		return fmt.Errorf("invalid node spec: needs at least 4 fields")
 	}
 
-	node, err := parseNodeFields(fields)
+	node, segment, err := parseNodeFields(fields)
 	if err != nil {
 		return err
 	}
+	if segment != "" {
+		if p.module != nil {
+			return fmt.Errorf("segment names are not allowed in a module")
+		}
+		p.segmentRefs = append(p.segmentRefs, segmentRef{node: len(*p.nodes), name: segment, src: p.line})
+	}
 
 	*p.nodes = append(*p.nodes, node)
 	return nil
 }
 
-// parsePayloadLine parses a payload directive
-func (p *dslParser) parsePayloadLine(fields []string) error {
+// parseMetaLine parses a metadata directive, "meta <key> <value...>"; the
+// value is the rest of the line
+func (p *dslParser) parseMetaLine(line string, fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid meta spec: missing key")
+	}
+	key := fields[1]
+	if _, dup := p.meta[key]; dup {
+		return fmt.Errorf("duplicate meta key %q", key)
+	}
+	value := strings.TrimSpace(strings.TrimPrefix(line, "meta"))
+	p.meta[key] = strings.TrimSpace(strings.TrimPrefix(value, key))
+	return nil
+}
+
+// parseSegmentLine parses a segment table entry,
+// "segment <id> <offset> <length> [role [dtype [name]]]"; role defaults to
+// activation and dtype to float32. Nodes reference it as "@<id>" in place of
+// their in and out offsets.
+func (p *dslParser) parseSegmentLine(fields []string) error {
+	if len(fields) < 4 || len(fields) > 7 {
+		return fmt.Errorf("invalid segment spec: want id, offset, length and optional role, dtype and name")
+	}
+	var nums [3]uint32
+	for i, f := range fields[1:4] {
+		v, err := strconv.ParseUint(f, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid segment %s %q: %v", [...]string{"id", "offset", "length"}[i], f, err)
+		}
+		nums[i] = uint32(v)
+	}
+	seg := model.Segment{ID: nums[0], Offset: nums[1], Length: nums[2]}
+	if seg.ID == 0 {
+		return fmt.Errorf("segment ID 0 is reserved")
+	}
+	var err error
+	if len(fields) > 4 {
+		if seg.Role, err = model.ParseSegmentRole(fields[4]); err != nil {
+			return err
+		}
+	}
+	if len(fields) > 5 {
+		if seg.DType, err = model.ParseDType(fields[5]); err != nil {
+			return err
+		}
+	}
+	if len(fields) > 6 {
+		seg.Name = fields[6]
+		p.declare(seg.Name, SymbolSegment)
+	}
+	p.segments = append(p.segments, seg)
+	return nil
+}
+
+// parseTieLine parses a weight sharing directive, "tie <id> <id>...": the
+// nodes share the payload segment of the first one, which need not be
+// declared yet
+func (p *dslParser) parseTieLine(fields []string) error {
+	if len(fields) < 3 {
+		return fmt.Errorf("invalid tie spec: needs at least two node ids")
+	}
+	ids, err := parseTopology(fields[1:])
+	if err != nil {
+		return fmt.Errorf("tie: %w", err)
+	}
+	p.ties = append(p.ties, ids)
+	return nil
+}
+
+// applyTies points the nodes of every tie at the segment of its first node
+// and flags them shared. A tied node declares either that same range or
+// "0 0", so the shared bytes appear once in the payload; it inherits the
+// owner's segment table entry.
+func applyTies(nodes []model.Node, ties [][]uint32) error {
+	index := make(map[uint32]int, len(nodes))
+	for i, n := range nodes {
+		index[n.ID] = i
+	}
+	tied := make(map[uint32]bool)
+	for _, ids := range ties {
+		for _, id := range ids {
+			if _, ok := index[id]; !ok {
+				return fmt.Errorf("tie references undefined node %d", id)
+			}
+			if tied[id] {
+				return fmt.Errorf("node %d is tied more than once", id)
+			}
+			tied[id] = true
+		}
+		owner := &nodes[index[ids[0]]]
+		if owner.Out <= owner.In {
+			return fmt.Errorf("tie: node %d has an empty payload range [%d, %d)", owner.ID, owner.In, owner.Out)
+		}
+		owner.Flags |= core.FlagShared
+		for _, id := range ids[1:] {
+			n := &nodes[index[id]]
+			if (n.In != 0 || n.Out != 0) && (n.In != owner.In || n.Out != owner.Out) {
+				return fmt.Errorf("tie: node %d range [%d, %d) differs from node %d range [%d, %d)", n.ID, n.In, n.Out, owner.ID, owner.In, owner.Out)
+			}
+			n.In, n.Out = owner.In, owner.Out
+			if n.Segment == 0 {
+				n.Segment = owner.Segment
+			}
+			n.Flags |= core.FlagShared
+		}
+	}
+	return nil
+}
+
+// parsePortLine parses the "input" and "output" declarations of a module
+func (p *dslParser) parsePortLine(fields []string) error {
+	if p.module == nil {
+		return fmt.Errorf("%s is only allowed in a module", fields[0])
+	}
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid %s spec: missing node ids", fields[0])
+	}
+	ids, err := parseTopology(fields[1:])
+	if err != nil {
+		return fmt.Errorf("%s: %w", fields[0], err)
+	}
+	if fields[0] == "input" {
+		p.module.Inputs = append(p.module.Inputs, ids...)
+	} else {
+		p.module.Outputs = append(p.module.Outputs, ids...)
+	}
+	return nil
+}
+
+// parseUseLine instantiates a module, "use <name> <base> [x<count>] [<- dep...]".
+// Instance nodes take IDs base plus their local ID and the input nodes
+// depend on the listed nodes. With a count the module is repeated as a
+// chain: instance k starts at base + k*span, span being the module's ID
+// range, and its inputs consume the outputs of instance k-1.
+func (p *dslParser) parseUseLine(fields []string) error {
+	var deps []string
+	for i, f := range fields {
+		if f == "<-" {
+			fields, deps = fields[:i], fields[i+1:]
+			if len(deps) == 0 {
+				return fmt.Errorf("no dependencies after \"<-\"")
+			}
+			break
+		}
+	}
+	if len(fields) < 3 || len(fields) > 4 {
+		return fmt.Errorf("invalid use spec: want module name, base id and optional x<count> before \"<-\"")
+	}
+	m, ok := p.modules[fields[1]]
+	if !ok {
+		return atToken(fields[1], fmt.Errorf("undefined module %q", fields[1]))
+	}
+	delete(p.diag.unusedModules, m.Name)
+	if m == nil {
+		// Its errors are reported already
+		return nil
+	}
+	base, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid base id %q: %v", fields[2], err)
+	}
+	count := uint64(1)
+	if len(fields) == 4 {
+		n, ok := strings.CutPrefix(fields[3], "x")
+		if count, err = strconv.ParseUint(n, 10, 32); !ok || err != nil || count == 0 {
+			return fmt.Errorf("invalid instance count %q: want x<count>", fields[3])
+		}
+	}
+	inputs, err := parseTopology(deps)
+	if err != nil {
+		return fmt.Errorf("use %s: %w", m.Name, err)
+	}
+
+	g := model.Graph{Nodes: *p.nodes, Payload: *p.payload}
+	for k := uint64(0); k < count; k++ {
+		at := base + k*uint64(m.Span())
+		if at > 0xFFFFFFFF {
+			return fmt.Errorf("use %s: instance %d overflows node IDs", m.Name, k)
+		}
+		if inputs, err = g.Instantiate(m, uint32(at), inputs); err != nil {
+			return err
+		}
+	}
+	*p.nodes, *p.payload = g.Nodes, g.Payload
+	return nil
+}
+
+// parsePayloadLine parses a payload directive, hex data or a payload
+// source such as @file(...)
+func (p *dslParser) parsePayloadLine(line string, fields []string) error {
 	if len(fields) < 2 {
 		return fmt.Errorf("invalid payload spec: missing data")
 	}
+	if strings.HasPrefix(fields[1], "@") {
+		return p.parsePayloadSource(strings.TrimSpace(strings.TrimPrefix(line, "payload")))
+	}
 
 	data, err := parsePayloadData(fields[1])
 	if err != nil {
 		return err
 	}
+	if _, err := hex.DecodeString(fields[1]); err != nil {
+		p.diag.warn(WarnPayloadText, p.line, fields[1], "payload %q is not hex, its characters are used as bytes", fields[1])
+	}
 
 	*p.payload = append(*p.payload, data...)
 	return nil
@@ -293,46 +662,66 @@ func parseIterateParams(fields []string) (varName string, start, end int, err er
 	varName = fields[1]
 	start, err = strconv.Atoi(fields[2])
 	if err != nil {
-		return "", 0, 0, fmt.Errorf("invalid iterate start %q: %v", fields[2], err)
+		return "", 0, 0, atToken(fields[2], fmt.Errorf("invalid iterate start %q: %v", fields[2], err))
 	}
 	end, err = strconv.Atoi(fields[3])
 	if err != nil {
-		return "", 0, 0, fmt.Errorf("invalid iterate end %q: %v", fields[3], err)
+		return "", 0, 0, atToken(fields[3], fmt.Errorf("invalid iterate end %q: %v", fields[3], err))
 	}
 	return varName, start, end, nil
 }
 
-// collectBlockLines gathers lines within braces
-func collectBlockLines(lines []string, startIdx int) ([]string, int, error) {
-	var block []string
+// collectBlockLines gathers lines within braces, including nested blocks
+func collectBlockLines(lines []srcLine, startIdx int) ([]srcLine, int, error) {
+	var block []srcLine
 	i := startIdx + 1
+	depth := 0
 
 	for i < len(lines) {
-		line := strings.TrimSpace(lines[i])
+		line := lines[i].text
 		if line == "}" {
-			return block, i, nil
+			if depth == 0 {
+				return block, i, nil
+			}
+			depth--
+		} else if strings.HasSuffix(line, "{") && !strings.HasPrefix(line, "#") {
+			depth++
 		}
 		if line != "" && !strings.HasPrefix(line, "#") {
-			block = append(block, line)
+			block = append(block, lines[i])
 		}
 		i++
 	}
 
-	return nil, i, fmt.Errorf("unterminated iterate block")
+	return nil, i, fmt.Errorf("unterminated block")
 }
 
-// expandIterateBlock processes iterate expansion
-func (p *dslParser) expandIterateBlock(block []string, varName string, start, end int) error {
+// expandIterateBlock processes iterate expansion. Errors keep the
+// position of the block line; each line is reported once, for the first
+// value failing.
+func (p *dslParser) expandIterateBlock(block []srcLine, varName string, start, end int) {
+	outer := p.vars
+	p.vars = maps.Clone(p.scope())
+	defer func() { p.vars = outer }()
+
+	failed := make([]bool, len(block))
 	for v := start; v <= end; v++ {
-		for _, line := range block {
-			expanded := expandVariable(line, varName, v)
-			fields := strings.Fields(expanded)
-			if err := p.processSimpleLine(expanded, fields); err != nil {
-				return fmt.Errorf("iterate expansion error: %v", err)
+		p.vars[varName] = int64(v)
+		for i, line := range block {
+			if failed[i] {
+				continue
+			}
+			line.text = expandVariable(line.text, varName, v)
+			p.line = line
+			if err := p.processSimpleLine(line.text, strings.Fields(line.text)); err != nil {
+				p.diag.report(line, fmt.Errorf("iterate %s = %d: %w", varName, v, err))
+				failed[i] = true
+				if p.diag.full(line) {
+					return
+				}
 			}
 		}
 	}
-	return nil
 }
 
 // expandVariable replaces variable with value in line
@@ -346,41 +735,113 @@ func expandVariable(line, varName string, value int) string {
 	return strings.Join(fields, " ")
 }
 
-// parseNodeFields extracts node from field tokens
-func parseNodeFields(fields []string) (model.Node, error) {
-	id, err := strconv.Atoi(fields[1])
+// parseNodeFields extracts node from field tokens:
+//
+//	node <id> <kernel> <in> <out> [flags] [<- dep dep,dep ...]
+//	node <id> <kernel> @<segment> [flags] [<- dep dep,dep ...]
+//
+// The kernel is a name such as relu or a numeric opcode.
+// The IDs after "<-" are the nodes this one consumes, any number of them.
+// The second form computes on a segment table entry instead of a raw range,
+// given by ID or by name; a name is returned for the caller to resolve.
+func parseNodeFields(fields []string) (model.Node, string, error) {
+	var deps []string
+	for i, f := range fields {
+		if f == "<-" {
+			fields, deps = fields[:i], fields[i+1:]
+			if len(deps) == 0 {
+				return model.Node{}, "", fmt.Errorf("no dependencies after \"<-\"")
+			}
+			break
+		}
+	}
+	var segment uint64
+	var segmentName string
+	if len(fields) > 3 && strings.HasPrefix(fields[3], "@") {
+		var err error
+		if nodeName.MatchString(fields[3][1:]) {
+			segmentName = fields[3][1:]
+		} else if segment, err = strconv.ParseUint(fields[3][1:], 0, 32); err != nil || segment == 0 {
+			return model.Node{}, "", atToken(fields[3], fmt.Errorf("invalid segment reference %q", fields[3]))
+		}
+		// Resolved to the segment's range once the table is complete
+		fields = append(fields[:3:3], append([]string{"0", "0"}, fields[4:]...)...)
+	}
+	if len(fields) < 5 || len(fields) > 6 {
+		return model.Node{}, "", fmt.Errorf("invalid node spec: want id, kernel, in, out and optional flags before \"<-\"")
+	}
+
+	id, err := strconv.ParseUint(fields[1], 10, 32)
 	if err != nil {
-		return model.Node{}, fmt.Errorf("invalid node id %q: %v", fields[1], err)
+		return model.Node{}, "", atToken(fields[1], fmt.Errorf("invalid node id %q: %v", fields[1], err))
 	}
-	kernel, err := strconv.ParseUint(fields[2], 0, 8)
+	kernel, err := parseKernel(fields[2])
 	if err != nil {
-		return model.Node{}, fmt.Errorf("invalid kernel %q: %v", fields[2], err)
+		return model.Node{}, "", atToken(fields[2], err)
 	}
-	in, err := strconv.ParseUint(fields[3], 0, 16)
+	in, err := strconv.ParseUint(fields[3], 0, 32)
 	if err != nil {
-		return model.Node{}, fmt.Errorf("invalid in %q: %v", fields[3], err)
+		return model.Node{}, "", atToken(fields[3], fmt.Errorf("invalid in %q: %v", fields[3], err))
 	}
-	out, err := strconv.ParseUint(fields[4], 0, 16)
+	out, err := strconv.ParseUint(fields[4], 0, 32)
 	if err != nil {
-		return model.Node{}, fmt.Errorf("invalid out %q: %v", fields[4], err)
+		return model.Node{}, "", atToken(fields[4], fmt.Errorf("invalid out %q: %v", fields[4], err))
 	}
 
 	var flags uint32
 	if len(fields) > 5 {
 		f, err := strconv.ParseUint(fields[5], 0, 32)
 		if err != nil {
-			return model.Node{}, fmt.Errorf("invalid flags %q: %v", fields[5], err)
+			return model.Node{}, "", atToken(fields[5], fmt.Errorf("invalid flags %q: %v", fields[5], err))
 		}
 		flags = uint32(f)
 	}
 
+	topo, err := parseTopology(deps)
+	if err != nil {
+		return model.Node{}, "", fmt.Errorf("node %d: %w", id, err)
+	}
+
 	return model.Node{
-		ID:     uint16(id),
-		Kernel: uint8(kernel),
-		In:     uint16(in),
-		Out:    uint16(out),
-		Flags:  flags,
-	}, nil
+		ID:      uint32(id),
+		Kernel:  uint8(kernel),
+		In:      uint32(in),
+		Out:     uint32(out),
+		Flags:   flags,
+		Topo:    topo,
+		Segment: uint32(segment),
+	}, segmentName, nil
+}
+
+// parseTopology parses the dependency IDs following "<-", separated by
+// spaces or commas. fields end the line, so errors point at the dependency
+// by its field and offset.
+func parseTopology(fields []string) ([]uint32, error) {
+	var topo []uint32
+	seen := make(map[uint32]bool)
+	for i, f := range fields {
+		off := 0
+		for _, dep := range strings.Split(f, ",") {
+			at := off
+			off += len(dep) + 1
+			if dep == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(dep, 10, 32)
+			if err != nil || id == model.NoNeighbor {
+				return nil, atTrailingField(dep, len(fields)-i, at, fmt.Errorf("invalid dependency %q", dep))
+			}
+			if seen[uint32(id)] {
+				return nil, atTrailingField(dep, len(fields)-i, at, fmt.Errorf("dependency %d listed twice", id))
+			}
+			seen[uint32(id)] = true
+			topo = append(topo, uint32(id))
+		}
+	}
+	if len(fields) > 0 && len(topo) == 0 {
+		return nil, fmt.Errorf("no dependencies after \"<-\"")
+	}
+	return topo, nil
 }
 
 // parsePayloadData decodes hex or literal payload data
@@ -405,9 +866,94 @@ func alignPayload(payload []byte) []byte {
 // CompileOptions configures the compilation process
 type CompileOptions struct {
 	OptimizeLayout bool // Reorder nodes for cache efficiency
+	FoldConstants  bool // Evaluate constant nodes and drop identities, see model.Graph.Fold
+	FuseKernels    bool // Replace kernel chains by fused kernels, see model.Graph.Fuse
+	EliminateDead  bool // Drop nodes no declared output needs, see model.Graph.EliminateDeadCode
 	ValidateGraph  bool // Check for cycles, unreachable nodes
 	DebugOutput    bool // Include debug symbols
-	Verbose        bool // Enable verbose output
+	Verbose        bool // Print the compile report as text to stdout when compilation ends
+	Strict         bool // Fail on warnings about the source, like -Werror
+
+	// Severities overrides what to do with classes of warnings, as -W
+	// flags set them; unlisted classes warn
+	Severities map[WarningClass]Severity
+
+	// Warnings, when set, receives the warnings about the source with
+	// excerpts, as PrintErrors writes them
+	Warnings io.Writer
+
+	// SigningKey, when set, signs the output so runtimes configured with
+	// the matching public key accept it
+	SigningKey ed25519.PrivateKey
+
+	// Compression encodes the node table and payload. CompressNone keeps
+	// the payload aligned in the file for in-place loading.
+	Compression model.Compression
+
+	// Metadata is merged into the "meta" directives of the source, its
+	// values winning, and written to the META section
+	Metadata model.Metadata
+
+	// PruneOutputs, when set, keeps only these output nodes and the nodes
+	// they depend on, compacting the payload; see model.Graph.Prune
+	PruneOutputs []uint32
+
+	// Weights, when set, is a .safetensors file whose tensors fill the
+	// payload segments named after them; see model.Graph.LoadSafetensors
+	Weights string
+
+	// ExtraPasses run in order after folding and fusion and before the
+	// layout optimization, followed by validation when ValidateGraph is set
+	ExtraPasses []Pass
+
+	// Target selects the ISA profile: kernel variants and payload alignment
+	// for the CPU the model will run on, recorded in the file header; see
+	// model.Graph.ApplyTarget
+	Target model.Target
+
+	// From is the source format and Emit the output format. JSON and ONNX
+	// output cannot be signed or compressed; ONNX is output only and GGUF
+	// input only.
+	From, Emit Format
+}
+
+// Format is a model file format the compiler reads or writes
+type Format uint8
+
+const (
+	FormatNative Format = iota // .subs source in, binary .subl out
+	FormatJSON                 // Canonical JSON, see model.Graph.MarshalJSON
+	FormatONNX                 // ONNX export, see model.Graph.ExportONNX
+	FormatGGUF                 // GGUF weight import, see model.ReadGGUF
+)
+
+var formatNames = [...]string{
+	FormatNative: "native",
+	FormatJSON:   "json",
+	FormatONNX:   "onnx",
+	FormatGGUF:   "gguf",
+}
+
+// String returns the format name
+func (f Format) String() string {
+	if int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return fmt.Sprintf("Format(%d)", f)
+}
+
+// ParseFormat parses a format name as printed by String; "" selects
+// FormatNative
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatNative, nil
+	}
+	for f, n := range formatNames {
+		if strings.EqualFold(name, n) {
+			return Format(f), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q (want native, json, onnx or gguf)", name)
 }
 
 // DefaultOptions provides sensible compilation defaults
@@ -420,337 +966,432 @@ func DefaultOptions() CompileOptions {
 	}
 }
 
-// CompileWithOptions provides advanced compilation features
-func CompileWithOptions(src, out string, opts CompileOptions) error {
-	if opts.Verbose {
-		fmt.Printf("Compiling %s -> %s\n", src, out)
-	}
+// CompileWithOptions compiles src to out and returns the report of the
+// compilation, also when it fails, covering the steps that ran
+func CompileWithOptions(src, out string, opts CompileOptions) (*CompileReport, error) {
+	start := time.Now()
+	report := &CompileReport{Source: src, Output: out}
+	defer opts.printReport(report)
 
-	spec, err := os.ReadFile(src)
+	g, err := build(src, opts, report)
 	if err != nil {
-		return fmt.Errorf("failed to read source: %w", err)
+		return report, err
 	}
-
-	// Parse the specification
-	g, err := parseSpec(spec)
+	err = report.step("write", g, func() (string, error) {
+		data, err := encodeGraph(g, opts)
+		if err != nil {
+			return "", err
+		}
+		report.OutputBytes = len(data)
+		return fmt.Sprintf("%d bytes of %v output", len(data), opts.Emit), os.WriteFile(out, data, 0o644)
+	})
 	if err != nil {
-		return fmt.Errorf("parse error: %w", err)
+		return report, fmt.Errorf("failed to write output: %w", err)
 	}
+	report.finish(g, start)
+	return report, nil
+}
 
-	if opts.Verbose {
-		fmt.Printf("Parsed %d nodes with %d bytes payload\n", len(g.Nodes), len(g.Payload))
-	}
+// Build reads src and runs the passes opts select, returning the graph
+// CompileWithOptions would write without writing it, and the report of the
+// compilation
+func Build(src string, opts CompileOptions) (*model.Graph, *CompileReport, error) {
+	start := time.Now()
+	report := &CompileReport{Source: src}
+	defer opts.printReport(report)
 
-	// Validate graph structure
-	if opts.ValidateGraph {
-		if err := validateGraph(&g); err != nil {
-			return fmt.Errorf("validation error: %w", err)
-		}
-		if opts.Verbose {
-			fmt.Println("Graph validation passed")
-		}
+	g, err := build(src, opts, report)
+	if err != nil {
+		return nil, report, err
 	}
+	report.finish(g, start)
+	return g, report, nil
+}
 
-	// Optimize node layout
-	if opts.OptimizeLayout {
-		optimizeNodeLayout(&g)
-		if opts.Verbose {
-			fmt.Println("Applied layout optimizations")
-		}
+// CompileBytes compiles a source held in memory, in the format opts.From
+// selects, and returns the graph CompileWithOptions would write, for
+// services that receive specs over the network. Files the spec includes or
+// reads are relative to the working directory, and errors are reported at
+// "line" instead of a file name. EmitBinary encodes the result.
+func CompileBytes(src []byte, opts CompileOptions) (*model.Graph, error) {
+	start := time.Now()
+	report := &CompileReport{Source: "<bytes>"}
+	defer opts.printReport(report)
+
+	var g model.Graph
+	var warnings ErrorList
+	err := report.step("parse", &g, func() (string, error) {
+		var err error
+		g, warnings, err = parseSource(src, "", opts.From)
+		return parsedDetail(&g), err
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	// Write output file
-	if err := writeCompiledGraph(&g, out, opts); err != nil {
-		return fmt.Errorf("failed to write output: %w", err)
+	built, err := buildGraph(g, warnings, opts, report)
+	if err != nil {
+		return nil, err
 	}
+	report.finish(built, start)
+	return built, nil
+}
 
+// printReport prints the report to stdout in verbose mode
+func (opts CompileOptions) printReport(report *CompileReport) {
 	if opts.Verbose {
-		fmt.Printf("Successfully compiled to %s\n", out)
+		report.WriteText(os.Stdout)
 	}
-
-	return nil
 }
 
-// validateGraph checks for common graph issues
-func validateGraph(g *model.Graph) error {
-	if len(g.Nodes) == 0 {
-		return fmt.Errorf("empty graph")
+// build reads and parses src, then runs the passes opts select
+func build(src string, opts CompileOptions, report *CompileReport) (*model.Graph, error) {
+	var g model.Graph
+	var warnings ErrorList
+	err := report.step("parse", &g, func() (string, error) {
+		var err error
+		g, warnings, err = readSource(src, opts.From)
+		return parsedDetail(&g), err
+	})
+	if err != nil {
+		return nil, err
 	}
+	return buildGraph(g, warnings, opts, report)
+}
 
-	// Check for duplicate node IDs
-	seen := make(map[uint16]bool)
-	for i, node := range g.Nodes {
-		if seen[node.ID] {
-			return fmt.Errorf("duplicate node ID %d at index %d", node.ID, i)
-		}
-		seen[node.ID] = true
+// parsedDetail describes a parsed graph
+func parsedDetail(g *model.Graph) string {
+	return fmt.Sprintf("%d nodes, %d segments", len(g.Nodes), len(g.Segments))
+}
 
-		// Check payload bounds
-		if node.In >= uint16(len(g.Payload)) {
-			return fmt.Errorf("node %d input offset %d exceeds payload size %d", node.ID, node.In, len(g.Payload))
-		}
-		if node.Out >= uint16(len(g.Payload)) {
-			return fmt.Errorf("node %d output offset %d exceeds payload size %d", node.ID, node.Out, len(g.Payload))
-		}
+// buildGraph runs the passes opts select on a parsed source, reporting
+// the warnings of the parse and each pass
+func buildGraph(g model.Graph, warnings ErrorList, opts CompileOptions, report *CompileReport) (*model.Graph, error) {
+	if errs := opts.applySeverities(warnings, report); len(errs) > 0 {
+		return nil, fmt.Errorf("parse error: %w", errs)
+	}
 
-		// Check topology references
-		for _, ref := range node.Topo {
-			if !seen[ref] && ref != 0xFFFF { // 0xFFFF is sentinel for unused
-				fmt.Printf("Warning: node %d references undefined node %d\n", node.ID, ref)
-			}
+	if len(opts.Metadata) > 0 {
+		if g.Meta == nil {
+			g.Meta = model.Metadata{}
 		}
+		maps.Copy(g.Meta, opts.Metadata)
 	}
 
-	// Check for cycles (simplified DFS-based detection)
-	return detectCycles(g)
-}
-
-// detectCycles performs topological sort to detect cycles
-func detectCycles(g *model.Graph) error {
-	// Build adjacency list
-	adj := make(map[uint16][]uint16)
-	inDegree := make(map[uint16]int)
-
-	for _, node := range g.Nodes {
-		if _, exists := inDegree[node.ID]; !exists {
-			inDegree[node.ID] = 0
-		}
-		for _, dep := range node.Topo {
-			if dep != 0xFFFF {
-				adj[dep] = append(adj[dep], node.ID)
-				inDegree[node.ID]++
-			}
+	if opts.Weights != "" {
+		err := report.step("weights", &g, func() (string, error) {
+			loaded, err := loadWeights(&g, opts.Weights)
+			return fmt.Sprintf("%d segments loaded from %s", loaded, opts.Weights), err
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	// Kahn's algorithm
-	queue := make([]uint16, 0)
-	for nodeID, degree := range inDegree {
-		if degree == 0 {
-			queue = append(queue, nodeID)
+	if len(opts.PruneOutputs) > 0 {
+		err := report.step("prune", &g, func() (string, error) {
+			removed, err := g.Prune(opts.PruneOutputs)
+			return fmt.Sprintf("%d nodes pruned", removed), err
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	processed := 0
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		processed++
-
-		for _, neighbor := range adj[current] {
-			inDegree[neighbor]--
-			if inDegree[neighbor] == 0 {
-				queue = append(queue, neighbor)
+	// Validate graph structure
+	if opts.ValidateGraph {
+		err := report.step("validate", &g, func() (string, error) {
+			if err := validateGraph(&g); err != nil {
+				return "", fmt.Errorf("validation error: %w", err)
 			}
+			if err := g.InferShapes(); err != nil {
+				return "", fmt.Errorf("shape error: %w", err)
+			}
+			g.EstimateCosts()
+			return fmt.Sprintf("%d of %d node shapes inferred", len(g.Shapes), len(g.Nodes)), nil
+		})
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if processed != len(g.Nodes) {
-		return fmt.Errorf("cycle detected in graph")
+	if err := optimizeGraph(&g, opts, report); err != nil {
+		return nil, err
 	}
-
-	return nil
+	return &g, nil
 }
 
-// optimizeNodeLayout reorders nodes for better cache locality
-func optimizeNodeLayout(g *model.Graph) {
-	// Simple optimization: sort nodes by execution order based on dependencies
-	// This puts dependent nodes closer together in memory
-
-	// Build execution order using topological sort
-	adj := make(map[uint16][]uint16)
-	inDegree := make(map[uint16]int)
-
-	for _, node := range g.Nodes {
-		if _, exists := inDegree[node.ID]; !exists {
-			inDegree[node.ID] = 0
-		}
-		for _, dep := range node.Topo {
-			if dep != 0xFFFF {
-				adj[dep] = append(adj[dep], node.ID)
-				inDegree[node.ID]++
+// optimizeGraph runs the optimization, extra and target passes opts select
+// on a validated graph
+func optimizeGraph(g *model.Graph, opts CompileOptions, report *CompileReport) error {
+	if opts.FoldConstants {
+		err := report.step("fold", g, func() (string, error) {
+			stats, err := g.Fold()
+			if err != nil {
+				return "", fmt.Errorf("fold error: %w", err)
 			}
+			if opts.ValidateGraph {
+				g.EstimateCosts()
+			}
+			return fmt.Sprintf("%d constant nodes folded, %d chain links merged, %d identity nodes bypassed",
+				stats.Folded, stats.Chains, stats.Identities), nil
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	// Execute topological sort
-	queue := make([]uint16, 0)
-	for nodeID, degree := range inDegree {
-		if degree == 0 {
-			queue = append(queue, nodeID)
+	if opts.FuseKernels {
+		err := report.step("fuse", g, func() (string, error) {
+			counts, err := g.Fuse()
+			if err != nil {
+				return "", fmt.Errorf("fusion error: %w", err)
+			}
+			if opts.ValidateGraph {
+				g.EstimateCosts()
+			}
+			return "fused " + fusionSummary(counts), nil
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	var executionOrder []uint16
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		executionOrder = append(executionOrder, current)
-
-		for _, neighbor := range adj[current] {
-			inDegree[neighbor]--
-			if inDegree[neighbor] == 0 {
-				queue = append(queue, neighbor)
+	if opts.EliminateDead {
+		err := report.step("dce", g, func() (string, error) {
+			stats, err := g.EliminateDeadCode()
+			if err != nil {
+				return "", fmt.Errorf("dead code elimination error: %w", err)
 			}
+			return fmt.Sprintf("%d dead nodes and %d unused segments eliminated", stats.Nodes, stats.Segments), nil
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	// Reorder nodes according to execution order
-	nodeMap := make(map[uint16]model.Node)
-	for _, node := range g.Nodes {
-		nodeMap[node.ID] = node
+	if err := runExtraPasses(g, opts, report); err != nil {
+		return err
 	}
 
-	newNodes := make([]model.Node, 0, len(g.Nodes))
-	for _, nodeID := range executionOrder {
-		if node, exists := nodeMap[nodeID]; exists {
-			newNodes = append(newNodes, node)
-			delete(nodeMap, nodeID)
+	if opts.Target != model.TargetGeneric {
+		err := report.step("target", g, func() (string, error) {
+			tiled, err := g.ApplyTarget(opts.Target)
+			if err != nil {
+				return "", fmt.Errorf("target error: %w", err)
+			}
+			if opts.ValidateGraph {
+				g.EstimateCosts()
+			}
+			return fmt.Sprintf("specialized for %v: %d matmul nodes tiled, payload aligned to %d bytes",
+				opts.Target, tiled, opts.Target.Profile().Align), nil
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	// Append any remaining nodes (shouldn't happen if graph is valid)
-	for _, node := range nodeMap {
-		newNodes = append(newNodes, node)
+	// Optimize node layout
+	if opts.OptimizeLayout {
+		report.step("layout", g, func() (string, error) {
+			optimizeNodeLayout(g)
+			return "nodes reordered for locality", nil
+		})
 	}
 
-	g.Nodes = newNodes
+	return nil
 }
 
-// writeCompiledGraph writes the optimized graph to a binary file
-func writeCompiledGraph(g *model.Graph, output string, opts CompileOptions) error {
-	f, err := os.Create(output)
-	if err != nil {
-		return err
+// fusionSummary lists how often each fusion rule applied, by rule name
+func fusionSummary(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "no kernel chains"
 	}
-	defer f.Close()
-
-	writer := &binaryWriter{f: f}
-
-	if err := writer.writeHeader(g, opts); err != nil {
-		return err
+	rules := make([]string, 0, len(counts))
+	for r := range counts {
+		rules = append(rules, r)
 	}
-
-	if err := writer.writeNodes(g.Nodes); err != nil {
-		return err
+	slices.Sort(rules)
+	parts := make([]string, len(rules))
+	for i, r := range rules {
+		parts[i] = fmt.Sprintf("%s x%d", r, counts[r])
 	}
-
-	return writer.writePayload(g.Payload)
-}
-
-// binaryWriter handles binary file output
-type binaryWriter struct {
-	f *os.File
+	return strings.Join(parts, ", ")
 }
 
-// writeHeader writes file version and metadata
-func (w *binaryWriter) writeHeader(g *model.Graph, opts CompileOptions) error {
-	// File format version
-	if err := binary.Write(w.f, binary.LittleEndian, uint32(1)); err != nil {
-		return err
+// validateGraph checks for common graph issues
+func validateGraph(g *model.Graph) error {
+	if len(g.Nodes) == 0 {
+		return fmt.Errorf("empty graph")
 	}
 
-	// Compute flags
-	flags := uint32(0)
-	if opts.DebugOutput {
-		flags |= 0x01
+	// Check for duplicate node IDs
+	seen := make(map[uint32]bool)
+	for i, node := range g.Nodes {
+		if seen[node.ID] {
+			return fmt.Errorf("duplicate node ID %d at index %d", node.ID, i)
+		}
+		seen[node.ID] = true
 	}
 
-	// Write header fields
-	headers := []uint32{
-		uint32(len(g.Nodes)),
-		uint32(len(g.Payload)),
-		flags,
-	}
+	for _, node := range g.Nodes {
+		// Check payload bounds
+		if uint64(node.In) >= uint64(len(g.Payload)) {
+			return fmt.Errorf("node %d input offset %d exceeds payload size %d", node.ID, node.In, len(g.Payload))
+		}
+		if uint64(node.Out) >= uint64(len(g.Payload)) {
+			return fmt.Errorf("node %d output offset %d exceeds payload size %d", node.ID, node.Out, len(g.Payload))
+		}
 
-	for _, header := range headers {
-		if err := binary.Write(w.f, binary.LittleEndian, header); err != nil {
-			return err
+		// Check topology references; they may name later nodes
+		for _, ref := range node.Topo {
+			if !seen[ref] && ref != model.NoNeighbor { // model.NoNeighbor is sentinel for unused
+				return fmt.Errorf("node %d depends on undefined node %d", node.ID, ref)
+			}
 		}
 	}
 
-	return nil
-}
-
-// writeNodes writes all nodes with proper alignment
-func (w *binaryWriter) writeNodes(nodes []model.Node) error {
-	for _, node := range nodes {
-		if err := w.writeNode(node); err != nil {
-			return err
+	// Tied nodes share whole segments
+	segs := g.SharedSegments()
+	for i := 1; i < len(segs); i++ {
+		if segs[i-1].Out > segs[i].In {
+			return fmt.Errorf("shared segments [%d, %d) and [%d, %d) overlap", segs[i-1].In, segs[i-1].Out, segs[i].In, segs[i].Out)
 		}
 	}
-	return nil
-}
 
-// writeNode writes a single node with alignment
-func (w *binaryWriter) writeNode(node model.Node) error {
-	// Write basic fields
-	if err := w.writeNodeFields(node); err != nil {
+	// Kernels reading a header need a payload laid out for it, or they
+	// silently do nothing at run time
+	if err := g.CheckPayloads(); err != nil {
 		return err
 	}
 
-	// Write topology
-	if err := w.writeNodeTopology(node.Topo); err != nil {
-		return err
-	}
+	// Check for cycles, naming the first one found
+	_, err := g.TopologicalOrder()
+	return err
+}
 
-	// Apply padding for alignment
-	return w.writeNodePadding(node)
+// optimizeNodeLayout reorders nodes for better cache locality: dependency
+// order, keeping the source order of independent nodes so layouts are
+// deterministic. Cyclic graphs, which validation rejects, keep their order.
+func optimizeNodeLayout(g *model.Graph) {
+	_ = g.Optimize()
 }
 
-// writeNodeFields writes basic node fields
-func (w *binaryWriter) writeNodeFields(node model.Node) error {
-	fields := []interface{}{
-		node.ID,
-		node.Kernel,
-		node.In,
-		node.Out,
-		node.Flags,
+// loadWeights fills the named segments of g from a .safetensors file
+func loadWeights(g *model.Graph, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read weights: %w", err)
 	}
-
-	for _, field := range fields {
-		if err := binary.Write(w.f, binary.LittleEndian, field); err != nil {
-			return err
-		}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read weights: %w", err)
 	}
-
-	return nil
+	return g.LoadSafetensors(f, info.Size())
 }
 
-// writeNodeTopology writes topology data with length prefix
-func (w *binaryWriter) writeNodeTopology(topo []uint16) error {
-	// Write length prefix
-	if err := binary.Write(w.f, binary.LittleEndian, uint16(len(topo))); err != nil {
-		return err
+// readSource reads and parses the source file in the given format, with
+// the warnings about a .subs source
+func readSource(src string, from Format) (model.Graph, ErrorList, error) {
+	if from == FormatGGUF {
+		// Read in place: GGUF files are too large to load whole
+		f, err := os.Open(src)
+		if err != nil {
+			return model.Graph{}, nil, fmt.Errorf("failed to read source: %w", err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return model.Graph{}, nil, fmt.Errorf("failed to read source: %w", err)
+		}
+		g, err := model.ReadGGUF(f, info.Size())
+		if err != nil {
+			return model.Graph{}, nil, fmt.Errorf("parse error: %w", err)
+		}
+		return *g, nil, nil
 	}
+	spec, err := os.ReadFile(src)
+	if err != nil {
+		return model.Graph{}, nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	return parseSource(spec, src, from)
+}
 
-	// Write topology entries
-	for _, entry := range topo {
-		if err := binary.Write(w.f, binary.LittleEndian, entry); err != nil {
-			return err
+// parseSource parses a source read from file in the given format, with
+// the warnings about a .subs source
+func parseSource(spec []byte, file string, from Format) (model.Graph, ErrorList, error) {
+	var g model.Graph
+	var warnings ErrorList
+	var err error
+	switch from {
+	case FormatNative:
+		g, warnings, err = parseSpec(spec, file, nil)
+	case FormatJSON:
+		err = json.Unmarshal(spec, &g)
+	case FormatGGUF:
+		var gg *model.Graph
+		if gg, err = model.ReadGGUF(bytes.NewReader(spec), int64(len(spec))); err == nil {
+			g = *gg
 		}
+	default:
+		err = fmt.Errorf("unsupported source format %v", from)
 	}
-
-	return nil
+	if err != nil {
+		return model.Graph{}, nil, fmt.Errorf("parse error: %w", err)
+	}
+	return g, warnings, nil
 }
 
-// writeNodePadding applies alignment padding
-func (w *binaryWriter) writeNodePadding(node model.Node) error {
-	baseSize := 16 + 2 + len(node.Topo)*2 // ID+Kernel+In+Out+Flags+TopoLen+Topo
-	padding := core.AlignSize(baseSize, 8) - baseSize
-
-	if padding > 0 {
-		padBytes := make([]byte, padding)
-		_, err := w.f.Write(padBytes)
+// writeCompiledGraph writes the optimized graph, marking debug builds in
+// the file header and keeping the debug section only for them, compressing
+// and signing it as configured
+func writeCompiledGraph(g *model.Graph, output string, opts CompileOptions) error {
+	data, err := encodeGraph(g, opts)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	return os.WriteFile(output, data, 0o644)
 }
 
-// writePayload writes aligned payload data
-func (w *binaryWriter) writePayload(payload []byte) error {
-	alignedPayload := core.PadToAlignment(payload, 32)
-	_, err := w.f.Write(alignedPayload)
+// EmitBinary writes g to w as CompileWithOptions writes its output: in the
+// format opts.Emit selects, the binary .subl format by default, compressed
+// and signed as configured and with debug symbols when opts.DebugOutput is
+// set. g is not modified.
+func EmitBinary(g *model.Graph, w io.Writer, opts CompileOptions) error {
+	data, err := encodeGraph(g, opts)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
 	return err
 }
+
+// encodeGraph encodes a copy of g, marked a debug build or stripped of
+// debug symbols, in the output format
+func encodeGraph(g *model.Graph, opts CompileOptions) ([]byte, error) {
+	c := *g
+	g = &c
+	if opts.DebugOutput {
+		g.Flags |= model.FlagDebug
+	} else {
+		g.Debug = nil
+	}
+	switch opts.Emit {
+	case FormatJSON, FormatONNX:
+		if opts.SigningKey != nil || opts.Compression != model.CompressNone {
+			return nil, fmt.Errorf("%v output cannot be signed or compressed", opts.Emit)
+		}
+		if opts.Emit == FormatONNX {
+			return g.ExportONNX()
+		}
+		data, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+	return g.SerializeWithOptions(model.SerializeOptions{
+		Compression: opts.Compression,
+		SigningKey:  opts.SigningKey,
+	})
+}
@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestDeadCodeElimination(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	// unused and node 1 feed no output; segment 2 backs nothing
+	spec := `segment 2 64 32 weight float32 stale
+node 0 relu 0 32
+node 1 sigmoid 32 64 <- 0
+payload ` + strings.Repeat("00", 96) + `
+tensor x f32[8] input
+node h = relu(x)
+node y = sigmoid(h)
+node unused = tanh(x)
+output y first=0
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	opts := DefaultOptions()
+	plain := filepath.Join(dir, "plain.subl")
+	if _, err := CompileWithOptions(src, plain, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	full, err := readCompiled(plain)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	want := []model.IOSpec{
+		{Name: "x", Kind: model.Input, NodeID: 2, Shape: []int{8}},
+		{Name: "y", Kind: model.Output, NodeID: 4, Shape: []int{8}},
+		{Name: "first", Kind: model.Output, NodeID: 0, Shape: []int{8}},
+	}
+	if len(full.IO) != len(want) {
+		t.Fatalf("Expected IO specs %+v, got %+v", want, full.IO)
+	}
+	for i, w := range want {
+		if s := full.IO[i]; s.Name != w.Name || s.Kind != w.Kind || s.NodeID != w.NodeID || !slices.Equal(s.Shape, w.Shape) {
+			t.Errorf("Expected IO spec %+v, got %+v", w, s)
+		}
+	}
+
+	opts.EliminateDead = true
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	var ids []uint32
+	for _, n := range graph.Nodes {
+		ids = append(ids, n.ID)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []uint32{0, 2, 3, 4}) || len(graph.IO) != 3 {
+		t.Errorf("Expected nodes 0 and x, h, y kept with their IO specs, got %v and %+v", ids, graph.IO)
+	}
+	if _, ok := graph.Segment(2); ok || len(graph.Payload) >= len(full.Payload) {
+		t.Errorf("Expected segment 2 dropped and the payload compacted from %d bytes, got %d bytes and %+v",
+			len(full.Payload), len(graph.Payload), graph.Segments)
+	}
+
+	// Without outputs nothing is dead
+	g := *full
+	g.IO = g.IO[:1]
+	g.Nodes = slices.Clone(full.Nodes)
+	if stats, err := g.EliminateDeadCode(); err != nil || stats != (model.DeadCodeStats{}) || len(g.Nodes) != len(full.Nodes) {
+		t.Errorf("Expected no change without outputs, got %+v, %v", stats, err)
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"undefined": {"node a = noop() [4]\noutput b\n", "output b: undefined node b"},
+		"numbered":  {"node 0 relu 0 32\npayload 00\noutput o=7\n", "output o: undefined node 7"},
+		"duplicate": {"node a = noop() [4]\noutput a a\n", `duplicate output "a"`},
+		"id":        {"node a = noop() [4]\noutput o=x\n", `invalid node id "x"`},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package compiler
+
+import "github.com/sbl8/sublation/model"
+
+// debugInfo returns the debug symbols of a parsed graph: the position of
+// every numbered node and segment directive, and the name and position of
+// every named node and tensor and of the segment it gets. Named segments
+// lend their name to the numbered nodes bound to them.
+func (p *dslParser) debugInfo(g *model.Graph) *model.DebugInfo {
+	d := &model.DebugInfo{Nodes: make(map[uint32]model.SourceInfo), Segments: make(map[uint32]model.SourceInfo)}
+	segNames := make(map[uint32]string)
+	for i, pos := range p.segmentPos {
+		s := g.Segments[i]
+		d.Segments[s.ID] = model.SourceInfo{Name: s.Name, File: pos.File, Line: pos.Line}
+		segNames[s.ID] = s.Name
+	}
+	for i, pos := range p.nodePos {
+		n := g.Nodes[i]
+		d.Nodes[n.ID] = model.SourceInfo{Name: segNames[n.Segment], File: pos.File, Line: pos.Line}
+	}
+
+	decls := make(map[string]srcLine, len(p.named))
+	for _, n := range p.named {
+		decls[n.name] = n.src
+	}
+	named := make(map[uint32]string)
+	for _, s := range g.Segments[len(p.segmentPos):] {
+		if src, ok := decls[s.Name]; ok {
+			d.Segments[s.ID] = model.SourceInfo{Name: s.Name, File: src.pos.File, Line: src.pos.Line}
+			named[s.ID] = s.Name
+		}
+	}
+	for _, n := range g.Nodes[len(p.nodePos):] {
+		if name, ok := named[n.Segment]; ok {
+			d.Nodes[n.ID] = model.SourceInfo{Name: name, File: decls[name].pos.File, Line: decls[name].pos.Line}
+		}
+	}
+	return d
+}
@@ -0,0 +1,81 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestDebugSection(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := `segment 1 0 32 activation float32 scratch
+node 0 relu @scratch
+node 1 sigmoid 32 64 <- 0
+payload ` + strings.Repeat("00", 64) + `
+node hidden = relu(x)
+node x = noop() [8]
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	opts := DefaultOptions()
+	plain := filepath.Join(dir, "plain.subl")
+	if _, err := CompileWithOptions(src, plain, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(plain)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	if graph.Debug != nil || graph.NodeLabel(0) != "node 0" {
+		t.Errorf("Expected no debug section without DebugOutput, got %+v", graph.Debug)
+	}
+
+	opts.DebugOutput = true
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if graph, err = readCompiled(out); err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	if graph.Flags&model.FlagDebug == 0 || graph.Debug == nil {
+		t.Fatalf("Expected a debug build with a debug section, got flags 0x%x", graph.Flags)
+	}
+	want := map[uint32]model.SourceInfo{
+		0: {Name: "scratch", File: src, Line: 2},
+		1: {File: src, Line: 3},
+		2: {Name: "hidden", File: src, Line: 5},
+		3: {Name: "x", File: src, Line: 6},
+	}
+	for id, w := range want {
+		if got := graph.Debug.Nodes[id]; got != w {
+			t.Errorf("node %d: expected %+v, got %+v", id, w, got)
+		}
+	}
+	if got := graph.Debug.Segments[1]; got != (model.SourceInfo{Name: "scratch", File: src, Line: 1}) {
+		t.Errorf("Expected segment 1 declared on line 1, got %+v", got)
+	}
+	if got := graph.NodeLabel(2); got != "node hidden" {
+		t.Errorf("Expected node 2 labelled by name, got %q", got)
+	}
+
+	// The section survives the JSON form
+	data, err := graph.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	var back model.Graph
+	if err := back.UnmarshalJSON(data); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %v", err)
+	}
+	if back.NodeName(3) != "x" || back.Debug.Segments[1].Line != 1 {
+		t.Errorf("Expected debug info to round-trip through JSON, got %+v", back.Debug)
+	}
+}
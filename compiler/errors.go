@@ -0,0 +1,261 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxErrors is how many errors a parse reports before giving up
+const maxErrors = 10
+
+// Pos is a position in a spec
+type Pos struct {
+	File string `json:"file"` // Path of the spec, joined to the including spec's directory for includes
+	Line int    `json:"line"` // 1-based
+	Col  int    `json:"col"`  // 1-based byte column, 0 when unknown
+}
+
+// String formats the position as file:line:col, leaving out what is unknown
+func (p Pos) String() string {
+	s := p.File
+	if s == "" {
+		s = "line"
+	}
+	if p.Line > 0 {
+		s += fmt.Sprintf(":%d", p.Line)
+	}
+	if p.Line > 0 && p.Col > 0 {
+		s += fmt.Sprintf(":%d", p.Col)
+	}
+	return s
+}
+
+// SyntaxError is an error, or a warning, at a position in a spec
+type SyntaxError struct {
+	Pos
+	Msg     string
+	Source  string // The source line, for excerpts
+	Warning bool
+	Class   WarningClass // Of a warning
+}
+
+// Error formats the error as pos: msg
+func (e *SyntaxError) Error() string {
+	if e.Warning {
+		return Warning{Class: e.Class, Pos: e.Pos, Msg: e.Msg}.String()
+	}
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+// Excerpt returns the source line followed by a caret under the column,
+// or "" without a source line
+func (e *SyntaxError) Excerpt() string {
+	if e.Source == "" {
+		return ""
+	}
+	line := strings.TrimRight(e.Source, "\r")
+	if e.Col < 1 || e.Col > len(line)+1 {
+		return "\t" + line + "\n"
+	}
+	// Tabs before the column stay tabs so the caret lines up
+	caret := []byte(line[:e.Col-1])
+	for i, c := range caret {
+		if c != '\t' {
+			caret[i] = ' '
+		}
+	}
+	return "\t" + line + "\n\t" + string(caret) + "^\n"
+}
+
+// ErrorList is the errors, or warnings, of a spec in the order found
+type ErrorList []*SyntaxError
+
+// Error lists every error on its own line
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors of the list, for errors.As
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+	return errs
+}
+
+// PrintErrors writes err to w, each syntax error in it on its own line
+// followed by an excerpt of the source with a caret under the column
+func PrintErrors(w io.Writer, err error) {
+	var list ErrorList
+	var one *SyntaxError
+	switch {
+	case errors.As(err, &list):
+	case errors.As(err, &one):
+		list = ErrorList{one}
+	default:
+		fmt.Fprintln(w, err)
+		return
+	}
+	for _, e := range list {
+		fmt.Fprintf(w, "%v\n%s", e, e.Excerpt())
+	}
+}
+
+// srcLine is a line of a spec and where it comes from
+type srcLine struct {
+	text string // Trimmed, with include parameters and iterate variables substituted
+	raw  string // As in the file
+	pos  Pos    // Col is unset
+}
+
+// specLines splits a spec into lines positioned in file
+func specLines(src, file string) []srcLine {
+	raw := strings.Split(src, "\n")
+	lines := make([]srcLine, len(raw))
+	for i, r := range raw {
+		lines[i] = srcLine{text: strings.TrimSpace(r), raw: r, pos: Pos{File: file, Line: i + 1}}
+	}
+	return lines
+}
+
+// errorf returns an error at the column of tok in the line, or of its
+// first non-blank character when tok is empty or not found
+func (l srcLine) errorf(tok, format string, args ...any) *SyntaxError {
+	pos := l.pos
+	pos.Col = tokenColumn(l.raw, tok)
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...), Source: l.raw}
+}
+
+// error positions err in the line: errors that already carry positions,
+// such as those of included specs, are returned as they are, and a token
+// marked with atToken gives the column
+func (l srcLine) error(err error) ErrorList {
+	var list ErrorList
+	var one *SyntaxError
+	var tok *tokenError
+	switch {
+	case errors.As(err, &list):
+		return list
+	case errors.As(err, &one):
+		return ErrorList{one}
+	case errors.As(err, &tok) && tok.last > 0:
+		e := l.errorf(tok.tok, "%v", err)
+		if col := trailingFieldColumn(l.raw, tok.last); col > 0 {
+			e.Col = col + tok.off
+		}
+		return ErrorList{e}
+	case errors.As(err, &tok):
+		return ErrorList{l.errorf(tok.tok, "%v", err)}
+	}
+	return ErrorList{l.errorf("", "%v", err)}
+}
+
+// tokenError marks the token of a line an error is about. When last is
+// set the token is off bytes into the last-th field from the end of the
+// line, which tells apart tokens spelled alike
+type tokenError struct {
+	tok       string
+	last, off int
+	err       error
+}
+
+func (e *tokenError) Error() string { return e.err.Error() }
+func (e *tokenError) Unwrap() error { return e.err }
+
+// atToken marks err as being about tok, whose column the error report
+// points at
+func atToken(tok string, err error) error {
+	return &tokenError{tok: tok, err: err}
+}
+
+// atTrailingField marks err as being about tok, found off bytes into the
+// last-th field from the end of the line
+func atTrailingField(tok string, last, off int, err error) error {
+	return &tokenError{tok: tok, last: last, off: off, err: err}
+}
+
+// trailingFieldColumn returns the 1-based column of the last-th
+// whitespace-separated field from the end of line, 0 when it has fewer
+func trailingFieldColumn(line string, last int) int {
+	end := len(line)
+	for ; last > 0; last-- {
+		end = len(strings.TrimRight(line[:end], " \t"))
+		start := strings.LastIndexAny(line[:end], " \t") + 1
+		if start == end {
+			return 0
+		}
+		if last == 1 {
+			return start + 1
+		}
+		end = start
+	}
+	return 0
+}
+
+// tokenColumn returns the 1-based column of tok in line, preferring an
+// occurrence that is a whole word, or of the first non-blank character
+func tokenColumn(line, tok string) int {
+	first := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+	if tok == "" {
+		return first
+	}
+	word := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	found := -1
+	for i := 0; i+len(tok) <= len(line); i++ {
+		if line[i:i+len(tok)] != tok {
+			continue
+		}
+		if found < 0 {
+			found = i
+		}
+		if (i == 0 || !word(line[i-1]) || !word(tok[0])) && (i+len(tok) == len(line) || !word(line[i+len(tok)]) || !word(tok[len(tok)-1])) {
+			return i + 1
+		}
+	}
+	if found >= 0 {
+		return found + 1
+	}
+	return first
+}
+
+// diagnostics collects the errors and warnings of a parse, shared by the
+// parsers of modules and included specs
+type diagnostics struct {
+	errs, warnings ErrorList
+
+	// Modules defined but not used yet, with the line defining them
+	unusedModules map[string]srcLine
+}
+
+// report adds the errors of err, positioned in line l
+func (d *diagnostics) report(l srcLine, err error) {
+	d.errs = append(d.errs, l.error(err)...)
+}
+
+// warn adds a warning of a class at the column of tok in line l
+func (d *diagnostics) warn(class WarningClass, l srcLine, tok, format string, args ...any) {
+	w := l.errorf(tok, format, args...)
+	w.Warning, w.Class = true, class
+	d.warnings = append(d.warnings, w)
+}
+
+// full reports whether the parse should stop, adding a final "too many
+// errors" at line l once there are maxErrors of them
+func (d *diagnostics) full(l srcLine) bool {
+	if len(d.errs) < maxErrors {
+		return false
+	}
+	if len(d.errs) == maxErrors {
+		d.errs = append(d.errs, &SyntaxError{Pos: l.pos, Msg: "too many errors"})
+	}
+	return true
+}
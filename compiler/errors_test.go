@@ -0,0 +1,34 @@
+package compiler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDependencyErrorPositions(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	for name, c := range map[string]struct {
+		spec string
+		col  int
+		msg  string
+	}{
+		"invalid": {"node 5 1 0 32 <- 7,x\n", 20, `invalid dependency "x"`},
+		"twice":   {"node 5 1 0 32 <- 7,7\n", 20, "dependency 7 listed twice"},
+		"spaced":  {"node 7 1 0 32 <- 3  7 7\n", 23, "dependency 7 listed twice"},
+		"tie":     {"tie 4 4\n", 7, "dependency 4 listed twice"},
+	} {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		err := Compile(src, src+"l")
+		var list ErrorList
+		if !errors.As(err, &list) || len(list) != 1 || list[0].Line != 1 || list[0].Col != c.col || !strings.Contains(list[0].Msg, c.msg) {
+			t.Errorf("%s: expected %s at 1:%d, got %v", name, c.msg, c.col, err)
+		}
+	}
+}
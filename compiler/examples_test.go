@@ -0,0 +1,32 @@
+package compiler
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestCompileExamples compiles every spec in examples/ as sublc does
+// without flags, with -O and with -O2
+func TestCompileExamples(t *testing.T) {
+	t.Parallel()
+	specs, err := filepath.Glob(filepath.Join("..", "examples", "*.subs"))
+	if err != nil || len(specs) == 0 {
+		t.Fatalf("Expected example specs, got %v (%v)", specs, err)
+	}
+	for _, spec := range specs {
+		for level, opts := range map[string]CompileOptions{
+			"default": {ValidateGraph: true},
+			"-O":      {ValidateGraph: true, OptimizeLayout: true, FoldConstants: true, EliminateDead: true},
+			"-O2":     {ValidateGraph: true, OptimizeLayout: true, FoldConstants: true, FuseKernels: true, EliminateDead: true},
+		} {
+			g, _, err := Build(spec, opts)
+			if err != nil {
+				t.Errorf("%s %s: %v", level, spec, err)
+				continue
+			}
+			if err := g.Validate(); err != nil {
+				t.Errorf("%s %s: compiled graph fails validation: %v", level, spec, err)
+			}
+		}
+	}
+}
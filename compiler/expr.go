@@ -0,0 +1,265 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var letSyntax = regexp.MustCompile(`^let\s+(\S+?)\s*=\s*(.+)$`)
+
+// parseLetLine defines a named constant, "let <NAME> = <expr>". The
+// expression may use the constants defined before it. Constants are
+// visible in the rest of the spec, including specs it includes and the
+// specs including it, and cannot be redefined.
+func (p *dslParser) parseLetLine(line string) error {
+	if p.vars != nil {
+		return fmt.Errorf("let is not allowed in an iterate block")
+	}
+	m := letSyntax.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("invalid let spec: want let <name> = <expr>")
+	}
+	name := m[1]
+	if !paramName.MatchString(name) {
+		return atToken(name, fmt.Errorf("invalid constant name %q", name))
+	}
+	if _, dup := p.consts[name]; dup {
+		return atToken(name, fmt.Errorf("constant %s already defined", name))
+	}
+	v, err := evalExpr(m[2], p.consts)
+	if err != nil {
+		return atToken(m[2], fmt.Errorf("let %s: %w", name, err))
+	}
+	p.consts[name] = v
+	p.declare(name, SymbolConstant)
+	return nil
+}
+
+// scope returns the values of the names expressions may use
+func (p *dslParser) scope() map[string]int64 {
+	if p.vars != nil {
+		return p.vars
+	}
+	return p.consts
+}
+
+// expandFields evaluates the parenthesized expressions in a directive and
+// replaces its integer fields, or the items of comma-separated lists of
+// them, that name a constant or the iterate variable by their value
+func (p *dslParser) expandFields(line string) (string, []string, error) {
+	line, err := expandExprs(line, p.scope())
+	if err != nil {
+		return "", nil, err
+	}
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		if !intField(fields[0], i) {
+			continue
+		}
+		items := strings.Split(f, ",")
+		for k, item := range items {
+			if v, ok := p.scope()[item]; ok {
+				items[k] = strconv.FormatInt(v, 10)
+			}
+		}
+		fields[i] = strings.Join(items, ",")
+	}
+	return strings.Join(fields, " "), fields, nil
+}
+
+// intField reports whether field i of a directive holds integers, rather
+// than a name, role or dtype
+func intField(directive string, i int) bool {
+	switch directive {
+	case "segment":
+		return i >= 1 && i <= 3
+	case "use":
+		return i >= 2
+	case "iterate":
+		return i == 2 || i == 3
+	}
+	return i > 0
+}
+
+// exprParser evaluates integer expressions by recursive descent:
+//
+//	expr   = term {("+" | "-") term}
+//	term   = unary {("*" | "/" | "%") unary}
+//	unary  = ["-" | "+"] unary | number | name | "(" expr ")"
+//
+// Numbers are decimal or 0x hexadecimal, and names are looked up in vars.
+type exprParser struct {
+	src  string
+	pos  int
+	vars map[string]int64
+}
+
+// evalExpr evaluates an integer expression such as "i*64 + 16", whose names
+// are the variables in vars
+func evalExpr(src string, vars map[string]int64) (int64, error) {
+	p := &exprParser{src: src, vars: vars}
+	v, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return 0, fmt.Errorf("unexpected %q in expression %q", p.src[p.pos:], src)
+	}
+	return v, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-blank byte, or 0 at the end
+func (p *exprParser) peek() byte {
+	if p.skipSpace(); p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) expr() (int64, error) {
+	v, err := p.term()
+	for err == nil {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			break
+		}
+		p.pos++
+		var w int64
+		if w, err = p.term(); op == '+' {
+			v += w
+		} else {
+			v -= w
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) term() (int64, error) {
+	v, err := p.unary()
+	for err == nil {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			break
+		}
+		p.pos++
+		var w int64
+		if w, err = p.unary(); err != nil {
+			break
+		}
+		switch {
+		case op == '*':
+			v *= w
+		case w == 0:
+			err = fmt.Errorf("division by zero in expression %q", p.src)
+		case op == '/':
+			v /= w
+		default:
+			v %= w
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) unary() (int64, error) {
+	switch c := p.peek(); {
+	case c == '-' || c == '+':
+		p.pos++
+		v, err := p.unary()
+		if c == '-' {
+			v = -v
+		}
+		return v, err
+	case c == '(':
+		p.pos++
+		v, err := p.expr()
+		if err != nil {
+			return 0, err
+		}
+		switch p.peek() {
+		case ')':
+			p.pos++
+			return v, nil
+		case 0:
+			return 0, fmt.Errorf("missing ')' in expression %q", p.src)
+		}
+		return 0, fmt.Errorf("unexpected %q in expression %q", p.src[p.pos:], p.src)
+	case c >= '0' && c <= '9':
+		tok := p.token()
+		v, err := strconv.ParseInt(tok, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q in expression %q", tok, p.src)
+		}
+		return v, nil
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		name := p.token()
+		v, ok := p.vars[name]
+		if !ok {
+			return 0, fmt.Errorf("undefined name %s in expression %q", name, p.src)
+		}
+		return v, nil
+	case c == 0:
+		return 0, fmt.Errorf("incomplete expression %q", p.src)
+	default:
+		return 0, fmt.Errorf("unexpected %q in expression %q", c, p.src)
+	}
+}
+
+// token consumes a run of letters, digits and underscores
+func (p *exprParser) token() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c != '_' && (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// expandExprs replaces each parenthesized expression in line, such as
+// "(i*64)", by its decimal value
+func expandExprs(line string, vars map[string]int64) (string, error) {
+	if !strings.Contains(line, "(") && !strings.Contains(line, ")") {
+		return line, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ')':
+			return "", atToken(line[i:i+1], fmt.Errorf("unbalanced ')'"))
+		case '(':
+		default:
+			b.WriteByte(line[i])
+			continue
+		}
+		end, depth := i, 0
+		for ; end < len(line); end++ {
+			if line[end] == '(' {
+				depth++
+			} else if line[end] == ')' {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		if end == len(line) {
+			return "", atToken(line[i:], fmt.Errorf("unbalanced '(' in %s", line[i:]))
+		}
+		v, err := evalExpr(line[i:end+1], vars)
+		if err != nil {
+			return "", atToken(line[i:end+1], err)
+		}
+		b.WriteString(strconv.FormatInt(v, 10))
+		i = end
+	}
+	return b.String(), nil
+}
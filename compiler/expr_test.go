@@ -0,0 +1,68 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestIterateExpressions(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := `node 9 0x03 0 64
+iterate i 0 (6/2 - 1) {
+    node (i + 10) 0x03 (i*64 + 64) (i*64+128) <- (i+9)
+}
+segment 1 (0x40*4) (-(-32)) activation
+node 20 0x03 @1 <- (2*6 - (12 % 5)) ,11
+payload ` + strings.Repeat("00", 320) + `
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	nodes := map[uint32]model.Node{}
+	for _, n := range graph.Nodes {
+		nodes[n.ID] = n
+	}
+	for i := uint32(0); i <= 2; i++ {
+		n, ok := nodes[i+10]
+		if !ok || n.In != i*64+64 || n.Out != i*64+128 || !slices.Equal(n.Topo, []uint32{i + 9}) {
+			t.Errorf("Expected node %d on [%d, %d) after %d, got %+v", i+10, i*64+64, i*64+128, i+9, n)
+		}
+	}
+	if n := nodes[20]; n.In != 256 || n.Out != 288 || !slices.Equal(n.Topo, []uint32{10, 11}) {
+		t.Errorf("Expected node 20 on [256, 288) after 10 and 11, got %+v", n)
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"undefined":  {"node (j+1) 1 0 32\n", "undefined name j"},
+		"zero":       {"iterate i 0 1 {\nnode (i/0) 1 0 32\n}\n", "division by zero"},
+		"unbalanced": {"node (1+2 1 0 32\n", "unbalanced '('"},
+		"close":      {"node 1) 1 0 32\n", "unbalanced ')'"},
+		"operator":   {"node (1+*2) 1 0 32\n", `unexpected '*'`},
+		"trailing":   {"node (1 2) 1 0 32\n", `unexpected "2)"`},
+		"bound":      {"iterate i 0 (n) {\n}\n", "undefined name n"},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package compiler
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// fmtIndent is the indentation of each block level in formatted specs
+const fmtIndent = "    "
+
+// fmtLine is a line of a spec being formatted
+type fmtLine struct {
+	tokens  []string // Fields, with quoted and bracketed spans kept whole
+	comment string   // Full-line or trailing comment, with its '#'
+	depth   int      // Block nesting
+	blank   bool
+}
+
+// FormatSpec returns src in canonical form: one space between fields,
+// blocks indented by four spaces with the opening brace on the directive's
+// line, at most one blank line in a row, the fields of consecutive
+// numbered node, named node and segment lines aligned into columns, and
+// runs of meta lines sorted by key. Integer literals of node and segment
+// fields are normalized (lower-case hex, 0o octal, no leading zeros on
+// decimal IDs), @floats values are written in their shortest form and hex
+// payloads in lower case, none of which changes the compiled model. Only
+// the spec itself is formatted; included files are not read. The error
+// reports unbalanced braces.
+func FormatSpec(src []byte) ([]byte, error) {
+	lines, err := fmtParse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	for i := range lines {
+		fmtNormalize(lines[i].tokens)
+	}
+	sortMetaRuns(lines)
+
+	var out bytes.Buffer
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		if l.blank {
+			i++
+			continue
+		}
+		// One blank line between lines that had any, none at the start
+		// or end of the spec and of blocks
+		if i > 0 && lines[i-1].blank && out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("{\n")) && !isClose(l) {
+			out.WriteByte('\n')
+		}
+		kind := alignKind(l)
+		if kind == "" {
+			out.WriteString(renderLine(l))
+			out.WriteByte('\n')
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && alignKind(lines[end]) == kind && lines[end].depth == l.depth {
+			end++
+		}
+		for _, s := range alignRun(lines[i:end], kind) {
+			out.WriteString(s)
+			out.WriteByte('\n')
+		}
+		i = end
+	}
+	return out.Bytes(), nil
+}
+
+// fmtParse splits src into tokenized lines with their block depth, moving
+// a brace on a line of its own to the directive it opens
+func fmtParse(src string) ([]fmtLine, error) {
+	var lines []fmtLine
+	depth := 0
+	for n, raw := range strings.Split(src, "\n") {
+		text := strings.TrimSpace(raw)
+		if text == "" {
+			lines = append(lines, fmtLine{blank: true})
+			continue
+		}
+		l := fmtLine{depth: depth}
+		if strings.HasPrefix(text, "#") {
+			l.comment = text
+			lines = append(lines, l)
+			continue
+		}
+		l.tokens, l.comment = fmtTokens(text)
+		switch {
+		case isClose(l):
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("line %d: unmatched '}'", n+1)
+			}
+			l.depth = depth
+		case l.tokens[len(l.tokens)-1] == "{":
+			depth++
+			// "{" alone joins the iterate or module line before it
+			if len(l.tokens) == 1 && l.comment == "" {
+				if prev := lastCode(lines); prev >= 0 && lines[prev].comment == "" && opensBlock(lines[prev].tokens) {
+					lines = lines[:prev+1]
+					lines[prev].tokens = append(lines[prev].tokens, "{")
+					continue
+				}
+			}
+		}
+		lines = append(lines, l)
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("missing '}' at end of spec")
+	}
+	return lines, nil
+}
+
+// fmtTokens splits a line into whitespace-separated tokens, keeping quoted
+// strings and bracketed spans whole, and a trailing comment. The value of
+// a meta directive, the rest of the line, is a single token.
+func fmtTokens(text string) ([]string, string) {
+	if f := strings.Fields(text); f[0] == "meta" && len(f) > 2 {
+		rest := strings.TrimSpace(strings.TrimPrefix(text, "meta"))
+		return []string{"meta", f[1], strings.TrimSpace(strings.TrimPrefix(rest, f[1]))}, ""
+	}
+	var tokens []string
+	depth, start := 0, -1
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"':
+			if q, err := strconv.QuotedPrefix(text[i:]); err == nil {
+				i += len(q) - 1
+			}
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case c == '#' && depth == 0 && start < 0:
+			return tokens, strings.TrimSpace(text[i:])
+		case (c == ' ' || c == '\t') && depth == 0:
+			if start >= 0 {
+				tokens = append(tokens, text[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens, ""
+}
+
+// fmtNormalize rewrites the literals of a directive in canonical form
+func fmtNormalize(tokens []string) {
+	if len(tokens) < 2 {
+		return
+	}
+	switch tokens[0] {
+	case "node":
+		if isNamedNode(tokens) {
+			return
+		}
+		deps := false
+		for i := 1; i < len(tokens); i++ {
+			switch {
+			case tokens[i] == "<-":
+				deps = true
+			case deps:
+				items := strings.Split(tokens[i], ",")
+				for k := range items {
+					items[k] = normalizeInt(items[k], 10)
+				}
+				tokens[i] = strings.Join(items, ",")
+			case i == 1:
+				tokens[i] = normalizeInt(tokens[i], 10)
+			case strings.HasPrefix(tokens[i], "@"):
+				tokens[i] = "@" + normalizeInt(tokens[i][1:], 0)
+			default:
+				tokens[i] = normalizeInt(tokens[i], 0)
+			}
+		}
+	case "segment":
+		for i := 1; i < min(len(tokens), 4); i++ {
+			tokens[i] = normalizeInt(tokens[i], 0)
+		}
+	case "payload":
+		t := tokens[1]
+		if strings.HasPrefix(t, "@floats(") && strings.HasSuffix(t, ")") {
+			tokens[1] = "@floats(" + normalizeFloats(t[len("@floats("):len(t)-1]) + ")"
+		} else if _, err := hex.DecodeString(t); err == nil {
+			tokens[1] = strings.ToLower(t)
+		}
+	}
+}
+
+// normalizeInt returns the canonical spelling of an unsigned integer
+// literal parsed in the given base, 10 or 0 for Go syntax; anything else,
+// such as a constant or an expression, is returned as it is
+func normalizeInt(s string, base int) string {
+	if _, err := strconv.ParseUint(s, base, 64); err != nil {
+		return s
+	}
+	if base == 10 {
+		if t := strings.TrimLeft(s, "0"); t != "" {
+			return t
+		}
+		return "0"
+	}
+	if len(s) > 2 && s[0] == '0' && strings.ContainsRune("xXoObB", rune(s[1])) {
+		return strings.ToLower(s)
+	}
+	if len(s) > 1 && s[0] == '0' {
+		return "0o" + s[1:] // Legacy octal
+	}
+	return s
+}
+
+// normalizeFloats returns the comma-separated float32 values of @floats
+// in their shortest form, or the list as it is when one is invalid
+func normalizeFloats(args string) string {
+	items := strings.Split(args, ",")
+	for i, item := range items {
+		f, err := strconv.ParseFloat(strings.TrimSpace(item), 32)
+		if err != nil {
+			return args
+		}
+		items[i] = strconv.FormatFloat(float64(float32(f)), 'g', -1, 32)
+	}
+	return strings.Join(items, ", ")
+}
+
+// sortMetaRuns sorts each run of consecutive meta lines by key
+func sortMetaRuns(lines []fmtLine) {
+	isMeta := func(l fmtLine) bool { return len(l.tokens) > 1 && l.tokens[0] == "meta" }
+	for i := 0; i < len(lines); i++ {
+		if !isMeta(lines[i]) {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && isMeta(lines[end]) {
+			end++
+		}
+		slices.SortStableFunc(lines[i:end], func(a, b fmtLine) int { return cmp.Compare(a.tokens[1], b.tokens[1]) })
+		i = end
+	}
+}
+
+// alignKind returns which kind of aligned run a line belongs to: numbered
+// or named nodes or segments, or "" for lines printed on their own
+func alignKind(l fmtLine) string {
+	if len(l.tokens) < 2 {
+		return ""
+	}
+	switch {
+	case l.tokens[0] == "segment":
+		return "segment"
+	case l.tokens[0] == "node" && isNamedNode(l.tokens):
+		if len(l.tokens) > 3 && l.tokens[2] == "=" {
+			return "named"
+		}
+	case l.tokens[0] == "node":
+		return "node"
+	}
+	return ""
+}
+
+// alignRun renders lines of one kind with their fields in columns and
+// their trailing comments aligned
+func alignRun(run []fmtLine, kind string) []string {
+	rows := make([][]string, len(run))
+	for i, l := range run {
+		row := l.tokens
+		switch kind {
+		case "named":
+			// Name, "=" and the rest: the call and shape stay together
+			row = []string{row[0], row[1], row[2], strings.Join(row[3:], " ")}
+		case "node":
+			// A segment reference takes the place of both offsets, and
+			// the dependencies line up after the widest fields
+			head, deps := row, []string(nil)
+			if k := slices.Index(row, "<-"); k >= 0 {
+				head, deps = row[:k], row[k+1:]
+			}
+			head = slices.Clone(head)
+			if len(head) > 3 && strings.HasPrefix(head[3], "@") {
+				head = slices.Insert(head, 4, "")
+			}
+			row = head
+			if deps != nil {
+				row = append(row, make([]string, max(0, 6-len(head)))...)
+				row = append(row, "<-", strings.Join(deps, " "))
+			}
+		}
+		rows[i] = row
+	}
+
+	// A column is as wide as its widest cell, not counting the last cell
+	// of each row, which is not padded
+	var widths []int
+	for _, row := range rows {
+		for c, cell := range row[:len(row)-1] {
+			if c == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[c] = max(widths[c], len(cell))
+		}
+	}
+	out := make([]string, len(rows))
+	for i, row := range rows {
+		var b strings.Builder
+		b.WriteString(strings.Repeat(fmtIndent, run[i].depth))
+		for c, cell := range row {
+			if c < len(row)-1 && widths[c] == 0 {
+				continue // A column no row fills
+			}
+			b.WriteString(cell)
+			if c < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[c]-len(cell)+1))
+			}
+		}
+		out[i] = strings.TrimRight(b.String(), " ")
+	}
+
+	// Trailing comments line up two spaces after the longest line
+	width := 0
+	for i, l := range run {
+		if l.comment != "" {
+			width = max(width, len(out[i]))
+		}
+	}
+	for i, l := range run {
+		if l.comment != "" {
+			out[i] += strings.Repeat(" ", width-len(out[i])+2) + l.comment
+		}
+	}
+	return out
+}
+
+// renderLine renders a line printed on its own
+func renderLine(l fmtLine) string {
+	s := strings.Repeat(fmtIndent, l.depth) + strings.Join(l.tokens, " ")
+	switch {
+	case len(l.tokens) == 0:
+		return strings.Repeat(fmtIndent, l.depth) + l.comment
+	case l.comment != "":
+		return s + "  " + l.comment
+	}
+	return s
+}
+
+// isClose reports whether a line closes a block
+func isClose(l fmtLine) bool {
+	return len(l.tokens) > 0 && l.tokens[0] == "}"
+}
+
+// opensBlock reports whether a directive takes a block
+func opensBlock(tokens []string) bool {
+	return (tokens[0] == "iterate" || tokens[0] == "module") && tokens[len(tokens)-1] != "{"
+}
+
+// lastCode returns the index of the last line with tokens, past blank
+// lines only, or -1
+func lastCode(lines []fmtLine) int {
+	for i := len(lines) - 1; i >= 0; i-- {
+		switch {
+		case len(lines[i].tokens) > 0:
+			return i
+		case !lines[i].blank:
+			return -1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatSpec(t *testing.T) {
+	t.Parallel()
+	spec := `
+
+meta version   1.0  beta
+meta author me
+segment 1 0X40 32 weight float32 W
+node 0 relu 0 32
+node 01   sigmoid 32 64 0 <- 0
+node 2 0x03 @W <- 1,0
+node 10 relu 010 0x40
+
+
+iterate i 0 1
+{
+  node (i + 20) 0x03   (i*32) (i*32+32)   <- 0
+
+}
+payload @floats(1.0,  0.50, -2.5e-3, 0x1p-4)   # floats
+payload ABCDEF0123456789
+tensor x f32[8] input
+node h = relu(x)
+node longer_name   = sigmoid(h)   [8]
+`
+	want := `meta author me
+meta version 1.0  beta
+segment 1 0x40 32 weight float32 W
+node 0  relu    0    32
+node 1  sigmoid 32   64 0 <- 0
+node 2  0x03    @W        <- 1,0
+node 10 relu    0o10 0x40
+
+iterate i 0 1 {
+    node (i + 20) 0x03 (i*32) (i*32+32) <- 0
+}
+payload @floats(1, 0.5, -0.0025, 0.0625)  # floats
+payload abcdef0123456789
+tensor x f32[8] input
+node h           = relu(x)
+node longer_name = sigmoid(h) [8]
+`
+	got, err := FormatSpec([]byte(spec))
+	if err != nil {
+		t.Fatalf("FormatSpec failed: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("Expected formatted spec\n%s\ngot\n%s", want, got)
+	}
+	if again, err := FormatSpec(got); err != nil || !bytes.Equal(again, got) {
+		t.Errorf("Expected formatting to be idempotent, got\n%s, %v", again, err)
+	}
+
+	// Both compile to the same model
+	dir := t.TempDir()
+	var models [2][]byte
+	for i, src := range []string{spec, want} {
+		path := filepath.Join(dir, "m.subs")
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if _, err := CompileWithOptions(path, path+"l", DefaultOptions()); err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		if models[i], err = os.ReadFile(path + "l"); err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+	}
+	if !bytes.Equal(models[0], models[1]) {
+		t.Errorf("Expected the formatted spec to compile to the same model")
+	}
+
+	for _, bad := range []string{"node 0 relu 0 32\n}\n", "iterate i 0 1 {\nnode i relu 0 32\n"} {
+		if _, err := FormatSpec([]byte(bad)); err == nil {
+			t.Errorf("Expected an error for unbalanced braces in %q", bad)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestFoldConstants(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	tensors := map[string][]float32{
+		"c1":   {1, 2, 3, 4},
+		"c2":   {10, 20, 30, 40},
+		"ones": {1, 1, 1, 1},
+		"neg":  {-1, -2, 3, -4},
+	}
+	for name, v := range tensors {
+		data := make([]byte, 4*len(v))
+		for i, f := range v {
+			binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(f))
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".bin"), data, 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	src := filepath.Join(dir, "m.subs")
+	spec := `tensor x f32[4] input
+tensor c1 f32[4] = @c1.bin
+tensor c2 f32[4] = @c2.bin
+tensor ones f32[4] = @ones.bin
+tensor neg f32[4] = @neg.bin
+node k = relu(neg)
+node k2 = add(k, c1)
+node a = add(x, c1)
+node b = add(a, c2)
+node m = mul(b, ones)
+node same = noop(m)
+node y = add(same, k2)
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.FoldConstants = true
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+
+	// x, b, y, the folded k2 and the merged constant c1 + c2 remain
+	if len(graph.Nodes) != 5 {
+		t.Fatalf("Expected 5 nodes, got %+v", graph.Nodes)
+	}
+	nodes := map[uint32]model.Node{}
+	for _, n := range graph.Nodes {
+		nodes[n.ID] = n
+	}
+	value := func(id uint32) []float32 {
+		n := nodes[id]
+		var v []float32
+		for i := n.In; i+4 <= n.Out; i += 4 {
+			v = append(v, math.Float32frombits(binary.LittleEndian.Uint32(graph.Payload[i:])))
+		}
+		return v
+	}
+	// Named declarations take IDs 0 (x) to 11 (y) in order; the merged
+	// constant comes after them
+	const x, k2, b, y, c12 = 0, 6, 8, 11, 12
+	if n := nodes[y]; n.Kernel != 0x06 || !slices.Equal(n.Topo, []uint32{b, k2}) {
+		t.Errorf("Expected y = add(b, k2), got %+v", n)
+	}
+	if n := nodes[b]; n.Kernel != 0x06 || !slices.Equal(n.Topo, []uint32{x, c12}) {
+		t.Errorf("Expected b = add(x, c1 + c2), got %+v", n)
+	}
+	if n := nodes[k2]; n.Kernel != 0 || len(n.Topo) != 0 || !slices.Equal(value(k2), []float32{1, 2, 6, 4}) {
+		t.Errorf("Expected k2 folded to [1 2 6 4], got %+v holding %v", n, value(k2))
+	}
+	if n := nodes[c12]; n.Kernel != 0 || !slices.Equal(value(c12), []float32{11, 22, 33, 44}) {
+		t.Errorf("Expected the merged constant [11 22 33 44], got %+v holding %v", n, value(c12))
+	}
+	if in := graph.Inputs(); len(in) != 1 || in[0].NodeID != x {
+		t.Errorf("Expected input x to stay bound to node %d, got %+v", x, in)
+	}
+	if !slices.Equal(graph.Shapes[y], []int{4}) || !slices.Equal(graph.Shapes[c12], []int{4}) {
+		t.Errorf("Expected shapes [4], got %v and %v", graph.Shapes[y], graph.Shapes[c12])
+	}
+	if len(graph.Payload) >= 320 {
+		t.Errorf("Expected the payload compacted to the remaining nodes, got %d bytes", len(graph.Payload))
+	}
+
+	// The first node and declared outputs survive, even when constant
+	g := model.Graph{
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 0x03, In: 0, Out: 16},
+			{ID: 1, Kernel: 0x00, In: 32, Out: 48, Topo: []uint32{0}},
+		},
+		Payload: make([]byte, 64),
+	}
+	binary.LittleEndian.PutUint32(g.Payload[0:], math.Float32bits(-5))
+	binary.LittleEndian.PutUint32(g.Payload[4:], math.Float32bits(5))
+	stats, err := g.Fold()
+	if err != nil {
+		t.Fatalf("Fold failed: %v", err)
+	}
+	if stats.Folded != 2 || len(g.Nodes) != 2 || g.Nodes[0].Kernel != 0 || len(g.Nodes[1].Topo) != 0 {
+		t.Errorf("Expected both nodes folded and kept, got %+v and %+v", stats, g.Nodes)
+	}
+	n := g.Nodes[0]
+	if got := math.Float32frombits(binary.LittleEndian.Uint32(g.Payload[n.In:])); got != 0 || n.Out-n.In != 16 {
+		t.Errorf("Expected node 0 to hold relu of its payload, got %v in [%d, %d)", got, n.In, n.Out)
+	}
+}
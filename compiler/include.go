@@ -0,0 +1,119 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth bounds nested includes
+const maxIncludeDepth = 32
+
+var (
+	includeSyntax = regexp.MustCompile(`^include\s+("(?:[^"\\]|\\.)*")((?:\s+\S+)*)$`)
+	paramName     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	paramRef      = regexp.MustCompile(`\$\{([^}]*)\}`)
+)
+
+// parseIncludeLine parses an include directive and the spec it names:
+//
+//	include "<path>" [<param>=<value> ...]
+//
+// The path is relative to the including spec. Every ${param} in the
+// included spec is replaced by its value before parsing, so one file can
+// describe a layer instantiated with different sizes, names or IDs. Each
+// parameter the file uses must be given and each one given must be used.
+// Errors in the included spec are reported at their position in it.
+func (p *dslParser) parseIncludeLine(line string) error {
+	m := includeSyntax.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("invalid include spec: want include \"<path>\" [<param>=<value> ...]")
+	}
+	name, err := strconv.Unquote(m[1])
+	if err != nil || name == "" {
+		return atToken(m[1], fmt.Errorf("invalid include path %s", m[1]))
+	}
+	args := make(map[string]string)
+	for _, arg := range strings.Fields(m[2]) {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok || !paramName.MatchString(k) {
+			return atToken(arg, fmt.Errorf("include %s: invalid argument %q, want <param>=<value>", name, arg))
+		}
+		if _, dup := args[k]; dup {
+			return atToken(arg, fmt.Errorf("include %s: argument %s given twice", name, k))
+		}
+		args[k] = v
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.dir, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("include %s: %w", name, err)
+	}
+	if slices.Contains(p.includes, abs) {
+		return atToken(m[1], fmt.Errorf("include %s: includes itself", name))
+	}
+	if len(p.includes) >= maxIncludeDepth {
+		return fmt.Errorf("include %s: nested deeper than %d", name, maxIncludeDepth)
+	}
+	p.depend(path)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return atToken(m[1], fmt.Errorf("include %s: %w", name, err))
+	}
+	lines, err := substituteParams(specLines(string(src), path), args)
+	if err != nil {
+		return fmt.Errorf("include %s: %w", name, err)
+	}
+
+	dir, includes, cur := p.dir, p.includes, p.line
+	p.dir, p.includes = filepath.Dir(path), append(includes[:len(includes):len(includes)], abs)
+	defer func() { p.dir, p.includes, p.line = dir, includes, cur }()
+	p.parseLines(lines)
+	return nil
+}
+
+// substituteParams replaces each ${param} outside comments by its value in
+// args, failing on parameters without a value, at their position, and on
+// unused arguments
+func substituteParams(lines []srcLine, args map[string]string) ([]srcLine, error) {
+	used := make(map[string]bool, len(args))
+	var err error
+	out := make([]srcLine, len(lines))
+	for i, line := range lines {
+		out[i] = line
+		if strings.HasPrefix(line.text, "#") {
+			continue
+		}
+		out[i].text = paramRef.ReplaceAllStringFunc(line.text, func(ref string) string {
+			k := ref[2 : len(ref)-1]
+			v, ok := args[k]
+			if !ok && err == nil {
+				err = line.errorf(ref, "no value for parameter %s", ref)
+			}
+			used[k] = true
+			return v
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var unused []string
+	for k := range args {
+		if !used[k] {
+			unused = append(unused, k)
+		}
+	}
+	if len(unused) > 0 {
+		slices.Sort(unused)
+		return nil, fmt.Errorf("unused arguments: %s", strings.Join(unused, ", "))
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestIncludes(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		// Paths inside an included spec are relative to it
+		"layers/dense.subs": "# ${ignored} in comments\nnode ${out} = ${act}(${in})\n",
+		"layers/block.subs": "include \"dense.subs\" in=${in} out=${name}_a act=relu\ninclude \"dense.subs\" in=${name}_a out=${name}_b act=tanh\n",
+		"layers/cycle.subs": "include \"cycle.subs\"\n",
+		"layers/bad.subs":   "node a = relu(\n",
+		"m.subs":            "tensor x f32[8] input\ninclude \"layers/block.subs\" in=x name=l1\ninclude \"layers/dense.subs\" in=l1_b out=y act=softmax\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	src := filepath.Join(dir, "m.subs")
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+
+	nodes := map[string]model.Node{}
+	for _, n := range graph.Nodes {
+		if s, ok := graph.Segment(n.Segment); ok {
+			nodes[s.Name] = n
+		}
+	}
+	want := []struct {
+		name, dep string
+		kernel    uint8
+	}{
+		{"l1_a", "x", 0x03},
+		{"l1_b", "l1_a", 0x05},
+		{"y", "l1_b", 0x0A},
+	}
+	for _, w := range want {
+		n, ok := nodes[w.name]
+		if !ok || n.Kernel != w.kernel || !slices.Equal(n.Topo, []uint32{nodes[w.dep].ID}) {
+			t.Errorf("%s: expected kernel %d consuming %s, got %+v", w.name, w.kernel, w.dep, n)
+		}
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"missing":   {`include "layers/dense.subs" in=x out=y` + "\n", "no value for parameter ${act}"},
+		"unused":    {`include "layers/dense.subs" in=x out=y act=relu z=1 a=2` + "\n", "unused arguments: a, z"},
+		"cycle":     {`include "layers/cycle.subs"` + "\n", "includes itself"},
+		"file":      {`include "layers/none.subs"` + "\n", "none.subs"},
+		"nested":    {"\n" + `include "layers/bad.subs"` + "\n", "layers/bad.subs:1:1: invalid named node spec"},
+		"argument":  {`include "layers/dense.subs" in` + "\n", `invalid argument "in"`},
+		"duplicate": {`include "layers/dense.subs" in=x in=y` + "\n", "argument in given twice"},
+		"syntax":    {"include layers/dense.subs\n", "invalid include spec"},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
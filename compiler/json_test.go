@@ -0,0 +1,37 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONFormat(t *testing.T) {
+	t.Parallel()
+	// The compiler reads and writes the format
+	dir := t.TempDir()
+	src, out, bin := filepath.Join(dir, "m.subs"), filepath.Join(dir, "m.json"), filepath.Join(dir, "m.subl")
+	if err := os.WriteFile(src, []byte("node 0 1 0 32\nnode 1 3 32 64 <- 0\npayload "+strings.Repeat("07", 128)+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.Emit = FormatJSON
+	if _, err := CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile to JSON failed: %v", err)
+	}
+	opts.Emit, opts.From = FormatNative, FormatJSON
+	if _, err := CompileWithOptions(out, bin, opts); err != nil {
+		t.Fatalf("Compile from JSON failed: %v", err)
+	}
+	compiled, err := readCompiled(bin)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	if len(compiled.Nodes) != 2 || len(compiled.Payload) != 128 || compiled.Payload[127] != 7 {
+		t.Errorf("Expected the JSON model to compile back, got %d nodes and %d payload bytes", len(compiled.Nodes), len(compiled.Payload))
+	}
+	if _, err := ParseFormat("yaml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
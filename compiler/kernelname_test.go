@@ -0,0 +1,53 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+func TestKernelNames(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := `node 1 relu 0 64
+node 2 sigmoid 64 128 <- 1
+node 3 0x03 128 192 <- 2
+payload ` + strings.Repeat("00", 256) + `
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	want := map[uint32]uint8{1: kernels.OpReLU, 2: kernels.OpSigmoid, 3: kernels.OpReLU}
+	for _, n := range graph.Nodes {
+		if n.Kernel != want[n.ID] {
+			t.Errorf("node %d: expected kernel %s, got %s", n.ID, kernels.OpName(want[n.ID]), kernels.OpName(n.Kernel))
+		}
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"unknown": {"node 1 gelu 0 64\n", `unknown kernel "gelu", want one of noop, `},
+		"named":   {"node x = gelu() [4]\n", "node x: unknown kernel \"gelu\""},
+		"opcode":  {"node 1 0x100 0 64\n", `unknown kernel "0x100"`},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
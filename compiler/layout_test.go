@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPayloadLayoutValidation(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	invalid := map[string]struct{ spec, want string }{
+		"header": {"node 1 matmul 0 4\npayload 0200020000000000\n",
+			"node 1 (matmul), payload [0, 4): matmul needs a [rows][cols][b_cols] uint16 header, payload has 4 bytes"},
+		"operands": {"node 1 matmul 0 22\npayload 020002000200\npayload @floats(1, 2, 3, 4, 0)\n",
+			"2x2 by 2x2 matmul needs 38 payload bytes (6 header, 16 A, 16 B and result), segment has 22"},
+		"result": {"node 1 matmul 0 26\npayload 030001000100\npayload @floats(1, 2, 3, 4, 0, 0, 0)\n",
+			"3x1 by 1x1 matmul needs 30 payload bytes (6 header, 12 A, 12 B and result), segment has 26"},
+		"zero":    {"node 1 matmul 0 6\npayload 0000020002000000\n", "matmul header has a zero dimension: 0x2 by 2x2"},
+		"conv1d":  {"node 1 conv1d 0 16\npayload 04000200\npayload @floats(1, 2, 3, 0)\n", "conv1d of 4 inputs by 2 taps needs 28 payload bytes"},
+		"taps":    {"node 1 conv1d 0 4\npayload 0200040000000000\n", "conv1d kernel length 4 does not fit input length 2"},
+		"bn":      {"node 1 batchnorm 0 8\npayload @floats(0, 0, 0)\n", "batchnorm needs an 18-byte header"},
+		"bncount": {"node 1 batchnorm 0 22\npayload 0200\npayload @floats(0, 1, 1, 0, 5, 0)\n", "batchnorm of 2 inputs needs 26 payload bytes"},
+		"several": {"node 1 matmul 0 4\nnode 2 batchnorm 0 4 <- 1\npayload 0000000000000000\n", "node 2 (batchnorm), payload [0, 4)"},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if _, err := CompileWithOptions(src, src+"l", DefaultOptions()); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+
+	src := filepath.Join(dir, "ok.subs")
+	spec := "node 1 matmul 0 22\npayload 010002000100\npayload @floats(1, 2, 3, 4, 0)\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := CompileWithOptions(src, src+"l", DefaultOptions()); err != nil {
+		t.Errorf("Expected a laid out 1x2 by 2x1 matmul to compile, got %v", err)
+	}
+}
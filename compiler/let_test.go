@@ -0,0 +1,82 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestLetConstants(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sizes.subs"), []byte("let N = 3\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	src := filepath.Join(dir, "m.subs")
+	spec := `let W = 64
+let BASE = W*2 - 64
+include "sizes.subs"
+tensor x f32[W / 16] input
+node h = relu(x) [W/16]
+node 100 0x03 0 W
+iterate i 1 N {
+    node (100 + i) 0x03 (i*W) ((i+1)*W) <- (100+i-1)
+}
+segment 1 BASE W activation
+node 110 0x03 @1 <- 100,(100+N)
+payload ` + strings.Repeat("00", 288) + `
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	nodes := map[uint32]model.Node{}
+	for _, n := range graph.Nodes {
+		nodes[n.ID] = n
+	}
+	if n := nodes[100]; n.Out != 64 {
+		t.Errorf("Expected node 100 on [0, 64), got %+v", n)
+	}
+	for i := uint32(1); i <= 3; i++ {
+		if n, ok := nodes[100+i]; !ok || n.In != i*64 || n.Out != (i+1)*64 {
+			t.Errorf("Expected node %d on [%d, %d), got %+v", 100+i, i*64, (i+1)*64, n)
+		}
+	}
+	if n := nodes[110]; n.In != 64 || n.Out != 128 || !slices.Equal(n.Topo, []uint32{100, 103}) {
+		t.Errorf("Expected node 110 on segment [64, 128) after 100 and 103, got %+v", n)
+	}
+	if in := graph.Inputs(); len(in) != 1 || !slices.Equal(in[0].Shape, []int{4}) {
+		t.Errorf("Expected input x of shape [4], got %+v", in)
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"redefined": {"let W = 1\nlet W = 2\n", "constant W already defined"},
+		"undefined": {"let W = H * 2\n", "let W: undefined name H"},
+		"later":     {"node 1 1 0 W\nlet W = 32\n", `invalid out "W"`},
+		"iterate":   {"iterate i 0 1 {\nlet W = 1\n}\n", "not allowed in an iterate block"},
+		"shadow":    {"let i = 1\niterate i 0 1 {\n}\n", "shadows a constant"},
+		"name":      {"let 1W = 1\n", "invalid constant name"},
+		"syntax":    {"let W\n", "invalid let spec"},
+		"dimension": {"let W = 0\ntensor x f32[W] input\n", `invalid dimension "W"`},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// Link reads compiled models, binary or JSON, links them with model.Link
+// and writes the result to output like CompileWithOptions, recording
+// opts.Metadata and validating it when opts.ValidateGraph is set. Modules
+// are named after their file without the extension. Debug symbols are kept
+// when a module has them.
+func Link(inputs []string, output string, opts CompileOptions) error {
+	modules := make([]model.LinkModule, len(inputs))
+	for i, path := range inputs {
+		g, err := readCompiled(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		modules[i] = model.LinkModule{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), Graph: g}
+	}
+	g, stats, err := model.Link(modules)
+	if err != nil {
+		return fmt.Errorf("link error: %w", err)
+	}
+	if len(opts.Metadata) > 0 {
+		if g.Meta == nil {
+			g.Meta = model.Metadata{}
+		}
+		maps.Copy(g.Meta, opts.Metadata)
+	}
+	if opts.ValidateGraph {
+		if err := validateGraph(g); err != nil {
+			return fmt.Errorf("validation error: %w", err)
+		}
+	}
+	if opts.Verbose {
+		fmt.Printf("Linked %d modules: %d nodes, %d bindings resolved, %d duplicate segments (%d bytes) shared, %d bytes payload\n",
+			len(modules), len(g.Nodes), stats.Bindings, stats.Deduplicated, stats.SavedBytes, len(g.Payload))
+	}
+
+	opts.DebugOutput = opts.DebugOutput || g.Debug != nil
+	if err := writeCompiledGraph(g, output, opts); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// readCompiled reads a model written by sublc in the binary or JSON format
+func readCompiled(path string) (*model.Graph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		g := new(model.Graph)
+		return g, json.Unmarshal(data, g)
+	}
+	return model.Deserialize(data)
+}
@@ -0,0 +1,369 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// namedNode is a declaration "node <name> = <kernel>(<dep>, ...) [shape]",
+// resolved once the whole spec is parsed
+type namedNode struct {
+	name   string
+	kernel uint8
+	deps   []string
+	shape  []int // Declared output shape in float32 elements; nil to infer it
+
+	// Set for "tensor" declarations, which become nodes only when they are
+	// model inputs or named nodes consume them
+	tensor bool
+	input  bool
+	dtype  model.DType
+	role   model.SegmentRole
+	data   []byte // Initial contents, nil for zeros
+
+	output bool // Declared a model output by an "output" directive
+
+	src srcLine // The declaration, for error reports
+}
+
+var (
+	namedNodeSyntax = regexp.MustCompile(`^node\s+(\S+?)\s*=\s*(\w+)\s*\(([^)]*)\)\s*(?:\[([^\]]*)\])?$`)
+	nodeName        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+)
+
+// isNamedNode reports whether a node directive uses the named form, whose
+// name, unlike a node ID, starts with a letter or underscore
+func isNamedNode(fields []string) bool {
+	return len(fields) > 1 && (fields[1][0] == '_' || fields[1][0] >= 'A' && fields[1][0] <= 'Z' || fields[1][0] >= 'a' && fields[1][0] <= 'z')
+}
+
+// parseNamedNodeLine parses a named node declaration:
+//
+//	node <name> = <kernel>(<dep>, ...) [<d0>, <d1>, ...]
+//
+// The kernel is a name such as relu or a numeric opcode, and the
+// dependencies are names of other named nodes, declared before or after.
+// The output shape may be left out when the kernel infers it from the
+// dependencies.
+func (p *dslParser) parseNamedNodeLine(line string) error {
+	if p.module != nil {
+		return fmt.Errorf("named nodes are not allowed in a module")
+	}
+	m := namedNodeSyntax.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("invalid named node spec: want node <name> = <kernel>(<deps>) [shape]")
+	}
+	d := namedNode{name: m[1], src: p.line}
+	if !nodeName.MatchString(d.name) {
+		return atToken(d.name, fmt.Errorf("invalid node name %q", d.name))
+	}
+	if p.declared(d.name) {
+		return atToken(d.name, fmt.Errorf("duplicate node name %q", d.name))
+	}
+
+	var err error
+	if d.kernel, err = parseKernel(m[2]); err != nil {
+		return atToken(m[2], fmt.Errorf("node %s: %w", d.name, err))
+	}
+
+	if args := strings.TrimSpace(m[3]); args != "" {
+		for _, dep := range strings.Split(args, ",") {
+			dep = strings.TrimSpace(dep)
+			if !nodeName.MatchString(dep) {
+				return atToken(dep, fmt.Errorf("node %s: invalid dependency %q", d.name, dep))
+			}
+			if slices.Contains(d.deps, dep) {
+				return atToken(dep, fmt.Errorf("node %s: dependency %s listed twice", d.name, dep))
+			}
+			d.deps = append(d.deps, dep)
+		}
+	}
+
+	if m[4] != "" || strings.HasSuffix(line, "]") {
+		if d.shape, err = parseDims(m[4], p.scope()); err != nil {
+			return atToken("["+m[4], fmt.Errorf("node %s: %v", d.name, err))
+		}
+	}
+	p.declare(d.name, SymbolNode)
+	p.named = append(p.named, d)
+	return nil
+}
+
+// parseKernel resolves a kernel name such as relu, as listed by
+// kernels.Names, or a numeric opcode, which custom kernels use
+func parseKernel(name string) (uint8, error) {
+	if op, ok := kernels.Lookup(name); ok {
+		return op, nil
+	}
+	if op, err := strconv.ParseUint(name, 0, 8); err == nil {
+		return uint8(op), nil
+	}
+	return 0, fmt.Errorf("unknown kernel %q, want one of %s or a numeric opcode", name, strings.Join(kernels.Names(), ", "))
+}
+
+// declared reports whether a named node or tensor is called name
+func (p *dslParser) declared(name string) bool {
+	return p.namedIndex(name) >= 0
+}
+
+// namedIndex returns the index in p.named of the named node or tensor
+// called name, or -1
+func (p *dslParser) namedIndex(name string) int {
+	return slices.IndexFunc(p.named, func(n namedNode) bool { return n.name == name })
+}
+
+// parseDims parses the comma-separated dimensions of a shape, each an
+// integer expression over the constants in vars
+func parseDims(dims string, vars map[string]int64) ([]int, error) {
+	var shape []int
+	for _, dim := range strings.Split(dims, ",") {
+		dim = strings.TrimSpace(dim)
+		n, err := evalExpr(dim, vars)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dimension %q in shape [%s]: %v", dim, dims, err)
+		}
+		if n <= 0 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid dimension %q in shape [%s]", dim, dims)
+		}
+		shape = append(shape, int(n))
+	}
+	return shape, nil
+}
+
+// resolveNamedNodes adds the named nodes and tensors to g. Named nodes
+// take the IDs after the highest numbered node, in declaration order, and
+// depend on the nodes they name. Their shapes are inferred from their
+// dependencies or checked against them in dependency order; every
+// declaration that fails is reported, in an ErrorList. Tensors become
+// source nodes when they are model inputs, which are bound to an input
+// spec, or when named nodes consume them, and when they are declared
+// outputs, which are bound to an output spec. Each declaration gets a segment
+// carrying its name, laid out after the payload and every segment.
+func resolveNamedNodes(g *model.Graph, decls []namedNode) error {
+	if len(decls) == 0 {
+		return nil
+	}
+	r := newNamedResolver(decls)
+	if err := r.assignIDs(g); err != nil {
+		return err
+	}
+	firstSeg, end := uint64(1), uint64(len(g.Payload))
+	for _, s := range g.Segments {
+		if i, dup := r.index[s.Name]; dup {
+			return ErrorList{decls[i].src.errorf(s.Name, "node %s: name already used by segment %d", s.Name, s.ID)}
+		}
+		firstSeg = max(firstSeg, uint64(s.ID)+1)
+		end = max(end, uint64(s.End()))
+	}
+	for i := range decls {
+		r.visit(i)
+	}
+	if len(r.errs) > 0 {
+		return r.errs
+	}
+	return r.place(g, firstSeg, end)
+}
+
+// namedResolver holds the state of resolveNamedNodes, indexed like the
+// declarations
+type namedResolver struct {
+	decls  []namedNode
+	index  map[string]int // Declaration of each name
+	isNode []bool         // Whether the declaration becomes a node
+	ids    []uint32       // Node IDs of the declarations that become nodes
+	shapes [][]int
+	state  []uint8 // 0 unvisited, 1 in progress, 2 done, 3 failed
+	errs   ErrorList
+}
+
+// newNamedResolver indexes decls and marks the declarations that become
+// nodes: named nodes, and tensors that are model inputs or outputs or that
+// named nodes consume
+func newNamedResolver(decls []namedNode) *namedResolver {
+	r := &namedResolver{
+		decls:  decls,
+		index:  make(map[string]int, len(decls)),
+		isNode: make([]bool, len(decls)),
+		ids:    make([]uint32, len(decls)),
+		shapes: make([][]int, len(decls)),
+		state:  make([]uint8, len(decls)),
+	}
+	for i, d := range decls {
+		r.index[d.name] = i
+	}
+	for i, d := range decls {
+		r.isNode[i] = r.isNode[i] || !d.tensor || d.input || d.output
+		for _, dep := range d.deps {
+			if j, ok := r.index[dep]; ok {
+				r.isNode[j] = true
+			}
+		}
+	}
+	return r
+}
+
+// assignIDs numbers the nodes after the highest numbered node of g, in
+// declaration order
+func (r *namedResolver) assignIDs(g *model.Graph) error {
+	firstID := uint64(0)
+	for _, n := range g.Nodes {
+		firstID = max(firstID, uint64(n.ID)+1)
+	}
+	next := firstID
+	for i := range r.decls {
+		if r.isNode[i] {
+			r.ids[i] = uint32(next)
+			next++
+		}
+	}
+	if next > model.NoNeighbor {
+		return fmt.Errorf("named nodes overflow node IDs after %d", firstID-1)
+	}
+	return nil
+}
+
+// visit computes the shape of declaration i depth first, so dependencies
+// come before their users, and reports whether it succeeded. Nodes
+// depending on a failed one fail without a report of their own.
+func (r *namedResolver) visit(i int) bool {
+	if r.state[i] != 0 {
+		return r.state[i] == 2
+	}
+	d := r.decls[i]
+	if d.tensor {
+		r.shapes[i], r.state[i] = d.shape, 2
+		return true
+	}
+	r.state[i] = 1
+	var inputs [][]int
+	for _, dep := range d.deps {
+		j, ok := r.index[dep]
+		switch {
+		case !ok:
+			r.errs = append(r.errs, d.src.errorf(dep, "node %s: undefined node %s", d.name, dep))
+		case r.decls[j].dtype != model.Float32:
+			r.errs = append(r.errs, d.src.errorf(dep, "node %s: tensor %s is %v, named nodes compute on float32", d.name, dep, r.decls[j].dtype))
+		case r.state[j] == 1:
+			r.errs = append(r.errs, d.src.errorf(dep, "node %s: dependency cycle through %s", d.name, dep))
+		case r.visit(j):
+			inputs = append(inputs, r.shapes[j])
+			continue
+		}
+		r.state[i] = 3
+		return false
+	}
+	shape, err := namedShape(d, inputs)
+	if err != nil {
+		r.errs = append(r.errs, d.src.errorf(d.name, "%v", err))
+		r.state[i] = 3
+		return false
+	}
+	r.shapes[i], r.state[i] = shape, 2
+	return true
+}
+
+// place lays out a segment per declaration from end on, numbered from
+// firstSeg, adds the nodes with their IO specs to g and copies the initial
+// contents into the payload
+func (r *namedResolver) place(g *model.Graph, firstSeg, end uint64) error {
+	if g.Shapes == nil {
+		g.Shapes = make(map[uint32][]int, len(r.decls))
+	}
+	offset := uint64(core.Align32(int(end)))
+	var inits []int // Declarations with initial contents
+	for i, d := range r.decls {
+		size := uint64(kernels.Elements(r.shapes[i])) * uint64(d.dtype.Size())
+		if offset+size >= math.MaxUint32 {
+			return fmt.Errorf("node %s: payload offset %d overflows", d.name, offset+size)
+		}
+		seg := model.Segment{
+			ID:     uint32(firstSeg) + uint32(i),
+			Offset: uint32(offset),
+			Length: uint32(size),
+			DType:  d.dtype,
+			Role:   d.role,
+			Name:   d.name,
+		}
+		g.Segments = append(g.Segments, seg)
+		if d.data != nil {
+			inits = append(inits, i)
+		}
+		end = offset + size
+		offset = uint64(core.Align32(int(end)))
+		if r.isNode[i] {
+			r.addNode(g, i, seg)
+		}
+	}
+
+	// Validate wants node offsets inside the payload
+	if need := core.Align32(int(end) + 1); need > len(g.Payload) {
+		g.Payload = append(g.Payload, make([]byte, need-len(g.Payload))...)
+	}
+	for _, i := range inits {
+		seg := g.Segments[len(g.Segments)-len(r.decls)+i]
+		copy(g.Payload[seg.Offset:seg.End()], r.decls[i].data)
+	}
+	return nil
+}
+
+// addNode adds declaration i to g as a node over seg, bound to an input or
+// output spec when it is declared one
+func (r *namedResolver) addNode(g *model.Graph, i int, seg model.Segment) {
+	d := r.decls[i]
+	topo := make([]uint32, len(d.deps))
+	for k, dep := range d.deps {
+		topo[k] = r.ids[r.index[dep]]
+	}
+	id := r.ids[i]
+	g.Nodes = append(g.Nodes, model.Node{ID: id, Kernel: d.kernel, In: seg.Offset, Out: seg.End(), Topo: topo, Segment: seg.ID})
+	g.Shapes[id] = r.shapes[i]
+	if d.input {
+		g.IO = append(g.IO, model.IOSpec{Name: d.name, Kind: model.Input, NodeID: id, DType: d.dtype, Shape: d.shape})
+	}
+	if d.output {
+		g.IO = append(g.IO, model.IOSpec{Name: d.name, Kind: model.Output, NodeID: id, DType: d.dtype, Shape: r.shapes[i]})
+	}
+}
+
+// namedShape returns the output shape of a named node given the shapes of
+// its inputs, inferred or checked against the declared one
+func namedShape(d namedNode, inputs [][]int) ([]int, error) {
+	info, known := kernels.Info(d.kernel)
+	if known && info.Arity > 0 && len(inputs) > 0 && len(inputs) != info.Arity {
+		return nil, fmt.Errorf("node %s: %s takes %d inputs, got %d", d.name, info.Name, info.Arity, len(inputs))
+	}
+	known = known && info.Shape != nil
+	var inferred []int
+	if known && len(inputs) > 0 {
+		var err error
+		if inferred, err = info.Shape(inputs, nil); err != nil {
+			return nil, fmt.Errorf("node %s (%s): %w", d.name, info.Name, err)
+		}
+	}
+	shape := d.shape
+	switch {
+	case d.shape == nil && inferred == nil:
+		return nil, fmt.Errorf("node %s: cannot infer the output shape of %s, declare it as [d0, d1, ...]", d.name, kernels.OpName(d.kernel))
+	case d.shape == nil:
+		shape = inferred
+	case inferred != nil && !slices.Equal(d.shape, inferred):
+		return nil, fmt.Errorf("node %s: declared shape %v differs from the inferred shape %v", d.name, d.shape, inferred)
+	}
+
+	// The node's payload starts zeroed, which kernels that read a
+	// header from their payload reject
+	if known && len(inputs) > 0 {
+		if _, err := info.Shape(inputs, make([]byte, kernels.Elements(shape)*4)); err != nil {
+			return nil, fmt.Errorf("node %s (%s): %w; kernels that read a payload header need a numbered node", d.name, info.Name, err)
+		}
+	}
+	return shape, nil
+}
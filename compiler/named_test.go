@@ -0,0 +1,155 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+func TestNamedNodes(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	// Named nodes follow the numbered ones and may be used before they
+	// are declared
+	spec := `node 0 0 0 32
+payload ` + strings.Repeat("00", 32) + `
+node scores = softmax(hidden)
+node hidden = relu(x)
+node x = noop() [2, 4]
+node total = sum(scores)
+node mixed = add(hidden, scores)
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+
+	want := []struct {
+		name   string
+		id     uint32
+		kernel uint8
+		topo   []uint32
+		in     uint32
+		length uint32
+	}{
+		{"scores", 1, 0x0A, []uint32{2}, 32, 32},
+		{"hidden", 2, 0x03, []uint32{3}, 64, 32},
+		{"x", 3, 0x00, nil, 96, 32},
+		{"total", 4, 0x08, []uint32{1}, 128, 4},
+		{"mixed", 5, 0x06, []uint32{2, 1}, 160, 32},
+	}
+	for _, w := range want {
+		i := slices.IndexFunc(graph.Nodes, func(n model.Node) bool { return n.ID == w.id })
+		if i < 0 {
+			t.Errorf("%s: expected node %d", w.name, w.id)
+			continue
+		}
+		n := graph.Nodes[i]
+		s, ok := graph.Segment(n.Segment)
+		if !ok || s.Name != w.name || s.Role != model.RoleActivation || s.Offset != w.in || s.Length != w.length {
+			t.Errorf("%s: expected segment [%d, +%d) named %q, got %+v", w.name, w.in, w.length, w.name, s)
+		}
+		if n.Kernel != w.kernel || !slices.Equal(n.Topo, w.topo) || n.In != w.in || n.Out != w.in+w.length {
+			t.Errorf("%s: expected kernel %d, topo %v and range [%d, %d), got %+v", w.name, w.kernel, w.topo, w.in, w.in+w.length, n)
+		}
+	}
+	if len(graph.Payload) <= 192 {
+		t.Errorf("Expected the payload to cover every named node, got %d bytes", len(graph.Payload))
+	}
+	if !slices.Equal(graph.Shapes[4], []int{1}) || !slices.Equal(graph.Shapes[5], []int{2, 4}) {
+		t.Errorf("Expected shapes [1] and [2 4] for total and mixed, got %v and %v", graph.Shapes[4], graph.Shapes[5])
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"undefined": {"node y = relu(x)\n", "node y: undefined node x"},
+		"cycle":     {"node a = relu(b)\nnode b = relu(a)\n", "dependency cycle"},
+		"duplicate": {"node a = noop() [4]\nnode a = noop() [4]\n", `duplicate node name "a"`},
+		"kernel":    {"node a = gelu() [4]\n", `unknown kernel "gelu"`},
+		"shape":     {"node a = noop()\n", "cannot infer the output shape"},
+		"mismatch":  {"node a = noop() [4]\nnode b = relu(a) [2]\n", "differs from the inferred shape [4]"},
+		"operands":  {"node a = noop() [4]\nnode b = noop() [8]\nnode c = add(a, b)\n", "differ"},
+		"header":    {"node a = noop() [2, 3]\nnode b = noop() [3, 2]\nnode c = matmul(a, b)\n", "need a numbered node"},
+		"syntax":    {"node a = relu(x\n", "invalid named node spec"},
+		"dimension": {"node a = noop() [4, 0]\n", "invalid dimension"},
+		"segment":   {"segment 1 0 32 activation float32 a\nnode a = noop() [4]\npayload 00\n", "already used by segment 1"},
+		"module":    {"module m {\nnode a = noop() [4]\n}\n", "not allowed in a module"},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
+
+func TestNamedChainValues(t *testing.T) {
+	t.Parallel()
+	floats := func(v ...float32) []byte {
+		b := make([]byte, 0, 4*len(v))
+		for _, f := range v {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+		}
+		return b
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "b.bin"), floats(0.5, 0.5, -4, 1), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	src := filepath.Join(dir, "m.subs")
+	spec := `tensor x f32[4] input
+tensor b f32[4] = @b.bin
+node h = add(x, b)
+node y = relu(h)
+node z = sigmoid(y)
+output y z
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	engine, err := runtime.NewEngine(graph, &runtime.EngineOptions{Workers: 2, Streaming: true})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	// x = [1, -2, 3, -4]: h = [1.5, -1.5, -1, -3], y = [1.5, 0, 0, 0] and
+	// z = y / (1 + |y|), the sigmoid kernel's approximation
+	output := make([]byte, engine.OutputSize())
+	if err := engine.ExecuteStreaming(floats(1, -2, 3, -4), output); err != nil {
+		t.Fatalf("ExecuteStreaming failed: %v", err)
+	}
+	want := []float32{1.5, 0, 0, 0, 0.6, 0, 0, 0}
+	if len(output) != 4*len(want) {
+		t.Fatalf("Expected y and z in %d bytes, got %d", 4*len(want), len(output))
+	}
+	for i, w := range want {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(output[4*i:])); math.Abs(float64(got-w)) > 1e-6 {
+			t.Errorf("Output %d: expected %v, got %v", i, w, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// outputDecl is a model output declared by an "output" directive
+type outputDecl struct {
+	name string
+	node uint32 // Numbered node ID when numbered is set
+	src  srcLine
+
+	numbered bool
+}
+
+// parseOutputLine parses a top-level output declaration:
+//
+//	output <name>... | <name>=<id>...
+//
+// A bare name declares the named node or tensor of that name a model
+// output; name=id declares numbered node id an output called name, its
+// whole payload range as float32 values. Inside a module, "output" lists
+// the module's output nodes instead, see parsePortLine.
+func (p *dslParser) parseOutputLine(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid output spec: want output <name>... or <name>=<id>...")
+	}
+	for _, f := range fields[1:] {
+		name, ref, numbered := strings.Cut(f, "=")
+		d := outputDecl{name: name, src: p.line, numbered: numbered}
+		if !nodeName.MatchString(name) {
+			return atToken(f, fmt.Errorf("invalid output name %q", name))
+		}
+		if numbered {
+			id, err := strconv.ParseUint(ref, 10, 32)
+			if err != nil || id >= model.NoNeighbor {
+				return atToken(f, fmt.Errorf("output %s: invalid node id %q", name, ref))
+			}
+			d.node = uint32(id)
+		}
+		for _, o := range p.outputs {
+			if o.name == name {
+				return atToken(f, fmt.Errorf("duplicate output %q", name))
+			}
+		}
+		p.outputs = append(p.outputs, d)
+	}
+	return nil
+}
+
+// markOutputs flags the named nodes and tensors declared outputs, which
+// resolveNamedNodes binds to output specs
+func (p *dslParser) markOutputs() error {
+	var errs ErrorList
+	for _, o := range p.outputs {
+		if o.numbered {
+			continue
+		}
+		i := p.namedIndex(o.name)
+		if i < 0 {
+			errs = append(errs, o.src.errorf(o.name, "output %s: undefined node %s", o.name, o.name))
+			continue
+		}
+		p.named[i].output = true
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// resolveNumberedOutputs binds the numbered nodes declared outputs to
+// output specs
+func resolveNumberedOutputs(g *model.Graph, outputs []outputDecl) error {
+	var errs ErrorList
+	for _, o := range outputs {
+		if !o.numbered {
+			continue
+		}
+		i := slices.IndexFunc(g.Nodes, func(n model.Node) bool { return n.ID == o.node })
+		if i < 0 {
+			errs = append(errs, o.src.errorf(o.name+"=", "output %s: undefined node %d", o.name, o.node))
+			continue
+		}
+		n := g.Nodes[i]
+		if n.Out-n.In < 4 {
+			errs = append(errs, o.src.errorf(o.name+"=", "output %s: node %d has no float32 output in [%d, %d)", o.name, n.ID, n.In, n.Out))
+			continue
+		}
+		g.IO = append(g.IO, model.IOSpec{Name: o.name, Kind: model.Output, NodeID: n.ID, DType: model.Float32, Shape: []int{int(n.Out-n.In) / 4}})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
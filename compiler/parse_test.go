@@ -0,0 +1,124 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	write := func(name, spec string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		return path
+	}
+	write("layer.subs", "# comment\nnode ${out} = relu(${in})\n")
+	src := write("m.subs", `tensor x f32[4] input
+nod 1 2 3
+
+iterate i 0 3 {
+	node i 1 0 bogus
+}
+node y = relu(x) [4, 0]
+include "layer.subs" in=x
+`)
+
+	err := Compile(src, src+"l")
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Expected an ErrorList, got %v", err)
+	}
+	// The iterate error is reported once, at the line in the block
+	want := []struct {
+		file      string
+		line, col int
+		msg       string
+	}{
+		{src, 2, 1, "unknown directive: nod"},
+		{src, 5, 13, `iterate i = 0: invalid out "bogus"`},
+		{src, 7, 18, "invalid dimension"},
+		{filepath.Join(dir, "layer.subs"), 2, 6, "no value for parameter ${out}"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("Expected %d errors, got %d:\n%v", len(want), len(list), err)
+	}
+	for i, w := range want {
+		e := list[i]
+		if e.File != w.file || e.Line != w.line || e.Col != w.col || !strings.Contains(e.Msg, w.msg) {
+			t.Errorf("Error %d: expected %s:%d:%d: %s, got %v", i, w.file, w.line, w.col, w.msg, e)
+		}
+	}
+
+	var out bytes.Buffer
+	PrintErrors(&out, err)
+	if excerpt := "\tnode y = relu(x) [4, 0]\n\t                 ^\n"; !strings.Contains(out.String(), excerpt) {
+		t.Errorf("Expected the excerpt %q, got:\n%s", excerpt, out.String())
+	}
+	if excerpt := "\t\tnode i 1 0 bogus\n\t\t           ^\n"; !strings.Contains(out.String(), excerpt) {
+		t.Errorf("Expected the tab-indented excerpt %q, got:\n%s", excerpt, out.String())
+	}
+
+	// Named nodes are resolved once the spec parses, each failing one
+	// reported at its declaration
+	src = write("named.subs", "node a = relu(b)\nnode c = relu(a)\nnode d = relu(e)\n")
+	err = Compile(src, src+"l")
+	if !errors.As(err, &list) || len(list) != 2 || list[0].Line != 1 || list[0].Col != 15 || list[1].Line != 3 {
+		t.Errorf("Expected undefined b and e at 1:15 and 3:15, got %v", err)
+	}
+
+	src = write("many.subs", strings.Repeat("bad\n", 20))
+	err = Compile(src, src+"l")
+	if !errors.As(err, &list) || len(list) != 11 || list[10].Msg != "too many errors" {
+		t.Errorf("Expected 10 errors and too many errors, got %v", err)
+	}
+
+	// Warnings pass unless strict
+	src = write("warn.subs", "tensor x f32[4] input\ntensor w f32[4]\nnode y = relu(x)\niterate i 3 0 {\nnode i 1 0 32\n}\npayload 0g\n")
+	var warnings bytes.Buffer
+	opts := DefaultOptions()
+	opts.Warnings = &warnings
+	if _, err := CompileWithOptions(src, src+"l", opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	for _, w := range []string{
+		"warn.subs:2:8: warning: tensor w is never used",
+		"warn.subs:4:13: warning: iterate i from 3 to 0 expands to nothing",
+		`warn.subs:7:9: warning: payload "0g" is not hex`,
+	} {
+		if !strings.Contains(warnings.String(), w) {
+			t.Errorf("Expected warning %q, got:\n%s", w, warnings.String())
+		}
+	}
+	opts.Strict = true
+	_, err = CompileWithOptions(src, src+"l", opts)
+	if !errors.As(err, &list) || len(list) != 3 || list[0].Warning || !strings.HasSuffix(list[0].Msg, "(strict)") {
+		t.Errorf("Expected the 3 warnings as errors in strict mode, got %v", err)
+	}
+
+	// -W flags disable classes or make them errors
+	opts.Strict = false
+	opts.Severities = map[WarningClass]Severity{}
+	for _, f := range []string{"no-all", "empty-iterate", "error=payload-text"} {
+		if err := ParseWarningFlag(f, opts.Severities); err != nil {
+			t.Fatalf("ParseWarningFlag(%q) failed: %v", f, err)
+		}
+	}
+	warnings.Reset()
+	_, err = CompileWithOptions(src, src+"l", opts)
+	if !errors.As(err, &list) || len(list) != 1 || list[0].Class != WarnPayloadText || !strings.HasSuffix(list[0].Msg, "(error=payload-text)") {
+		t.Errorf("Expected only the payload warning as an error, got %v", err)
+	}
+	if got := warnings.String(); !strings.Contains(got, "expands to nothing [empty-iterate]") || strings.Contains(got, "never used") {
+		t.Errorf("Expected only the empty iterate warning, got:\n%s", got)
+	}
+	if err := ParseWarningFlag("error=bogus", opts.Severities); err == nil || !strings.Contains(err.Error(), `unknown warning class "bogus"`) {
+		t.Errorf("Expected an unknown class error, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// Pass is a graph transform the compiler runs after its own passes, such as
+// a custom pruning step. Run may change the graph in place; an error stops
+// the compilation.
+type Pass interface {
+	Name() string
+	Run(g *model.Graph) error
+}
+
+// funcPass adapts a function to Pass
+type funcPass struct {
+	name string
+	run  func(*model.Graph) error
+}
+
+func (p funcPass) Name() string             { return p.name }
+func (p funcPass) Run(g *model.Graph) error { return p.run(g) }
+
+// NewPass returns a Pass named name that calls run
+func NewPass(name string, run func(g *model.Graph) error) Pass {
+	return funcPass{name: name, run: run}
+}
+
+// runExtraPasses runs opts.ExtraPasses in order, each a step of the
+// report, revalidating the graph after them when opts.ValidateGraph is set
+func runExtraPasses(g *model.Graph, opts CompileOptions, report *CompileReport) error {
+	for _, pass := range opts.ExtraPasses {
+		err := report.step(pass.Name(), g, func() (string, error) {
+			if err := pass.Run(g); err != nil {
+				return "", fmt.Errorf("pass %s: %w", pass.Name(), err)
+			}
+			return "", nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.ExtraPasses) == 0 || !opts.ValidateGraph {
+		return nil
+	}
+	if err := validateGraph(g); err != nil {
+		return fmt.Errorf("validation error after extra passes: %w", err)
+	}
+	if err := g.InferShapes(); err != nil {
+		return fmt.Errorf("shape error after extra passes: %w", err)
+	}
+	g.EstimateCosts()
+	return nil
+}
@@ -0,0 +1,69 @@
+package compiler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestExtraPasses(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := `node 1 relu 0 64
+node 2 sigmoid 64 128 <- 1
+node 3 relu 128 192
+payload ` + strings.Repeat("00", 256) + `
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var order []string
+	drop := NewPass("drop-3", func(g *model.Graph) error {
+		order = append(order, "drop-3")
+		g.Nodes = g.Nodes[:2]
+		return nil
+	})
+	count := NewPass("count", func(g *model.Graph) error {
+		order = append(order, "count")
+		if len(g.Nodes) != 2 {
+			t.Errorf("Expected the second pass to see 2 nodes, got %d", len(g.Nodes))
+		}
+		return nil
+	})
+	opts := DefaultOptions()
+	opts.ExtraPasses = []Pass{drop, count}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if strings.Join(order, ",") != "drop-3,count" {
+		t.Errorf("Expected the passes to run in order, got %v", order)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	if len(graph.Nodes) != 2 {
+		t.Errorf("Expected the pass result of 2 nodes, got %d", len(graph.Nodes))
+	}
+
+	errDenied := errors.New("denied")
+	opts.ExtraPasses = []Pass{NewPass("deny", func(*model.Graph) error { return errDenied })}
+	if _, err := CompileWithOptions(src, out, opts); !errors.Is(err, errDenied) || !strings.Contains(err.Error(), "pass deny") {
+		t.Errorf("Expected the pass error, got %v", err)
+	}
+
+	opts.ExtraPasses = []Pass{NewPass("break", func(g *model.Graph) error {
+		g.Nodes[0].Out = 4096
+		return nil
+	})}
+	if _, err := CompileWithOptions(src, out, opts); err == nil || !strings.Contains(err.Error(), "after extra passes") {
+		t.Errorf("Expected a validation error after the pass, got %v", err)
+	}
+}
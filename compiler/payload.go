@@ -0,0 +1,157 @@
+package compiler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parsePayloadSource appends the bytes of a payload source call,
+// "@file(...)" or "@floats(...)", the rest of a payload directive:
+//
+//	payload @file("<path>"[, <offset>[, <length>]])
+//	payload @floats(<f>, <f>, ...)
+//
+// @file copies a byte range of a binary file, relative to the spec, by
+// default all of it from the offset on; the offset and length are integer
+// expressions. @floats appends float32 values in little-endian order. A
+// comment may follow the closing parenthesis.
+func (p *dslParser) parsePayloadSource(src string) error {
+	name, args, ok := strings.Cut(src, "(")
+	if !ok {
+		return fmt.Errorf("invalid payload spec: want %s(...)", name)
+	}
+	end := closingParen(args)
+	if end < 0 {
+		return atToken(src, fmt.Errorf("invalid payload spec: missing ')' after %s(", name))
+	}
+	if rest := strings.TrimSpace(args[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+		return atToken(rest, fmt.Errorf("unexpected %q after %s(...)", rest, name))
+	}
+	args = args[:end]
+
+	var data []byte
+	var err error
+	switch name {
+	case "@file":
+		data, err = p.payloadFile(args)
+	case "@floats":
+		data, err = payloadFloats(args)
+	default:
+		return atToken(name, fmt.Errorf("unknown payload source %s, want @file or @floats", name))
+	}
+	if err != nil {
+		return err
+	}
+	*p.payload = append(*p.payload, data...)
+	return nil
+}
+
+// payloadFile reads the range of a file given by the arguments of @file
+func (p *dslParser) payloadFile(args string) ([]byte, error) {
+	args = strings.TrimSpace(args)
+	quoted, err := strconv.QuotedPrefix(args)
+	if err != nil {
+		return nil, atToken(args, fmt.Errorf("@file: want a quoted path first"))
+	}
+	name, _ := strconv.Unquote(quoted)
+	var nums []int64
+	if rest := strings.TrimSpace(args[len(quoted):]); rest != "" {
+		rest, ok := strings.CutPrefix(rest, ",")
+		if !ok {
+			return nil, atToken(rest, fmt.Errorf("@file: want ',' after the path"))
+		}
+		for _, arg := range strings.Split(rest, ",") {
+			v, err := evalExpr(strings.TrimSpace(arg), p.scope())
+			if err != nil {
+				return nil, atToken(strings.TrimSpace(arg), fmt.Errorf("@file %s: %w", name, err))
+			}
+			nums = append(nums, v)
+		}
+		if len(nums) > 2 {
+			return nil, fmt.Errorf("@file %s: want an offset and a length, got %d numbers", name, len(nums))
+		}
+	}
+
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.dir, path)
+	}
+	p.depend(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, atToken(quoted, fmt.Errorf("@file: %w", err))
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("@file: %w", err)
+	}
+	var offset int64
+	if len(nums) > 0 {
+		offset = nums[0]
+	}
+	length := info.Size() - offset
+	if len(nums) > 1 {
+		length = nums[1]
+	}
+	if offset < 0 || length < 0 || offset > info.Size() || length > info.Size()-offset {
+		return nil, fmt.Errorf("@file %s: range [%d, %d) exceeds its %d bytes", name, offset, offset+length, info.Size())
+	}
+	if length > math.MaxUint32 {
+		return nil, fmt.Errorf("@file %s: %d bytes exceed the 4 GiB payload", name, length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(io.NewSectionReader(f, offset, length), data); err != nil {
+		return nil, fmt.Errorf("@file %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// payloadFloats encodes the comma-separated arguments of @floats as
+// little-endian float32 values
+func payloadFloats(args string) ([]byte, error) {
+	if strings.TrimSpace(args) == "" {
+		return nil, fmt.Errorf("@floats: no values")
+	}
+	var data []byte
+	for _, arg := range strings.Split(args, ",") {
+		arg = strings.TrimSpace(arg)
+		f, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return nil, atToken(arg, fmt.Errorf("@floats: invalid float32 %q", arg))
+		}
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(f)))
+	}
+	return data, nil
+}
+
+// closingParen returns the index of the ')' closing the call whose
+// arguments s starts with, skipping quoted strings and nested
+// parentheses, or -1
+func closingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			q, err := strconv.QuotedPrefix(s[i:])
+			if err != nil {
+				return -1
+			}
+			i += len(q) - 1
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
@@ -0,0 +1,77 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPayloadSources(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	blob := make([]byte, 16)
+	for i := range blob {
+		blob[i] = byte(i + 1)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "w.bin"), blob, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	src := filepath.Join(dir, "m.subs")
+	spec := `let OFF = 4
+node 0 0x03 0 16
+payload @floats(1.0, -2.5, 3e-1, 0x1p-2)
+node 1 0x00 16 48 <- 0
+payload @file("w.bin", OFF, 8)  # bytes 4 to 12
+payload @file("w.bin", (2*OFF))
+payload @file("w.bin")
+payload 00
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	p := graph.Payload
+	for i, want := range []float32{1, -2.5, 0.3, 0.25} {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(p[4*i:])); got != want {
+			t.Errorf("float %d: expected %v, got %v", i, want, got)
+		}
+	}
+	want := slices.Concat(blob[4:12], blob[8:], blob)
+	if !bytes.Equal(p[16:16+len(want)], want) {
+		t.Errorf("Expected the file ranges %x, got %x", want, p[16:16+len(want)])
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"range":    {`payload @file("w.bin", 8, 9)` + "\n", "range [8, 17) exceeds its 16 bytes"},
+		"offset":   {`payload @file("w.bin", 17)` + "\n", "exceeds its 16 bytes"},
+		"missing":  {`payload @file("none.bin")` + "\n", "none.bin"},
+		"path":     {`payload @file(w.bin)` + "\n", "want a quoted path"},
+		"numbers":  {`payload @file("w.bin", 0, 1, 2)` + "\n", "got 3 numbers"},
+		"float":    {`payload @floats(1.0, x)` + "\n", `invalid float32 "x"`},
+		"empty":    {`payload @floats()` + "\n", "no values"},
+		"source":   {`payload @bytes(1)` + "\n", "unknown payload source @bytes"},
+		"unclosed": {`payload @floats(1.0` + "\n", "missing ')'"},
+		"trailing": {`payload @floats(1.0) 2.0` + "\n", `unexpected "2.0"`},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPlan(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := `node 1 relu 0 64
+node 2 sigmoid 64 128 <- 1
+node 3 relu 128 192 <- 1,2
+node 4 noop 192 256
+payload ` + strings.Repeat("00", 320) + `
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.OptimizeLayout = false
+	g, _, err := Build(src, opts)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	levels, err := g.Levels()
+	if err != nil {
+		t.Fatalf("Levels failed: %v", err)
+	}
+	if want := [][]int{{0, 3}, {1}, {2}}; !reflect.DeepEqual(levels, want) {
+		t.Errorf("Expected levels %v, got %v", want, levels)
+	}
+
+	g.Nodes[0].Topo = []uint32{3}
+	if _, err := g.Levels(); err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+}
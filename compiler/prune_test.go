@@ -0,0 +1,43 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestPruneOutputs(t *testing.T) {
+	t.Parallel()
+	// The compiler prunes before validating
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := "node 0 1 0 32\nnode 1 3 32 64 <- 0\nnode 2 3 64 96 <- 0\npayload " + strings.Repeat("07", 128) + "\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.PruneOutputs = []uint32{2}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	compiled, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+	if ids := nodeIDs(compiled); !slices.Equal(ids, []uint32{0, 2}) || len(compiled.Payload) != 96 {
+		t.Errorf("Expected nodes [0 2] and 96 payload bytes, got %v and %d", ids, len(compiled.Payload))
+	}
+}
+
+func nodeIDs(g *model.Graph) []uint32 {
+	ids := make([]uint32, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
@@ -0,0 +1,129 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// CompileReport describes a compilation: each step the compiler ran, with
+// its timing and what it did to the graph, and the warnings about the
+// source. CompileWithOptions and Build return it even when compilation
+// fails, covering the steps that ran.
+type CompileReport struct {
+	Source      string        `json:"source"`
+	Output      string        `json:"output,omitempty"`
+	Steps       []StepReport  `json:"steps"`
+	Warnings    []Warning     `json:"warnings,omitempty"`
+	Nodes       int           `json:"nodes"`                  // Nodes of the compiled graph
+	Payload     int           `json:"payload_bytes"`          // Payload size of the compiled graph
+	OutputBytes int           `json:"output_bytes,omitempty"` // Size of the written output
+	Duration    time.Duration `json:"duration_ns"`
+	Complete    bool          `json:"complete"`              // False when a step failed
+	FailedStep  string        `json:"failed_step,omitempty"` // Name of the step that failed, such as parse or validate
+}
+
+// StepReport is one step of a compilation, such as parsing, constant
+// folding or an extra pass
+type StepReport struct {
+	Name          string        `json:"name"`
+	Duration      time.Duration `json:"duration_ns"`
+	NodesBefore   int           `json:"nodes_before"`
+	NodesAfter    int           `json:"nodes_after"`
+	PayloadBefore int           `json:"payload_before"`
+	PayloadAfter  int           `json:"payload_after"`
+	Detail        string        `json:"detail,omitempty"` // What the step did, in words
+}
+
+// step runs fn as the named step of the compilation of g, recording its
+// timing, the change in nodes and payload and the detail fn returns. A
+// failed step is not recorded, only its name as FailedStep.
+func (r *CompileReport) step(name string, g *model.Graph, fn func() (string, error)) error {
+	start := time.Now()
+	nodes, payload := len(g.Nodes), len(g.Payload)
+	detail, err := fn()
+	if err != nil {
+		r.FailedStep = name
+		return err
+	}
+	r.Steps = append(r.Steps, StepReport{
+		Name:          name,
+		Duration:      time.Since(start),
+		NodesBefore:   nodes,
+		NodesAfter:    len(g.Nodes),
+		PayloadBefore: payload,
+		PayloadAfter:  len(g.Payload),
+		Detail:        detail,
+	})
+	return nil
+}
+
+// finish records the compiled graph and how long compilation took
+func (r *CompileReport) finish(g *model.Graph, start time.Time) {
+	r.Nodes, r.Payload = len(g.Nodes), len(g.Payload)
+	r.Duration = time.Since(start)
+	r.Complete = true
+}
+
+// WriteText prints the report as a summary line, a table of the steps and
+// the warnings
+func (r *CompileReport) WriteText(w io.Writer) error {
+	target := r.Source
+	if r.Output != "" {
+		target += " -> " + r.Output
+	}
+	var err error
+	switch {
+	case !r.Complete:
+		_, err = fmt.Fprintf(w, "Compiling %s stopped after %d steps\n", target, len(r.Steps))
+	case r.OutputBytes > 0:
+		_, err = fmt.Fprintf(w, "Compiled %s in %v: %d nodes, %d bytes payload, %d bytes written\n",
+			target, r.Duration.Round(time.Microsecond), r.Nodes, r.Payload, r.OutputBytes)
+	default:
+		_, err = fmt.Fprintf(w, "Compiled %s in %v: %d nodes, %d bytes payload\n",
+			target, r.Duration.Round(time.Microsecond), r.Nodes, r.Payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(r.Steps) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  STEP\tTIME\tNODES\tPAYLOAD\tDETAIL")
+		for _, s := range r.Steps {
+			fmt.Fprintf(tw, "  %s\t%v\t%s\t%s\t%s\n", s.Name, s.Duration.Round(time.Microsecond),
+				change(s.NodesBefore, s.NodesAfter), change(s.PayloadBefore, s.PayloadAfter), s.Detail)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	for _, warning := range r.Warnings {
+		if _, err := fmt.Fprintln(w, warning.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON prints the report as indented JSON, durations in nanoseconds
+func (r *CompileReport) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// change formats a count before and after a step, or once when it kept it
+func change(before, after int) string {
+	if before == after {
+		return fmt.Sprint(after)
+	}
+	return fmt.Sprintf("%d -> %d", before, after)
+}
@@ -0,0 +1,83 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestCompileReport(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := "tensor x f32[8] input\ntensor w f32[4]\nnode h = relu(x)\nnode y = sigmoid(h)\nnode dead = tanh(x)\noutput y\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.Warnings = &bytes.Buffer{}
+	opts.EliminateDead = true
+	out := filepath.Join(dir, "m.subl")
+	rep, err := CompileWithOptions(src, out, opts)
+	if err != nil {
+		t.Fatalf("CompileWithOptions failed: %v", err)
+	}
+	var names []string
+	for _, s := range rep.Steps {
+		names = append(names, s.Name)
+	}
+	if got := strings.Join(names, " "); got != "parse validate dce layout write" {
+		t.Errorf("Expected steps parse validate dce layout write, got %s", got)
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !rep.Complete || rep.Nodes != 3 || rep.OutputBytes != int(info.Size()) {
+		t.Errorf("Expected a complete report of 3 nodes and %d bytes written, got %+v", info.Size(), rep)
+	}
+	if dce := rep.Steps[2]; dce.NodesBefore != 4 || dce.NodesAfter != 3 || dce.PayloadAfter >= dce.PayloadBefore {
+		t.Errorf("Expected dce to take 4 nodes to 3 and shrink the payload, got %+v", dce)
+	}
+	want := Warning{Class: WarnUnused, Pos: Pos{File: src, Line: 2, Col: 8}, Msg: "tensor w is never used"}
+	if len(rep.Warnings) != 1 || rep.Warnings[0] != want {
+		t.Errorf("Expected the unused tensor warning, got %+v", rep.Warnings)
+	}
+
+	var text bytes.Buffer
+	if err := rep.WriteText(&text); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	for _, want := range []string{"Compiled " + src + " -> " + out, "dce", "4 -> 3", "m.subs:2:8: warning: tensor w is never used [unused]\n"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("Expected the text report to contain %q, got:\n%s", want, text.String())
+		}
+	}
+	var buf bytes.Buffer
+	if err := rep.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded CompileReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(decoded.Steps) != len(rep.Steps) || decoded.Steps[2] != rep.Steps[2] || decoded.Duration != rep.Duration || decoded.Warnings[0] != want {
+		t.Errorf("Expected the JSON report to decode to %+v, got %+v", rep, decoded)
+	}
+
+	// A failed compilation reports the steps before the failure
+	opts.ExtraPasses = []Pass{NewPass("reject", func(g *model.Graph) error {
+		return errors.New("rejected")
+	})}
+	rep, err = CompileWithOptions(src, out, opts)
+	if err == nil || rep.Complete || len(rep.Steps) != 3 || rep.Steps[2].Name != "dce" || rep.FailedStep != "reject" {
+		t.Errorf("Expected the reject pass to fail after 3 steps, got %v and %+v", err, rep)
+	}
+}
@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestSegmentTable(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := `segment 1 0 32 weight float32 embed
+segment 2 32 64 activation
+node 0 0 @1
+node 1 3 @2 <- 0
+node 2 0 0 0 <- 1
+tie 0 2
+payload ` + strings.Repeat("01", 128) + "\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	graph, err := model.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	want := []model.Segment{
+		{ID: 1, Offset: 0, Length: 32, DType: model.Float32, Role: model.RoleWeight, Name: "embed"},
+		{ID: 2, Offset: 32, Length: 64, DType: model.Float32, Role: model.RoleActivation},
+	}
+	if !slices.Equal(graph.Segments, want) {
+		t.Errorf("Expected segments %v, got %v", want, graph.Segments)
+	}
+	for _, n := range graph.Nodes {
+		wantSeg := map[uint32]uint32{0: 1, 1: 2, 2: 1}[n.ID]
+		s, _ := graph.Segment(wantSeg)
+		if n.Segment != wantSeg || n.In != s.Offset || n.Out != s.End() {
+			t.Errorf("node %d: expected segment %d [%d, %d), got %d [%d, %d)", n.ID, wantSeg, s.Offset, s.End(), n.Segment, n.In, n.Out)
+		}
+	}
+	if err := graph.Validate(); err != nil {
+		t.Errorf("Expected a valid graph, got %v", err)
+	}
+
+	gob, err := graph.SerializeGob()
+	if err != nil {
+		t.Fatalf("SerializeGob failed: %v", err)
+	}
+	if g, err := model.DeserializeGob(gob); err != nil || !slices.Equal(g.Segments, want) || g.Nodes[0].Segment == 0 {
+		t.Errorf("Expected segments to round-trip through gob, got %v (%v)", g.Segments, err)
+	}
+
+	// A node that drifts from its segment no longer validates
+	graph.Nodes[1].Out += 4
+	if err := graph.Validate(); err == nil || !strings.Contains(err.Error(), "differs from segment 2") {
+		t.Errorf("Expected a segment range mismatch, got %v", err)
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"undefined": {"node 0 0 @3\npayload 00\n", "undefined segment 3"},
+		"overlap":   {"segment 1 0 16\nsegment 2 8 16\nnode 0 0 0 0\npayload 00\n", "overlap"},
+		"bounds":    {"segment 1 0 64\nnode 0 0 @1\npayload 00\n", "exceeds payload size"},
+		"length":    {"segment 1 0 6\nnode 0 0 @1\npayload 00\n", "not a multiple"},
+		"duplicate": {"segment 1 0 4\nsegment 1 4 4\nnode 0 0 0 0\npayload 00\n", "duplicate segment ID 1"},
+		"role":      {"segment 1 0 4 gradient\nnode 0 0 0 0\npayload 00\n", "unknown segment role"},
+		"module":    {"module m {\nsegment 1 0 4\nnode 0 0 0 0\noutput 0\n}\npayload 00\n", "not allowed in a module"},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package compiler
+
+import (
+	"os"
+)
+
+// parseRecord collects what a parse read and declared, for tools
+type parseRecord struct {
+	files   []string // Files included or read, which need not exist
+	symbols []Symbol // Names declared, in source order
+}
+
+// SourceFiles returns the files compiling src with opts reads: src, the
+// files a .subs source includes and loads tensors and payloads from, and
+// the weights file. The files read before a parse error are returned with
+// the error, so a watcher still sees the file to fix; files that do not
+// exist are listed too.
+func SourceFiles(src string, opts CompileOptions) ([]string, error) {
+	rec := &parseRecord{files: []string{src}}
+	var err error
+	if opts.From == FormatNative {
+		var spec []byte
+		if spec, err = os.ReadFile(src); err == nil {
+			_, _, err = parseSpec(spec, src, rec)
+		}
+	}
+	if opts.Weights != "" {
+		rec.files = append(rec.files, opts.Weights)
+	}
+	return rec.files, err
+}
@@ -0,0 +1,112 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/sbl8/sublation/model"
+)
+
+var tensorSyntax = regexp.MustCompile(`^tensor\s+(\S+)\s+(\w+)\s*\[([^\]]*)\]\s*(?:=\s*@(\S+))?\s*(\w+)?$`)
+
+// parseTensorLine parses a tensor declaration:
+//
+//	tensor <name> <dtype>[<d0>, <d1>, ...] [= @<file>] [input|weight|bias|activation]
+//
+// The compiler lays the tensor out in the payload as a segment named after
+// it, filled from the file, whose size must match the shape, or with
+// zeros. Tensors read from a file default to the weight role, others to
+// activation. An input tensor is a source node bound to a model input of
+// its name and shape. Named nodes consume tensors by name, and numbered
+// nodes compute on them with "@<name>" in place of the payload range.
+func (p *dslParser) parseTensorLine(line string) error {
+	if p.module != nil {
+		return fmt.Errorf("tensor is not allowed in a module")
+	}
+	m := tensorSyntax.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("invalid tensor spec: want tensor <name> <dtype>[shape] [= @file] [role]")
+	}
+	d := namedNode{name: m[1], tensor: true, src: p.line}
+	if !nodeName.MatchString(d.name) {
+		return atToken(d.name, fmt.Errorf("invalid tensor name %q", d.name))
+	}
+	if p.declared(d.name) {
+		return atToken(d.name, fmt.Errorf("duplicate tensor name %q", d.name))
+	}
+	var err error
+	if d.dtype, err = model.ParseDType(m[2]); err != nil {
+		return atToken(m[2], fmt.Errorf("tensor %s: %v", d.name, err))
+	}
+	if d.shape, err = parseDims(m[3], p.scope()); err != nil {
+		return atToken("["+m[3], fmt.Errorf("tensor %s: %v", d.name, err))
+	}
+	size := uint64(d.dtype.Size())
+	for _, n := range d.shape {
+		if size *= uint64(n); size > 1<<32-1 {
+			return fmt.Errorf("tensor %s: shape %v exceeds 4 GiB", d.name, d.shape)
+		}
+	}
+
+	switch role := m[5]; {
+	case role == "input":
+		if m[4] != "" {
+			return fmt.Errorf("tensor %s: an input cannot be read from a file", d.name)
+		}
+		d.input = true
+	case role == "" && m[4] != "":
+		d.role = model.RoleWeight
+	default:
+		if d.role, err = model.ParseSegmentRole(role); err != nil {
+			return atToken(role, fmt.Errorf("tensor %s: %v", d.name, err))
+		}
+	}
+
+	if path := m[4]; path != "" {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(p.dir, path)
+		}
+		p.depend(path)
+		if d.data, err = os.ReadFile(path); err != nil {
+			return atToken("@"+m[4], fmt.Errorf("tensor %s: %w", d.name, err))
+		}
+		if uint64(len(d.data)) != size {
+			return atToken("@"+m[4], fmt.Errorf("tensor %s: %s is %d bytes, %s[%s] needs %d", d.name, m[4], len(d.data), m[2], m[3], size))
+		}
+	}
+	p.declare(d.name, SymbolTensor)
+	p.named = append(p.named, d)
+	return nil
+}
+
+// segmentRef is a numbered node computing on a segment given by name
+type segmentRef struct {
+	node int // Index in the parsed nodes
+	name string
+	src  srcLine
+}
+
+// resolveSegmentNames points the nodes of refs at the segments they name,
+// declared by "segment" or "tensor" directives or by named nodes, reporting
+// every undefined one in an ErrorList
+func resolveSegmentNames(g *model.Graph, refs []segmentRef) error {
+	var errs ErrorList
+	for _, r := range refs {
+		n := &g.Nodes[r.node]
+		for _, s := range g.Segments {
+			if s.Name == r.name {
+				n.Segment = s.ID
+				break
+			}
+		}
+		if n.Segment == 0 {
+			errs = append(errs, r.src.errorf("@"+r.name, "node %d: undefined segment %q", n.ID, r.name))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestTensorDeclarations(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	bias := make([]byte, 16)
+	for i := range 4 {
+		binary.LittleEndian.PutUint32(bias[i*4:], math.Float32bits(float32(i+1)))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.bin"), bias, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "w.bin"), []byte{1, 2, 3, 4, 5, 6}, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	src := filepath.Join(dir, "m.subs")
+	// w is only used through its segment, so it does not become a node
+	spec := `tensor x f32[2, 2] input
+tensor b f32[2, 2] = @b.bin bias
+tensor w u8[6] = @w.bin
+tensor scratch i32[3]
+node h = add(x, b)
+node y = relu(h)
+node 0 0 @w
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := CompileWithOptions(src, out, DefaultOptions()); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := readCompiled(out)
+	if err != nil {
+		t.Fatalf("readCompiled failed: %v", err)
+	}
+
+	segs := map[string]model.Segment{}
+	for _, s := range graph.Segments {
+		segs[s.Name] = s
+	}
+	want := []struct {
+		name   string
+		dtype  model.DType
+		role   model.SegmentRole
+		length uint32
+	}{
+		{"x", model.Float32, model.RoleActivation, 16},
+		{"b", model.Float32, model.RoleBias, 16},
+		{"w", model.Uint8, model.RoleWeight, 6},
+		{"scratch", model.Int32, model.RoleActivation, 12},
+		{"h", model.Float32, model.RoleActivation, 16},
+	}
+	for _, w := range want {
+		s, ok := segs[w.name]
+		if !ok || s.DType != w.dtype || s.Role != w.role || s.Length != w.length || s.Offset%32 != 0 {
+			t.Errorf("%s: expected an aligned %v %v segment of %d bytes, got %+v", w.name, w.role, w.dtype, w.length, s)
+		}
+	}
+	if b := segs["b"]; !bytes.Equal(graph.Payload[b.Offset:b.End()], bias) {
+		t.Errorf("Expected b to hold the file contents, got % x", graph.Payload[b.Offset:b.End()])
+	}
+
+	nodes := map[uint32]model.Node{}
+	for _, n := range graph.Nodes {
+		nodes[n.Segment] = n
+	}
+	if len(graph.Nodes) != 5 {
+		t.Errorf("Expected nodes 0, x, b, h and y, got %d nodes", len(graph.Nodes))
+	}
+	if n, ok := nodes[segs["w"].ID]; !ok || n.ID != 0 {
+		t.Errorf("Expected node 0 to compute on w, got %+v", n)
+	}
+	if _, ok := nodes[segs["scratch"].ID]; ok {
+		t.Error("Expected no node for the unused tensor scratch")
+	}
+	h := nodes[segs["h"].ID]
+	if !slices.Equal(h.Topo, []uint32{nodes[segs["x"].ID].ID, nodes[segs["b"].ID].ID}) {
+		t.Errorf("Expected h to consume x and b, got %v", h.Topo)
+	}
+	inputs := graph.Inputs()
+	if len(inputs) != 1 || inputs[0].Name != "x" || inputs[0].NodeID != nodes[segs["x"].ID].ID || !slices.Equal(inputs[0].Shape, []int{2, 2}) {
+		t.Errorf("Expected input x of shape [2 2], got %+v", inputs)
+	}
+	if y := nodes[segs["y"].ID]; !slices.Equal(graph.Shapes[y.ID], []int{2, 2}) {
+		t.Errorf("Expected y of shape [2 2], got %v", graph.Shapes[y.ID])
+	}
+
+	invalid := map[string]struct{ spec, want string }{
+		"size":      {"tensor w f32[2] = @w.bin\n", "w.bin is 6 bytes, f32[2] needs 8"},
+		"file":      {"tensor w f32[2] = @missing.bin\n", "missing.bin"},
+		"dtype":     {"tensor w f64[2]\n", `unknown dtype "f64"`},
+		"role":      {"tensor w f32[2] output\n", `unknown segment role "output"`},
+		"input":     {"tensor x u8[6] = @w.bin input\n", "cannot be read from a file"},
+		"duplicate": {"tensor x f32[2]\nnode x = noop() [2]\n", `duplicate node name "x"`},
+		"arity":     {"tensor a f32[2] input\ntensor b f32[2] input\nnode y = relu(a, b)\n", "relu takes 1 inputs, got 2"},
+		"binary":    {"tensor x f32[2] input\nnode y = add(x)\n", "add takes 2 inputs, got 1"},
+		"float":     {"tensor x u8[6] = @w.bin\nnode y = relu(x)\n", "tensor x is uint8"},
+		"segment":   {"node 0 0 @nothing\n", `node 0: undefined segment "nothing"`},
+		"module":    {"module m {\ntensor x f32[2]\n}\n", "not allowed in a module"},
+		"syntax":    {"tensor x f32\n", "invalid tensor spec"},
+	}
+	for name, c := range invalid {
+		src := filepath.Join(dir, name+".subs")
+		if err := os.WriteFile(src, []byte(c.spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := Compile(src, src+"l"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
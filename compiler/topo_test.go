@@ -0,0 +1,24 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompileNamesCycle(t *testing.T) {
+	t.Parallel()
+	src := filepath.Join(t.TempDir(), "m.subs")
+	spec := "node 0 1 0 32\nnode 1 1 0 32 <- 0 2\nnode 2 1 0 32 <- 1\npayload " + strings.Repeat("00", 64) + "\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := Compile(src, src+"l"); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	_, err := CompileWithOptions(src, src+"l", DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle: 1 -> 2 -> 1") {
+		t.Errorf("Expected the compiler to name the cycle, got %v", err)
+	}
+}
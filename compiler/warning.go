@@ -0,0 +1,101 @@
+package compiler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// WarningClass is a kind of warning about the source, which -W flags
+// enable, disable or turn into errors
+type WarningClass string
+
+const (
+	WarnUnused       WarningClass = "unused"        // Tensors and modules never used
+	WarnEmptyIterate WarningClass = "empty-iterate" // iterate ranges that expand to nothing
+	WarnPayloadText  WarningClass = "payload-text"  // Payload data that is not hex
+)
+
+// WarningClasses lists every warning class
+var WarningClasses = []WarningClass{WarnUnused, WarnEmptyIterate, WarnPayloadText}
+
+// Severity is what the compiler does with a class of warnings
+type Severity uint8
+
+const (
+	SeverityWarn   Severity = iota // Report the warning and go on, the default
+	SeverityIgnore                 // Drop the warning
+	SeverityError                  // Fail the compilation
+)
+
+// Warning is a warning about the source, as collected in a compile report
+type Warning struct {
+	Class WarningClass `json:"class"`
+	Pos   Pos          `json:"pos"`
+	Msg   string       `json:"message"`
+}
+
+// String formats the warning as the compiler prints it
+func (w Warning) String() string {
+	return fmt.Sprintf("%v: warning: %s [%s]", w.Pos, w.Msg, w.Class)
+}
+
+// ParseWarningFlag applies a -W flag to severities: a class name enables
+// the class, no-<class> disables it and error=<class> makes it an error.
+// "all" stands for every class.
+func ParseWarningFlag(value string, severities map[WarningClass]Severity) error {
+	severity, name := SeverityWarn, value
+	if rest, ok := strings.CutPrefix(value, "no-"); ok {
+		severity, name = SeverityIgnore, rest
+	} else if rest, ok := strings.CutPrefix(value, "error="); ok {
+		severity, name = SeverityError, rest
+	}
+	classes := WarningClasses
+	if name != "all" {
+		if !slices.Contains(WarningClasses, WarningClass(name)) {
+			return fmt.Errorf("unknown warning class %q, want one of %v or all", name, WarningClasses)
+		}
+		classes = []WarningClass{WarningClass(name)}
+	}
+	for _, c := range classes {
+		severities[c] = severity
+	}
+	return nil
+}
+
+// severity returns what to do with a class of warnings: Strict makes
+// every class not set otherwise an error
+func (opts CompileOptions) severity(class WarningClass) Severity {
+	s := opts.Severities[class]
+	if s == SeverityWarn && opts.Strict {
+		return SeverityError
+	}
+	return s
+}
+
+// applySeverities drops the ignored warnings, records the others in the
+// report and prints them, and returns the warnings that are errors
+func (opts CompileOptions) applySeverities(warnings ErrorList, report *CompileReport) ErrorList {
+	var kept, errs ErrorList
+	for _, w := range warnings {
+		switch opts.severity(w.Class) {
+		case SeverityIgnore:
+		case SeverityError:
+			promoted := *w
+			promoted.Warning = false
+			if opts.Severities[w.Class] == SeverityError {
+				promoted.Msg += fmt.Sprintf(" (error=%s)", w.Class)
+			} else {
+				promoted.Msg += " (strict)"
+			}
+			errs = append(errs, &promoted)
+		default:
+			kept = append(kept, w)
+			report.Warnings = append(report.Warnings, Warning{Class: w.Class, Pos: w.Pos, Msg: w.Msg})
+		}
+	}
+	if len(kept) > 0 && opts.Warnings != nil {
+		PrintErrors(opts.Warnings, kept)
+	}
+	return errs
+}
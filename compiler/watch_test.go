@@ -0,0 +1,47 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSourceFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		return path
+	}
+	write("bias.bin", strings.Repeat("\x00", 32))
+	write("raw.bin", strings.Repeat("\x00", 32))
+	inc := write("layer.subs", "tensor b f32[8] = @bias.bin\n")
+	src := write("m.subs", `include "layer.subs"
+payload @file("raw.bin")
+tensor x f32[8] input
+node y = relu(x)
+`)
+
+	opts := DefaultOptions()
+	opts.Weights = filepath.Join(dir, "w.safetensors")
+	files, err := SourceFiles(src, opts)
+	if err != nil {
+		t.Fatalf("SourceFiles failed: %v", err)
+	}
+	want := []string{src, inc, filepath.Join(dir, "bias.bin"), filepath.Join(dir, "raw.bin"), opts.Weights}
+	if !slices.Equal(files, want) {
+		t.Errorf("Expected files %v, got %v", want, files)
+	}
+
+	// A missing include is still listed with the error
+	broken := write("broken.subs", "include \"missing.subs\"\n")
+	files, err = SourceFiles(broken, DefaultOptions())
+	if err == nil || !slices.Contains(files, filepath.Join(dir, "missing.subs")) {
+		t.Errorf("Expected an error and missing.subs listed, got %v, %v", files, err)
+	}
+}
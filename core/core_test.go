@@ -38,7 +38,7 @@ func TestSublateValidation(t *testing.T) {
 			name: "valid sublate",
 			sublate: &Sublate{
 				PayloadPrev: []byte{1, 2, 3, 4}, // 4 bytes, aligned
-				Topology:    []uint16{1, 2},
+				Topology:    []uint32{1, 2},
 				KernelID:    1,
 			},
 			wantErr: false,
@@ -47,7 +47,7 @@ func TestSublateValidation(t *testing.T) {
 			name: "invalid topology",
 			sublate: &Sublate{
 				PayloadPrev: []byte{1, 2, 3, 4},
-				Topology:    []uint16{0xFFFF}, // invalid index
+				Topology:    []uint32{0xFFFFFFFF}, // invalid index
 				KernelID:    1,
 			},
 			wantErr: true,
@@ -99,7 +99,7 @@ func TestSublateClone(t *testing.T) {
 	original := &Sublate{
 		PayloadPrev: []byte{1, 2, 3, 4},
 		PayloadProp: []byte{5, 6, 7, 8},
-		Topology:    []uint16{1, 2, 3},
+		Topology:    []uint32{1, 2, 3},
 		KernelID:    5,
 		Flags:       FlagDirty,
 	}
@@ -200,7 +200,7 @@ func TestSublatePool(t *testing.T) {
 	s1.KernelID = 42
 	s1.PayloadPrev = pool.GetBuffer()
 	s1.PayloadPrev = append(s1.PayloadPrev, 1, 2, 3, 4)
-	s1.Topology = []uint16{1, 2, 3}
+	s1.Topology = []uint32{1, 2, 3}
 
 	// Return to pool
 	pool.Put(s1)
@@ -221,7 +221,7 @@ func TestSublatePool(t *testing.T) {
 func BenchmarkSublateValidation(b *testing.B) {
 	s := &Sublate{
 		PayloadPrev: make([]byte, 1024),
-		Topology:    []uint16{1, 2, 3, 4, 5},
+		Topology:    []uint32{1, 2, 3, 4, 5},
 		KernelID:    1,
 	}
 
@@ -245,7 +245,7 @@ func BenchmarkSublateClone(b *testing.B) {
 	s := &Sublate{
 		PayloadPrev: make([]byte, 1024),
 		PayloadProp: make([]byte, 1024),
-		Topology:    []uint16{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		Topology:    []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
 		KernelID:    1,
 	}
 
@@ -321,3 +321,27 @@ func TestSublateAsUint32(t *testing.T) {
 		t.Error("Expected nil for unaligned data")
 	}
 }
+
+func TestSerializeSublateTopology(t *testing.T) {
+	t.Parallel()
+	s := &Sublate{KernelID: 1, Topology: make([]uint32, 1000)}
+	for i := range s.Topology {
+		s.Topology[i] = uint32(i * 7)
+	}
+	data, err := SerializeSublate(s)
+	if err != nil {
+		t.Fatalf("SerializeSublate failed: %v", err)
+	}
+	got, err := DeserializeSublate(data)
+	if err != nil {
+		t.Fatalf("DeserializeSublate failed: %v", err)
+	}
+	if len(got.Topology) != 1000 || got.Topology[999] != 999*7 {
+		t.Errorf("Expected 1000 neighbors ending in %d, got %d", 999*7, len(got.Topology))
+	}
+
+	s.Topology = make([]uint32, 0x10000)
+	if _, err := SerializeSublate(s); err == nil {
+		t.Error("Expected an error instead of truncating 65536 neighbors")
+	}
+}
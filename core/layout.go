@@ -25,7 +25,7 @@ func AlignPage(size int) int {
 
 // SublateSize calculates the exact memory footprint of a Sublate
 func SublateSize(s *Sublate) int {
-	return int(unsafe.Sizeof(*s)) + len(s.PayloadPrev) + len(s.PayloadProp) + len(s.Topology)*2
+	return int(unsafe.Sizeof(*s)) + len(s.PayloadPrev) + len(s.PayloadProp) + len(s.Topology)*4
 }
 
 // SublateAlignedSize calculates the aligned memory footprint
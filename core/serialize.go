@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 )
 
 // SerializeSublate writes a Sublate to a byte slice in binary form.
-// Layout: [KernelID(1)][Flags(4)][len(Topology)(2)][Topology elems(2*len)][len(PayloadPrev)(4)][PayloadPrev bytes][len(PayloadProp)(4)][PayloadProp bytes]
+// Layout: [KernelID(1)][Flags(4)][len(Topology)(2)][Topology elems(4*len)][len(PayloadPrev)(4)][PayloadPrev bytes][len(PayloadProp)(4)][PayloadProp bytes]
 func SerializeSublate(s *Sublate) ([]byte, error) {
 	buf := &bytes.Buffer{}
 
@@ -22,6 +23,9 @@ func SerializeSublate(s *Sublate) ([]byte, error) {
 	}
 
 	// Topology length
+	if len(s.Topology) > 0xFFFF {
+		return nil, fmt.Errorf("topology has %d entries, limit %d", len(s.Topology), 0xFFFF)
+	}
 	topoLen := uint16(len(s.Topology))
 	if err := binary.Write(buf, binary.LittleEndian, topoLen); err != nil {
 		return nil, err
@@ -83,7 +87,7 @@ func DeserializeSublate(b []byte) (*Sublate, error) {
 	}
 
 	// Topology elements
-	s.Topology = make([]uint16, topoLen)
+	s.Topology = make([]uint32, topoLen)
 	for i := uint16(0); i < topoLen; i++ {
 		if err := binary.Read(buf, binary.LittleEndian, &s.Topology[i]); err != nil {
 			return nil, err
@@ -126,7 +130,7 @@ func BatchSerializeSublates(sublates []*Sublate) ([]byte, error) {
 	// Pre-calculate total size for single allocation
 	totalSize := 0
 	for _, s := range sublates {
-		totalSize += 1 + 4 + 2 + len(s.Topology)*2 + 4 + len(s.PayloadPrev) + 4 + len(s.PayloadProp)
+		totalSize += 1 + 4 + 2 + len(s.Topology)*4 + 4 + len(s.PayloadPrev) + 4 + len(s.PayloadProp)
 	}
 
 	buf := make([]byte, 0, totalSize)
@@ -153,7 +157,7 @@ type SerializationHeader struct {
 
 const (
 	SerializationMagic   = 0x4C425553 // "SUBL" in little endian
-	SerializationVersion = 1
+	SerializationVersion = 2
 	HeaderSize           = 20 // sizeof(SerializationHeader)
 )
 
@@ -247,7 +251,7 @@ func BatchDeserializeSublates(data []byte, count int) ([]*Sublate, error) {
 		}
 
 		// Skip topology data
-		if _, err := tempBuf.Seek(int64(topoLen)*2, 1); err != nil {
+		if _, err := tempBuf.Seek(int64(topoLen)*4, 1); err != nil {
 			return nil, err
 		}
 
@@ -269,7 +273,7 @@ func BatchDeserializeSublates(data []byte, count int) ([]*Sublate, error) {
 		}
 
 		// Calculate total sublate size
-		sublateSize := 1 + 4 + 2 + int(topoLen)*2 + 4 + int(prevLen) + 4 + int(propLen)
+		sublateSize := 1 + 4 + 2 + int(topoLen)*4 + 4 + int(prevLen) + 4 + int(propLen)
 
 		// Read the complete sublate
 		sublateData := make([]byte, sublateSize)
@@ -325,9 +329,9 @@ func AnalyzeMemoryLayout(sublates []*Sublate) MemoryLayout {
 	}
 
 	for _, s := range sublates {
-		layout.TotalSize += 1 + 4 + 2 + len(s.Topology)*2 + 4 + len(s.PayloadPrev) + 4 + len(s.PayloadProp)
+		layout.TotalSize += 1 + 4 + 2 + len(s.Topology)*4 + 4 + len(s.PayloadPrev) + 4 + len(s.PayloadProp)
 		layout.PayloadSize += len(s.PayloadPrev) + len(s.PayloadProp)
-		layout.TopologySize += len(s.Topology) * 2
+		layout.TopologySize += len(s.Topology) * 4
 	}
 
 	// Calculate fragmentation as percentage of overhead
@@ -27,7 +27,7 @@ import (
 type Sublate struct {
 	PayloadPrev []byte   // previous step data (aligned to cache boundary)
 	PayloadProp []byte   // propagation data (aligned to cache boundary)
-	Topology    []uint16 // neighbor indices for message passing
+	Topology    []uint32 // neighbor indices for message passing
 	KernelID    uint8    // opcode for data transform
 	Flags       uint32   // runtime flags including lineage tracking
 
@@ -39,10 +39,11 @@ type Sublate struct {
 
 // Flags bit definitions for runtime behavior
 const (
-	FlagLineageTracked = 1 << 0 // Set when lineage has been updated
+	FlagLineageTracked = 1 << 0 // Set when lineage has been updated, see runtime.EngineOptions.Lineage
 	FlagFused          = 1 << 1 // Set when sublate has been fused
 	FlagDirty          = 1 << 2 // Set when data needs propagation
 	FlagReadOnly       = 1 << 3 // Set for immutable sublates
+	FlagShared         = 1 << 4 // Set for sublates tied to others sharing their payload segment
 )
 
 // Size returns the total size of the sublate data
@@ -62,7 +63,7 @@ func (s *Sublate) Validate() error {
 		return errors.New("sublate payload not aligned to 4-byte boundary")
 	}
 	for _, idx := range s.Topology {
-		if idx == 0xFFFF {
+		if idx == 0xFFFFFFFF {
 			return errors.New("invalid topology index")
 		}
 	}
@@ -128,7 +129,7 @@ func (s *Sublate) Clone() *Sublate {
 		Flags:       s.Flags,
 		PayloadPrev: make([]byte, len(s.PayloadPrev)),
 		PayloadProp: make([]byte, len(s.PayloadProp)),
-		Topology:    make([]uint16, len(s.Topology)),
+		Topology:    make([]uint32, len(s.Topology)),
 		capacity:    s.capacity,
 	}
 	copy(clone.PayloadPrev, s.PayloadPrev)
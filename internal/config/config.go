@@ -0,0 +1,251 @@
+// Package config reads the project config file the command line tools take
+// their defaults from, so a project does not repeat the same flags on every
+// command line. The file is sublation.toml or sublation.yaml (or .yml) in the
+// working directory or one of its parents, holding flat key/value pairs:
+//
+//	workers = 8
+//	arena_size = "64MiB"
+//	target = "avx2"
+//	opt_level = 2
+//	output_format = "json"
+//
+// Flags given on the command line override the file.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// FileNames lists the config file names looked for, in order of preference
+var FileNames = []string{"sublation.toml", "sublation.yaml", "sublation.yml"}
+
+// Keys lists the keys a config file may set
+var Keys = []string{"workers", "arena_size", "target", "opt_level", "output_format"}
+
+// Config holds the values a config file sets, validated but kept as text
+// so they can be applied like command line flags
+type Config struct {
+	Path   string // File the values were read from
+	values map[string]string
+}
+
+// Find returns the path of the config file in dir or the closest parent
+// directory holding one, or "" when there is none
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range FileNames {
+			path := filepath.Join(dir, name)
+			info, err := os.Stat(path)
+			if err == nil && !info.IsDir() {
+				return path, nil
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads the config file at path, or with path "" the one Find
+// discovers from the working directory. It returns an empty Config when
+// there is no file, and for the path "none".
+func Load(path string) (*Config, error) {
+	if path == "none" {
+		return &Config{}, nil
+	}
+	if path == "" {
+		var err error
+		if path, err = Find("."); err != nil || path == "" {
+			return &Config{}, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse parses config data in the format the extension of path names:
+// TOML for .toml, YAML for .yaml and .yml. Both take one key per line,
+// with # comments, and values that are numbers or optionally quoted strings.
+func Parse(path string, data []byte) (*Config, error) {
+	sep := ""
+	switch filepath.Ext(path) {
+	case ".toml":
+		sep = "="
+	case ".yaml", ".yml":
+		sep = ":"
+	default:
+		return nil, fmt.Errorf("%s: unknown config format, want .toml, .yaml or .yml", path)
+	}
+	c := &Config{Path: path, values: map[string]string{}}
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" || line == "---" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want key %s value, got %q", path, n+1, sep, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !slices.Contains(Keys, key) {
+			return nil, fmt.Errorf("%s:%d: unknown key %q (want %s)", path, n+1, key, strings.Join(Keys, ", "))
+		}
+		if _, dup := c.values[key]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate key %q", path, n+1, key)
+		}
+		value, err := unquote(value)
+		if err == nil {
+			err = validate(key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %w", path, n+1, key, err)
+		}
+		c.values[key] = value
+	}
+	return c, nil
+}
+
+// stripComment drops a # comment from line, leaving # inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquote returns a value without its double or single quotes
+func unquote(value string) (string, error) {
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		if len(value) < 2 || value[len(value)-1] != value[0] {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	}
+	if value == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return value, nil
+}
+
+// validate checks a value is valid for key, so a bad file fails on load
+// with its line number rather than later as a flag
+func validate(key, value string) error {
+	switch key {
+	case "workers":
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			return fmt.Errorf("invalid value %q, want a positive number", value)
+		}
+	case "arena_size":
+		var s Size
+		return s.Set(value)
+	case "target":
+		_, err := model.ParseTarget(value)
+		return err
+	case "opt_level":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 2 {
+			return fmt.Errorf("invalid value %q, want 0, 1 or 2", value)
+		}
+	}
+	return nil
+}
+
+// Get returns the value the file sets for key
+func (c *Config) Get(key string) (string, bool) {
+	v, ok := c.values[key]
+	return v, ok
+}
+
+// Apply sets the flags of fs that flags maps config keys to from the file,
+// leaving alone those given on the command line. Call it after fs.Parse.
+func (c *Config) Apply(fs *flag.FlagSet, flags map[string]string) error {
+	set := Explicit(fs)
+	for key, name := range flags {
+		value, ok := c.values[key]
+		if !ok || set[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", c.Path, key, err)
+		}
+	}
+	return nil
+}
+
+// Explicit returns the names of the flags given on the command line
+func Explicit(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// Size is a byte count flag taking a plain number or one with a KiB, MiB or
+// GiB suffix (KB, MB and GB are taken as the same powers of two)
+type Size uintptr
+
+func (s Size) String() string {
+	switch {
+	case s == 0:
+		return "0"
+	case s%(1<<30) == 0:
+		return fmt.Sprintf("%dGiB", s>>30)
+	case s%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", s>>20)
+	case s%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", s>>10)
+	}
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+func (s *Size) Set(value string) error {
+	num, shift := value, 0
+	for _, u := range []struct {
+		suffixes []string
+		shift    int
+	}{{[]string{"KiB", "KB", "K"}, 10}, {[]string{"MiB", "MB", "M"}, 20}, {[]string{"GiB", "GB", "G"}, 30}} {
+		for _, suffix := range u.suffixes {
+			if rest, ok := strings.CutSuffix(value, suffix); ok {
+				num, shift = strings.TrimSpace(rest), u.shift
+				break
+			}
+		}
+		if shift != 0 {
+			break
+		}
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil || n > uint64(^uintptr(0))>>shift {
+		return fmt.Errorf("invalid size %q, want bytes or a number with a KiB, MiB or GiB suffix", value)
+	}
+	*s = Size(n << shift)
+	return nil
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"sublation.toml": `# project defaults
+workers = 4
+arena_size = "64MiB" # trailing comment
+target = 'avx2'
+opt_level = 2
+output_format = "json"
+`,
+		"sublation.yaml": `---
+workers: 4
+arena_size: 64MiB   # trailing comment
+target: avx2
+opt_level: 2
+output_format: "json"
+`,
+	}
+	want := map[string]string{"workers": "4", "arena_size": "64MiB", "target": "avx2", "opt_level": "2", "output_format": "json"}
+	for name, data := range files {
+		c, err := Parse(name, []byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for key, v := range want {
+			if got, ok := c.Get(key); !ok || got != v {
+				t.Errorf("%s: %s = %q, %v, want %q", name, key, got, ok, v)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name, data, want string
+	}{
+		{"sublation.toml", "threads = 4", `unknown key "threads"`},
+		{"sublation.toml", "workers: 4", "want key = value"},
+		{"sublation.toml", "workers = 0", "positive number"},
+		{"sublation.toml", "workers = 2\nworkers = 4", `:2: duplicate key "workers"`},
+		{"sublation.yaml", "target: sparc", "unknown target"},
+		{"sublation.yaml", "opt_level: 3", "want 0, 1 or 2"},
+		{"sublation.yaml", "arena_size: 1TB", "invalid size"},
+		{"sublation.yaml", `output_format: "json`, "unterminated string"},
+		{"sublation.ini", "workers = 4", "unknown config format"},
+	} {
+		_, err := Parse(tc.name, []byte(tc.data))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Parse(%s, %q) = %v, want an error containing %q", tc.name, tc.data, err, tc.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if path, err := Find(sub); err != nil || path != "" && strings.HasPrefix(path, root) {
+		t.Fatalf("Find without a file = %q, %v", path, err)
+	}
+	for _, name := range []string{"sublation.yaml", "sublation.toml"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if path, err := Find(sub); err != nil || path != filepath.Join(root, "sublation.toml") {
+		t.Errorf("Find = %q, %v, want the parent's sublation.toml", path, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+	c, err := Parse("sublation.toml", []byte("workers = 3\narena_size = \"1KiB\"\noutput_format = \"csv\""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	workers := fs.Int("workers", 1, "")
+	var arena Size
+	fs.Var(&arena, "arena-size", "")
+	format := fs.String("output-format", "raw", "")
+	if err := fs.Parse([]string{"-output-format", "npy"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Apply(fs, map[string]string{"workers": "workers", "arena_size": "arena-size", "output_format": "output-format"}); err != nil {
+		t.Fatal(err)
+	}
+	if *workers != 3 || arena != 1024 || *format != "npy" {
+		t.Errorf("got workers %d, arena size %v, output format %q, want 3, 1KiB and the flag's npy", *workers, arena, *format)
+	}
+}
+
+func TestSize(t *testing.T) {
+	t.Parallel()
+	for in, want := range map[string]Size{"0": 0, "4096": 4096, "64KiB": 64 << 10, "2 MB": 2 << 20, "1G": 1 << 30} {
+		var s Size
+		if err := s.Set(in); err != nil || s != want {
+			t.Errorf("Set(%q) = %d, %v, want %d", in, s, err, want)
+		}
+	}
+	if got := Size(3 << 20).String(); got != "3MiB" {
+		t.Errorf("String = %q, want 3MiB", got)
+	}
+}
@@ -0,0 +1,115 @@
+// Package exit defines the exit codes of the command line tools and how
+// they report the error they exit on: as log text, or with -error-format
+// json as a single JSON object on stderr, so build systems and wrappers
+// can react to failures without scraping messages.
+//
+// The codes are stable:
+//
+//	0  success
+//	1  any other failure
+//	2  usage: invalid flags or arguments
+//	3  parse: a source, model file or input that does not parse
+//	4  validation: well-formed but rejected, such as a cyclic graph, a
+//	   shape mismatch or a bad signature
+//	5  io: a file that cannot be read or written
+//	6  runtime: engine creation or execution failed
+package exit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+)
+
+// Code is a process exit status
+type Code int
+
+const (
+	OK         Code = 0
+	Failure    Code = 1
+	Usage      Code = 2 // As the flag package exits on an invalid flag
+	Parse      Code = 3
+	Validation Code = 4
+	IO         Code = 5
+	Runtime    Code = 6
+)
+
+var codeNames = [...]string{"ok", "failure", "usage", "parse", "validation", "io", "runtime"}
+
+// String returns the name of the code as -error-format json reports it
+func (c Code) String() string {
+	if c >= 0 && int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return fmt.Sprintf("Code(%d)", int(c))
+}
+
+// Diagnostic is a located error, such as one syntax error of a source
+type Diagnostic struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Col     int    `json:"col,omitempty"`
+	Message string `json:"message"`
+}
+
+// report is the JSON object -error-format json writes
+type report struct {
+	Code        int          `json:"code"`
+	Kind        string       `json:"kind"`
+	Message     string       `json:"message"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+var jsonFormat bool
+
+// SetFormat selects how Fatal reports errors: text or json
+func SetFormat(name string) error {
+	switch name {
+	case "text":
+		jsonFormat = false
+	case "json":
+		jsonFormat = true
+	default:
+		return fmt.Errorf("invalid error format %q, want text or json", name)
+	}
+	return nil
+}
+
+// JSON reports whether errors are reported as JSON
+func JSON() bool {
+	return jsonFormat
+}
+
+// Classify returns IO for errors of the file system, such as a missing
+// file, and otherwise fallback
+func Classify(err error, fallback Code) Code {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return IO
+	}
+	return fallback
+}
+
+// Fatalf reports the formatted message and exits with code
+func Fatalf(code Code, format string, args ...any) {
+	Fatal(code, fmt.Sprintf(format, args...))
+}
+
+// Fatal reports msg and its diagnostics and exits with code. As text, msg
+// goes through the log package and the caller prints the diagnostics, with
+// whatever context it has; as JSON, both make up a single object.
+func Fatal(code Code, msg string, diags ...Diagnostic) {
+	if !jsonFormat {
+		log.Print(msg)
+		os.Exit(int(code))
+	}
+	enc := json.NewEncoder(os.Stderr)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(report{Code: int(code), Kind: code.String(), Message: msg, Diagnostics: diags}); err != nil {
+		log.Print(msg)
+	}
+	os.Exit(int(code))
+}
@@ -0,0 +1,44 @@
+package exit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCodes(t *testing.T) {
+	t.Parallel()
+	// The codes are a contract with scripts: they must never change
+	for code, want := range map[Code]int{OK: 0, Failure: 1, Usage: 2, Parse: 3, Validation: 4, IO: 5, Runtime: 6} {
+		if int(code) != want {
+			t.Errorf("%v = %d, want %d", code, int(code), want)
+		}
+	}
+	if Validation.String() != "validation" || Code(9).String() != "Code(9)" {
+		t.Errorf("got names %q and %q", Validation, Code(9))
+	}
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	_, err := os.ReadFile("does-not-exist")
+	if got := Classify(fmt.Errorf("failed to read source: %w", err), Parse); got != IO {
+		t.Errorf("Classify of a missing file = %v, want io", got)
+	}
+	if got := Classify(errors.New("bad kernel"), Parse); got != Parse {
+		t.Errorf("Classify of another error = %v, want the fallback parse", got)
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	if err := SetFormat("xml"); err == nil {
+		t.Error("SetFormat(xml) succeeded")
+	}
+	if err := SetFormat("json"); err != nil || !JSON() {
+		t.Errorf("SetFormat(json) = %v, JSON() = %v", err, JSON())
+	}
+	if err := SetFormat("text"); err != nil || JSON() {
+		t.Errorf("SetFormat(text) = %v, JSON() = %v", err, JSON())
+	}
+}
@@ -0,0 +1,92 @@
+// Package version describes the build of the Sublation binaries. Release
+// builds stamp Version, Commit and Date through the linker:
+//
+//	go build -ldflags "-X github.com/sbl8/sublation/internal/version.Version=v1.2.0 \
+//	    -X github.com/sbl8/sublation/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	    -X github.com/sbl8/sublation/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// as make build does. Without them the module version and the VCS
+// revision and time the Go toolchain records are used when known.
+package version
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	sublation_runtime "github.com/sbl8/sublation/runtime"
+)
+
+// Set with -ldflags -X at build time
+var (
+	Version = "" // Release version such as v1.2.0
+	Commit  = "" // VCS revision
+	Date    = "" // Build time
+)
+
+// Info is the build of a binary
+type Info struct {
+	Version string
+	Commit  string // "" when unknown
+	Date    string // "" when unknown
+	Go      string
+}
+
+// Get returns the build info, taking what the linker did not set from the
+// build info the Go toolchain embeds
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, Go: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value[:min(len(s.Value), 12)]
+			case s.Key == "vcs.time" && info.Date == "":
+				info.Date = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true" && Commit == "":
+				info.Commit += "-dirty"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
+
+// String formats the info on one line, such as
+// "v1.2.0 (commit 1a2b3c4, built 2026-01-02T15:04:05Z, go1.22.2)"
+func (i Info) String() string {
+	details := make([]string, 0, 3)
+	if i.Commit != "" {
+		details = append(details, "commit "+i.Commit)
+	}
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+	details = append(details, i.Go)
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
+
+// Print writes what -version shows for the binary called name: its build,
+// platform, the .subl format versions it reads and writes, and the kernel
+// ISAs enabled on this machine
+func Print(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %v\n", name, Get())
+	fmt.Fprintf(w, "platform:    %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(w, "formats:     .subl version %d (written), %d and headerless legacy (read)\n", model.Version2, model.Version1)
+	isas := []string{sublation_runtime.HostTarget().String()}
+	if kernels.UseASM() {
+		isas = append(isas, runtime.GOARCH+" assembly kernels")
+	} else {
+		isas = append(isas, "pure Go kernels")
+	}
+	fmt.Fprintf(w, "kernel ISAs: %s\n", strings.Join(isas, ", "))
+}
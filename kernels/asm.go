@@ -2,6 +2,8 @@
 
 package kernels
 
+import "math"
+
 // Assembly function declarations for AMD64
 //
 //go:noescape
@@ -22,6 +24,21 @@ func axpyASM(alpha float32, x, y []float32)
 //go:noescape
 func gemvASM(alpha float32, a []float32, rows, cols int, x []float32, beta float32, y []float32)
 
+//go:noescape
+func firstNonFiniteASM(x []float32) int
+
+//go:noescape
+func reluGradASM(dy, x []float32)
+
+//go:noescape
+func sigmoidGradASM(dy, x []float32)
+
+//go:noescape
+func tanhGradASM(dy, x []float32)
+
+//go:noescape
+func sqrPlusXGradASM(dy, x []float32)
+
 // useASM indicates whether to use assembly optimizations
 const useASM = true
 
@@ -110,6 +127,35 @@ func MatMulOptimized(a []float32, aRows, aCols int, b []float32, bRows, bCols in
 	return result
 }
 
+// matMulInto computes result = a·b like MatMulOptimized, into result
+// instead of a new slice
+func matMulInto(a []float32, aRows, aCols int, b []float32, bCols int, result []float32) {
+	matMulASM(a, aRows, aCols, b, bCols, result)
+}
+
+// gradSIMD runs the AVX2 loop of the elementwise gradient kernel op over
+// the leading whole blocks of 8 elements of dy and x, returning how many
+// elements it updated; the caller's scalar loop finishes the rest
+func gradSIMD(op byte, dy, x []float32) int {
+	n := len(dy) &^ 7
+	if n == 0 || len(x) < n {
+		return 0
+	}
+	switch op {
+	case OpReLUGrad:
+		reluGradASM(dy[:n], x[:n])
+	case OpSigmoidGrad:
+		sigmoidGradASM(dy[:n], x[:n])
+	case OpTanhGrad:
+		tanhGradASM(dy[:n], x[:n])
+	case OpSqrPlusXGrad:
+		sqrPlusXGradASM(dy[:n], x[:n])
+	default:
+		return 0
+	}
+	return n
+}
+
 // In-place operations for zero-allocation patterns
 
 // VectorAddInPlace performs in-place vector addition (a = a + b)
@@ -184,6 +230,20 @@ func GemvOptimized(alpha float32, a []float32, rows, cols int, x []float32, beta
 	}
 }
 
+// FirstNonFinite returns the index of the first NaN or Inf in x, or -1 when
+// every value is finite. Eight values are tested per AVX2 instruction.
+func FirstNonFinite(x []float32) int {
+	if useASM && len(x) > 0 {
+		return firstNonFiniteASM(x)
+	}
+	for i, v := range x {
+		if math.Float32bits(v)&expMask == expMask {
+			return i
+		}
+	}
+	return -1
+}
+
 // Zero-allocation kernel wrappers for Sublate operations
 
 // ApplyKernel applies an operation kernel directly to Sublate buffers
@@ -240,9 +240,9 @@ matMul_loop_i:
 
     XORQ SI, SI                   // SI = j (col index for B and result), 0 to N-1
 matMul_loop_j_avx:
-    MOVQ R12, BP                   // BP = N (bCols)
-    SUBQ SI, BP                   // BP = N - j (remaining columns in current row of result)
-    CMPQ BP, $8
+    MOVQ R12, R15                   // R15 = N (bCols)
+    SUBQ SI, R15                   // R15 = N - j (remaining columns in current row of result)
+    CMPQ R15, $8
     JL   matMul_loop_j_scalar_prologue // If < 8 columns left, handle scalar
 
     VXORPS Y0, Y0, Y0               // Y0 accumulates sums for result[i][j:j+7]
@@ -274,7 +274,7 @@ matMul_store_avx_results:
     JMP  matMul_loop_j_avx
 
 matMul_loop_j_scalar_prologue:
-    CMPQ BP, $0                    // BP = remaining columns for scalar part
+    CMPQ R15, $0                    // R15 = remaining columns for scalar part
     JE   matMul_next_i
 
 matMul_loop_j_scalar:
@@ -301,7 +301,7 @@ matMul_loop_k_scalar:
 matMul_store_scalar_result:
     VMOVSS X0, (DX)(SI*4)        // Store result[i][j]
     INCQ SI                        // j++
-    DECQ BP
+    DECQ R15
     JNZ  matMul_loop_j_scalar
 
 matMul_next_i:
@@ -479,3 +479,178 @@ gemv_N_is_zero_scalar_loop:
 gemv_done:
     VZEROUPPER
     RET
+
+// func firstNonFiniteASM(x []float32) int
+// Returns the index of the first NaN or Inf in x, or -1. A float32 is
+// non-finite exactly when all of its exponent bits are set.
+TEXT ·firstNonFiniteASM(SB), NOSPLIT, $0-32
+	MOVQ x_base+0(FP), AX
+	MOVQ x_len+8(FP), CX
+	XORQ BX, BX                 // BX = i
+
+	MOVL $0x7f800000, DX
+	MOVQ DX, X2
+	VPBROADCASTD X2, Y2         // Y2 = exponent mask in every lane
+
+finite_loop:
+	MOVQ CX, DX
+	SUBQ BX, DX
+	CMPQ DX, $8
+	JL finite_scalar
+
+	VMOVDQU (AX)(BX*4), Y0
+	VPAND Y2, Y0, Y0
+	VPCMPEQD Y2, Y0, Y0         // Lanes with every exponent bit set
+	VPTEST Y0, Y0
+	JNZ finite_scalar           // Locate the exact lane below
+	ADDQ $8, BX
+	JMP finite_loop
+
+finite_scalar:
+	CMPQ BX, CX
+	JGE finite_none
+	MOVL (AX)(BX*4), DX
+	ANDL $0x7f800000, DX
+	CMPL DX, $0x7f800000
+	JE finite_found
+	INCQ BX
+	JMP finite_scalar
+
+finite_found:
+	MOVQ BX, ret+24(FP)
+	VZEROUPPER
+	RET
+
+finite_none:
+	MOVQ $-1, ret+24(FP)
+	VZEROUPPER
+	RET
+
+// Elementwise gradient kernels. Each takes func(dy, x []float32), updates
+// dy in place from x and covers only the whole blocks of 8 elements; the
+// caller finishes the remainder with the scalar loop.
+
+// func reluGradASM(dy, x []float32)
+// dy = x > 0 ? dy : 0
+TEXT ·reluGradASM(SB), NOSPLIT, $0-48
+	MOVQ dy_base+0(FP), AX
+	MOVQ x_base+24(FP), BX
+	MOVQ dy_len+8(FP), CX
+	SHRQ $3, CX                 // CX = blocks of 8
+	JZ relu_grad_done
+
+	VXORPS Y7, Y7, Y7           // Y7 = 0
+
+relu_grad_loop:
+	VMOVUPS (BX), Y1
+	VCMPPS $0x1e, Y7, Y1, Y1    // Lanes where x > 0 (ordered), as a mask
+	VANDPS (AX), Y1, Y0
+	VMOVUPS Y0, (AX)
+
+	ADDQ $32, AX
+	ADDQ $32, BX
+	DECQ CX
+	JNZ relu_grad_loop
+
+relu_grad_done:
+	VZEROUPPER
+	RET
+
+// func sigmoidGradASM(dy, x []float32)
+// dy = dy / (1 + |x|)²
+TEXT ·sigmoidGradASM(SB), NOSPLIT, $0-48
+	MOVQ dy_base+0(FP), AX
+	MOVQ x_base+24(FP), BX
+	MOVQ dy_len+8(FP), CX
+	SHRQ $3, CX
+	JZ sigmoid_grad_done
+
+	MOVL $0x7fffffff, DX
+	MOVQ DX, X6
+	VPBROADCASTD X6, Y6         // Y6 = sign-clearing mask
+	MOVL $0x3f800000, DX
+	MOVQ DX, X5
+	VPBROADCASTD X5, Y5         // Y5 = 1.0
+
+sigmoid_grad_loop:
+	VANDPS (BX), Y6, Y1         // |x|
+	VADDPS Y5, Y1, Y1           // 1 + |x|
+	VMULPS Y1, Y1, Y1
+	VMOVUPS (AX), Y0
+	VDIVPS Y1, Y0, Y0
+	VMOVUPS Y0, (AX)
+
+	ADDQ $32, AX
+	ADDQ $32, BX
+	DECQ CX
+	JNZ sigmoid_grad_loop
+
+sigmoid_grad_done:
+	VZEROUPPER
+	RET
+
+// func tanhGradASM(dy, x []float32)
+// dy = dy · (x² - 9)² / (9(3 + x²)²)
+TEXT ·tanhGradASM(SB), NOSPLIT, $0-48
+	MOVQ dy_base+0(FP), AX
+	MOVQ x_base+24(FP), BX
+	MOVQ dy_len+8(FP), CX
+	SHRQ $3, CX
+	JZ tanh_grad_done
+
+	MOVL $0x41100000, DX
+	MOVQ DX, X4
+	VPBROADCASTD X4, Y4         // Y4 = 9.0
+	MOVL $0x40400000, DX
+	MOVQ DX, X3
+	VPBROADCASTD X3, Y3         // Y3 = 3.0
+
+tanh_grad_loop:
+	VMOVUPS (BX), Y1
+	VMULPS Y1, Y1, Y1           // x²
+	VSUBPS Y4, Y1, Y2           // x² - 9
+	VADDPS Y3, Y1, Y1           // 3 + x²
+	VMULPS Y2, Y2, Y2           // (x² - 9)²
+	VMULPS Y4, Y1, Y0           // 9(3 + x²)
+	VMULPS Y1, Y0, Y0           // 9(3 + x²)²
+	VDIVPS Y0, Y2, Y2
+	VMULPS (AX), Y2, Y2
+	VMOVUPS Y2, (AX)
+
+	ADDQ $32, AX
+	ADDQ $32, BX
+	DECQ CX
+	JNZ tanh_grad_loop
+
+tanh_grad_done:
+	VZEROUPPER
+	RET
+
+// func sqrPlusXGradASM(dy, x []float32)
+// dy = dy · (2x + 1)
+TEXT ·sqrPlusXGradASM(SB), NOSPLIT, $0-48
+	MOVQ dy_base+0(FP), AX
+	MOVQ x_base+24(FP), BX
+	MOVQ dy_len+8(FP), CX
+	SHRQ $3, CX
+	JZ sqrplusx_grad_done
+
+	MOVL $0x3f800000, DX
+	MOVQ DX, X5
+	VPBROADCASTD X5, Y5         // Y5 = 1.0
+
+sqrplusx_grad_loop:
+	VMOVUPS (BX), Y1
+	VADDPS Y1, Y1, Y1           // 2x
+	VADDPS Y5, Y1, Y1           // 2x + 1
+	VMULPS (AX), Y1, Y1
+	VMOVUPS Y1, (AX)
+
+	ADDQ $32, AX
+	ADDQ $32, BX
+	DECQ CX
+	JNZ sqrplusx_grad_loop
+
+sqrplusx_grad_done:
+	VZEROUPPER
+	RET
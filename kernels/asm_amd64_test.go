@@ -0,0 +1,185 @@
+package kernels
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestVectorAddASM(t *testing.T) {
+	sizes := []int{0, 1, 7, 8, 15, 16, 100}
+	for _, n := range sizes {
+		a := randomSlice(n)
+		b := randomSlice(n)
+		resultAsm := make([]float32, n)
+		resultGo := make([]float32, n)
+
+		vectorAddASM(a, b, resultAsm)
+		vectorAddGo(a, b, resultGo)
+
+		if !slicesEqual(resultAsm, resultGo, floatTolerance) {
+			t.Errorf("VectorAddASM failed for n=%d. ASM: %v, Go: %v", n, resultAsm, resultGo)
+		}
+	}
+}
+
+func TestVectorMulASM(t *testing.T) {
+	sizes := []int{0, 1, 7, 8, 15, 16, 100}
+	for _, n := range sizes {
+		a := randomSlice(n)
+		b := randomSlice(n)
+		resultAsm := make([]float32, n)
+		resultGo := make([]float32, n)
+
+		vectorMulASM(a, b, resultAsm)
+		vectorMulGo(a, b, resultGo)
+
+		if !slicesEqual(resultAsm, resultGo, floatTolerance) {
+			t.Errorf("VectorMulASM failed for n=%d. ASM: %v, Go: %v", n, resultAsm, resultGo)
+		}
+	}
+}
+
+func TestVectorDotASM(t *testing.T) {
+	sizes := []int{0, 1, 7, 8, 15, 16, 100}
+	for _, n := range sizes {
+		a := randomSlice(n)
+		b := randomSlice(n)
+
+		resultAsm := vectorDotASM(a, b)
+		resultGo := vectorDotGo(a, b)
+
+		if !floatsEqual(resultAsm, resultGo, floatTolerance*float32(n+1)) { // Tolerance might need to scale with n for dot products
+			t.Errorf("VectorDotASM failed for n=%d. ASM: %f, Go: %f", n, resultAsm, resultGo)
+		}
+	}
+}
+
+func TestAxpyASM(t *testing.T) {
+	sizes := []int{0, 1, 7, 8, 15, 16, 100}
+	alpha := rand.Float32()*2 - 1
+	for _, n := range sizes {
+		x := randomSlice(n)
+		yAsm := randomSlice(n)
+		yGo := make([]float32, n)
+		copy(yGo, yAsm)
+
+		axpyASM(alpha, x, yAsm)
+		axpyGo(alpha, x, yGo)
+
+		if !slicesEqual(yAsm, yGo, floatTolerance) {
+			t.Errorf("AxpyASM failed for n=%d, alpha=%f. ASM: %v, Go: %v", n, alpha, yAsm, yGo)
+		}
+	}
+}
+
+func TestMatMulASM(t *testing.T) {
+	testCases := []struct {
+		m, k, n int
+	}{
+		{1, 1, 1}, {2, 2, 2}, {3, 4, 5}, {8, 8, 8},
+		{7, 7, 7}, {10, 1, 10}, {10, 10, 1}, {16, 16, 16},
+		{15, 17, 13}, {0, 5, 5}, {5, 0, 5}, {5, 5, 0}, {0, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		if tc.m == 0 || tc.k == 0 || tc.n == 0 { // Handle zero dimensions
+			a := make([]float32, 0)
+			b := make([]float32, 0)
+			resultAsm := make([]float32, 0)
+			resultGo := make([]float32, 0)
+			if tc.m*tc.n > 0 {
+				resultAsm = make([]float32, tc.m*tc.n)
+				resultGo = make([]float32, tc.m*tc.n)
+			}
+			if tc.m*tc.k > 0 {
+				a = make([]float32, tc.m*tc.k)
+			}
+			if tc.k*tc.n > 0 {
+				b = make([]float32, tc.k*tc.n)
+			}
+
+			matMulASM(a, tc.m, tc.k, b, tc.n, resultAsm)
+			matMulGo(a, tc.m, tc.k, b, tc.n, resultGo)
+
+			if !slicesEqual(resultAsm, resultGo, floatTolerance) {
+				t.Errorf("MatMulASM failed for M=%d, K=%d, N=%d (zero case). ASM: %v, Go: %v", tc.m, tc.k, tc.n, resultAsm, resultGo)
+			}
+			continue
+		}
+
+		a := randomSlice(tc.m * tc.k)
+		b := randomSlice(tc.k * tc.n)
+		resultAsm := make([]float32, tc.m*tc.n)
+		resultGo := make([]float32, tc.m*tc.n)
+
+		matMulASM(a, tc.m, tc.k, b, tc.n, resultAsm)
+		matMulGo(a, tc.m, tc.k, b, tc.n, resultGo)
+
+		if !slicesEqual(resultAsm, resultGo, floatTolerance*float32(tc.k)) { // Tolerance might scale with K
+			t.Errorf("MatMulASM failed for M=%d, K=%d, N=%d. \nASM: %v\n Go: %v\nDiff: %v", tc.m, tc.k, tc.n, resultAsm, resultGo, diffSlices(resultAsm, resultGo))
+		}
+	}
+}
+
+func TestGemvASM(t *testing.T) {
+	testCases := []struct {
+		rows, cols int
+	}{
+		{1, 1}, {2, 2}, {8, 8}, {7, 7}, {10, 1}, {1, 10}, {16, 16},
+		{15, 17}, {0, 5}, {5, 0}, {0, 0},
+	}
+	alpha := rand.Float32()*2 - 1
+	beta := rand.Float32()*2 - 1
+
+	for _, tc := range testCases {
+		if tc.rows == 0 || tc.cols == 0 { // Handle zero dimensions
+			a := make([]float32, 0)
+			x := make([]float32, 0)
+			yAsm := make([]float32, 0)
+			yGo := make([]float32, 0)
+
+			if tc.rows*tc.cols > 0 {
+				a = make([]float32, tc.rows*tc.cols)
+			}
+			if tc.cols > 0 {
+				x = make([]float32, tc.cols)
+			}
+			if tc.rows > 0 {
+				yAsm = make([]float32, tc.rows)
+				yGo = make([]float32, tc.rows)
+			}
+
+			gemvASM(alpha, a, tc.rows, tc.cols, x, beta, yAsm)
+			gemvGo(alpha, a, tc.rows, tc.cols, x, beta, yGo)
+
+			if !slicesEqual(yAsm, yGo, floatTolerance) {
+				t.Errorf("GemvASM failed for rows=%d, cols=%d (zero case). ASM: %v, Go: %v", tc.rows, tc.cols, yAsm, yGo)
+			}
+			continue
+		}
+
+		a := randomSlice(tc.rows * tc.cols)
+		x := randomSlice(tc.cols)
+		yAsm := randomSlice(tc.rows)
+		yGo := make([]float32, tc.rows)
+		copy(yGo, yAsm)
+
+		gemvASM(alpha, a, tc.rows, tc.cols, x, beta, yAsm)
+		gemvGo(alpha, a, tc.rows, tc.cols, x, beta, yGo)
+
+		if !slicesEqual(yAsm, yGo, floatTolerance*float32(tc.cols+1)) { // Tolerance might scale with cols
+			t.Errorf("GemvASM failed for rows=%d, cols=%d. Alpha=%f, Beta=%f. \nASM: %v\n Go: %v\nDiff: %v", tc.rows, tc.cols, alpha, beta, yAsm, yGo, diffSlices(yAsm, yGo))
+		}
+	}
+}
+
+// Ensure assembly functions are declared for the linker
+// These are dummy calls, actual functions are in asm_amd64.s
+var (
+	_ = vectorAddASM
+	_ = vectorMulASM
+	_ = vectorDotASM
+	_ = axpyASM
+	_ = matMulASM
+	_ = gemvASM
+)
@@ -2,6 +2,8 @@
 
 package kernels
 
+import "math"
+
 // useASM indicates whether to use assembly optimizations (disabled for non-AMD64)
 const useASM = false
 
@@ -71,6 +73,26 @@ func MatMulOptimized(a []float32, aRows, aCols int, b []float32, bRows, bCols in
 	return result
 }
 
+// matMulInto computes result = a·b like MatMulOptimized, into result
+// instead of a new slice
+func matMulInto(a []float32, aRows, aCols int, b []float32, bCols int, result []float32) {
+	for i := 0; i < aRows; i++ {
+		for j := 0; j < bCols; j++ {
+			var sum float32
+			for k := 0; k < aCols; k++ {
+				sum += a[i*aCols+k] * b[k*bCols+j]
+			}
+			result[i*bCols+j] = sum
+		}
+	}
+}
+
+// gradSIMD has no vector loops to run without AVX2; the gradient kernels'
+// scalar loops cover every element
+func gradSIMD(op byte, dy, x []float32) int {
+	return 0
+}
+
 // VectorAddInPlace performs in-place vector addition
 func VectorAddInPlace(a, b []float32) {
 	if len(a) != len(b) {
@@ -92,3 +114,14 @@ func VectorMulInPlace(a, b []float32) {
 		a[i] *= b[i]
 	}
 }
+
+// FirstNonFinite returns the index of the first NaN or Inf in x, or -1 when
+// every value is finite.
+func FirstNonFinite(x []float32) int {
+	for i, v := range x {
+		if math.Float32bits(v)&expMask == expMask {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,7 +1,10 @@
 package kernels
 
 import (
+	"encoding/binary"
+	"math"
 	"math/rand"
+	"slices"
 	"testing"
 	"unsafe"
 )
@@ -321,3 +324,68 @@ func BenchmarkCacheEfficiency_Random_1MB(b *testing.B) {
 		_ = sum
 	}
 }
+
+// matMulBenchPayload lays out header, then A and B of random values, then
+// rest zero bytes
+func matMulBenchPayload(header []uint16, aLen, bLen, rest int) []byte {
+	data := make([]byte, 0, 2*len(header)+4*(aLen+bLen)+rest)
+	for _, h := range header {
+		data = binary.LittleEndian.AppendUint16(data, h)
+	}
+	for _, v := range generateRandomFloat32(aLen + bLen) {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v/100))
+	}
+	return append(data, make([]byte, rest)...)
+}
+
+// Benchmark the fused, quantized and tiled matmul kernels
+func BenchmarkMatMulBiasAct_64x64(b *testing.B) {
+	size := 64
+	data := matMulBenchPayload([]uint16{uint16(size), uint16(size), uint16(size), OpTanh}, size*size, size*size, 4*size*size)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matMulBiasAct(data)
+	}
+}
+
+func BenchmarkMatMulQ8_64x64(b *testing.B) {
+	size := 64
+	// The scales, then A and the bias as float32 and B as int8 codes
+	data := matMulBenchPayload([]uint16{uint16(size), uint16(size), uint16(size), OpTanh, 0, 0, 0, 0}, size*size, 0, 4*size*size+size*size)
+	binary.LittleEndian.PutUint32(data[12:], math.Float32bits(1.0/127))
+	for i := len(data) - size*size; i < len(data); i++ {
+		data[i] = byte(rand.Intn(255) - 127)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matMulQ8(data)
+	}
+}
+
+func BenchmarkMatMulTiled_128x128(b *testing.B) {
+	size := 128
+	data := matMulBenchPayload([]uint16{uint16(size), uint16(size), uint16(size), 32}, size*size, size*size, 4*size*size)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matMulTiled(data)
+	}
+}
+
+func BenchmarkConv1DBatchNorm_1K(b *testing.B) {
+	n, k := 1024, 9
+	data := matMulBenchPayload([]uint16{uint16(n), uint16(k)}, n, k, 0)
+	for _, v := range []float32{0, 1, 1, 0} { // mean, variance, gamma, beta
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+	data = binary.LittleEndian.AppendUint32(data, OpReLU)
+	input := slices.Clone(data)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(data, input) // The result overwrites the input
+		conv1DBatchNorm(data)
+	}
+}
@@ -0,0 +1,171 @@
+package kernels
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Fused kernel opcodes, emitted by the compiler's fusion pass in place of
+// the chains they compute
+const (
+	OpMatMulBiasAct   = 0x0D
+	OpConv1DBatchNorm = 0x0E
+)
+
+// conv1DBNTail is the size of the parameters conv1d_bn appends to the
+// conv1d payload: mean, variance, gamma, beta and the activation opcode
+const conv1DBNTail = 20
+
+func init() {
+	Catalog[OpMatMulBiasAct] = matMulBiasAct
+	Catalog[OpConv1DBatchNorm] = conv1DBatchNorm
+	opNames[OpMatMulBiasAct] = "matmul_bias_act"
+	opNames[OpConv1DBatchNorm] = "conv1d_bn"
+	infos[OpMatMulBiasAct] = KernelInfo{Shape: matMulBiasActShape, FLOPs: matMulBiasActFLOPs, Arity: 1, Layout: shapeLayout(matMulBiasActShape), Ports: matMulPorts(8, true),
+		Doc: "act(A·B + bias), fused matmul, add and activation. Layout: [rows(2)][cols(2)][b_cols(2)][act(2)][A][B][bias]; the result overwrites bias"}
+	infos[OpConv1DBatchNorm] = KernelInfo{Shape: conv1DBatchNormShape, FLOPs: conv1DBatchNormFLOPs, Arity: 1, Layout: conv1DBatchNormLayout, Ports: fixedPorts(4),
+		Doc: "conv1d, batchnorm and an activation fused. Layout: [input_len(2)][kernel_len(2)][input][kernel][mean][variance][gamma][beta][act(4)]; the result overwrites input"}
+}
+
+// Activation returns the kernel of an activation a fused kernel may apply,
+// relu, sigmoid or tanh; ok is false for any other opcode. Opcode 0 applies
+// none and returns a nil kernel.
+func Activation(opcode uint32) (fn KernelFn, ok bool) {
+	switch opcode {
+	case 0:
+		return nil, true
+	case OpReLU, OpSigmoid, OpTanh:
+		return Catalog[opcode], true
+	}
+	return nil, false
+}
+
+// matMulBiasAct computes act(A·B + bias), the fusion of matmul, add and an
+// activation. Layout: [rows(2)][cols(2)][b_cols(2)][act(2)][A][B][bias];
+// the result overwrites bias.
+func matMulBiasAct(data []byte) {
+	if len(data) < 8 {
+		return
+	}
+	rows := int(binary.LittleEndian.Uint16(data[0:]))
+	cols := int(binary.LittleEndian.Uint16(data[2:]))
+	bCols := int(binary.LittleEndian.Uint16(data[4:]))
+	act, ok := Activation(uint32(binary.LittleEndian.Uint16(data[6:])))
+	aEnd := 8 + 4*rows*cols
+	bEnd := aEnd + 4*cols*bCols
+	if !ok || len(data) < bEnd+4*rows*bCols {
+		return
+	}
+	a := float32s(data[8:], rows*cols)
+	b := float32s(data[aEnd:], cols*bCols)
+	out := float32s(data[bEnd:], rows*bCols)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < bCols; j++ {
+			sum := float32(0)
+			for k := 0; k < cols; k++ {
+				sum += a[i*cols+k] * b[k*bCols+j]
+			}
+			out[i*bCols+j] += sum
+		}
+	}
+	if act != nil {
+		act(data[bEnd : bEnd+4*rows*bCols])
+	}
+}
+
+// conv1DBatchNorm computes a conv1d followed by batchnorm and an
+// activation, with the same operations as the separate kernels. Layout: the
+// conv1d payload, [input_len(2)][kernel_len(2)][input][kernel], then
+// [mean][variance][gamma][beta][act(4)]; the result overwrites input.
+func conv1DBatchNorm(data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	n := int(binary.LittleEndian.Uint16(data[0:]))
+	k := int(binary.LittleEndian.Uint16(data[2:]))
+	end := 4 + 4*(n+k)
+	if k == 0 || k > n || len(data) < end+conv1DBNTail {
+		return
+	}
+	act, ok := Activation(binary.LittleEndian.Uint32(data[end+16:]))
+	if !ok {
+		return
+	}
+	convolution1D(data[:end])
+
+	param := func(i int) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(data[end+4*i:])) }
+	mean, variance, gamma, beta := param(0), param(1), param(2), param(3)
+	invStd := 1.0 / float32(math.Sqrt(float64(variance)+1e-5))
+	out := float32s(data[4:], n-k+1)
+	for i, val := range out {
+		normalized := (val - mean) * invStd
+		out[i] = gamma*normalized + beta
+	}
+	if act != nil {
+		act(data[4 : 4+4*len(out)])
+	}
+}
+
+// matMulBiasActShape reads the matmul_bias_act header; an input replaces
+// the A operand
+func matMulBiasActShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(payload) < 8 {
+		return nil, fmt.Errorf("missing matmul_bias_act header")
+	}
+	rows := int(binary.LittleEndian.Uint16(payload[0:]))
+	cols := int(binary.LittleEndian.Uint16(payload[2:]))
+	bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+	if act := binary.LittleEndian.Uint16(payload[6:]); !validActivation(uint32(act)) {
+		return nil, fmt.Errorf("matmul_bias_act has invalid activation %s", OpName(byte(act)))
+	}
+	if need := 8 + 4*(rows*cols+cols*bCols+rows*bCols); len(payload) < need {
+		return nil, fmt.Errorf("%dx%d by %dx%d matmul_bias_act needs %d payload bytes, segment has %d", rows, cols, cols, bCols, need, len(payload))
+	}
+	for _, s := range inputs {
+		if Elements(s) != rows*cols {
+			return nil, fmt.Errorf("input shape %v does not match the %dx%d left operand", s, rows, cols)
+		}
+	}
+	return []int{rows, bCols}, nil
+}
+
+// conv1DBatchNormShape is conv1DShape, checking the batchnorm parameters
+// follow the convolution operands
+func conv1DBatchNormShape(inputs [][]int, payload []byte) ([]int, error) {
+	shape, err := conv1DShape(inputs, payload)
+	if err != nil || shape == nil {
+		return shape, err
+	}
+	n := int(binary.LittleEndian.Uint16(payload[0:]))
+	k := int(binary.LittleEndian.Uint16(payload[2:]))
+	end := 4 + 4*(n+k)
+	if len(payload) < end+conv1DBNTail {
+		return nil, fmt.Errorf("conv1d_bn needs %d payload bytes, segment has %d", end+conv1DBNTail, len(payload))
+	}
+	if act := binary.LittleEndian.Uint32(payload[end+16:]); !validActivation(act) {
+		return nil, fmt.Errorf("conv1d_bn has invalid activation %d", act)
+	}
+	return shape, nil
+}
+
+// validActivation reports whether a fused kernel accepts the activation
+func validActivation(opcode uint32) bool {
+	_, ok := Activation(opcode)
+	return ok
+}
+
+// matMulBiasActFLOPs counts the matmul, the bias add and the activation
+func matMulBiasActFLOPs(_ [][]int, output []int, payload []byte) uint64 {
+	if len(payload) < 8 {
+		return 0
+	}
+	cols := uint64(binary.LittleEndian.Uint16(payload[2:]))
+	return (2*cols + 2) * uint64(Elements(output))
+}
+
+// conv1DBatchNormFLOPs counts the convolution, the normalization and the
+// activation
+func conv1DBatchNormFLOPs(inputs [][]int, output []int, payload []byte) uint64 {
+	return conv1DFLOPs(inputs, output, payload) + 5*uint64(Elements(output))
+}
@@ -0,0 +1,277 @@
+package kernels
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Gradient kernels for reverse-mode differentiation. Each turns the
+// gradient dy of a kernel's output into the gradient of its input, the
+// derivative taken of the kernel as implemented here, approximations
+// included. The elementwise ones take [dy][x], with x the kernel's input,
+// and overwrite dy; on amd64 they run 8 elements per AVX2 instruction.
+const (
+	OpReLUGrad     = 0x11
+	OpSigmoidGrad  = 0x12
+	OpTanhGrad     = 0x13
+	OpSqrPlusXGrad = 0x14
+	OpSoftmaxGrad  = 0x15
+	OpMatMulGrad   = 0x16
+	OpSumGrad      = 0x17
+	OpMaxGrad      = 0x18
+
+	// OpSoftmaxCrossEntropy is the loss of logits against a target
+	// distribution, whose gradient OpSoftmaxCrossEntropyGrad fuses the
+	// softmax into, avoiding the ill-conditioned softmax_grad of a log
+	OpSoftmaxCrossEntropy     = 0x19
+	OpSoftmaxCrossEntropyGrad = 0x1A
+)
+
+func init() {
+	grads := []struct {
+		op   byte
+		fn   KernelFn
+		name string
+		info KernelInfo
+	}{
+		{OpReLUGrad, reluGrad, "relu_grad", KernelInfo{FLOPs: perElement(1), Doc: "Gradient of relu, dy where x > 0. Layout: [dy][x]; the result overwrites dy"}},
+		{OpSigmoidGrad, sigmoidGrad, "sigmoid_grad", KernelInfo{FLOPs: perElement(4), Doc: "Gradient of sigmoid's x / (1 + |x|), dy / (1 + |x|)². Layout: [dy][x]; the result overwrites dy"}},
+		{OpTanhGrad, tanhGrad, "tanh_grad", KernelInfo{FLOPs: perElement(6), Doc: "Gradient of tanh's rational approximation, dy·(x² - 9)² / (9(3 + x²)²). Layout: [dy][x]; the result overwrites dy"}},
+		{OpSqrPlusXGrad, sqrPlusXGrad, "sqrplusx_grad", KernelInfo{FLOPs: perElement(3), Doc: "Gradient of x*x + x, dy·(2x + 1). Layout: [dy][x]; the result overwrites dy"}},
+		{OpSoftmaxGrad, softmaxGrad, "softmax_grad", KernelInfo{FLOPs: perElement(4), Doc: "Gradient of softmax from its output y, y·(dy - Σ dy·y). Layout: [dy][y]; the result overwrites dy"}},
+		{OpMatMulGrad, matMulGrad, "matmul_grad", KernelInfo{Doc: "Gradients of A·B, dA = dC·Bᵀ and dB = Aᵀ·dC. Layout: [rows(2)][cols(2)][b_cols(2)][A][B][dC][dA][dB][T], T scratch for max(rows·cols, cols·b_cols) floats; the results overwrite dA and dB"}},
+		{OpSumGrad, sumGrad, "sum_grad", KernelInfo{Doc: "Gradient of sum, dy for every element. Layout: [dy][x]; the result overwrites x"}},
+		{OpMaxGrad, maxGrad, "max_grad", KernelInfo{Doc: "Gradient of max, dy for the first largest element and 0 for the others. Layout: [dy][x]; the result overwrites x"}},
+		{OpSoftmaxCrossEntropy, softmaxCrossEntropy, "softmax_cross_entropy", KernelInfo{Shape: lossShape, FLOPs: perInput(4), Arity: 2,
+			Doc: "Cross entropy of softmax(z) against the target distribution t, -Σ t·log softmax(z), stored in the first element. Layout: [z][t] of equal length"}},
+		{OpSoftmaxCrossEntropyGrad, softmaxCrossEntropyGrad, "softmax_cross_entropy_grad", KernelInfo{
+			Doc: "Gradients of softmax_cross_entropy, dz = dy·(softmax(z)·Σt - t) and dt = -dy·log softmax(z). Layout: [dy][z][t]; the results overwrite z and t"}},
+	}
+	for _, g := range grads {
+		Catalog[g.op] = g.fn
+		opNames[g.op] = g.name
+		infos[g.op] = g.info
+	}
+}
+
+// Gradient returns the gradient kernel of the kernel for opcode; ok is
+// false for kernels without one. Noop, add and mul pass or scale dy with
+// existing kernels and have none.
+func Gradient(opcode byte) (grad byte, ok bool) {
+	switch opcode {
+	case OpReLU:
+		return OpReLUGrad, true
+	case OpSigmoid:
+		return OpSigmoidGrad, true
+	case OpTanh:
+		return OpTanhGrad, true
+	case OpSqrPlusX:
+		return OpSqrPlusXGrad, true
+	case OpSoftmax:
+		return OpSoftmaxGrad, true
+	case OpMatMul:
+		return OpMatMulGrad, true
+	case OpSum:
+		return OpSumGrad, true
+	case OpMax:
+		return OpMaxGrad, true
+	case OpSoftmaxCrossEntropy:
+		return OpSoftmaxCrossEntropyGrad, true
+	}
+	return 0, false
+}
+
+// halves views the [dy][x] halves of an elementwise gradient payload
+func halves(data []byte) (dy, x []float32) {
+	n := len(data) / 8
+	return float32s(data, n), float32s(data[4*n:], n)
+}
+
+// lossShape reduces two equally shaped operands to a scalar loss
+func lossShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(inputs) > 0 {
+		if _, err := sameShape(inputs); err != nil {
+			return nil, err
+		}
+	} else if len(payload) < 8 {
+		return nil, nil
+	}
+	return []int{1}, nil
+}
+
+// perInput counts ops operations per element of the first operand, read
+// from the payload when the node has no inputs
+func perInput(ops uint64) FLOPsFn {
+	return func(inputs [][]int, _ []int, payload []byte) uint64 {
+		if len(inputs) == 0 {
+			return ops * uint64(len(payload)/8)
+		}
+		return ops * uint64(Elements(inputs[0]))
+	}
+}
+
+func reluGrad(data []byte) {
+	dy, x := halves(data)
+	for i := gradSIMD(OpReLUGrad, dy, x); i < len(dy); i++ {
+		if !(x[i] > 0) {
+			dy[i] = 0
+		}
+	}
+}
+
+func sigmoidGrad(data []byte) {
+	dy, x := halves(data)
+	for i := gradSIMD(OpSigmoidGrad, dy, x); i < len(dy); i++ {
+		d := 1 + x[i]
+		if x[i] < 0 {
+			d = 1 - x[i]
+		}
+		dy[i] /= d * d
+	}
+}
+
+func tanhGrad(data []byte) {
+	dy, x := halves(data)
+	for i := gradSIMD(OpTanhGrad, dy, x); i < len(dy); i++ {
+		x2 := x[i] * x[i]
+		num := x2 - 9
+		den := 3 + x2
+		dy[i] *= num * num / (9 * den * den)
+	}
+}
+
+func sqrPlusXGrad(data []byte) {
+	dy, x := halves(data)
+	for i := gradSIMD(OpSqrPlusXGrad, dy, x); i < len(dy); i++ {
+		dy[i] *= 2*x[i] + 1
+	}
+}
+
+func softmaxGrad(data []byte) {
+	dy, y := halves(data)
+	var dot float32
+	for i := range dy {
+		dot += dy[i] * y[i]
+	}
+	for i := range dy {
+		dy[i] = y[i] * (dy[i] - dot)
+	}
+}
+
+// MatMulGradSize returns the bytes of a matmul_grad payload for A of rows
+// x cols and B of cols x bCols, header and scratch included
+func MatMulGradSize(rows, cols, bCols int) int {
+	aLen, bLen := rows*cols, cols*bCols
+	return 6 + 4*(2*aLen+2*bLen+rows*bCols+max(aLen, bLen))
+}
+
+// matMulGrad computes the gradients of C = A·B for A of rows x cols and B
+// of cols x b_cols from dC, leaving A, B and dC unchanged. Both products
+// run on the matmul of MatMulOptimized, over operands transposed into the
+// scratch T.
+func matMulGrad(data []byte) {
+	if len(data) < 6 {
+		return
+	}
+	rows := int(binary.LittleEndian.Uint16(data[0:]))
+	cols := int(binary.LittleEndian.Uint16(data[2:]))
+	bCols := int(binary.LittleEndian.Uint16(data[4:]))
+	aLen, bLen, cLen := rows*cols, cols*bCols, rows*bCols
+	if len(data) < MatMulGradSize(rows, cols, bCols) || aLen == 0 || bLen == 0 {
+		return
+	}
+	f := float32s(data[6:], 2*aLen+2*bLen+cLen+max(aLen, bLen))
+	a, b := f[:aLen], f[aLen:aLen+bLen]
+	dc := f[aLen+bLen : aLen+bLen+cLen]
+	da := f[aLen+bLen+cLen : 2*aLen+bLen+cLen]
+	db := f[2*aLen+bLen+cLen : 2*aLen+2*bLen+cLen]
+	t := f[2*aLen+2*bLen+cLen:]
+
+	transpose(b, cols, bCols, t)
+	matMulInto(dc, rows, bCols, t, cols, da)
+	transpose(a, rows, cols, t)
+	matMulInto(t, cols, rows, dc, bCols, db)
+}
+
+// transpose writes the transpose of the rows x cols matrix m to dst
+func transpose(m []float32, rows, cols int, dst []float32) {
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			dst[j*rows+i] = m[i*cols+j]
+		}
+	}
+}
+
+func sumGrad(data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	x := float32s(data[4:], len(data)/4-1)
+	dy := float32s(data, 1)[0]
+	for i := range x {
+		x[i] = dy
+	}
+}
+
+func maxGrad(data []byte) {
+	if len(data) < 8 {
+		return
+	}
+	x := float32s(data[4:], len(data)/4-1)
+	dy := float32s(data, 1)[0]
+	arg := 0
+	for i, v := range x {
+		if v > x[arg] {
+			arg = i
+		}
+	}
+	clear(x)
+	x[arg] = dy
+}
+
+// logSoftmaxNorm returns the maximum of z and log Σ e^(z - max), so that
+// log softmax(z)_i = z_i - max - norm
+func logSoftmaxNorm(z []float32) (zMax, norm float32) {
+	zMax = float32(math.Inf(-1))
+	for _, v := range z {
+		zMax = max(zMax, v)
+	}
+	var sum float64
+	for _, v := range z {
+		sum += math.Exp(float64(v - zMax))
+	}
+	return zMax, float32(math.Log(sum))
+}
+
+func softmaxCrossEntropy(data []byte) {
+	n := len(data) / 8
+	if n == 0 {
+		return
+	}
+	z, t := float32s(data, n), float32s(data[4*n:], n)
+	zMax, norm := logSoftmaxNorm(z)
+	var loss float32
+	for i := range z {
+		loss -= t[i] * (z[i] - zMax - norm)
+	}
+	z[0] = loss
+}
+
+func softmaxCrossEntropyGrad(data []byte) {
+	n := (len(data) - 4) / 8
+	if n <= 0 {
+		return
+	}
+	dy := float32s(data, 1)[0]
+	z, t := float32s(data[4:], n), float32s(data[4+4*n:], n)
+	zMax, norm := logSoftmaxNorm(z)
+	var total float32
+	for _, v := range t {
+		total += v
+	}
+	for i := range z {
+		logP := z[i] - zMax - norm
+		z[i] = dy * (float32(math.Exp(float64(logP)))*total - t[i])
+		t[i] = -dy * logP
+	}
+}
@@ -0,0 +1,208 @@
+package kernels
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+)
+
+func encodeFloats(v ...float32) []byte {
+	data := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(f))
+	}
+	return data
+}
+
+// TestElementwiseGradients checks every elementwise gradient kernel against
+// a central difference of its kernel
+func TestElementwiseGradients(t *testing.T) {
+	x := []float32{-2.5, -0.7, 0.3, 1.9}
+	for op := range map[byte]bool{OpReLU: true, OpSigmoid: true, OpTanh: true, OpSqrPlusX: true} {
+		grad, ok := Gradient(op)
+		if !ok {
+			t.Fatalf("%s has no gradient", OpName(op))
+		}
+		data := encodeFloats(append([]float32{1, 1, 1, 1}, x...)...)
+		Catalog[grad](data)
+		got := float32s(data, 4)
+		for i, v := range x {
+			const eps = 1e-3
+			up, down := encodeFloats(v+eps), encodeFloats(v-eps)
+			Catalog[op](up)
+			Catalog[op](down)
+			want := (float32s(up, 1)[0] - float32s(down, 1)[0]) / (2 * eps)
+			if !floatsEqual(got[i], want, 1e-2) {
+				t.Errorf("%s at %v: got %v, central difference %v", OpName(grad), v, got[i], want)
+			}
+		}
+	}
+}
+
+// TestGradientSIMD checks the vector loops against the scalar ones on a
+// length with a remainder
+func TestGradientSIMD(t *testing.T) {
+	for _, op := range []byte{OpReLUGrad, OpSigmoidGrad, OpTanhGrad, OpSqrPlusXGrad} {
+		dy, x := randomSlice(19), randomSlice(19)
+		x[3] = 0
+		data := encodeFloats(append(slices.Clone(dy), x...)...)
+		Catalog[op](data)
+
+		// Every element through the scalar loop
+		want := encodeFloats(append(slices.Clone(dy), x...)...)
+		for i := range dy {
+			one := encodeFloats(dy[i], x[i])
+			Catalog[op](one)
+			copy(want[4*i:], one[:4])
+		}
+		if !slices.Equal(data, want) {
+			t.Errorf("%s: got %v, want %v", OpName(op), float32s(data, 19), float32s(want, 19))
+		}
+	}
+}
+
+func TestMatMulGradLarge(t *testing.T) {
+	// Large enough for the AVX2 loops, against the definitions
+	rows, cols, bCols := 9, 11, 13
+	a, b, dc := randomSlice(rows*cols), randomSlice(cols*bCols), randomSlice(rows*bCols)
+	data := make([]byte, 6, MatMulGradSize(rows, cols, bCols))
+	binary.LittleEndian.PutUint16(data[0:], uint16(rows))
+	binary.LittleEndian.PutUint16(data[2:], uint16(cols))
+	binary.LittleEndian.PutUint16(data[4:], uint16(bCols))
+	data = append(data, encodeFloats(slices.Concat(a, b, dc)...)...)
+	data = data[:MatMulGradSize(rows, cols, bCols)]
+	matMulGrad(data)
+	f := float32s(data[6:], len(a)+len(b)+len(dc)+len(a)+len(b))
+	da, db := f[len(a)+len(b)+len(dc):2*len(a)+len(b)+len(dc)], f[2*len(a)+len(b)+len(dc):]
+	for i := 0; i < rows; i++ {
+		for k := 0; k < cols; k++ {
+			var want float32
+			for j := 0; j < bCols; j++ {
+				want += dc[i*bCols+j] * b[k*bCols+j]
+			}
+			if !floatsEqual(da[i*cols+k], want, 1e-4) {
+				t.Fatalf("dA[%d][%d] = %v, want %v", i, k, da[i*cols+k], want)
+			}
+		}
+	}
+	for k := 0; k < cols; k++ {
+		for j := 0; j < bCols; j++ {
+			var want float32
+			for i := 0; i < rows; i++ {
+				want += a[i*cols+k] * dc[i*bCols+j]
+			}
+			if !floatsEqual(db[k*bCols+j], want, 1e-4) {
+				t.Fatalf("dB[%d][%d] = %v, want %v", k, j, db[k*bCols+j], want)
+			}
+		}
+	}
+}
+
+func TestSoftmaxCrossEntropy(t *testing.T) {
+	z, target := []float32{1, 2, 0.5}, []float32{0, 1, 0}
+	data := encodeFloats(append(slices.Clone(z), target...)...)
+	softmaxCrossEntropy(data)
+	norm := math.Log(math.Exp(1) + math.Exp(2) + math.Exp(0.5))
+	if loss := float32s(data, 1)[0]; !floatsEqual(loss, float32(norm-2), 1e-5) {
+		t.Errorf("got loss %v, want %v", loss, norm-2)
+	}
+
+	grad := encodeFloats(append([]float32{2}, append(slices.Clone(z), target...)...)...)
+	softmaxCrossEntropyGrad(grad)
+	dz := float32s(grad[4:], 3)
+	for i := range z {
+		// dy·(softmax(z) - t) for a one-hot target
+		want := 2 * (float32(math.Exp(float64(z[i])-norm)) - target[i])
+		if !floatsEqual(dz[i], want, 1e-5) {
+			t.Errorf("dz[%d] = %v, want %v", i, dz[i], want)
+		}
+	}
+}
+
+func TestSoftmaxGrad(t *testing.T) {
+	// With dy one-hot at 0, dx_i = y_0·(δ_i0 - y_i)
+	y := []float32{0.5, 0.3, 0.2}
+	data := encodeFloats(1, 0, 0, y[0], y[1], y[2])
+	softmaxGrad(data)
+	if want := []float32{0.25, -0.15, -0.1}; !slicesEqual(float32s(data, 3), want, floatTolerance) {
+		t.Errorf("got %v, want %v", float32s(data, 3), want)
+	}
+}
+
+func TestMatMulGrad(t *testing.T) {
+	// A 1x2, B 2x2, dC 1x2, then dA, dB and the scratch
+	data := make([]byte, 6, MatMulGradSize(1, 2, 2))
+	binary.LittleEndian.PutUint16(data[0:], 1)
+	binary.LittleEndian.PutUint16(data[2:], 2)
+	binary.LittleEndian.PutUint16(data[4:], 2)
+	data = append(data, encodeFloats(1, 2, 3, 4, 5, 6, 1, -1, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9)...)
+	matMulGrad(data)
+	f := float32s(data[6:], 14)
+	if da, want := f[8:10], []float32{-1, -1}; !slicesEqual(da, want, floatTolerance) {
+		t.Errorf("got dA %v, want %v", da, want)
+	}
+	if db, want := f[10:], []float32{1, -1, 2, -2}; !slicesEqual(db, want, floatTolerance) {
+		t.Errorf("got dB %v, want %v", db, want)
+	}
+}
+
+func TestReduceGradients(t *testing.T) {
+	data := encodeFloats(2, 1, 5, 5, 3)
+	sumGrad(data)
+	if want := []float32{2, 2, 2, 2}; !slicesEqual(float32s(data[4:], 4), want, floatTolerance) {
+		t.Errorf("sum_grad got %v, want %v", float32s(data[4:], 4), want)
+	}
+	data = encodeFloats(2, 1, 5, 5, 3)
+	maxGrad(data)
+	if want := []float32{0, 2, 0, 0}; !slicesEqual(float32s(data[4:], 4), want, floatTolerance) {
+		t.Errorf("max_grad got %v, want %v", float32s(data[4:], 4), want)
+	}
+}
+
+// BenchmarkGradients runs each elementwise gradient kernel on dy and x of
+// 1024 elements
+func BenchmarkGradients(b *testing.B) {
+	for _, op := range []byte{OpReLUGrad, OpSigmoidGrad, OpTanhGrad, OpSqrPlusXGrad, OpSoftmaxGrad} {
+		data := encodeFloats(append(randomSlice(1024), randomSlice(1024)...)...)
+		b.Run(OpName(op), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				Catalog[op](data)
+			}
+		})
+	}
+}
+
+func BenchmarkMatMulGrad_64x64(b *testing.B) {
+	size := 64
+	data := make([]byte, 6, MatMulGradSize(size, size, size))
+	binary.LittleEndian.PutUint16(data[0:], uint16(size))
+	binary.LittleEndian.PutUint16(data[2:], uint16(size))
+	binary.LittleEndian.PutUint16(data[4:], uint16(size))
+	data = append(data, encodeFloats(randomSlice(3*size*size)...)...)
+	data = data[:MatMulGradSize(size, size, size)]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matMulGrad(data)
+	}
+}
+
+func BenchmarkSoftmaxCrossEntropy_1K(b *testing.B) {
+	target := make([]float32, 1024)
+	target[7] = 1
+	z := randomSlice(1024)
+	b.Run("loss", func(b *testing.B) {
+		data := encodeFloats(append(slices.Clone(z), target...)...)
+		for i := 0; i < b.N; i++ {
+			softmaxCrossEntropy(data)
+		}
+	})
+	b.Run("grad", func(b *testing.B) {
+		data := encodeFloats(append(append([]float32{1}, z...), target...)...)
+		for i := 0; i < b.N; i++ {
+			softmaxCrossEntropyGrad(data)
+		}
+	})
+}
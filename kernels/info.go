@@ -0,0 +1,210 @@
+package kernels
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// ShapeFn computes the output shape of a kernel, in float32 elements, from
+// the shapes of the tensors a node consumes and the node's payload segment.
+// It fails when they are incompatible and returns a nil shape when they do
+// not determine the output.
+type ShapeFn func(inputs [][]int, payload []byte) ([]int, error)
+
+// FLOPsFn estimates the floating-point operations of one kernel call from
+// the shapes a node consumes and produces and its payload segment
+type FLOPsFn func(inputs [][]int, output []int, payload []byte) uint64
+
+// KernelInfo describes a kernel to compile-time passes
+type KernelInfo struct {
+	Name   string
+	Shape  ShapeFn
+	FLOPs  FLOPsFn  // nil for kernels that do no arithmetic
+	Arity  int      // Inputs a node consuming other nodes takes; 0 for any number
+	Layout LayoutFn // nil for kernels that read no payload header
+	Ports  PortsFn  // nil for kernels reading operands from and writing the output to the buffer start
+	Doc    string   // What the kernel computes and its payload layout, for tools
+}
+
+// infos maps opcodes to their metadata; opcodes without Shape are opaque
+var infos = [256]KernelInfo{
+	OpNoop:      {Shape: elementwiseShape, Doc: "Leaves its payload unchanged; declares inputs and buffers"},
+	OpSqrPlusX:  {Shape: elementwiseShape, FLOPs: perElement(2), Arity: 1, Doc: "x*x + x on each float32 element"},
+	OpMatMul:    {Shape: matMulShape, FLOPs: matMulFLOPs, Layout: matMulLayout, Ports: matMulPorts(6, false), Doc: "A·B for float32 matrices. Layout: [rows(2)][cols(2)][b_cols(2)][A][B]; the result overwrites B"},
+	OpReLU:      {Shape: elementwiseShape, FLOPs: perElement(1), Arity: 1, Doc: "max(0, x) on each float32 element"},
+	OpSigmoid:   {Shape: elementwiseShape, FLOPs: perElement(4), Arity: 1, Doc: "1 / (1 + e^-x) on each float32 element"},
+	OpTanh:      {Shape: elementwiseShape, FLOPs: perElement(4), Arity: 1, Doc: "Hyperbolic tangent of each float32 element"},
+	OpAdd:       {Shape: binaryShape, FLOPs: perElement(1), Arity: 2, Doc: "Element-wise a + b. Layout: [a][b] of equal length; the result overwrites a"},
+	OpMul:       {Shape: binaryShape, FLOPs: perElement(1), Arity: 2, Doc: "Element-wise a * b. Layout: [a][b] of equal length; the result overwrites a"},
+	OpSum:       {Shape: reduceShape, FLOPs: reduceFLOPs, Doc: "Sum of all float32 elements, stored in the first"},
+	OpMax:       {Shape: reduceShape, FLOPs: reduceFLOPs, Doc: "Largest float32 element, stored in the first"},
+	OpSoftmax:   {Shape: elementwiseShape, FLOPs: perElement(4), Arity: 1, Doc: "Numerically stable softmax over all float32 elements"},
+	OpConv1D:    {Shape: conv1DShape, FLOPs: conv1DFLOPs, Arity: 1, Layout: conv1DLayout, Ports: fixedPorts(4), Doc: "1D convolution. Layout: [input_len(2)][kernel_len(2)][input][kernel]; the result overwrites input"},
+	OpBatchNorm: {Shape: batchNormShape, FLOPs: perElement(4), Arity: 1, Layout: batchNormLayout, Ports: fixedPorts(18), Doc: "Batch normalization, gamma·(x - mean)/sqrt(variance) + beta. Layout: [count(2)][mean][variance][gamma][beta][input]"},
+}
+
+// Info returns the metadata of the kernel for opcode; ok is false when the
+// opcode has no kernel
+func Info(opcode byte) (info KernelInfo, ok bool) {
+	if Catalog[opcode] == nil {
+		return KernelInfo{}, false
+	}
+	info = infos[opcode]
+	info.Name = OpName(opcode)
+	return info, true
+}
+
+// Elements returns the number of elements of a shape
+func Elements(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+// sameShape returns the shape shared by all inputs
+func sameShape(inputs [][]int) ([]int, error) {
+	for _, s := range inputs[1:] {
+		if !slices.Equal(s, inputs[0]) {
+			return nil, fmt.Errorf("input shapes %v and %v differ", inputs[0], s)
+		}
+	}
+	return inputs[0], nil
+}
+
+// elementwiseShape keeps the input shape, or with no inputs the shape of
+// the float32 vector in the payload
+func elementwiseShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(inputs) > 0 {
+		return sameShape(inputs)
+	}
+	if len(payload) < 4 {
+		return nil, nil
+	}
+	return []int{len(payload) / 4}, nil
+}
+
+// binaryShape combines equally shaped operands; with no inputs the payload
+// holds both operands back to back
+func binaryShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(inputs) > 0 {
+		return sameShape(inputs)
+	}
+	if len(payload) < 8 {
+		return nil, nil
+	}
+	return []int{len(payload) / 8}, nil
+}
+
+// reduceShape reduces any input to a single element
+func reduceShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(inputs) == 0 && len(payload) < 4 {
+		return nil, nil
+	}
+	return []int{1}, nil
+}
+
+// matMulShape reads the [rows][cols][b_cols] uint16 header of the payload,
+// or multiplies two inputs of shapes [m, k] and [k, n]
+func matMulShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(payload) >= 6 {
+		rows := int(binary.LittleEndian.Uint16(payload[0:]))
+		cols := int(binary.LittleEndian.Uint16(payload[2:]))
+		bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+		if need := 6 + 4*(rows*cols+cols*bCols); len(payload) < need {
+			return nil, fmt.Errorf("%dx%d by %dx%d matmul needs %d payload bytes, segment has %d", rows, cols, cols, bCols, need, len(payload))
+		}
+		for _, s := range inputs {
+			if Elements(s) != rows*cols {
+				return nil, fmt.Errorf("input shape %v does not match the %dx%d left operand", s, rows, cols)
+			}
+		}
+		return []int{rows, bCols}, nil
+	}
+	if len(inputs) != 2 {
+		return nil, nil
+	}
+	a, b := inputs[0], inputs[1]
+	if len(a) != 2 || len(b) != 2 || a[1] != b[0] {
+		return nil, fmt.Errorf("cannot multiply shapes %v and %v", a, b)
+	}
+	return []int{a[0], b[1]}, nil
+}
+
+// conv1DShape reads the [input_len][kernel_len] uint16 header of the
+// payload; the valid convolution has input_len-kernel_len+1 outputs
+func conv1DShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(payload) < 4 {
+		return nil, nil
+	}
+	n := int(binary.LittleEndian.Uint16(payload[0:]))
+	k := int(binary.LittleEndian.Uint16(payload[2:]))
+	if k == 0 || k > n {
+		return nil, fmt.Errorf("conv1d kernel length %d does not fit input length %d", k, n)
+	}
+	for _, s := range inputs {
+		if Elements(s) != n {
+			return nil, fmt.Errorf("input shape %v does not match conv1d input length %d", s, n)
+		}
+	}
+	return []int{n - k + 1}, nil
+}
+
+// batchNormShape reads the uint16 element count of the payload header
+func batchNormShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(payload) < 2 {
+		return elementwiseShape(inputs, nil)
+	}
+	n := int(binary.LittleEndian.Uint16(payload[0:]))
+	for _, s := range inputs {
+		if Elements(s) != n {
+			return nil, fmt.Errorf("input shape %v does not match batchnorm count %d", s, n)
+		}
+	}
+	return []int{n}, nil
+}
+
+// perElement counts ops operations per output element
+func perElement(ops uint64) FLOPsFn {
+	return func(_ [][]int, output []int, _ []byte) uint64 {
+		return ops * uint64(Elements(output))
+	}
+}
+
+// reduceFLOPs counts one operation per element consumed, read from the
+// payload when the node has no inputs
+func reduceFLOPs(inputs [][]int, _ []int, payload []byte) uint64 {
+	if len(inputs) == 0 {
+		return uint64(len(payload) / 4)
+	}
+	var n uint64
+	for _, s := range inputs {
+		n += uint64(Elements(s))
+	}
+	return n
+}
+
+// matMulFLOPs counts a multiply and an add per term of each output element
+func matMulFLOPs(inputs [][]int, output []int, payload []byte) uint64 {
+	if len(payload) >= 6 {
+		rows := uint64(binary.LittleEndian.Uint16(payload[0:]))
+		cols := uint64(binary.LittleEndian.Uint16(payload[2:]))
+		bCols := uint64(binary.LittleEndian.Uint16(payload[4:]))
+		return 2 * rows * cols * bCols
+	}
+	if len(inputs) == 0 || len(inputs[0]) != 2 {
+		return 0
+	}
+	return 2 * uint64(Elements(output)) * uint64(inputs[0][1])
+}
+
+// conv1DFLOPs counts a multiply and an add per kernel tap of each output
+func conv1DFLOPs(_ [][]int, output []int, payload []byte) uint64 {
+	if len(payload) < 4 {
+		return 0
+	}
+	k := uint64(binary.LittleEndian.Uint16(payload[2:]))
+	return 2 * k * uint64(Elements(output))
+}
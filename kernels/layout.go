@@ -0,0 +1,122 @@
+package kernels
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LayoutFn checks that a node's payload segment holds the header and
+// operands the kernel reads. Kernels return without computing anything on
+// a payload that does not, so compilers check layouts up front.
+type LayoutFn func(payload []byte) error
+
+// shapeLayout checks a payload with a shape function that validates the
+// whole payload when given no inputs
+func shapeLayout(shape ShapeFn) LayoutFn {
+	return func(payload []byte) error {
+		_, err := shape(nil, payload)
+		return err
+	}
+}
+
+// matMulLayout checks the [rows][cols][b_cols] header and that the payload
+// holds A, and B or the result it overwrites B with, whichever is larger
+func matMulLayout(payload []byte) error {
+	if len(payload) < 6 {
+		return fmt.Errorf("matmul needs a [rows][cols][b_cols] uint16 header, payload has %d bytes", len(payload))
+	}
+	rows := int(binary.LittleEndian.Uint16(payload[0:]))
+	cols := int(binary.LittleEndian.Uint16(payload[2:]))
+	bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+	if rows*cols*bCols == 0 {
+		return fmt.Errorf("matmul header has a zero dimension: %dx%d by %dx%d", rows, cols, cols, bCols)
+	}
+	a, b := 4*rows*cols, 4*max(cols, rows)*bCols
+	if need := 6 + a + b; len(payload) < need {
+		return fmt.Errorf("%dx%d by %dx%d matmul needs %d payload bytes (6 header, %d A, %d B and result), segment has %d",
+			rows, cols, cols, bCols, need, a, b, len(payload))
+	}
+	return nil
+}
+
+// conv1DLayout checks the [input_len][kernel_len] header and that the
+// payload holds the input and the kernel
+func conv1DLayout(payload []byte) error {
+	if len(payload) < 4 {
+		return fmt.Errorf("conv1d needs an [input_len][kernel_len] uint16 header, payload has %d bytes", len(payload))
+	}
+	if _, err := conv1DShape(nil, payload); err != nil {
+		return err
+	}
+	n := int(binary.LittleEndian.Uint16(payload[0:]))
+	k := int(binary.LittleEndian.Uint16(payload[2:]))
+	if need := 4 + 4*(n+k); len(payload) < need {
+		return fmt.Errorf("conv1d of %d inputs by %d taps needs %d payload bytes (4 header, %d input, %d kernel), segment has %d",
+			n, k, need, 4*n, 4*k, len(payload))
+	}
+	return nil
+}
+
+// conv1DBatchNormLayout checks the conv1d operands, then the parameters
+// following them
+func conv1DBatchNormLayout(payload []byte) error {
+	if err := conv1DLayout(payload); err != nil {
+		return err
+	}
+	_, err := conv1DBatchNormShape(nil, payload)
+	return err
+}
+
+// batchNormLayout checks the [count][mean][variance][gamma][beta] header
+// and that the payload holds count inputs
+func batchNormLayout(payload []byte) error {
+	if len(payload) < 18 {
+		return fmt.Errorf("batchnorm needs an 18-byte header, count uint16 then mean, variance, gamma and beta float32, payload has %d bytes", len(payload))
+	}
+	n := int(binary.LittleEndian.Uint16(payload[0:]))
+	if need := 18 + 4*n; len(payload) < need {
+		return fmt.Errorf("batchnorm of %d inputs needs %d payload bytes (18 header, %d input), segment has %d", n, need, 4*n, len(payload))
+	}
+	return nil
+}
+
+// PortsFn returns where a kernel reads the outputs of the nodes a node
+// consumes and where it leaves its own output, as offsets into the node's
+// buffer, which starts as its payload segment. The outputs are packed back
+// to back from operands, after any header and in place of the operand they
+// replace.
+type PortsFn func(payload []byte) (operands, output int)
+
+// Ports returns the operand and output offsets of the kernel for opcode in
+// a buffer starting with payload: 0 and 0 for kernels without a header
+func Ports(opcode byte, payload []byte) (operands, output int) {
+	if ports := infos[opcode].Ports; ports != nil {
+		return ports(payload)
+	}
+	return 0, 0
+}
+
+// fixedPorts reads the operand at the end of a header of size bytes and
+// writes the result over it
+func fixedPorts(size int) PortsFn {
+	return func([]byte) (int, int) { return size, size }
+}
+
+// matMulPorts reads A after a header of size bytes starting with
+// [rows][cols][b_cols]. Its result follows A, then B when the kernel keeps
+// B, so a result after A is one overwriting B.
+func matMulPorts(size int, keepsB bool) PortsFn {
+	return func(payload []byte) (int, int) {
+		if len(payload) < size {
+			return 0, 0
+		}
+		rows := int(binary.LittleEndian.Uint16(payload[0:]))
+		cols := int(binary.LittleEndian.Uint16(payload[2:]))
+		bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+		output := size + 4*rows*cols
+		if keepsB {
+			output += 4 * cols * bCols
+		}
+		return size, output
+	}
+}
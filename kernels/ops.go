@@ -7,7 +7,7 @@
 // Architecture support:
 //   - AMD64: Hand-tuned AVX2/AVX-512 assembly implementations
 //   - ARM64: NEON vectorized operations
-//   - Fallback: Pure Go implementations for portability
+//   - Fallback: Pure Go implementations for portability, including WebAssembly
 //
 // Available operations:
 //   - Basic arithmetic: add, multiply, square-plus-x
@@ -20,6 +20,7 @@
 package kernels
 
 import (
+	"fmt"
 	"math"
 	"unsafe"
 )
@@ -29,19 +30,24 @@ type KernelFn func(data []byte)
 
 // Kernel operation codes
 const (
-	OpNoop     = 0x00
-	OpSqrPlusX = 0x01
-	OpMatMul   = 0x02
-	OpReLU     = 0x03
-	OpSigmoid  = 0x04
-	OpTanh     = 0x05
-	OpAdd      = 0x06
-	OpMul      = 0x07
-	OpSum      = 0x08
-	OpMax      = 0x09
-	OpSoftmax  = 0x0A
+	OpNoop      = 0x00
+	OpSqrPlusX  = 0x01
+	OpMatMul    = 0x02
+	OpReLU      = 0x03
+	OpSigmoid   = 0x04
+	OpTanh      = 0x05
+	OpAdd       = 0x06
+	OpMul       = 0x07
+	OpSum       = 0x08
+	OpMax       = 0x09
+	OpSoftmax   = 0x0A
+	OpConv1D    = 0x0B
+	OpBatchNorm = 0x0C
 )
 
+// expMask selects the float32 exponent; it is all ones only for NaN and Inf.
+const expMask = 0x7f800000
+
 // Catalog maps opcodes to optimized kernel implementations
 var Catalog = [256]KernelFn{
 	OpNoop:     noop,
@@ -57,6 +63,21 @@ var Catalog = [256]KernelFn{
 	OpSoftmax:  softmax,
 }
 
+// opNames maps opcodes to the names used in errors and reports
+var opNames = [256]string{
+	OpNoop:     "noop",
+	OpSqrPlusX: "sqrplusx",
+	OpMatMul:   "matmul",
+	OpReLU:     "relu",
+	OpSigmoid:  "sigmoid",
+	OpTanh:     "tanh",
+	OpAdd:      "add",
+	OpMul:      "mul",
+	OpSum:      "sum",
+	OpMax:      "max",
+	OpSoftmax:  "softmax",
+}
+
 // -------- Core Kernels (SIMD-friendly) ----------
 
 func noop(data []byte) {
@@ -117,6 +138,16 @@ func tanh(data []byte) {
 	}
 }
 
+// float32s views the first n float32 values of b without copying. Indexing
+// the view is bounds-checked, unlike pointer arithmetic, so a length read
+// from a payload cannot reach past it.
+func float32s(b []byte, n int) []float32 {
+	if n <= 0 {
+		return nil
+	}
+	return unsafe.Slice((*float32)(unsafe.Pointer(&b[:n*4][0])), n)
+}
+
 // vectorAdd performs element-wise addition (data layout: [a0,a1,..][b0,b1,..])
 func vectorAdd(data []byte) {
 	const sz = 4
@@ -261,33 +292,21 @@ func vectorAddUnrolled(data []byte) {
 		return
 	}
 
-	aPtr := (*float32)(unsafe.Pointer(&data[0]))
-	bPtr := (*float32)(unsafe.Pointer(&data[count*sz]))
+	a := float32s(data, count)
+	b := float32s(data[count*sz:], count)
 
 	// Process in groups of 4 for better cache usage
 	i := 0
 	for ; i < count-unrollFactor+1; i += unrollFactor {
-		a0 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr(i*sz)))
-		a1 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr((i+1)*sz)))
-		a2 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr((i+2)*sz)))
-		a3 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr((i+3)*sz)))
-
-		b0 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(bPtr)) + uintptr(i*sz)))
-		b1 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(bPtr)) + uintptr((i+1)*sz)))
-		b2 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(bPtr)) + uintptr((i+2)*sz)))
-		b3 := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(bPtr)) + uintptr((i+3)*sz)))
-
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr(i*sz))) = a0 + b0
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr((i+1)*sz))) = a1 + b1
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr((i+2)*sz))) = a2 + b2
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr((i+3)*sz))) = a3 + b3
+		a[i] += b[i]
+		a[i+1] += b[i+1]
+		a[i+2] += b[i+2]
+		a[i+3] += b[i+3]
 	}
 
 	// Handle remaining elements
 	for ; i < count; i++ {
-		a := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr(i*sz)))
-		b := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(bPtr)) + uintptr(i*sz)))
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(aPtr)) + uintptr(i*sz))) = a + b
+		a[i] += b[i]
 	}
 }
 
@@ -304,18 +323,19 @@ func matMulOptimized(data []byte) {
 
 	aSize := int(rows) * int(cols) * 4
 	bSize := int(cols) * int(bCols) * 4
+	resultSize := int(rows) * int(bCols) * 4
 	headerSize := 6
 
-	if len(data) < headerSize+aSize+bSize {
+	if len(data) < headerSize+aSize+max(bSize, resultSize) {
 		return
 	}
 
-	// Get matrix pointers
-	matA := (*float32)(unsafe.Pointer(&data[headerSize]))
-	matB := (*float32)(unsafe.Pointer(&data[headerSize+aSize]))
+	matA := float32s(data[headerSize:], int(rows)*int(cols))
+	matB := float32s(data[headerSize+aSize:], int(cols)*int(bCols))
 
-	// Allocate result matrix (overwrite matB area for in-place operation)
-	result := (*float32)(unsafe.Pointer(&data[headerSize+aSize]))
+	// The result overwrites the matB area, so it is accumulated apart while
+	// B is still being read
+	result := make([]float32, int(rows)*int(bCols))
 
 	// Cache-friendly matrix multiplication with blocking
 	blockSize := 32 // Tune based on cache size
@@ -341,19 +361,15 @@ func matMulOptimized(data []byte) {
 					for j := jj; j < jEnd; j++ {
 						sum := float32(0)
 						for k := kk; k < kEnd; k++ {
-							aVal := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(matA)) +
-								uintptr((i*int(cols)+k)*4)))
-							bVal := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(matB)) +
-								uintptr((k*int(bCols)+j)*4)))
-							sum += aVal * bVal
+							sum += matA[i*int(cols)+k] * matB[k*int(bCols)+j]
 						}
-						*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(result)) +
-							uintptr((i*int(bCols)+j)*4))) += sum
+						result[i*int(bCols)+j] += sum
 					}
 				}
 			}
 		}
 	}
+	copy(float32s(data[headerSize+aSize:], len(result)), result)
 }
 
 // softmaxOptimized implements numerically stable softmax with SIMD-friendly patterns
@@ -407,8 +423,8 @@ func convolution1D(data []byte) {
 		return
 	}
 
-	input := (*float32)(unsafe.Pointer(&data[headerSize]))
-	kernel := (*float32)(unsafe.Pointer(&data[headerSize+inputSize]))
+	input := float32s(data[headerSize:], int(inputLen))
+	kernel := float32s(data[headerSize+inputSize:], int(kernelLen))
 
 	// Output overwrites input area
 	output := input
@@ -425,23 +441,18 @@ func convolution1D(data []byte) {
 
 		// Unroll inner loop for better performance
 		for ; j < int(kernelLen)-3; j += 4 {
-			sum += *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(input)) + uintptr((i+j)*4))) *
-				*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(kernel)) + uintptr(j*4)))
-			sum += *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(input)) + uintptr((i+j+1)*4))) *
-				*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(kernel)) + uintptr((j+1)*4)))
-			sum += *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(input)) + uintptr((i+j+2)*4))) *
-				*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(kernel)) + uintptr((j+2)*4)))
-			sum += *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(input)) + uintptr((i+j+3)*4))) *
-				*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(kernel)) + uintptr((j+3)*4)))
+			sum += input[i+j] * kernel[j]
+			sum += input[i+j+1] * kernel[j+1]
+			sum += input[i+j+2] * kernel[j+2]
+			sum += input[i+j+3] * kernel[j+3]
 		}
 
 		// Handle remaining elements
 		for ; j < int(kernelLen); j++ {
-			sum += *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(input)) + uintptr((i+j)*4))) *
-				*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(kernel)) + uintptr(j*4)))
+			sum += input[i+j] * kernel[j]
 		}
 
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(output)) + uintptr(i*4))) = sum
+		output[i] = sum
 	}
 }
 
@@ -458,17 +469,16 @@ func batchNorm(data []byte) {
 	gamma := *(*float32)(unsafe.Pointer(&data[10]))
 	beta := *(*float32)(unsafe.Pointer(&data[14]))
 
-	input := (*float32)(unsafe.Pointer(&data[18]))
+	// count comes from the payload; never normalize past its end
+	input := float32s(data[18:], min(int(count), (len(data)-18)/4))
 
 	// Precompute normalization factor
 	invStd := 1.0 / float32(math.Sqrt(float64(variance)+1e-5))
 
 	// Vectorized batch normalization
-	for i := 0; i < int(count); i++ {
-		val := *(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(input)) + uintptr(i*4)))
+	for i, val := range input {
 		normalized := (val - mean) * invStd
-		*(*float32)(unsafe.Pointer(uintptr(unsafe.Pointer(input)) + uintptr(i*4))) =
-			gamma*normalized + beta
+		input[i] = gamma*normalized + beta
 	}
 }
 
@@ -480,13 +490,10 @@ func init() {
 	Catalog[OpSoftmax] = softmaxOptimized
 
 	// Add new kernels
-	const (
-		OpConv1D    = 0x0B
-		OpBatchNorm = 0x0C
-	)
-
 	Catalog[OpConv1D] = convolution1D
 	Catalog[OpBatchNorm] = batchNorm
+	opNames[OpConv1D] = "conv1d"
+	opNames[OpBatchNorm] = "batchnorm"
 }
 
 // GetKernel returns the kernel function for the given opcode
@@ -494,6 +501,36 @@ func GetKernel(opcode byte) KernelFn {
 	return Catalog[opcode]
 }
 
+// OpName returns the name of the kernel for opcode, or its hex code when the
+// opcode has no kernel.
+func OpName(opcode byte) string {
+	if name := opNames[opcode]; name != "" {
+		return name
+	}
+	return fmt.Sprintf("op0x%02x", opcode)
+}
+
+// Lookup returns the opcode of the kernel named name, as returned by OpName
+func Lookup(name string) (opcode byte, ok bool) {
+	for op, n := range opNames {
+		if n != "" && n == name && Catalog[op] != nil {
+			return byte(op), true
+		}
+	}
+	return 0, false
+}
+
+// Names returns the names of the registered kernels, in opcode order
+func Names() []string {
+	var names []string
+	for op, n := range opNames {
+		if n != "" && Catalog[op] != nil {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
 // UseASM returns whether assembly optimizations are available
 func UseASM() bool {
 	return useASM
@@ -70,6 +70,29 @@ func TestVectorAdd(t *testing.T) {
 	}
 }
 
+func TestMatMulOverwritesB(t *testing.T) {
+	// [2x3]·[3x2]: the result is written over B, which it reads throughout
+	a := []float32{1, 2, 3, 4, 5, 6}
+	b := []float32{7, 8, 9, 10, 11, 12}
+	data := make([]byte, 6+4*len(a)+4*len(b))
+	binary.LittleEndian.PutUint16(data[0:], 2)
+	binary.LittleEndian.PutUint16(data[2:], 3)
+	binary.LittleEndian.PutUint16(data[4:], 2)
+	for i, v := range append(append([]float32(nil), a...), b...) {
+		binary.LittleEndian.PutUint32(data[6+4*i:], math.Float32bits(v))
+	}
+
+	Catalog[OpMatMul](data)
+
+	want := make([]float32, 4)
+	matMulGo(a, 2, 3, b, 2, want)
+	for i, w := range want {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(data[6+4*len(a)+4*i:])); got != w {
+			t.Errorf("Index %d: got %f, want %f", i, got, w)
+		}
+	}
+}
+
 func TestSoftmax(t *testing.T) {
 	// Create properly encoded test data: [1.0, 2.0, 3.0]
 	data := make([]byte, 12)
@@ -129,3 +152,53 @@ func BenchmarkSoftmax(b *testing.B) {
 		softmax(data)
 	}
 }
+
+func TestFirstNonFinite(t *testing.T) {
+	specials := []float32{float32(math.NaN()), float32(math.Inf(1)), float32(math.Inf(-1))}
+	for _, n := range []int{1, 7, 8, 9, 16, 100} {
+		x := make([]float32, n)
+		for i := range x {
+			x[i] = float32(i) - 3.5
+		}
+		if got := FirstNonFinite(x); got != -1 {
+			t.Errorf("n=%d: expected -1 for finite values, got %d", n, got)
+		}
+		for _, at := range []int{0, n / 2, n - 1} {
+			for _, v := range specials {
+				x[at] = v
+				if got := FirstNonFinite(x); got != at {
+					t.Errorf("n=%d: expected %v at %d, got %d", n, v, at, got)
+				}
+				x[at] = 1
+			}
+		}
+	}
+	if got := FirstNonFinite(nil); got != -1 {
+		t.Errorf("Expected -1 for empty input, got %d", got)
+	}
+	// Largest finite value and subnormals stay finite
+	if got := FirstNonFinite([]float32{math.MaxFloat32, -math.MaxFloat32, math.SmallestNonzeroFloat32}); got != -1 {
+		t.Errorf("Expected extreme finite values to pass, got %d", got)
+	}
+}
+
+func TestBatchNormBounds(t *testing.T) {
+	// count claims 1000 inputs but the payload holds 2, followed by a guard
+	// value outside the slice handed to the kernel
+	buf := make([]byte, 18+12)
+	binary.LittleEndian.PutUint16(buf[0:2], 1000)
+	binary.LittleEndian.PutUint32(buf[6:10], math.Float32bits(1))  // variance
+	binary.LittleEndian.PutUint32(buf[10:14], math.Float32bits(2)) // gamma
+	binary.LittleEndian.PutUint32(buf[18:22], math.Float32bits(1))
+	binary.LittleEndian.PutUint32(buf[22:26], math.Float32bits(3))
+	binary.LittleEndian.PutUint32(buf[26:30], math.Float32bits(7))
+
+	batchNorm(buf[:26])
+
+	if got := math.Float32frombits(binary.LittleEndian.Uint32(buf[26:])); got != 7 {
+		t.Errorf("Expected the guard value to stay 7, got %f", got)
+	}
+	if got := math.Float32frombits(binary.LittleEndian.Uint32(buf[22:])); math.Abs(float64(got-6)) > 1e-4 {
+		t.Errorf("Expected the second input normalized to 6, got %f", got)
+	}
+}
@@ -0,0 +1,93 @@
+package kernels
+
+import "math"
+
+// Optimizer kernels update parameters from their gradients. Each payload
+// starts with the float32 hyperparameters, the learning rate first, then
+// holds the parameters, their gradients and any optimizer state as equally
+// long float32 arrays; the kernel updates the parameters and state in place.
+const (
+	OpSGD      = 0x1B
+	OpMomentum = 0x1C
+	OpAdam     = 0x1D
+)
+
+// Header sizes of the optimizer kernels
+const (
+	SGDHeader      = 4
+	MomentumHeader = 8
+	AdamHeader     = 20
+)
+
+func init() {
+	optimizers := []struct {
+		op   byte
+		fn   KernelFn
+		name string
+		info KernelInfo
+	}{
+		{OpSGD, sgd, "sgd", KernelInfo{Doc: "SGD step, p -= lr·g. Layout: [lr][p][g]"}},
+		{OpMomentum, momentum, "sgd_momentum", KernelInfo{Doc: "SGD with momentum, v = μ·v + g then p -= lr·v. Layout: [lr][μ][p][g][v]"}},
+		{OpAdam, adam, "adam", KernelInfo{Doc: "Adam step with bias-corrected moments m and v; the kernel increments step. Layout: [lr][β1][β2][ε][step][p][g][m][v]"}},
+	}
+	for _, o := range optimizers {
+		Catalog[o.op] = o.fn
+		opNames[o.op] = o.name
+		infos[o.op] = o.info
+	}
+}
+
+// arrays views the n (up to 4) float32 arrays of equal length following
+// an optimizer header of header bytes
+func arrays(data []byte, header, n int) (views [4][]float32) {
+	count := (len(data) - header) / (4 * n)
+	for i := 0; i < n; i++ {
+		views[i] = float32s(data[header+4*count*i:], count)
+	}
+	return views
+}
+
+func sgd(data []byte) {
+	if len(data) < SGDHeader {
+		return
+	}
+	lr := float32s(data, 1)[0]
+	a := arrays(data, SGDHeader, 2)
+	p, g := a[0], a[1]
+	for i := range p {
+		p[i] -= lr * g[i]
+	}
+}
+
+func momentum(data []byte) {
+	if len(data) < MomentumHeader {
+		return
+	}
+	h := float32s(data, 2)
+	lr, mu := h[0], h[1]
+	a := arrays(data, MomentumHeader, 3)
+	p, g, v := a[0], a[1], a[2]
+	for i := range p {
+		v[i] = mu*v[i] + g[i]
+		p[i] -= lr * v[i]
+	}
+}
+
+func adam(data []byte) {
+	if len(data) < AdamHeader {
+		return
+	}
+	h := float32s(data, 5)
+	lr, beta1, beta2, eps := h[0], h[1], h[2], h[3]
+	h[4]++
+	step := float64(h[4])
+	c1 := float32(1 - math.Pow(float64(beta1), step))
+	c2 := float32(1 - math.Pow(float64(beta2), step))
+	a := arrays(data, AdamHeader, 4)
+	p, g, m, v := a[0], a[1], a[2], a[3]
+	for i := range p {
+		m[i] = beta1*m[i] + (1-beta1)*g[i]
+		v[i] = beta2*v[i] + (1-beta2)*g[i]*g[i]
+		p[i] -= lr * (m[i] / c1) / (float32(math.Sqrt(float64(v[i]/c2))) + eps)
+	}
+}
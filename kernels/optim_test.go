@@ -0,0 +1,58 @@
+package kernels
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOptimizers(t *testing.T) {
+	// [lr][p][g]
+	data := encodeFloats(0.5, 1, 2, 4, -2)
+	sgd(data)
+	if got, want := float32s(data[SGDHeader:], 2), []float32{-1, 3}; !slicesEqual(got, want, floatTolerance) {
+		t.Errorf("sgd got %v, want %v", got, want)
+	}
+
+	// [lr][μ][p][g][v]: v = 0.5·2 + 1, p = 1 - 0.1·2
+	data = encodeFloats(0.1, 0.5, 1, 1, 2)
+	momentum(data)
+	if got, want := float32s(data[MomentumHeader:], 3), []float32{0.8, 1, 2}; !slicesEqual(got, want, floatTolerance) {
+		t.Errorf("sgd_momentum got %v, want %v", got, want)
+	}
+
+	// The first Adam step moves each parameter by about lr against the
+	// sign of its gradient, whatever its magnitude
+	data = encodeFloats(0.01, 0.9, 0.999, 1e-8, 0, 1, 1, 3, -0.002, 0, 0, 0, 0)
+	adam(data)
+	if step := float32s(data, 5)[4]; step != 1 {
+		t.Errorf("adam step = %v, want 1", step)
+	}
+	p := float32s(data[AdamHeader:], 2)
+	if math.Abs(float64(p[0]-0.99)) > 1e-5 || math.Abs(float64(p[1]-1.01)) > 1e-5 {
+		t.Errorf("adam got parameters %v, want [0.99 1.01]", p)
+	}
+}
+
+// BenchmarkOptimizers runs one step of each optimizer on 4096 parameters
+func BenchmarkOptimizers(b *testing.B) {
+	const n = 4096
+	for _, c := range []struct {
+		name   string
+		kernel func([]byte)
+		header []float32
+		arrays int
+	}{
+		{"sgd", sgd, []float32{0.01}, 2},
+		{"sgd_momentum", momentum, []float32{0.01, 0.9}, 3},
+		{"adam", adam, []float32{0.001, 0.9, 0.999, 1e-8, 0}, 4},
+	} {
+		data := encodeFloats(append(c.header, make([]float32, c.arrays*n)...)...)
+		copy(data[4*len(c.header):], encodeFloats(randomSlice(2*n)...))
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				c.kernel(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package kernels
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// OpMatMulQ8 is the int8 matmul the compiler's quantization pass emits in
+// place of matmul and matmul_bias_act
+const OpMatMulQ8 = 0x0F
+
+// MatMulQ8Header is the size of the matmul_q8 header: the dimensions, the
+// activation opcode and the two scales
+const MatMulQ8Header = 16
+
+func init() {
+	Catalog[OpMatMulQ8] = matMulQ8
+	opNames[OpMatMulQ8] = "matmul_q8"
+	infos[OpMatMulQ8] = KernelInfo{Shape: matMulQ8Shape, FLOPs: matMulBiasActFLOPs, Arity: 1, Layout: shapeLayout(matMulQ8Shape), Ports: matMulPorts(MatMulQ8Header, false),
+		Doc: "act(A·B + bias) with int8 weights. Layout: [rows(2)][cols(2)][b_cols(2)][act(2)][a_scale(4)][b_scale(4)][A][bias][B as int8]; the result overwrites bias"}
+}
+
+// QuantizeInt8 returns the symmetric int8 code of v for scale, rounding to
+// the nearest code and saturating at ±127
+func QuantizeInt8(v, scale float32) int8 {
+	if scale == 0 {
+		return 0
+	}
+	q := math.Round(float64(v / scale))
+	return int8(max(-127, min(127, q)))
+}
+
+// matMulQ8 computes act(A·B + bias) with B stored as int8 codes. A is
+// quantized with the activation scale before the multiplication, or with
+// the scale of its largest magnitude when the activation scale is 0, and
+// the int32 sums are scaled back to float32. Layout:
+// [rows(2)][cols(2)][b_cols(2)][act(2)][a_scale(4)][b_scale(4)][A][bias][B
+// as int8]; the result overwrites bias.
+func matMulQ8(data []byte) {
+	if len(data) < MatMulQ8Header {
+		return
+	}
+	rows := int(binary.LittleEndian.Uint16(data[0:]))
+	cols := int(binary.LittleEndian.Uint16(data[2:]))
+	bCols := int(binary.LittleEndian.Uint16(data[4:]))
+	act, ok := Activation(uint32(binary.LittleEndian.Uint16(data[6:])))
+	aScale := math.Float32frombits(binary.LittleEndian.Uint32(data[8:]))
+	bScale := math.Float32frombits(binary.LittleEndian.Uint32(data[12:]))
+	aEnd := MatMulQ8Header + 4*rows*cols
+	biasEnd := aEnd + 4*rows*bCols
+	if !ok || len(data) < biasEnd+cols*bCols {
+		return
+	}
+	a := float32s(data[MatMulQ8Header:], rows*cols)
+	out := float32s(data[aEnd:], rows*bCols)
+	b := data[biasEnd : biasEnd+cols*bCols]
+	if aScale == 0 {
+		var maxAbs float32
+		for _, v := range a {
+			maxAbs = max(maxAbs, float32(math.Abs(float64(v))))
+		}
+		aScale = maxAbs / 127
+	}
+	scale := aScale * bScale
+	for i := 0; i < rows; i++ {
+		for j := 0; j < bCols; j++ {
+			var sum int32
+			for k := 0; k < cols; k++ {
+				sum += int32(QuantizeInt8(a[i*cols+k], aScale)) * int32(int8(b[k*bCols+j]))
+			}
+			out[i*bCols+j] += float32(sum) * scale
+		}
+	}
+	if act != nil {
+		act(data[aEnd:biasEnd])
+	}
+}
+
+// matMulQ8Shape reads the matmul_q8 header; an input replaces the A operand
+func matMulQ8Shape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(payload) < MatMulQ8Header {
+		return nil, fmt.Errorf("missing matmul_q8 header")
+	}
+	rows := int(binary.LittleEndian.Uint16(payload[0:]))
+	cols := int(binary.LittleEndian.Uint16(payload[2:]))
+	bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+	if act := binary.LittleEndian.Uint16(payload[6:]); !validActivation(uint32(act)) {
+		return nil, fmt.Errorf("matmul_q8 has invalid activation %s", OpName(byte(act)))
+	}
+	if need := MatMulQ8Header + 4*(rows*cols+rows*bCols) + cols*bCols; len(payload) < need {
+		return nil, fmt.Errorf("%dx%d by %dx%d matmul_q8 needs %d payload bytes, segment has %d", rows, cols, cols, bCols, need, len(payload))
+	}
+	for _, s := range inputs {
+		if Elements(s) != rows*cols {
+			return nil, fmt.Errorf("input shape %v does not match the %dx%d left operand", s, rows, cols)
+		}
+	}
+	return []int{rows, bCols}, nil
+}
@@ -0,0 +1,83 @@
+package kernels
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// OpMatMulTiled is the cache-blocked matmul the compiler emits in place of
+// matmul when compiling for a target with a tile size
+const OpMatMulTiled = 0x10
+
+// MatMulTiledHeader is the size of the matmul_tiled header: the dimensions
+// and the tile edge
+const MatMulTiledHeader = 8
+
+func init() {
+	Catalog[OpMatMulTiled] = matMulTiled
+	opNames[OpMatMulTiled] = "matmul_tiled"
+	infos[OpMatMulTiled] = KernelInfo{Shape: matMulTiledShape, FLOPs: matMulFLOPs, Arity: 1, Layout: shapeLayout(matMulTiledShape), Ports: matMulPorts(MatMulTiledHeader, true),
+		Doc: "Cache-blocked A·B. Layout: [rows(2)][cols(2)][b_cols(2)][tile(2)][A][B][C]; the result overwrites C"}
+}
+
+// matMulTiled computes A·B over tile x tile blocks sized to stay in cache,
+// walking each row of B contiguously. A tile of 0 uses one block. Layout:
+// [rows(2)][cols(2)][b_cols(2)][tile(2)][A][B][C]; the result overwrites C.
+func matMulTiled(data []byte) {
+	if len(data) < MatMulTiledHeader {
+		return
+	}
+	rows := int(binary.LittleEndian.Uint16(data[0:]))
+	cols := int(binary.LittleEndian.Uint16(data[2:]))
+	bCols := int(binary.LittleEndian.Uint16(data[4:]))
+	tile := int(binary.LittleEndian.Uint16(data[6:]))
+	aEnd := MatMulTiledHeader + 4*rows*cols
+	bEnd := aEnd + 4*cols*bCols
+	if len(data) < bEnd+4*rows*bCols {
+		return
+	}
+	if tile == 0 {
+		tile = max(rows, cols, bCols)
+	}
+	a := float32s(data[MatMulTiledHeader:], rows*cols)
+	b := float32s(data[aEnd:], cols*bCols)
+	out := float32s(data[bEnd:], rows*bCols)
+	clear(out)
+	for ii := 0; ii < rows; ii += tile {
+		for kk := 0; kk < cols; kk += tile {
+			for jj := 0; jj < bCols; jj += tile {
+				iEnd, kEnd, jEnd := min(ii+tile, rows), min(kk+tile, cols), min(jj+tile, bCols)
+				for i := ii; i < iEnd; i++ {
+					row := out[i*bCols : (i+1)*bCols]
+					for k := kk; k < kEnd; k++ {
+						av := a[i*cols+k]
+						bRow := b[k*bCols : (k+1)*bCols]
+						for j := jj; j < jEnd; j++ {
+							row[j] += av * bRow[j]
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// matMulTiledShape reads the matmul_tiled header; an input replaces the A
+// operand
+func matMulTiledShape(inputs [][]int, payload []byte) ([]int, error) {
+	if len(payload) < MatMulTiledHeader {
+		return nil, fmt.Errorf("missing matmul_tiled header")
+	}
+	rows := int(binary.LittleEndian.Uint16(payload[0:]))
+	cols := int(binary.LittleEndian.Uint16(payload[2:]))
+	bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+	if need := MatMulTiledHeader + 4*(rows*cols+cols*bCols+rows*bCols); len(payload) < need {
+		return nil, fmt.Errorf("%dx%d by %dx%d matmul_tiled needs %d payload bytes, segment has %d", rows, cols, cols, bCols, need, len(payload))
+	}
+	for _, s := range inputs {
+		if Elements(s) != rows*cols {
+			return nil, fmt.Errorf("input shape %v does not match the %dx%d left operand", s, rows, cols)
+		}
+	}
+	return []int{rows, bCols}, nil
+}
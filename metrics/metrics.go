@@ -0,0 +1,429 @@
+// Package metrics scores model predictions against labels. A Metric takes
+// one sample at a time, so evaluation streams over executions without
+// keeping their outputs; only AUC, which ranks every score, keeps one
+// value per sample.
+//
+// Classification metrics read a prediction as class scores, the class
+// being the largest, or as a single probability of the positive class of
+// a binary problem, positive from 0.5. A label is a class index, a single
+// 0 or 1 for a binary problem, or a one-hot or target distribution as
+// long as the prediction, its class the largest entry. Regression metrics
+// compare predictions and labels element by element.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric accumulates a score over samples
+type Metric interface {
+	// Name returns the name Parse takes
+	Name() string
+	// Add scores one sample
+	Add(pred, label []float64) error
+	// Value returns the score of the samples added since the last Reset,
+	// NaN before any
+	Value() float64
+	// Reset forgets the samples added
+	Reset()
+}
+
+// Parse returns the metrics of a comma-separated list of names: accuracy,
+// top<k> such as top5, precision, recall, f1, auc, mse and mae
+func Parse(names string) (Set, error) {
+	var set Set
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		var m Metric
+		switch name {
+		case "":
+			continue
+		case "accuracy":
+			m = &Accuracy{}
+		case "precision":
+			m = &Precision{}
+		case "recall":
+			m = &Recall{}
+		case "f1":
+			m = &F1{}
+		case "auc":
+			m = &AUC{}
+		case "mse":
+			m = &MSE{}
+		case "mae":
+			m = &MAE{}
+		default:
+			k, err := strconv.Atoi(strings.TrimPrefix(name, "top"))
+			if !strings.HasPrefix(name, "top") || err != nil || k < 1 {
+				return nil, fmt.Errorf("unknown metric %q, want accuracy, top<k>, precision, recall, f1, auc, mse or mae", name)
+			}
+			m = &TopK{K: k}
+		}
+		set = append(set, m)
+	}
+	return set, nil
+}
+
+// Set is several metrics scoring the same samples
+type Set []Metric
+
+// Add adds the sample to every metric
+func (s Set) Add(pred, label []float64) error {
+	for _, m := range s {
+		if err := m.Add(pred, label); err != nil {
+			return fmt.Errorf("%s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Reset resets every metric
+func (s Set) Reset() {
+	for _, m := range s {
+		m.Reset()
+	}
+}
+
+// String formats the values as name value pairs, such as
+// "accuracy 0.9375, f1 0.9"
+func (s Set) String() string {
+	parts := make([]string, len(s))
+	for i, m := range s {
+		parts[i] = fmt.Sprintf("%s %.6g", m.Name(), m.Value())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ReadLabels reads one label per line of numbers separated by commas,
+// spaces or tabs, skipping blank lines and '#' comments
+func ReadLabels(r io.Reader) ([][]float64, error) {
+	var labels [][]float64
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var label []float64
+		for _, f := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("labels: line %d: invalid number %q", n, f)
+			}
+			label = append(label, v)
+		}
+		labels = append(labels, label)
+	}
+	return labels, sc.Err()
+}
+
+// predictedClass returns the class of a prediction
+func predictedClass(pred []float64) (int, error) {
+	switch len(pred) {
+	case 0:
+		return 0, fmt.Errorf("empty prediction")
+	case 1:
+		if pred[0] >= 0.5 {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	best := 0
+	for i, v := range pred {
+		if v > pred[best] {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+// labelClass returns the class of the label of a prediction of n scores
+func labelClass(label []float64, n int) (int, error) {
+	switch {
+	case len(label) == 1 && n == 1:
+		if label[0] >= 0.5 {
+			return 1, nil
+		}
+		return 0, nil
+	case len(label) == 1:
+		c := int(label[0])
+		if float64(c) != label[0] || c < 0 || c >= n {
+			return 0, fmt.Errorf("label %v is not a class of %d scores", label[0], n)
+		}
+		return c, nil
+	case len(label) == n:
+		return predictedClass(label)
+	}
+	return 0, fmt.Errorf("label of %d values for a prediction of %d", len(label), n)
+}
+
+// classes returns the predicted and labelled class of a sample
+func classes(pred, label []float64) (got, want int, err error) {
+	if got, err = predictedClass(pred); err != nil {
+		return 0, 0, err
+	}
+	want, err = labelClass(label, len(pred))
+	return got, want, err
+}
+
+// ratio returns n/d, NaN for no samples
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return math.NaN()
+	}
+	return float64(n) / float64(d)
+}
+
+// Accuracy is the fraction of samples of the labelled class
+type Accuracy struct {
+	correct, total int
+}
+
+func (m *Accuracy) Name() string { return "accuracy" }
+
+func (m *Accuracy) Add(pred, label []float64) error {
+	got, want, err := classes(pred, label)
+	if err != nil {
+		return err
+	}
+	if got == want {
+		m.correct++
+	}
+	m.total++
+	return nil
+}
+
+func (m *Accuracy) Value() float64 { return ratio(m.correct, m.total) }
+
+func (m *Accuracy) Reset() { *m = Accuracy{} }
+
+// TopK is the fraction of samples whose labelled class is among the K
+// highest scores
+type TopK struct {
+	K              int
+	correct, total int
+}
+
+func (m *TopK) Name() string { return "top" + strconv.Itoa(m.K) }
+
+func (m *TopK) Add(pred, label []float64) error {
+	if len(pred) < 2 {
+		return fmt.Errorf("prediction of %d values has no ranking", len(pred))
+	}
+	want, err := labelClass(label, len(pred))
+	if err != nil {
+		return err
+	}
+	higher := 0
+	for _, v := range pred {
+		if v > pred[want] {
+			higher++
+		}
+	}
+	if higher < m.K {
+		m.correct++
+	}
+	m.total++
+	return nil
+}
+
+func (m *TopK) Value() float64 { return ratio(m.correct, m.total) }
+
+func (m *TopK) Reset() { m.correct, m.total = 0, 0 }
+
+// confusion counts the true positives, false positives and false
+// negatives of every class. Binary predictions only score the positive
+// class; the others average the classes seen, macro-averaging.
+type confusion struct {
+	tp, fp, fn map[int]int
+	binary     bool
+}
+
+func (c *confusion) add(pred, label []float64) error {
+	got, want, err := classes(pred, label)
+	if err != nil {
+		return err
+	}
+	if c.tp == nil {
+		c.tp, c.fp, c.fn = map[int]int{}, map[int]int{}, map[int]int{}
+	}
+	c.binary = len(pred) == 1
+	if got == want {
+		c.tp[got]++
+	} else {
+		c.fp[got]++
+		c.fn[want]++
+	}
+	return nil
+}
+
+// average returns the mean of score over the classes scored
+func (c *confusion) average(score func(tp, fp, fn int) float64) float64 {
+	if c.tp == nil {
+		return math.NaN()
+	}
+	if c.binary {
+		return score(c.tp[1], c.fp[1], c.fn[1])
+	}
+	var seen []int
+	for _, counts := range []map[int]int{c.tp, c.fp, c.fn} {
+		for class := range counts {
+			if !slices.Contains(seen, class) {
+				seen = append(seen, class)
+			}
+		}
+	}
+	sort.Ints(seen) // Sum in a fixed order
+	var sum float64
+	for _, class := range seen {
+		sum += score(c.tp[class], c.fp[class], c.fn[class])
+	}
+	return sum / float64(len(seen))
+}
+
+func (c *confusion) reset() { *c = confusion{} }
+
+func precision(tp, fp, _ int) float64 { return ratioOrZero(tp, tp+fp) }
+
+func recall(tp, _, fn int) float64 { return ratioOrZero(tp, tp+fn) }
+
+func f1(tp, fp, fn int) float64 { return ratioOrZero(2*tp, 2*tp+fp+fn) }
+
+// ratioOrZero returns n/d, 0 for a class never predicted or labelled
+func ratioOrZero(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// Precision is the fraction of predictions of a class that are right
+type Precision struct{ c confusion }
+
+func (m *Precision) Name() string                    { return "precision" }
+func (m *Precision) Add(pred, label []float64) error { return m.c.add(pred, label) }
+func (m *Precision) Value() float64                  { return m.c.average(precision) }
+func (m *Precision) Reset()                          { m.c.reset() }
+
+// Recall is the fraction of samples of a class predicted as it
+type Recall struct{ c confusion }
+
+func (m *Recall) Name() string                    { return "recall" }
+func (m *Recall) Add(pred, label []float64) error { return m.c.add(pred, label) }
+func (m *Recall) Value() float64                  { return m.c.average(recall) }
+func (m *Recall) Reset()                          { m.c.reset() }
+
+// F1 is the harmonic mean of precision and recall
+type F1 struct{ c confusion }
+
+func (m *F1) Name() string                    { return "f1" }
+func (m *F1) Add(pred, label []float64) error { return m.c.add(pred, label) }
+func (m *F1) Value() float64                  { return m.c.average(f1) }
+func (m *F1) Reset()                          { m.c.reset() }
+
+// AUC is the area under the ROC curve of a binary problem: the chance a
+// positive sample scores higher than a negative one, ties counting half.
+// The score is a single prediction, or the second of two class scores.
+type AUC struct {
+	scores []float64
+	labels []bool
+}
+
+func (m *AUC) Name() string { return "auc" }
+
+func (m *AUC) Add(pred, label []float64) error {
+	if len(pred) != 1 && len(pred) != 2 {
+		return fmt.Errorf("prediction of %d values is not binary", len(pred))
+	}
+	want, err := labelClass(label, len(pred))
+	if err != nil {
+		return err
+	}
+	m.scores = append(m.scores, pred[len(pred)-1])
+	m.labels = append(m.labels, want == 1)
+	return nil
+}
+
+// Value ranks the scores, the Mann-Whitney U statistic over the number of
+// positive and negative pairs. It is NaN without both.
+func (m *AUC) Value() float64 {
+	order := make([]int, len(m.scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return m.scores[order[a]] < m.scores[order[b]] })
+	var rankSum float64
+	positives := 0
+	for i := 0; i < len(order); {
+		// Tied scores share the mean of their ranks
+		j := i
+		for j < len(order) && m.scores[order[j]] == m.scores[order[i]] {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for _, k := range order[i:j] {
+			if m.labels[k] {
+				rankSum += rank
+				positives++
+			}
+		}
+		i = j
+	}
+	negatives := len(order) - positives
+	if positives == 0 || negatives == 0 {
+		return math.NaN()
+	}
+	p := float64(positives)
+	return (rankSum - p*(p+1)/2) / (p * float64(negatives))
+}
+
+func (m *AUC) Reset() { m.scores, m.labels = m.scores[:0], m.labels[:0] }
+
+// errorSum sums a function of the elementwise errors of predictions
+type errorSum struct {
+	sum   float64
+	count int
+}
+
+func (e *errorSum) add(pred, label []float64, f func(float64) float64) error {
+	if len(pred) != len(label) {
+		return fmt.Errorf("label of %d values for a prediction of %d", len(label), len(pred))
+	}
+	for i := range pred {
+		e.sum += f(pred[i] - label[i])
+	}
+	e.count += len(pred)
+	return nil
+}
+
+func (e *errorSum) mean() float64 {
+	if e.count == 0 {
+		return math.NaN()
+	}
+	return e.sum / float64(e.count)
+}
+
+// MSE is the mean squared error of the elements
+type MSE struct{ e errorSum }
+
+func (m *MSE) Name() string { return "mse" }
+func (m *MSE) Add(pred, label []float64) error {
+	return m.e.add(pred, label, func(d float64) float64 { return d * d })
+}
+func (m *MSE) Value() float64 { return m.e.mean() }
+func (m *MSE) Reset()         { m.e = errorSum{} }
+
+// MAE is the mean absolute error of the elements
+type MAE struct{ e errorSum }
+
+func (m *MAE) Name() string                    { return "mae" }
+func (m *MAE) Add(pred, label []float64) error { return m.e.add(pred, label, math.Abs) }
+func (m *MAE) Value() float64                  { return m.e.mean() }
+func (m *MAE) Reset()                          { m.e = errorSum{} }
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// sample is a prediction and its label
+type sample struct{ pred, label []float64 }
+
+func score(t *testing.T, m Metric, samples []sample) float64 {
+	t.Helper()
+	m.Reset()
+	for _, s := range samples {
+		if err := m.Add(s.pred, s.label); err != nil {
+			t.Fatalf("%s: Add(%v, %v) failed: %v", m.Name(), s.pred, s.label, err)
+		}
+	}
+	return m.Value()
+}
+
+func TestClassification(t *testing.T) {
+	t.Parallel()
+	// Three classes: labels as indices and one-hot, predictions right for
+	// samples 0, 1 and 3; sample 2 has class 2 second and class 1 third
+	multi := []sample{
+		{[]float64{0.7, 0.2, 0.1}, []float64{0}},
+		{[]float64{0.1, 0.8, 0.1}, []float64{0, 1, 0}},
+		{[]float64{0.5, 0.2, 0.3}, []float64{2}},
+		{[]float64{0.1, 0.2, 0.7}, []float64{2}},
+	}
+	// Binary probabilities: one false positive, one false negative
+	binary := []sample{
+		{[]float64{0.9}, []float64{1}},
+		{[]float64{0.8}, []float64{0}},
+		{[]float64{0.3}, []float64{1}},
+		{[]float64{0.2}, []float64{0}},
+		{[]float64{0.6}, []float64{1}},
+	}
+	for _, tc := range []struct {
+		m       Metric
+		samples []sample
+		want    float64
+	}{
+		{&Accuracy{}, multi, 0.75},
+		{&TopK{K: 1}, multi, 0.75},
+		{&TopK{K: 2}, multi, 1},
+		// Class 0: precision 1/2, recall 1; class 1: 1, 1; class 2: 1, 1/2
+		{&Precision{}, multi, 2.5 / 3},
+		{&Recall{}, multi, 2.5 / 3},
+		{&F1{}, multi, (2.0/3 + 1 + 2.0/3) / 3},
+		{&Accuracy{}, binary, 0.6},
+		{&Precision{}, binary, 2.0 / 3},
+		{&Recall{}, binary, 2.0 / 3},
+		{&F1{}, binary, 2.0 / 3},
+		// 0.3 and 0.6 rank below the negative 0.8 in 2 of the 6 pairs
+		{&AUC{}, binary, 4.0 / 6},
+	} {
+		if got := score(t, tc.m, tc.samples); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("%s = %v, want %v", tc.m.Name(), got, tc.want)
+		}
+	}
+}
+
+func TestAUCTies(t *testing.T) {
+	t.Parallel()
+	tied := []sample{
+		{[]float64{0.2, 0.5}, []float64{0, 1}},
+		{[]float64{0.5, 0.5}, []float64{1, 0}},
+		{[]float64{0.9, 0.1}, []float64{0}},
+	}
+	if got := score(t, &AUC{}, tied); got != 0.75 {
+		t.Errorf("AUC with a tie = %v, want 0.75", got)
+	}
+	if got := score(t, &AUC{}, tied[2:]); !math.IsNaN(got) {
+		t.Errorf("AUC without positives = %v, want NaN", got)
+	}
+}
+
+func TestRegression(t *testing.T) {
+	t.Parallel()
+	samples := []sample{
+		{[]float64{1, 2}, []float64{1, 4}},
+		{[]float64{0, -1}, []float64{1, -1}},
+	}
+	if got := score(t, &MSE{}, samples); got != 5.0/4 {
+		t.Errorf("MSE = %v, want 1.25", got)
+	}
+	if got := score(t, &MAE{}, samples); got != 3.0/4 {
+		t.Errorf("MAE = %v, want 0.75", got)
+	}
+	if got := (&MSE{}).Value(); !math.IsNaN(got) {
+		t.Errorf("MSE of no samples = %v, want NaN", got)
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		m           Metric
+		pred, label []float64
+	}{
+		{&Accuracy{}, []float64{0.1, 0.9}, []float64{2}},
+		{&Accuracy{}, []float64{0.1, 0.9}, []float64{0.5}},
+		{&Accuracy{}, []float64{0.1, 0.9}, []float64{0, 1, 0}},
+		{&TopK{K: 1}, []float64{0.9}, []float64{1}},
+		{&AUC{}, []float64{0.1, 0.2, 0.7}, []float64{2}},
+		{&MSE{}, []float64{1}, []float64{1, 2}},
+	} {
+		if err := tc.m.Add(tc.pred, tc.label); err == nil {
+			t.Errorf("%s: Add(%v, %v) succeeded", tc.m.Name(), tc.pred, tc.label)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	set, err := Parse("accuracy, top5,f1,auc,mse")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := set[:3].Add([]float64{0.1, 0.9}, []float64{1}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if got := set[:3].String(); got != "accuracy 1, top5 1, f1 1" {
+		t.Errorf("String = %q", got)
+	}
+	for _, bad := range []string{"top0", "topk", "rmse"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestReadLabels(t *testing.T) {
+	t.Parallel()
+	labels, err := ReadLabels(strings.NewReader("# labels\n1\n\n0, 1 0\n"))
+	if err != nil || len(labels) != 2 || len(labels[1]) != 3 || labels[1][1] != 1 {
+		t.Errorf("ReadLabels = %v, %v", labels, err)
+	}
+	if _, err := ReadLabels(strings.NewReader("1\nx\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+}
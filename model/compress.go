@@ -0,0 +1,178 @@
+package model
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how Serialize stores section bodies. Compressed
+// sections record the codec in bits 8-15 of the section flags and the
+// uncompressed length in bytes 24-31 of the section header; the CRC covers
+// the stored bytes. Uncompressed files keep the payload 32-byte aligned in
+// the file, so they remain usable in place from a mapped file.
+type Compression uint8
+
+const (
+	CompressNone    Compression = iota // Store sections as is
+	CompressLZ4                        // LZ4 block format: fast to decode
+	CompressDeflate                    // DEFLATE (RFC 1951): smaller, slower to decode
+	CompressZstd                       // Zstandard (RFC 8878): smallest, decodes faster than DEFLATE
+)
+
+var compressionNames = [...]string{
+	CompressNone:    "none",
+	CompressLZ4:     "lz4",
+	CompressDeflate: "deflate",
+	CompressZstd:    "zstd",
+}
+
+// String returns the codec name
+func (c Compression) String() string {
+	if int(c) < len(compressionNames) {
+		return compressionNames[c]
+	}
+	return fmt.Sprintf("Compression(%d)", c)
+}
+
+// ParseCompression parses a codec name as printed by String; "" selects
+// CompressNone
+func ParseCompression(name string) (Compression, error) {
+	if name == "" {
+		return CompressNone, nil
+	}
+	for c, n := range compressionNames {
+		if strings.EqualFold(name, n) {
+			return Compression(c), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown compression %q (want none, lz4, deflate or zstd)", name)
+}
+
+const (
+	sectionCodecShift = 8
+	sectionCodecMask  = 0xFF << sectionCodecShift
+)
+
+// maxRatio bounds the uncompressed length a codec can claim for n stored
+// bytes, so a corrupt header cannot force a huge allocation
+func (c Compression) maxRatio() uint64 {
+	switch c {
+	case CompressLZ4:
+		return 255
+	case CompressZstd:
+		return 1 << 15 // A 128 KiB RLE block from 4 stored bytes
+	}
+	return 1032 // DEFLATE's limit for runs of one byte
+}
+
+// zstdEncoder is shared by every Serialize call; EncodeAll is safe for
+// concurrent use
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	e, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+	return e
+})
+
+// compress returns s with its body encoded by c, or s unchanged when c is
+// CompressNone or the encoded body is not smaller
+func (s section) compress(c Compression) (section, error) {
+	var body []byte
+	switch c {
+	case CompressNone:
+		return s, nil
+	case CompressLZ4:
+		body = lz4Compress(s.body)
+	case CompressDeflate:
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		if _, err := w.Write(s.body); err != nil {
+			return s, err
+		}
+		if err := w.Close(); err != nil {
+			return s, err
+		}
+		body = buf.Bytes()
+	case CompressZstd:
+		body = zstdEncoder().EncodeAll(s.body, nil)
+	default:
+		return s, fmt.Errorf("unknown compression %d", c)
+	}
+	if len(body) >= len(s.body) {
+		return s, nil
+	}
+	return section{
+		tag:    s.tag,
+		flags:  s.flags | uint32(c)<<sectionCodecShift,
+		body:   body,
+		rawLen: uint64(len(s.body)),
+	}, nil
+}
+
+// decode returns the uncompressed body of s, decompressing straight into
+// one buffer of the recorded length
+func (s section) decode() ([]byte, error) {
+	c, err := s.codec(uint64(len(s.body)))
+	if err != nil || c == CompressNone {
+		return s.body, err
+	}
+	raw := make([]byte, s.rawLen)
+	if err := s.decodeTo(raw, c); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// codec returns the compression of a section storing n bytes, checking
+// that they can expand to the recorded raw length
+func (s section) codec(n uint64) (Compression, error) {
+	c := Compression((s.flags & sectionCodecMask) >> sectionCodecShift)
+	if c == CompressNone {
+		return c, nil
+	}
+	if c != CompressLZ4 && c != CompressDeflate && c != CompressZstd {
+		return c, fmt.Errorf("%s section: unknown compression %d", tagName(s.tag), c)
+	}
+	if s.rawLen > n*c.maxRatio()+64 {
+		return c, fmt.Errorf("%s section: %d bytes cannot expand to %d with %v", tagName(s.tag), n, s.rawLen, c)
+	}
+	return c, nil
+}
+
+// decodeTo decompresses the body of s, compressed with c, into raw, which
+// holds exactly the recorded raw length
+func (s section) decodeTo(raw []byte, c Compression) error {
+	var err error
+	switch c {
+	case CompressLZ4:
+		err = lz4Decompress(raw, s.body)
+	case CompressZstd:
+		var d *zstd.Decoder
+		if d, err = zstd.NewReader(bytes.NewReader(s.body), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(len(raw))+1)); err == nil {
+			err = readExactly(d, raw)
+			d.Close()
+		}
+	default:
+		err = readExactly(flate.NewReader(bytes.NewReader(s.body)), raw)
+	}
+	if err != nil {
+		return fmt.Errorf("%s section: %v: %w", tagName(s.tag), c, err)
+	}
+	return nil
+}
+
+// readExactly fills raw from the decompressing reader r, which must end there
+func readExactly(r io.Reader, raw []byte) error {
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return err
+	}
+	var extra [1]byte
+	if n, _ := r.Read(extra[:]); n != 0 {
+		return fmt.Errorf("more than %d bytes", len(raw))
+	}
+	return nil
+}
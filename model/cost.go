@@ -0,0 +1,107 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+const sectionCosts = 0x54534F43 // "COST"
+
+// NodeCost is the cost of one execution of a node
+type NodeCost struct {
+	FLOPs uint64 // Estimated floating-point operations
+	Bytes uint64 // Estimated bytes read and written
+	Nanos uint64 // Measured mean duration, 0 when not profiled
+}
+
+// Weight returns the cost schedulers balance: the measured duration when the
+// node was profiled, otherwise its FLOPs plus bytes moved
+func (c NodeCost) Weight() uint64 {
+	if c.Nanos > 0 {
+		return c.Nanos
+	}
+	return c.FLOPs + c.Bytes
+}
+
+// EstimateCosts sets the FLOPs and Bytes of every node in g.Costs from its
+// kernel, payload segment and the shapes computed by InferShapes, keeping
+// measured durations. A node whose shapes are unknown is costed from its
+// payload segment alone.
+func (g *Graph) EstimateCosts() {
+	costs := make(map[uint32]NodeCost, len(g.Nodes))
+	for _, n := range g.Nodes {
+		var payload []byte
+		if n.Out > n.In && int(n.Out) <= len(g.Payload) {
+			payload = g.Payload[n.In:n.Out]
+		}
+		inputs, _ := g.inputShapes(n, g.Shapes)
+		output := g.Shapes[n.ID]
+
+		c := NodeCost{Nanos: g.Costs[n.ID].Nanos, Bytes: uint64(len(payload))}
+		for _, s := range inputs {
+			c.Bytes += 4 * uint64(kernels.Elements(s))
+		}
+		if output != nil {
+			c.Bytes += 4 * uint64(kernels.Elements(output))
+		} else {
+			output = []int{len(payload) / 4}
+		}
+		if info, ok := kernels.Info(n.Kernel); ok && info.FLOPs != nil {
+			c.FLOPs = info.FLOPs(inputs, output, payload)
+		}
+		costs[n.ID] = c
+	}
+	g.Costs = costs
+}
+
+// writeCosts writes the COST section body: a uint32 count, then per node in
+// ID order its ID (uint32), FLOPs, bytes and nanoseconds (uint64 each)
+func writeCosts(buf *bytes.Buffer, costs map[uint32]NodeCost) {
+	ids := make([]uint32, 0, len(costs))
+	for id := range costs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var b [28]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(ids)))
+	buf.Write(b[:4])
+	for _, id := range ids {
+		c := costs[id]
+		binary.LittleEndian.PutUint32(b[0:], id)
+		binary.LittleEndian.PutUint64(b[4:], c.FLOPs)
+		binary.LittleEndian.PutUint64(b[12:], c.Bytes)
+		binary.LittleEndian.PutUint64(b[20:], c.Nanos)
+		buf.Write(b[:])
+	}
+}
+
+// readCosts reads a section written by writeCosts
+func readCosts(body []byte) (map[uint32]NodeCost, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("truncated entry count")
+	}
+	count := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	if uint64(count)*28 > uint64(len(body)) {
+		return nil, fmt.Errorf("%d costs exceed the section", count)
+	}
+	costs := make(map[uint32]NodeCost, count)
+	for i := uint32(0); i < count; i++ {
+		e := body[28*i:]
+		id := binary.LittleEndian.Uint32(e)
+		if _, dup := costs[id]; dup {
+			return nil, fmt.Errorf("duplicate node %d", id)
+		}
+		costs[id] = NodeCost{
+			FLOPs: binary.LittleEndian.Uint64(e[4:]),
+			Bytes: binary.LittleEndian.Uint64(e[12:]),
+			Nanos: binary.LittleEndian.Uint64(e[20:]),
+		}
+	}
+	return costs, nil
+}
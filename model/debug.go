@@ -0,0 +1,160 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+const sectionDebug = 0x47554244 // "DBUG"
+
+// SourceInfo names a node or segment and locates the spec line declaring it
+type SourceInfo struct {
+	Name string `json:"name,omitempty"`
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Pos returns the position as file:line, "" when unknown
+func (s SourceInfo) Pos() string {
+	switch {
+	case s.Line == 0:
+		return s.File
+	case s.File == "":
+		return "line " + strconv.Itoa(s.Line)
+	}
+	return s.File + ":" + strconv.Itoa(s.Line)
+}
+
+// DebugInfo is the debug symbol table carried in the DBUG section, written
+// by compilers asked for debug output. Tools and the runtime use it to
+// report nodes by name and source position rather than by ID.
+type DebugInfo struct {
+	Nodes    map[uint32]SourceInfo `json:"nodes,omitempty"`    // Keyed by node ID
+	Segments map[uint32]SourceInfo `json:"segments,omitempty"` // Keyed by segment ID
+}
+
+// Empty reports whether d holds no entries; nil is empty
+func (d *DebugInfo) Empty() bool {
+	return d == nil || len(d.Nodes) == 0 && len(d.Segments) == 0
+}
+
+// NodeName returns the debug name of node id, "" when it has none
+func (g *Graph) NodeName(id uint32) string {
+	if g.Debug == nil {
+		return ""
+	}
+	return g.Debug.Nodes[id].Name
+}
+
+// NodeLabel returns how messages refer to node id: "node <name>" when the
+// graph carries a debug name for it, otherwise "node <id>"
+func (g *Graph) NodeLabel(id uint32) string {
+	return NodeLabel(id, g.NodeName(id))
+}
+
+// NodeLabel formats a node reference from its ID and debug name, which may
+// be empty
+func NodeLabel(id uint32, name string) string {
+	if name == "" {
+		return fmt.Sprintf("node %d", id)
+	}
+	return fmt.Sprintf("node %s", name)
+}
+
+// writeDebug writes the DBUG section body: the node entries, then the
+// segment entries, each a uint32 count followed per entry in ID order by
+// the ID and line (uint32), the name and file lengths (uint16), the name
+// and the file. Only entries of nodes and segments in g are written.
+func writeDebug(buf *bytes.Buffer, g *Graph) error {
+	nodes := make(map[uint32]SourceInfo, len(g.Debug.Nodes))
+	for _, n := range g.Nodes {
+		if s, ok := g.Debug.Nodes[n.ID]; ok {
+			nodes[n.ID] = s
+		}
+	}
+	segments := make(map[uint32]SourceInfo, len(g.Debug.Segments))
+	for _, s := range g.Segments {
+		if info, ok := g.Debug.Segments[s.ID]; ok {
+			segments[s.ID] = info
+		}
+	}
+	if err := writeSourceTable(buf, nodes); err != nil {
+		return fmt.Errorf("node %w", err)
+	}
+	if err := writeSourceTable(buf, segments); err != nil {
+		return fmt.Errorf("segment %w", err)
+	}
+	return nil
+}
+
+// writeSourceTable writes one table of the DBUG section
+func writeSourceTable(buf *bytes.Buffer, table map[uint32]SourceInfo) error {
+	ids := make([]uint32, 0, len(table))
+	for id := range table {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var b [12]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(ids)))
+	buf.Write(b[:4])
+	for _, id := range ids {
+		s := table[id]
+		if len(s.Name) > 0xFFFF || len(s.File) > 0xFFFF || s.Line < 0 || uint64(s.Line) > 0xFFFFFFFF {
+			return fmt.Errorf("%d: debug entry out of range", id)
+		}
+		binary.LittleEndian.PutUint32(b[0:], id)
+		binary.LittleEndian.PutUint32(b[4:], uint32(s.Line))
+		binary.LittleEndian.PutUint16(b[8:], uint16(len(s.Name)))
+		binary.LittleEndian.PutUint16(b[10:], uint16(len(s.File)))
+		buf.Write(b[:])
+		buf.WriteString(s.Name)
+		buf.WriteString(s.File)
+	}
+	return nil
+}
+
+// readDebug reads a section written by writeDebug
+func readDebug(body []byte) (*DebugInfo, error) {
+	var d DebugInfo
+	var err error
+	if d.Nodes, body, err = readSourceTable(body); err != nil {
+		return nil, fmt.Errorf("node table: %w", err)
+	}
+	if d.Segments, _, err = readSourceTable(body); err != nil {
+		return nil, fmt.Errorf("segment table: %w", err)
+	}
+	return &d, nil
+}
+
+// readSourceTable reads one table of the DBUG section and returns the rest
+// of the body
+func readSourceTable(body []byte) (map[uint32]SourceInfo, []byte, error) {
+	if len(body) < 4 {
+		return nil, nil, fmt.Errorf("truncated entry count")
+	}
+	count := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	table := make(map[uint32]SourceInfo, min(count, 1024))
+	for i := uint32(0); i < count; i++ {
+		if len(body) < 12 {
+			return nil, nil, fmt.Errorf("entry %d: truncated header", i)
+		}
+		id := binary.LittleEndian.Uint32(body)
+		line := binary.LittleEndian.Uint32(body[4:])
+		nl, fl := int(binary.LittleEndian.Uint16(body[8:])), int(binary.LittleEndian.Uint16(body[10:]))
+		body = body[12:]
+		if len(body) < nl+fl {
+			return nil, nil, fmt.Errorf("entry %d: truncated name or file", i)
+		}
+		if _, dup := table[id]; dup {
+			return nil, nil, fmt.Errorf("duplicate ID %d", id)
+		}
+		table[id] = SourceInfo{Name: string(body[:nl]), File: string(body[nl : nl+fl]), Line: int(line)}
+		body = body[nl+fl:]
+	}
+	return table, body, nil
+}
@@ -0,0 +1,219 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// NodeChange describes a node present in both graphs that differs
+type NodeChange struct {
+	ID            uint32
+	Before, After Node
+	Fields        []string // Changed fields: kernel, in, out, flags, topo, segment, payload
+	PayloadBytes  int      // Bytes of the node's [In, Out) payload range that differ
+}
+
+// ByteRange is a half-open range [Offset, Offset+Length) of payload bytes
+type ByteRange struct {
+	Offset, Length int
+}
+
+// GraphDiff is the structural difference between two graphs, as returned by
+// Diff. Node lists are sorted by ID.
+type GraphDiff struct {
+	Added    []Node
+	Removed  []Node
+	Modified []NodeChange
+
+	PayloadBefore, PayloadAfter int         // Payload sizes in bytes
+	PayloadRanges               []ByteRange // Differing payload bytes, merged into ranges
+	PayloadBytes                int         // Total differing payload bytes
+
+	IOAdded, IORemoved []IOSpec // IO specs in only one graph; a changed spec is in both lists
+	FlagsChanged       bool
+}
+
+// Diff compares graph a (before) with graph b (after). Nodes are matched by
+// ID; a node whose fields are equal but whose payload range holds different
+// bytes is reported as modified with the "payload" field. Bytes past the end
+// of the shorter payload count as differing.
+func Diff(a, b *Graph) *GraphDiff {
+	d := &GraphDiff{
+		PayloadBefore: len(a.Payload),
+		PayloadAfter:  len(b.Payload),
+		FlagsChanged:  a.Flags != b.Flags,
+	}
+
+	before := make(map[uint32]Node, len(a.Nodes))
+	for _, n := range a.Nodes {
+		before[n.ID] = n
+	}
+	after := make(map[uint32]Node, len(b.Nodes))
+	for _, n := range b.Nodes {
+		after[n.ID] = n
+		old, ok := before[n.ID]
+		if !ok {
+			d.Added = append(d.Added, n)
+			continue
+		}
+		if change := diffNode(old, n, a.Payload, b.Payload); len(change.Fields) > 0 {
+			d.Modified = append(d.Modified, change)
+		}
+	}
+	for _, n := range a.Nodes {
+		if _, ok := after[n.ID]; !ok {
+			d.Removed = append(d.Removed, n)
+		}
+	}
+	byID := func(x, y Node) int { return cmp.Compare(x.ID, y.ID) }
+	slices.SortFunc(d.Added, byID)
+	slices.SortFunc(d.Removed, byID)
+	slices.SortFunc(d.Modified, func(x, y NodeChange) int { return cmp.Compare(x.ID, y.ID) })
+
+	d.diffPayload(a.Payload, b.Payload)
+	d.IOAdded = missingIO(b.IO, a.IO)
+	d.IORemoved = missingIO(a.IO, b.IO)
+	return d
+}
+
+// Empty reports whether the graphs compared equal
+func (d *GraphDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0 &&
+		d.PayloadBytes == 0 && len(d.IOAdded) == 0 && len(d.IORemoved) == 0 && !d.FlagsChanged
+}
+
+// String formats the diff as one line per change
+func (d *GraphDiff) String() string {
+	if d.Empty() {
+		return "graphs are identical\n"
+	}
+	var b strings.Builder
+	for _, n := range d.Added {
+		fmt.Fprintf(&b, "+ node %d kernel %d in %d out %d\n", n.ID, n.Kernel, n.In, n.Out)
+	}
+	for _, n := range d.Removed {
+		fmt.Fprintf(&b, "- node %d kernel %d in %d out %d\n", n.ID, n.Kernel, n.In, n.Out)
+	}
+	for _, c := range d.Modified {
+		fmt.Fprintf(&b, "~ node %d: %s", c.ID, strings.Join(c.Fields, ", "))
+		if c.PayloadBytes > 0 {
+			fmt.Fprintf(&b, " (%d payload bytes)", c.PayloadBytes)
+		}
+		b.WriteByte('\n')
+	}
+	for _, s := range d.IOAdded {
+		fmt.Fprintf(&b, "+ %v %v\n", s.Kind, s)
+	}
+	for _, s := range d.IORemoved {
+		fmt.Fprintf(&b, "- %v %v\n", s.Kind, s)
+	}
+	if d.FlagsChanged {
+		b.WriteString("~ header flags\n")
+	}
+	if d.PayloadBytes > 0 {
+		fmt.Fprintf(&b, "~ payload: %d of %d bytes differ in %d ranges (%d -> %d bytes)\n",
+			d.PayloadBytes, max(d.PayloadBefore, d.PayloadAfter), len(d.PayloadRanges), d.PayloadBefore, d.PayloadAfter)
+	}
+	return b.String()
+}
+
+// diffNode compares two versions of a node
+func diffNode(a, b Node, payloadA, payloadB []byte) NodeChange {
+	c := NodeChange{ID: a.ID, Before: a, After: b}
+	if a.Kernel != b.Kernel {
+		c.Fields = append(c.Fields, "kernel")
+	}
+	if a.In != b.In {
+		c.Fields = append(c.Fields, "in")
+	}
+	if a.Out != b.Out {
+		c.Fields = append(c.Fields, "out")
+	}
+	if a.Flags != b.Flags {
+		c.Fields = append(c.Fields, "flags")
+	}
+	if !slices.Equal(usedTopo(a.Topo), usedTopo(b.Topo)) {
+		c.Fields = append(c.Fields, "topo")
+	}
+	if a.Segment != b.Segment {
+		c.Fields = append(c.Fields, "segment")
+	}
+	ra, rb := nodeRange(a, payloadA), nodeRange(b, payloadB)
+	c.PayloadBytes = countDiff(ra, rb)
+	if c.PayloadBytes > 0 {
+		c.Fields = append(c.Fields, "payload")
+	}
+	return c
+}
+
+// diffPayload records the differing byte ranges of two payloads
+func (d *GraphDiff) diffPayload(a, b []byte) {
+	start := -1
+	for i := 0; i < max(len(a), len(b)); i++ {
+		same := i < len(a) && i < len(b) && a[i] == b[i]
+		switch {
+		case !same && start < 0:
+			start = i
+		case same && start >= 0:
+			d.PayloadRanges = append(d.PayloadRanges, ByteRange{start, i - start})
+			start = -1
+		}
+		if !same {
+			d.PayloadBytes++
+		}
+	}
+	if start >= 0 {
+		d.PayloadRanges = append(d.PayloadRanges, ByteRange{start, max(len(a), len(b)) - start})
+	}
+}
+
+// nodeRange returns the node's [In, Out) payload bytes, clipped to payload
+func nodeRange(n Node, payload []byte) []byte {
+	in, out := min(int(n.In), len(payload)), min(int(n.Out), len(payload))
+	if out <= in {
+		return nil
+	}
+	return payload[in:out]
+}
+
+// countDiff counts differing bytes, treating a length difference as differing
+func countDiff(a, b []byte) int {
+	n := max(len(a), len(b)) - min(len(a), len(b))
+	for i := 0; i < min(len(a), len(b)); i++ {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// usedTopo drops unused NoNeighbor slots
+func usedTopo(topo []uint32) []uint32 {
+	var used []uint32
+	for _, id := range topo {
+		if id != NoNeighbor {
+			used = append(used, id)
+		}
+	}
+	return used
+}
+
+// missingIO returns the specs of a with no identical spec in b
+func missingIO(a, b []IOSpec) []IOSpec {
+	var missing []IOSpec
+	for _, s := range a {
+		found := false
+		for _, o := range b {
+			if o.Kind == s.Kind && o.String() == s.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// diffGraph is a chain of two nodes and a third independent one
+func diffGraph() *Graph {
+	payload := make([]byte, 224)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	return &Graph{
+		Payload: payload,
+		Nodes: []Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+			{ID: 2, Kernel: 1, In: 128, Out: 192},
+		},
+	}
+}
+
+func TestGraphDiff(t *testing.T) {
+	t.Parallel()
+	a := diffGraph()
+	a.IO = []IOSpec{{Name: "x", NodeID: 0, Shape: []int{4}}}
+	if d := Diff(a, a); !d.Empty() || d.String() != "graphs are identical\n" {
+		t.Fatalf("Expected an empty diff, got %s", d)
+	}
+
+	b := diffGraph()
+	b.Payload[a.Nodes[1].In+3] ^= 0xFF  // A retrained weight of node 1
+	b.Payload = append(b.Payload, 1, 2) // Grown payload
+	b.Nodes[2].Kernel++
+	b.Nodes[2].Topo = append(b.Nodes[2].Topo, NoNeighbor) // Padding only
+	b.Nodes = append(b.Nodes[1:], Node{ID: 9, Out: 32})   // Node 0 removed
+	b.IO = []IOSpec{{Name: "x", NodeID: 1, Shape: []int{4}}}
+	b.Flags = FlagDebug
+
+	d := Diff(a, b)
+	if len(d.Added) != 1 || d.Added[0].ID != 9 || len(d.Removed) != 1 || d.Removed[0].ID != 0 {
+		t.Errorf("Expected node 9 added and node 0 removed, got %v and %v", d.Added, d.Removed)
+	}
+	if len(d.Modified) != 2 {
+		t.Fatalf("Expected 2 modified nodes, got %+v", d.Modified)
+	}
+	if c := d.Modified[0]; c.ID != 1 || !slices.Equal(c.Fields, []string{"payload"}) || c.PayloadBytes != 1 {
+		t.Errorf("Unexpected change to node 1: %+v", c)
+	}
+	if c := d.Modified[1]; c.ID != 2 || !slices.Equal(c.Fields, []string{"kernel"}) {
+		t.Errorf("Unexpected change to node 2: %+v", c)
+	}
+	want := []ByteRange{{Offset: int(a.Nodes[1].In) + 3, Length: 1}, {Offset: len(a.Payload), Length: 2}}
+	if !slices.Equal(d.PayloadRanges, want) || d.PayloadBytes != 3 || d.PayloadAfter != d.PayloadBefore+2 {
+		t.Errorf("Expected payload ranges %v (3 bytes), got %v (%d bytes)", want, d.PayloadRanges, d.PayloadBytes)
+	}
+	if len(d.IOAdded) != 1 || len(d.IORemoved) != 1 || !d.FlagsChanged {
+		t.Errorf("Expected the moved IO spec and flags to differ, got %+v", d)
+	}
+	for _, line := range []string{"+ node 9", "- node 0", "~ node 1: payload (1 payload bytes)", "~ node 2: kernel", "~ header flags", "3 of"} {
+		if !strings.Contains(d.String(), line) {
+			t.Errorf("Expected report to contain %q:\n%s", line, d)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+// ToDOT writes the graph in Graphviz DOT format: one box per node labeled
+// with its ID, kernel name and payload range, and an edge from every
+// dependency to the node that consumes it. Nodes bound to a named input or
+// output are drawn bold with the IO spec in their label.
+func (g *Graph) ToDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	fmt.Fprintln(bw, "digraph sublation {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [shape=box, fontname=monospace];")
+	for _, n := range g.Nodes {
+		style := ""
+		if len(g.nodeIO(n.ID)) > 0 {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(bw, "\tn%d [label=\"%s\"%s];\n", n.ID, quote.Replace(g.nodeLabel(n)), style)
+	}
+	g.forEachEdge(func(from, to uint32) {
+		fmt.Fprintf(bw, "\tn%d -> n%d;\n", from, to)
+	})
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// ToMermaid writes the graph as a Mermaid flowchart with the same nodes,
+// labels and edges as ToDOT
+func (g *Graph) ToMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	quote := strings.NewReplacer(`"`, "#quot;", "\n", "<br/>")
+	fmt.Fprintln(bw, "flowchart LR")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(bw, "\tn%d[\"%s\"]\n", n.ID, quote.Replace(g.nodeLabel(n)))
+	}
+	g.forEachEdge(func(from, to uint32) {
+		fmt.Fprintf(bw, "\tn%d --> n%d\n", from, to)
+	})
+	return bw.Flush()
+}
+
+// nodeLabel returns the multi-line label of a node
+func (g *Graph) nodeLabel(n Node) string {
+	label := fmt.Sprintf("%d: %s", n.ID, kernels.OpName(n.Kernel))
+	if n.Out > n.In {
+		label += fmt.Sprintf("\n[%d, %d) %d B", n.In, n.Out, n.Out-n.In)
+	} else {
+		label += fmt.Sprintf("\nin %d, out %d", n.In, n.Out)
+	}
+	for _, s := range g.nodeIO(n.ID) {
+		label += fmt.Sprintf("\n%v %v", s.Kind, s)
+	}
+	return label
+}
+
+// nodeIO returns the IO specs bound to node id
+func (g *Graph) nodeIO(id uint32) []IOSpec {
+	var specs []IOSpec
+	for _, s := range g.IO {
+		if s.NodeID == id {
+			specs = append(specs, s)
+		}
+	}
+	return specs
+}
+
+// forEachEdge calls fn for every dependency edge between nodes of the graph,
+// skipping unused slots and references to missing nodes
+func (g *Graph) forEachEdge(fn func(from, to uint32)) {
+	ids := make(map[uint32]bool, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids[n.ID] = true
+	}
+	for _, n := range g.Nodes {
+		for _, dep := range n.Topo {
+			if dep != NoNeighbor && ids[dep] {
+				fn(dep, n.ID)
+			}
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+)
+
+// maxFoldBytes bounds the size of the values Fold evaluates
+const maxFoldBytes = 1 << 22
+
+// FoldStats counts the rewrites made by Fold
+type FoldStats struct {
+	Folded     int // Nodes evaluated at compile time
+	Chains     int // add or mul nodes merged into the next one of a chain
+	Identities int // Identity nodes bypassed
+}
+
+// Fold simplifies the graph using the data flow InferShapes assumes. Nodes
+// whose operands are all constant, read from their payload or computed by
+// other constant nodes, are evaluated with their kernels: those consumed by
+// other nodes or left as outputs become noop nodes holding their value and
+// the others are removed. Chains of add or of mul nodes with one constant
+// operand each collapse into a single node, and identity nodes, a noop with
+// one dependency or an add of zeros or mul by ones, are bypassed. The first
+// node, which streaming executions read, nodes bound to IO specs and tied
+// nodes are kept. Kernels reading a payload header are left alone. The
+// payload is compacted as by Prune and shapes are inferred again; costs of
+// removed nodes are dropped.
+func (g *Graph) Fold() (FoldStats, error) {
+	if len(g.Nodes) == 0 {
+		return FoldStats{}, nil
+	}
+	f, err := newFolder(g)
+	if err != nil {
+		return FoldStats{}, err
+	}
+	f.evaluate()
+	f.replaceConstants()
+	f.mergeChains()
+	f.bypassIdentities()
+	f.dropOrphans()
+	g.replaceNodes(slices.Concat(g.Nodes, f.added), f.removed, f.consts, f.vals)
+	return f.stats, g.InferShapes()
+}
+
+// folder holds the state of one Fold
+type folder struct {
+	g      *Graph
+	stats  FoldStats
+	order  []int
+	index  map[uint32]int
+	nextID uint64
+
+	keep       map[uint32]bool     // Nodes that must stay
+	fixed      map[uint32]bool     // Nodes whose output is not theirs to fold
+	consumers  map[uint32][]uint32 // Consumers of every node
+	orphanable map[uint32]bool     // Constants removed once they lose their consumers
+
+	vals    map[uint32][]byte // Values of the constant nodes
+	removed map[uint32]bool
+	consts  []uint32 // Nodes whose payload becomes their value
+	added   []Node
+}
+
+// newFolder infers the shapes of g and indexes its nodes and consumers
+func newFolder(g *Graph) (*folder, error) {
+	if err := g.InferShapes(); err != nil {
+		return nil, err
+	}
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	f := &folder{
+		g:         g,
+		order:     order,
+		index:     make(map[uint32]int, len(g.Nodes)),
+		keep:      map[uint32]bool{g.Nodes[0].ID: true},
+		fixed:     make(map[uint32]bool),
+		consumers: make(map[uint32][]uint32),
+		vals:      make(map[uint32][]byte),
+		removed:   make(map[uint32]bool),
+	}
+	for i, n := range g.Nodes {
+		if _, dup := f.index[n.ID]; dup {
+			return nil, fmt.Errorf("fold: duplicate node ID %d", n.ID)
+		}
+		f.index[n.ID] = i
+		f.nextID = max(f.nextID, uint64(n.ID)+1)
+	}
+
+	for _, s := range g.IO {
+		f.keep[s.NodeID] = true
+		if s.Kind == Input {
+			f.fixed[s.NodeID] = true
+		}
+	}
+	for _, n := range g.Nodes {
+		if n.Flags&core.FlagShared != 0 {
+			f.keep[n.ID], f.fixed[n.ID] = true, true
+		}
+		for _, dep := range liveDeps(n) {
+			f.consumers[dep] = append(f.consumers[dep], n.ID)
+		}
+	}
+	// Constants that lose their consumers are removed, sinks are outputs
+	f.orphanable = make(map[uint32]bool, len(f.consumers))
+	for id := range f.consumers {
+		f.orphanable[id] = true
+	}
+	return f, nil
+}
+
+// evaluate computes the value of every constant node in dependency order
+func (f *folder) evaluate() {
+	for _, i := range f.order {
+		n := f.g.Nodes[i]
+		if f.fixed[n.ID] {
+			continue
+		}
+		var ins [][]byte
+		for _, dep := range liveDeps(n) {
+			v, ok := f.vals[dep]
+			if !ok {
+				ins = nil
+				break
+			}
+			ins = append(ins, v)
+		}
+		if len(ins) != len(liveDeps(n)) {
+			continue
+		}
+		if v, ok := f.g.evalConst(n, ins); ok {
+			f.vals[n.ID] = v
+		}
+	}
+}
+
+// replaceConstants removes the constants only other constants consume and
+// turns the others into noop nodes holding their value
+func (f *folder) replaceConstants() {
+	for i := range f.g.Nodes {
+		n := &f.g.Nodes[i]
+		if _, ok := f.vals[n.ID]; !ok {
+			continue
+		}
+		source := n.Kernel == kernels.OpNoop && len(liveDeps(*n)) == 0
+		if !source {
+			f.stats.Folded++
+		}
+		used := f.keep[n.ID] || len(f.consumers[n.ID]) == 0
+		for _, c := range f.consumers[n.ID] {
+			if _, ok := f.vals[c]; !ok {
+				used = true
+			}
+		}
+		switch {
+		case !used:
+			f.removed[n.ID] = true
+		case !source:
+			n.Kernel, n.Topo = kernels.OpNoop, nil
+			f.consts = append(f.consts, n.ID)
+		}
+	}
+}
+
+// mergeChains rewrites op(op(x, c1), c2) as op(x, c1 op c2)
+func (f *folder) mergeChains() {
+	for _, i := range f.order {
+		n := &f.g.Nodes[i]
+		if f.removed[n.ID] || f.fixed[n.ID] || (n.Kernel != kernels.OpAdd && n.Kernel != kernels.OpMul) {
+			continue
+		}
+		x, c, ok := splitConst(*n, f.vals)
+		if !ok {
+			continue
+		}
+		a := &f.g.Nodes[f.index[x]]
+		if a.Kernel != n.Kernel || f.keep[a.ID] || f.fixed[a.ID] || len(f.consumers[a.ID]) != 1 {
+			continue
+		}
+		y, c1, ok := splitConst(*a, f.vals)
+		if !ok || f.nextID >= NoNeighbor {
+			continue
+		}
+		buf := append(slices.Clone(f.vals[c1]), f.vals[c]...)
+		kernels.Catalog[n.Kernel](buf)
+		id := uint32(f.nextID)
+		f.nextID++
+		f.vals[id] = buf[: len(buf)/2 : len(buf)/2]
+		f.added = append(f.added, Node{ID: id, Kernel: kernels.OpNoop})
+		f.consts = append(f.consts, id)
+		f.orphanable[id] = true
+		f.g.Shapes[id] = f.g.Shapes[c]
+
+		n.Topo = []uint32{y, id}
+		f.consumers[y] = replaceID(f.consumers[y], a.ID, n.ID)
+		f.removed[a.ID] = true
+		f.stats.Chains++
+	}
+}
+
+// bypassIdentities makes the consumers of noop(x), add(x, 0) and mul(x, 1)
+// use x
+func (f *folder) bypassIdentities() {
+	for _, i := range f.order {
+		n := &f.g.Nodes[i]
+		if _, ok := f.vals[n.ID]; ok || f.removed[n.ID] || f.keep[n.ID] || f.fixed[n.ID] {
+			continue
+		}
+		var x uint32
+		switch deps := liveDeps(*n); {
+		case n.Kernel == kernels.OpNoop && len(deps) == 1:
+			x = deps[0]
+		case n.Kernel == kernels.OpAdd || n.Kernel == kernels.OpMul:
+			var c uint32
+			var ok bool
+			if x, c, ok = splitConst(*n, f.vals); !ok || !allFloats(f.vals[c], map[byte]float32{kernels.OpAdd: 0, kernels.OpMul: 1}[n.Kernel]) {
+				continue
+			}
+		default:
+			continue
+		}
+		users := slices.DeleteFunc(slices.Clone(f.consumers[n.ID]), func(c uint32) bool { return f.removed[c] })
+		if slices.ContainsFunc(users, func(c uint32) bool { return slices.Contains(f.g.Nodes[f.index[c]].Topo, x) }) {
+			continue
+		}
+		for _, c := range users {
+			cn := &f.g.Nodes[f.index[c]]
+			cn.Topo = replaceID(slices.Clone(cn.Topo), n.ID, x)
+			f.consumers[x] = append(f.consumers[x], c)
+		}
+		f.consumers[x] = slices.DeleteFunc(f.consumers[x], func(c uint32) bool { return c == n.ID })
+		f.removed[n.ID] = true
+		f.stats.Identities++
+	}
+}
+
+// dropOrphans removes the constants the rewrites left without consumers
+func (f *folder) dropOrphans() {
+	all := slices.Concat(f.g.Nodes, f.added)
+	for changed := true; changed; {
+		changed = false
+		uses := make(map[uint32]int)
+		for _, n := range all {
+			if !f.removed[n.ID] {
+				for _, dep := range liveDeps(n) {
+					uses[dep]++
+				}
+			}
+		}
+		for _, n := range all {
+			_, constant := f.vals[n.ID]
+			if constant && f.orphanable[n.ID] && !f.removed[n.ID] && !f.keep[n.ID] && uses[n.ID] == 0 {
+				f.removed[n.ID] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// replaceNodes keeps the nodes of all not removed, gives the nodes in
+// consts new payload ranges holding their entry in vals and compacts the
+// payload
+func (g *Graph) replaceNodes(all []Node, removed map[uint32]bool, consts []uint32, vals map[uint32][]byte) {
+	var nodes []Node
+	segUsers := make(map[uint32]int)
+	referenced := make(map[uint32]bool)
+	for _, n := range all {
+		referenced[n.Segment] = true
+		if !removed[n.ID] {
+			nodes = append(nodes, n)
+			segUsers[n.Segment]++
+		}
+	}
+
+	payload := g.Payload
+	for _, id := range consts {
+		if removed[id] {
+			continue
+		}
+		i := slices.IndexFunc(nodes, func(n Node) bool { return n.ID == id })
+		n := &nodes[i]
+		off := core.Align32(len(payload))
+		payload = append(payload, make([]byte, off-len(payload))...)
+		payload = append(payload, vals[id]...)
+		n.In, n.Out = uint32(off), uint32(len(payload))
+		if n.Segment == 0 {
+			continue
+		}
+		if j := slices.IndexFunc(g.Segments, func(s Segment) bool { return s.ID == n.Segment }); j >= 0 && segUsers[n.Segment] == 1 {
+			s := &g.Segments[j]
+			s.Offset, s.Length, s.DType = n.In, n.Out-n.In, Float32
+		} else {
+			n.Segment = 0
+		}
+	}
+
+	// Segments no node referenced before folding are kept, they may be
+	// filled or referenced later
+	var segs []Segment
+	for _, s := range g.Segments {
+		if segUsers[s.ID] > 0 || !referenced[s.ID] {
+			segs = append(segs, s)
+		}
+	}
+	ranges := make([][2]uint32, 0, len(nodes)+len(segs))
+	for _, n := range nodes {
+		if n.Out > n.In {
+			ranges = append(ranges, [2]uint32{n.In, n.Out})
+		}
+	}
+	for _, s := range segs {
+		if s.Length > 0 {
+			ranges = append(ranges, [2]uint32{s.Offset, s.End()})
+		}
+	}
+	payload, move := compactRanges(payload, ranges, 32)
+	for i := range nodes {
+		nodes[i].In, nodes[i].Out = move(nodes[i].In), move(nodes[i].Out)
+	}
+	for i := range segs {
+		segs[i].Offset = move(segs[i].Offset)
+	}
+
+	for id := range g.Costs {
+		if removed[id] {
+			delete(g.Costs, id)
+		}
+	}
+	g.IO = slices.DeleteFunc(g.IO, func(s IOSpec) bool { return removed[s.NodeID] })
+	g.Nodes, g.Payload, g.Segments = nodes, payload, segs
+}
+
+// evalConst computes the output of n from the values of its dependencies,
+// or its payload operands when it has none. ok is false for kernels Fold
+// does not evaluate and operands that do not match the node's shape.
+func (g *Graph) evalConst(n Node, ins [][]byte) (v []byte, ok bool) {
+	shape, known := g.Shapes[n.ID]
+	size := 4 * kernels.Elements(shape)
+	if !known || size == 0 || size > maxFoldBytes {
+		return nil, false
+	}
+	var payload []byte
+	if n.Out > n.In && int(n.Out) <= len(g.Payload) {
+		payload = g.Payload[n.In:n.Out]
+	}
+
+	var buf []byte
+	out := size
+	switch n.Kernel {
+	case kernels.OpNoop, kernels.OpSqrPlusX, kernels.OpReLU, kernels.OpSigmoid, kernels.OpTanh, kernels.OpSoftmax:
+		switch {
+		case len(ins) == 1 && len(ins[0]) == size:
+			buf = slices.Clone(ins[0])
+		case len(ins) == 0 && len(payload) >= size:
+			buf = slices.Clone(payload[:size])
+		default:
+			return nil, false
+		}
+	case kernels.OpAdd, kernels.OpMul:
+		switch {
+		case len(ins) == 2 && len(ins[0]) == size && len(ins[1]) == size:
+			buf = slices.Concat(ins[0], ins[1])
+		case len(ins) == 0 && len(payload) >= 2*size:
+			buf = slices.Clone(payload[:2*size])
+		default:
+			return nil, false
+		}
+	case kernels.OpSum, kernels.OpMax:
+		switch {
+		case len(ins) == 1:
+			buf = slices.Clone(ins[0])
+		case len(ins) == 0:
+			buf = slices.Clone(payload[:len(payload)&^3])
+		}
+		if len(buf) == 0 || len(buf) > maxFoldBytes || size != 4 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	kernels.Catalog[n.Kernel](buf)
+	return buf[:out:out], true
+}
+
+// liveDeps returns the dependencies of n, without NoNeighbor entries
+func liveDeps(n Node) []uint32 {
+	return slices.DeleteFunc(slices.Clone(n.Topo), func(dep uint32) bool { return dep == NoNeighbor })
+}
+
+// splitConst returns the operands of a node consuming exactly one
+// non-constant node x and one constant node c
+func splitConst(n Node, vals map[uint32][]byte) (x, c uint32, ok bool) {
+	deps := liveDeps(n)
+	if len(deps) != 2 {
+		return 0, 0, false
+	}
+	_, c0 := vals[deps[0]]
+	_, c1 := vals[deps[1]]
+	switch {
+	case !c0 && c1:
+		return deps[0], deps[1], true
+	case c0 && !c1:
+		return deps[1], deps[0], true
+	}
+	return 0, 0, false
+}
+
+// replaceID replaces from by to in ids
+func replaceID(ids []uint32, from, to uint32) []uint32 {
+	for i, id := range ids {
+		if id == from {
+			ids[i] = to
+		}
+	}
+	return ids
+}
+
+// allFloats reports whether v holds only float32 values equal to f
+func allFloats(v []byte, f float32) bool {
+	for i := 0; i+4 <= len(v); i += 4 {
+		if math.Float32frombits(binary.LittleEndian.Uint32(v[i:])) != f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,311 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Version 2 is the canonical .subl format: the compiler emits it, Serialize
+// writes it and the runtime loads it. Every structure starts on a 32-byte
+// boundary so the payload can be used in place from a mapped file:
+//
+//	header   magic u32 | version u16 | flags u16 | section count u32 |
+//	         target u8 | reserved [19]
+//	section  tag u32 | flags u32 | body length u64 | crc32 u32 | reserved u32 |
+//	         raw length u64 | body | pad to 32
+//
+// The CRC-32 (IEEE) covers the stored section body and is checked when the
+// section has sectionFlagCRC set. Raw length is set for compressed sections
+// only, see Compression. Readers skip sections with unknown tags, so later
+// versions can add sections without breaking older runtimes.
+const (
+	headerSize        = 32
+	sectionHeaderSize = 32
+	sectionAlign      = 32
+)
+
+// ErrChecksum reports a section whose body does not match its CRC-32
+var ErrChecksum = errors.New("section checksum mismatch")
+
+// Header flags, stored in Graph.Flags
+const (
+	FlagDebug = 1 << 0 // Compiled with debug output
+)
+
+// sectionFlagCRC marks a section carrying a CRC-32 of its body
+const sectionFlagCRC = 1 << 0
+
+// Section tags, four ASCII bytes read as a little-endian uint32
+const (
+	sectionNodes   = 0x45444F4E // "NODE"
+	sectionIO      = 0x50534F49 // "IOSP"
+	sectionPayload = 0x4C594150 // "PAYL"
+)
+
+// section is one tagged region of a version 2 file
+type section struct {
+	tag    uint32
+	flags  uint32
+	body   []byte
+	offset int    // Start of the section header in the file, set when reading
+	rawLen uint64 // Uncompressed body length of a compressed section
+}
+
+func writeFileHeader(buf *bytes.Buffer, flags uint16, target Target, sections int) {
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint32(header[0:], Magic)
+	binary.LittleEndian.PutUint16(header[4:], Version2)
+	binary.LittleEndian.PutUint16(header[6:], flags)
+	binary.LittleEndian.PutUint32(header[8:], uint32(sections))
+	header[12] = byte(target)
+	buf.Write(header[:])
+}
+
+func (s section) writeTo(buf *bytes.Buffer) {
+	var header [sectionHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:], s.tag)
+	binary.LittleEndian.PutUint32(header[4:], s.flags|sectionFlagCRC)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(s.body)))
+	binary.LittleEndian.PutUint32(header[16:], crc32.ChecksumIEEE(s.body))
+	binary.LittleEndian.PutUint64(header[24:], s.rawLen)
+	buf.Write(header[:])
+	buf.Write(s.body)
+	buf.Write(make([]byte, alignUp(len(s.body))-len(s.body)))
+}
+
+// readSections splits a version 2 file into its sections
+func readSections(data []byte) ([]section, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("truncated header: %d bytes", len(data))
+	}
+	count := binary.LittleEndian.Uint32(data[8:])
+	sections := make([]section, 0, min(count, 16))
+	off := headerSize
+	for i := uint32(0); i < count; i++ {
+		if len(data)-off < sectionHeaderSize {
+			return nil, fmt.Errorf("section %d: truncated header at offset %d", i, off)
+		}
+		s := section{
+			tag:    binary.LittleEndian.Uint32(data[off:]),
+			flags:  binary.LittleEndian.Uint32(data[off+4:]),
+			offset: off,
+			rawLen: binary.LittleEndian.Uint64(data[off+24:]),
+		}
+		length := binary.LittleEndian.Uint64(data[off+8:])
+		sum := binary.LittleEndian.Uint32(data[off+16:])
+		off += sectionHeaderSize
+		if length > uint64(len(data)-off) {
+			return nil, fmt.Errorf("section %d: %d bytes exceed the file", i, length)
+		}
+		s.body = data[off : off+int(length)]
+		if s.flags&sectionFlagCRC != 0 && crc32.ChecksumIEEE(s.body) != sum {
+			return nil, fmt.Errorf("section %d (%s): %w", i, tagName(s.tag), ErrChecksum)
+		}
+		off += min(alignUp(int(length)), len(data)-off)
+		sections = append(sections, s)
+	}
+	return sections, nil
+}
+
+// SectionInfo describes a section of a version 2 file, as listed by
+// Sections
+type SectionInfo struct {
+	Tag         string // Four ASCII bytes, such as "NODE"
+	Offset      int    // Of the section header in the file
+	Size        int    // Stored body bytes, without header and padding
+	RawSize     int
+	Compression Compression
+}
+
+// Sections lists the sections of a version 2 file in file order, checking
+// their checksums but not decoding them. RawSize is the uncompressed body
+// size, Size for sections stored as is.
+func Sections(data []byte) ([]SectionInfo, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint32(data) != Magic || binary.LittleEndian.Uint16(data[4:]) != Version2 {
+		return nil, fmt.Errorf("not a version 2 file")
+	}
+	sections, err := readSections(data)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SectionInfo, len(sections))
+	for i, s := range sections {
+		c, err := s.codec(uint64(len(s.body)))
+		if err != nil {
+			return nil, err
+		}
+		infos[i] = SectionInfo{Tag: tagName(s.tag), Offset: s.offset, Size: len(s.body), RawSize: len(s.body), Compression: c}
+		if c != CompressNone {
+			infos[i].RawSize = int(s.rawLen)
+		}
+	}
+	return infos, nil
+}
+
+// deserializeV2 reads a version 2 file
+func deserializeV2(data []byte) (*Graph, error) {
+	sections, err := readSections(data)
+	if err != nil {
+		return nil, err
+	}
+	d := graphDecoder{g: &Graph{Flags: binary.LittleEndian.Uint16(data[6:]), Target: Target(data[12])}}
+	for i, s := range sections {
+		if s.tag == sectionSignature {
+			if i != len(sections)-1 {
+				return nil, fmt.Errorf("SIGN section must be last")
+			}
+			if _, _, err := checkDigest(data, s); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		body, err := s.decode()
+		if err != nil {
+			return nil, err
+		}
+		if s.tag == sectionPayload && s.rawLen == 0 {
+			body = bytes.Clone(body) // Do not alias the caller's buffer
+		}
+		if err := d.add(s.tag, body); err != nil {
+			return nil, err
+		}
+	}
+	return d.finish()
+}
+
+// graphDecoder assembles a Graph from decoded version 2 sections
+type graphDecoder struct {
+	g                      *Graph
+	haveNodes, havePayload bool
+	bindings               map[uint32]uint32 // Node segment IDs from SEGM
+}
+
+// add decodes one section body into the graph, skipping unknown tags
+func (d *graphDecoder) add(tag uint32, body []byte) error {
+	var err error
+	g := d.g
+	switch tag {
+	case sectionNodes:
+		if g.Nodes, err = readNodeSection(body); err != nil {
+			return fmt.Errorf("NODE section: %w", err)
+		}
+		d.haveNodes = true
+	case sectionIO:
+		if g.IO, err = readIOTable(bytes.NewReader(body)); err != nil {
+			return fmt.Errorf("IOSP section: %w", err)
+		}
+	case sectionMetadata:
+		if g.Meta, err = readMetadata(body); err != nil {
+			return fmt.Errorf("META section: %w", err)
+		}
+	case sectionShapes:
+		if g.Shapes, err = readShapes(body); err != nil {
+			return fmt.Errorf("SHAP section: %w", err)
+		}
+	case sectionSegments:
+		if g.Segments, d.bindings, err = readSegments(body); err != nil {
+			return fmt.Errorf("SEGM section: %w", err)
+		}
+	case sectionCosts:
+		if g.Costs, err = readCosts(body); err != nil {
+			return fmt.Errorf("COST section: %w", err)
+		}
+	case sectionDebug:
+		if g.Debug, err = readDebug(body); err != nil {
+			return fmt.Errorf("DBUG section: %w", err)
+		}
+	case sectionPayload:
+		g.Payload = body
+		d.havePayload = true
+	}
+	return nil
+}
+
+// finish checks that the required sections were present and binds nodes
+// to their segments
+func (d *graphDecoder) finish() (*Graph, error) {
+	if !d.haveNodes || !d.havePayload {
+		return nil, fmt.Errorf("missing NODE or PAYL section")
+	}
+	for i := range d.g.Nodes {
+		d.g.Nodes[i].Segment = d.bindings[d.g.Nodes[i].ID]
+	}
+	return d.g, nil
+}
+
+// writeNodeSection writes a node count followed by one entry per node: id,
+// in, out, flags (uint32), kernel (uint8), a reserved byte, the neighbor
+// count (uint16) and the neighbor ids (uint32)
+func writeNodeSection(buf *bytes.Buffer, nodes []Node) error {
+	var b [20]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(nodes)))
+	buf.Write(b[:4])
+	for _, n := range nodes {
+		if len(n.Topo) > 0xFFFF {
+			return fmt.Errorf("node %d has %d neighbors, limit %d", n.ID, len(n.Topo), 0xFFFF)
+		}
+		binary.LittleEndian.PutUint32(b[0:], n.ID)
+		binary.LittleEndian.PutUint32(b[4:], n.In)
+		binary.LittleEndian.PutUint32(b[8:], n.Out)
+		binary.LittleEndian.PutUint32(b[12:], n.Flags)
+		b[16], b[17] = n.Kernel, 0
+		binary.LittleEndian.PutUint16(b[18:], uint16(len(n.Topo)))
+		buf.Write(b[:])
+		for _, idx := range n.Topo {
+			binary.LittleEndian.PutUint32(b[:], idx)
+			buf.Write(b[:4])
+		}
+	}
+	return nil
+}
+
+// readNodeSection reads a section written by writeNodeSection
+func readNodeSection(body []byte) ([]Node, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("truncated node count")
+	}
+	count := binary.LittleEndian.Uint32(body)
+	if uint64(count)*20 > uint64(len(body)) {
+		return nil, fmt.Errorf("%d nodes exceed the section", count)
+	}
+	nodes := make([]Node, count)
+	off := 4
+	for i := range nodes {
+		if len(body)-off < 20 {
+			return nil, fmt.Errorf("node %d: truncated entry", i)
+		}
+		e := body[off:]
+		nodes[i] = Node{
+			ID:     binary.LittleEndian.Uint32(e[0:]),
+			In:     binary.LittleEndian.Uint32(e[4:]),
+			Out:    binary.LittleEndian.Uint32(e[8:]),
+			Flags:  binary.LittleEndian.Uint32(e[12:]),
+			Kernel: e[16],
+		}
+		topo := int(binary.LittleEndian.Uint16(e[18:]))
+		off += 20
+		if len(body)-off < topo*4 {
+			return nil, fmt.Errorf("node %d: truncated topology", i)
+		}
+		nodes[i].Topo = make([]uint32, topo)
+		for j := range nodes[i].Topo {
+			nodes[i].Topo[j] = binary.LittleEndian.Uint32(body[off:])
+			off += 4
+		}
+	}
+	return nodes, nil
+}
+
+// tagName returns the four ASCII bytes of a section tag
+func tagName(tag uint32) string {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], tag)
+	return string(b[:])
+}
+
+func alignUp(n int) int {
+	return (n + sectionAlign - 1) &^ (sectionAlign - 1)
+}
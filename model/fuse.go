@@ -0,0 +1,260 @@
+package model
+
+import (
+	"encoding/binary"
+	"slices"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+)
+
+// opActivation in a fusion rule matches relu, sigmoid or tanh
+const opActivation = 0x100
+
+// fusionRule is a chain of kernels, each consuming only the previous one,
+// that Fuse replaces by a single node running a fused kernel
+type fusionRule struct {
+	name  string
+	ops   []int // Kernels of the chain, producer first
+	fused byte
+	// build returns the payload of the fused node, or false when the chain
+	// does not fit the fused kernel
+	build func(g *Graph, chain []Node) ([]byte, bool)
+}
+
+// fusionRules are tried in order at every node, longer chains first
+var fusionRules = []fusionRule{
+	{"matmul+add+activation", []int{kernels.OpMatMul, kernels.OpAdd, opActivation}, kernels.OpMatMulBiasAct, buildMatMulBiasAct},
+	{"matmul+add", []int{kernels.OpMatMul, kernels.OpAdd}, kernels.OpMatMulBiasAct, buildMatMulBiasAct},
+	{"matmul+activation", []int{kernels.OpMatMul, opActivation}, kernels.OpMatMulBiasAct, buildMatMulBiasAct},
+	{"conv1d+batchnorm+activation", []int{kernels.OpConv1D, kernels.OpBatchNorm, opActivation}, kernels.OpConv1DBatchNorm, buildConv1DBatchNorm},
+	{"conv1d+batchnorm", []int{kernels.OpConv1D, kernels.OpBatchNorm}, kernels.OpConv1DBatchNorm, buildConv1DBatchNorm},
+}
+
+// Fuse replaces chains of nodes matching a fusion rule, such as a matmul
+// whose output only a bias add consumes, whose output only a relu consumes,
+// by one node running the fused kernel. The fused node keeps the ID of the
+// last node of the chain and the dependencies of the first. Chains whose
+// fused kernel is not in kernels.Catalog, or whose operands do not fit it,
+// are left alone; so are chains through the first node, nodes bound to IO
+// specs and tied nodes. Bias operands must be constant noop source nodes;
+// those no other node consumes are removed. It returns how often each rule
+// was applied, by rule name.
+func (g *Graph) Fuse() (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(g.Nodes) == 0 {
+		return counts, nil
+	}
+	if err := g.InferShapes(); err != nil {
+		return nil, err
+	}
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	index := g.nodeIndex()
+	consumers := make(map[uint32][]uint32)
+	for _, n := range g.Nodes {
+		for _, dep := range liveDeps(n) {
+			consumers[dep] = append(consumers[dep], n.ID)
+		}
+	}
+	pinned := map[uint32]bool{g.Nodes[0].ID: true}
+	for _, s := range g.IO {
+		pinned[s.NodeID] = true
+	}
+
+	removed := make(map[uint32]bool)
+	done := make(map[uint32]bool)
+	payloads := make(map[uint32][]byte)
+	var fused []uint32
+	biases := make(map[uint32]bool)
+	for _, i := range order {
+		first := g.Nodes[i]
+		if done[first.ID] {
+			continue
+		}
+		for _, r := range fusionRules {
+			chain := g.matchChain(first, r.ops, index, consumers, pinned, done)
+			if chain == nil || kernels.Catalog[r.fused] == nil {
+				continue
+			}
+			payload, ok := r.build(g, chain)
+			if !ok {
+				continue
+			}
+			last := &g.Nodes[index[chain[len(chain)-1].ID]]
+			for _, n := range chain {
+				done[n.ID] = true
+				if n.ID != last.ID {
+					removed[n.ID] = true
+				}
+				if n.Kernel == kernels.OpAdd {
+					if b, ok := biasOperand(g, n, chain, index); ok {
+						biases[b.ID] = true
+					}
+				}
+			}
+			*last = Node{ID: last.ID, Kernel: r.fused, Topo: slices.Clone(first.Topo)}
+			payloads[last.ID] = payload
+			fused = append(fused, last.ID)
+			counts[r.name]++
+			break
+		}
+	}
+	if len(fused) == 0 {
+		return counts, nil
+	}
+
+	// Biases no remaining node consumes go too
+	for id := range biases {
+		used := pinned[id]
+		for _, c := range consumers[id] {
+			if !removed[c] && slices.Contains(g.Nodes[index[c]].Topo, id) {
+				used = true
+			}
+		}
+		if !used {
+			removed[id] = true
+		}
+	}
+
+	g.replaceNodes(g.Nodes, removed, fused, payloads)
+	return counts, g.InferShapes()
+}
+
+// matchChain returns the nodes starting at first that match ops, each
+// intermediate node consumed only by the next, or nil
+func (g *Graph) matchChain(first Node, ops []int, index map[uint32]int, consumers map[uint32][]uint32, pinned, done map[uint32]bool) []Node {
+	chain := []Node{first}
+	for k, op := range ops {
+		n := chain[k]
+		if done[n.ID] || n.Flags&core.FlagShared != 0 || !matchOp(n.Kernel, op) {
+			return nil
+		}
+		if k == len(ops)-1 {
+			break
+		}
+		if pinned[n.ID] || len(consumers[n.ID]) != 1 {
+			return nil
+		}
+		next := g.Nodes[index[consumers[n.ID][0]]]
+		if deps := liveDeps(next); len(deps) != 1 && next.Kernel != kernels.OpAdd {
+			return nil
+		}
+		chain = append(chain, next)
+	}
+	return chain
+}
+
+// matchOp reports whether a kernel matches an entry of a fusion rule
+func matchOp(kernel byte, op int) bool {
+	if op == opActivation {
+		return kernel == kernels.OpReLU || kernel == kernels.OpSigmoid || kernel == kernels.OpTanh
+	}
+	return int(kernel) == op
+}
+
+// biasOperand returns the operand of the add node n that is not in chain,
+// when it is a constant noop source node
+func biasOperand(g *Graph, n Node, chain []Node, index map[uint32]int) (Node, bool) {
+	deps := liveDeps(n)
+	if len(deps) != 2 {
+		return Node{}, false
+	}
+	for _, dep := range deps {
+		if slices.ContainsFunc(chain, func(c Node) bool { return c.ID == dep }) {
+			continue
+		}
+		i, ok := index[dep]
+		if !ok {
+			return Node{}, false
+		}
+		b := g.Nodes[i]
+		if b.Kernel != kernels.OpNoop || len(liveDeps(b)) != 0 || b.Flags&core.FlagShared != 0 {
+			return Node{}, false
+		}
+		for _, s := range g.Inputs() {
+			if s.NodeID == b.ID {
+				return Node{}, false
+			}
+		}
+		return b, true
+	}
+	return Node{}, false
+}
+
+// nodePayload returns the payload range of n, or nil
+func (g *Graph) nodePayload(n Node) []byte {
+	if n.Out > n.In && int(n.Out) <= len(g.Payload) {
+		return g.Payload[n.In:n.Out]
+	}
+	return nil
+}
+
+// buildMatMulBiasAct lays out matmul_bias_act from a matmul with payload
+// operands and the optional bias add and activation after it
+func buildMatMulBiasAct(g *Graph, chain []Node) ([]byte, bool) {
+	mm := g.nodePayload(chain[0])
+	if len(mm) < 6 {
+		return nil, false
+	}
+	rows := int(binary.LittleEndian.Uint16(mm[0:]))
+	cols := int(binary.LittleEndian.Uint16(mm[2:]))
+	bCols := int(binary.LittleEndian.Uint16(mm[4:]))
+	operands := 4 * (rows*cols + cols*bCols)
+	size := 4 * rows * bCols
+	if len(mm) < 6+operands || size == 0 {
+		return nil, false
+	}
+	bias := make([]byte, size)
+	var act uint16
+	for _, n := range chain[1:] {
+		if n.Kernel != kernels.OpAdd {
+			act = uint16(n.Kernel)
+			continue
+		}
+		b, ok := biasOperand(g, n, chain, g.nodeIndex())
+		if !ok || len(g.nodePayload(b)) < size || kernels.Elements(g.Shapes[b.ID]) != rows*bCols {
+			return nil, false
+		}
+		copy(bias, g.nodePayload(b))
+	}
+
+	payload := make([]byte, 8, 8+operands+size)
+	copy(payload, mm[:6])
+	binary.LittleEndian.PutUint16(payload[6:], act)
+	payload = append(payload, mm[6:6+operands]...)
+	return append(payload, bias...), true
+}
+
+// buildConv1DBatchNorm appends the batchnorm parameters and the optional
+// activation to the conv1d payload
+func buildConv1DBatchNorm(g *Graph, chain []Node) ([]byte, bool) {
+	conv, bn := g.nodePayload(chain[0]), g.nodePayload(chain[1])
+	if len(conv) < 4 || len(bn) < 18 {
+		return nil, false
+	}
+	n := int(binary.LittleEndian.Uint16(conv[0:]))
+	k := int(binary.LittleEndian.Uint16(conv[2:]))
+	end := 4 + 4*(n+k)
+	if k == 0 || k > n || len(conv) < end || int(binary.LittleEndian.Uint16(bn[0:])) != n-k+1 {
+		return nil, false
+	}
+	var act uint32
+	if len(chain) == 3 {
+		act = uint32(chain[2].Kernel)
+	}
+	payload := slices.Concat(conv[:end], bn[2:18], make([]byte, 4))
+	binary.LittleEndian.PutUint32(payload[end+16:], act)
+	return payload, true
+}
+
+// nodeIndex maps node IDs to their index in g.Nodes
+func (g *Graph) nodeIndex() map[uint32]int {
+	index := make(map[uint32]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		index[n.ID] = i
+	}
+	return index
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+func TestFuseKernels(t *testing.T) {
+	t.Parallel()
+	put := func(b []byte, v ...float32) {
+		for i, f := range v {
+			binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+		}
+	}
+	get := func(b []byte, n int) []float32 {
+		v := make([]float32, n)
+		for i := range v {
+			v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+		return v
+	}
+
+	// y = relu(matmul(A, B) + bias) and bn = batchnorm(conv1d(input, kernel))
+	const y, add, mm, bias, conv, bn = 3, 2, 1, 4, 5, 6
+	g := Graph{
+		Nodes: []Node{
+			{ID: y, Kernel: kernels.OpReLU, In: 96, Out: 112, Topo: []uint32{add}},
+			{ID: add, Kernel: kernels.OpAdd, In: 64, Out: 96, Topo: []uint32{mm, bias}},
+			{ID: mm, Kernel: kernels.OpMatMul, In: 0, Out: 38},
+			{ID: bias, Kernel: kernels.OpNoop, In: 48, Out: 64},
+			{ID: conv, Kernel: kernels.OpConv1D, In: 128, Out: 156},
+			{ID: bn, Kernel: kernels.OpBatchNorm, In: 160, Out: 190, Topo: []uint32{conv}},
+		},
+		Payload: make([]byte, 192),
+		Shapes:  map[uint32][]int{bias: {2, 2}},
+	}
+	p := g.Payload
+	binary.LittleEndian.PutUint16(p[0:], 2)
+	binary.LittleEndian.PutUint16(p[2:], 2)
+	binary.LittleEndian.PutUint16(p[4:], 2)
+	put(p[6:], 1, 2, 3, 4, 1, 0, 0, 1)
+	put(p[48:], -5, 1, -1, 0)
+	binary.LittleEndian.PutUint16(p[128:], 4)
+	binary.LittleEndian.PutUint16(p[130:], 2)
+	put(p[132:], 1, 2, 3, 4, 1, 1)
+	binary.LittleEndian.PutUint16(p[160:], 3)
+	put(p[162:], 5, 4, 1, 0)
+
+	counts, err := g.Fuse()
+	if err != nil {
+		t.Fatalf("Fuse failed: %v", err)
+	}
+	want := map[string]int{"matmul+add+activation": 1, "conv1d+batchnorm": 1}
+	if len(counts) != len(want) || counts["matmul+add+activation"] != 1 || counts["conv1d+batchnorm"] != 1 {
+		t.Errorf("Expected counts %v, got %v", want, counts)
+	}
+	if len(g.Nodes) != 2 {
+		t.Fatalf("Expected 2 fused nodes, got %+v", g.Nodes)
+	}
+	run := func(n Node) []byte {
+		data := slices.Clone(g.Payload[n.In:n.Out])
+		kernels.Catalog[n.Kernel](data)
+		return data
+	}
+
+	n := g.Nodes[0]
+	if n.ID != y || n.Kernel != kernels.OpMatMulBiasAct || len(n.Topo) != 0 {
+		t.Fatalf("Expected node %d to be a matmul_bias_act source, got %+v", y, n)
+	}
+	out := run(n)
+	if got := get(out[len(out)-16:], 4); !slices.Equal(got, []float32{0, 3, 2, 4}) {
+		t.Errorf("Expected relu(A·B + bias) = [0 3 2 4], got %v", got)
+	}
+	if !slices.Equal(g.Shapes[y], []int{2, 2}) {
+		t.Errorf("Expected shape [2 2], got %v", g.Shapes[y])
+	}
+
+	n = g.Nodes[1]
+	if n.ID != bn || n.Kernel != kernels.OpConv1DBatchNorm || len(n.Topo) != 0 {
+		t.Fatalf("Expected node %d to be a conv1d_bn source, got %+v", bn, n)
+	}
+	got := get(run(n)[4:], 3)
+	for i, w := range []float32{-1, 0, 1} {
+		if math.Abs(float64(got[i]-w)) > 1e-4 {
+			t.Errorf("Expected batchnorm(conv1d) = [-1 0 1], got %v", got)
+			break
+		}
+	}
+
+	if _, err := g.ExportONNX(); err != nil {
+		t.Errorf("ExportONNX of the fused graph failed: %v", err)
+	}
+
+	// A matmul with two consumers stays as it is
+	g = Graph{
+		Nodes: []Node{
+			{ID: 0, Kernel: kernels.OpReLU, In: 64, Out: 80, Topo: []uint32{1}},
+			{ID: 1, Kernel: kernels.OpMatMul, In: 0, Out: 38},
+			{ID: 2, Kernel: kernels.OpSigmoid, In: 96, Out: 112, Topo: []uint32{1}},
+		},
+		Payload: slices.Clone(p[:128]),
+	}
+	counts, err = g.Fuse()
+	if err != nil {
+		t.Fatalf("Fuse failed: %v", err)
+	}
+	if len(counts) != 0 || len(g.Nodes) != 3 {
+		t.Errorf("Expected nothing fused, got %v and %+v", counts, g.Nodes)
+	}
+}
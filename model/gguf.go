@@ -0,0 +1,417 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+)
+
+// GGUFMagic is the magic number, "GGUF", opening GGUF files
+const GGUFMagic = 0x46554747
+
+// GGUF tensor types the importer dequantizes
+const (
+	ggmlF32  = 0
+	ggmlF16  = 1
+	ggmlQ4_0 = 2
+	ggmlQ4_1 = 3
+	ggmlQ8_0 = 8
+	ggmlBF16 = 30
+)
+
+// ggmlBlocks gives the elements per block and bytes per block of the
+// supported tensor types
+var ggmlBlocks = map[uint32][2]int{
+	ggmlF32:  {1, 4},
+	ggmlF16:  {1, 2},
+	ggmlBF16: {1, 2},
+	ggmlQ4_0: {32, 18},
+	ggmlQ4_1: {32, 20},
+	ggmlQ8_0: {32, 34},
+}
+
+var ggmlNames = map[uint32]string{
+	ggmlF32: "F32", ggmlF16: "F16", ggmlQ4_0: "Q4_0", ggmlQ4_1: "Q4_1", ggmlQ8_0: "Q8_0", ggmlBF16: "BF16",
+}
+
+// GGUF metadata value types
+const (
+	ggufUint8 = iota
+	ggufInt8
+	ggufUint16
+	ggufInt16
+	ggufUint32
+	ggufInt32
+	ggufFloat32
+	ggufBool
+	ggufString
+	ggufArray
+	ggufUint64
+	ggufInt64
+	ggufFloat64
+)
+
+// ggufSizes gives the size of the fixed-size metadata value types
+var ggufSizes = map[uint32]uint64{
+	ggufUint8: 1, ggufInt8: 1, ggufBool: 1, ggufUint16: 2, ggufInt16: 2,
+	ggufUint32: 4, ggufInt32: 4, ggufFloat32: 4, ggufUint64: 8, ggufInt64: 8, ggufFloat64: 8,
+}
+
+// ggufTensor is a tensor info entry of a GGUF file
+type ggufTensor struct {
+	name   string
+	dims   []uint64 // Innermost first
+	typ    uint32
+	offset uint64 // From the start of the data section
+}
+
+// ReadGGUF imports the tensors of a GGUF file (versions 2 and 3) of the given
+// size as a skeleton graph for experiments with open weights. Every tensor
+// is dequantized to float32 (F32, F16, BF16, Q4_0, Q4_1 and Q8_0 are
+// supported) into its own 32-byte aligned payload segment, named after the
+// tensor, with the bias role when the name ends in ".bias" and the weight
+// role otherwise. Tensor i becomes segment i+1, bound to noop node i whose
+// shape, outermost dimension first, is recorded in Shapes; wiring nodes
+// into transformer blocks is left to the caller. String and numeric
+// metadata is copied to Meta under its GGUF key; general.name also sets
+// "name". Arrays, such as tokenizer vocabularies, are skipped.
+func ReadGGUF(r io.ReaderAt, size int64) (*Graph, error) {
+	d := &ggufDecoder{r: r, size: size}
+	if magic := d.u32(); d.err == nil && magic != GGUFMagic {
+		return nil, fmt.Errorf("gguf: invalid magic number: %x", magic)
+	}
+	if v := d.u32(); d.err == nil && v != 2 && v != 3 {
+		return nil, fmt.Errorf("gguf: unsupported version %d", v)
+	}
+	tensorCount, kvCount := d.u64(), d.u64()
+	if d.err != nil {
+		return nil, fmt.Errorf("gguf: truncated header: %w", d.err)
+	}
+
+	g := &Graph{Meta: Metadata{}, Shapes: make(map[uint32][]int)}
+	alignment, err := d.metadata(g.Meta, kvCount)
+	if err != nil {
+		return nil, err
+	}
+	tensors, err := d.tensorInfos(tensorCount)
+	if err != nil {
+		return nil, err
+	}
+	dataStart := (uint64(d.off) + alignment - 1) &^ (alignment - 1)
+
+	var payload []byte
+	for i, t := range tensors {
+		id := uint32(i + 1)
+		elems, stored, err := t.read(r, size, dataStart)
+		if err != nil {
+			return nil, err
+		}
+		offset := core.Align32(len(payload))
+		if uint64(offset)+4*elems > math.MaxUint32 {
+			return nil, fmt.Errorf("gguf: tensors exceed the 4 GiB payload limit")
+		}
+		payload = slices.Grow(payload, offset+4*int(elems)-len(payload))
+		payload = payload[:offset+4*int(elems)]
+		dequantize(payload[offset:], stored, t.typ)
+
+		role := RoleWeight
+		if strings.HasSuffix(t.name, ".bias") {
+			role = RoleBias
+		}
+		g.Segments = append(g.Segments, Segment{ID: id, Offset: uint32(offset), Length: uint32(4 * elems), Role: role, Name: t.name})
+		g.Nodes = append(g.Nodes, Node{ID: id - 1, Kernel: kernels.OpNoop, Segment: id})
+
+		shape := make([]int, len(t.dims))
+		for j, dim := range t.dims {
+			shape[len(shape)-1-j] = int(dim)
+		}
+		g.Shapes[id-1] = shape
+	}
+	// Validate wants node offsets inside the payload
+	g.Payload = append(payload, make([]byte, core.Align32(len(payload)+1)-len(payload))...)
+	if err := g.ResolveSegments(); err != nil {
+		return nil, fmt.Errorf("gguf: %w", err)
+	}
+	return g, nil
+}
+
+// metadata copies count key-value pairs into meta, skipping arrays, and
+// returns the data section alignment, 32 unless general.alignment sets it
+func (d *ggufDecoder) metadata(meta Metadata, count uint64) (uint64, error) {
+	alignment := uint64(32)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		key := d.str()
+		typ := d.u32()
+		if typ == ggufArray {
+			d.skipArray()
+			continue
+		}
+		v := d.scalar(typ)
+		if d.err != nil {
+			break
+		}
+		if key == "general.alignment" {
+			a, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || a == 0 || a&(a-1) != 0 {
+				return 0, fmt.Errorf("gguf: invalid alignment %s", v)
+			}
+			alignment = a
+		}
+		meta[key] = v
+		if key == "general.name" {
+			meta["name"] = v
+		}
+	}
+	if d.err != nil {
+		return 0, fmt.Errorf("gguf: metadata: %w", d.err)
+	}
+	return alignment, nil
+}
+
+// tensorInfos reads count tensor info entries
+func (d *ggufDecoder) tensorInfos(count uint64) ([]ggufTensor, error) {
+	tensors := make([]ggufTensor, 0, min(count, 1<<16))
+	for i := uint64(0); i < count; i++ {
+		t := ggufTensor{name: d.str()}
+		rank := d.u32()
+		if rank > 4 {
+			return nil, fmt.Errorf("gguf: tensor %q: rank %d exceeds 4", t.name, rank)
+		}
+		for j := uint32(0); j < rank; j++ {
+			t.dims = append(t.dims, d.u64())
+		}
+		t.typ, t.offset = d.u32(), d.u64()
+		if d.err != nil {
+			return nil, fmt.Errorf("gguf: tensor info %d: %w", i, d.err)
+		}
+		tensors = append(tensors, t)
+	}
+	return tensors, nil
+}
+
+// read returns the element count and the stored bytes of t, whose data
+// section starts at dataStart in r of the given size
+func (t ggufTensor) read(r io.ReaderAt, size int64, dataStart uint64) (uint64, []byte, error) {
+	block, ok := ggmlBlocks[t.typ]
+	if !ok {
+		return 0, nil, fmt.Errorf("gguf: tensor %q: unsupported type %d", t.name, t.typ)
+	}
+	elems := uint64(1)
+	for _, dim := range t.dims {
+		if dim != 0 && elems > math.MaxUint32/dim {
+			return 0, nil, fmt.Errorf("gguf: tensor %q: too many elements", t.name)
+		}
+		elems *= dim
+	}
+	if elems%uint64(block[0]) != 0 {
+		return 0, nil, fmt.Errorf("gguf: tensor %q: %d elements are not whole %s blocks", t.name, elems, ggmlNames[t.typ])
+	}
+	// Check the extent before allocating it, in a form that cannot wrap
+	storedLen := elems / uint64(block[0]) * uint64(block[1])
+	if dataStart > uint64(size) || storedLen > uint64(size)-dataStart || t.offset > uint64(size)-dataStart-storedLen {
+		return 0, nil, fmt.Errorf("gguf: tensor %q exceeds the file", t.name)
+	}
+	stored := make([]byte, storedLen)
+	if err := readAt(r, stored, int64(dataStart+t.offset)); err != nil {
+		return 0, nil, fmt.Errorf("gguf: tensor %q: %w", t.name, err)
+	}
+	return elems, stored, nil
+}
+
+// dequantize expands stored blocks of type typ into float32 values in dst
+func dequantize(dst, src []byte, typ uint32) {
+	put := func(i int, v float32) { binary.LittleEndian.PutUint32(dst[4*i:], math.Float32bits(v)) }
+	switch typ {
+	case ggmlF32:
+		copy(dst, src)
+	case ggmlF16:
+		for i := 0; 2*i < len(src); i++ {
+			put(i, HalfToFloat(binary.LittleEndian.Uint16(src[2*i:])))
+		}
+	case ggmlBF16:
+		for i := 0; 2*i < len(src); i++ {
+			put(i, math.Float32frombits(uint32(binary.LittleEndian.Uint16(src[2*i:]))<<16))
+		}
+	case ggmlQ8_0:
+		for b := 0; 34*b < len(src); b++ {
+			blk := src[34*b:]
+			scale := HalfToFloat(binary.LittleEndian.Uint16(blk))
+			for j := 0; j < 32; j++ {
+				put(32*b+j, float32(int8(blk[2+j]))*scale)
+			}
+		}
+	case ggmlQ4_0, ggmlQ4_1:
+		size, qs := 18, 2
+		if typ == ggmlQ4_1 {
+			size, qs = 20, 4
+		}
+		for b := 0; size*b < len(src); b++ {
+			blk := src[size*b:]
+			scale := HalfToFloat(binary.LittleEndian.Uint16(blk))
+			// Q4_0 centers nibbles on 8, Q4_1 adds a stored minimum
+			center, minimum := 8, float32(0)
+			if typ == ggmlQ4_1 {
+				center, minimum = 0, HalfToFloat(binary.LittleEndian.Uint16(blk[2:]))
+			}
+			for j := 0; j < 16; j++ {
+				q := int(blk[qs+j])
+				put(32*b+j, float32(q&0x0F-center)*scale+minimum)
+				put(32*b+j+16, float32(q>>4-center)*scale+minimum)
+			}
+		}
+	}
+}
+
+// HalfToFloat converts an IEEE 754 half-precision value to float32
+func HalfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1F
+	frac := uint32(h) & 0x3FF
+	switch {
+	case exp == 0x1F: // Inf or NaN
+		return math.Float32frombits(sign | 0x7F800000 | frac<<13)
+	case exp != 0:
+		return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+	case frac == 0:
+		return math.Float32frombits(sign)
+	}
+	// Subnormal: frac * 2^-24
+	v := float32(frac) / (1 << 24)
+	if sign != 0 {
+		v = -v
+	}
+	return v
+}
+
+// FloatToHalf converts f to the nearest IEEE 754 half-precision value,
+// rounding ties to even; values beyond the half range become infinities
+func FloatToHalf(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xFF) - 127 + 15
+	frac := bits & 0x7FFFFF
+	switch {
+	case bits&0x7FFFFFFF > 0x7F800000: // NaN
+		return sign | 0x7E00
+	case exp >= 0x1F: // Overflow or Inf
+		return sign | 0x7C00
+	case exp <= 0: // Subnormal or zero
+		if exp < -10 {
+			return sign
+		}
+		frac |= 0x800000
+		shift := uint(14 - exp)
+		half := frac >> shift
+		rest := frac & (1<<shift - 1)
+		if mid := uint32(1) << (shift - 1); rest > mid || rest == mid && half&1 == 1 {
+			half++
+		}
+		return sign | uint16(half)
+	}
+	half := uint32(exp)<<10 | frac>>13
+	if rest := frac & 0x1FFF; rest > 0x1000 || rest == 0x1000 && half&1 == 1 {
+		half++ // May carry into the exponent, up to infinity
+	}
+	return sign | uint16(half)
+}
+
+// ggufDecoder reads consecutive little-endian GGUF values, keeping the first
+// error
+type ggufDecoder struct {
+	r    io.ReaderAt
+	size int64
+	off  int64
+	err  error
+}
+
+func (d *ggufDecoder) read(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(d.size-d.off) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := make([]byte, n)
+	d.err = readAt(d.r, b, d.off)
+	d.off += int64(n)
+	return b
+}
+
+func (d *ggufDecoder) u32() uint32 {
+	if b := d.read(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *ggufDecoder) u64() uint64 {
+	if b := d.read(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *ggufDecoder) str() string {
+	return string(d.read(d.u64()))
+}
+
+// scalar reads a non-array value of type typ, formatted as a string
+func (d *ggufDecoder) scalar(typ uint32) string {
+	if typ == ggufString {
+		return d.str()
+	}
+	size, ok := ggufSizes[typ]
+	if !ok {
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown value type %d", typ)
+		}
+		return ""
+	}
+	var b [8]byte
+	copy(b[:], d.read(size))
+	u := binary.LittleEndian.Uint64(b[:])
+	switch typ {
+	case ggufInt8:
+		return strconv.Itoa(int(int8(u)))
+	case ggufInt16:
+		return strconv.Itoa(int(int16(u)))
+	case ggufInt32:
+		return strconv.Itoa(int(int32(u)))
+	case ggufInt64:
+		return strconv.FormatInt(int64(u), 10)
+	case ggufFloat32:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(u))), 'g', -1, 32)
+	case ggufFloat64:
+		return strconv.FormatFloat(math.Float64frombits(u), 'g', -1, 64)
+	case ggufBool:
+		return strconv.FormatBool(u != 0)
+	}
+	return strconv.FormatUint(u, 10)
+}
+
+// skipArray skips an array value, whose elements may themselves be arrays
+func (d *ggufDecoder) skipArray() {
+	typ, n := d.u32(), d.u64()
+	if size, ok := ggufSizes[typ]; ok && d.err == nil {
+		if n > uint64(d.size-d.off)/size {
+			d.err = io.ErrUnexpectedEOF
+		}
+		d.off += int64(n * size)
+		return
+	}
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		if typ == ggufArray {
+			d.skipArray()
+		} else {
+			d.scalar(typ)
+		}
+	}
+}
@@ -23,26 +23,58 @@ package model
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/binary"
 	"encoding/gob"
 	"fmt"
 	"io"
 )
 
+// Magic starts every file written by Graph.Serialize ("SULB" in little endian)
+const Magic = 0x53554C42
+
 // Node represents a graph node with input and output ports and flags
 type Node struct {
-	ID     uint16
-	In     uint16   // payload offset for input
-	Out    uint16   // payload offset for output
+	ID     uint32
+	In     uint32   // payload offset for input
+	Out    uint32   // payload offset for output
 	Kernel uint8    // opcode for data transform
 	Flags  uint32   // node-specific flags
-	Topo   []uint16 // neighbor indices for message passing
+	Topo   []uint32 // neighbor indices for message passing
+
+	// Segment is the ID of the segment table entry the node computes on,
+	// or 0 when In and Out are raw payload offsets. ResolveSegments keeps
+	// In and Out equal to the segment's range.
+	Segment uint32
 }
 
+// NoNeighbor marks an unused topology slot
+const NoNeighbor = 0xFFFFFFFF
+
 // Graph is an immutable representation parsed from .subl, with utility methods
 type Graph struct {
 	Nodes   []Node
-	Payload []byte // concatenated and aligned data payload
+	Payload []byte   // concatenated and aligned data payload
+	IO      []IOSpec // named inputs and outputs, optional
+	Flags   uint16   // file header flags, see FlagDebug
+	Target  Target   // ISA profile compiled for, stored in the file header
+	Meta    Metadata // provenance key/value pairs, optional
+
+	// Shapes maps node IDs to their output shape in float32 elements, as
+	// computed by InferShapes; optional
+	Shapes map[uint32][]int
+
+	// Segments is the segment table: typed, named payload ranges nodes
+	// reference by ID; optional
+	Segments []Segment
+
+	// Costs maps node IDs to their estimated or measured execution cost,
+	// as set by EstimateCosts or a profiling run; optional
+	Costs map[uint32]NodeCost
+
+	// Debug holds node and segment names and source positions, written
+	// by compilers asked for debug output; optional
+	Debug *DebugInfo
 }
 
 // NodeCount returns the number of nodes in the graph
@@ -50,78 +82,98 @@ func (g *Graph) NodeCount() int {
 	return len(g.Nodes)
 }
 
-// NodeSize returns the size in bytes of a serialized Node entry
+// NodeSize returns the size in bytes of a node entry in the headerless
+// legacy layout read by DeserializeLegacy
 func NodeSize() int {
 	return 16 // Fixed size for binary serialization
 }
 
-// Serialize writes the Graph to a byte slice using optimized binary format
+// Format versions written by Serialize and read by Deserialize
+const (
+	Version1 = 1 // 16-bit ids and offsets, at most two neighbors per node
+	Version2 = 2 // 32-bit ids and offsets in tagged sections
+)
+
+// Serialize writes the Graph in the version 2 binary format: a header
+// followed by tagged NODE, IOSP, META, SHAP, SEGM, COST, DBUG and PAYL sections,
+// each 32-byte aligned and checksummed, and an unsigned SIGN section holding the file digest
 func (g *Graph) Serialize() ([]byte, error) {
-	var buf bytes.Buffer
+	return g.SerializeWithOptions(SerializeOptions{})
+}
 
-	// Write header: magic number, version, node count, payload size
-	if err := binary.Write(&buf, binary.LittleEndian, uint32(0x53554C42)); err != nil { // "SULB"
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.LittleEndian, uint16(1)); err != nil { // version
-		return nil, err
-	}
-	if err := binary.Write(&buf, binary.LittleEndian, uint16(len(g.Nodes))); err != nil {
-		return nil, err
+// SerializeOptions configures SerializeWithOptions
+type SerializeOptions struct {
+	Compression Compression        // Codec for every section but SIGN
+	SigningKey  ed25519.PrivateKey // Signs the file digest when set
+}
+
+// SerializeWithOptions writes the version 2 format like Serialize,
+// compressing and signing it as opts asks
+func (g *Graph) SerializeWithOptions(opts SerializeOptions) ([]byte, error) {
+	if opts.SigningKey != nil && len(opts.SigningKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 private key: %d bytes", len(opts.SigningKey))
 	}
-	if err := binary.Write(&buf, binary.LittleEndian, uint32(len(g.Payload))); err != nil {
+
+	var nodes, io bytes.Buffer
+	if err := writeNodeSection(&nodes, g.Nodes); err != nil {
 		return nil, err
 	}
-
-	// Write nodes in fixed-size format
-	for _, node := range g.Nodes {
-		if err := binary.Write(&buf, binary.LittleEndian, node.ID); err != nil {
+	sections := []section{{tag: sectionNodes, body: nodes.Bytes()}}
+	if len(g.IO) > 0 {
+		if err := writeIOTable(&io, g.IO); err != nil {
 			return nil, err
 		}
-		if err := binary.Write(&buf, binary.LittleEndian, node.In); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(&buf, binary.LittleEndian, node.Out); err != nil {
+		sections = append(sections, section{tag: sectionIO, body: io.Bytes()})
+	}
+	if len(g.Meta) > 0 {
+		var meta bytes.Buffer
+		if err := writeMetadata(&meta, g.Meta); err != nil {
 			return nil, err
 		}
-		if err := binary.Write(&buf, binary.LittleEndian, node.Kernel); err != nil {
+		sections = append(sections, section{tag: sectionMetadata, body: meta.Bytes()})
+	}
+	if len(g.Shapes) > 0 {
+		var shapes bytes.Buffer
+		if err := writeShapes(&shapes, g.Shapes); err != nil {
 			return nil, err
 		}
-		if err := binary.Write(&buf, binary.LittleEndian, uint8(len(node.Topo))); err != nil {
+		sections = append(sections, section{tag: sectionShapes, body: shapes.Bytes()})
+	}
+	if len(g.Segments) > 0 {
+		var segs bytes.Buffer
+		if err := writeSegments(&segs, g.Segments, g.Nodes); err != nil {
 			return nil, err
 		}
-		if err := binary.Write(&buf, binary.LittleEndian, node.Flags); err != nil {
+		sections = append(sections, section{tag: sectionSegments, body: segs.Bytes()})
+	}
+	if len(g.Costs) > 0 {
+		var costs bytes.Buffer
+		writeCosts(&costs, g.Costs)
+		sections = append(sections, section{tag: sectionCosts, body: costs.Bytes()})
+	}
+	if !g.Debug.Empty() {
+		var debug bytes.Buffer
+		if err := writeDebug(&debug, g); err != nil {
 			return nil, err
 		}
-
-		// Write topology indices (padded to 4-byte alignment)
-		for _, idx := range node.Topo {
-			if err := binary.Write(&buf, binary.LittleEndian, idx); err != nil {
-				return nil, err
-			}
-		}
-		// Pad to maintain alignment
-		for i := len(node.Topo); i < 2; i++ {
-			if err := binary.Write(&buf, binary.LittleEndian, uint16(0xFFFF)); err != nil {
-				return nil, err
-			}
-		}
+		sections = append(sections, section{tag: sectionDebug, body: debug.Bytes()})
 	}
+	sections = append(sections, section{tag: sectionPayload, body: g.Payload})
 
-	// Write payload data aligned to 32-byte boundary
-	payloadOffset := buf.Len()
-	alignedOffset := (payloadOffset + 31) &^ 31
-	padding := alignedOffset - payloadOffset
-	for i := 0; i < padding; i++ {
-		buf.WriteByte(0)
+	var buf bytes.Buffer
+	writeFileHeader(&buf, g.Flags, g.Target, len(sections)+1)
+	for _, s := range sections {
+		s, err := s.compress(opts.Compression)
+		if err != nil {
+			return nil, err
+		}
+		s.writeTo(&buf)
 	}
-
-	buf.Write(g.Payload)
-
+	writeSignature(&buf, opts.SigningKey)
 	return buf.Bytes(), nil
 }
 
-// Deserialize reads a Graph from a byte slice using binary format
+// Deserialize reads a Graph written by Serialize in either format version
 func Deserialize(data []byte) (*Graph, error) {
 	buf := bytes.NewReader(data)
 
@@ -130,7 +182,7 @@ func Deserialize(data []byte) (*Graph, error) {
 	if err := binary.Read(buf, binary.LittleEndian, &magic); err != nil {
 		return nil, err
 	}
-	if magic != 0x53554C42 {
+	if magic != Magic {
 		return nil, fmt.Errorf("invalid magic number: %x", magic)
 	}
 
@@ -138,10 +190,17 @@ func Deserialize(data []byte) (*Graph, error) {
 	if err := binary.Read(buf, binary.LittleEndian, &version); err != nil {
 		return nil, err
 	}
-	if version != 1 {
-		return nil, fmt.Errorf("unsupported version: %d", version)
+	switch version {
+	case Version1:
+		return deserializeV1(buf)
+	case Version2:
+		return deserializeV2(data)
 	}
+	return nil, fmt.Errorf("unsupported version: %d", version)
+}
 
+// deserializeV1 reads the version 1 body that follows magic and version
+func deserializeV1(buf *bytes.Reader) (*Graph, error) {
 	var nodeCount uint16
 	if err := binary.Read(buf, binary.LittleEndian, &nodeCount); err != nil {
 		return nil, err
@@ -152,42 +211,30 @@ func Deserialize(data []byte) (*Graph, error) {
 		return nil, err
 	}
 
-	// Read nodes
+	// Read nodes: id, in, out (uint16), kernel, topology length (uint8),
+	// flags (uint32) and two uint16 topology slots padded with 0xFFFF
 	nodes := make([]Node, nodeCount)
 	for i := range nodes {
-		if err := binary.Read(buf, binary.LittleEndian, &nodes[i].ID); err != nil {
-			return nil, err
+		var entry struct {
+			ID, In, Out    uint16
+			Kernel, TopoLn uint8
+			Flags          uint32
+			Topo           [2]uint16
 		}
-		if err := binary.Read(buf, binary.LittleEndian, &nodes[i].In); err != nil {
+		if err := binary.Read(buf, binary.LittleEndian, &entry); err != nil {
 			return nil, err
 		}
-		if err := binary.Read(buf, binary.LittleEndian, &nodes[i].Out); err != nil {
-			return nil, err
-		}
-		if err := binary.Read(buf, binary.LittleEndian, &nodes[i].Kernel); err != nil {
-			return nil, err
+		nodes[i] = Node{
+			ID:     uint32(entry.ID),
+			In:     uint32(entry.In),
+			Out:    uint32(entry.Out),
+			Kernel: entry.Kernel,
+			Flags:  entry.Flags,
+			Topo:   make([]uint32, 0, entry.TopoLn),
 		}
-
-		var topoLen uint8
-		if err := binary.Read(buf, binary.LittleEndian, &topoLen); err != nil {
-			return nil, err
-		}
-
-		if err := binary.Read(buf, binary.LittleEndian, &nodes[i].Flags); err != nil {
-			return nil, err
-		}
-
-		// Read topology (always read 2 uint16s for alignment)
-		topo := make([]uint16, 2)
-		if err := binary.Read(buf, binary.LittleEndian, &topo); err != nil {
-			return nil, err
-		}
-
-		// Extract actual topology
-		nodes[i].Topo = make([]uint16, 0, topoLen)
-		for j := 0; j < int(topoLen) && j < 2; j++ {
-			if topo[j] != 0xFFFF {
-				nodes[i].Topo = append(nodes[i].Topo, topo[j])
+		for j := 0; j < int(entry.TopoLn) && j < 2; j++ {
+			if entry.Topo[j] != 0xFFFF {
+				nodes[i].Topo = append(nodes[i].Topo, uint32(entry.Topo[j]))
 			}
 		}
 	}
@@ -201,13 +248,43 @@ func Deserialize(data []byte) (*Graph, error) {
 
 	// Read payload
 	payload := make([]byte, payloadSize)
-	if _, err := buf.Read(payload); err != nil {
+	if _, err := io.ReadFull(buf, payload); err != nil {
 		return nil, err
 	}
 
 	return &Graph{Nodes: nodes, Payload: payload}, nil
 }
 
+// DeserializeLegacy reads the headerless layout written by compilers before
+// the canonical format: node count and payload length (uint32), then fixed
+// 16-byte entries of id (uint16), kernel (uint8), in, out (uint16) and flags
+// (uint32), then the payload. The layout has no topology.
+func DeserializeLegacy(data []byte) (*Graph, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("truncated header: %d bytes", len(data))
+	}
+	nodeCount := uint64(binary.LittleEndian.Uint32(data[0:]))
+	payloadLen := uint64(binary.LittleEndian.Uint32(data[4:]))
+	data = data[8:]
+	if uint64(len(data)) < nodeCount*uint64(NodeSize())+payloadLen {
+		return nil, fmt.Errorf("inconsistent sizes: %d nodes and %d payload bytes in %d bytes", nodeCount, payloadLen, len(data))
+	}
+
+	nodes := make([]Node, nodeCount)
+	for i := range nodes {
+		entry := data[i*NodeSize():]
+		nodes[i] = Node{
+			ID:     uint32(binary.LittleEndian.Uint16(entry[0:])),
+			Kernel: entry[2],
+			In:     uint32(binary.LittleEndian.Uint16(entry[3:])),
+			Out:    uint32(binary.LittleEndian.Uint16(entry[5:])),
+			Flags:  binary.LittleEndian.Uint32(entry[7:]),
+		}
+	}
+	data = data[len(nodes)*NodeSize():]
+	return &Graph{Nodes: nodes, Payload: bytes.Clone(data[:payloadLen])}, nil
+}
+
 // SerializeGob writes the Graph using gob encoding (fallback)
 func (g *Graph) SerializeGob() ([]byte, error) {
 	var buf bytes.Buffer
@@ -218,6 +295,22 @@ func (g *Graph) SerializeGob() ([]byte, error) {
 	if err := encoder.Encode(g.Payload); err != nil {
 		return nil, err
 	}
+
+	// Optional fields follow in a fixed order up to the last one set, so
+	// files without them stay readable by older versions
+	optional := []any{g.IO, g.Meta, g.Shapes, g.Segments, g.Costs, g.Debug}
+	set := []bool{len(g.IO) > 0, len(g.Meta) > 0, len(g.Shapes) > 0, len(g.Segments) > 0, len(g.Costs) > 0, !g.Debug.Empty()}
+	last := -1
+	for i, ok := range set {
+		if ok {
+			last = i
+		}
+	}
+	for _, v := range optional[:last+1] {
+		if err := encoder.Encode(v); err != nil {
+			return nil, err
+		}
+	}
 	return buf.Bytes(), nil
 }
 
@@ -233,7 +326,31 @@ func DeserializeGob(data []byte) (*Graph, error) {
 	if err := decoder.Decode(&payload); err != nil {
 		return nil, err
 	}
-	return &Graph{Nodes: nodes, Payload: payload}, nil
+	var specs []IOSpec
+	if err := decoder.Decode(&specs); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var meta Metadata
+	if err := decoder.Decode(&meta); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var shapes map[uint32][]int
+	if err := decoder.Decode(&shapes); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var segs []Segment
+	if err := decoder.Decode(&segs); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var costs map[uint32]NodeCost
+	if err := decoder.Decode(&costs); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var debug *DebugInfo
+	if err := decoder.Decode(&debug); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &Graph{Nodes: nodes, Payload: payload, IO: specs, Meta: meta, Shapes: shapes, Segments: segs, Costs: costs, Debug: debug}, nil
 }
 
 // Validate checks graph consistency
@@ -243,16 +360,18 @@ func (g *Graph) Validate() error {
 	}
 
 	// Check for duplicate IDs
-	ids := make(map[uint16]bool)
+	ids := make(map[uint32]bool)
 	for _, node := range g.Nodes {
 		if ids[node.ID] {
 			return fmt.Errorf("duplicate node ID: %d", node.ID)
 		}
 		ids[node.ID] = true
+	}
 
-		// Check topology references
+	for _, node := range g.Nodes {
+		// Check topology references, which may name later nodes
 		for _, neighborID := range node.Topo {
-			if neighborID != 0xFFFF && !ids[neighborID] {
+			if neighborID != NoNeighbor && !ids[neighborID] {
 				return fmt.Errorf("node %d references non-existent neighbor %d", node.ID, neighborID)
 			}
 		}
@@ -263,71 +382,40 @@ func (g *Graph) Validate() error {
 		}
 	}
 
-	return nil
+	if err := g.validateSegments(); err != nil {
+		return err
+	}
+	if err := g.validateShared(); err != nil {
+		return err
+	}
+	return g.validateIO(ids)
 }
 
-// Optimize performs graph optimizations for runtime performance
-func (g *Graph) Optimize() {
+// Optimize performs graph optimizations for runtime performance. A cyclic
+// graph is left unchanged and reported with a *CycleError.
+func (g *Graph) Optimize() error {
 	// Sort nodes by execution order for better cache locality
-	g.topologicalSort()
+	if err := g.topologicalSort(); err != nil {
+		return err
+	}
 
 	// Pack payload for optimal memory layout
 	g.compactPayload()
+	return nil
 }
 
-// topologicalSort reorders nodes for execution dependency order
-func (g *Graph) topologicalSort() {
-	// Build dependency graph
-	adj := make(map[uint16][]uint16)
-	inDegree := make(map[uint16]int)
-
-	for _, node := range g.Nodes {
-		if _, exists := inDegree[node.ID]; !exists {
-			inDegree[node.ID] = 0
-		}
-		for _, dep := range node.Topo {
-			if dep != 0xFFFF {
-				adj[dep] = append(adj[dep], node.ID)
-				inDegree[node.ID]++
-			}
-		}
+// topologicalSort reorders nodes into TopologicalOrder
+func (g *Graph) topologicalSort() error {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return err
 	}
-
-	// Kahn's algorithm for topological sort
-	queue := make([]uint16, 0)
-	for nodeID, degree := range inDegree {
-		if degree == 0 {
-			queue = append(queue, nodeID)
-		}
-	}
-
-	var executionOrder []uint16
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		executionOrder = append(executionOrder, current)
-
-		for _, neighbor := range adj[current] {
-			inDegree[neighbor]--
-			if inDegree[neighbor] == 0 {
-				queue = append(queue, neighbor)
-			}
-		}
-	}
-
-	// Reorder nodes based on execution order
-	nodeMap := make(map[uint16]*Node)
-	for i := range g.Nodes {
-		nodeMap[g.Nodes[i].ID] = &g.Nodes[i]
-	}
-
-	reordered := make([]Node, 0, len(g.Nodes))
-	for _, nodeID := range executionOrder {
-		if node, exists := nodeMap[nodeID]; exists {
-			reordered = append(reordered, *node)
-		}
+	reordered := make([]Node, len(order))
+	for k, i := range order {
+		reordered[k] = g.Nodes[i]
 	}
 	g.Nodes = reordered
+	return nil
 }
 
 // compactPayload optimizes payload layout for cache efficiency
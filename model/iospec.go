@@ -0,0 +1,241 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DType is the element type of a model input or output
+type DType uint8
+
+const (
+	Float32 DType = iota
+	Float16
+	Int32
+	Int8
+	Uint8
+)
+
+var dtypeNames = [...]string{
+	Float32: "float32",
+	Float16: "float16",
+	Int32:   "int32",
+	Int8:    "int8",
+	Uint8:   "uint8",
+}
+
+// String returns the lower-case type name
+func (d DType) String() string {
+	if int(d) < len(dtypeNames) {
+		return dtypeNames[d]
+	}
+	return fmt.Sprintf("DType(%d)", d)
+}
+
+// Size returns the size in bytes of one element, or 0 for an unknown type
+func (d DType) Size() int {
+	switch d {
+	case Float32, Int32:
+		return 4
+	case Float16:
+		return 2
+	case Int8, Uint8:
+		return 1
+	}
+	return 0
+}
+
+// dtypeShortNames are the abbreviations the DSL accepts, such as f32
+var dtypeShortNames = [...]string{
+	Float32: "f32",
+	Float16: "f16",
+	Int32:   "i32",
+	Int8:    "i8",
+	Uint8:   "u8",
+}
+
+// ParseDType parses a type name as printed by String or its abbreviation,
+// such as f32; "" selects Float32
+func ParseDType(name string) (DType, error) {
+	if name == "" {
+		return Float32, nil
+	}
+	for d, n := range dtypeNames {
+		if strings.EqualFold(name, n) || strings.EqualFold(name, dtypeShortNames[d]) {
+			return DType(d), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dtype %q", name)
+}
+
+// IOKind tells whether an IOSpec is a model input or output
+type IOKind uint8
+
+const (
+	Input IOKind = iota
+	Output
+)
+
+// String returns "input" or "output"
+func (k IOKind) String() string {
+	switch k {
+	case Input:
+		return "input"
+	case Output:
+		return "output"
+	}
+	return fmt.Sprintf("IOKind(%d)", k)
+}
+
+// IOSpec names a tensor the model reads or produces and locates it at the
+// payload of one node, so integrators can address it without byte offsets
+type IOSpec struct {
+	Name   string
+	Kind   IOKind
+	NodeID uint32
+	DType  DType
+	Shape  []int // Dimensions, outermost first; empty for a scalar
+}
+
+// Elements returns the number of elements in the tensor
+func (s IOSpec) Elements() int {
+	n := 1
+	for _, d := range s.Shape {
+		n *= d
+	}
+	return n
+}
+
+// Bytes returns the tensor size in bytes
+func (s IOSpec) Bytes() int {
+	return s.Elements() * s.DType.Size()
+}
+
+// String formats the spec as name:dtype[d0,d1,...]@node
+func (s IOSpec) String() string {
+	dims := make([]string, len(s.Shape))
+	for i, d := range s.Shape {
+		dims[i] = fmt.Sprint(d)
+	}
+	return fmt.Sprintf("%s:%v[%s]@%d", s.Name, s.DType, strings.Join(dims, ","), s.NodeID)
+}
+
+// Inputs returns the input specs in declaration order
+func (g *Graph) Inputs() []IOSpec {
+	return g.ioSpecs(Input)
+}
+
+// Outputs returns the output specs in declaration order
+func (g *Graph) Outputs() []IOSpec {
+	return g.ioSpecs(Output)
+}
+
+func (g *Graph) ioSpecs(kind IOKind) []IOSpec {
+	var specs []IOSpec
+	for _, s := range g.IO {
+		if s.Kind == kind {
+			specs = append(specs, s)
+		}
+	}
+	return specs
+}
+
+// validateIO checks that IO names are unique per kind and refer to nodes
+func (g *Graph) validateIO(ids map[uint32]bool) error {
+	seen := make(map[IOKind]map[string]bool)
+	for _, s := range g.IO {
+		if s.Name == "" || len(s.Name) > 255 {
+			return fmt.Errorf("%v name %q must be 1 to 255 bytes", s.Kind, s.Name)
+		}
+		if s.Kind > Output {
+			return fmt.Errorf("%q has invalid kind %d", s.Name, s.Kind)
+		}
+		if s.DType.Size() == 0 {
+			return fmt.Errorf("%v %q has unknown dtype %d", s.Kind, s.Name, s.DType)
+		}
+		if seen[s.Kind] == nil {
+			seen[s.Kind] = make(map[string]bool)
+		}
+		if seen[s.Kind][s.Name] {
+			return fmt.Errorf("duplicate %v name %q", s.Kind, s.Name)
+		}
+		seen[s.Kind][s.Name] = true
+		if !ids[s.NodeID] {
+			return fmt.Errorf("%v %q references non-existent node %d", s.Kind, s.Name, s.NodeID)
+		}
+		if len(s.Shape) > 255 {
+			return fmt.Errorf("%v %q has rank %d, limit 255", s.Kind, s.Name, len(s.Shape))
+		}
+		for _, d := range s.Shape {
+			if d <= 0 || int64(d) > 1<<32-1 {
+				return fmt.Errorf("%v %q has invalid dimension %d", s.Kind, s.Name, d)
+			}
+		}
+	}
+	return nil
+}
+
+// writeIOTable writes the IOSP section body: a uint32 count, then per entry
+// kind, dtype, rank, name length (uint8), node id (uint32), the dimensions as
+// uint32 and the name
+func writeIOTable(w io.Writer, specs []IOSpec) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(specs))); err != nil {
+		return err
+	}
+	for _, s := range specs {
+		if len(s.Name) > 255 || len(s.Shape) > 255 {
+			return fmt.Errorf("%v %q exceeds the name or rank limit of 255", s.Kind, s.Name)
+		}
+		header := [8]byte{byte(s.Kind), byte(s.DType), byte(len(s.Shape)), byte(len(s.Name))}
+		binary.LittleEndian.PutUint32(header[4:], s.NodeID)
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		for _, d := range s.Shape {
+			if err := binary.Write(w, binary.LittleEndian, uint32(d)); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, s.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readIOTable reads a table written by writeIOTable
+func readIOTable(r io.Reader) ([]IOSpec, error) {
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	specs := make([]IOSpec, 0, min(count, 256))
+	for i := uint32(0); i < count; i++ {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("IO entry %d: %w", i, err)
+		}
+		dims := make([]uint32, header[2])
+		if err := binary.Read(r, binary.LittleEndian, dims); err != nil {
+			return nil, fmt.Errorf("IO entry %d: %w", i, err)
+		}
+		name := make([]byte, header[3])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, fmt.Errorf("IO entry %d: %w", i, err)
+		}
+		spec := IOSpec{
+			Name:   string(name),
+			Kind:   IOKind(header[0]),
+			DType:  DType(header[1]),
+			NodeID: binary.LittleEndian.Uint32(header[4:]),
+			Shape:  make([]int, len(dims)),
+		}
+		for j, d := range dims {
+			spec.Shape[j] = int(d)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
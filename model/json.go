@@ -0,0 +1,217 @@
+package model
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+// JSONVersion is the version of the interchange format written by
+// Graph.MarshalJSON
+const JSONVersion = 1
+
+// jsonZeroGap is the run of zero bytes that splits payload chunks
+const jsonZeroGap = 32
+
+// jsonGraph is the canonical JSON interchange form of a Graph. The payload
+// is stored as hex chunks at their offsets; bytes outside every chunk are
+// zero, so sparse payloads stay small.
+type jsonGraph struct {
+	Version     int                 `json:"version"`
+	Flags       uint16              `json:"flags,omitempty"`
+	Target      string              `json:"target,omitempty"`
+	Meta        Metadata            `json:"meta,omitempty"`
+	Nodes       []jsonNode          `json:"nodes"`
+	IO          []jsonIO            `json:"io,omitempty"`
+	Segments    []jsonSegment       `json:"segments,omitempty"`
+	Shapes      map[uint32][]int    `json:"shapes,omitempty"`
+	Costs       map[uint32]jsonCost `json:"costs,omitempty"`
+	Debug       *DebugInfo          `json:"debug,omitempty"`
+	PayloadSize int                 `json:"payload_size"`
+	Payload     []jsonChunk         `json:"payload,omitempty"`
+}
+
+type jsonNode struct {
+	ID      uint32   `json:"id"`
+	Kernel  uint8    `json:"kernel"`
+	Op      string   `json:"op,omitempty"` // Kernel name, informative only
+	In      uint32   `json:"in"`
+	Out     uint32   `json:"out"`
+	Flags   uint32   `json:"flags,omitempty"`
+	Topo    []uint32 `json:"topo,omitempty"`
+	Segment uint32   `json:"segment,omitempty"`
+}
+
+type jsonIO struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Node  uint32 `json:"node"`
+	DType string `json:"dtype,omitempty"`
+	Shape []int  `json:"shape"`
+}
+
+type jsonSegment struct {
+	ID     uint32 `json:"id"`
+	Offset uint32 `json:"offset"`
+	Length uint32 `json:"length"`
+	DType  string `json:"dtype,omitempty"`
+	Role   string `json:"role,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type jsonCost struct {
+	FLOPs uint64 `json:"flops,omitempty"`
+	Bytes uint64 `json:"bytes,omitempty"`
+	Nanos uint64 `json:"nanos,omitempty"`
+}
+
+type jsonChunk struct {
+	Offset int    `json:"offset"`
+	Data   string `json:"data"` // Hex
+}
+
+// MarshalJSON encodes the graph in the canonical JSON interchange format,
+// so tools in any language can inspect or generate models without the
+// binary format. Nodes keep their order, payload bytes are hex chunks with
+// long zero runs left out, and enumerations are written by name.
+func (g *Graph) MarshalJSON() ([]byte, error) {
+	jg := jsonGraph{
+		Version:     JSONVersion,
+		Flags:       g.Flags,
+		Meta:        g.Meta,
+		Nodes:       make([]jsonNode, len(g.Nodes)),
+		Shapes:      g.Shapes,
+		Debug:       g.Debug,
+		PayloadSize: len(g.Payload),
+		Payload:     payloadChunks(g.Payload),
+	}
+	if g.Target != TargetGeneric {
+		jg.Target = g.Target.String()
+	}
+	for i, n := range g.Nodes {
+		jg.Nodes[i] = jsonNode{ID: n.ID, Kernel: n.Kernel, Op: kernels.OpName(n.Kernel), In: n.In, Out: n.Out, Flags: n.Flags, Topo: n.Topo, Segment: n.Segment}
+	}
+	for _, s := range g.IO {
+		jg.IO = append(jg.IO, jsonIO{Name: s.Name, Kind: s.Kind.String(), Node: s.NodeID, DType: s.DType.String(), Shape: s.Shape})
+	}
+	for _, s := range g.Segments {
+		jg.Segments = append(jg.Segments, jsonSegment{ID: s.ID, Offset: s.Offset, Length: s.Length, DType: s.DType.String(), Role: s.Role.String(), Name: s.Name})
+	}
+	if len(g.Costs) > 0 {
+		jg.Costs = make(map[uint32]jsonCost, len(g.Costs))
+		for id, c := range g.Costs {
+			jg.Costs[id] = jsonCost(c)
+		}
+	}
+	return json.Marshal(jg)
+}
+
+// UnmarshalJSON decodes a graph written by MarshalJSON or by hand. Unknown
+// fields are errors so typos do not go unnoticed; omitted dtypes and roles
+// take their defaults.
+func (g *Graph) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var jg jsonGraph
+	if err := dec.Decode(&jg); err != nil {
+		return err
+	}
+	if jg.Version != JSONVersion {
+		return fmt.Errorf("unsupported JSON model version %d", jg.Version)
+	}
+
+	out := Graph{Flags: jg.Flags, Meta: jg.Meta, Shapes: jg.Shapes, Debug: jg.Debug}
+	var err error
+	if out.Target, err = ParseTarget(jg.Target); err != nil {
+		return err
+	}
+	for _, n := range jg.Nodes {
+		out.Nodes = append(out.Nodes, Node{ID: n.ID, Kernel: n.Kernel, In: n.In, Out: n.Out, Flags: n.Flags, Topo: n.Topo, Segment: n.Segment})
+	}
+	for _, s := range jg.IO {
+		spec := IOSpec{Name: s.Name, NodeID: s.Node, Shape: s.Shape}
+		switch s.Kind {
+		case "input":
+			spec.Kind = Input
+		case "output":
+			spec.Kind = Output
+		default:
+			return fmt.Errorf("io %q: unknown kind %q (want input or output)", s.Name, s.Kind)
+		}
+		var err error
+		if spec.DType, err = ParseDType(s.DType); err != nil {
+			return fmt.Errorf("io %q: %w", s.Name, err)
+		}
+		out.IO = append(out.IO, spec)
+	}
+	for _, s := range jg.Segments {
+		seg := Segment{ID: s.ID, Offset: s.Offset, Length: s.Length, Name: s.Name}
+		var err error
+		if seg.DType, err = ParseDType(s.DType); err != nil {
+			return fmt.Errorf("segment %d: %w", s.ID, err)
+		}
+		if seg.Role, err = ParseSegmentRole(s.Role); err != nil {
+			return fmt.Errorf("segment %d: %w", s.ID, err)
+		}
+		out.Segments = append(out.Segments, seg)
+	}
+	if len(jg.Costs) > 0 {
+		out.Costs = make(map[uint32]NodeCost, len(jg.Costs))
+		for id, c := range jg.Costs {
+			out.Costs[id] = NodeCost(c)
+		}
+	}
+
+	if jg.PayloadSize < 0 {
+		return fmt.Errorf("negative payload size %d", jg.PayloadSize)
+	}
+	out.Payload = make([]byte, jg.PayloadSize)
+	slices.SortStableFunc(jg.Payload, func(a, b jsonChunk) int { return cmp.Compare(a.Offset, b.Offset) })
+	end := 0
+	for _, c := range jg.Payload {
+		b, err := hex.DecodeString(c.Data)
+		if err != nil {
+			return fmt.Errorf("payload chunk at %d: %w", c.Offset, err)
+		}
+		if c.Offset < end || c.Offset+len(b) > len(out.Payload) {
+			return fmt.Errorf("payload chunk [%d, %d) overlaps another or exceeds payload size %d", c.Offset, c.Offset+len(b), len(out.Payload))
+		}
+		copy(out.Payload[c.Offset:], b)
+		end = c.Offset + len(b)
+	}
+	*g = out
+	return nil
+}
+
+// payloadChunks splits payload into hex chunks separated by runs of at
+// least jsonZeroGap zero bytes, which are left out
+func payloadChunks(payload []byte) []jsonChunk {
+	var chunks []jsonChunk
+	start, zeros := -1, 0
+	flush := func(end int) {
+		if start >= 0 {
+			chunks = append(chunks, jsonChunk{Offset: start, Data: hex.EncodeToString(payload[start:end])})
+			start = -1
+		}
+	}
+	for i, b := range payload {
+		if b != 0 {
+			if start < 0 {
+				start = i
+			}
+			zeros = 0
+			continue
+		}
+		zeros++
+		if zeros == jsonZeroGap {
+			flush(i + 1 - jsonZeroGap)
+		}
+	}
+	flush(len(payload) - zeros)
+	return chunks
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// headsGraph has two heads on a trunk, with a run of zeros in its payload
+// long enough to be left out of the JSON form
+func headsGraph() *Graph {
+	payload := make([]byte, 128)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	clear(payload[40:100])
+	return &Graph{
+		Payload: payload,
+		Nodes: []Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 32},
+			{ID: 1, Kernel: 3, In: 32, Out: 64, Topo: []uint32{0}},
+			{ID: 2, Kernel: 3, In: 64, Out: 100, Topo: []uint32{0}, Segment: 1},
+			{ID: 3, Kernel: 4, In: 100, Out: 108, Topo: []uint32{2}},
+		},
+		IO: []IOSpec{
+			{Name: "a", Kind: Output, NodeID: 1, Shape: []int{8}},
+			{Name: "b", Kind: Output, NodeID: 3, Shape: []int{2}},
+		},
+		Shapes:   map[uint32][]int{0: {8}, 1: {8}, 2: {9}, 3: {2}},
+		Segments: []Segment{{ID: 1, Offset: 64, Length: 36, Role: RoleWeight}},
+		Costs:    map[uint32]NodeCost{2: {FLOPs: 9, Bytes: 72, Nanos: 5}},
+		Meta:     Metadata{"name": "heads"},
+	}
+}
+
+func TestJSONInterchange(t *testing.T) {
+	t.Parallel()
+	g := headsGraph()
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if n := strings.Count(string(data), `"offset":`); n != 3 { // Two chunks and one segment
+		t.Errorf("Expected the zero run to split the payload in two chunks, got %s", data)
+	}
+	var back Graph
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(&back, g) {
+		t.Errorf("Expected a lossless round trip, got %+v", back)
+	}
+
+	for _, bad := range []string{
+		`{"version":2,"nodes":[],"payload_size":0}`,
+		`{"version":1,"nodes":[],"payload_size":0,"extra":1}`,
+		`{"version":1,"nodes":[],"payload_size":2,"payload":[{"offset":1,"data":"0102"}]}`,
+		`{"version":1,"nodes":[],"io":[{"name":"x","kind":"sideways","node":0,"shape":[1]}],"payload_size":0}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &back); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+
+}
@@ -0,0 +1,290 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sbl8/sublation/core"
+)
+
+// LinkModule is a compiled graph given to Link, with the name messages
+// and qualified segment names refer to it by
+type LinkModule struct {
+	Name  string
+	Graph *Graph
+}
+
+// LinkStats reports what Link resolved
+type LinkStats struct {
+	Bindings     int // Inputs bound to the output of another module
+	Deduplicated int // Weight and bias segments dropped as duplicates
+	SavedBytes   int // Payload bytes of the dropped segments
+}
+
+// Link merges separately compiled modules into one graph. Node and segment
+// IDs are renumbered past those of the modules before, and payloads are
+// laid out one after another. An input of one module named like an output
+// of another is bound to it: the input node depends on the output node and
+// is tied to its range, so it reads what the output node writes, and both
+// specs leave the IO table. Other input and output names must be unique
+// across modules. Weight and bias segments with the same name, dtype and
+// contents are stored once, and nodes bound to a duplicate use the first;
+// segments whose name is already taken are renamed to <module>.<name>.
+// The modules must be compiled for the same target; their metadata is
+// merged, earlier modules winning, and they are not modified.
+func Link(modules []LinkModule) (*Graph, LinkStats, error) {
+	var stats LinkStats
+	if len(modules) == 0 {
+		return nil, stats, fmt.Errorf("no modules to link")
+	}
+	first := modules[0]
+	l := &linker{
+		out:      &Graph{Target: first.Graph.Target},
+		owner:    make(map[uint32]int),
+		segOwner: make(map[uint32]int),
+		nextSeg:  1,
+	}
+	for k, m := range modules {
+		if m.Graph.Target != l.out.Target {
+			return nil, stats, fmt.Errorf("module %s is compiled for %v, %s for %v", m.Name, m.Graph.Target, first.Name, l.out.Target)
+		}
+		if err := l.add(k, m); err != nil {
+			return nil, stats, err
+		}
+	}
+
+	out := l.out
+	if err := out.linkSegments(modules, l.segOwner, &stats); err != nil {
+		return nil, stats, err
+	}
+	if err := out.linkIO(modules, l.owner, &stats); err != nil {
+		return nil, stats, err
+	}
+	// Drop the bytes nothing references any more: the buffers of bound
+	// inputs and the duplicate segments
+	out.alignPayload(32)
+	return out, stats, nil
+}
+
+// linker accumulates the modules given to Link into one graph
+type linker struct {
+	out      *Graph
+	owner    map[uint32]int // Module index of each node
+	segOwner map[uint32]int // Module index of each segment
+	nextNode uint64         // First free node ID
+	nextSeg  uint64         // First free segment ID
+}
+
+// add appends module k to the linked graph, renumbering its nodes and
+// segments past those added before and laying out its payload after theirs
+func (l *linker) add(k int, m LinkModule) error {
+	g, out := m.Graph, l.out
+	nodeBase, segBase := l.nextNode, l.nextSeg-1
+	payBase := uint64(core.Align32(len(out.Payload)))
+	if payBase+uint64(len(g.Payload)) > NoNeighbor {
+		return fmt.Errorf("module %s: payload overflows 32-bit offsets", m.Name)
+	}
+	out.Payload = append(out.Payload, make([]byte, int(payBase)-len(out.Payload))...)
+	out.Payload = append(out.Payload, g.Payload...)
+	out.Flags |= g.Flags
+	for key, v := range g.Meta {
+		if _, ok := out.Meta[key]; !ok {
+			if out.Meta == nil {
+				out.Meta = Metadata{}
+			}
+			out.Meta[key] = v
+		}
+	}
+
+	node := func(id uint32) uint32 { return uint32(nodeBase + uint64(id)) }
+	for _, n := range g.Nodes {
+		if nodeBase+uint64(n.ID) >= NoNeighbor {
+			return fmt.Errorf("module %s: node IDs overflow after %d", m.Name, nodeBase-1)
+		}
+		n.ID = node(n.ID)
+		n.In += uint32(payBase)
+		n.Out += uint32(payBase)
+		n.Topo = slices.Clone(n.Topo)
+		for i, t := range n.Topo {
+			if t != NoNeighbor {
+				n.Topo[i] = node(t)
+			}
+		}
+		if n.Segment != 0 {
+			n.Segment += uint32(segBase)
+		}
+		out.Nodes = append(out.Nodes, n)
+		l.owner[n.ID] = k
+		l.nextNode = max(l.nextNode, uint64(n.ID)+1)
+	}
+	for _, s := range g.Segments {
+		if segBase+uint64(s.ID) >= NoNeighbor {
+			return fmt.Errorf("module %s: segment IDs overflow after %d", m.Name, segBase)
+		}
+		s.ID += uint32(segBase)
+		s.Offset += uint32(payBase)
+		out.Segments = append(out.Segments, s)
+		l.segOwner[s.ID] = k
+		l.nextSeg = max(l.nextSeg, uint64(s.ID)+1)
+	}
+	out.addTables(g, node, uint32(segBase))
+	return nil
+}
+
+// addTables copies the IO specs, shapes, costs and debug information of src,
+// whose node IDs node maps and whose segment IDs are offset by segBase
+func (g *Graph) addTables(src *Graph, node func(uint32) uint32, segBase uint32) {
+	for _, s := range src.IO {
+		s.NodeID = node(s.NodeID)
+		s.Shape = slices.Clone(s.Shape)
+		g.IO = append(g.IO, s)
+	}
+	for id, shape := range src.Shapes {
+		if g.Shapes == nil {
+			g.Shapes = make(map[uint32][]int)
+		}
+		g.Shapes[node(id)] = slices.Clone(shape)
+	}
+	for id, c := range src.Costs {
+		if g.Costs == nil {
+			g.Costs = make(map[uint32]NodeCost)
+		}
+		g.Costs[node(id)] = c
+	}
+	if src.Debug.Empty() {
+		return
+	}
+	if g.Debug == nil {
+		g.Debug = &DebugInfo{Nodes: make(map[uint32]SourceInfo), Segments: make(map[uint32]SourceInfo)}
+	}
+	for id, s := range src.Debug.Nodes {
+		g.Debug.Nodes[node(id)] = s
+	}
+	for id, s := range src.Debug.Segments {
+		g.Debug.Segments[id+segBase] = s
+	}
+}
+
+// linkSegments stores duplicate weight and bias segments once and renames
+// segments whose name an earlier module took
+func (g *Graph) linkSegments(modules []LinkModule, owner map[uint32]int, stats *LinkStats) error {
+	type key struct {
+		name  string
+		dtype DType
+		role  SegmentRole
+		data  string
+	}
+	firsts := make(map[key]Segment)
+	replaced := make(map[uint32]Segment)
+	names := make(map[string]bool)
+	kept := g.Segments[:0]
+	for _, s := range g.Segments {
+		if s.End() > uint32(len(g.Payload)) {
+			return fmt.Errorf("segment %d [%d, %d) exceeds payload size %d", s.ID, s.Offset, s.End(), len(g.Payload))
+		}
+		if s.Role != RoleActivation {
+			k := key{s.Name, s.DType, s.Role, string(g.Payload[s.Offset:s.End()])}
+			if f, dup := firsts[k]; dup {
+				replaced[s.ID] = f
+				stats.Deduplicated++
+				stats.SavedBytes += int(s.Length)
+				continue
+			}
+			firsts[k] = s
+		}
+		if s.Name != "" && names[s.Name] {
+			s.Name = modules[owner[s.ID]].Name + "." + s.Name
+			if names[s.Name] {
+				return fmt.Errorf("segment name %q is used twice", s.Name)
+			}
+		}
+		names[s.Name] = true
+		kept = append(kept, s)
+	}
+	g.Segments = kept
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		if f, ok := replaced[n.Segment]; ok {
+			n.Segment, n.In, n.Out = f.ID, f.Offset, f.End()
+		}
+	}
+	return nil
+}
+
+// linkIO binds the inputs of each module to the outputs of the same name
+// of the others and checks that the remaining names are unique
+func (g *Graph) linkIO(modules []LinkModule, owner map[uint32]int, stats *LinkStats) error {
+	outputs := make(map[string]int) // Index in g.IO
+	for i, s := range g.IO {
+		if s.Kind != Output {
+			continue
+		}
+		if prev, dup := outputs[s.Name]; dup {
+			return fmt.Errorf("output %q is declared by modules %s and %s", s.Name, modules[owner[g.IO[prev].NodeID]].Name, modules[owner[s.NodeID]].Name)
+		}
+		outputs[s.Name] = i
+	}
+
+	index := g.nodeIndex()
+	bound := make([]bool, len(g.IO))
+	inputs := make(map[string]IOSpec)
+	var orphans []uint32
+	for i, s := range g.IO {
+		if s.Kind != Input {
+			continue
+		}
+		j, ok := outputs[s.Name]
+		o := g.IO[j]
+		if !ok || owner[o.NodeID] == owner[s.NodeID] {
+			if prev, dup := inputs[s.Name]; dup {
+				return fmt.Errorf("input %q is declared by modules %s and %s", s.Name, modules[owner[prev.NodeID]].Name, modules[owner[s.NodeID]].Name)
+			}
+			inputs[s.Name] = s
+			continue
+		}
+		if o.DType != s.DType || !slices.Equal(o.Shape, s.Shape) {
+			return fmt.Errorf("input %q of module %s is %v %v, the output of module %s is %v %v",
+				s.Name, modules[owner[s.NodeID]].Name, s.DType, s.Shape, modules[owner[o.NodeID]].Name, o.DType, o.Shape)
+		}
+		if seg := g.Nodes[index[s.NodeID]].Segment; seg != 0 {
+			orphans = append(orphans, seg)
+		}
+		g.bindNode(index, s.NodeID, o.NodeID)
+		bound[i], bound[j] = true, true
+		stats.Bindings++
+	}
+	var io []IOSpec
+	for i, s := range g.IO {
+		if !bound[i] {
+			io = append(io, s)
+		}
+	}
+	g.IO = io
+
+	// The segments of bound inputs go unless another node uses them
+	for _, n := range g.Nodes {
+		orphans = slices.DeleteFunc(orphans, func(id uint32) bool { return id == n.Segment })
+	}
+	g.Segments = slices.DeleteFunc(g.Segments, func(s Segment) bool { return slices.Contains(orphans, s.ID) })
+	return nil
+}
+
+// bindNode ties node id, and the nodes already tied to it, to the range of
+// node src and makes it depend on src
+func (g *Graph) bindNode(index map[uint32]int, id, src uint32) {
+	from := g.Nodes[index[src]]
+	n := &g.Nodes[index[id]]
+	in, out, shared := n.In, n.Out, n.Flags&core.FlagShared != 0
+	for i := range g.Nodes {
+		t := &g.Nodes[i]
+		if t.ID != id && !(shared && t.Flags&core.FlagShared != 0 && t.In == in && t.Out == out) {
+			continue
+		}
+		t.In, t.Out, t.Segment = from.In, from.Out, from.Segment
+		t.Flags |= core.FlagShared
+	}
+	if !slices.Contains(n.Topo, src) {
+		n.Topo = append(n.Topo, src)
+	}
+	g.Nodes[index[src]].Flags |= core.FlagShared
+}
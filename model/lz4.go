@@ -0,0 +1,140 @@
+package model
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// LZ4 block format, as specified at https://github.com/lz4/lz4. Each
+// sequence is a token (literal length << 4 | match length - 4), optional
+// length extension bytes, the literals, a little-endian uint16 match offset
+// and optional match length extension bytes. The last sequence holds
+// literals only.
+const (
+	lz4MinMatch  = 4
+	lz4MFLimit   = 12 // No match starts within the last 12 bytes
+	lz4LastLits  = 5  // The last 5 bytes are always literals
+	lz4MaxOffset = 0xFFFF
+	lz4HashLog   = 16
+)
+
+var errLZ4Corrupt = errors.New("corrupt lz4 block")
+
+// lz4Compress encodes src as one LZ4 block with a greedy single-probe
+// matcher; it favors load-time decode speed over ratio
+func lz4Compress(src []byte) []byte {
+	dst := make([]byte, 0, len(src)/2+16)
+	table := make([]int32, 1<<lz4HashLog) // Last position + 1 of each hash
+	anchor := 0
+	for i := 0; i < len(src)-lz4MFLimit; {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		ref := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+			i++
+			continue
+		}
+
+		end := i + lz4MinMatch
+		for end < len(src)-lz4LastLits && src[end] == src[ref+end-i] {
+			end++
+		}
+		dst = lz4Sequence(dst, src[anchor:i], i-ref, end-i)
+		i, anchor = end, end
+	}
+
+	lits := src[anchor:]
+	dst = append(dst, byte(min(len(lits), 15)<<4))
+	dst = lz4Length(dst, len(lits))
+	return append(dst, lits...)
+}
+
+// lz4Sequence appends literals followed by a match of length n at offset
+func lz4Sequence(dst, lits []byte, offset, n int) []byte {
+	n -= lz4MinMatch
+	dst = append(dst, byte(min(len(lits), 15)<<4|min(n, 15)))
+	dst = lz4Length(dst, len(lits))
+	dst = append(dst, lits...)
+	dst = append(dst, byte(offset), byte(offset>>8))
+	return lz4Length(dst, n)
+}
+
+// lz4Length appends the extension bytes of a length whose token nibble is 15
+func lz4Length(dst []byte, n int) []byte {
+	if n < 15 {
+		return dst
+	}
+	for n -= 15; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4Decompress decodes the block src into dst, which must have exactly the
+// uncompressed size
+func lz4Decompress(dst, src []byte) error {
+	d, s := 0, 0
+	readLength := func(n int) (int, error) {
+		if n < 15 {
+			return n, nil
+		}
+		for {
+			if s >= len(src) {
+				return 0, errLZ4Corrupt
+			}
+			b := src[s]
+			s++
+			n += int(b)
+			if n > len(dst) {
+				return 0, errLZ4Corrupt
+			}
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+
+	for s < len(src) {
+		token := src[s]
+		s++
+		lits, err := readLength(int(token >> 4))
+		if err != nil {
+			return err
+		}
+		if lits > len(src)-s || lits > len(dst)-d {
+			return errLZ4Corrupt
+		}
+		d += copy(dst[d:], src[s:s+lits])
+		s += lits
+		if s == len(src) {
+			break
+		}
+
+		if len(src)-s < 2 {
+			return errLZ4Corrupt
+		}
+		offset := int(binary.LittleEndian.Uint16(src[s:]))
+		s += 2
+		n, err := readLength(int(token & 15))
+		if err != nil {
+			return err
+		}
+		n += lz4MinMatch
+		if offset == 0 || offset > d || n > len(dst)-d {
+			return errLZ4Corrupt
+		}
+		if offset >= n {
+			d += copy(dst[d:d+n], dst[d-offset:])
+			continue
+		}
+		for ; n > 0; n-- { // Overlapping match repeats the last offset bytes
+			dst[d] = dst[d-offset]
+			d++
+		}
+	}
+	if d != len(dst) {
+		return errLZ4Corrupt
+	}
+	return nil
+}
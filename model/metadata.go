@@ -0,0 +1,90 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Metadata is free-form key/value provenance carried in the META section.
+// Keys are unique and written in sorted order, so equal metadata always
+// serializes to equal bytes.
+type Metadata map[string]string
+
+// Well-known metadata keys; any other key is preserved as is
+const (
+	MetaAuthor        = "author"
+	MetaTrainingRun   = "training_run"
+	MetaGitCommit     = "git_commit"
+	MetaLicense       = "license"
+	MetaCreated       = "created"       // RFC 3339 time the model was compiled
+	MetaNormalization = "normalization" // Input normalization constants, e.g. "mean=0.5 std=0.25"
+)
+
+const sectionMetadata = 0x4154454D // "META"
+
+// Metadata returns a copy of the graph's metadata, empty when it has none
+func (g *Graph) Metadata() Metadata {
+	m := make(Metadata, len(g.Meta))
+	maps.Copy(m, g.Meta)
+	return m
+}
+
+// Keys returns the metadata keys in sorted order
+func (m Metadata) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// writeMetadata writes the META section body: a uint32 count, then per
+// entry the key length (uint16), value length (uint32), key and value
+func writeMetadata(buf *bytes.Buffer, m Metadata) error {
+	var b [6]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(m)))
+	buf.Write(b[:4])
+	for _, k := range m.Keys() {
+		v := m[k]
+		if k == "" || len(k) > 0xFFFF {
+			return fmt.Errorf("metadata key %q must be 1 to %d bytes", k, 0xFFFF)
+		}
+		binary.LittleEndian.PutUint16(b[0:], uint16(len(k)))
+		binary.LittleEndian.PutUint32(b[2:], uint32(len(v)))
+		buf.Write(b[:])
+		buf.WriteString(k)
+		buf.WriteString(v)
+	}
+	return nil
+}
+
+// readMetadata reads a section written by writeMetadata
+func readMetadata(body []byte) (Metadata, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("truncated entry count")
+	}
+	count := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	m := make(Metadata, min(count, 64))
+	for i := uint32(0); i < count; i++ {
+		if len(body) < 6 {
+			return nil, fmt.Errorf("entry %d: truncated header", i)
+		}
+		kl, vl := int(binary.LittleEndian.Uint16(body)), uint64(binary.LittleEndian.Uint32(body[2:]))
+		body = body[6:]
+		if uint64(len(body)) < uint64(kl)+vl {
+			return nil, fmt.Errorf("entry %d: truncated key or value", i)
+		}
+		k, v := string(body[:kl]), string(body[kl:kl+int(vl)])
+		if _, dup := m[k]; dup {
+			return nil, fmt.Errorf("duplicate key %q", k)
+		}
+		m[k] = v
+		body = body[kl+int(vl):]
+	}
+	return m, nil
+}
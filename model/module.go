@@ -0,0 +1,129 @@
+package model
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sbl8/sublation/core"
+)
+
+// Module is a reusable subgraph: a named group of nodes with its own
+// payload and declared inputs and outputs. Node IDs, topology and payload
+// offsets are local to the module; Instantiate rebases them into a graph.
+type Module struct {
+	Name    string
+	Nodes   []Node
+	Payload []byte
+	Inputs  []uint32 // Local IDs of the nodes fed by an instance's dependencies
+	Outputs []uint32 // Local IDs of the nodes an instance's consumers read
+}
+
+// Span returns the ID range one instance occupies: the largest local ID
+// plus one
+func (m *Module) Span() uint32 {
+	span := uint32(0)
+	for _, n := range m.Nodes {
+		span = max(span, n.ID+1)
+	}
+	return span
+}
+
+// Validate checks that local IDs are unique, that topology stays inside the
+// module and that the declared inputs and outputs name its nodes
+func (m *Module) Validate() error {
+	if len(m.Nodes) == 0 {
+		return fmt.Errorf("module %s has no nodes", m.Name)
+	}
+	ids := make(map[uint32]bool, len(m.Nodes))
+	for _, n := range m.Nodes {
+		if ids[n.ID] {
+			return fmt.Errorf("module %s: duplicate node ID %d", m.Name, n.ID)
+		}
+		if n.Segment != 0 {
+			return fmt.Errorf("module %s: node %d references segment %d; modules use raw offsets", m.Name, n.ID, n.Segment)
+		}
+		ids[n.ID] = true
+	}
+	for _, n := range m.Nodes {
+		for _, dep := range n.Topo {
+			if dep != NoNeighbor && !ids[dep] {
+				return fmt.Errorf("module %s: node %d references non-existent node %d", m.Name, n.ID, dep)
+			}
+		}
+	}
+	for _, id := range m.Inputs {
+		if !ids[id] {
+			return fmt.Errorf("module %s: input %d is not a node", m.Name, id)
+		}
+	}
+	if len(m.Outputs) == 0 {
+		return fmt.Errorf("module %s declares no outputs", m.Name)
+	}
+	for _, id := range m.Outputs {
+		if !ids[id] {
+			return fmt.Errorf("module %s: output %d is not a node", m.Name, id)
+		}
+	}
+	return nil
+}
+
+// Instantiate appends a copy of m to the graph and returns the graph IDs of
+// its outputs. Node IDs are offset by base, the module payload is appended
+// at the next 32-byte boundary with node offsets moved along, and every
+// input node additionally depends on deps. Each instance has its own copy
+// of the payload; tie nodes to share it.
+func (g *Graph) Instantiate(m *Module, base uint32, deps []uint32) ([]uint32, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if uint64(base)+uint64(m.Span()) > math.MaxUint32 {
+		return nil, fmt.Errorf("module %s: instance at %d overflows node IDs", m.Name, base)
+	}
+	offset := core.Align32(len(g.Payload))
+	if uint64(offset)+uint64(len(m.Payload)) > math.MaxUint32 {
+		return nil, fmt.Errorf("module %s: payload exceeds 4 GiB", m.Name)
+	}
+
+	ids := make(map[uint32]bool, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids[n.ID] = true
+	}
+	inputs := make(map[uint32]bool, len(m.Inputs))
+	for _, id := range m.Inputs {
+		inputs[id] = true
+	}
+
+	nodes := make([]Node, 0, len(m.Nodes))
+	for _, n := range m.Nodes {
+		n.ID += base
+		if ids[n.ID] {
+			return nil, fmt.Errorf("module %s: instance node %d collides with an existing node", m.Name, n.ID)
+		}
+		n.In += uint32(offset)
+		n.Out += uint32(offset)
+		topo := make([]uint32, 0, len(n.Topo)+len(deps))
+		for _, dep := range n.Topo {
+			if dep != NoNeighbor {
+				topo = append(topo, dep+base)
+			}
+		}
+		if inputs[n.ID-base] {
+			topo = append(topo, deps...)
+		}
+		n.Topo = nil
+		if len(topo) > 0 {
+			n.Topo = topo
+		}
+		nodes = append(nodes, n)
+	}
+
+	g.Nodes = append(g.Nodes, nodes...)
+	g.Payload = append(g.Payload, make([]byte, offset-len(g.Payload))...)
+	g.Payload = append(g.Payload, m.Payload...)
+
+	outputs := make([]uint32, len(m.Outputs))
+	for i, id := range m.Outputs {
+		outputs[i] = id + base
+	}
+	return outputs, nil
+}
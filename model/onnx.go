@@ -0,0 +1,528 @@
+package model
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+// ONNX versions written by ExportONNX
+const (
+	onnxIRVersion = 7
+	onnxOpset     = 13
+)
+
+// ErrNoONNX is returned by ExportONNX for a kernel whose results no ONNX
+// operator reproduces, such as the rational tanh approximation
+var ErrNoONNX = errors.New("kernel has no exact ONNX equivalent")
+
+// ONNX TensorProto data types
+const (
+	onnxFloat = 1
+	onnxInt64 = 7
+)
+
+// ExportONNX encodes the graph as an ONNX model (IR version 7, opset 13) so
+// its numerical outputs can be cross-checked with onnxruntime. Data flows as
+// InferShapes assumes: a node consumes the outputs of its dependencies, the
+// input bound to it, or else the operands in its payload, which become
+// initializers. Every node needs a known shape, all IO must be float32, and
+// only kernels that map exactly are supported; the sigmoid kernel, which
+// computes x/(1+|x|), is exported as Softsign. Declared outputs, or nodes
+// nothing depends on when there are none, become the graph outputs.
+func (g *Graph) ExportONNX() ([]byte, error) {
+	shapes := g.Shapes
+	if len(shapes) == 0 {
+		c := *g
+		if err := c.InferShapes(); err != nil {
+			return nil, err
+		}
+		shapes = c.Shapes
+	}
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &onnxExporter{g: g, shapes: shapes}
+	for _, s := range g.Inputs() {
+		if s.DType != Float32 {
+			return nil, fmt.Errorf("onnx: input %q is %v, only float32 is supported", s.Name, s.DType)
+		}
+		e.graph.message(11, onnxValueInfo(s.Name, s.Shape))
+	}
+	for _, i := range order {
+		if err := e.exportNode(g.Nodes[i]); err != nil {
+			return nil, fmt.Errorf("onnx: node %d (%s): %w", g.Nodes[i].ID, kernels.OpName(g.Nodes[i].Kernel), err)
+		}
+	}
+	if err := e.exportOutputs(); err != nil {
+		return nil, fmt.Errorf("onnx: %w", err)
+	}
+	name := g.Meta["name"]
+	if name == "" {
+		name = "sublation"
+	}
+	e.graph.string(2, name)
+
+	var opset, model protoBuf
+	opset.string(1, "")
+	opset.varint(2, onnxOpset)
+	model.varint(1, onnxIRVersion)
+	model.string(2, "sublation")
+	model.message(7, &e.graph)
+	model.message(8, &opset)
+	for _, k := range g.Meta.Keys() {
+		var prop protoBuf
+		prop.string(1, k)
+		prop.string(2, g.Meta[k])
+		model.message(14, &prop)
+	}
+	return model.b, nil
+}
+
+// onnxExporter accumulates the ONNX GraphProto of a graph
+type onnxExporter struct {
+	g      *Graph
+	shapes map[uint32][]int
+	graph  protoBuf
+	names  int // Counter for intermediate tensors and initializers
+}
+
+// onnxName returns the tensor holding the output of node id
+func onnxName(id uint32) string {
+	return "node_" + strconv.FormatUint(uint64(id), 10)
+}
+
+// tmp returns a fresh tensor name
+func (e *onnxExporter) tmp(prefix string) string {
+	e.names++
+	return prefix + "_" + strconv.Itoa(e.names)
+}
+
+// node appends an operator writing out
+func (e *onnxExporter) node(op, out string, inputs []string) {
+	var n protoBuf
+	for _, in := range inputs {
+		n.string(1, in)
+	}
+	n.string(2, out)
+	n.string(4, op)
+	e.graph.message(1, &n)
+}
+
+// chain appends a sequence of operators, each consuming the previous
+// result and the extra inputs given for it, and ends in out
+func (e *onnxExporter) chain(x, out string, steps ...onnxStep) {
+	for i, s := range steps {
+		next := out
+		if i < len(steps)-1 {
+			next = e.tmp("t")
+		}
+		e.node(s.op, next, append([]string{x}, s.args...))
+		x = next
+	}
+}
+
+// onnxStep is one operator of a chain
+type onnxStep struct {
+	op   string
+	args []string
+}
+
+// floats adds a float32 initializer holding raw little-endian data
+func (e *onnxExporter) floats(data []byte, dims ...int) string {
+	return e.initializer(onnxFloat, data, dims)
+}
+
+// scalar adds a float32 scalar initializer
+func (e *onnxExporter) scalar(v float32) string {
+	return e.floats(binary.LittleEndian.AppendUint32(nil, math.Float32bits(v)))
+}
+
+// shape adds an int64 initializer holding dims, as Reshape expects
+func (e *onnxExporter) shape(dims ...int) string {
+	var data []byte
+	for _, d := range dims {
+		data = binary.LittleEndian.AppendUint64(data, uint64(int64(d)))
+	}
+	return e.initializer(onnxInt64, data, []int{len(dims)})
+}
+
+func (e *onnxExporter) initializer(dtype int, data []byte, dims []int) string {
+	name := e.tmp("c")
+	var t protoBuf
+	for _, d := range dims {
+		t.varint(1, uint64(d))
+	}
+	t.varint(2, uint64(dtype))
+	t.string(8, name)
+	t.bytes(9, data)
+	e.graph.message(5, &t)
+	return name
+}
+
+// operands returns the tensors node n consumes: its dependencies' outputs or
+// the inputs bound to it, or none when it reads its payload
+func (e *onnxExporter) operands(n Node) []string {
+	var ins []string
+	for _, dep := range n.Topo {
+		if dep != NoNeighbor {
+			ins = append(ins, onnxName(dep))
+		}
+	}
+	if len(ins) == 0 {
+		for _, s := range e.g.Inputs() {
+			if s.NodeID == n.ID {
+				ins = append(ins, s.Name)
+			}
+		}
+	}
+	return ins
+}
+
+// vector returns the single operand of n, or the payload bytes [from, to)
+// as a float32 initializer of the given dims
+func (e *onnxExporter) vector(ins []string, payload []byte, from, to int, dims ...int) (string, error) {
+	switch {
+	case len(ins) == 1:
+		return ins[0], nil
+	case len(ins) > 1:
+		return "", fmt.Errorf("%d operands, want 1", len(ins))
+	case to > len(payload) || from > to:
+		return "", fmt.Errorf("operand [%d, %d) exceeds the %d byte payload", from, to, len(payload))
+	}
+	return e.floats(payload[from:to], dims...), nil
+}
+
+// onnxOp is the node being exported with what its emitter needs
+type onnxOp struct {
+	kernel  byte
+	shape   []int    // Output shape
+	size    int      // Output bytes
+	payload []byte   // The node's payload segment
+	out     string   // Output tensor
+	ins     []string // Operand tensors, see operands
+}
+
+// onnxEmitters appends the operators computing each supported kernel
+var onnxEmitters = map[byte]func(*onnxExporter, onnxOp) error{
+	kernels.OpNoop:            (*onnxExporter).emitElementwise,
+	kernels.OpReLU:            (*onnxExporter).emitElementwise,
+	kernels.OpSigmoid:         (*onnxExporter).emitElementwise,
+	kernels.OpSqrPlusX:        (*onnxExporter).emitElementwise,
+	kernels.OpSoftmax:         (*onnxExporter).emitElementwise,
+	kernels.OpAdd:             (*onnxExporter).emitBinary,
+	kernels.OpMul:             (*onnxExporter).emitBinary,
+	kernels.OpSum:             (*onnxExporter).emitReduce,
+	kernels.OpMax:             (*onnxExporter).emitReduce,
+	kernels.OpMatMul:          (*onnxExporter).emitMatMul,
+	kernels.OpMatMulTiled:     (*onnxExporter).emitMatMul,
+	kernels.OpConv1D:          (*onnxExporter).emitConv1D,
+	kernels.OpBatchNorm:       (*onnxExporter).emitBatchNorm,
+	kernels.OpMatMulBiasAct:   (*onnxExporter).emitMatMulBiasAct,
+	kernels.OpConv1DBatchNorm: (*onnxExporter).emitConv1DBatchNorm,
+}
+
+// exportNode appends the operators computing node n with its kernel's
+// emitter
+func (e *onnxExporter) exportNode(n Node) error {
+	shape, ok := e.shapes[n.ID]
+	if !ok {
+		return fmt.Errorf("unknown output shape")
+	}
+	emit, ok := onnxEmitters[n.Kernel]
+	if !ok {
+		return ErrNoONNX
+	}
+	op := onnxOp{kernel: n.Kernel, shape: shape, size: 4 * kernels.Elements(shape), out: onnxName(n.ID), ins: e.operands(n)}
+	if n.Out > n.In && int(n.Out) <= len(e.g.Payload) {
+		op.payload = e.g.Payload[n.In:n.Out]
+	}
+	return emit(e, op)
+}
+
+// emitElementwise exports the kernels of one operand applied elementwise,
+// and softmax
+func (e *onnxExporter) emitElementwise(op onnxOp) error {
+	x, err := e.vector(op.ins, op.payload, 0, op.size, op.shape...)
+	if err != nil {
+		return err
+	}
+	switch op.kernel {
+	case kernels.OpNoop:
+		e.node("Identity", op.out, []string{x})
+	case kernels.OpReLU:
+		e.node("Relu", op.out, []string{x})
+	case kernels.OpSigmoid:
+		e.node("Softsign", op.out, []string{x})
+	case kernels.OpSqrPlusX:
+		e.chain(x, op.out, onnxStep{op: "Mul", args: []string{x}}, onnxStep{op: "Add", args: []string{x}})
+	case kernels.OpSoftmax:
+		// The kernel normalizes over every element
+		e.chain(x, op.out,
+			onnxStep{op: "Reshape", args: []string{e.shape(-1)}},
+			onnxStep{op: "Softmax"},
+			onnxStep{op: "Reshape", args: []string{e.shape(op.shape...)}})
+	}
+	return nil
+}
+
+// emitBinary exports add and mul
+func (e *onnxExporter) emitBinary(op onnxOp) error {
+	name := map[byte]string{kernels.OpAdd: "Add", kernels.OpMul: "Mul"}[op.kernel]
+	switch len(op.ins) {
+	case 2:
+		e.node(name, op.out, op.ins)
+	case 0:
+		if 2*op.size > len(op.payload) {
+			return fmt.Errorf("operands exceed the %d byte payload", len(op.payload))
+		}
+		e.node(name, op.out, []string{e.floats(op.payload[:op.size], op.shape...), e.floats(op.payload[op.size:2*op.size], op.shape...)})
+	default:
+		return fmt.Errorf("%d operands, want 2", len(op.ins))
+	}
+	return nil
+}
+
+// emitReduce exports sum and max over every element
+func (e *onnxExporter) emitReduce(op onnxOp) error {
+	x, err := e.vector(op.ins, op.payload, 0, len(op.payload)&^3, len(op.payload)/4)
+	if err != nil {
+		return err
+	}
+	name := map[byte]string{kernels.OpSum: "ReduceSum", kernels.OpMax: "ReduceMax"}[op.kernel]
+	e.chain(x, op.out, onnxStep{op: "Reshape", args: []string{e.shape(-1)}}, onnxStep{op: name})
+	return nil
+}
+
+// emitMatMul exports matmul and matmul_tiled
+func (e *onnxExporter) emitMatMul(op onnxOp) error {
+	payload := op.payload
+	header := 6
+	if op.kernel == kernels.OpMatMulTiled {
+		header = kernels.MatMulTiledHeader
+	}
+	if len(payload) < header {
+		if op.kernel == kernels.OpMatMulTiled {
+			return fmt.Errorf("missing matmul_tiled header")
+		}
+		if len(op.ins) != 2 {
+			return fmt.Errorf("%d operands, want 2", len(op.ins))
+		}
+		e.node("MatMul", op.out, op.ins)
+		return nil
+	}
+	rows := int(binary.LittleEndian.Uint16(payload[0:]))
+	cols := int(binary.LittleEndian.Uint16(payload[2:]))
+	bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+	aEnd := header + 4*rows*cols
+	if aEnd+4*cols*bCols > len(payload) {
+		return fmt.Errorf("operands exceed the %d byte payload", len(payload))
+	}
+	a, err := e.vector(op.ins, payload, header, aEnd, rows, cols)
+	if err != nil {
+		return err
+	}
+	b := e.floats(payload[aEnd:aEnd+4*cols*bCols], cols, bCols)
+	e.chain(a, op.out, onnxStep{op: "Reshape", args: []string{e.shape(rows, cols)}}, onnxStep{op: "MatMul", args: []string{b}})
+	return nil
+}
+
+// emitConv1D exports conv1d
+func (e *onnxExporter) emitConv1D(op onnxOp) error {
+	payload := op.payload
+	if len(payload) < 4 {
+		return fmt.Errorf("missing conv1d header")
+	}
+	length := int(binary.LittleEndian.Uint16(payload[0:]))
+	taps := int(binary.LittleEndian.Uint16(payload[2:]))
+	xEnd := 4 + 4*length
+	if xEnd+4*taps > len(payload) {
+		return fmt.Errorf("operands exceed the %d byte payload", len(payload))
+	}
+	x, err := e.vector(op.ins, payload, 4, xEnd, length)
+	if err != nil {
+		return err
+	}
+	w := e.floats(payload[xEnd:xEnd+4*taps], 1, 1, taps)
+	e.chain(x, op.out,
+		onnxStep{op: "Reshape", args: []string{e.shape(1, 1, length)}},
+		onnxStep{op: "Conv", args: []string{w}},
+		onnxStep{op: "Reshape", args: []string{e.shape(op.shape...)}})
+	return nil
+}
+
+// emitBatchNorm exports batchnorm
+func (e *onnxExporter) emitBatchNorm(op onnxOp) error {
+	payload := op.payload
+	if len(payload) < 18 {
+		return fmt.Errorf("missing batchnorm header")
+	}
+	count := int(binary.LittleEndian.Uint16(payload[0:]))
+	param := func(off int) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(payload[off:])) }
+	x, err := e.vector(op.ins, payload, 18, 18+4*count, count)
+	if err != nil {
+		return err
+	}
+	// Same operations, in the same order and precision, as the kernel
+	invStd := 1.0 / float32(math.Sqrt(float64(param(6))+1e-5))
+	e.chain(x, op.out,
+		onnxStep{op: "Reshape", args: []string{e.shape(-1)}},
+		onnxStep{op: "Sub", args: []string{e.scalar(param(2))}},
+		onnxStep{op: "Mul", args: []string{e.scalar(invStd)}},
+		onnxStep{op: "Mul", args: []string{e.scalar(param(10))}},
+		onnxStep{op: "Add", args: []string{e.scalar(param(14))}})
+	return nil
+}
+
+// emitMatMulBiasAct exports the fused matmul_bias_act
+func (e *onnxExporter) emitMatMulBiasAct(op onnxOp) error {
+	payload := op.payload
+	if len(payload) < 8 {
+		return fmt.Errorf("missing matmul_bias_act header")
+	}
+	rows := int(binary.LittleEndian.Uint16(payload[0:]))
+	cols := int(binary.LittleEndian.Uint16(payload[2:]))
+	bCols := int(binary.LittleEndian.Uint16(payload[4:]))
+	aEnd := 8 + 4*rows*cols
+	bEnd := aEnd + 4*cols*bCols
+	if bEnd+4*rows*bCols > len(payload) {
+		return fmt.Errorf("operands exceed the %d byte payload", len(payload))
+	}
+	act, err := onnxActivation(uint32(binary.LittleEndian.Uint16(payload[6:])))
+	if err != nil {
+		return err
+	}
+	a, err := e.vector(op.ins, payload, 8, aEnd, rows, cols)
+	if err != nil {
+		return err
+	}
+	steps := []onnxStep{
+		{op: "Reshape", args: []string{e.shape(rows, cols)}},
+		{op: "MatMul", args: []string{e.floats(payload[aEnd:bEnd], cols, bCols)}},
+		{op: "Add", args: []string{e.floats(payload[bEnd:bEnd+4*rows*bCols], rows, bCols)}},
+	}
+	e.chain(a, op.out, append(steps, act...)...)
+	return nil
+}
+
+// emitConv1DBatchNorm exports the fused conv1d_bn
+func (e *onnxExporter) emitConv1DBatchNorm(op onnxOp) error {
+	payload := op.payload
+	if len(payload) < 4 {
+		return fmt.Errorf("missing conv1d_bn header")
+	}
+	length := int(binary.LittleEndian.Uint16(payload[0:]))
+	taps := int(binary.LittleEndian.Uint16(payload[2:]))
+	xEnd := 4 + 4*length
+	end := xEnd + 4*taps
+	if end+20 > len(payload) {
+		return fmt.Errorf("operands exceed the %d byte payload", len(payload))
+	}
+	act, err := onnxActivation(binary.LittleEndian.Uint32(payload[end+16:]))
+	if err != nil {
+		return err
+	}
+	x, err := e.vector(op.ins, payload, 4, xEnd, length)
+	if err != nil {
+		return err
+	}
+	param := func(i int) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(payload[end+4*i:])) }
+	invStd := 1.0 / float32(math.Sqrt(float64(param(1))+1e-5))
+	steps := []onnxStep{
+		{op: "Reshape", args: []string{e.shape(1, 1, length)}},
+		{op: "Conv", args: []string{e.floats(payload[xEnd:end], 1, 1, taps)}},
+		{op: "Reshape", args: []string{e.shape(-1)}},
+		{op: "Sub", args: []string{e.scalar(param(0))}},
+		{op: "Mul", args: []string{e.scalar(invStd)}},
+		{op: "Mul", args: []string{e.scalar(param(2))}},
+		{op: "Add", args: []string{e.scalar(param(3))}},
+	}
+	e.chain(x, op.out, append(steps, act...)...)
+	return nil
+}
+
+// onnxActivation returns the step applying the activation of a fused
+// kernel, none for opcode 0
+func onnxActivation(opcode uint32) ([]onnxStep, error) {
+	switch opcode {
+	case 0:
+		return nil, nil
+	case kernels.OpReLU:
+		return []onnxStep{{op: "Relu"}}, nil
+	case kernels.OpSigmoid:
+		return []onnxStep{{op: "Softsign"}}, nil
+	}
+	return nil, ErrNoONNX
+}
+
+// exportOutputs declares the graph outputs, reshaped to their declared
+// shapes
+func (e *onnxExporter) exportOutputs() error {
+	outputs := e.g.Outputs()
+	if len(outputs) == 0 {
+		used := make(map[uint32]bool)
+		for _, n := range e.g.Nodes {
+			for _, dep := range n.Topo {
+				used[dep] = true
+			}
+		}
+		for _, n := range e.g.Nodes {
+			if !used[n.ID] {
+				e.graph.message(12, onnxValueInfo(onnxName(n.ID), e.shapes[n.ID]))
+			}
+		}
+		return nil
+	}
+	for _, s := range outputs {
+		if s.DType != Float32 {
+			return fmt.Errorf("output %q is %v, only float32 is supported", s.Name, s.DType)
+		}
+		e.node("Reshape", s.Name, []string{onnxName(s.NodeID), e.shape(s.Shape...)})
+		e.graph.message(12, onnxValueInfo(s.Name, s.Shape))
+	}
+	return nil
+}
+
+// onnxValueInfo returns a ValueInfoProto of a float32 tensor
+func onnxValueInfo(name string, shape []int) *protoBuf {
+	var dims, tensor, typ, info protoBuf
+	for _, d := range shape {
+		var dim protoBuf
+		dim.varint(1, uint64(d))
+		dims.message(1, &dim)
+	}
+	tensor.varint(1, onnxFloat)
+	tensor.message(2, &dims)
+	typ.message(1, &tensor)
+	info.string(1, name)
+	info.message(2, &typ)
+	return &info
+}
+
+// protoBuf appends protocol buffer fields to b
+type protoBuf struct {
+	b []byte
+}
+
+// varint appends a varint field (wire type 0)
+func (p *protoBuf) varint(field int, v uint64) {
+	p.b = binary.AppendUvarint(p.b, uint64(field)<<3)
+	p.b = binary.AppendUvarint(p.b, v)
+}
+
+// bytes appends a length-delimited field (wire type 2)
+func (p *protoBuf) bytes(field int, b []byte) {
+	p.b = binary.AppendUvarint(p.b, uint64(field)<<3|2)
+	p.b = binary.AppendUvarint(p.b, uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+func (p *protoBuf) string(field int, s string) { p.bytes(field, []byte(s)) }
+
+func (p *protoBuf) message(field int, m *protoBuf) { p.bytes(field, m.b) }
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+// protoFields returns the length-delimited fields number of a protobuf
+// message in order, skipping varints
+func protoFields(t *testing.T, msg []byte, number uint64) [][]byte {
+	t.Helper()
+	var fields [][]byte
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		msg = msg[n:]
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(msg)
+			msg = msg[n:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				t.Fatalf("truncated field %d", key>>3)
+			}
+			if key>>3 == number {
+				fields = append(fields, msg[n:n+int(size)])
+			}
+			msg = msg[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// onnxGraph feeds a [2, 3] input through relu into a 2x3 by 3x4 matmul
+// whose header and operands fill the first 80 payload bytes, then sums it
+func onnxGraph() *Graph {
+	payload := make([]byte, 96)
+	binary.LittleEndian.PutUint16(payload[0:], 2)
+	binary.LittleEndian.PutUint16(payload[2:], 3)
+	binary.LittleEndian.PutUint16(payload[4:], 4)
+	return &Graph{
+		Payload: payload,
+		Nodes: []Node{
+			{ID: 0, Kernel: kernels.OpNoop},
+			{ID: 1, Kernel: kernels.OpReLU, Topo: []uint32{0}},
+			{ID: 2, Kernel: kernels.OpMatMul, In: 0, Out: 80, Topo: []uint32{1}},
+			{ID: 3, Kernel: kernels.OpSum, Topo: []uint32{2}},
+		},
+		IO: []IOSpec{
+			{Name: "x", Kind: Input, NodeID: 0, Shape: []int{2, 3}},
+			{Name: "y", Kind: Output, NodeID: 3, Shape: []int{1}},
+		},
+	}
+}
+
+func TestExportONNX(t *testing.T) {
+	t.Parallel()
+	g := onnxGraph()
+	data, err := g.ExportONNX()
+	if err != nil {
+		t.Fatalf("ExportONNX failed: %v", err)
+	}
+	graphs := protoFields(t, data, 7)
+	if len(graphs) != 1 {
+		t.Fatalf("Expected one graph, got %d", len(graphs))
+	}
+	var ops []string
+	for _, n := range protoFields(t, graphs[0], 1) {
+		ops = append(ops, string(protoFields(t, n, 4)[0]))
+	}
+	want := []string{"Identity", "Relu", "Reshape", "MatMul", "Reshape", "ReduceSum", "Reshape"}
+	if !slices.Equal(ops, want) {
+		t.Errorf("Expected operators %v, got %v", want, ops)
+	}
+	for field, name := range map[uint64]string{11: "x", 12: "y"} {
+		infos := protoFields(t, graphs[0], field)
+		if len(infos) != 1 || string(protoFields(t, infos[0], 1)[0]) != name {
+			t.Errorf("Expected graph field %d to declare %q", field, name)
+		}
+	}
+	// The right matmul operand and three reshape targets
+	if n := len(protoFields(t, graphs[0], 5)); n != 4 {
+		t.Errorf("Expected 4 initializers, got %d", n)
+	}
+
+	g = onnxGraph()
+	g.Nodes[1].Kernel = kernels.OpTanh
+	if _, err := g.ExportONNX(); !errors.Is(err, ErrNoONNX) {
+		t.Errorf("Expected ErrNoONNX for tanh, got %v", err)
+	}
+	g = onnxGraph()
+	g.IO[0].DType = Int8
+	if _, err := g.ExportONNX(); err == nil {
+		t.Error("Expected an error for an int8 input")
+	}
+}
@@ -0,0 +1,181 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/sbl8/sublation/core"
+)
+
+// Prune removes the nodes that do not contribute to the given output
+// nodes, following dependencies backwards, and compacts the payload to the
+// ranges the remaining nodes and segments reference. Each kept range moves
+// to an offset with the same 32-byte alignment, so kernels reading aligned
+// data still do. IO specs, shapes, costs and segments of removed nodes
+// are dropped. It returns the number of nodes removed.
+func (g *Graph) Prune(outputs []uint32) (int, error) {
+	if len(outputs) == 0 {
+		return 0, fmt.Errorf("prune: no outputs given")
+	}
+	index := make(map[uint32]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		index[n.ID] = i
+	}
+
+	keep := make(map[uint32]bool, len(g.Nodes))
+	stack := make([]uint32, 0, len(outputs))
+	for _, id := range outputs {
+		if _, ok := index[id]; !ok {
+			return 0, fmt.Errorf("prune: output node %d does not exist", id)
+		}
+		stack = append(stack, id)
+	}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if keep[id] {
+			continue
+		}
+		keep[id] = true
+		for _, dep := range g.Nodes[index[id]].Topo {
+			if _, ok := index[dep]; ok && dep != NoNeighbor && !keep[dep] {
+				stack = append(stack, dep)
+			}
+		}
+	}
+
+	nodes := make([]Node, 0, len(keep))
+	used := make(map[uint32]bool)
+	for _, n := range g.Nodes {
+		if keep[n.ID] {
+			nodes = append(nodes, n)
+			used[n.Segment] = true
+		}
+	}
+	removed := len(g.Nodes) - len(nodes)
+
+	var segs []Segment
+	for _, s := range g.Segments {
+		if used[s.ID] {
+			segs = append(segs, s)
+		}
+	}
+	ranges := make([][2]uint32, 0, len(nodes)+len(segs))
+	for _, n := range nodes {
+		if n.Out > n.In {
+			ranges = append(ranges, [2]uint32{n.In, n.Out})
+		}
+	}
+	for _, s := range segs {
+		if s.Length > 0 {
+			ranges = append(ranges, [2]uint32{s.Offset, s.End()})
+		}
+	}
+	payload, move := compactRanges(g.Payload, ranges, 32)
+
+	for i := range nodes {
+		nodes[i].In, nodes[i].Out = move(nodes[i].In), move(nodes[i].Out)
+	}
+	for i := range segs {
+		segs[i].Offset = move(segs[i].Offset)
+	}
+
+	var specs []IOSpec
+	for _, s := range g.IO {
+		if keep[s.NodeID] {
+			specs = append(specs, s)
+		}
+	}
+	for id := range g.Shapes {
+		if !keep[id] {
+			delete(g.Shapes, id)
+		}
+	}
+	for id := range g.Costs {
+		if !keep[id] {
+			delete(g.Costs, id)
+		}
+	}
+	g.Nodes, g.Payload, g.IO, g.Segments = nodes, payload, specs, segs
+	return removed, nil
+}
+
+// DeadCodeStats reports what EliminateDeadCode removed
+type DeadCodeStats struct {
+	Nodes    int // Nodes no output depends on
+	Segments int // Segments no remaining node references
+	Bytes    int // Payload bytes dropped
+}
+
+// EliminateDeadCode removes the nodes no declared output depends on and the
+// segments no remaining node references, compacting the payload as Prune
+// does. Nodes bound to input specs are kept, so the model's interface does
+// not change. A graph declaring no outputs is left as it is: any node may
+// be the one its user reads.
+func (g *Graph) EliminateDeadCode() (DeadCodeStats, error) {
+	if len(g.Outputs()) == 0 {
+		return DeadCodeStats{}, nil
+	}
+	roots := make([]uint32, len(g.IO))
+	for i, s := range g.IO {
+		roots[i] = s.NodeID
+	}
+	segs, size := len(g.Segments), len(g.Payload)
+	removed, err := g.Prune(roots)
+	if err != nil {
+		return DeadCodeStats{}, err
+	}
+	return DeadCodeStats{Nodes: removed, Segments: segs - len(g.Segments), Bytes: max(size-len(g.Payload), 0)}, nil
+}
+
+// compactRanges copies the payload bytes covered by ranges into a new
+// payload, merging overlapping ranges, and returns it with a function
+// mapping old offsets inside a range, or at its end, to new ones. Each
+// merged range starts at its old offset modulo 32 past an align-byte
+// boundary, align being a multiple of 32. Offsets outside every range map
+// to 0.
+func compactRanges(payload []byte, ranges [][2]uint32, align int) ([]byte, func(uint32) uint32) {
+	slices.SortFunc(ranges, func(a, b [2]uint32) int { return cmp.Compare(a[0], b[0]) })
+	var merged [][2]uint32
+	for _, r := range ranges {
+		r[1] = min(r[1], uint32(len(payload)))
+		if r[0] >= r[1] {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && r[0] <= merged[last][1] {
+			merged[last][1] = max(merged[last][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	starts := make([]uint32, len(merged))
+	var out []byte
+	for i, r := range merged {
+		// Keep each block's offset modulo 32
+		start := alignTo(len(out), align) + int(r[0]%32)
+		out = append(out, make([]byte, start-len(out))...)
+		out = append(out, payload[r[0]:r[1]]...)
+		starts[i] = uint32(start)
+	}
+	// Validate wants every offset inside the payload, so pad past the last
+	// range end even when it is aligned
+	out = append(out, make([]byte, core.Align32(len(out)+1)-len(out))...)
+
+	move := func(off uint32) uint32 {
+		i, _ := slices.BinarySearchFunc(merged, off, func(r [2]uint32, off uint32) int {
+			return cmp.Compare(r[1], off) // First block ending at or after off
+		})
+		if i < len(merged) && merged[i][0] <= off {
+			return starts[i] + off - merged[i][0]
+		}
+		return 0
+	}
+	return out, move
+}
+
+// alignTo rounds n up to a multiple of align, a power of two
+func alignTo(n, align int) int {
+	return (n + align - 1) &^ (align - 1)
+}
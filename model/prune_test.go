@@ -0,0 +1,80 @@
+package model
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// pruneGraph has a trunk feeding two heads, the second one two nodes deep
+func pruneGraph() *Graph {
+	payload := make([]byte, 128)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	return &Graph{
+		Payload: payload,
+		Nodes: []Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 32},
+			{ID: 1, Kernel: 3, In: 32, Out: 64, Topo: []uint32{0}},
+			{ID: 2, Kernel: 3, In: 64, Out: 100, Topo: []uint32{0}, Segment: 1},
+			{ID: 3, Kernel: 4, In: 100, Out: 108, Topo: []uint32{2}},
+		},
+		IO: []IOSpec{
+			{Name: "a", Kind: Output, NodeID: 1, Shape: []int{8}},
+			{Name: "b", Kind: Output, NodeID: 3, Shape: []int{2}},
+		},
+		Shapes:   map[uint32][]int{0: {8}, 1: {8}, 2: {9}, 3: {2}},
+		Segments: []Segment{{ID: 1, Offset: 64, Length: 36}},
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+	orig := pruneGraph()
+
+	g := pruneGraph()
+	removed, err := g.Prune([]uint32{3})
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected one node pruned, got %d (%v)", removed, err)
+	}
+	if ids := nodeIDs(g); !slices.Equal(ids, []uint32{0, 2, 3}) {
+		t.Errorf("Expected nodes [0 2 3], got %v", ids)
+	}
+	if len(g.IO) != 1 || g.IO[0].Name != "b" || len(g.Shapes) != 3 || len(g.Segments) != 1 {
+		t.Errorf("Expected IO, shapes and segments of kept nodes only, got %v %v %v", g.IO, g.Shapes, g.Segments)
+	}
+	if len(g.Payload) != 96 {
+		t.Errorf("Expected a 96 byte payload, got %d", len(g.Payload))
+	}
+	for i, n := range g.Nodes {
+		if n.In%32 != orig.Nodes[n.ID].In%32 {
+			t.Errorf("node %d: offset %d lost its alignment", n.ID, n.In)
+		}
+		if !bytes.Equal(g.Payload[n.In:n.Out], orig.Payload[orig.Nodes[n.ID].In:orig.Nodes[n.ID].Out]) {
+			t.Errorf("node %d (index %d): payload bytes moved incorrectly", n.ID, i)
+		}
+	}
+	if s := g.Segments[0]; s.Offset != g.Nodes[1].In || s.End() != g.Nodes[1].Out {
+		t.Errorf("Expected segment 1 to follow node 2, got %+v", s)
+	}
+	if err := g.Validate(); err != nil {
+		t.Errorf("Expected the pruned graph to validate, got %v", err)
+	}
+
+	g = pruneGraph()
+	if removed, err := g.Prune([]uint32{1, 3}); err != nil || removed != 0 {
+		t.Errorf("Expected nothing pruned, got %d (%v)", removed, err)
+	}
+	if _, err := pruneGraph().Prune([]uint32{9}); err == nil {
+		t.Error("Expected an error for an unknown output")
+	}
+}
+
+func nodeIDs(g *Graph) []uint32 {
+	ids := make([]uint32, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+)
+
+// Range is the interval of the values observed in a node's payload, for
+// example by running a model over calibration inputs
+type Range struct {
+	Min, Max float32
+}
+
+// Include widens r to contain v
+func (r Range) Include(v float32) Range {
+	return Range{Min: min(r.Min, v), Max: max(r.Max, v)}
+}
+
+// Union returns the smallest range containing r and o
+func (r Range) Union(o Range) Range {
+	return Range{Min: min(r.Min, o.Min), Max: max(r.Max, o.Max)}
+}
+
+// Scale returns the symmetric int8 scale covering the range, 0 for [0, 0]
+func (r Range) Scale() float32 {
+	return max(-r.Min, r.Max) / 127
+}
+
+// QuantizeInt8 rewrites the matmul and matmul_bias_act nodes to matmul_q8:
+// the B operand is stored as int8 codes with one scale for the tensor, and
+// the A operand, the activations, is quantized when the kernel runs with
+// the scale of ranges, keyed by node ID, of the nodes it consumes. A node
+// consuming nothing multiplies its constant payload operand, whose own
+// range gives the scale. A node consuming nodes without a range, or nodes
+// whose payload holds more than float32 values, such as another matmul,
+// scales A by its largest magnitude on every call. The first node, nodes
+// bound to IO specs, tied nodes and nodes whose payload does not hold
+// their operands are left in float32, as is everything when matmul_q8 is
+// not in kernels.Catalog. The payload is compacted and shapes are inferred
+// again.
+// It returns the number of nodes quantized.
+func (g *Graph) QuantizeInt8(ranges map[uint32]Range) (int, error) {
+	if len(g.Nodes) == 0 || kernels.Catalog[kernels.OpMatMulQ8] == nil {
+		return 0, nil
+	}
+	pinned := map[uint32]bool{g.Nodes[0].ID: true}
+	for _, s := range g.IO {
+		pinned[s.NodeID] = true
+	}
+
+	index := g.nodeIndex()
+	var quantized []uint32
+	payloads := make(map[uint32][]byte)
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		if pinned[n.ID] || n.Flags&core.FlagShared != 0 {
+			continue
+		}
+		payload, ok := g.quantizeMatMul(*n, ranges, index)
+		if !ok {
+			continue
+		}
+		n.Kernel = kernels.OpMatMulQ8
+		payloads[n.ID] = payload
+		quantized = append(quantized, n.ID)
+	}
+	if len(quantized) == 0 {
+		return 0, nil
+	}
+
+	g.replaceNodes(g.Nodes, nil, quantized, payloads)
+	for _, n := range g.Nodes {
+		if payloads[n.ID] == nil || n.Segment == 0 {
+			continue
+		}
+		for i := range g.Segments {
+			if g.Segments[i].ID == n.Segment {
+				g.Segments[i].DType = Int8
+			}
+		}
+	}
+	return len(quantized), g.InferShapes()
+}
+
+// quantizeMatMul lays out the matmul_q8 payload of a matmul or
+// matmul_bias_act node
+func (g *Graph) quantizeMatMul(n Node, ranges map[uint32]Range, index map[uint32]int) ([]byte, bool) {
+	p := g.nodePayload(n)
+	header := 6
+	switch {
+	case n.Kernel == kernels.OpMatMulBiasAct:
+		header = 8
+	case n.Kernel != kernels.OpMatMul:
+		return nil, false
+	}
+	if len(p) < header {
+		return nil, false
+	}
+	rows := int(binary.LittleEndian.Uint16(p[0:]))
+	cols := int(binary.LittleEndian.Uint16(p[2:]))
+	bCols := int(binary.LittleEndian.Uint16(p[4:]))
+	aSize, bSize, outSize := 4*rows*cols, 4*cols*bCols, 4*rows*bCols
+	if rows*cols*bCols == 0 || len(p) < header+aSize+bSize || header == 8 && len(p) < header+aSize+bSize+outSize {
+		return nil, false
+	}
+	a := p[header : header+aSize]
+	b := p[header+aSize : header+aSize+bSize]
+
+	var aRange Range
+	deps := liveDeps(n)
+	switch {
+	case len(deps) == 0:
+		aRange = floatRange(a)
+	default:
+		for _, dep := range deps {
+			r, ok := ranges[dep]
+			if i, known := index[dep]; !ok || !known || !plainData(g.Nodes[i].Kernel) {
+				aRange = Range{}
+				break
+			}
+			aRange = aRange.Union(r)
+		}
+	}
+	bScale := floatRange(b).Scale()
+
+	out := make([]byte, kernels.MatMulQ8Header, kernels.MatMulQ8Header+aSize+outSize+bSize/4)
+	copy(out, p[:header])
+	binary.LittleEndian.PutUint32(out[8:], math.Float32bits(aRange.Scale()))
+	binary.LittleEndian.PutUint32(out[12:], math.Float32bits(bScale))
+	out = append(out, a...)
+	if header == 8 {
+		out = append(out, p[header+aSize+bSize:header+aSize+bSize+outSize]...)
+	} else {
+		out = append(out, make([]byte, outSize)...)
+	}
+	for i := 0; i < len(b); i += 4 {
+		v := math.Float32frombits(binary.LittleEndian.Uint32(b[i:]))
+		out = append(out, byte(kernels.QuantizeInt8(v, bScale)))
+	}
+	return out, true
+}
+
+// plainData reports whether the payload of a node running kernel holds
+// only float32 values, so its range bounds the node's output
+func plainData(kernel byte) bool {
+	switch kernel {
+	case kernels.OpNoop, kernels.OpSqrPlusX, kernels.OpReLU, kernels.OpSigmoid, kernels.OpTanh,
+		kernels.OpAdd, kernels.OpMul, kernels.OpSoftmax:
+		return true
+	}
+	return false
+}
+
+// floatRange returns the range of the finite float32 values in data
+func floatRange(data []byte) Range {
+	var r Range
+	for i := 0; i+4 <= len(data); i += 4 {
+		v := math.Float32frombits(binary.LittleEndian.Uint32(data[i:]))
+		if !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0) {
+			r = r.Include(v)
+		}
+	}
+	return r
+}
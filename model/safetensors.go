@@ -0,0 +1,123 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// safetensorsDTypes maps safetensors dtype names to the dtypes stored as is
+var safetensorsDTypes = map[string]DType{
+	"F32": Float32,
+	"F16": Float16,
+	"I32": Int32,
+	"I8":  Int8,
+	"U8":  Uint8,
+}
+
+// safetensor is a tensor entry of a safetensors header
+type safetensor struct {
+	DType       string    `json:"dtype"`
+	Shape       []int     `json:"shape"`
+	DataOffsets [2]uint64 `json:"data_offsets"` // Relative to the end of the header
+}
+
+// LoadSafetensors copies the tensors of a .safetensors file of the given size
+// into the payload segments named after them and returns the number of
+// segments loaded. A tensor must have exactly as many elements as its
+// segment and the segment's dtype, except that F16 and BF16 tensors widen
+// into float32 segments. Every named weight or bias segment must be found in
+// the file; tensors without a segment are ignored.
+func (g *Graph) LoadSafetensors(r io.ReaderAt, size int64) (int, error) {
+	var b [8]byte
+	if err := readAt(r, b[:], 0); err != nil {
+		return 0, fmt.Errorf("safetensors: truncated header size: %w", err)
+	}
+	headerLen := binary.LittleEndian.Uint64(b[:])
+	if headerLen > uint64(size-8) || headerLen > 100<<20 {
+		return 0, fmt.Errorf("safetensors: header size %d exceeds the file", headerLen)
+	}
+	header := make([]byte, headerLen)
+	if err := readAt(r, header, 8); err != nil {
+		return 0, fmt.Errorf("safetensors: truncated header: %w", err)
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(header, &entries); err != nil {
+		return 0, fmt.Errorf("safetensors: header: %w", err)
+	}
+	dataStart := 8 + headerLen
+
+	loaded := 0
+	for _, s := range g.Segments {
+		if s.Name == "" {
+			continue
+		}
+		raw, ok := entries[s.Name]
+		if !ok || s.Name == "__metadata__" {
+			if s.Role != RoleActivation {
+				return loaded, fmt.Errorf("safetensors: no tensor for %v segment %d %q", s.Role, s.ID, s.Name)
+			}
+			continue
+		}
+		var t safetensor
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return loaded, fmt.Errorf("safetensors: tensor %q: %w", s.Name, err)
+		}
+		if err := g.loadSafetensor(r, size, dataStart, s, t); err != nil {
+			return loaded, fmt.Errorf("safetensors: tensor %q: %w", s.Name, err)
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// loadSafetensor reads tensor t into segment s
+func (g *Graph) loadSafetensor(r io.ReaderAt, size int64, dataStart uint64, s Segment, t safetensor) error {
+	elems := 1
+	for _, d := range t.Shape {
+		if d < 0 || (d > 0 && elems > math.MaxInt32/d) {
+			return fmt.Errorf("invalid shape %v", t.Shape)
+		}
+		elems *= d
+	}
+	if elems != s.Elements() {
+		return fmt.Errorf("%d elements %v do not fit segment %d of %d %v elements", elems, t.Shape, s.ID, s.Elements(), s.DType)
+	}
+
+	elemSize := 0
+	switch dt, ok := safetensorsDTypes[t.DType]; {
+	case ok && dt == s.DType:
+		elemSize = dt.Size()
+	case (t.DType == "F16" || t.DType == "BF16") && s.DType == Float32:
+		elemSize = 2
+	default:
+		return fmt.Errorf("cannot load %s into a %v segment", t.DType, s.DType)
+	}
+	begin, end := t.DataOffsets[0], t.DataOffsets[1]
+	if end < begin || end-begin != uint64(elems*elemSize) || dataStart+end > uint64(size) {
+		return fmt.Errorf("data offsets [%d, %d) do not hold %d %s elements within the file", begin, end, elems, t.DType)
+	}
+
+	if uint64(s.Offset)+uint64(s.Length) > uint64(len(g.Payload)) {
+		return fmt.Errorf("segment %d exceeds the payload", s.ID)
+	}
+	dst := g.Payload[s.Offset:s.End()]
+	if elemSize == s.DType.Size() {
+		return readAt(r, dst, int64(dataStart+begin))
+	}
+	src := make([]byte, end-begin)
+	if err := readAt(r, src, int64(dataStart+begin)); err != nil {
+		return err
+	}
+	for i := 0; i < elems; i++ {
+		h := binary.LittleEndian.Uint16(src[2*i:])
+		v := math.Float32frombits(uint32(h) << 16)
+		if t.DType == "F16" {
+			v = HalfToFloat(h)
+		}
+		binary.LittleEndian.PutUint32(dst[4*i:], math.Float32bits(v))
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package model
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SegmentRole tells what a payload segment holds
+type SegmentRole uint8
+
+const (
+	RoleActivation SegmentRole = iota // Data a node computes on
+	RoleWeight                        // Trained parameters
+	RoleBias                          // Trained offsets added to a result
+)
+
+var segmentRoleNames = [...]string{
+	RoleActivation: "activation",
+	RoleWeight:     "weight",
+	RoleBias:       "bias",
+}
+
+// String returns the role name
+func (r SegmentRole) String() string {
+	if int(r) < len(segmentRoleNames) {
+		return segmentRoleNames[r]
+	}
+	return fmt.Sprintf("SegmentRole(%d)", r)
+}
+
+// ParseSegmentRole parses a role name as printed by String; "" selects
+// RoleActivation
+func ParseSegmentRole(name string) (SegmentRole, error) {
+	if name == "" {
+		return RoleActivation, nil
+	}
+	for r, n := range segmentRoleNames {
+		if strings.EqualFold(name, n) {
+			return SegmentRole(r), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown segment role %q (want activation, weight or bias)", name)
+}
+
+// Segment is an entry of the segment table: a typed range of the payload
+// that nodes reference by ID instead of raw offsets
+type Segment struct {
+	ID     uint32 // Nonzero; a node with Segment 0 uses its raw In and Out
+	Offset uint32
+	Length uint32
+	DType  DType
+	Role   SegmentRole
+	Name   string // Optional
+}
+
+// End returns the offset just past the segment
+func (s Segment) End() uint32 {
+	return s.Offset + s.Length
+}
+
+// Elements returns the number of DType elements in the segment
+func (s Segment) Elements() int {
+	if s.DType.Size() == 0 {
+		return 0
+	}
+	return int(s.Length) / s.DType.Size()
+}
+
+const sectionSegments = 0x4D474553 // "SEGM"
+
+// Segment returns the segment table entry with the given ID
+func (g *Graph) Segment(id uint32) (Segment, bool) {
+	for _, s := range g.Segments {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Segment{}, false
+}
+
+// ResolveSegments checks the segment table and sets In and Out of every
+// node that references a segment to the segment's range, so the runtime
+// and offset-based tools see the same bytes
+func (g *Graph) ResolveSegments() error {
+	segs, err := g.segmentIndex()
+	if err != nil {
+		return err
+	}
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		if n.Segment == 0 {
+			continue
+		}
+		s, ok := segs[n.Segment]
+		if !ok {
+			return fmt.Errorf("node %d references undefined segment %d", n.ID, n.Segment)
+		}
+		n.In, n.Out = s.Offset, s.End()
+	}
+	return nil
+}
+
+// validateSegments checks the segment table and that nodes referencing a
+// segment cover exactly its range
+func (g *Graph) validateSegments() error {
+	segs, err := g.segmentIndex()
+	if err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		if n.Segment == 0 {
+			continue
+		}
+		s, ok := segs[n.Segment]
+		if !ok {
+			return fmt.Errorf("node %d references undefined segment %d", n.ID, n.Segment)
+		}
+		if n.In != s.Offset || n.Out != s.End() {
+			return fmt.Errorf("node %d range [%d, %d) differs from segment %d [%d, %d)", n.ID, n.In, n.Out, s.ID, s.Offset, s.End())
+		}
+	}
+	return nil
+}
+
+// segmentIndex maps segment IDs to entries after checking that IDs are
+// nonzero and unique, types known, and ranges inside the payload and
+// disjoint
+func (g *Graph) segmentIndex() (map[uint32]Segment, error) {
+	index := make(map[uint32]Segment, len(g.Segments))
+	for _, s := range g.Segments {
+		if s.ID == 0 {
+			return nil, fmt.Errorf("segment ID 0 is reserved")
+		}
+		if _, dup := index[s.ID]; dup {
+			return nil, fmt.Errorf("duplicate segment ID %d", s.ID)
+		}
+		if s.DType.Size() == 0 {
+			return nil, fmt.Errorf("segment %d has unknown dtype %d", s.ID, s.DType)
+		}
+		if int(s.Role) >= len(segmentRoleNames) {
+			return nil, fmt.Errorf("segment %d has unknown role %d", s.ID, s.Role)
+		}
+		if uint64(s.Offset)+uint64(s.Length) > uint64(len(g.Payload)) {
+			return nil, fmt.Errorf("segment %d [%d, %d) exceeds payload size %d", s.ID, s.Offset, uint64(s.Offset)+uint64(s.Length), len(g.Payload))
+		}
+		if s.Length%uint32(s.DType.Size()) != 0 {
+			return nil, fmt.Errorf("segment %d length %d is not a multiple of the %v size", s.ID, s.Length, s.DType)
+		}
+		index[s.ID] = s
+	}
+
+	byOffset := slices.Clone(g.Segments)
+	slices.SortFunc(byOffset, func(a, b Segment) int { return cmp.Compare(a.Offset, b.Offset) })
+	for i := 1; i < len(byOffset); i++ {
+		if a, b := byOffset[i-1], byOffset[i]; a.End() > b.Offset && b.Length > 0 {
+			return nil, fmt.Errorf("segments %d and %d overlap", a.ID, b.ID)
+		}
+	}
+	return index, nil
+}
+
+// writeSegments writes the SEGM section body: a uint32 entry count, then per
+// segment its ID, offset and length (uint32), dtype and role (uint8), name
+// length (uint16) and name; then a uint32 binding count and per node
+// referencing a segment its ID and the segment ID (uint32)
+func writeSegments(buf *bytes.Buffer, segs []Segment, nodes []Node) error {
+	var b [16]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(segs)))
+	buf.Write(b[:4])
+	for _, s := range segs {
+		if len(s.Name) > 0xFFFF {
+			return fmt.Errorf("segment %d name exceeds %d bytes", s.ID, 0xFFFF)
+		}
+		binary.LittleEndian.PutUint32(b[0:], s.ID)
+		binary.LittleEndian.PutUint32(b[4:], s.Offset)
+		binary.LittleEndian.PutUint32(b[8:], s.Length)
+		b[12], b[13] = byte(s.DType), byte(s.Role)
+		binary.LittleEndian.PutUint16(b[14:], uint16(len(s.Name)))
+		buf.Write(b[:])
+		buf.WriteString(s.Name)
+	}
+
+	var bound []Node
+	for _, n := range nodes {
+		if n.Segment != 0 {
+			bound = append(bound, n)
+		}
+	}
+	binary.LittleEndian.PutUint32(b[:], uint32(len(bound)))
+	buf.Write(b[:4])
+	for _, n := range bound {
+		binary.LittleEndian.PutUint32(b[0:], n.ID)
+		binary.LittleEndian.PutUint32(b[4:], n.Segment)
+		buf.Write(b[:8])
+	}
+	return nil
+}
+
+// readSegments reads a section written by writeSegments, returning the
+// table and the segment ID of every bound node
+func readSegments(body []byte) ([]Segment, map[uint32]uint32, error) {
+	if len(body) < 4 {
+		return nil, nil, fmt.Errorf("truncated segment count")
+	}
+	count := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	if uint64(count)*16 > uint64(len(body)) {
+		return nil, nil, fmt.Errorf("%d segments exceed the section", count)
+	}
+	segs := make([]Segment, count)
+	for i := range segs {
+		if len(body) < 16 {
+			return nil, nil, fmt.Errorf("segment %d: truncated entry", i)
+		}
+		nameLen := int(binary.LittleEndian.Uint16(body[14:]))
+		if len(body) < 16+nameLen {
+			return nil, nil, fmt.Errorf("segment %d: truncated name", i)
+		}
+		segs[i] = Segment{
+			ID:     binary.LittleEndian.Uint32(body[0:]),
+			Offset: binary.LittleEndian.Uint32(body[4:]),
+			Length: binary.LittleEndian.Uint32(body[8:]),
+			DType:  DType(body[12]),
+			Role:   SegmentRole(body[13]),
+			Name:   string(body[16 : 16+nameLen]),
+		}
+		body = body[16+nameLen:]
+	}
+
+	if len(body) < 4 {
+		return nil, nil, fmt.Errorf("truncated binding count")
+	}
+	count = binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	if uint64(count)*8 > uint64(len(body)) {
+		return nil, nil, fmt.Errorf("%d bindings exceed the section", count)
+	}
+	bindings := make(map[uint32]uint32, count)
+	for i := uint32(0); i < count; i++ {
+		bindings[binary.LittleEndian.Uint32(body[8*i:])] = binary.LittleEndian.Uint32(body[8*i+4:])
+	}
+	return segs, bindings, nil
+}
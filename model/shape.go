@@ -0,0 +1,177 @@
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+const sectionShapes = 0x50414853 // "SHAP"
+
+// InferShapes computes the output shape, in float32 elements, of every node
+// whose kernel, inputs and payload determine one and stores them in
+// g.Shapes. A node consumes the outputs of its dependencies or, for a
+// source node, the shape of the input bound to it. A source node reading a
+// flat vector from its payload keeps a shape with as many elements already
+// in g.Shapes, such as one declared in the DSL. Nodes with undetermined
+// shapes are left out; incompatible shapes and outputs whose declared size
+// differs from the inferred one are errors. Cyclic graphs are rejected.
+func (g *Graph) InferShapes() error {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return err
+	}
+	shapes := make(map[uint32][]int, len(g.Nodes))
+	for _, i := range order {
+		n := g.Nodes[i]
+		info, ok := kernels.Info(n.Kernel)
+		if !ok || info.Shape == nil {
+			continue
+		}
+		inputs, known := g.inputShapes(n, shapes)
+		if !known {
+			continue
+		}
+		var payload []byte
+		if n.Out > n.In && int(n.Out) <= len(g.Payload) {
+			payload = g.Payload[n.In:n.Out]
+		}
+		shape, err := info.Shape(inputs, payload)
+		if err != nil {
+			return fmt.Errorf("node %d (%s): %w", n.ID, info.Name, err)
+		}
+		if prior, ok := g.Shapes[n.ID]; ok && len(inputs) == 0 && shape != nil && kernels.Elements(prior) == kernels.Elements(shape) {
+			shape = prior
+		}
+		if shape != nil {
+			shapes[n.ID] = shape
+		}
+	}
+
+	for _, s := range g.Outputs() {
+		if shape, ok := shapes[s.NodeID]; ok && kernels.Elements(shape)*4 != s.Bytes() {
+			return fmt.Errorf("output %q is %d bytes but node %d produces shape %v", s.Name, s.Bytes(), s.NodeID, shape)
+		}
+	}
+	g.Shapes = shapes
+	return nil
+}
+
+// CheckPayloads verifies that the payload of every node holds the header
+// and operands its kernel reads, as described by kernels.KernelInfo.Layout,
+// and returns one error per offending node naming its payload range
+func (g *Graph) CheckPayloads() error {
+	var errs []error
+	for _, n := range g.Nodes {
+		info, ok := kernels.Info(n.Kernel)
+		if !ok || info.Layout == nil {
+			continue
+		}
+		if err := info.Layout(g.nodePayload(n)); err != nil {
+			errs = append(errs, fmt.Errorf("node %d (%s), payload [%d, %d): %w", n.ID, info.Name, n.In, n.Out, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// InputShapes returns the shapes node id consumes: the inferred outputs of
+// its dependencies in Topo order, or the shape of the input bound to a
+// source node. ok is false when any of them is unknown.
+func (g *Graph) InputShapes(id uint32) (shapes [][]int, ok bool) {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return g.inputShapes(n, g.Shapes)
+		}
+	}
+	return nil, false
+}
+
+// inputShapes returns the input shapes of n given the known output shapes
+func (g *Graph) inputShapes(n Node, outputs map[uint32][]int) ([][]int, bool) {
+	var inputs [][]int
+	for _, dep := range n.Topo {
+		if dep == NoNeighbor {
+			continue
+		}
+		shape, ok := outputs[dep]
+		if !ok {
+			return nil, false
+		}
+		inputs = append(inputs, shape)
+	}
+	if len(inputs) == 0 {
+		for _, s := range g.Inputs() {
+			if s.NodeID == n.ID {
+				inputs = append(inputs, s.Shape)
+			}
+		}
+	}
+	return inputs, true
+}
+
+// writeShapes writes the SHAP section body: a uint32 count, then per node in
+// ID order its ID (uint32), rank (uint32) and dimensions (uint32 each)
+func writeShapes(buf *bytes.Buffer, shapes map[uint32][]int) error {
+	ids := make([]uint32, 0, len(shapes))
+	for id := range shapes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(len(ids)))
+	buf.Write(b[:])
+	for _, id := range ids {
+		shape := shapes[id]
+		binary.LittleEndian.PutUint32(b[:], id)
+		buf.Write(b[:])
+		binary.LittleEndian.PutUint32(b[:], uint32(len(shape)))
+		buf.Write(b[:])
+		for _, d := range shape {
+			if d < 0 || uint64(d) > math.MaxUint32 {
+				return fmt.Errorf("node %d: dimension %d out of range", id, d)
+			}
+			binary.LittleEndian.PutUint32(b[:], uint32(d))
+			buf.Write(b[:])
+		}
+	}
+	return nil
+}
+
+// readShapes reads a section written by writeShapes
+func readShapes(body []byte) (map[uint32][]int, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("truncated entry count")
+	}
+	count := binary.LittleEndian.Uint32(body)
+	body = body[4:]
+	if uint64(count)*8 > uint64(len(body)) {
+		return nil, fmt.Errorf("%d shapes exceed the section", count)
+	}
+	shapes := make(map[uint32][]int, count)
+	for i := uint32(0); i < count; i++ {
+		if len(body) < 8 {
+			return nil, fmt.Errorf("entry %d: truncated header", i)
+		}
+		id, rank := binary.LittleEndian.Uint32(body), uint64(binary.LittleEndian.Uint32(body[4:]))
+		body = body[8:]
+		if rank*4 > uint64(len(body)) {
+			return nil, fmt.Errorf("entry %d: truncated dimensions", i)
+		}
+		if _, dup := shapes[id]; dup {
+			return nil, fmt.Errorf("duplicate node %d", id)
+		}
+		shape := make([]int, rank)
+		for j := range shape {
+			shape[j] = int(binary.LittleEndian.Uint32(body[4*j:]))
+		}
+		shapes[id] = shape
+		body = body[4*rank:]
+	}
+	return shapes, nil
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/sbl8/sublation/core"
+)
+
+// SharedSegment is a payload range [In, Out) tied to several nodes, such
+// as a shared embedding and the output projection reusing its weights
+type SharedSegment struct {
+	In, Out uint32
+	Nodes   []uint32 // IDs of the nodes referencing the segment, in graph order
+}
+
+// Refs returns the number of nodes referencing the segment
+func (s SharedSegment) Refs() int {
+	return len(s.Nodes)
+}
+
+// SharedSegments returns the payload segments of nodes flagged
+// core.FlagShared, ordered by offset. Nodes with the flag and the same
+// [In, Out) range share one segment: its bytes are stored once and the
+// runtime backs all of them with a single pair of node buffers.
+func (g *Graph) SharedSegments() []SharedSegment {
+	index := make(map[[2]uint32]int)
+	var segs []SharedSegment
+	for _, n := range g.Nodes {
+		if n.Flags&core.FlagShared == 0 {
+			continue
+		}
+		key := [2]uint32{n.In, n.Out}
+		i, ok := index[key]
+		if !ok {
+			i = len(segs)
+			index[key] = i
+			segs = append(segs, SharedSegment{In: n.In, Out: n.Out})
+		}
+		segs[i].Nodes = append(segs[i].Nodes, n.ID)
+	}
+	slices.SortFunc(segs, func(a, b SharedSegment) int {
+		return cmp.Or(cmp.Compare(a.In, b.In), cmp.Compare(a.Out, b.Out))
+	})
+	return segs
+}
+
+// validateShared checks that every shared node references a non-empty
+// segment that no other shared segment partially overlaps
+func (g *Graph) validateShared() error {
+	segs := g.SharedSegments()
+	for i, s := range segs {
+		if s.Out <= s.In {
+			return fmt.Errorf("node %d is shared but has an empty payload range [%d, %d)", s.Nodes[0], s.In, s.Out)
+		}
+		if i > 0 && segs[i-1].Out > s.In {
+			return fmt.Errorf("shared segments [%d, %d) and [%d, %d) overlap", segs[i-1].In, segs[i-1].Out, s.In, s.Out)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// The SIGN section closes every version 2 file. Its body is the SHA-256
+// digest of all bytes before the section header, followed by an Ed25519
+// signature of that digest when the file was signed:
+//
+//	sha256 [32] | signature [64], optional
+//
+// Section CRCs catch accidental corruption; the digest ties the sections
+// together and the signature lets deployments reject tampered models.
+const sectionSignature = 0x4E474953 // "SIGN"
+
+// Signature verification errors
+var (
+	ErrUnsigned  = errors.New("model is not signed")
+	ErrSignature = errors.New("model signature verification failed")
+)
+
+// SerializeSigned writes the Graph like Serialize and signs the file digest
+// with key
+func (g *Graph) SerializeSigned(key ed25519.PrivateKey) ([]byte, error) {
+	if key == nil {
+		return nil, fmt.Errorf("missing signing key")
+	}
+	return g.SerializeWithOptions(SerializeOptions{SigningKey: key})
+}
+
+// writeSignature appends the SIGN section for the bytes already in buf
+func writeSignature(buf *bytes.Buffer, key ed25519.PrivateKey) {
+	digest := sha256.Sum256(buf.Bytes())
+	body := digest[:]
+	if key != nil {
+		body = append(body, ed25519.Sign(key, digest[:])...)
+	}
+	section{tag: sectionSignature, body: body}.writeTo(buf)
+}
+
+// checkDigest verifies the digest in the SIGN section s of data and returns
+// it with the signature, nil when the file is unsigned
+func checkDigest(data []byte, s section) (digest [sha256.Size]byte, sig []byte, err error) {
+	if len(s.body) != sha256.Size && len(s.body) != sha256.Size+ed25519.SignatureSize {
+		return digest, nil, fmt.Errorf("SIGN section has %d bytes", len(s.body))
+	}
+	digest = sha256.Sum256(data[:s.offset])
+	if !bytes.Equal(digest[:], s.body[:sha256.Size]) {
+		return digest, nil, fmt.Errorf("file digest: %w", ErrChecksum)
+	}
+	if len(s.body) > sha256.Size {
+		sig = s.body[sha256.Size:]
+	}
+	return digest, sig, nil
+}
+
+// Verify checks that data is a version 2 file signed by key. It returns
+// ErrUnsigned for files without a signature and ErrSignature when the
+// signature does not match.
+func Verify(data []byte, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid Ed25519 public key: %d bytes", len(key))
+	}
+	if len(data) < headerSize || binary.LittleEndian.Uint32(data) != Magic || binary.LittleEndian.Uint16(data[4:]) != Version2 {
+		return ErrUnsigned
+	}
+	sections, err := readSections(data)
+	if err != nil {
+		return err
+	}
+	if len(sections) == 0 || sections[len(sections)-1].tag != sectionSignature {
+		return ErrUnsigned
+	}
+	digest, sig, err := checkDigest(data, sections[len(sections)-1])
+	if err != nil {
+		return err
+	}
+	if sig == nil {
+		return ErrUnsigned
+	}
+	if !ed25519.Verify(key, digest[:], sig) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// ParsePrivateKey reads a PEM-encoded PKCS #8 Ed25519 private key, as
+// written by "openssl genpkey -algorithm ed25519"
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no PEM PRIVATE KEY block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is %T, not Ed25519", key)
+	}
+	return priv, nil
+}
+
+// ParsePublicKey reads a PEM-encoded PKIX Ed25519 public key, as written by
+// "openssl pkey -pubout"
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("no PEM PUBLIC KEY block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is %T, not Ed25519", key)
+	}
+	return pub, nil
+}
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// streamChunk is the size of the reads Reader issues while streaming
+const streamChunk = 4 << 20
+
+// ErrCompressed reports random access to a compressed payload
+var ErrCompressed = errors.New("payload is compressed")
+
+// Reader loads a version 2 file through an io.ReaderAt without holding the
+// file in memory. NewReader reads the node table and the other small
+// sections; the payload is then streamed in chunks into a caller-provided
+// buffer, such as an arena region, or read lazily through PayloadAt. Peak
+// memory is the payload plus one chunk instead of the file plus a copy.
+type Reader struct {
+	r     io.ReaderAt
+	graph *Graph
+
+	payload  section // Header of the PAYL section, without body
+	bodyOff  int64   // File offset of the payload body
+	bodyLen  int64   // Stored payload length
+	sumWant  uint32  // CRC-32 recorded for the stored payload
+	signOff  int64   // Offset of the SIGN section header, -1 without one
+	signBody []byte
+
+	digest   [sha256.Size]byte // Set by ReadPayload
+	digested bool
+}
+
+// NewReader reads the header and every section but the payload of the
+// version 2 file of the given size. Section checksums are verified.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	var header [headerSize]byte
+	if err := readAt(r, header[:], 0); err != nil {
+		return nil, fmt.Errorf("truncated header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(header[:]) != Magic {
+		return nil, fmt.Errorf("invalid magic number: %x", binary.LittleEndian.Uint32(header[:]))
+	}
+	if v := binary.LittleEndian.Uint16(header[4:]); v != Version2 {
+		return nil, fmt.Errorf("unsupported streaming version: %d", v)
+	}
+
+	sr := &Reader{r: r, signOff: -1, bodyOff: -1}
+	d := graphDecoder{g: &Graph{Flags: binary.LittleEndian.Uint16(header[6:]), Target: Target(header[12])}}
+	count := binary.LittleEndian.Uint32(header[8:])
+	off := int64(headerSize)
+	for i := uint32(0); i < count; i++ {
+		if sr.signOff >= 0 {
+			return nil, fmt.Errorf("SIGN section must be last")
+		}
+		var h [sectionHeaderSize]byte
+		if size-off < sectionHeaderSize {
+			return nil, fmt.Errorf("section %d: truncated header at offset %d", i, off)
+		}
+		if err := readAt(r, h[:], off); err != nil {
+			return nil, fmt.Errorf("section %d: %w", i, err)
+		}
+		s := section{
+			tag:    binary.LittleEndian.Uint32(h[0:]),
+			flags:  binary.LittleEndian.Uint32(h[4:]),
+			offset: int(off),
+			rawLen: binary.LittleEndian.Uint64(h[24:]),
+		}
+		length := binary.LittleEndian.Uint64(h[8:])
+		sum := binary.LittleEndian.Uint32(h[16:])
+		bodyOff := off + sectionHeaderSize
+		if length > uint64(size-bodyOff) {
+			return nil, fmt.Errorf("section %d: %d bytes exceed the file", i, length)
+		}
+
+		if s.tag == sectionPayload {
+			if _, err := s.codec(length); err != nil {
+				return nil, err
+			}
+			sr.payload, sr.bodyOff, sr.bodyLen = s, bodyOff, int64(length)
+			if s.flags&sectionFlagCRC != 0 {
+				sr.sumWant = sum
+			}
+			d.havePayload = true
+		} else {
+			s.body = make([]byte, length)
+			if err := readAt(r, s.body, bodyOff); err != nil {
+				return nil, fmt.Errorf("section %d: %w", i, err)
+			}
+			if s.flags&sectionFlagCRC != 0 && crc32.ChecksumIEEE(s.body) != sum {
+				return nil, fmt.Errorf("section %d (%s): %w", i, tagName(s.tag), ErrChecksum)
+			}
+			if s.tag == sectionSignature {
+				sr.signOff, sr.signBody = off, s.body
+			} else {
+				body, err := s.decode()
+				if err != nil {
+					return nil, err
+				}
+				if err := d.add(s.tag, body); err != nil {
+					return nil, err
+				}
+			}
+		}
+		off = bodyOff + min(int64(alignUp(int(length))), size-bodyOff)
+	}
+	g, err := d.finish()
+	if err != nil {
+		return nil, err
+	}
+	sr.graph = g
+	return sr, nil
+}
+
+// Graph returns the graph read so far; its Payload is nil until Load
+func (r *Reader) Graph() *Graph {
+	return r.graph
+}
+
+// PayloadSize returns the uncompressed payload length in bytes
+func (r *Reader) PayloadSize() int64 {
+	if r.payload.rawLen != 0 {
+		return int64(r.payload.rawLen)
+	}
+	return r.bodyLen
+}
+
+// PayloadAt returns a reader for lazy random access to an uncompressed
+// payload. Reads through it skip the checksum and digest checks, and it
+// fails with ErrCompressed for compressed payloads.
+func (r *Reader) PayloadAt() (*io.SectionReader, error) {
+	if r.payload.rawLen != 0 {
+		return nil, ErrCompressed
+	}
+	return io.NewSectionReader(r.r, r.bodyOff, r.bodyLen), nil
+}
+
+// ReadPayload streams the payload into dst, which must hold PayloadSize
+// bytes, verifying its checksum on the way. In signed and digested files
+// the rest of the file is read in chunks to check the digest as well. A
+// compressed payload is read whole before it is decompressed into dst.
+func (r *Reader) ReadPayload(dst []byte) error {
+	if int64(len(dst)) != r.PayloadSize() {
+		return fmt.Errorf("payload is %d bytes, buffer holds %d", r.PayloadSize(), len(dst))
+	}
+	h := sha256.New()
+	if r.signOff < 0 {
+		h = nil
+	}
+	if err := r.hashRange(h, 0, r.bodyOff); err != nil {
+		return err
+	}
+
+	stored := dst
+	c, _ := r.payload.codec(uint64(r.bodyLen))
+	if c != CompressNone {
+		stored = make([]byte, r.bodyLen)
+	}
+	var sum uint32
+	for off := int64(0); off < r.bodyLen; off += streamChunk {
+		chunk := stored[off:min(off+streamChunk, r.bodyLen)]
+		if err := readAt(r.r, chunk, r.bodyOff+off); err != nil {
+			return fmt.Errorf("PAYL section: %w", err)
+		}
+		sum = crc32.Update(sum, crc32.IEEETable, chunk)
+		if h != nil {
+			h.Write(chunk)
+		}
+	}
+	if r.payload.flags&sectionFlagCRC != 0 && sum != r.sumWant {
+		return fmt.Errorf("PAYL section: %w", ErrChecksum)
+	}
+	if h != nil {
+		if err := r.hashRange(h, r.bodyOff+r.bodyLen, r.signOff); err != nil {
+			return err
+		}
+		h.Sum(r.digest[:0])
+		r.digested = true
+		if len(r.signBody) != sha256.Size && len(r.signBody) != sha256.Size+ed25519.SignatureSize {
+			return fmt.Errorf("SIGN section has %d bytes", len(r.signBody))
+		}
+		if !bytes.Equal(r.digest[:], r.signBody[:sha256.Size]) {
+			return fmt.Errorf("file digest: %w", ErrChecksum)
+		}
+	}
+	if c != CompressNone {
+		r.payload.body = stored
+		return r.payload.decodeTo(dst, c)
+	}
+	return nil
+}
+
+// hashRange feeds the file bytes [from, to) to h, if any
+func (r *Reader) hashRange(h hash.Hash, from, to int64) error {
+	if h == nil || to <= from {
+		return nil
+	}
+	_, err := io.CopyBuffer(h, io.NewSectionReader(r.r, from, to-from), make([]byte, min(streamChunk, to-from)))
+	return err
+}
+
+// Load allocates the payload, streams it in with ReadPayload and returns
+// the complete graph
+func (r *Reader) Load() (*Graph, error) {
+	if r.graph.Payload == nil {
+		payload := make([]byte, r.PayloadSize())
+		if err := r.ReadPayload(payload); err != nil {
+			return nil, err
+		}
+		r.graph.Payload = payload
+	}
+	return r.graph, nil
+}
+
+// Verify checks the file signature like the package-level Verify, reusing
+// the digest computed by ReadPayload when it ran
+func (r *Reader) Verify(key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid Ed25519 public key: %d bytes", len(key))
+	}
+	if r.signOff < 0 {
+		return ErrUnsigned
+	}
+	if !r.digested {
+		h := sha256.New()
+		if err := r.hashRange(h, 0, r.signOff); err != nil {
+			return err
+		}
+		h.Sum(r.digest[:0])
+		r.digested = true
+	}
+	if len(r.signBody) < sha256.Size || !bytes.Equal(r.digest[:], r.signBody[:sha256.Size]) {
+		return fmt.Errorf("file digest: %w", ErrChecksum)
+	}
+	if len(r.signBody) != sha256.Size+ed25519.SignatureSize {
+		return ErrUnsigned
+	}
+	if !ed25519.Verify(key, r.digest[:], r.signBody[sha256.Size:]) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// readAt fills p from offset off of r, accepting the io.EOF a ReaderAt may
+// return along with the last bytes of its input
+func readAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
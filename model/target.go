@@ -0,0 +1,161 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+)
+
+// Target is the ISA profile a model is compiled for, recorded in the file
+// header so runtimes can tell when they run a model built for another CPU
+type Target uint8
+
+const (
+	TargetGeneric Target = iota // Portable layout, the default
+	TargetAVX2
+	TargetAVX512
+	TargetNEON
+)
+
+var targetNames = [...]string{
+	TargetGeneric: "generic",
+	TargetAVX2:    "avx2",
+	TargetAVX512:  "avx512",
+	TargetNEON:    "neon",
+}
+
+// TargetProfile holds the layout and blocking parameters of a Target
+type TargetProfile struct {
+	Align int // Payload alignment in bytes, the cache line size
+	Tile  int // matmul block edge in elements, 0 keeps the plain kernel
+}
+
+var targetProfiles = [...]TargetProfile{
+	TargetGeneric: {Align: 32},
+	TargetAVX2:    {Align: 64, Tile: 64},
+	TargetAVX512:  {Align: 64, Tile: 128},
+	TargetNEON:    {Align: 128, Tile: 32},
+}
+
+// String returns the target name
+func (t Target) String() string {
+	if int(t) < len(targetNames) {
+		return targetNames[t]
+	}
+	return fmt.Sprintf("Target(%d)", t)
+}
+
+// Profile returns the parameters the compiler uses for t
+func (t Target) Profile() TargetProfile {
+	if int(t) < len(targetProfiles) {
+		return targetProfiles[t]
+	}
+	return targetProfiles[TargetGeneric]
+}
+
+// ParseTarget parses a target name as printed by String; "" selects
+// TargetGeneric
+func ParseTarget(name string) (Target, error) {
+	if name == "" {
+		return TargetGeneric, nil
+	}
+	for t, n := range targetNames {
+		if strings.EqualFold(name, n) {
+			return Target(t), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown target %q (want %s)", name, strings.Join(targetNames[:], ", "))
+}
+
+// ApplyTarget specializes g for t and records it in g.Target. With a tile
+// size, matmul nodes become matmul_tiled with the profile's tile edge, under
+// the same exclusions as Fuse: the first node, nodes bound to IO specs and
+// tied nodes keep their kernel. With an alignment above 32 bytes, every node
+// range and segment of the payload is moved to start on that boundary. It
+// returns the number of nodes rewritten.
+func (g *Graph) ApplyTarget(t Target) (int, error) {
+	if int(t) >= len(targetNames) {
+		return 0, fmt.Errorf("unknown target %v", t)
+	}
+	g.Target = t
+	p := t.Profile()
+
+	var tiled []uint32
+	payloads := make(map[uint32][]byte)
+	if p.Tile > 0 && len(g.Nodes) > 0 && kernels.Catalog[kernels.OpMatMulTiled] != nil {
+		pinned := map[uint32]bool{g.Nodes[0].ID: true}
+		for _, s := range g.IO {
+			pinned[s.NodeID] = true
+		}
+		for i := range g.Nodes {
+			n := &g.Nodes[i]
+			if pinned[n.ID] || n.Flags&core.FlagShared != 0 || n.Kernel != kernels.OpMatMul {
+				continue
+			}
+			payload, ok := tileMatMul(g.nodePayload(*n), p.Tile)
+			if !ok {
+				continue
+			}
+			n.Kernel = kernels.OpMatMulTiled
+			payloads[n.ID] = payload
+			tiled = append(tiled, n.ID)
+		}
+	}
+	if len(tiled) > 0 {
+		g.replaceNodes(g.Nodes, nil, tiled, payloads)
+	}
+	if p.Align > 32 {
+		g.alignPayload(p.Align)
+	}
+	if len(tiled) == 0 {
+		return 0, nil
+	}
+	return len(tiled), g.InferShapes()
+}
+
+// tileMatMul lays out the matmul_tiled payload of a matmul payload,
+// appending a zeroed result matrix
+func tileMatMul(p []byte, tile int) ([]byte, bool) {
+	if len(p) < 6 {
+		return nil, false
+	}
+	rows := int(binary.LittleEndian.Uint16(p[0:]))
+	cols := int(binary.LittleEndian.Uint16(p[2:]))
+	bCols := int(binary.LittleEndian.Uint16(p[4:]))
+	operands := 4 * (rows*cols + cols*bCols)
+	if rows*cols*bCols == 0 || len(p) < 6+operands {
+		return nil, false
+	}
+	out := make([]byte, kernels.MatMulTiledHeader, kernels.MatMulTiledHeader+operands+4*rows*bCols)
+	copy(out, p[:6])
+	binary.LittleEndian.PutUint16(out[6:], uint16(min(tile, 0xFFFF)))
+	out = append(out, p[6:6+operands]...)
+	return append(out, make([]byte, 4*rows*bCols)...), true
+}
+
+// alignPayload moves the node ranges and segments of the payload so each
+// starts on an align-byte boundary
+func (g *Graph) alignPayload(align int) {
+	ranges := make([][2]uint32, 0, len(g.Nodes)+len(g.Segments))
+	for _, n := range g.Nodes {
+		if n.Out > n.In {
+			ranges = append(ranges, [2]uint32{n.In, n.Out})
+		}
+	}
+	for _, s := range g.Segments {
+		if s.Length > 0 {
+			ranges = append(ranges, [2]uint32{s.Offset, s.End()})
+		}
+	}
+	payload, move := compactRanges(g.Payload, ranges, align)
+	for i := range g.Nodes {
+		g.Nodes[i].In, g.Nodes[i].Out = move(g.Nodes[i].In), move(g.Nodes[i].Out)
+	}
+	for i := range g.Segments {
+		g.Segments[i].Offset = move(g.Segments[i].Offset)
+	}
+	g.Payload = payload
+}
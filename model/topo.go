@@ -0,0 +1,160 @@
+package model
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CycleError reports a dependency cycle in the node topology
+type CycleError struct {
+	Path []uint32 // Node IDs in data-flow order, the first repeated at the end
+}
+
+// Error names the nodes around the cycle, e.g. "dependency cycle: 3 -> 4 -> 3"
+func (e *CycleError) Error() string {
+	ids := make([]string, len(e.Path))
+	for i, id := range e.Path {
+		ids[i] = fmt.Sprint(id)
+	}
+	return "dependency cycle: " + strings.Join(ids, " -> ")
+}
+
+// TopologicalOrder returns the node indices ordered so every node follows
+// the nodes it depends on. The sort is stable: of the nodes ready at any
+// point the earliest in graph order comes first, so a graph already in
+// dependency order keeps its order. A Topo entry naming an ID shared by
+// several nodes depends on all of them; unknown IDs are ignored. A cyclic
+// graph returns a *CycleError naming one cycle.
+func (g *Graph) TopologicalOrder() ([]int, error) {
+	byID := make(map[uint32][]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		byID[n.ID] = append(byID[n.ID], i)
+	}
+	inDegree := make([]int, len(g.Nodes))
+	dependents := make([][]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		for _, dep := range n.Topo {
+			if dep == NoNeighbor {
+				continue
+			}
+			for _, j := range byID[dep] {
+				dependents[j] = append(dependents[j], i)
+				inDegree[i]++
+			}
+		}
+	}
+
+	// Roots are collected in ascending order, which is already a valid heap
+	var ready indexHeap
+	for i, d := range inDegree {
+		if d == 0 {
+			ready = append(ready, i)
+		}
+	}
+	order := make([]int, 0, len(g.Nodes))
+	for ready.Len() > 0 {
+		i := heap.Pop(&ready).(int)
+		order = append(order, i)
+		for _, d := range dependents[i] {
+			inDegree[d]--
+			if inDegree[d] == 0 {
+				heap.Push(&ready, d)
+			}
+		}
+	}
+
+	if len(order) < len(g.Nodes) {
+		return nil, &CycleError{Path: g.findCycle(byID, inDegree)}
+	}
+	return order, nil
+}
+
+// Levels groups the node indices by dependency depth: level 0 holds the
+// nodes without dependencies, and every other node is one level after its
+// deepest dependency, so the nodes of a level can run concurrently once the
+// levels before it finished. Each level is in graph order. A cyclic graph
+// returns a *CycleError.
+func (g *Graph) Levels() ([][]int, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint32][]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		byID[n.ID] = append(byID[n.ID], i)
+	}
+	depth := make([]int, len(g.Nodes))
+	var levels [][]int
+	for _, i := range order {
+		for _, dep := range g.Nodes[i].Topo {
+			for _, j := range byID[dep] {
+				depth[i] = max(depth[i], depth[j]+1)
+			}
+		}
+		if depth[i] == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[depth[i]] = append(levels[depth[i]], i)
+	}
+	for _, l := range levels {
+		slices.Sort(l)
+	}
+	return levels, nil
+}
+
+// findCycle returns one cycle among the nodes Kahn's algorithm left with a
+// positive in-degree. Each of them depends on another such node, so walking
+// dependencies from the first one must revisit a node.
+func (g *Graph) findCycle(byID map[uint32][]int, inDegree []int) []uint32 {
+	start := slices.IndexFunc(inDegree, func(d int) bool { return d > 0 })
+	seen := make(map[int]int) // Node index to its position in walk
+	var walk []int
+	for i := start; ; {
+		if pos, ok := seen[i]; ok {
+			walk = walk[pos:]
+			break
+		}
+		seen[i] = len(walk)
+		walk = append(walk, i)
+		i = g.pendingDependency(byID, inDegree, i)
+	}
+
+	// walk follows dependencies backwards; report it in data-flow order,
+	// starting from the node where the walk entered the cycle
+	path := []uint32{g.Nodes[walk[0]].ID}
+	for k := len(walk) - 1; k >= 0; k-- {
+		path = append(path, g.Nodes[walk[k]].ID)
+	}
+	return path
+}
+
+// pendingDependency returns a dependency of node i that was never sorted
+func (g *Graph) pendingDependency(byID map[uint32][]int, inDegree []int, i int) int {
+	for _, dep := range g.Nodes[i].Topo {
+		if dep == NoNeighbor {
+			continue
+		}
+		for _, j := range byID[dep] {
+			if inDegree[j] > 0 {
+				return j
+			}
+		}
+	}
+	panic("model: unsorted node without unsorted dependencies")
+}
+
+// indexHeap is a min-heap of node indices
+type indexHeap []int
+
+func (h indexHeap) Len() int           { return len(h) }
+func (h indexHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x any)        { *h = append(*h, x.(int)) }
+func (h *indexHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
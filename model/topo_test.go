@@ -0,0 +1,58 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestTopologicalOrder(t *testing.T) {
+	t.Parallel()
+	ordered := &Graph{Nodes: []Node{
+		{ID: 0}, {ID: 1}, {ID: 2, Topo: []uint32{0}}, {ID: 3, Topo: []uint32{1, 2}}, {ID: 4},
+	}}
+	if order, err := ordered.TopologicalOrder(); err != nil || !slices.Equal(order, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("Expected a graph in dependency order to keep it, got %v (%v)", order, err)
+	}
+
+	// Consumers listed first move after their producers, and independent
+	// nodes keep their relative order
+	graph := &Graph{Nodes: []Node{
+		{ID: 2, Topo: []uint32{1}}, {ID: 0}, {ID: 1, Topo: []uint32{0}}, {ID: 3},
+	}}
+	for run := 0; run < 10; run++ {
+		if order, err := graph.TopologicalOrder(); err != nil || !slices.Equal(order, []int{1, 2, 0, 3}) {
+			t.Fatalf("Expected order [1 2 0 3], got %v (%v)", order, err)
+		}
+	}
+	if err := graph.Optimize(); err != nil {
+		t.Fatalf("Optimize failed: %v", err)
+	}
+	if ids := nodeIDs(graph); !slices.Equal(ids, []uint32{0, 1, 2, 3}) {
+		t.Errorf("Expected Optimize to sort nodes, got %v", ids)
+	}
+
+	for _, tc := range []struct {
+		nodes []Node
+		want  []uint32
+	}{
+		{
+			[]Node{{ID: 0}, {ID: 1, Topo: []uint32{0, 3}}, {ID: 2, Topo: []uint32{1}}, {ID: 3, Topo: []uint32{2}}, {ID: 4, Topo: []uint32{3}}},
+			[]uint32{1, 2, 3, 1},
+		},
+		{
+			[]Node{{ID: 0}, {ID: 5, Topo: []uint32{0, 5}}},
+			[]uint32{5, 5},
+		},
+	} {
+		cyclic := &Graph{Nodes: slices.Clone(tc.nodes)}
+		_, err := cyclic.TopologicalOrder()
+		var cycle *CycleError
+		if !errors.As(err, &cycle) || !slices.Equal(cycle.Path, tc.want) {
+			t.Errorf("Expected cycle %v, got %v", tc.want, err)
+		}
+		if err := cyclic.Optimize(); !errors.As(err, &cycle) || !slices.Equal(nodeIDs(cyclic), nodeIDs(&Graph{Nodes: tc.nodes})) {
+			t.Errorf("Expected Optimize to fail and keep every node, got %v (%v)", nodeIDs(cyclic), err)
+		}
+	}
+}
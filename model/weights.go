@@ -0,0 +1,218 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// A weights checkpoint holds only the parameters of a model, its weight and
+// bias segments, so training runs and deployments exchange them without the
+// architecture. It is bound to the architecture by hash:
+//
+//	header   magic "SBLW" u32 | version u16 | reserved u16 | architecture sha256 [32] | count u32
+//	tensor   segment ID u32 | length u32 | dtype u8 | role u8 | name length u16 | name | data
+//	trailer  crc32 (IEEE) u32 of every byte before it
+const (
+	WeightsMagic   = 0x574C4253 // "SBLW" in little endian
+	WeightsVersion = 1
+)
+
+// ErrArchitectureMismatch reports weights extracted from a model with a
+// different architecture than the one they are applied to
+var ErrArchitectureMismatch = errors.New("architecture mismatch")
+
+// Weights is a parameter checkpoint, see ExtractWeights
+type Weights struct {
+	Architecture [sha256.Size]byte // ArchitectureHash of the model extracted from
+	Tensors      []WeightTensor    // In segment table order
+}
+
+// WeightTensor is the data of one parameter segment
+type WeightTensor struct {
+	ID    uint32 // Segment ID
+	Name  string
+	DType DType
+	Role  SegmentRole
+	Data  []byte
+}
+
+// ArchitectureHash returns the SHA-256 digest of everything about the
+// graph but its payload bytes, metadata and inferred shapes: the nodes, IO
+// specs, segment table and payload size. Training and reloading weights
+// leave it unchanged.
+func (g *Graph) ArchitectureHash() ([sha256.Size]byte, error) {
+	var buf bytes.Buffer
+	if err := writeNodeSection(&buf, g.Nodes); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	if err := writeIOTable(&buf, g.IO); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	if err := writeSegments(&buf, g.Segments, g.Nodes); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(g.Payload))))
+	return sha256.Sum256(buf.Bytes()), nil
+}
+
+// ParameterSegments returns the weight and bias segments, in table order
+func (g *Graph) ParameterSegments() []Segment {
+	var params []Segment
+	for _, s := range g.Segments {
+		if s.Role == RoleWeight || s.Role == RoleBias {
+			params = append(params, s)
+		}
+	}
+	return params
+}
+
+// ExtractWeights copies the parameter segments of the graph into a
+// checkpoint. The graph needs a weight or bias segment.
+func (g *Graph) ExtractWeights() (*Weights, error) {
+	params := g.ParameterSegments()
+	if len(params) == 0 {
+		return nil, errors.New("weights: model has no weight or bias segments")
+	}
+	arch, err := g.ArchitectureHash()
+	if err != nil {
+		return nil, fmt.Errorf("weights: %w", err)
+	}
+	w := &Weights{Architecture: arch, Tensors: make([]WeightTensor, len(params))}
+	for i, s := range params {
+		if uint64(s.End()) > uint64(len(g.Payload)) {
+			return nil, fmt.Errorf("weights: segment %d exceeds the payload", s.ID)
+		}
+		w.Tensors[i] = WeightTensor{
+			ID:    s.ID,
+			Name:  s.Name,
+			DType: s.DType,
+			Role:  s.Role,
+			Data:  bytes.Clone(g.Payload[s.Offset:s.End()]),
+		}
+	}
+	return w, nil
+}
+
+// CheckWeights reports whether w can be applied to the graph: extracted
+// from the same architecture, with one tensor of the right name, dtype and
+// size per parameter segment
+func (g *Graph) CheckWeights(w *Weights) error {
+	arch, err := g.ArchitectureHash()
+	if err != nil {
+		return fmt.Errorf("weights: %w", err)
+	}
+	if arch != w.Architecture {
+		return fmt.Errorf("weights: %w", ErrArchitectureMismatch)
+	}
+	params := g.ParameterSegments()
+	if len(w.Tensors) != len(params) {
+		return fmt.Errorf("weights: %d tensors for %d parameter segments", len(w.Tensors), len(params))
+	}
+	for i, s := range params {
+		t := w.Tensors[i]
+		if t.ID != s.ID || t.Name != s.Name || t.DType != s.DType || len(t.Data) != int(s.Length) {
+			return fmt.Errorf("weights: tensor %d %q (%d bytes of %v) does not match segment %d %q (%d bytes of %v)",
+				t.ID, t.Name, len(t.Data), t.DType, s.ID, s.Name, s.Length, s.DType)
+		}
+		if uint64(s.End()) > uint64(len(g.Payload)) {
+			return fmt.Errorf("weights: segment %d exceeds the payload", s.ID)
+		}
+	}
+	return nil
+}
+
+// ApplyWeights copies the tensors of w into the parameter segments of the
+// payload, after CheckWeights, so a failed check leaves the payload alone
+func (g *Graph) ApplyWeights(w *Weights) error {
+	if err := g.CheckWeights(w); err != nil {
+		return err
+	}
+	for i, s := range g.ParameterSegments() {
+		copy(g.Payload[s.Offset:s.End()], w.Tensors[i].Data)
+	}
+	return nil
+}
+
+// Serialize writes the checkpoint in the weights format
+func (w *Weights) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	var b [12]byte
+	binary.LittleEndian.PutUint32(b[0:], WeightsMagic)
+	binary.LittleEndian.PutUint16(b[4:], WeightsVersion)
+	binary.LittleEndian.PutUint16(b[6:], 0)
+	buf.Write(b[:8])
+	buf.Write(w.Architecture[:])
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(w.Tensors))))
+	for _, t := range w.Tensors {
+		if len(t.Name) > 0xFFFF {
+			return nil, fmt.Errorf("weights: segment %d name exceeds %d bytes", t.ID, 0xFFFF)
+		}
+		if uint64(len(t.Data)) > 0xFFFFFFFF {
+			return nil, fmt.Errorf("weights: segment %d exceeds 4 GiB", t.ID)
+		}
+		binary.LittleEndian.PutUint32(b[0:], t.ID)
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(t.Data)))
+		b[8], b[9] = byte(t.DType), byte(t.Role)
+		binary.LittleEndian.PutUint16(b[10:], uint16(len(t.Name)))
+		buf.Write(b[:12])
+		buf.WriteString(t.Name)
+		buf.Write(t.Data)
+	}
+	buf.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(buf.Bytes())))
+	return buf.Bytes(), nil
+}
+
+// ReadWeights reads a checkpoint written by Weights.Serialize. The tensors
+// alias data.
+func ReadWeights(data []byte) (*Weights, error) {
+	const header = 8 + sha256.Size + 4
+	if len(data) < header+4 {
+		return nil, fmt.Errorf("weights: truncated header: %d bytes", len(data))
+	}
+	if magic := binary.LittleEndian.Uint32(data); magic != WeightsMagic {
+		return nil, fmt.Errorf("weights: invalid magic number %#x", magic)
+	}
+	if version := binary.LittleEndian.Uint16(data[4:]); version != WeightsVersion {
+		return nil, fmt.Errorf("weights: unsupported version %d", version)
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("weights: %w", ErrChecksum)
+	}
+
+	w := &Weights{}
+	copy(w.Architecture[:], body[8:])
+	count := binary.LittleEndian.Uint32(body[8+sha256.Size:])
+	body = body[header:]
+	if uint64(count)*12 > uint64(len(body)) {
+		return nil, fmt.Errorf("weights: %d tensors exceed the file", count)
+	}
+	w.Tensors = make([]WeightTensor, count)
+	for i := range w.Tensors {
+		if len(body) < 12 {
+			return nil, fmt.Errorf("weights: tensor %d: truncated entry", i)
+		}
+		length := uint64(binary.LittleEndian.Uint32(body[4:]))
+		nameLen := uint64(binary.LittleEndian.Uint16(body[10:]))
+		if 12+nameLen+length > uint64(len(body)) {
+			return nil, fmt.Errorf("weights: tensor %d: %d bytes exceed the file", i, nameLen+length)
+		}
+		name := body[12 : 12+nameLen]
+		w.Tensors[i] = WeightTensor{
+			ID:    binary.LittleEndian.Uint32(body[0:]),
+			Name:  string(name),
+			DType: DType(body[8]),
+			Role:  SegmentRole(body[9]),
+			Data:  body[12+nameLen : 12+nameLen+length],
+		}
+		body = body[12+nameLen+length:]
+	}
+	if len(body) != 0 {
+		return nil, fmt.Errorf("weights: %d trailing bytes", len(body))
+	}
+	return w, nil
+}
@@ -0,0 +1,87 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sbl8/sublation/core"
+)
+
+// NUMAPolicy selects how per-worker arena shards are placed across NUMA nodes.
+type NUMAPolicy int
+
+const (
+	// NUMANone leaves page placement to the operating system.
+	NUMANone NUMAPolicy = iota
+	// NUMALocal binds each worker's arena shard to the node of the CPU the
+	// worker is pinned to, so temporaries never cross the socket interconnect.
+	NUMALocal
+)
+
+// String returns the policy name as used in flags and logs.
+func (p NUMAPolicy) String() string {
+	switch p {
+	case NUMANone:
+		return "none"
+	case NUMALocal:
+		return "local"
+	default:
+		return fmt.Sprintf("NUMAPolicy(%d)", int(p))
+	}
+}
+
+// ParseNUMAPolicy converts a policy name ("none", "local") into a NUMAPolicy.
+func ParseNUMAPolicy(name string) (NUMAPolicy, error) {
+	switch name {
+	case "", "none":
+		return NUMANone, nil
+	case "local":
+		return NUMALocal, nil
+	default:
+		return NUMANone, fmt.Errorf("unknown NUMA policy %q (want none or local)", name)
+	}
+}
+
+// errNUMAUnsupported is returned by bindToNode when the platform or sandbox
+// does not allow memory policy changes. Placement is then left to the kernel.
+var errNUMAUnsupported = errors.New("NUMA memory binding not supported")
+
+// workerCPU maps a worker index onto the set of CPUs the process may run on.
+// Workers wrap around when there are more workers than CPUs. Returns -1 when
+// the CPU set is unknown.
+func workerCPU(worker int, cpus []int) int {
+	if len(cpus) == 0 || worker < 0 {
+		return -1
+	}
+	return cpus[worker%len(cpus)]
+}
+
+// placeWorkerShards carves one scratch shard per worker out of the arena and,
+// under NUMALocal, binds each shard to the node of the worker's CPU.
+func (e *Engine) placeWorkerShards(arena *Arena) error {
+	if e.opts.NUMAPolicy == NUMANone {
+		return nil
+	}
+
+	if err := arena.CarveWorkerShards(e.workers, core.PageSize); err != nil {
+		return fmt.Errorf("failed to carve worker shards: %w", err)
+	}
+
+	for i := 0; i < e.workers; i++ {
+		shard, err := arena.WorkerShard(i)
+		if err != nil {
+			return err
+		}
+		node := cpuNode(workerCPU(i, e.cpus))
+		if node < 0 {
+			continue
+		}
+		if err := bindToNode(shard, node); err != nil {
+			if errors.Is(err, errNUMAUnsupported) {
+				return nil
+			}
+			return fmt.Errorf("failed to bind shard %d to node %d: %w", i, node, err)
+		}
+	}
+	return nil
+}
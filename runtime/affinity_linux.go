@@ -0,0 +1,128 @@
+//go:build linux
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// cpuSetWords sizes the affinity mask for up to 1024 CPUs, matching glibc's cpu_set_t.
+const cpuSetWords = 1024 / 64
+
+// Memory policy constants from <linux/mempolicy.h>.
+const (
+	mpolBind   = 2
+	mpolMFMove = 1 << 1
+)
+
+// allowedCPUs returns the sorted list of CPUs the calling process may run on.
+func allowedCPUs() []int {
+	var mask [cpuSetWords]uint64
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return nil
+	}
+
+	var cpus []int
+	for w, bits := range mask {
+		for b := 0; b < 64; b++ {
+			if bits&(1<<uint(b)) != 0 {
+				cpus = append(cpus, w*64+b)
+			}
+		}
+	}
+	return cpus
+}
+
+// pinThread restricts the calling OS thread to a single CPU.
+// The caller must hold runtime.LockOSThread for the pin to be meaningful.
+func pinThread(cpu int) error {
+	if cpu < 0 || cpu >= cpuSetWords*64 {
+		return syscall.EINVAL
+	}
+	var mask [cpuSetWords]uint64
+	mask[cpu/64] = 1 << uint(cpu%64)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// cpuNode returns the NUMA node owning cpu, or -1 when sysfs does not expose topology.
+func cpuNode(cpu int) int {
+	if cpu < 0 {
+		return -1
+	}
+	matches, err := filepath.Glob("/sys/devices/system/node/node*/cpulist")
+	if err != nil {
+		return -1
+	}
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if !cpuListContains(strings.TrimSpace(string(data)), cpu) {
+			continue
+		}
+		name := filepath.Base(filepath.Dir(path))
+		node, err := strconv.Atoi(strings.TrimPrefix(name, "node"))
+		if err != nil {
+			continue
+		}
+		return node
+	}
+	return -1
+}
+
+// cpuListContains reports whether a sysfs cpulist such as "0-3,8-11" includes cpu.
+func cpuListContains(list string, cpu int) bool {
+	for _, part := range strings.Split(list, ",") {
+		if part == "" {
+			continue
+		}
+		lo, hi := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+		start, err1 := strconv.Atoi(lo)
+		end, err2 := strconv.Atoi(hi)
+		if err1 == nil && err2 == nil && cpu >= start && cpu <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// bindToNode applies an MPOL_BIND policy for node to the pages backing buf,
+// migrating pages that were already faulted in elsewhere.
+// buf must start on a page boundary.
+func bindToNode(buf []byte, node int) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	if node < 0 || node >= cpuSetWords*64 {
+		return syscall.EINVAL
+	}
+	var nodemask [cpuSetWords]uint64
+	nodemask[node/64] = 1 << uint(node%64)
+
+	_, _, errno := syscall.Syscall6(syscall.SYS_MBIND,
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)),
+		mpolBind, uintptr(unsafe.Pointer(&nodemask[0])), uintptr(len(nodemask)*64),
+		mpolMFMove)
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOSYS, syscall.EPERM:
+		return errNUMAUnsupported
+	default:
+		return errno
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package runtime
+
+// allowedCPUs is unknown on this platform; workers are left unpinned.
+func allowedCPUs() []int { return nil }
+
+// pinThread is a no-op outside Linux.
+func pinThread(cpu int) error { return nil }
+
+// cpuNode reports no NUMA topology outside Linux.
+func cpuNode(cpu int) int { return -1 }
+
+// bindToNode is not available outside Linux.
+func bindToNode(buf []byte, node int) error { return errNUMAUnsupported }
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/sbl8/sublation/core"
@@ -38,8 +39,26 @@ type Arena struct {
 	streamingInput ArenaRegion // Active batch
 	freeTail       ArenaRegion // Head-room for growth / hot-swap
 
-	currentNodePayloadOffset uintptr // Bump allocator for nodePayloads region
-	currentScratchOffset     uintptr // Bump allocator for scratch region
+	currentNodePayloadOffset atomic.Uintptr // Bump allocator for nodePayloads region
+	currentScratchOffset     atomic.Uintptr // Bump allocator for scratch region
+
+	nodePayloadHighWater atomic.Uintptr // Peak bytes handed out from nodePayloads
+	scratchHighWater     atomic.Uintptr // Peak bytes handed out from scratch
+	streamingHighWater   uintptr        // Most bytes ever buffered in streamingInput
+
+	streamRead, streamWrite uintptr // Ring cursors over streamingInput; free-running, taken modulo its size
+
+	workerShards []ArenaRegion // Per-worker slices of the scratch region, see CarveWorkerShards
+	shardCursors []shardCursor // Bump allocator per worker shard
+
+	growth arenaGrowth // FreeTail overflow, see AllowGrowth
+}
+
+// shardCursor is the bump offset of one worker shard, padded so neighbouring
+// workers never share a cache line.
+type shardCursor struct {
+	offset uintptr
+	_      [core.CacheLineSize - unsafe.Sizeof(uintptr(0))]byte
 }
 
 const (
@@ -49,6 +68,24 @@ const (
 
 // NewArena initializes a new Arena with a given total size and graph definition.
 func NewArena(totalSize uintptr, graph *model.Graph, nodePayloadsSize uintptr, streamingInputSize uintptr, kernelScratchSize uintptr) (*Arena, error) {
+	return newArena(nil, totalSize, graph, nodePayloadsSize, streamingInputSize, kernelScratchSize)
+}
+
+// NewArenaInBuffer lays an Arena out over caller-owned memory instead of
+// allocating. buf must be cache-line aligned and at least as large as the
+// effective arena size; the arena uses only that prefix of it.
+func NewArenaInBuffer(buf []byte, totalSize uintptr, graph *model.Graph, nodePayloadsSize uintptr, streamingInputSize uintptr, kernelScratchSize uintptr) (*Arena, error) {
+	if len(buf) == 0 {
+		return nil, errors.New("arena backing buffer is empty")
+	}
+	if !core.IsAligned(uintptr(unsafe.Pointer(&buf[0]))) {
+		return nil, errors.New("arena backing buffer is not cache-line aligned")
+	}
+	return newArena(buf, totalSize, graph, nodePayloadsSize, streamingInputSize, kernelScratchSize)
+}
+
+// newArena builds an arena, allocating a buffer when backing is nil.
+func newArena(backing []byte, totalSize uintptr, graph *model.Graph, nodePayloadsSize uintptr, streamingInputSize uintptr, kernelScratchSize uintptr) (*Arena, error) {
 	if err := validateArenaInputs(totalSize, graph, nodePayloadsSize, streamingInputSize, kernelScratchSize); err != nil {
 		return nil, err
 	}
@@ -58,7 +95,7 @@ func NewArena(totalSize uintptr, graph *model.Graph, nodePayloadsSize uintptr, s
 		return nil, err
 	}
 
-	arena, err := createArenaBuffer(effectiveTotalSize)
+	arena, err := createArenaBuffer(effectiveTotalSize, backing)
 	if err != nil {
 		return nil, err
 	}
@@ -125,13 +162,22 @@ func calculateMinRequiredSize(graph *model.Graph, nodePayloadsSize uintptr, stre
 	return core.AlignedSize(minRequiredSize)
 }
 
-// createArenaBuffer allocates the arena buffer
-func createArenaBuffer(effectiveTotalSize uintptr) (*Arena, error) {
+// createArenaBuffer allocates the arena buffer, or slices it from backing when provided
+func createArenaBuffer(effectiveTotalSize uintptr, backing []byte) (*Arena, error) {
 	arena := &Arena{
-		buffer:  core.AlignedBytes(int(effectiveTotalSize)),
 		regions: make(map[string]ArenaRegion),
 	}
 
+	if backing != nil {
+		if uintptr(len(backing)) < effectiveTotalSize {
+			return nil, fmt.Errorf("arena backing buffer of %d bytes is smaller than required size %d", len(backing), effectiveTotalSize)
+		}
+		arena.buffer = backing[:effectiveTotalSize:effectiveTotalSize]
+		return arena, nil
+	}
+
+	arena.buffer = core.AlignedBytes(int(effectiveTotalSize))
+
 	if arena.buffer == nil && effectiveTotalSize > 0 {
 		return nil, fmt.Errorf("failed to allocate arena buffer of size %d", effectiveTotalSize)
 	}
@@ -201,7 +247,7 @@ func layoutNodePayloads(arena *Arena, nodePayloadsSize uintptr, currentOffset ui
 	currentOffset = core.AlignedSize(currentOffset)
 	arena.nodePayloads = ArenaRegion{Offset: currentOffset, Size: nodePayloadsSize, Name: "NodePayloads"}
 	arena.regions["NodePayloads"] = arena.nodePayloads
-	arena.currentNodePayloadOffset = currentOffset
+	arena.currentNodePayloadOffset.Store(currentOffset)
 
 	return currentOffset + nodePayloadsSize
 }
@@ -215,7 +261,7 @@ func layoutScratchBuffers(arena *Arena, kernelScratchSize uintptr, currentOffset
 	currentOffset = core.AlignedSize(currentOffset)
 	arena.scratch = ArenaRegion{Offset: currentOffset, Size: kernelScratchSize, Name: "Scratch"}
 	arena.regions["Scratch"] = arena.scratch
-	arena.currentScratchOffset = currentOffset
+	arena.currentScratchOffset.Store(currentOffset)
 
 	return currentOffset + kernelScratchSize
 }
@@ -309,54 +355,168 @@ func (a *Arena) GetSublateAtIndex(index int) (*core.Sublate, error) {
 	return (*core.Sublate)(unsafe.Pointer(&a.buffer[absOffset])), nil
 }
 
-// AllocateNodePayload allocates a slice from the node payloads region using a bump allocator.
-// Not thread-safe without external locking.
-func (a *Arena) AllocateNodePayload(size uintptr, alignment uintptr) ([]byte, error) {
-	if a.nodePayloads.Size == 0 {
-		return nil, errors.New("no node payloads region defined")
-	}
+// bump reserves size bytes at the given alignment from region by advancing
+// cursor with compare-and-swap, and raises high to the new peak. It is safe
+// for concurrent use.
+func (a *Arena) bump(region ArenaRegion, cursor, high *atomic.Uintptr, size, alignment uintptr) ([]byte, error) {
 	if alignment == 0 {
 		alignment = DefaultAlignment
 	}
 
-	alignedOffset := (a.currentNodePayloadOffset + alignment - 1) &^ (alignment - 1)
-	if alignedOffset+size > a.nodePayloads.Offset+a.nodePayloads.Size {
-		return nil, fmt.Errorf("node payloads region exhausted: requested %d, available approx %d from current offset %d in region size %d", size, (a.nodePayloads.Offset+a.nodePayloads.Size)-alignedOffset, a.currentNodePayloadOffset, a.nodePayloads.Size)
+	end := region.Offset + region.Size
+	for {
+		current := cursor.Load()
+		alignedOffset := (current + alignment - 1) &^ (alignment - 1)
+		if alignedOffset+size > end {
+			return nil, a.exhausted(region, current, size)
+		}
+		if !cursor.CompareAndSwap(current, alignedOffset+size) {
+			continue
+		}
+
+		used := alignedOffset + size - region.Offset
+		for {
+			peak := high.Load()
+			if used <= peak || high.CompareAndSwap(peak, used) {
+				break
+			}
+		}
+		return a.buffer[alignedOffset : alignedOffset+size], nil
 	}
+}
 
-	result := a.buffer[alignedOffset : alignedOffset+size]
-	a.currentNodePayloadOffset = alignedOffset + size
-	return result, nil
+// AllocateNodePayload allocates a slice from the node payloads region using a bump allocator.
+// Safe for concurrent use. With AllowGrowth, a full region overflows into FreeTail.
+func (a *Arena) AllocateNodePayload(size uintptr, alignment uintptr) ([]byte, error) {
+	if a.nodePayloads.Size == 0 {
+		return nil, errors.New("no node payloads region defined")
+	}
+	buf, err := a.bump(a.nodePayloads, &a.currentNodePayloadOffset, &a.nodePayloadHighWater, size, alignment)
+	if err != nil {
+		if grown, ok := a.grow(false, size, alignment); ok {
+			return grown, nil
+		}
+	}
+	return buf, err
 }
 
 // ResetNodePayloads resets the bump allocator for the node payloads region.
+// It must not race with allocations.
 func (a *Arena) ResetNodePayloads() {
-	a.currentNodePayloadOffset = a.nodePayloads.Offset
+	a.currentNodePayloadOffset.Store(a.nodePayloads.Offset)
+	a.resetGrowth(false)
 }
 
 // AllocateScratch allocates a slice from the scratch buffer region using a bump allocator.
-// Not thread-safe without external locking.
+// Safe for concurrent use; workers with a carved shard should prefer
+// AllocateWorkerScratch, which does not contend.
 func (a *Arena) AllocateScratch(size uintptr, alignment uintptr) ([]byte, error) {
 	if a.scratch.Size == 0 {
 		return nil, errors.New("no scratch region defined")
 	}
+	buf, err := a.bump(a.scratch, &a.currentScratchOffset, &a.scratchHighWater, size, alignment)
+	if err != nil {
+		if grown, ok := a.grow(true, size, alignment); ok {
+			return grown, nil
+		}
+	}
+	return buf, err
+}
+
+// ResetScratch resets the bump allocators for the scratch region and every
+// worker shard. It must not race with allocations.
+func (a *Arena) ResetScratch() {
+	a.currentScratchOffset.Store(a.scratch.Offset)
+	a.resetGrowth(true)
+	for i := range a.shardCursors {
+		a.shardCursors[i].offset = a.workerShards[i].Offset
+	}
+}
+
+// CarveWorkerShards splits the scratch region into n equally sized shards, one per
+// worker, each starting on an align-byte boundary of the underlying memory (use
+// core.PageSize when shards are to be bound to NUMA nodes). Once carved, the shared
+// scratch bump allocator is restricted to the bytes preceding the first shard.
+func (a *Arena) CarveWorkerShards(n int, align uintptr) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid worker shard count %d", n)
+	}
+	if a.scratch.Size == 0 {
+		return errors.New("no scratch region defined")
+	}
+	if align == 0 {
+		align = DefaultAlignment
+	}
+
+	base := uintptr(unsafe.Pointer(&a.buffer[0]))
+	regionEnd := a.scratch.Offset + a.scratch.Size
+	start := ((base+a.scratch.Offset+align-1)&^(align-1) - base)
+	if start >= regionEnd {
+		return fmt.Errorf("scratch region of %d bytes cannot hold %d-byte aligned shards", a.scratch.Size, align)
+	}
+
+	shardSize := ((regionEnd - start) / uintptr(n)) &^ (align - 1)
+	if shardSize == 0 {
+		return fmt.Errorf("scratch region of %d bytes too small for %d worker shards aligned to %d", a.scratch.Size, n, align)
+	}
+
+	a.workerShards = make([]ArenaRegion, n)
+	a.shardCursors = make([]shardCursor, n)
+	for i := range a.workerShards {
+		a.workerShards[i] = ArenaRegion{
+			Offset: start + uintptr(i)*shardSize,
+			Size:   shardSize,
+			Name:   fmt.Sprintf("WorkerShard%d", i),
+		}
+	}
+
+	a.scratch.Size = start - a.scratch.Offset
+	a.regions["Scratch"] = a.scratch
+	a.ResetScratch()
+	return nil
+}
+
+// WorkerShard returns the scratch shard owned by the given worker.
+func (a *Arena) WorkerShard(worker int) ([]byte, error) {
+	if worker < 0 || worker >= len(a.workerShards) {
+		return nil, fmt.Errorf("worker %d has no shard (%d shards carved)", worker, len(a.workerShards))
+	}
+	shard := a.workerShards[worker]
+	return a.buffer[shard.Offset : shard.Offset+shard.Size], nil
+}
+
+// AllocateWorkerScratch allocates a slice from the given worker's shard using
+// a bump allocator private to that worker. Only the owning worker may call it,
+// so no synchronization is needed.
+func (a *Arena) AllocateWorkerScratch(worker int, size uintptr, alignment uintptr) ([]byte, error) {
+	if worker < 0 || worker >= len(a.workerShards) {
+		return nil, fmt.Errorf("worker %d has no shard (%d shards carved)", worker, len(a.workerShards))
+	}
 	if alignment == 0 {
 		alignment = DefaultAlignment
 	}
 
-	alignedOffset := (a.currentScratchOffset + alignment - 1) &^ (alignment - 1)
-	if alignedOffset+size > a.scratch.Offset+a.scratch.Size {
-		return nil, errors.New("scratch region exhausted")
+	shard := a.workerShards[worker]
+	cursor := &a.shardCursors[worker]
+	alignedOffset := (cursor.offset + alignment - 1) &^ (alignment - 1)
+	if alignedOffset+size > shard.Offset+shard.Size {
+		return nil, a.exhausted(shard, cursor.offset, size)
 	}
 
-	result := a.buffer[alignedOffset : alignedOffset+size]
-	a.currentScratchOffset = alignedOffset + size
-	return result, nil
+	cursor.offset = alignedOffset + size
+	return a.buffer[alignedOffset : alignedOffset+size], nil
 }
 
-// ResetScratch resets the bump allocator for the scratch region.
-func (a *Arena) ResetScratch() {
-	a.currentScratchOffset = a.scratch.Offset
+// ResetWorkerScratch resets the bump allocator of the given worker's shard.
+func (a *Arena) ResetWorkerScratch(worker int) {
+	if worker >= 0 && worker < len(a.shardCursors) {
+		a.shardCursors[worker].offset = a.workerShards[worker].Offset
+	}
+}
+
+// WorkerShardCount returns the number of carved worker shards.
+func (a *Arena) WorkerShardCount() int {
+	return len(a.workerShards)
 }
 
 // StreamingInputWindow returns a slice to the streaming input window.
@@ -367,16 +527,18 @@ func (a *Arena) StreamingInputWindow() ([]byte, error) {
 	return a.buffer[a.streamingInput.Offset : a.streamingInput.Offset+a.streamingInput.Size], nil
 }
 
-// WriteToStreamingInput copies data into the streaming input window.
+// WriteToStreamingInput empties the streaming ring and writes data at the
+// start of the window. Data larger than the window is rejected with an
+// InputTooLargeError.
 func (a *Arena) WriteToStreamingInput(data []byte) error {
-	window, err := a.StreamingInputWindow()
-	if err != nil {
-		return err
+	if a.streamingInput.Size == 0 {
+		return errors.New("no streaming input region defined")
 	}
 	if uintptr(len(data)) > a.streamingInput.Size {
-		return fmt.Errorf("data size %d exceeds streaming input size %d", len(data), a.streamingInput.Size)
+		return &InputTooLargeError{Size: len(data), Limit: int(a.streamingInput.Size)}
 	}
-	copy(window, data)
+	a.ResetStream()
+	a.StreamWrite(data)
 	return nil
 }
 
@@ -485,7 +647,7 @@ func InitSublateInArena(
 
 	// Allocate PayloadPrev from model payload or scratch
 	prevSize := defaultPayloadPrevSize
-	if modelNode.In < uint16(len(graphPayloadData)) {
+	if modelNode.In < uint32(len(graphPayloadData)) {
 		// Calculate size based on model structure or use default
 		remaining := uintptr(len(graphPayloadData)) - uintptr(modelNode.In)
 		if remaining < prevSize {
@@ -502,12 +664,12 @@ func InitSublateInArena(
 		sublatePtr.PayloadPrev = prevBuf
 
 		// Copy initial data if available
-		if modelNode.In < uint16(len(graphPayloadData)) {
+		if modelNode.In < uint32(len(graphPayloadData)) {
 			copySize := prevSize
 			if uintptr(modelNode.In)+copySize > uintptr(len(graphPayloadData)) {
 				copySize = uintptr(len(graphPayloadData)) - uintptr(modelNode.In)
 			}
-			copy(sublatePtr.PayloadPrev[:copySize], graphPayloadData[modelNode.In:modelNode.In+uint16(copySize)])
+			copy(sublatePtr.PayloadPrev[:copySize], graphPayloadData[modelNode.In:modelNode.In+uint32(copySize)])
 		}
 	}
 
@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrArenaExhausted is matched by every ArenaExhaustedError.
+var ErrArenaExhausted = errors.New("arena region exhausted")
+
+// ArenaExhaustedError describes a bump allocation that did not fit its region.
+type ArenaExhaustedError struct {
+	Region     string
+	NodeID     int // Node that requested the memory, -1 if unknown
+	Requested  uintptr
+	Available  uintptr
+	RegionSize uintptr
+}
+
+// Error implements error.
+func (e *ArenaExhaustedError) Error() string {
+	owner := ""
+	if e.NodeID >= 0 {
+		owner = fmt.Sprintf(" for node %d", e.NodeID)
+	}
+	return fmt.Sprintf("%s region exhausted%s: requested %d bytes, %d of %d available",
+		e.Region, owner, e.Requested, e.Available, e.RegionSize)
+}
+
+// Is lets errors.Is match ErrArenaExhausted.
+func (e *ArenaExhaustedError) Is(target error) bool {
+	return target == ErrArenaExhausted
+}
+
+// exhausted builds the error for a failed allocation of size bytes in region.
+func (a *Arena) exhausted(region ArenaRegion, current, size uintptr) error {
+	end := region.Offset + region.Size
+	available := uintptr(0)
+	if current < end {
+		available = end - current
+	}
+	return &ArenaExhaustedError{
+		Region:     region.Name,
+		NodeID:     -1,
+		Requested:  size,
+		Available:  available,
+		RegionSize: region.Size,
+	}
+}
+
+// withNodeID attributes an arena exhaustion error to the given node.
+func withNodeID(err error, nodeID uint32) error {
+	var exhausted *ArenaExhaustedError
+	if errors.As(err, &exhausted) {
+		exhausted.NodeID = int(nodeID)
+	}
+	return err
+}
+
+// RegionUsage reports how much of one arena region has been used.
+type RegionUsage struct {
+	Name      string
+	Offset    uintptr
+	Size      uintptr
+	Used      uintptr // Bytes currently allocated
+	HighWater uintptr // Peak bytes allocated since the arena was created
+}
+
+// ArenaReport summarizes arena sizing for debugging allocation failures.
+type ArenaReport struct {
+	Total   uintptr
+	Regions []RegionUsage
+}
+
+// HighWater returns the peak number of bytes used across all regions.
+func (r ArenaReport) HighWater() uintptr {
+	total := uintptr(0)
+	for _, region := range r.Regions {
+		total += region.HighWater
+	}
+	return total
+}
+
+// String renders the report as a table, one region per line.
+func (r ArenaReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "arena: %d bytes, peak %d (%.1f%%)\n", r.Total, r.HighWater(), percent(r.HighWater(), r.Total))
+	for _, region := range r.Regions {
+		fmt.Fprintf(&b, "  %-16s offset %8d  size %8d  used %8d  peak %8d (%.1f%%)\n",
+			region.Name, region.Offset, region.Size, region.Used, region.HighWater, percent(region.HighWater, region.Size))
+	}
+	return b.String()
+}
+
+// percent returns part as a percentage of whole.
+func percent(part, whole uintptr) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(whole)
+}
+
+// Report returns per-region usage and high-water marks. Fixed regions (model
+// payload, sublate metadata, worker shards) count as fully used; FreeTail
+// usage is what AllowGrowth lent to the node payload and scratch regions.
+func (a *Arena) Report() ArenaReport {
+	report := ArenaReport{Total: a.TotalSize()}
+	add := func(region ArenaRegion, used, high uintptr) {
+		if region.Size == 0 {
+			return
+		}
+		report.Regions = append(report.Regions, RegionUsage{
+			Name:      region.Name,
+			Offset:    region.Offset,
+			Size:      region.Size,
+			Used:      used,
+			HighWater: high,
+		})
+	}
+
+	add(a.modelPayload, a.modelPayload.Size, a.modelPayload.Size)
+	add(a.sublateMeta, a.sublateMeta.Size, a.sublateMeta.Size)
+	add(a.nodePayloads, a.currentNodePayloadOffset.Load()-a.nodePayloads.Offset, a.nodePayloadHighWater.Load())
+	add(a.scratch, a.currentScratchOffset.Load()-a.scratch.Offset, a.scratchHighWater.Load())
+	for _, shard := range a.workerShards {
+		add(shard, shard.Size, shard.Size)
+	}
+	add(a.streamingInput, a.streamingHighWater, a.streamingHighWater)
+	a.growth.mu.Lock()
+	add(a.freeTail, a.growth.low+a.growth.high, a.growth.peak)
+	a.growth.mu.Unlock()
+	return report
+}
+
+// Utilization returns the fraction of the arena covered by peak usage.
+func (a *Arena) Utilization() float64 {
+	if a == nil || a.TotalSize() == 0 {
+		return 0
+	}
+	report := a.Report()
+	return float64(report.HighWater()) / float64(report.Total)
+}
@@ -0,0 +1,198 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+)
+
+// RegionSize sizes one arena region, either in absolute bytes or as a share
+// of EngineOptions.ArenaSize. The zero value lets the engine pick the size.
+type RegionSize struct {
+	Bytes    uintptr // Absolute size; takes precedence over Fraction
+	Fraction float64 // Share of the arena in (0, 1]
+}
+
+// RegionBytes returns an absolute region size.
+func RegionBytes(n uintptr) RegionSize {
+	return RegionSize{Bytes: n}
+}
+
+// RegionFraction returns a region size proportional to the arena size.
+func RegionFraction(f float64) RegionSize {
+	return RegionSize{Fraction: f}
+}
+
+// IsAuto reports whether the region size is left to the engine.
+func (r RegionSize) IsAuto() bool {
+	return r.Bytes == 0 && r.Fraction == 0
+}
+
+// resolve converts the size into bytes for an arena of total bytes.
+func (r RegionSize) resolve(total uintptr) uintptr {
+	if r.Bytes > 0 {
+		return r.Bytes
+	}
+	return uintptr(r.Fraction * float64(total))
+}
+
+// validateRegionSizes rejects fractions outside (0, 1] and fractions that
+// have no arena size to be a share of.
+func (o *EngineOptions) validateRegionSizes() error {
+	regions := []struct {
+		name string
+		size RegionSize
+	}{
+		{"NodePayloadBytes", o.NodePayloadBytes},
+		{"ScratchBytes", o.ScratchBytes},
+		{"StreamingBytes", o.StreamingBytes},
+	}
+	for _, region := range regions {
+		if region.size.Bytes > 0 {
+			continue
+		}
+		f := region.size.Fraction
+		if f < 0 || f > 1 {
+			return fmt.Errorf("%s fraction %g must be in (0, 1]", region.name, f)
+		}
+		if f > 0 && o.ArenaSize == 0 {
+			return fmt.Errorf("%s fraction %g requires an explicit ArenaSize", region.name, f)
+		}
+	}
+	return nil
+}
+
+// arenaSizes holds the resolved sizes of the configurable arena regions.
+type arenaSizes struct {
+	scratch, streaming, nodePayloads uintptr
+	explicit                         bool // At least one size was set by the caller
+}
+
+// nodePayloadDemand returns the node payload bytes the graph needs: a Prev and
+// a Prop buffer per node, each rounded to a cache line as the allocator does.
+// Tied nodes share the buffers of the first node of their segment.
+func nodePayloadDemand(graph *model.Graph) uintptr {
+	total := uintptr(0)
+	for i, owner := range bufferOwners(graph) {
+		if owner != i {
+			continue
+		}
+		node := graph.Nodes[i]
+		total += 2 * core.AlignedSize(uintptr(calculateNodePayloadSize(&node, graph)))
+	}
+	return total
+}
+
+// streamingDemand returns the streaming window bytes the graph needs: the
+// data of its declared inputs, which ExecuteStreaming takes back to back,
+// and of its declared outputs, which shared-memory replies place after them
+func streamingDemand(graph *model.Graph) uintptr {
+	total := 0
+	for _, spec := range graph.IO {
+		total += spec.Bytes()
+	}
+	return uintptr(total)
+}
+
+// fixedArenaSize returns the bytes taken by the model payload and sublate metadata.
+func fixedArenaSize(graph *model.Graph) uintptr {
+	return calculateMinRequiredSize(graph, 0, 0, 0)
+}
+
+// EstimateArenaSize returns the arena size NewEngine allocates for graph
+// with opts, nil meaning DefaultEngineOptions: opts.ArenaSize when set,
+// otherwise the size derived from the model and the absolute region sizes
+func EstimateArenaSize(graph *model.Graph, opts *EngineOptions) uintptr {
+	o := DefaultEngineOptions()
+	if opts != nil {
+		o = *opts
+	}
+	if o.ArenaSize > 0 {
+		return o.ArenaSize
+	}
+	return max(calculateArenaSize(graph), explicitArenaSize(&o, graph))
+}
+
+// explicitArenaSize returns the smallest arena that holds the fixed regions,
+// the model's node payloads and every absolutely sized region.
+func explicitArenaSize(opts *EngineOptions, graph *model.Graph) uintptr {
+	size := fixedArenaSize(graph) + core.AlignedSize(max(opts.NodePayloadBytes.Bytes, nodePayloadDemand(graph)))
+	size += core.AlignedSize(opts.ScratchBytes.Bytes)
+	if opts.Streaming {
+		size += core.AlignedSize(opts.StreamingBytes.Bytes)
+		if opts.StreamingBytes.IsAuto() {
+			size += core.AlignedSize(streamingDemand(graph))
+		}
+	}
+	return core.AlignedSize(size)
+}
+
+// calculateArenaSizes resolves scratch, streaming and node payload sizes for
+// opts.ArenaSize. Explicit sizes are used as given and validated against the
+// model; the remaining regions split what is left, streaming and scratch
+// each taking a quarter (scratch takes half when there is no streaming window).
+// An automatic streaming window also gets the bytes of the declared inputs
+// and outputs up front, so a model whose other regions fill the arena can
+// still stream.
+func calculateArenaSizes(opts *EngineOptions, graph *model.Graph) (arenaSizes, error) {
+	total := opts.ArenaSize
+	sizes := arenaSizes{
+		explicit: !opts.NodePayloadBytes.IsAuto() || !opts.ScratchBytes.IsAuto() || !opts.StreamingBytes.IsAuto(),
+	}
+
+	demand := nodePayloadDemand(graph)
+	if opts.NodePayloadBytes.IsAuto() {
+		sizes.nodePayloads = demand
+	} else {
+		sizes.nodePayloads = opts.NodePayloadBytes.resolve(total)
+		if sizes.nodePayloads < demand {
+			return arenaSizes{}, fmt.Errorf("NodePayloadBytes of %d cannot hold the %d bytes of node payloads the model needs",
+				sizes.nodePayloads, demand)
+		}
+	}
+
+	streamingAuto := opts.StreamingBytes.IsAuto()
+	if opts.Streaming {
+		if streamingAuto {
+			sizes.streaming = core.AlignedSize(streamingDemand(graph))
+		} else {
+			sizes.streaming = opts.StreamingBytes.resolve(total)
+		}
+	}
+	if !opts.ScratchBytes.IsAuto() {
+		sizes.scratch = opts.ScratchBytes.resolve(total)
+	}
+
+	committed := fixedArenaSize(graph) + core.AlignedSize(sizes.nodePayloads) +
+		core.AlignedSize(sizes.scratch) + core.AlignedSize(sizes.streaming)
+	if committed > total {
+		if !sizes.explicit {
+			// Legacy behaviour for undersized automatic arenas: let NewArena
+			// report the shortfall or the caller fall back to a minimal layout
+			sizes.nodePayloads = min(sizes.nodePayloads, total/2)
+			return sizes, nil
+		}
+		return arenaSizes{}, fmt.Errorf("arena regions need %d bytes but ArenaSize is %d", committed, total)
+	}
+
+	free := total - committed
+	if streamingAuto && opts.Streaming {
+		sizes.streaming += alignDown(free / 4)
+	}
+	if opts.ScratchBytes.IsAuto() {
+		if streamingAuto && opts.Streaming {
+			sizes.scratch = alignDown(free / 4)
+		} else {
+			sizes.scratch = alignDown(free / 2)
+		}
+	}
+
+	return sizes, nil
+}
+
+// alignDown rounds size down to a cache line multiple so region padding
+// never pushes the layout past the arena end.
+func alignDown(size uintptr) uintptr {
+	return size &^ (core.CacheLineSize - 1)
+}
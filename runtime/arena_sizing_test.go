@@ -0,0 +1,31 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+func TestEstimateArenaSize(t *testing.T) {
+	t.Parallel()
+	g := &model.Graph{
+		Payload: make([]byte, 320),
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpReLU, In: 0, Out: 64},
+			{ID: 2, Kernel: kernels.OpSigmoid, In: 64, Out: 128, Topo: []uint32{1}},
+			{ID: 3, Kernel: kernels.OpReLU, In: 128, Out: 192, Topo: []uint32{1, 2}},
+			{ID: 4, Kernel: kernels.OpNoop, In: 192, Out: 256},
+		},
+	}
+	engine, err := NewEngine(g, nil)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if got, want := EstimateArenaSize(g, nil), uintptr(engine.ArenaBytes()); got != want {
+		t.Errorf("Expected the estimate to match the engine arena of %d bytes, got %d", want, got)
+	}
+	if got := EstimateArenaSize(g, &EngineOptions{ArenaSize: 1 << 20}); got != 1<<20 {
+		t.Errorf("Expected the explicit arena size, got %d", got)
+	}
+}
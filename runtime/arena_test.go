@@ -1,6 +1,8 @@
 package runtime
 
 import (
+	"errors"
+	"sync"
 	"testing"
 	"unsafe"
 
@@ -12,8 +14,8 @@ func TestNewArena(t *testing.T) {
 	graph := &model.Graph{
 		Payload: make([]byte, 1024),
 		Nodes: []model.Node{
-			{Kernel: 1, In: 0, Out: 256, Flags: 0x01, Topo: []uint16{1, 2, 0, 0}},
-			{Kernel: 2, In: 256, Out: 512, Flags: 0x02, Topo: []uint16{2, 1, 0, 0}},
+			{Kernel: 1, In: 0, Out: 256, Flags: 0x01, Topo: []uint32{1, 2, 0, 0}},
+			{Kernel: 2, In: 256, Out: 512, Flags: 0x02, Topo: []uint32{2, 1, 0, 0}},
 		},
 	}
 
@@ -153,12 +155,233 @@ func TestScratchAllocation(t *testing.T) {
 	}
 }
 
+func TestCarveWorkerShards(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 64),
+		Nodes:   []model.Node{{Kernel: 1}},
+	}
+
+	arena, err := NewArena(0, graph, 64, 0, 64*1024)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+
+	if err := arena.CarveWorkerShards(4, 4096); err != nil {
+		t.Fatalf("CarveWorkerShards failed: %v", err)
+	}
+	if arena.WorkerShardCount() != 4 {
+		t.Fatalf("Expected 4 shards, got %d", arena.WorkerShardCount())
+	}
+
+	scratch, _ := arena.Region("Scratch")
+	var prevEnd uintptr
+	for i := 0; i < 4; i++ {
+		shard, err := arena.WorkerShard(i)
+		if err != nil {
+			t.Fatalf("WorkerShard(%d) failed: %v", i, err)
+		}
+		start := uintptr(unsafe.Pointer(&shard[0]))
+		if start%4096 != 0 {
+			t.Errorf("Shard %d not page aligned: 0x%x", i, start)
+		}
+		if start < prevEnd {
+			t.Errorf("Shard %d overlaps previous shard", i)
+		}
+		prevEnd = start + uintptr(len(shard))
+	}
+
+	// The shared scratch allocator must not hand out shard memory
+	if _, err := arena.AllocateScratch(scratch.Size+1, 1); err == nil {
+		t.Error("Expected shared scratch to be limited to bytes before the shards")
+	}
+
+	if _, err := arena.WorkerShard(4); err == nil {
+		t.Error("Expected error for worker without a shard")
+	}
+	if err := arena.CarveWorkerShards(1<<20, 4096); err == nil {
+		t.Error("Expected error when shards cannot fit")
+	}
+}
+
+func TestConcurrentScratchAllocation(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 64),
+		Nodes:   []model.Node{{Kernel: 1}},
+	}
+
+	const workers, allocs, size = 8, 64, 16
+	arena, err := NewArena(0, graph, 64, 0, workers*allocs*size)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	bufs := make([][][]byte, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < allocs; i++ {
+				buf, err := arena.AllocateScratch(size, 8)
+				if err != nil {
+					t.Errorf("AllocateScratch failed: %v", err)
+					return
+				}
+				bufs[w] = append(bufs[w], buf)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Every allocation must own a distinct range of the region
+	seen := make(map[uintptr]bool)
+	for _, list := range bufs {
+		for _, buf := range list {
+			start := uintptr(unsafe.Pointer(&buf[0]))
+			if seen[start] {
+				t.Fatalf("Scratch offset 0x%x handed out twice", start)
+			}
+			seen[start] = true
+		}
+	}
+	if len(seen) != workers*allocs {
+		t.Errorf("Expected %d allocations, got %d", workers*allocs, len(seen))
+	}
+	if _, err := arena.AllocateScratch(size, 8); !errors.Is(err, ErrArenaExhausted) {
+		t.Errorf("Expected ErrArenaExhausted once the region is full, got %v", err)
+	}
+}
+
+func TestWorkerScratchAllocation(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 64),
+		Nodes:   []model.Node{{Kernel: 1}},
+	}
+
+	arena, err := NewArena(0, graph, 64, 0, 64*1024)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+	if err := arena.CarveWorkerShards(2, 4096); err != nil {
+		t.Fatalf("CarveWorkerShards failed: %v", err)
+	}
+
+	shard, _ := arena.WorkerShard(1)
+	buf, err := arena.AllocateWorkerScratch(1, 128, 64)
+	if err != nil {
+		t.Fatalf("AllocateWorkerScratch failed: %v", err)
+	}
+	if &buf[0] != &shard[0] {
+		t.Error("Expected first allocation at the start of the worker's shard")
+	}
+	if _, err := arena.AllocateWorkerScratch(1, uintptr(len(shard)), 64); !errors.Is(err, ErrArenaExhausted) {
+		t.Errorf("Expected ErrArenaExhausted, got %v", err)
+	}
+
+	arena.ResetWorkerScratch(1)
+	buf, err = arena.AllocateWorkerScratch(1, uintptr(len(shard)), 64)
+	if err != nil {
+		t.Fatalf("AllocateWorkerScratch after reset failed: %v", err)
+	}
+	if &buf[0] != &shard[0] {
+		t.Error("Expected reset to rewind the shard cursor")
+	}
+
+	if _, err := arena.AllocateWorkerScratch(2, 8, 8); err == nil {
+		t.Error("Expected error for worker without a shard")
+	}
+}
+
+func TestArenaReport(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 128),
+		Nodes:   make([]model.Node, 2),
+	}
+
+	arena, err := NewArena(8192, graph, 256, 256, 512)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+
+	if _, err := arena.AllocateScratch(200, 8); err != nil {
+		t.Fatalf("AllocateScratch failed: %v", err)
+	}
+	arena.ResetScratch()
+	if _, err := arena.AllocateScratch(64, 8); err != nil {
+		t.Fatalf("AllocateScratch failed: %v", err)
+	}
+
+	var scratch RegionUsage
+	for _, region := range arena.Report().Regions {
+		if region.Name == "Scratch" {
+			scratch = region
+		}
+	}
+	if scratch.Used != 64 {
+		t.Errorf("Expected 64 scratch bytes in use, got %d", scratch.Used)
+	}
+	if scratch.HighWater != 200 {
+		t.Errorf("Expected scratch high-water mark 200, got %d", scratch.HighWater)
+	}
+	if u := arena.Utilization(); u <= 0 || u >= 1 {
+		t.Errorf("Expected utilization in (0, 1), got %f", u)
+	}
+
+	_, err = arena.AllocateNodePayload(1024, 8)
+	var exhausted *ArenaExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("Expected ArenaExhaustedError, got %v", err)
+	}
+	if !errors.Is(err, ErrArenaExhausted) {
+		t.Error("Expected error to match ErrArenaExhausted")
+	}
+	if exhausted.Region != "NodePayloads" || exhausted.Requested != 1024 || exhausted.NodeID != -1 {
+		t.Errorf("Unexpected error details: %+v", exhausted)
+	}
+}
+
+func TestEngineReportsOverflowingNode(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128},
+			{ID: 2, Kernel: 1, In: 64, Out: 192},
+			{ID: 7, Kernel: 1, In: 128, Out: 224},
+		},
+	}
+
+	engine, err := createBaseEngine(graph, &EngineOptions{ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("createBaseEngine failed: %v", err)
+	}
+	// Room for the first three nodes' Prev and Prop buffers only
+	arena, err := NewArena(1<<16, graph, 2*(64+64+128), 0, 0)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+
+	err = engine.initializeSublates(graph, arena)
+	var exhausted *ArenaExhaustedError
+	if !errors.As(err, &exhausted) {
+		t.Fatalf("Expected ArenaExhaustedError, got %v", err)
+	}
+	if exhausted.NodeID != 7 {
+		t.Errorf("Expected overflow attributed to node 7, got %d", exhausted.NodeID)
+	}
+}
+
 func TestInitSublateInArena(t *testing.T) {
 	t.Parallel()
 	graph := &model.Graph{
 		Payload: []byte{1, 2, 3, 4, 5, 6, 7, 8},
 		Nodes: []model.Node{
-			{Kernel: 1, In: 0, Out: 4, Flags: 0x01, Topo: []uint16{1, 1, 0, 0}},
+			{Kernel: 1, In: 0, Out: 4, Flags: 0x01, Topo: []uint32{1, 1, 0, 0}},
 		},
 	}
 
@@ -282,3 +505,50 @@ func BenchmarkScratchAllocation(b *testing.B) {
 		}
 	}
 }
+
+func TestArenaRegionSizing(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 128},
+			{ID: 1, Kernel: 1, In: 128, Out: 256},
+		},
+	}
+
+	engine, err := NewEngine(graph, &EngineOptions{
+		ArenaSize:      1 << 16,
+		Streaming:      true,
+		ScratchBytes:   RegionBytes(8192),
+		StreamingBytes: RegionFraction(0.25),
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if r, _ := engine.arena.Region("Scratch"); r.Size != 8192 {
+		t.Errorf("Expected 8192-byte scratch region, got %d", r.Size)
+	}
+	if r, _ := engine.arena.Region("StreamingInput"); r.Size != 1<<14 {
+		t.Errorf("Expected %d-byte streaming region, got %d", 1<<14, r.Size)
+	}
+
+	auto, err := NewEngine(graph, &EngineOptions{Streaming: true, ScratchBytes: RegionBytes(1 << 20)})
+	if err != nil {
+		t.Fatalf("NewEngine with auto arena size failed: %v", err)
+	}
+	if r, _ := auto.arena.Region("Scratch"); r.Size != 1<<20 {
+		t.Errorf("Expected auto-sized arena to fit 1MiB scratch, got %d", r.Size)
+	}
+
+	invalid := []EngineOptions{
+		{ArenaSize: 1 << 16, NodePayloadBytes: RegionBytes(64)},
+		{ArenaSize: 4096, ScratchBytes: RegionBytes(1 << 16)},
+		{ArenaSize: 1 << 16, ScratchBytes: RegionFraction(1.5)},
+		{ScratchBytes: RegionFraction(0.5)},
+	}
+	for i := range invalid {
+		if _, err := NewEngine(graph, &invalid[i]); err == nil {
+			t.Errorf("Expected sizing error for case %d", i)
+		}
+	}
+}
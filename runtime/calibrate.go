@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"maps"
+	"math"
+	"sync"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// Calibrator is an Observer that records the range of the finite float32
+// values of every node's output after its kernel ran, over the executions
+// it watches. Running a model over calibration inputs gives the activation
+// ranges model.Graph.QuantizeInt8 takes.
+type Calibrator struct {
+	mu     sync.Mutex
+	ranges map[uint32]model.Range
+}
+
+// NewCalibrator creates a calibrator with no ranges
+func NewCalibrator() *Calibrator {
+	return &Calibrator{ranges: make(map[uint32]model.Range)}
+}
+
+// BeforeNode implements Observer.
+func (c *Calibrator) BeforeNode(NodeEvent) {}
+
+// AfterNode implements Observer.
+func (c *Calibrator) AfterNode(ev NodeEvent) {
+	var r model.Range
+	seen := false
+	for i := 0; i+4 <= len(ev.Output); i += 4 {
+		v := math.Float32frombits(binary.LittleEndian.Uint32(ev.Output[i:]))
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			continue
+		}
+		if !seen {
+			r, seen = model.Range{Min: v, Max: v}, true
+		}
+		r = r.Include(v)
+	}
+	if !seen {
+		return
+	}
+	c.mu.Lock()
+	if old, ok := c.ranges[ev.NodeID]; ok {
+		r = r.Union(old)
+	}
+	c.ranges[ev.NodeID] = r
+	c.mu.Unlock()
+}
+
+// AfterRun implements Observer.
+func (c *Calibrator) AfterRun(RunEvent) {}
+
+// Ranges returns the ranges recorded so far, keyed by node ID
+func (c *Calibrator) Ranges() map[uint32]model.Range {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.ranges)
+}
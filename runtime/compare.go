@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// Comparison reports how two engines differ over the same inputs. Outputs
+// are compared element-wise as float32 values.
+type Comparison struct {
+	Inputs   int // Inputs both engines ran
+	Elements int // Output values compared across all inputs
+
+	MaxAbsDiff     float64 // Largest |a-b|; +Inf when only one side is NaN or Inf
+	MeanAbsDiff    float64 // Mean |a-b| over the finite differences
+	MaxInput       int     // Input index of MaxAbsDiff
+	MaxElement     int     // Output element index of MaxAbsDiff
+	SizeMismatches int     // Inputs whose outputs differed in length; only the common prefix is compared
+
+	LatencyA, LatencyB LatencyPercentiles // Exact, over every input
+	MeanLatencyA       time.Duration
+	MeanLatencyB       time.Duration
+	LatencyDelta       time.Duration // MeanLatencyB - MeanLatencyA; negative when B is faster
+}
+
+// String summarises the comparison on one line.
+func (c *Comparison) String() string {
+	return fmt.Sprintf("%d inputs, %d values: max |diff| %g (input %d, element %d), mean |diff| %g, latency %v -> %v (delta %v)",
+		c.Inputs, c.Elements, c.MaxAbsDiff, c.MaxInput, c.MaxElement, c.MeanAbsDiff,
+		c.MeanLatencyA, c.MeanLatencyB, c.LatencyDelta)
+}
+
+// Compare runs engines a and b on each input in turn and reports the
+// element-wise output differences and latency deltas, for example to
+// validate a quantized or optimized variant against its float32 baseline.
+// Both engines must be configured for streaming; inputs go through
+// ExecuteStreaming, so they update the engines' stats like live traffic.
+func Compare(a, b *Engine, inputs [][]byte) (*Comparison, error) {
+	if a == nil || b == nil {
+		return nil, errors.New("compare requires two engines")
+	}
+
+	c := &Comparison{Inputs: len(inputs)}
+	outA := make([]byte, a.OutputSize())
+	outB := make([]byte, b.OutputSize())
+	timesA := make([]time.Duration, 0, len(inputs))
+	timesB := make([]time.Duration, 0, len(inputs))
+
+	var sum float64
+	var finite int
+	for i, input := range inputs {
+		d, err := timeStreaming(a, input, outA)
+		if err != nil {
+			return nil, fmt.Errorf("engine A, input %d: %w", i, err)
+		}
+		timesA = append(timesA, d)
+		if d, err = timeStreaming(b, input, outB); err != nil {
+			return nil, fmt.Errorf("engine B, input %d: %w", i, err)
+		}
+		timesB = append(timesB, d)
+
+		if len(outA) != len(outB) {
+			c.SizeMismatches++
+		}
+		va, vb := asFloat32(outA), asFloat32(outB)
+		for j := range min(len(va), len(vb)) {
+			diff := absDiff(va[j], vb[j])
+			c.Elements++
+			if !math.IsInf(diff, 0) {
+				sum += diff
+				finite++
+			}
+			if diff > c.MaxAbsDiff {
+				c.MaxAbsDiff, c.MaxInput, c.MaxElement = diff, i, j
+			}
+		}
+	}
+
+	if finite > 0 {
+		c.MeanAbsDiff = sum / float64(finite)
+	}
+	c.LatencyA, c.MeanLatencyA = exactPercentiles(timesA)
+	c.LatencyB, c.MeanLatencyB = exactPercentiles(timesB)
+	c.LatencyDelta = c.MeanLatencyB - c.MeanLatencyA
+	return c, nil
+}
+
+// timeStreaming runs one streaming request and returns its wall time.
+func timeStreaming(e *Engine, input, output []byte) (time.Duration, error) {
+	start := time.Now()
+	err := e.ExecuteStreaming(input, output)
+	return time.Since(start), err
+}
+
+// absDiff returns |a-b|. Matching NaNs or infinities count as equal; a
+// special value on only one side is an infinite difference.
+func absDiff(a, b float32) float64 {
+	x, y := float64(a), float64(b)
+	switch {
+	case math.IsNaN(x) || math.IsNaN(y):
+		if math.IsNaN(x) && math.IsNaN(y) {
+			return 0
+		}
+		return math.Inf(1)
+	case math.IsInf(x, 0) || math.IsInf(y, 0):
+		if x == y {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(x - y)
+}
+
+// exactPercentiles returns the nearest-rank percentiles and mean of times.
+func exactPercentiles(times []time.Duration) (LatencyPercentiles, time.Duration) {
+	if len(times) == 0 {
+		return LatencyPercentiles{}, 0
+	}
+	sorted := slices.Clone(times)
+	slices.Sort(sorted)
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return LatencyPercentiles{P50: nearestRank(sorted, 0.50), P95: nearestRank(sorted, 0.95), P99: nearestRank(sorted, 0.99)},
+		total / time.Duration(len(sorted))
+}
@@ -0,0 +1,75 @@
+package runtime
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	newEngine := func(kernel uint8) *Engine {
+		graph := memoGraph()
+		for i := range graph.Nodes {
+			graph.Nodes[i].Kernel = kernel
+		}
+		engine, err := NewEngine(graph, &EngineOptions{Workers: 1, ArenaSize: 1 << 16, Streaming: true})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		return engine
+	}
+	inputs := make([][]byte, 4)
+	for i := range inputs {
+		inputs[i] = make([]byte, 16)
+	}
+
+	same, err := Compare(newEngine(1), newEngine(1), inputs)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if same.MaxAbsDiff != 0 || same.Elements != 4*16 || same.Inputs != 4 {
+		t.Errorf("Expected identical outputs over 64 values, got %v", same)
+	}
+	if same.LatencyA.P99 == 0 || same.MeanLatencyB == 0 {
+		t.Errorf("Expected latencies to be measured, got %v", same)
+	}
+
+	// Square-plus-x against ReLU on positive data: x*x+x - x = x*x
+	diff, err := Compare(newEngine(1), newEngine(3), inputs)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if diff.MaxAbsDiff == 0 || diff.MeanAbsDiff == 0 || diff.MeanAbsDiff > diff.MaxAbsDiff {
+		t.Errorf("Expected differing outputs, got %v", diff)
+	}
+
+	if _, err := Compare(newEngine(1), nil, inputs); err == nil {
+		t.Error("Expected error comparing against a nil engine")
+	}
+	resident, _ := NewEngine(&model.Graph{Nodes: []model.Node{{Kernel: 1}}}, &EngineOptions{Workers: 1, ArenaSize: 1 << 16})
+	if _, err := Compare(newEngine(1), resident, inputs); err == nil {
+		t.Error("Expected error comparing against a non-streaming engine")
+	}
+}
+
+func TestAbsDiff(t *testing.T) {
+	t.Parallel()
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	cases := []struct {
+		a, b float32
+		want float64
+	}{
+		{1, 1.5, 0.5},
+		{nan, nan, 0},
+		{inf, inf, 0},
+		{nan, 1, math.Inf(1)},
+		{inf, -inf, math.Inf(1)},
+	}
+	for _, c := range cases {
+		if got := absDiff(c.a, c.b); got != c.want {
+			t.Errorf("absDiff(%v, %v): expected %v, got %v", c.a, c.b, c.want, got)
+		}
+	}
+}
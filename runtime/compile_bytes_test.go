@@ -0,0 +1,80 @@
+package runtime
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/model"
+)
+
+func TestCompileBytes(t *testing.T) {
+	t.Parallel()
+	spec := "tensor x f32[8] input\nnode h = relu(x)\nnode y = sigmoid(h)\noutput y\n"
+	opts := compiler.DefaultOptions()
+	g, err := compiler.CompileBytes([]byte(spec), opts)
+	if err != nil {
+		t.Fatalf("CompileBytes failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := compiler.EmitBinary(g, &buf, opts); err != nil {
+		t.Fatalf("EmitBinary failed: %v", err)
+	}
+	if g.Debug == nil {
+		t.Errorf("Expected EmitBinary to leave the graph's debug symbols alone")
+	}
+
+	// The same bytes as compiling a file
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	out := filepath.Join(dir, "m.subl")
+	if _, err := compiler.CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("CompileWithOptions failed: %v", err)
+	}
+	want, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Expected EmitBinary to write the %d bytes CompileWithOptions writes, got %d", len(want), buf.Len())
+	}
+	engine, err := NewEngine(mustDeserialize(t, buf.Bytes()), &EngineOptions{Workers: 1, ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// JSON sources and output
+	opts.Emit = compiler.FormatJSON
+	buf.Reset()
+	if err := compiler.EmitBinary(g, &buf, opts); err != nil {
+		t.Fatalf("EmitBinary failed: %v", err)
+	}
+	opts.From, opts.Emit = compiler.FormatJSON, compiler.FormatNative
+	if g2, err := compiler.CompileBytes(buf.Bytes(), opts); err != nil || len(g2.Nodes) != len(g.Nodes) {
+		t.Errorf("Expected the JSON output to compile back to %d nodes, got %v", len(g.Nodes), err)
+	}
+
+	_, err = compiler.CompileBytes([]byte("node y = sigmoid(hh)\n"), compiler.DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "line:1:18: node y: undefined node hh") {
+		t.Errorf("Expected a positioned error, got %v", err)
+	}
+}
+
+// mustDeserialize decodes a compiled model
+func mustDeserialize(t *testing.T, data []byte) *model.Graph {
+	t.Helper()
+	g, err := model.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	return g
+}
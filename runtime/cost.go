@@ -0,0 +1,68 @@
+package runtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// CostProfiler is an Observer that measures the mean kernel time of every
+// node over the executions it watches. Apply records the measurements in a
+// graph, so saving it gives schedulers measured instead of estimated costs.
+type CostProfiler struct {
+	mu    sync.Mutex
+	total map[uint32]time.Duration
+	calls map[uint32]int
+}
+
+// NewCostProfiler creates a profiler with no measurements
+func NewCostProfiler() *CostProfiler {
+	return &CostProfiler{total: make(map[uint32]time.Duration), calls: make(map[uint32]int)}
+}
+
+// BeforeNode implements Observer.
+func (p *CostProfiler) BeforeNode(NodeEvent) {}
+
+// AfterNode implements Observer.
+func (p *CostProfiler) AfterNode(ev NodeEvent) {
+	p.mu.Lock()
+	p.total[ev.NodeID] += ev.Duration
+	p.calls[ev.NodeID]++
+	p.mu.Unlock()
+}
+
+// AfterRun implements Observer.
+func (p *CostProfiler) AfterRun(RunEvent) {}
+
+// Mean returns the mean kernel time of node id; ok is false when the node
+// never ran
+func (p *CostProfiler) Mean(id uint32) (mean time.Duration, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := p.calls[id]
+	if n == 0 {
+		return 0, false
+	}
+	return p.total[id] / time.Duration(n), true
+}
+
+// Apply sets the measured duration of every profiled node of g, keeping
+// estimated FLOPs and bytes, and returns the number of nodes updated
+func (p *CostProfiler) Apply(g *model.Graph) int {
+	if g.Costs == nil {
+		g.Costs = make(map[uint32]model.NodeCost)
+	}
+	updated := 0
+	for _, n := range g.Nodes {
+		mean, ok := p.Mean(n.ID)
+		if !ok {
+			continue
+		}
+		c := g.Costs[n.ID]
+		c.Nanos = max(uint64(mean.Nanoseconds()), 1) // 0 means not profiled
+		g.Costs[n.ID] = c
+		updated++
+	}
+	return updated
+}
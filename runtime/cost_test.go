@@ -0,0 +1,77 @@
+package runtime
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestCostModel(t *testing.T) {
+	t.Parallel()
+	graph := shapeGraph(3)
+	if err := graph.InferShapes(); err != nil {
+		t.Fatalf("InferShapes failed: %v", err)
+	}
+	graph.EstimateCosts()
+	want := map[uint32]model.NodeCost{
+		0: {Bytes: 24 + 24},
+		1: {FLOPs: 6, Bytes: 24 + 24},
+		2: {FLOPs: 2 * 2 * 3 * 4, Bytes: 80 + 24 + 32},
+		3: {FLOPs: 8, Bytes: 32 + 4},
+	}
+	if !maps.Equal(graph.Costs, want) {
+		t.Errorf("Expected costs %v, got %v", want, graph.Costs)
+	}
+
+	// Costs survive both encodings
+	data, err := graph.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if g, err := model.Deserialize(data); err != nil || !maps.Equal(g.Costs, want) {
+		t.Errorf("Expected costs to round-trip, got %v (%v)", g.Costs, err)
+	}
+	gob, err := graph.SerializeGob()
+	if err != nil {
+		t.Fatalf("SerializeGob failed: %v", err)
+	}
+	if g, err := model.DeserializeGob(gob); err != nil || !maps.Equal(g.Costs, want) {
+		t.Errorf("Expected costs to round-trip through gob, got %v (%v)", g.Costs, err)
+	}
+
+	// A profiling run records measured times, which estimates keep
+	engine, err := NewEngine(graph, &EngineOptions{ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	profiler := NewCostProfiler()
+	engine.AddObserver(profiler)
+	if err := engine.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if n := profiler.Apply(graph); n != len(graph.Nodes) {
+		t.Errorf("Expected every node profiled, got %d", n)
+	}
+	graph.EstimateCosts()
+	for id, c := range graph.Costs {
+		if c.Nanos == 0 || c.Weight() != c.Nanos || c.FLOPs != want[id].FLOPs {
+			t.Errorf("node %d: expected a measured weight and estimated FLOPs, got %+v", id, c)
+		}
+	}
+
+	// Ready nodes start costliest critical path first
+	fanout := &model.Graph{
+		Nodes: []model.Node{
+			{ID: 0}, {ID: 1}, {ID: 2, Topo: []uint32{1}}, {ID: 3},
+		},
+		Costs: map[uint32]model.NodeCost{0: {FLOPs: 10}, 1: {FLOPs: 5}, 2: {FLOPs: 8}, 3: {Nanos: 20}},
+	}
+	s, err := NewStreamScheduler(fanout, 2)
+	if err != nil {
+		t.Fatalf("NewStreamScheduler failed: %v", err)
+	}
+	if roots := [3]uint32{fanout.Nodes[s.roots[0]].ID, fanout.Nodes[s.roots[1]].ID, fanout.Nodes[s.roots[2]].ID}; roots != [3]uint32{3, 1, 0} {
+		t.Errorf("Expected roots [3 1 0], got %v", roots)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build amd64
+
+package runtime
+
+import "github.com/sbl8/sublation/model"
+
+// Implemented in cpu_amd64.s
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func xgetbv() (eax, edx uint32)
+
+// detectTarget reads the CPUID feature bits and, through XGETBV, whether
+// the OS saves the AVX and AVX-512 register state
+func detectTarget() model.Target {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return model.TargetGeneric
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	if ecx1&(1<<27) == 0 { // OSXSAVE
+		return model.TargetGeneric
+	}
+	xcr0, _ := xgetbv()
+	_, ebx7, _, _ := cpuid(7, 0)
+	avx := ecx1&(1<<28) != 0 && xcr0&0x6 == 0x6
+	switch {
+	case avx && ebx7&(1<<16) != 0 && xcr0&0xE6 == 0xE6: // AVX-512F, opmask and ZMM state
+		return model.TargetAVX512
+	case avx && ebx7&(1<<5) != 0 && ecx1&(1<<12) != 0: // AVX2 and FMA
+		return model.TargetAVX2
+	}
+	return model.TargetGeneric
+}
@@ -0,0 +1,8 @@
+//go:build arm64
+
+package runtime
+
+import "github.com/sbl8/sublation/model"
+
+// detectTarget returns neon, which every arm64 CPU implements
+func detectTarget() model.Target { return model.TargetNEON }
@@ -0,0 +1,8 @@
+//go:build !amd64 && !arm64
+
+package runtime
+
+import "github.com/sbl8/sublation/model"
+
+// detectTarget returns generic, the only profile for this architecture
+func detectTarget() model.Target { return model.TargetGeneric }
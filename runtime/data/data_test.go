@@ -0,0 +1,286 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// pairFields are the fields of the test samples: x of two values, y of one
+var pairFields = []model.IOSpec{
+	{Name: "x", Kind: model.Input, DType: model.Float32, Shape: []int{2}},
+	{Name: "y", Kind: model.Input, DType: model.Float32, Shape: []int{1}},
+}
+
+func floats(vs ...float32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+	}
+	return b
+}
+
+func values(t ioutil.Tensor) []float32 {
+	vs := make([]float32, len(t.Data)/4)
+	for i := range vs {
+		vs[i] = math.Float32frombits(binary.LittleEndian.Uint32(t.Data[4*i:]))
+	}
+	return vs
+}
+
+// pairs returns n records of x = (i, -i) and y = 10i, 0 - i keeping the
+// first a positive zero as text and .npy sources read it
+func pairs(n int) []byte {
+	var b []byte
+	for i := range n {
+		v := float32(i)
+		b = append(b, floats(v, 0-v, 10*v)...)
+	}
+	return b
+}
+
+// readAll reads every record of src
+func readAll(t *testing.T, src Source) [][]byte {
+	t.Helper()
+	var records [][]byte
+	for i := range src.Len() {
+		record := make([]byte, RecordSize(src.Fields()))
+		if err := src.Read(i, record); err != nil {
+			t.Fatalf("Read(%d) failed: %v", i, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestSources(t *testing.T) {
+	t.Parallel()
+	want := pairs(3)
+	records, err := NewRecords(bytes.NewReader(want), int64(len(want)), pairFields)
+	if err != nil {
+		t.Fatalf("NewRecords failed: %v", err)
+	}
+	csv, err := NewCSV(strings.NewReader("x0,x1,y\r\n# comment\n0,0,0\n\n1 -1 10\r\n2,-2,20"), 48, pairFields)
+	if err != nil {
+		t.Fatalf("NewCSV failed: %v", err)
+	}
+
+	var x, y bytes.Buffer
+	if err := ioutil.WriteNPY(&x, ioutil.Tensor{DType: model.Float32, Shape: []int{3, 2}, Data: floats(0, 0, 1, -1, 2, -2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteNPY(&y, ioutil.Tensor{DType: model.Float32, Shape: []int{3, 1}, Data: floats(0, 10, 20)}); err != nil {
+		t.Fatal(err)
+	}
+	nx, err := NewNPY(bytes.NewReader(x.Bytes()), "x")
+	if err != nil {
+		t.Fatalf("NewNPY failed: %v", err)
+	}
+	ny, err := NewNPY(bytes.NewReader(y.Bytes()), "y")
+	if err != nil {
+		t.Fatalf("NewNPY failed: %v", err)
+	}
+	// Zipped in the wrong order, then matched to the fields
+	zipped, err := Zip(ny, nx)
+	if err != nil {
+		t.Fatalf("Zip failed: %v", err)
+	}
+	npy, err := Match(zipped, pairFields)
+	if err != nil {
+		t.Fatalf("Match failed: %v", err)
+	}
+
+	for name, src := range map[string]Source{"records": records, "csv": csv, "npy": npy} {
+		if src.Len() != 3 || !slices.EqualFunc(src.Fields(), pairFields, func(a, b model.IOSpec) bool { return a.String() == b.String() }) {
+			t.Errorf("%s: got %d samples of %v", name, src.Len(), src.Fields())
+			continue
+		}
+		if got := bytes.Join(readAll(t, src), nil); !bytes.Equal(got, want) {
+			t.Errorf("%s: read %v, want %v", name, got, want)
+		}
+		if err := src.Read(3, make([]byte, 12)); err == nil {
+			t.Errorf("%s: Read past the end succeeded", name)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := NewRecords(bytes.NewReader(make([]byte, 13)), 13, pairFields); err == nil {
+		t.Error("NewRecords of a partial record succeeded")
+	}
+	csv, err := NewCSV(strings.NewReader("1,2\n1,2,x\n"), 10, pairFields)
+	if err != nil {
+		t.Fatalf("NewCSV failed: %v", err)
+	}
+	record := make([]byte, 12)
+	if err := csv.Read(0, record); err == nil || !strings.Contains(err.Error(), "line 1: got 2 values, want 3") {
+		t.Errorf("Expected a value count error for line 1, got %v", err)
+	}
+	if err := csv.Read(1, record); err == nil || !strings.Contains(err.Error(), `line 2: invalid number "x"`) {
+		t.Errorf("Expected an invalid number on line 2, got %v", err)
+	}
+
+	a, _ := NewRecords(bytes.NewReader(pairs(2)), 24, pairFields)
+	b, _ := NewRecords(bytes.NewReader(pairs(3)), 36, pairFields[1:])
+	if _, err := Zip(a, b); err == nil {
+		t.Error("Zip of sources of different lengths succeeded")
+	}
+	if _, err := Zip(a, a); err == nil {
+		t.Error("Zip of duplicate fields succeeded")
+	}
+	int8x := []model.IOSpec{{Name: "x", DType: model.Int8, Shape: []int{2}}}
+	if _, err := Match(a, int8x); err == nil || !strings.Contains(err.Error(), "input takes") {
+		t.Errorf("Expected a dtype mismatch, got %v", err)
+	}
+	if _, err := Match(a, []model.IOSpec{{Name: "z", DType: model.Float32}}); err == nil {
+		t.Error("Match of a missing field succeeded")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+	src, _ := NewRecords(bytes.NewReader(pairs(10)), 120, pairFields)
+	train, held := Split(src, 0.2)
+	if train.Len() != 8 || held.Len() != 2 {
+		t.Fatalf("Split 0.2 of 10 gave %d and %d samples", train.Len(), held.Len())
+	}
+	if got := readAll(t, held); !bytes.Equal(got[0], pairs(10)[8*12:9*12]) {
+		t.Errorf("held out sample 0 = %v, want sample 8", got[0])
+	}
+}
+
+// epoch collects the y of every sample of an epoch of l
+func epoch(t *testing.T, l *Loader) (ys []float32, batches int) {
+	t.Helper()
+	if err := l.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		batch, err := l.Next()
+		if errors.Is(err, io.EOF) {
+			return ys, batches
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		for _, s := range batch {
+			if x := values(s["x"]); x[0] != -x[1] {
+				t.Fatalf("got x %v", x)
+			}
+			ys = append(ys, values(s["y"])...)
+		}
+		batches++
+	}
+}
+
+func TestLoader(t *testing.T) {
+	t.Parallel()
+	src, _ := NewRecords(bytes.NewReader(pairs(10)), 120, pairFields)
+	l, err := NewLoader(src, Options{BatchSize: 4})
+	if err != nil {
+		t.Fatalf("NewLoader failed: %v", err)
+	}
+	ys, batches := epoch(t, l)
+	if batches != 3 || !slices.Equal(ys, []float32{0, 10, 20, 30, 40, 50, 60, 70, 80, 90}) {
+		t.Errorf("got %d batches of %v, want the samples in order in 3", batches, ys)
+	}
+	if p := l.Progress(); p != (Progress{Epoch: 1, Batches: 3, Samples: 10, Total: 10}) {
+		t.Errorf("got progress %+v", p)
+	}
+
+	shuffled := func(seed uint64) [][]float32 {
+		l, err := NewLoader(src, Options{BatchSize: 4, Shuffle: true, DropLast: true, Seed: seed})
+		if err != nil {
+			t.Fatalf("NewLoader failed: %v", err)
+		}
+		var epochs [][]float32
+		for range 3 {
+			ys, batches := epoch(t, l)
+			if batches != 2 || len(ys) != 8 {
+				t.Fatalf("got %d batches of %v, want the 2 full batches", batches, ys)
+			}
+			epochs = append(epochs, ys)
+		}
+		if p := l.Progress(); p.Epoch != 3 || p.Total != 8 {
+			t.Errorf("got progress %+v, want 3 epochs of 8 samples", p)
+		}
+		return epochs
+	}
+	a, b := shuffled(1), shuffled(1)
+	if !slices.EqualFunc(a, b, slices.Equal) {
+		t.Errorf("equal seeds gave orders %v and %v", a, b)
+	}
+	if slices.Equal(a[0], a[1]) || slices.Equal(a[0], ys[:8]) {
+		t.Errorf("Expected a new order every epoch, got %v", a)
+	}
+}
+
+func TestLoaderBuffer(t *testing.T) {
+	t.Parallel()
+	src, _ := NewRecords(bytes.NewReader(pairs(4)), 48, pairFields)
+	window := make([]byte, 30)
+	if _, err := NewLoader(src, Options{BatchSize: 3, Buffer: window}); !errors.Is(err, runtime.ErrInputTooLarge) {
+		t.Errorf("Expected ErrInputTooLarge for 36 bytes in a 30-byte buffer, got %v", err)
+	}
+	l, err := NewLoader(src, Options{BatchSize: 2, Buffer: window})
+	if err != nil {
+		t.Fatalf("NewLoader failed: %v", err)
+	}
+	batch, err := l.Next()
+	if err != nil || len(batch) != 2 {
+		t.Fatalf("Next = %d samples, %v", len(batch), err)
+	}
+	if !bytes.Equal(window[:24], pairs(2)) {
+		t.Errorf("Expected the batch in the buffer, got %v", window[:24])
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	var x, y bytes.Buffer
+	if err := ioutil.WriteNPY(&x, ioutil.Tensor{DType: model.Float32, Shape: []int{3, 2}, Data: floats(0, 0, 1, -1, 2, -2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteNPY(&y, ioutil.Tensor{DType: model.Float32, Shape: []int{3, 1}, Data: floats(0, 10, 20)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, paths := range [][]string{
+		{write("train.bin", pairs(3))},
+		{write("train.csv", []byte("0,0,0\n1,-1,10\n2,-2,20\n"))},
+		{write("y.npy", y.Bytes()), write("x.npy", x.Bytes())},
+	} {
+		f, err := Open(pairFields, paths...)
+		if err != nil {
+			t.Fatalf("Open(%v) failed: %v", paths, err)
+		}
+		if got := bytes.Join(readAll(t, f), nil); !bytes.Equal(got, pairs(3)) {
+			t.Errorf("Open(%v) read %v", paths, got)
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	}
+	if _, err := Open(pairFields, filepath.Join(dir, "train.csv"), filepath.Join(dir, "y.npy")); err == nil {
+		t.Error("Open of a csv file with an array succeeded")
+	}
+}
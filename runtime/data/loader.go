@@ -0,0 +1,140 @@
+// Package data feeds datasets to training and evaluation loops. A Source
+// reads the samples of a dataset by index from CSV text, .npy arrays or
+// files of fixed-size binary records, loading one sample at a time rather
+// than the whole file. A Loader visits the samples of a source in batches,
+// shuffled anew every epoch if asked, reading each batch into one buffer,
+// such as the engine's streaming window, and counts the epochs and batches
+// it has served. A Loader is a trainer.Dataset.
+package data
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// Sample is the tensors of one sample, by field name
+type Sample map[string]ioutil.Tensor
+
+// Options configures a Loader
+type Options struct {
+	BatchSize int    // Samples per batch; 1 when 0
+	Shuffle   bool   // Visit the samples in a new random order every epoch
+	Seed      uint64 // Seed of the shuffle; equal seeds repeat the orders epoch by epoch
+	DropLast  bool   // Skip the last batch of an epoch when it is short
+	// Buffer holds the batch being served, such as the memory of
+	// Engine.StreamingWindow; nil allocates it
+	Buffer []byte
+}
+
+// Progress is how far a Loader is through its epochs
+type Progress struct {
+	Epoch   int // Completed epochs
+	Batches int // Batches served in the current epoch
+	Samples int // Samples served in the current epoch
+	Total   int // Samples an epoch serves
+}
+
+// Loader serves the samples of a Source in batches. It is not safe for
+// concurrent use.
+type Loader struct {
+	src    Source
+	opts   Options
+	fields []model.IOSpec
+	record int
+	order  []int
+	pos    int
+	done   bool
+	prog   Progress
+	buf    []byte
+	batch  []Sample
+}
+
+// NewLoader returns a Loader over src. A batch of opts.BatchSize records
+// must fit opts.Buffer, or NewLoader fails with a runtime.InputTooLargeError.
+func NewLoader(src Source, opts Options) (*Loader, error) {
+	opts.BatchSize = max(opts.BatchSize, 1)
+	l := &Loader{src: src, opts: opts, fields: src.Fields(), record: RecordSize(src.Fields())}
+	size := opts.BatchSize * l.record
+	switch {
+	case opts.Buffer == nil:
+		l.buf = make([]byte, size)
+	case len(opts.Buffer) < size:
+		return nil, fmt.Errorf("data: batch of %d samples: %w", opts.BatchSize, &runtime.InputTooLargeError{Size: size, Limit: len(opts.Buffer)})
+	default:
+		l.buf = opts.Buffer[:size]
+	}
+	l.prog.Total = src.Len()
+	if opts.DropLast {
+		l.prog.Total -= l.prog.Total % opts.BatchSize
+	}
+	l.order = make([]int, src.Len())
+	l.rewind()
+	return l, nil
+}
+
+// Fields returns the tensors of every sample
+func (l *Loader) Fields() []model.IOSpec {
+	return l.fields
+}
+
+// Progress returns how far the loader is through its epochs
+func (l *Loader) Progress() Progress {
+	return l.prog
+}
+
+// Next returns the next batch of the epoch, or io.EOF after the last,
+// which completes the epoch. The batch and its tensors are only valid
+// until the next call to Next or Reset, which reuse their memory.
+func (l *Loader) Next() ([]Sample, error) {
+	n := min(l.opts.BatchSize, len(l.order)-l.pos)
+	if n <= 0 || (l.opts.DropLast && n < l.opts.BatchSize) {
+		if !l.done {
+			l.done = true
+			l.prog.Epoch++
+		}
+		return nil, io.EOF
+	}
+	l.batch = l.batch[:0]
+	for k := range n {
+		record := l.buf[k*l.record : (k+1)*l.record]
+		if err := l.src.Read(l.order[l.pos+k], record); err != nil {
+			return nil, fmt.Errorf("data: %w", err)
+		}
+		sample := make(Sample, len(l.fields))
+		for _, f := range l.fields {
+			sample[f.Name] = ioutil.Tensor{DType: f.DType, Shape: f.Shape, Data: record[:f.Bytes():f.Bytes()]}
+			record = record[f.Bytes():]
+		}
+		l.batch = append(l.batch, sample)
+	}
+	l.pos += n
+	l.prog.Batches++
+	l.prog.Samples += n
+	return l.batch, nil
+}
+
+// Reset rewinds to the first batch, starting another epoch, in a new order
+// when shuffling. Resetting before the last batch abandons the epoch
+// without completing it.
+func (l *Loader) Reset() error {
+	l.rewind()
+	return nil
+}
+
+// rewind orders the samples of the epoch after the completed ones
+func (l *Loader) rewind() {
+	for i := range l.order {
+		l.order[i] = i
+	}
+	if l.opts.Shuffle {
+		rng := rand.New(rand.NewPCG(l.opts.Seed, uint64(l.prog.Epoch)))
+		rng.Shuffle(len(l.order), func(i, j int) { l.order[i], l.order[j] = l.order[j], l.order[i] })
+	}
+	l.pos, l.done = 0, false
+	l.prog.Batches, l.prog.Samples = 0, 0
+}
@@ -0,0 +1,450 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// Source reads the samples of a dataset by index. Every sample holds one
+// tensor per field, laid out as a record of the fields' data back to back
+// in field order.
+type Source interface {
+	// Fields returns the tensors of a sample, in record order
+	Fields() []model.IOSpec
+	// Len returns the number of samples
+	Len() int
+	// Read writes the record of sample i to dst, which holds RecordSize bytes
+	Read(i int, dst []byte) error
+}
+
+// RecordSize returns the bytes of one record of fields
+func RecordSize(fields []model.IOSpec) int {
+	n := 0
+	for _, f := range fields {
+		n += f.Bytes()
+	}
+	return n
+}
+
+// checkIndex rejects a sample index outside [0, n)
+func checkIndex(i, n int) error {
+	if i < 0 || i >= n {
+		return fmt.Errorf("sample %d out of range [0, %d)", i, n)
+	}
+	return nil
+}
+
+// Records reads fixed-size binary records, each the little-endian data of
+// its fields back to back, as ioutil.Tensor holds it
+type Records struct {
+	r      io.ReaderAt
+	fields []model.IOSpec
+	size   int
+	n      int
+}
+
+// NewRecords reads the records of fields from the size bytes of r, which
+// must hold a whole number of them
+func NewRecords(r io.ReaderAt, size int64, fields []model.IOSpec) (*Records, error) {
+	rec := RecordSize(fields)
+	if rec == 0 {
+		return nil, errors.New("records: fields hold no data")
+	}
+	if size%int64(rec) != 0 {
+		return nil, fmt.Errorf("records: %d bytes are not a whole number of %d-byte records", size, rec)
+	}
+	return &Records{r: r, fields: fields, size: rec, n: int(size / int64(rec))}, nil
+}
+
+// Fields implements Source.
+func (s *Records) Fields() []model.IOSpec { return s.fields }
+
+// Len implements Source.
+func (s *Records) Len() int { return s.n }
+
+// Read implements Source.
+func (s *Records) Read(i int, dst []byte) error {
+	if err := checkIndex(i, s.n); err != nil {
+		return fmt.Errorf("records: %w", err)
+	}
+	if _, err := s.r.ReadAt(dst[:s.size], int64(i)*int64(s.size)); err != nil {
+		return fmt.Errorf("records: sample %d: %w", i, err)
+	}
+	return nil
+}
+
+// NPY reads the samples of a .npy array along its leading dimension, each
+// the slice of the remaining dimensions
+type NPY struct {
+	r      io.ReaderAt
+	fields []model.IOSpec
+	offset int64
+	n      int
+}
+
+// NewNPY reads the .npy array of r as the samples of the field name. Only
+// the header is read up front; Read loads one slice at a time.
+func NewNPY(r io.ReaderAt, name string) (*NPY, error) {
+	t, offset, err := ioutil.ReadNPYHeader(io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Shape) == 0 {
+		return nil, fmt.Errorf("npy: %s: a scalar has no samples", name)
+	}
+	spec := model.IOSpec{Name: name, Kind: model.Input, DType: t.DType, Shape: t.Shape[1:]}
+	return &NPY{r: r, fields: []model.IOSpec{spec}, offset: offset, n: t.Shape[0]}, nil
+}
+
+// Fields implements Source.
+func (s *NPY) Fields() []model.IOSpec { return s.fields }
+
+// Len implements Source.
+func (s *NPY) Len() int { return s.n }
+
+// Read implements Source.
+func (s *NPY) Read(i int, dst []byte) error {
+	if err := checkIndex(i, s.n); err != nil {
+		return fmt.Errorf("npy: %s: %w", s.fields[0].Name, err)
+	}
+	size := s.fields[0].Bytes()
+	if _, err := s.r.ReadAt(dst[:size], s.offset+int64(i)*int64(size)); err != nil {
+		return fmt.Errorf("npy: %s: sample %d: %w", s.fields[0].Name, i, err)
+	}
+	return nil
+}
+
+// CSV reads one sample per line of numbers separated by commas, spaces or
+// tabs, shared out among the fields in order as ioutil.ParseCSV does.
+// Lines starting with '#' are comments, and a first line that is not all
+// numbers is a header of column names.
+type CSV struct {
+	r      io.ReaderAt
+	fields []model.IOSpec
+	lines  []csvLine
+}
+
+// csvLine locates the text of one sample
+type csvLine struct {
+	offset int64
+	length int
+	number int
+}
+
+// NewCSV indexes the lines of the size bytes of r as samples of fields;
+// their values are only parsed when read
+func NewCSV(r io.ReaderAt, size int64, fields []model.IOSpec) (*CSV, error) {
+	s := &CSV{r: r, fields: fields}
+	sc := bufio.NewScanner(io.NewSectionReader(r, 0, size))
+	sc.Buffer(nil, 1<<24)
+	sc.Split(rawLines)
+	var offset int64
+	for number := 1; sc.Scan(); number++ {
+		line := sc.Bytes()
+		start := offset
+		offset += int64(len(line)) + 1
+		text := bytes.TrimSpace(line)
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		if number == 1 && !numeric(text) {
+			continue
+		}
+		s.lines = append(s.lines, csvLine{offset: start, length: len(line), number: number})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	return s, nil
+}
+
+// rawLines splits lines like bufio.ScanLines but keeps a trailing \r, so
+// the lengths of the lines and their newlines add up to their offsets
+func rawLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// csvFields splits a line into its values
+func csvFields(line string) []string {
+	return strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' })
+}
+
+// numeric reports whether every value of a line parses as a number
+func numeric(line []byte) bool {
+	for _, f := range csvFields(string(line)) {
+		if _, err := strconv.ParseFloat(f, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Fields implements Source.
+func (s *CSV) Fields() []model.IOSpec { return s.fields }
+
+// Len implements Source.
+func (s *CSV) Len() int { return len(s.lines) }
+
+// Read implements Source.
+func (s *CSV) Read(i int, dst []byte) error {
+	if err := checkIndex(i, len(s.lines)); err != nil {
+		return fmt.Errorf("csv: %w", err)
+	}
+	l := s.lines[i]
+	text := make([]byte, l.length)
+	if _, err := s.r.ReadAt(text, l.offset); err != nil {
+		return fmt.Errorf("csv: line %d: %w", l.number, err)
+	}
+	fields := csvFields(string(text))
+	values := make([]float64, len(fields))
+	for k, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return fmt.Errorf("csv: line %d: invalid number %q", l.number, f)
+		}
+		values[k] = v
+	}
+	if want := elements(s.fields); len(values) != want {
+		return fmt.Errorf("csv: line %d: got %d values, want %d", l.number, len(values), want)
+	}
+	for _, spec := range s.fields {
+		t, err := ioutil.FromValues(spec, values[:spec.Elements()])
+		if err != nil {
+			return fmt.Errorf("csv: line %d: %w", l.number, err)
+		}
+		dst = dst[copy(dst, t.Data):]
+		values = values[spec.Elements():]
+	}
+	return nil
+}
+
+// elements returns the values of a record of fields
+func elements(fields []model.IOSpec) int {
+	n := 0
+	for _, f := range fields {
+		n += f.Elements()
+	}
+	return n
+}
+
+// zipped joins sources of equally many samples field by field
+type zipped struct {
+	sources []Source
+	fields  []model.IOSpec
+}
+
+// Zip returns a Source whose samples join the samples of sources with the
+// same index, such as the inputs and targets of a dataset kept in separate
+// .npy files. The sources must have as many samples and distinct fields.
+func Zip(sources ...Source) (Source, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("zip: no sources")
+	}
+	z := &zipped{sources: sources}
+	for _, s := range sources {
+		if s.Len() != sources[0].Len() {
+			return nil, fmt.Errorf("zip: sources have %d and %d samples", sources[0].Len(), s.Len())
+		}
+		for _, f := range s.Fields() {
+			if slices.ContainsFunc(z.fields, func(g model.IOSpec) bool { return g.Name == f.Name }) {
+				return nil, fmt.Errorf("zip: duplicate field %q", f.Name)
+			}
+			z.fields = append(z.fields, f)
+		}
+	}
+	return z, nil
+}
+
+func (z *zipped) Fields() []model.IOSpec { return z.fields }
+
+func (z *zipped) Len() int { return z.sources[0].Len() }
+
+func (z *zipped) Read(i int, dst []byte) error {
+	for _, s := range z.sources {
+		if err := s.Read(i, dst); err != nil {
+			return err
+		}
+		dst = dst[RecordSize(s.Fields()):]
+	}
+	return nil
+}
+
+// matched presents the fields of a source as a model's inputs
+type matched struct {
+	src    Source
+	fields []model.IOSpec
+	from   []int // Record offset in src of each field
+	record []byte
+}
+
+// Match returns a Source yielding the declared inputs of a model from the
+// fields of src: each input takes the field of its name, which must have
+// its dtype and as many elements, and its shape. As ioutil.BindInputs does,
+// a lone field feeds a lone input whatever its name. Fields the model does
+// not take are dropped.
+func Match(src Source, inputs []model.IOSpec) (Source, error) {
+	fields := src.Fields()
+	offsets := make([]int, len(fields))
+	for k := 1; k < len(fields); k++ {
+		offsets[k] = offsets[k-1] + fields[k-1].Bytes()
+	}
+	m := &matched{src: src, fields: slices.Clone(inputs), record: make([]byte, RecordSize(fields))}
+	for _, in := range inputs {
+		k := slices.IndexFunc(fields, func(f model.IOSpec) bool { return f.Name == in.Name })
+		if k < 0 && len(fields) == 1 && len(inputs) == 1 {
+			k = 0
+		}
+		if k < 0 {
+			return nil, fmt.Errorf("dataset has no field %q", in.Name)
+		}
+		if f := fields[k]; f.DType != in.DType || f.Elements() != in.Elements() {
+			return nil, fmt.Errorf("field %q is %v, the input takes %v", f.Name,
+				ioutil.Tensor{DType: f.DType, Shape: f.Shape}, ioutil.Tensor{DType: in.DType, Shape: in.Shape})
+		}
+		m.from = append(m.from, offsets[k])
+	}
+	return m, nil
+}
+
+func (m *matched) Fields() []model.IOSpec { return m.fields }
+
+func (m *matched) Len() int { return m.src.Len() }
+
+func (m *matched) Read(i int, dst []byte) error {
+	if err := m.src.Read(i, m.record); err != nil {
+		return err
+	}
+	for k, f := range m.fields {
+		dst = dst[copy(dst, m.record[m.from[k]:m.from[k]+f.Bytes()]):]
+	}
+	return nil
+}
+
+// subset is a view of some samples of a source
+type subset struct {
+	src     Source
+	indices []int
+}
+
+// Subset returns a Source of the samples of src at indices, in that order
+func Subset(src Source, indices []int) Source {
+	return &subset{src: src, indices: indices}
+}
+
+// Split divides src into the samples before and from the fraction holdout
+// of its end, such as training and validation sets. Shuffle the samples
+// before splitting an ordered dataset.
+func Split(src Source, holdout float64) (train, held Source) {
+	n := src.Len()
+	cut := n - int(math.Round(float64(n)*min(max(holdout, 0), 1)))
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	return Subset(src, indices[:cut]), Subset(src, indices[cut:])
+}
+
+func (s *subset) Fields() []model.IOSpec { return s.src.Fields() }
+
+func (s *subset) Len() int { return len(s.indices) }
+
+func (s *subset) Read(i int, dst []byte) error {
+	if err := checkIndex(i, len(s.indices)); err != nil {
+		return err
+	}
+	return s.src.Read(s.indices[i], dst)
+}
+
+// Files is a Source read from files, which Close closes
+type Files struct {
+	Source
+	files []*os.File
+}
+
+// Close closes the files
+func (f *Files) Close() error {
+	var errs []error
+	for _, file := range f.files {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Open opens a dataset of the inputs a model declares, its samples holding
+// them in order. A .csv or .txt file holds one sample per line, and any
+// other single file binary records. .npy arrays are sliced along their
+// leading dimension, each file holding the input named like it without
+// extension; a lone array feeds a lone input whatever its name.
+func Open(inputs []model.IOSpec, paths ...string) (*Files, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no dataset files")
+	}
+	f := &Files{}
+	src, err := f.open(inputs, paths)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.Source = src
+	return f, nil
+}
+
+func (f *Files) open(inputs []model.IOSpec, paths []string) (Source, error) {
+	var arrays []Source
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		f.files = append(f.files, file)
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == ".npy" {
+			src, err := NewNPY(file, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			arrays = append(arrays, src)
+			continue
+		}
+		if len(paths) > 1 {
+			return nil, fmt.Errorf("%s: only .npy arrays combine with other files", path)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		var src Source
+		if ext == ".csv" || ext == ".txt" {
+			src, err = NewCSV(file, info.Size(), inputs)
+		} else {
+			src, err = NewRecords(file, info.Size(), inputs)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return src, nil
+	}
+	src, err := Zip(arrays...)
+	if err != nil {
+		return nil, err
+	}
+	return Match(src, inputs)
+}
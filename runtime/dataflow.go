@@ -0,0 +1,187 @@
+package runtime
+
+import (
+	"fmt"
+	"maps"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// flow is how a node exchanges data with the nodes it consumes, following
+// the data flow model.Graph.InferShapes assumes: a node without
+// dependencies reads the operands in its payload segment, and a node with
+// dependencies their outputs in Topo order, packed where its kernel reads
+// its operands.
+type flow struct {
+	deps     []int // Indices of the nodes consumed, in Topo order
+	operands int   // Buffer offset the outputs of deps are packed at
+	output   int   // Buffer offset of the node's output
+	size     int   // Output bytes, 0 when the shape is unknown: the rest of the buffer
+}
+
+// setupFlows resolves the flow of every node. Dependencies on IDs the
+// graph does not hold are left out, as the scheduler leaves them out.
+// Output shapes missing from the graph, which compiled graphs carry, are
+// inferred on a copy.
+func (e *Engine) setupFlows() {
+	shapes := e.graph.Shapes
+	if len(shapes) < len(e.graph.Nodes) {
+		c := *e.graph
+		if c.InferShapes() == nil {
+			shapes = maps.Clone(c.Shapes)
+			maps.Copy(shapes, e.graph.Shapes)
+		}
+	}
+	index := make(map[uint32]int, len(e.graph.Nodes))
+	for i, n := range e.graph.Nodes {
+		if _, dup := index[n.ID]; !dup {
+			index[n.ID] = i
+		}
+	}
+	e.flows = make([]flow, len(e.graph.Nodes))
+	for i := range e.graph.Nodes {
+		n := &e.graph.Nodes[i]
+		f := &e.flows[i]
+		for _, dep := range n.Topo {
+			if j, ok := index[dep]; ok && dep != model.NoNeighbor {
+				f.deps = append(f.deps, j)
+			}
+		}
+		f.operands, f.output = kernels.Ports(n.Kernel, nodeSegment(n, e.graph.Payload))
+		if shape, ok := shapes[n.ID]; ok {
+			f.size = 4 * kernels.Elements(shape)
+		}
+	}
+}
+
+// port is a declared input or output of the model: the index of the node
+// holding it and its bytes
+type port struct {
+	index int
+	bytes int
+}
+
+// setupPorts resolves the declared inputs and outputs to their nodes. A
+// model declaring no outputs returns the output of its last node in
+// topological order from ExecuteStreaming.
+func (e *Engine) setupPorts() {
+	e.inPorts, e.outPorts = nil, nil
+	for _, d := range e.Inputs() {
+		if d.Index >= 0 {
+			e.inPorts = append(e.inPorts, port{d.Index, d.Bytes()})
+		}
+	}
+	for _, d := range e.Outputs() {
+		if d.Index >= 0 {
+			e.outPorts = append(e.outPorts, port{d.Index, d.Bytes()})
+		}
+	}
+	if len(e.graph.Outputs()) > 0 || len(e.graph.Nodes) == 0 {
+		return
+	}
+	last := len(e.graph.Nodes) - 1
+	if order, err := topologicalOrder(e.graph); err == nil {
+		last = order[len(order)-1]
+	}
+	f := &e.flows[last]
+	size := f.size
+	if size == 0 {
+		size = max(int(core.AlignedSize(uintptr(calculateNodePayloadSize(&e.graph.Nodes[last], e.graph))))-f.output, 0)
+	}
+	e.outPorts = []port{{last, size}}
+}
+
+// bindInput copies input, the data of the declared inputs back to back in
+// declaration order, into their payload segments in the resident arena,
+// where their nodes read it. Bytes past the inputs are left to the
+// streaming window; models declaring no inputs take nothing.
+func (e *Engine) bindInput(input []byte) error {
+	payload := e.modelPayload(e.arena)
+	for _, p := range e.inPorts {
+		n := &e.graph.Nodes[p.index]
+		if len(input) < p.bytes {
+			return fmt.Errorf("%w: %d bytes left for the %d-byte input of node %d", ErrInputTooShort, len(input), p.bytes, n.ID)
+		}
+		segment := nodeSegment(n, payload)
+		if len(segment) < p.bytes {
+			return fmt.Errorf("input of %d bytes does not fit the %d-byte payload segment of node %d", p.bytes, len(segment), n.ID)
+		}
+		copy(segment, input[:p.bytes])
+		input = input[p.bytes:]
+	}
+	return nil
+}
+
+// readOutput copies the committed declared outputs back to back in
+// declaration order into output, as far as it holds them, and returns the
+// bytes copied
+func (e *Engine) readOutput(output []byte) int {
+	total := 0
+	for _, p := range e.outPorts {
+		data := e.output(p.index)
+		total += copy(output[total:], data[:min(p.bytes, len(data))])
+	}
+	return total
+}
+
+// nodeSegment returns the payload segment [In, Out) of n, clipped to payload
+func nodeSegment(n *model.Node, payload []byte) []byte {
+	in, out := min(int(n.In), len(payload)), min(int(n.Out), len(payload))
+	if out <= in {
+		return nil
+	}
+	return payload[in:out]
+}
+
+// gather lays out the kernel input of node i in its PayloadProp: its
+// segment of payload, the model payload of the arena it runs in, then the
+// committed outputs of its dependencies. It returns the bytes of the input,
+// which the kernel is called on.
+func (e *Engine) gather(i int, payload []byte) int {
+	prop := e.sublates[i].PayloadProp
+	n := copy(prop, nodeSegment(&e.graph.Nodes[i], payload))
+	f := &e.flows[i]
+	if len(f.deps) == 0 {
+		if n == 0 {
+			return len(prop)
+		}
+		return n
+	}
+	at := min(f.operands, len(prop))
+	for _, j := range f.deps {
+		at += copy(prop[at:], e.output(j))
+	}
+	return max(n, at)
+}
+
+// output returns the committed output of node i, which its buffer swap
+// left in PayloadPrev
+func (e *Engine) output(i int) []byte {
+	if e.sublates[i] == nil {
+		return nil
+	}
+	return e.flows[i].of(e.sublates[i].PayloadPrev)
+}
+
+// of returns the output of the node within buf, a buffer its kernel ran on
+func (f *flow) of(buf []byte) []byte {
+	start := min(f.output, len(buf))
+	if f.size == 0 {
+		return buf[start:]
+	}
+	return buf[start:min(start+f.size, len(buf))]
+}
+
+// modelPayload returns the model payload region of arena, nil when it has none
+func (e *Engine) modelPayload(arena *Arena) []byte {
+	if arena == nil {
+		return nil
+	}
+	payload, err := arena.ModelPayload(uintptr(len(e.graph.Payload)))
+	if err != nil {
+		return nil
+	}
+	return payload
+}
@@ -0,0 +1,148 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/training"
+)
+
+// float32Bytes encodes v little endian
+func float32Bytes(v ...float32) []byte {
+	b := make([]byte, 0, 4*len(v))
+	for _, f := range v {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+	}
+	return b
+}
+
+// reluSumGraph computes s = sum(relu(x)) of the input x = [1, -2, 3, -4]
+func reluSumGraph() *model.Graph {
+	return &model.Graph{
+		Payload: float32Bytes(1, -2, 3, -4),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: kernels.OpNoop, In: 0, Out: 16},
+			{ID: 1, Kernel: kernels.OpReLU, In: 16, Out: 16, Topo: []uint32{0}},
+			{ID: 2, Kernel: kernels.OpSum, In: 16, Out: 16, Topo: []uint32{1}},
+		},
+		IO: []model.IOSpec{
+			{Name: "x", Kind: model.Input, NodeID: 0, DType: model.Float32, Shape: []int{4}},
+			{Name: "s", Kind: model.Output, NodeID: 2, DType: model.Float32, Shape: []int{1}},
+		},
+	}
+}
+
+func TestDependencyOutputsPropagate(t *testing.T) {
+	t.Parallel()
+	for _, c := range []struct {
+		name  string
+		graph func() *model.Graph
+		loss  uint32
+		want  float32
+	}{
+		{"relu then sum", reluSumGraph, 2, 4},
+		{"regression", regressionGraph, 7, 67.5},
+	} {
+		// The training forward pass is the reference
+		b, err := training.Differentiate(c.graph(), c.loss)
+		if err != nil {
+			t.Fatalf("%s: Differentiate failed: %v", c.name, err)
+		}
+		if loss, err := b.Forward(make([]byte, b.Size)); err != nil || loss != c.want {
+			t.Fatalf("%s: training forward gives %v, %v, want %v", c.name, loss, err, c.want)
+		}
+
+		for mode, opts := range map[string]EngineOptions{
+			"sequential":    {Workers: 1},
+			"levels":        {Workers: 4, Streaming: true},
+			"work stealing": {Workers: 4, Streaming: true, Scheduler: SchedulerWorkSteal},
+			"deterministic": {Streaming: true, Deterministic: true},
+		} {
+			graph := c.graph()
+			engine, err := NewEngine(graph, &opts)
+			if err != nil {
+				t.Fatalf("%s, %s: NewEngine failed: %v", c.name, mode, err)
+			}
+			loss := func() float32 {
+				for i, n := range graph.Nodes {
+					if n.ID == c.loss {
+						return math.Float32frombits(binary.LittleEndian.Uint32(engine.output(i)))
+					}
+				}
+				return float32(math.NaN())
+			}
+			for run := 0; run < 2; run++ {
+				if err := engine.Execute(nil); err != nil {
+					t.Fatalf("%s, %s: Execute failed: %v", c.name, mode, err)
+				}
+				if got := loss(); got != c.want {
+					t.Errorf("%s, %s: Execute %d gives %v, want %v", c.name, mode, run, got, c.want)
+				}
+			}
+			if err := engine.Run(); err != nil {
+				t.Fatalf("%s, %s: Run failed: %v", c.name, mode, err)
+			}
+			if got := loss(); got != c.want {
+				t.Errorf("%s, %s: Run gives %v, want %v", c.name, mode, got, c.want)
+			}
+		}
+	}
+}
+
+func TestExecuteStreamingDeclaredIO(t *testing.T) {
+	t.Parallel()
+	for mode, opts := range map[string]EngineOptions{
+		"sequential":    {Workers: 1, Streaming: true},
+		"levels":        {Workers: 4, Streaming: true},
+		"work stealing": {Workers: 4, Streaming: true, Scheduler: SchedulerWorkSteal},
+		"chunked":       {Workers: 1, Streaming: true, ChunkedInput: true},
+	} {
+		engine, err := NewEngine(reluSumGraph(), &opts)
+		if err != nil {
+			t.Fatalf("%s: NewEngine failed: %v", mode, err)
+		}
+		if size := engine.OutputSize(); size != 4 {
+			t.Fatalf("%s: expected the 4 bytes of s, got OutputSize %d", mode, size)
+		}
+		output := make([]byte, engine.OutputSize())
+		for _, c := range []struct {
+			x    []float32
+			want float32
+		}{
+			{[]float32{2, -1, 5, -3}, 7},
+			{[]float32{-1, -1, -1, 0.5}, 0.5},
+		} {
+			if err := engine.ExecuteStreaming(float32Bytes(c.x...), output); err != nil {
+				t.Fatalf("%s: ExecuteStreaming failed: %v", mode, err)
+			}
+			if got := math.Float32frombits(binary.LittleEndian.Uint32(output)); got != c.want {
+				t.Errorf("%s: sum(relu(%v)) gives %v, want %v", mode, c.x, got, c.want)
+			}
+		}
+		if err := engine.ExecuteStreaming(make([]byte, 8), output); !errors.Is(err, ErrInputTooShort) {
+			t.Errorf("%s: expected an error for input shorter than x", mode)
+		}
+	}
+}
+
+func TestOutputSizeWithoutDeclaredOutputs(t *testing.T) {
+	t.Parallel()
+	g := reluSumGraph()
+	g.IO = nil
+	engine, err := NewEngine(g, &EngineOptions{Workers: 1, Streaming: true})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	// The output of the last node, the sum, without an IO table
+	output := make([]byte, engine.OutputSize())
+	if err := engine.ExecuteStreaming(nil, output); err != nil {
+		t.Fatalf("ExecuteStreaming failed: %v", err)
+	}
+	if len(output) != 4 || math.Float32frombits(binary.LittleEndian.Uint32(output)) != 4 {
+		t.Errorf("Expected the sum 4 of the model payload, got %v", output)
+	}
+}
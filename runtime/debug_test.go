@@ -0,0 +1,30 @@
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestDebugNamesInErrors(t *testing.T) {
+	t.Parallel()
+	graph := overflowGraph()
+	graph.Debug = &model.DebugInfo{Nodes: map[uint32]model.SourceInfo{0: {Name: "logits"}}}
+	engine, err := NewEngine(graph, &EngineOptions{
+		Workers:        1,
+		ArenaSize:      1 << 16,
+		GuardNonFinite: true,
+		DisableMemo:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	err = engine.Run()
+
+	var nf *NonFiniteError
+	if !errors.As(err, &nf) || nf.NodeName != "logits" || !strings.HasPrefix(err.Error(), "node logits ") {
+		t.Errorf("Expected a NonFiniteError naming node logits, got %v", err)
+	}
+}
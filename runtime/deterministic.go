@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// DefaultSeed seeds the engine random source when EngineOptions.Seed is zero.
+const DefaultSeed = 0x5ab1a7e
+
+// topologicalOrder returns the node indices in the fixed order deterministic
+// engines execute them: Kahn's algorithm over the node topology, visiting
+// ready nodes in graph order.
+func topologicalOrder(graph *model.Graph) ([]int, error) {
+	s, err := NewStreamScheduler(graph, 1)
+	if err != nil {
+		return nil, err
+	}
+	return s.order, nil
+}
+
+// setupOrder makes sequential runs follow the topology when the graph lists
+// a consumer before one of its producers, as graphs compiled without layout
+// optimization may. Cyclic graphs keep graph order.
+func (e *Engine) setupOrder() {
+	order, err := topologicalOrder(e.graph)
+	if err != nil {
+		return
+	}
+	for k, i := range order {
+		if k != i {
+			e.order = order
+			return
+		}
+	}
+}
+
+// setupDeterminism fixes the node order and random source of a deterministic
+// engine. It is a no-op otherwise.
+func (e *Engine) setupDeterminism() error {
+	if !e.opts.Deterministic {
+		return nil
+	}
+	order, err := topologicalOrder(e.graph)
+	if err != nil {
+		return err
+	}
+	e.order = order
+	e.reseed()
+	return nil
+}
+
+// validateDeterminism forces a single worker and rejects options that cannot
+// give reproducible runs.
+func (o *EngineOptions) validateDeterminism() error {
+	if !o.Deterministic {
+		return nil
+	}
+	if o.Scheduler == SchedulerWorkSteal {
+		return errors.New("deterministic mode cannot use the worksteal scheduler")
+	}
+	o.Workers = 1
+	if o.Seed == 0 {
+		o.Seed = DefaultSeed
+	}
+	return nil
+}
+
+// nodeIndex maps the k-th step of a sequential execution to a node index:
+// the topological order when one is fixed, graph order otherwise.
+func (e *Engine) nodeIndex(k int) int {
+	if e.order != nil {
+		return e.order[k]
+	}
+	return k
+}
+
+// runDeterministic executes every node on the calling goroutine in the fixed
+// topological order, so results do not depend on worker timing.
+func (e *Engine) runDeterministic(arena *Arena) error {
+	payload := e.modelPayload(arena)
+	for _, i := range e.scheduler.order {
+		if err := e.runNode(0, i, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reseed restarts the engine random source from the configured seed.
+func (e *Engine) reseed() {
+	e.rng = rand.New(rand.NewPCG(e.opts.Seed, e.opts.Seed))
+}
+
+// Rand returns the engine random source. Deterministic engines reseed it from
+// EngineOptions.Seed before every execution, so each run draws the same
+// sequence. It is not safe for concurrent use.
+func (e *Engine) Rand() *rand.Rand {
+	if e.rng == nil {
+		e.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return e.rng
+}
@@ -0,0 +1,106 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// unorderedGraph lists its nodes in reverse dependency order.
+func unorderedGraph() *model.Graph {
+	payload := make([]byte, 256)
+	for i := 0; i < len(payload)/4; i++ {
+		binary.LittleEndian.PutUint32(payload[i*4:], math.Float32bits(float32(i)*0.37-5))
+	}
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 3, Kernel: 1, In: 192, Out: 256, Topo: []uint32{1, 2}},
+			{ID: 2, Kernel: 1, In: 128, Out: 192, Topo: []uint32{0}},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+		},
+	}
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	t.Parallel()
+	want := []uint32{0, 2, 1, 3}
+
+	for _, streaming := range []bool{false, true} {
+		recorder := NewTraceRecorder(0)
+		engine, err := NewEngine(unorderedGraph(), &EngineOptions{
+			Workers:       8,
+			ArenaSize:     1 << 16,
+			Streaming:     streaming,
+			Deterministic: true,
+			Tracer:        recorder,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		if engine.workers != 1 {
+			t.Errorf("Expected deterministic mode to force 1 worker, got %d", engine.workers)
+		}
+
+		if err := engine.Execute(NewExecutionContext(4)); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		events := recorder.Events()
+		if len(events) != len(want) {
+			t.Fatalf("Expected %d traced nodes, got %d", len(want), len(events))
+		}
+		for i, ev := range events {
+			if ev.NodeID != want[i] || ev.Worker != 0 {
+				t.Errorf("streaming=%v: step %d ran node %d on worker %d, expected node %d on worker 0",
+					streaming, i, ev.NodeID, ev.Worker, want[i])
+			}
+		}
+	}
+}
+
+func TestDeterministicReplay(t *testing.T) {
+	t.Parallel()
+	run := func() ([]byte, uint64) {
+		engine, err := NewEngine(unorderedGraph(), &EngineOptions{
+			ArenaSize:     1 << 16,
+			Streaming:     true,
+			Deterministic: true,
+			Seed:          42,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		output := make([]byte, 64)
+		for i := 0; i < 3; i++ {
+			if err := engine.ExecuteStreaming(make([]byte, 64), output); err != nil {
+				t.Fatalf("ExecuteStreaming failed: %v", err)
+			}
+		}
+		return output, engine.Rand().Uint64()
+	}
+
+	out1, r1 := run()
+	out2, r2 := run()
+	if !bytes.Equal(out1, out2) {
+		t.Error("Expected bit-identical outputs across deterministic runs")
+	}
+	if r1 != r2 {
+		t.Errorf("Expected the same random stream, got %d and %d", r1, r2)
+	}
+}
+
+func TestDeterministicRejectsWorkStealing(t *testing.T) {
+	t.Parallel()
+	_, err := NewEngine(unorderedGraph(), &EngineOptions{
+		Streaming:     true,
+		Deterministic: true,
+		Scheduler:     SchedulerWorkSteal,
+	})
+	if err == nil {
+		t.Error("Expected deterministic mode to reject the worksteal scheduler")
+	}
+}
@@ -0,0 +1,169 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/model"
+)
+
+// ggufFile builds a GGUF v3 file holding the given tensors, each a name,
+// dims (innermost first), ggml type and raw data
+func ggufFile(tensors ...struct {
+	name string
+	dims []uint64
+	typ  uint32
+	data []byte
+}) []byte {
+	var b bytes.Buffer
+	le := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+	str := func(s string) { le(uint64(len(s))); b.WriteString(s) }
+	le(uint32(model.GGUFMagic))
+	le(uint32(3))
+	le(uint64(len(tensors)))
+	le(uint64(4))
+	str("general.name")
+	le(uint32(8))
+	str("tiny")
+	str("general.alignment")
+	le(uint32(4))
+	le(uint32(64))
+	str("tokenizer.ggml.tokens") // Array of strings, skipped
+	le(uint32(9))
+	le(uint32(8))
+	le(uint64(2))
+	str("a")
+	str("bc")
+	str("tiny.rope.freq_base")
+	le(uint32(6))
+	le(float32(10000))
+
+	var data []byte
+	for _, t := range tensors {
+		data = append(data, make([]byte, (64-len(data)%64)%64)...)
+		str(t.name)
+		le(uint32(len(t.dims)))
+		le(t.dims)
+		le(t.typ)
+		le(uint64(len(data)))
+		data = append(data, t.data...)
+	}
+	b.Write(make([]byte, (64-b.Len()%64)%64))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestReadGGUF(t *testing.T) {
+	t.Parallel()
+	f32 := make([]byte, 24)
+	for i := range 6 {
+		binary.LittleEndian.PutUint32(f32[4*i:], math.Float32bits(float32(i)))
+	}
+	// Half precision 1, -2, 0.5 and the smallest subnormal
+	f16 := []byte{0x00, 0x3C, 0x00, 0xC0, 0x00, 0x38, 0x01, 0x00}
+	q8 := append([]byte{0x00, 0x38}, make([]byte, 32)...) // Scale 0.5
+	q8[2], q8[3] = 4, 0xFE                                // 4, -2
+	q4 := append([]byte{0x00, 0x40}, make([]byte, 16)...) // Scale 2
+	q4[2] = 0x9A                                          // 10 and 9, centered on 8
+	q41 := append([]byte{0x00, 0x3C, 0x00, 0x3C}, make([]byte, 16)...)
+	q41[4] = 0x21 // 1*1+1 and 2*1+1
+
+	file := ggufFile([]struct {
+		name string
+		dims []uint64
+		typ  uint32
+		data []byte
+	}{
+		{"blk.0.attn.bias", []uint64{3, 2}, 0, f32},
+		{"f16", []uint64{4}, 1, f16},
+		{"q8", []uint64{32}, 8, q8},
+		{"q4", []uint64{32}, 2, q4},
+		{"q41", []uint64{32}, 3, q41},
+	}...)
+	g, err := model.ReadGGUF(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("ReadGGUF failed: %v", err)
+	}
+	if g.Meta["name"] != "tiny" || g.Meta["tiny.rope.freq_base"] != "10000" {
+		t.Errorf("Expected GGUF metadata, got %v", g.Meta)
+	}
+	if len(g.Nodes) != 5 || len(g.Segments) != 5 || !slices.Equal(g.Shapes[0], []int{2, 3}) {
+		t.Fatalf("Expected five tensors with a [2 3] first shape, got %d nodes, shapes %v", len(g.Nodes), g.Shapes)
+	}
+	if s := g.Segments[0]; s.Role != model.RoleBias || s.Name != "blk.0.attn.bias" || g.Segments[1].Role != model.RoleWeight {
+		t.Errorf("Expected named bias and weight segments, got %+v", g.Segments[:2])
+	}
+	values := func(i, n int) []float32 {
+		s := g.Segments[i]
+		out := make([]float32, n)
+		for j := range out {
+			out[j] = math.Float32frombits(binary.LittleEndian.Uint32(g.Payload[int(s.Offset)+4*j:]))
+		}
+		return out
+	}
+	if got := values(0, 6); !slices.Equal(got, []float32{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("F32: got %v", got)
+	}
+	if got := values(1, 4); !slices.Equal(got, []float32{1, -2, 0.5, 1.0 / (1 << 24)}) {
+		t.Errorf("F16: got %v", got)
+	}
+	if got := values(2, 3); !slices.Equal(got, []float32{2, -1, 0}) {
+		t.Errorf("Q8_0: got %v", got)
+	}
+	if got := values(3, 32); got[0] != 4 || got[1] != -16 || got[16] != 2 {
+		t.Errorf("Q4_0: got %v", got)
+	}
+	if got := values(4, 32); got[0] != 2 || got[1] != 1 || got[16] != 3 {
+		t.Errorf("Q4_1: got %v", got)
+	}
+	if err := g.Validate(); err != nil {
+		t.Errorf("Expected the imported graph to validate, got %v", err)
+	}
+
+	if _, err := model.ReadGGUF(bytes.NewReader(file[:100]), 100); err == nil {
+		t.Error("Expected an error for a truncated file")
+	}
+
+	// Tensors claiming more data than the file holds fail before their data
+	// is allocated, however large, including offsets wrapping around
+	type tensor = struct {
+		name string
+		dims []uint64
+		typ  uint32
+		data []byte
+	}
+	huge := ggufFile(tensor{"huge", []uint64{math.MaxUint32}, 0, nil})
+	if _, err := model.ReadGGUF(bytes.NewReader(huge), int64(len(huge))); err == nil {
+		t.Error("Expected an error for a tensor exceeding the file")
+	}
+	wrap := ggufFile(tensor{"wrap", []uint64{1}, 0, f32[:4]})
+	at := bytes.Index(wrap, []byte("wrap")) + len("wrap") + 4 + 8 + 4
+	binary.LittleEndian.PutUint64(wrap[at:], math.MaxUint64-63)
+	if _, err := model.ReadGGUF(bytes.NewReader(wrap), int64(len(wrap))); err == nil {
+		t.Error("Expected an error for a tensor offset wrapping around")
+	}
+
+	dir := t.TempDir()
+	src, out := filepath.Join(dir, "m.gguf"), filepath.Join(dir, "m.subl")
+	if err := os.WriteFile(src, file, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	opts := compiler.DefaultOptions()
+	opts.From = compiler.FormatGGUF
+	if _, err := compiler.CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile from GGUF failed: %v", err)
+	}
+	compiled, err := ReadGraph(out, nil)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+	if len(compiled.Segments) != 5 || compiled.Meta["name"] != "tiny" {
+		t.Errorf("Expected the compiled model to keep segments and metadata, got %d and %v", len(compiled.Segments), compiled.Meta)
+	}
+}
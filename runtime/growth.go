@@ -0,0 +1,91 @@
+package runtime
+
+import "sync"
+
+// arenaGrowth lets exhausted node payload and scratch allocations overflow
+// into the FreeTail region. Node payloads grow up from the start of the tail
+// and scratch grows down from its end, so each side can be reset on its own.
+type arenaGrowth struct {
+	enabled bool
+	mu      sync.Mutex
+	low     uintptr // Tail bytes taken by node payloads
+	high    uintptr // Tail bytes taken by scratch
+	peak    uintptr // Most tail bytes in use at once
+}
+
+// AllowGrowth lets AllocateNodePayload and AllocateScratch fall back to the
+// FreeTail region instead of failing when their own region is full.
+func (a *Arena) AllowGrowth(allow bool) {
+	a.growth.enabled = allow
+}
+
+// Grown returns the FreeTail bytes currently lent to other regions.
+func (a *Arena) Grown() uintptr {
+	a.growth.mu.Lock()
+	defer a.growth.mu.Unlock()
+	return a.growth.low + a.growth.high
+}
+
+// grow carves size bytes from the free tail, from the bottom for node
+// payloads or from the top for scratch. It reports false when growth is
+// disabled or the tail is full.
+func (a *Arena) grow(top bool, size, alignment uintptr) ([]byte, bool) {
+	if !a.growth.enabled || a.freeTail.Size == 0 {
+		return nil, false
+	}
+	if alignment == 0 {
+		alignment = DefaultAlignment
+	}
+
+	g := &a.growth
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	start, end := a.freeTail.Offset+g.low, a.freeTail.Offset+a.freeTail.Size-g.high
+	var offset uintptr
+	if top {
+		if end < size {
+			return nil, false
+		}
+		offset = (end - size) &^ (alignment - 1)
+		if offset < start {
+			return nil, false
+		}
+		g.high = a.freeTail.Offset + a.freeTail.Size - offset
+	} else {
+		offset = (start + alignment - 1) &^ (alignment - 1)
+		if offset+size > end {
+			return nil, false
+		}
+		g.low = offset + size - a.freeTail.Offset
+	}
+	g.peak = max(g.peak, g.low+g.high)
+	return a.buffer[offset : offset+size], true
+}
+
+// resetGrowth returns the tail bytes lent to node payloads or scratch.
+func (a *Arena) resetGrowth(top bool) {
+	a.growth.mu.Lock()
+	defer a.growth.mu.Unlock()
+	if top {
+		a.growth.high = 0
+	} else {
+		a.growth.low = 0
+	}
+}
+
+// configureArena applies the engine's arena options to a freshly created arena.
+func (e *Engine) configureArena(arena *Arena) error {
+	arena.AllowGrowth(e.opts.AllowArenaGrowth)
+	return e.placeWorkerShards(arena)
+}
+
+// growthPeak returns the most FreeTail bytes ever lent at once.
+func (a *Arena) growthPeak() uintptr {
+	if a == nil {
+		return 0
+	}
+	a.growth.mu.Lock()
+	defer a.growth.mu.Unlock()
+	return a.growth.peak
+}
@@ -0,0 +1,91 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestArenaGrowthIntoFreeTail(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 64),
+		Nodes:   []model.Node{{Kernel: 1}},
+	}
+	arena, err := NewArena(8192, graph, 128, 0, 128)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+	tail, _ := arena.Region("FreeTail")
+
+	if _, err := arena.AllocateNodePayload(256, 64); !errors.Is(err, ErrArenaExhausted) {
+		t.Fatalf("Expected ErrArenaExhausted without growth, got %v", err)
+	}
+
+	arena.AllowGrowth(true)
+	payload, err := arena.AllocateNodePayload(256, 64)
+	if err != nil {
+		t.Fatalf("AllocateNodePayload with growth failed: %v", err)
+	}
+	scratch, err := arena.AllocateScratch(512, 64)
+	if err != nil {
+		t.Fatalf("AllocateScratch with growth failed: %v", err)
+	}
+
+	offset := func(b []byte) uintptr { return uintptr(cap(arena.buffer) - cap(b)) }
+	if offset(payload) != tail.Offset {
+		t.Errorf("Expected node payload growth at the tail start %d, got %d", tail.Offset, offset(payload))
+	}
+	if end := offset(scratch) + uintptr(len(scratch)); end != tail.Offset+tail.Size {
+		t.Errorf("Expected scratch growth at the tail end %d, got %d", tail.Offset+tail.Size, end)
+	}
+	if got := arena.Grown(); got != 256+512 {
+		t.Errorf("Expected 768 grown bytes, got %d", got)
+	}
+
+	// Resetting one side leaves the other's borrowed memory alone
+	arena.ResetScratch()
+	if got := arena.Grown(); got != 256 {
+		t.Errorf("Expected 256 grown bytes after scratch reset, got %d", got)
+	}
+	for _, region := range arena.Report().Regions {
+		if region.Name == "FreeTail" && (region.Used != 256 || region.HighWater != 768) {
+			t.Errorf("Expected FreeTail used 256, peak 768, got %d and %d", region.Used, region.HighWater)
+		}
+	}
+
+	if _, err := arena.AllocateNodePayload(tail.Size, 64); !errors.Is(err, ErrArenaExhausted) {
+		t.Errorf("Expected ErrArenaExhausted once the tail is full, got %v", err)
+	}
+}
+
+func TestEngineArenaGrowth(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 7, Kernel: 1, In: 128, Out: 224},
+		},
+	}
+
+	engine, err := createBaseEngine(graph, &EngineOptions{ArenaSize: 1 << 16, AllowArenaGrowth: true})
+	if err != nil {
+		t.Fatalf("createBaseEngine failed: %v", err)
+	}
+	// Room for the first node's buffers only
+	arena, err := NewArena(1<<16, graph, 2*64, 0, 0)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+	if err := engine.configureArena(arena); err != nil {
+		t.Fatalf("configureArena failed: %v", err)
+	}
+	if err := engine.initializeSublates(graph, arena); err != nil {
+		t.Fatalf("Expected node 7 to grow into the free tail, got %v", err)
+	}
+	if arena.Grown() != 2*128 {
+		t.Errorf("Expected 256 grown bytes, got %d", arena.Grown())
+	}
+}
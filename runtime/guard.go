@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// ErrNonFinite matches every NonFiniteError.
+var ErrNonFinite = errors.New("non-finite kernel output")
+
+// NonFiniteError reports a kernel that wrote NaN or Inf into its node's
+// output while EngineOptions.GuardNonFinite was set.
+type NonFiniteError struct {
+	NodeID   uint32
+	NodeName string // From the model's debug section, "" without one
+	KernelID uint8
+	Index    int // Float32 element of the first bad value
+	Value    float32
+}
+
+func (e *NonFiniteError) Error() string {
+	return fmt.Sprintf("%s kernel %s: %v %v at element %d",
+		model.NodeLabel(e.NodeID, e.NodeName), kernels.OpName(e.KernelID), ErrNonFinite, e.Value, e.Index)
+}
+
+// Is reports whether target is ErrNonFinite.
+func (e *NonFiniteError) Is(target error) bool {
+	return target == ErrNonFinite
+}
+
+// asFloat32 views b as float32 values, dropping a partial trailing value.
+func asFloat32(b []byte) []float32 {
+	if len(b) < 4 {
+		return nil
+	}
+	return unsafe.Slice((*float32)(unsafe.Pointer(&b[0])), len(b)/4)
+}
+
+// guardOutput fails with a NonFiniteError when GuardNonFinite is set and
+// out holds a NaN or Inf, so garbage never reaches the node's dependents.
+func (e *Engine) guardOutput(nodeID uint32, kernelID uint8, out []byte) error {
+	if !e.opts.GuardNonFinite {
+		return nil
+	}
+	values := asFloat32(out)
+	if i := kernels.FirstNonFinite(values); i >= 0 {
+		return &NonFiniteError{NodeID: nodeID, NodeName: e.graph.NodeName(nodeID), KernelID: kernelID, Index: i, Value: values[i]}
+	}
+	return nil
+}
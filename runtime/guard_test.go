@@ -0,0 +1,51 @@
+package runtime
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestGuardNonFinite(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(overflowGraph(), &EngineOptions{
+		Workers:        1,
+		ArenaSize:      1 << 16,
+		GuardNonFinite: true,
+		DisableMemo:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	// Node 0 squares 1e30 into +Inf
+	err = engine.Run()
+
+	var nf *NonFiniteError
+	if !errors.As(err, &nf) || !errors.Is(err, ErrNonFinite) {
+		t.Fatalf("Expected NonFiniteError, got %v", err)
+	}
+	if nf.NodeID != 0 || nf.KernelID != 1 || nf.Index != 0 || !math.IsInf(float64(nf.Value), 1) {
+		t.Errorf("Expected +Inf at node 0 element 0, got %+v", nf)
+	}
+	// Fails fast: node 1 never ran and still holds its payload, not x*x+x of it
+	if got := engine.sublates[1].AsFloat32Prev()[0]; got != 0.5 {
+		t.Errorf("Expected node 1 to be skipped, got output %v", got)
+	}
+}
+
+func TestGuardNonFiniteOff(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(overflowGraph(), &EngineOptions{
+		Workers:     1,
+		ArenaSize:   1 << 16,
+		DisableMemo: true,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := engine.Run(); err != nil {
+			t.Fatalf("Expected non-finite output to propagate without the guard, got %v", err)
+		}
+	}
+}
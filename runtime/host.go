@@ -0,0 +1,250 @@
+package runtime
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+)
+
+// workerPool is a fixed set of goroutines shared by every engine of a Host.
+type workerPool struct {
+	tasks chan func(worker int)
+	wg    sync.WaitGroup
+}
+
+// newWorkerPool starts n pool workers.
+func newWorkerPool(n int) *workerPool {
+	p := &workerPool{tasks: make(chan func(worker int), n*4)}
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(id int) {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				task(id)
+			}
+		}(i)
+	}
+	return p
+}
+
+// submit queues a task, blocking while the pool backlog is full.
+func (p *workerPool) submit(task func(worker int)) {
+	p.tasks <- task
+}
+
+// stop lets queued tasks finish and waits for the workers to exit.
+func (p *workerPool) stop() {
+	close(p.tasks)
+	p.wg.Wait()
+}
+
+// runOnPool executes the graph by dispatching each ready node to the shared pool.
+// The calling goroutine only forwards nodes; it never runs kernels itself.
+func (e *Engine) runOnPool(arena *Arena) error {
+	run := e.scheduler.begin()
+	payload := e.modelPayload(arena)
+
+	var wg sync.WaitGroup
+	for i := range run.ready {
+		wg.Add(1)
+		e.pool.submit(func(worker int) {
+			defer wg.Done()
+			e.execNode(run, worker, i, payload)
+			e.scheduler.complete(run, i)
+		})
+	}
+	wg.Wait()
+	return run.failure()
+}
+
+// HostOptions configures a multi-model Host.
+type HostOptions struct {
+	Workers     int     // Size of the shared worker pool
+	ArenaSize   uintptr // Shared arena size; 0 gives every model a private arena
+	EnableStats bool
+	Streaming   bool
+
+	// VerifyKey, when set, makes Load reject models that are not signed by
+	// it. Models passed to Add are trusted as given.
+	VerifyKey ed25519.PublicKey
+}
+
+// Host serves several models from one worker pool and, optionally, one arena
+// split into per-model segments. Calls are routed by model name.
+type Host struct {
+	opts   HostOptions
+	pool   *workerPool
+	mu     sync.RWMutex
+	models map[string]*Engine
+
+	slab   []byte  // Shared arena memory, nil when models own their arenas
+	offset uintptr // Next free byte of slab
+}
+
+// NewHost creates a host with its shared worker pool and arena.
+func NewHost(opts *HostOptions) *Host {
+	hostOpts := HostOptions{Workers: DefaultEngineOptions().Workers, Streaming: true}
+	if opts != nil {
+		hostOpts = *opts
+		if hostOpts.Workers <= 0 {
+			hostOpts.Workers = DefaultEngineOptions().Workers
+		}
+	}
+
+	h := &Host{
+		opts:   hostOpts,
+		pool:   newWorkerPool(hostOpts.Workers),
+		models: make(map[string]*Engine),
+	}
+	if hostOpts.ArenaSize > 0 {
+		h.slab = core.AlignedBytes(int(core.AlignedSize(hostOpts.ArenaSize)))
+	}
+	return h
+}
+
+// Load reads a compiled .subl model from path and hosts it under name.
+func (h *Host) Load(name, path string) error {
+	graph, err := ReadGraph(path, h.opts.VerifyKey)
+	if err != nil {
+		return fmt.Errorf("failed to load model %q: %w", name, err)
+	}
+	return h.Add(name, graph)
+}
+
+// Add hosts an in-memory graph under name.
+func (h *Host) Add(name string, graph *model.Graph) error {
+	if graph == nil {
+		return fmt.Errorf("graph for model %q cannot be nil", name)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.pool == nil {
+		return ErrClosed
+	}
+	if _, exists := h.models[name]; exists {
+		return fmt.Errorf("model %q already loaded", name)
+	}
+
+	size := core.AlignedSize(calculateArenaSize(graph))
+	backing, err := h.reserve(size)
+	if err != nil {
+		return fmt.Errorf("model %q: %w", name, err)
+	}
+
+	engine, err := newEngine(graph, &EngineOptions{
+		Workers:     h.opts.Workers,
+		ArenaSize:   size,
+		EnableStats: h.opts.EnableStats,
+		Streaming:   h.opts.Streaming,
+	}, backing)
+	if err != nil {
+		h.offset -= uintptr(len(backing))
+		return fmt.Errorf("failed to create engine for model %q: %w", name, err)
+	}
+	engine.pool = h.pool
+
+	h.models[name] = engine
+	return nil
+}
+
+// reserve carves the next segment from the shared arena. It returns nil when
+// the host has no shared arena. Must be called with h.mu held.
+func (h *Host) reserve(size uintptr) ([]byte, error) {
+	if h.slab == nil {
+		return nil, nil
+	}
+	if h.offset+size > uintptr(len(h.slab)) {
+		return nil, fmt.Errorf("shared arena exhausted: need %d bytes, %d of %d free",
+			size, uintptr(len(h.slab))-h.offset, len(h.slab))
+	}
+	segment := h.slab[h.offset : h.offset+size : h.offset+size]
+	h.offset += size
+	return segment, nil
+}
+
+// Engine returns the engine serving name.
+func (h *Host) Engine(name string) (*Engine, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	e, ok := h.models[name]
+	return e, ok
+}
+
+// Workers returns the size of the shared worker pool.
+func (h *Host) Workers() int {
+	return h.opts.Workers
+}
+
+// Models returns the hosted model names in sorted order.
+func (h *Host) Models() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return sortedKeys(h.models)
+}
+
+// Execute runs the named model. Calls for the same model are serialized;
+// different models run concurrently on the shared pool.
+func (h *Host) Execute(name string, ctx *ExecutionContext) error {
+	e, ok := h.Engine(name)
+	if !ok {
+		return fmt.Errorf("model %q not loaded", name)
+	}
+	e.admission.acquire(PriorityNormal)
+	defer e.admission.release()
+	return e.Execute(ctx)
+}
+
+// ExecuteStreaming routes a streaming request to the named model.
+func (h *Host) ExecuteStreaming(name string, p Priority, input, output []byte) error {
+	e, ok := h.Engine(name)
+	if !ok {
+		return fmt.Errorf("model %q not loaded", name)
+	}
+	return e.ExecuteStreamingPriority(p, input, output)
+}
+
+// ArenaUsed returns the bytes of the shared arena handed out to models.
+func (h *Host) ArenaUsed() uintptr {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.offset
+}
+
+// Close closes every hosted engine, then stops the shared worker pool and
+// drops the shared arena. It returns ctx.Err() if the engines do not drain in
+// time, in which case the pool is left running.
+func (h *Host) Close(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, name := range sortedKeys(h.models) {
+		if err := h.models[name].Close(ctx); err != nil {
+			return fmt.Errorf("failed to close model %q: %w", name, err)
+		}
+	}
+	if h.pool != nil {
+		h.pool.stop()
+		h.pool = nil
+	}
+	h.models = make(map[string]*Engine)
+	h.slab = nil
+	h.offset = 0
+	return nil
+}
+
+// sortedKeys returns the model names of m in sorted order.
+func sortedKeys(m map[string]*Engine) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
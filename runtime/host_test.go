@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func hostTestGraph() *model.Graph {
+	return &model.Graph{
+		Payload: make([]byte, 128),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+		},
+	}
+}
+
+func TestHostSharedArena(t *testing.T) {
+	t.Parallel()
+	host := NewHost(&HostOptions{Workers: 2, ArenaSize: 1 << 20, Streaming: true})
+	defer host.Close(context.Background())
+
+	for _, name := range []string{"b", "a", "c"} {
+		if err := host.Add(name, hostTestGraph()); err != nil {
+			t.Fatalf("Add(%q) failed: %v", name, err)
+		}
+	}
+	if err := host.Add("a", hostTestGraph()); err == nil {
+		t.Error("Expected error adding duplicate model")
+	}
+
+	models := host.Models()
+	if len(models) != 3 || models[0] != "a" || models[2] != "c" {
+		t.Errorf("Expected sorted models [a b c], got %v", models)
+	}
+	if host.ArenaUsed() == 0 {
+		t.Error("Expected models to occupy the shared arena")
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range models {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				if err := host.Execute(name, NewExecutionContext(2)); err != nil {
+					t.Errorf("Execute(%q) failed: %v", name, err)
+				}
+			}(name)
+		}
+	}
+	wg.Wait()
+
+	if err := host.Execute("missing", NewExecutionContext(0)); err == nil {
+		t.Error("Expected error executing unknown model")
+	}
+}
+
+func TestHostArenaExhausted(t *testing.T) {
+	t.Parallel()
+	host := NewHost(&HostOptions{Workers: 1, ArenaSize: 128, Streaming: true})
+	defer host.Close(context.Background())
+
+	if err := host.Add("big", hostTestGraph()); err == nil {
+		t.Fatal("Expected error when model does not fit the shared arena")
+	}
+	if host.ArenaUsed() != 0 {
+		t.Errorf("Expected failed Add to release its segment, %d bytes still used", host.ArenaUsed())
+	}
+}
@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sbl8/sublation/core"
+)
+
+// HugePagePolicy selects how the engine's arena is backed by huge pages.
+type HugePagePolicy int
+
+const (
+	// HugePagesNone allocates the arena on the Go heap.
+	HugePagesNone HugePagePolicy = iota
+	// HugePagesTransparent maps the arena anonymously and asks the kernel to
+	// back it with transparent huge pages (madvise MADV_HUGEPAGE).
+	HugePagesTransparent
+	// HugePagesExplicit maps the arena from the reserved hugetlb pool
+	// (MAP_HUGETLB), falling back to transparent huge pages when the pool
+	// is empty.
+	HugePagesExplicit
+)
+
+// hugePageSize is the huge page granularity arena mappings are rounded to.
+const hugePageSize = 2 << 20
+
+// String returns the policy name as used in flags and logs.
+func (p HugePagePolicy) String() string {
+	switch p {
+	case HugePagesNone:
+		return "none"
+	case HugePagesTransparent:
+		return "transparent"
+	case HugePagesExplicit:
+		return "explicit"
+	default:
+		return fmt.Sprintf("HugePagePolicy(%d)", int(p))
+	}
+}
+
+// ParseHugePagePolicy converts a policy name ("none", "transparent", "explicit") into a HugePagePolicy.
+func ParseHugePagePolicy(name string) (HugePagePolicy, error) {
+	switch name {
+	case "", "none":
+		return HugePagesNone, nil
+	case "transparent":
+		return HugePagesTransparent, nil
+	case "explicit":
+		return HugePagesExplicit, nil
+	default:
+		return HugePagesNone, fmt.Errorf("unknown huge page policy %q (want none, transparent or explicit)", name)
+	}
+}
+
+// errHugePagesUnsupported is returned by mapHugePages when the platform cannot
+// provide huge pages. The arena then falls back to the Go heap.
+var errHugePagesUnsupported = errors.New("huge pages not supported")
+
+// allocateHugeArena maps size bytes under policy, degrading from explicit to
+// transparent huge pages. It returns the policy actually obtained and a
+// function that unmaps the memory, or HugePagesNone and nil on fallback.
+func allocateHugeArena(size uintptr, policy HugePagePolicy) ([]byte, HugePagePolicy, func() error) {
+	length := core.AlignSize(int(core.AlignedSize(size)), hugePageSize)
+	for p := policy; p > HugePagesNone; p-- {
+		buf, unmap, err := mapHugePages(length, p)
+		if err == nil {
+			return buf, p, unmap
+		}
+	}
+	return nil, HugePagesNone, nil
+}
+
+// setupHugePages backs the engine's resident arena with huge pages when
+// requested. Execute reuses that arena instead of allocating per call, and
+// Close unmaps it.
+func (e *Engine) setupHugePages() {
+	if e.opts.HugePages == HugePagesNone || e.backing != nil || e.opts.ArenaSize == 0 {
+		return
+	}
+	buf, obtained, unmap := allocateHugeArena(e.opts.ArenaSize, e.opts.HugePages)
+	e.stats.ArenaHugePages = obtained
+	if buf == nil {
+		return
+	}
+	e.backing = buf
+	e.unmapArena = unmap
+}
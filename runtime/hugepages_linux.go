@@ -0,0 +1,28 @@
+//go:build linux
+
+package runtime
+
+import "syscall"
+
+// mapHugePages maps length bytes of anonymous memory backed by huge pages.
+func mapHugePages(length int, policy HugePagePolicy) ([]byte, func() error, error) {
+	flags := syscall.MAP_PRIVATE | syscall.MAP_ANONYMOUS
+	if policy == HugePagesExplicit {
+		flags |= syscall.MAP_HUGETLB
+	}
+
+	buf, err := syscall.Mmap(-1, 0, length, syscall.PROT_READ|syscall.PROT_WRITE, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if policy == HugePagesTransparent {
+		if err := syscall.Madvise(buf, syscall.MADV_HUGEPAGE); err != nil {
+			// THP disabled or unsupported: the mapping would be regular pages
+			_ = syscall.Munmap(buf)
+			return nil, nil, err
+		}
+	}
+
+	return buf, func() error { return syscall.Munmap(buf) }, nil
+}
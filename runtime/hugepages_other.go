@@ -0,0 +1,8 @@
+//go:build !linux
+
+package runtime
+
+// mapHugePages is not available outside Linux.
+func mapHugePages(length int, policy HugePagePolicy) ([]byte, func() error, error) {
+	return nil, nil, errHugePagesUnsupported
+}
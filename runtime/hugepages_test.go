@@ -0,0 +1,68 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestHugePageArena(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 128},
+			{ID: 1, Kernel: 1, In: 128, Out: 256, Topo: []uint32{0}},
+		},
+	}
+
+	for _, policy := range []HugePagePolicy{HugePagesTransparent, HugePagesExplicit} {
+		engine, err := NewEngine(graph, &EngineOptions{
+			Workers:     2,
+			ArenaSize:   1 << 20,
+			Streaming:   true,
+			EnableStats: true,
+			HugePages:   policy,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine with %s huge pages failed: %v", policy, err)
+		}
+
+		obtained := engine.Stats().ArenaHugePages
+		if obtained > policy {
+			t.Errorf("Obtained %s huge pages when %s was requested", obtained, policy)
+		}
+		if (obtained != HugePagesNone) != (engine.unmapArena != nil) {
+			t.Errorf("Huge page state %s inconsistent with arena mapping", obtained)
+		}
+
+		for i := 0; i < 2; i++ {
+			if err := engine.Execute(NewExecutionContext(len(graph.Nodes))); err != nil {
+				t.Fatalf("Execute with %s huge pages failed: %v", policy, err)
+			}
+		}
+		if err := engine.Close(context.Background()); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if engine.unmapArena != nil {
+			t.Error("Expected Close to unmap the arena")
+		}
+	}
+}
+
+func TestParseHugePagePolicy(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"none", "transparent", "explicit"} {
+		p, err := ParseHugePagePolicy(name)
+		if err != nil {
+			t.Fatalf("ParseHugePagePolicy(%q) failed: %v", name, err)
+		}
+		if p.String() != name {
+			t.Errorf("Round trip of %q produced %q", name, p.String())
+		}
+	}
+	if _, err := ParseHugePagePolicy("gigantic"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
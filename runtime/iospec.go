@@ -0,0 +1,43 @@
+package runtime
+
+import "github.com/sbl8/sublation/model"
+
+// IODescriptor describes a named model input or output: its declared dtype
+// and shape, and the node payload that holds it in the engine.
+type IODescriptor struct {
+	model.IOSpec
+	Index int // Position of the node in Graph().Nodes
+	Size  int // Bytes of the node payload
+}
+
+// Inputs describes the named inputs the model declares, in declaration
+// order. Models without an IO table return nil.
+func (e *Engine) Inputs() []IODescriptor {
+	return e.describe(e.graph.Inputs())
+}
+
+// Outputs describes the named outputs the model declares, in declaration
+// order. Models without an IO table return nil.
+func (e *Engine) Outputs() []IODescriptor {
+	return e.describe(e.graph.Outputs())
+}
+
+// describe resolves specs to the nodes they name. Validate guarantees every
+// node exists; unresolved specs keep Index -1 and Size 0.
+func (e *Engine) describe(specs []model.IOSpec) []IODescriptor {
+	if len(specs) == 0 {
+		return nil
+	}
+	descs := make([]IODescriptor, len(specs))
+	for i, s := range specs {
+		descs[i] = IODescriptor{IOSpec: s, Index: -1}
+		for j := range e.graph.Nodes {
+			if e.graph.Nodes[j].ID == s.NodeID {
+				descs[i].Index = j
+				descs[i].Size = calculateNodePayloadSize(&e.graph.Nodes[j], e.graph)
+				break
+			}
+		}
+	}
+	return descs
+}
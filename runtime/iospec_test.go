@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// ioGraph is memoGraph with payload past the last node's output offset, as
+// Validate requires.
+func ioGraph() *model.Graph {
+	graph := memoGraph()
+	graph.Payload = append(graph.Payload, make([]byte, 32)...)
+	return graph
+}
+
+func TestIOSpecRoundTrip(t *testing.T) {
+	t.Parallel()
+	graph := ioGraph()
+	graph.IO = []model.IOSpec{
+		{Name: "pixels", Kind: model.Input, NodeID: 0, DType: model.Float32, Shape: []int{4, 4}},
+		{Name: "logits", Kind: model.Output, NodeID: 1, DType: model.Float32, Shape: []int{16}},
+	}
+	if err := graph.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	data, err := graph.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "io.subl")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	engine, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	inputs, outputs := engine.Inputs(), engine.Outputs()
+	if len(inputs) != 1 || len(outputs) != 1 {
+		t.Fatalf("Expected 1 input and 1 output, got %v and %v", inputs, outputs)
+	}
+	in := inputs[0]
+	if in.Name != "pixels" || in.Index != 0 || !slices.Equal(in.Shape, []int{4, 4}) || in.Bytes() != 64 {
+		t.Errorf("Unexpected input descriptor %+v", in)
+	}
+	if in.Size < in.Bytes() {
+		t.Errorf("Expected node payload of at least %d bytes, got %d", in.Bytes(), in.Size)
+	}
+	if got := outputs[0].String(); got != "logits:float32[16]@1" {
+		t.Errorf("Expected logits:float32[16]@1, got %s", got)
+	}
+
+	// Graphs without an IO table omit the section
+	graph.IO = nil
+	if data, err = graph.Serialize(); err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	plain, err := model.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if plain.IO != nil {
+		t.Errorf("Expected no IO table, got %v", plain.IO)
+	}
+}
+
+func TestIOSpecValidate(t *testing.T) {
+	t.Parallel()
+	for name, spec := range map[string]model.IOSpec{
+		"missing node": {Name: "x", NodeID: 9, Shape: []int{1}},
+		"empty name":   {NodeID: 0, Shape: []int{1}},
+		"bad dim":      {Name: "x", NodeID: 0, Shape: []int{0}},
+		"bad dtype":    {Name: "x", NodeID: 0, DType: 200},
+	} {
+		graph := ioGraph()
+		graph.IO = []model.IOSpec{spec}
+		if err := graph.Validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+
+	graph := ioGraph()
+	graph.IO = []model.IOSpec{{Name: "x", NodeID: 0}, {Name: "x", NodeID: 1}}
+	if err := graph.Validate(); err == nil {
+		t.Error("Expected duplicate input names to fail validation")
+	}
+	graph.IO[1].Kind = model.Output
+	if err := graph.Validate(); err != nil {
+		t.Errorf("Expected an input and output to share a name, got %v", err)
+	}
+
+	if d, err := model.ParseDType("INT8"); err != nil || d != model.Int8 {
+		t.Errorf("Expected int8, got %v (err %v)", d, err)
+	}
+	if _, err := model.ParseDType("complex64"); err == nil {
+		t.Error("Expected an error for an unknown dtype")
+	}
+}
+
+func TestGraphDiagrams(t *testing.T) {
+	t.Parallel()
+	graph := ioGraph()
+	graph.Nodes[2].Topo = append(graph.Nodes[2].Topo, 0, 1, model.NoNeighbor, 77)
+	graph.IO = []model.IOSpec{{Name: `say "hi"`, Kind: model.Input, NodeID: 0, Shape: []int{4}}}
+
+	var dot, mermaid bytes.Buffer
+	if err := graph.ToDOT(&dot); err != nil {
+		t.Fatalf("ToDOT failed: %v", err)
+	}
+	if err := graph.ToMermaid(&mermaid); err != nil {
+		t.Fatalf("ToMermaid failed: %v", err)
+	}
+	for _, want := range []string{"digraph sublation {", "n0 -> n2;", "n1 -> n2;", `input say \"hi\":float32[4]@0`, "style=bold", kernels.OpName(graph.Nodes[1].Kernel)} {
+		if !strings.Contains(dot.String(), want) {
+			t.Errorf("Expected DOT output to contain %q:\n%s", want, dot.String())
+		}
+	}
+	for _, want := range []string{"flowchart LR", "n0 --> n2", "n1 --> n2", "say #quot;hi#quot;", "<br/>"} {
+		if !strings.Contains(mermaid.String(), want) {
+			t.Errorf("Expected Mermaid output to contain %q:\n%s", want, mermaid.String())
+		}
+	}
+	if strings.Contains(dot.String(), "n77") || strings.Contains(dot.String(), "n4294967295") {
+		t.Errorf("Expected edges to missing nodes to be skipped:\n%s", dot.String())
+	}
+}
@@ -0,0 +1,113 @@
+package ioutil
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+// Check reports whether t has the dtype and shape spec declares
+func Check(spec model.IOSpec, t Tensor) error {
+	if t.DType != spec.DType || !slices.Equal(t.Shape, spec.Shape) {
+		want := Tensor{DType: spec.DType, Shape: spec.Shape}
+		return fmt.Errorf("%v %q: want %v, got %v", spec.Kind, spec.Name, want, t)
+	}
+	return nil
+}
+
+// BindInputs checks tensors, keyed by input name, against the inputs g
+// declares and copies each into the payload of its node, where executions
+// read it. Every declared input must be given; unknown names are errors.
+// When g declares a single input, a lone tensor binds to it whatever its
+// name, so a plain .npy file can feed a model.
+func BindInputs(g *model.Graph, tensors map[string]Tensor) error {
+	inputs := g.Inputs()
+	if len(inputs) == 0 {
+		return fmt.Errorf("model declares no inputs")
+	}
+	if len(inputs) == 1 && len(tensors) == 1 {
+		for _, t := range tensors {
+			tensors = map[string]Tensor{inputs[0].Name: t}
+		}
+	}
+	for name := range tensors {
+		if !slices.ContainsFunc(inputs, func(s model.IOSpec) bool { return s.Name == name }) {
+			return fmt.Errorf("model has no input %q", name)
+		}
+	}
+
+	for _, spec := range inputs {
+		t, ok := tensors[spec.Name]
+		if !ok {
+			return fmt.Errorf("missing input %q", spec.Name)
+		}
+		if err := Check(spec, t); err != nil {
+			return err
+		}
+		i := slices.IndexFunc(g.Nodes, func(n model.Node) bool { return n.ID == spec.NodeID })
+		if i < 0 {
+			return fmt.Errorf("input %q references non-existent node %d", spec.Name, spec.NodeID)
+		}
+		n := g.Nodes[i]
+		if n.Out < n.In || int(n.Out-n.In) < len(t.Data) || int(n.Out) > len(g.Payload) {
+			return fmt.Errorf("input %q: %d bytes do not fit the payload [%d, %d) of node %d", spec.Name, len(t.Data), n.In, n.Out, n.ID)
+		}
+		copy(g.Payload[n.In:], t.Data)
+	}
+	return nil
+}
+
+// OutputCollector is a runtime.Observer that keeps the outputs of the output
+// nodes of a model after their kernels run, so an execution's declared
+// outputs can be read as tensors
+type OutputCollector struct {
+	specs []model.IOSpec
+
+	mu   sync.Mutex
+	data map[uint32][]byte
+}
+
+// NewOutputCollector creates a collector for the outputs g declares
+func NewOutputCollector(g *model.Graph) *OutputCollector {
+	return &OutputCollector{specs: g.Outputs(), data: make(map[uint32][]byte)}
+}
+
+// BeforeNode implements runtime.Observer.
+func (c *OutputCollector) BeforeNode(runtime.NodeEvent) {}
+
+// AfterNode implements runtime.Observer.
+func (c *OutputCollector) AfterNode(ev runtime.NodeEvent) {
+	for _, s := range c.specs {
+		if s.NodeID == ev.NodeID {
+			c.mu.Lock()
+			c.data[ev.NodeID] = append(c.data[ev.NodeID][:0], ev.Output...)
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// AfterRun implements runtime.Observer.
+func (c *OutputCollector) AfterRun(runtime.RunEvent) {}
+
+// Outputs returns the declared outputs of the most recent execution, keyed
+// by name, each cut to its declared dtype and shape
+func (c *OutputCollector) Outputs() (map[string]Tensor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]Tensor, len(c.specs))
+	for _, s := range c.specs {
+		data, ok := c.data[s.NodeID]
+		if !ok {
+			return nil, fmt.Errorf("output %q: node %d did not run", s.Name, s.NodeID)
+		}
+		if len(data) < s.Bytes() {
+			return nil, fmt.Errorf("output %q: node %d produced %d bytes, want %d", s.Name, s.NodeID, len(data), s.Bytes())
+		}
+		out[s.Name] = Tensor{DType: s.DType, Shape: slices.Clone(s.Shape), Data: slices.Clone(data[:s.Bytes()])}
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+package ioutil
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+// Calibrate runs g once per sample of batch with a runtime.Calibrator
+// watching and returns the node ranges it recorded and the number of
+// samples. Each tensor of batch stacks the samples of the declared input of
+// its name along a leading axis, or is a single sample of that input; as
+// with BindInputs, a lone tensor feeds a lone input whatever its name. All
+// inputs must have the same number of samples. g itself is not modified.
+func Calibrate(g *model.Graph, batch map[string]Tensor) (map[uint32]model.Range, int, error) {
+	inputs := g.Inputs()
+	if len(inputs) == 0 {
+		return nil, 0, fmt.Errorf("model declares no inputs")
+	}
+	if len(inputs) == 1 && len(batch) == 1 {
+		for _, t := range batch {
+			batch = map[string]Tensor{inputs[0].Name: t}
+		}
+	}
+	samples := -1
+	for _, spec := range inputs {
+		t, ok := batch[spec.Name]
+		if !ok {
+			return nil, 0, fmt.Errorf("missing calibration data for input %q", spec.Name)
+		}
+		n := 1
+		if !slices.Equal(t.Shape, spec.Shape) {
+			if len(t.Shape) != len(spec.Shape)+1 || !slices.Equal(t.Shape[1:], spec.Shape) || t.DType != spec.DType {
+				want := Tensor{DType: spec.DType, Shape: append([]int{-1}, spec.Shape...)}
+				return nil, 0, fmt.Errorf("calibration data for input %q: want %v or a single sample, got %v", spec.Name, want, t)
+			}
+			n = t.Shape[0]
+		}
+		if samples >= 0 && n != samples {
+			return nil, 0, fmt.Errorf("calibration data for input %q has %d samples, want %d", spec.Name, n, samples)
+		}
+		samples = n
+	}
+	if samples == 0 {
+		return nil, 0, fmt.Errorf("calibration data has no samples")
+	}
+
+	calibrator := runtime.NewCalibrator()
+	for k := range samples {
+		if err := calibrateSample(g, batch, inputs, k, calibrator); err != nil {
+			return nil, 0, fmt.Errorf("calibration sample %d: %w", k, err)
+		}
+	}
+	return calibrator.Ranges(), samples, nil
+}
+
+// calibrateSample runs g on sample k of batch with calibrator watching
+func calibrateSample(g *model.Graph, batch map[string]Tensor, inputs []model.IOSpec, k int, calibrator *runtime.Calibrator) error {
+	run := *g
+	run.Payload = slices.Clone(g.Payload)
+	sample := make(map[string]Tensor, len(inputs))
+	for _, spec := range inputs {
+		size := spec.Bytes()
+		sample[spec.Name] = Tensor{DType: spec.DType, Shape: spec.Shape, Data: batch[spec.Name].Data[k*size : (k+1)*size]}
+	}
+	if err := BindInputs(&run, sample); err != nil {
+		return err
+	}
+	engine, err := runtime.NewEngine(&run, &runtime.EngineOptions{Workers: 1, Deterministic: true})
+	if err != nil {
+		return err
+	}
+	defer engine.Close(context.Background())
+	engine.AddObserver(calibrator)
+	return engine.Run()
+}
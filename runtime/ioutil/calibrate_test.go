@@ -0,0 +1,92 @@
+package ioutil
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+func TestCalibrateQuantize(t *testing.T) {
+	t.Parallel()
+	// x, 2x3, feeds a matmul by a 3x4 weight, whose A operand in the
+	// payload is a placeholder the propagated x replaces
+	a := []float32{0.5, -1, 2, 1.5, 0.25, -0.75}
+	w := []float32{0.1, -0.2, 0.3, -0.4, 0.5, 0.6, -0.7, 0.8, 0.9, -1.0, 0.05, 0.15}
+	mm := binary.LittleEndian.AppendUint16(nil, 2)
+	mm = binary.LittleEndian.AppendUint16(mm, 3)
+	mm = binary.LittleEndian.AppendUint16(mm, 4)
+	mm = append(mm, make([]byte, 4*len(a))...)
+	mm = append(mm, floats(w...)...)
+	payload := append(make([]byte, 32), mm...)
+	payload = append(payload, make([]byte, 64)...)
+	g := &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpNoop, In: 0, Out: 24},
+			{ID: 2, Kernel: kernels.OpMatMul, In: 32, Out: uint32(32 + len(mm)), Topo: []uint32{1}},
+		},
+		IO: []model.IOSpec{{Name: "x", Kind: model.Input, NodeID: 1, Shape: []int{2, 3}}},
+	}
+	before := slices.Clone(g.Payload)
+
+	matmul := func(x []float32) []float32 {
+		y := make([]float32, 8)
+		for i := range 2 {
+			for j := range 4 {
+				for k := range 3 {
+					y[i*4+j] += x[i*3+k] * w[k*4+j]
+				}
+			}
+		}
+		return y
+	}
+	b := []float32{-3, 0, 1, 1, 0, 2.5}
+	batch := map[string]Tensor{"calib": {DType: model.Float32, Shape: []int{2, 2, 3}, Data: floats(append(slices.Clone(a), b...)...)}}
+	ranges, samples, err := Calibrate(g, batch)
+	if err != nil {
+		t.Fatalf("Calibrate failed: %v", err)
+	}
+	if samples != 2 || ranges[1] != (model.Range{Min: -3, Max: 2.5}) {
+		t.Errorf("Expected node 1 to range over [-3, 2.5] in 2 samples, got %v in %d", ranges[1], samples)
+	}
+	// The matmul range covers the products of both samples, and nothing
+	// else of its buffer
+	y := append(matmul(a), matmul(b)...)
+	want := model.Range{Min: slices.Min(y), Max: slices.Max(y)}
+	if got := ranges[2]; math.Abs(float64(got.Min-want.Min)) > 1e-6 || math.Abs(float64(got.Max-want.Max)) > 1e-6 {
+		t.Errorf("Expected node 2 to range over %v, got %v", want, got)
+	}
+	if !slices.Equal(g.Payload, before) {
+		t.Error("Expected Calibrate to leave the graph payload alone")
+	}
+
+	n, err := g.QuantizeInt8(ranges)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 quantized node, got %d, %v", n, err)
+	}
+	q := g.Nodes[1]
+	if q.Kernel != kernels.OpMatMulQ8 || !slices.Equal(g.Shapes[2], []int{2, 4}) {
+		t.Fatalf("Expected a [2, 4] matmul_q8 node, got %s with shape %v", kernels.OpName(q.Kernel), g.Shapes[2])
+	}
+	data := slices.Clone(g.Payload[q.In:q.Out])
+	if scale := math.Float32frombits(binary.LittleEndian.Uint32(data[8:])); scale != 3.0/127 {
+		t.Errorf("Expected the activation scale 3/127 from the calibrated range, got %v", scale)
+	}
+	copy(data[kernels.MatMulQ8Header:], floats(a...))
+	kernels.Catalog[kernels.OpMatMulQ8](data)
+	out := data[kernels.MatMulQ8Header+24:]
+	for i, want := range matmul(a) {
+		got := math.Float32frombits(binary.LittleEndian.Uint32(out[4*i:]))
+		if math.Abs(float64(got-want)) > 0.05 {
+			t.Errorf("Element (%d, %d): expected about %v, got %v", i/4, i%4, want, got)
+		}
+	}
+
+	if _, _, err := Calibrate(g, map[string]Tensor{"x": {DType: model.Float32, Shape: []int{2, 4}, Data: make([]byte, 32)}}); err == nil {
+		t.Error("Expected an error for calibration data of the wrong shape")
+	}
+}
@@ -0,0 +1,305 @@
+// Package ioutil moves typed tensors between NumPy files and models.
+//
+// ReadNPY, ReadNPZ, ReadFile, WriteNPY and WriteNPZ convert between
+// .npy/.npz files and Tensor values, and ReadNPYHeader locates the array
+// of a .npy file without loading it; WriteCSV, WriteFloat32 and
+// Tensor.MarshalJSON write tensors for other tools, and ParseCSV,
+// ParseJSON and ParseFloat32 read typed inputs from them. BindInputs
+// checks tensors against a model's declared inputs and copies them into
+// the payload of the nodes that hold them, OutputCollector captures the
+// declared outputs of an execution as tensors, and Calibrate runs a model
+// over a batch of inputs to record the value ranges quantization needs.
+package ioutil
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// npyMagic opens every .npy file
+const npyMagic = "\x93NUMPY"
+
+// Tensor is a dense tensor in row-major order with little-endian elements
+type Tensor struct {
+	DType model.DType
+	Shape []int // Outermost first; empty for a scalar
+	Data  []byte
+}
+
+// Elements returns the number of elements of the tensor
+func (t Tensor) Elements() int {
+	n := 1
+	for _, d := range t.Shape {
+		n *= d
+	}
+	return n
+}
+
+// String formats the tensor type as dtype[d0,d1,...]
+func (t Tensor) String() string {
+	dims := make([]string, len(t.Shape))
+	for i, d := range t.Shape {
+		dims[i] = strconv.Itoa(d)
+	}
+	return fmt.Sprintf("%v[%s]", t.DType, strings.Join(dims, ","))
+}
+
+// npyDescrs maps NumPy type codes, without byte order, to dtypes
+var npyDescrs = map[string]model.DType{
+	"f4": model.Float32,
+	"f2": model.Float16,
+	"i4": model.Int32,
+	"i1": model.Int8,
+	"u1": model.Uint8,
+}
+
+// npyDescr returns the NumPy type string of a dtype
+func npyDescr(d model.DType) string {
+	for code, dt := range npyDescrs {
+		if dt == d {
+			if d.Size() == 1 {
+				return "|" + code
+			}
+			return "<" + code
+		}
+	}
+	return ""
+}
+
+// ReadNPY reads a .npy file (format versions 1 to 3) holding a C-ordered
+// little-endian array of a dtype models support
+func ReadNPY(r io.Reader) (Tensor, error) {
+	return readNPY(r, -1)
+}
+
+// readNPY reads a .npy file of size bytes, or of unknown size when
+// negative. The data is read as it arrives rather than allocated up front
+// from the header, so a header claiming more than the file holds fails
+// without exhausting memory.
+func readNPY(r io.Reader, size int64) (Tensor, error) {
+	t, offset, err := ReadNPYHeader(r)
+	if err != nil {
+		return Tensor{}, err
+	}
+	n := int64(t.Elements()) * int64(t.DType.Size())
+	if size >= 0 && n > size-offset {
+		return Tensor{}, fmt.Errorf("npy: %v data of %d bytes exceeds the %d-byte file", t, n, size)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, n); err != nil {
+		return Tensor{}, fmt.Errorf("npy: truncated %v data: %w", t, err)
+	}
+	t.Data = buf.Bytes()
+	return t, nil
+}
+
+// ReadNPYHeader reads the header of a .npy file, leaving r at the start of
+// the array data. It returns the array's dtype and shape, without Data,
+// and the offset of the data in the file, for readers that load slices of
+// the array on demand.
+func ReadNPYHeader(r io.Reader) (Tensor, int64, error) {
+	var pre [8]byte
+	if _, err := io.ReadFull(r, pre[:]); err != nil {
+		return Tensor{}, 0, fmt.Errorf("npy: truncated preamble: %w", err)
+	}
+	if string(pre[:6]) != npyMagic {
+		return Tensor{}, 0, fmt.Errorf("npy: invalid magic %q", pre[:6])
+	}
+	var headerLen, lenBytes int
+	switch pre[6] {
+	case 1:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return Tensor{}, 0, fmt.Errorf("npy: truncated header length: %w", err)
+		}
+		headerLen, lenBytes = int(binary.LittleEndian.Uint16(b[:])), 2
+	case 2, 3:
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return Tensor{}, 0, fmt.Errorf("npy: truncated header length: %w", err)
+		}
+		headerLen, lenBytes = int(binary.LittleEndian.Uint32(b[:])), 4
+		if headerLen > 1<<20 {
+			return Tensor{}, 0, fmt.Errorf("npy: header of %d bytes is too long", headerLen)
+		}
+	default:
+		return Tensor{}, 0, fmt.Errorf("npy: unsupported format version %d.%d", pre[6], pre[7])
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Tensor{}, 0, fmt.Errorf("npy: truncated header: %w", err)
+	}
+	t, err := parseNPYHeader(string(header))
+	if err != nil {
+		return Tensor{}, 0, fmt.Errorf("npy: %w", err)
+	}
+	return t, int64(len(pre) + lenBytes + headerLen), nil
+}
+
+// parseNPYHeader parses the Python dict literal of a .npy header, such as
+// {'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }
+func parseNPYHeader(h string) (Tensor, error) {
+	field := func(key string) (string, error) {
+		i := strings.Index(h, "'"+key+"'")
+		if i < 0 {
+			return "", fmt.Errorf("header lacks %q", key)
+		}
+		rest := strings.TrimLeft(h[i+len(key)+2:], " ")
+		if !strings.HasPrefix(rest, ":") {
+			return "", fmt.Errorf("malformed %q", key)
+		}
+		rest = strings.TrimLeft(rest[1:], " ")
+		var end int
+		switch {
+		case strings.HasPrefix(rest, "'"):
+			end = strings.IndexByte(rest[1:], '\'') + 2
+		case strings.HasPrefix(rest, "("):
+			end = strings.IndexByte(rest, ')') + 1
+		default:
+			end = strings.IndexAny(rest, ",}")
+		}
+		if end <= 0 {
+			return "", fmt.Errorf("malformed %q", key)
+		}
+		return rest[:end], nil
+	}
+
+	descr, err := field("descr")
+	if err != nil {
+		return Tensor{}, err
+	}
+	descr = strings.Trim(descr, "'")
+	if len(descr) < 2 {
+		return Tensor{}, fmt.Errorf("malformed descr %q", descr)
+	}
+	order, code := descr[0], descr[1:]
+	dtype, ok := npyDescrs[code]
+	if !ok || (order == '>' && dtype.Size() > 1) || !strings.ContainsRune("<>|=", rune(order)) {
+		return Tensor{}, fmt.Errorf("unsupported dtype %q (want little-endian f4, f2, i4, i1 or u1)", descr)
+	}
+
+	fortran, err := field("fortran_order")
+	if err != nil {
+		return Tensor{}, err
+	}
+	shapeText, err := field("shape")
+	if err != nil {
+		return Tensor{}, err
+	}
+	t := Tensor{DType: dtype, Shape: []int{}}
+	for _, dim := range strings.Split(strings.Trim(shapeText, "()"), ",") {
+		if dim = strings.TrimSpace(dim); dim == "" {
+			continue
+		}
+		n, err := strconv.Atoi(dim)
+		if err != nil || n < 0 {
+			return Tensor{}, fmt.Errorf("invalid dimension %q", dim)
+		}
+		t.Shape = append(t.Shape, n)
+	}
+	// The byte count must fit an int for Elements and the data buffer
+	size := dtype.Size()
+	for _, d := range t.Shape {
+		if d != 0 && size > math.MaxInt/d {
+			return Tensor{}, fmt.Errorf("shape %v of %v overflows the addressable size", t.Shape, dtype)
+		}
+		size *= d
+	}
+	if fortran == "True" && len(t.Shape) > 1 {
+		return Tensor{}, fmt.Errorf("fortran-ordered arrays are not supported")
+	}
+	return t, nil
+}
+
+// ReadNPZ reads the arrays of a .npz archive of the given size, keyed by
+// their names without the .npy extension
+func ReadNPZ(r io.ReaderAt, size int64) (map[string]Tensor, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("npz: %w", err)
+	}
+	tensors := make(map[string]Tensor, len(zr.File))
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("npz: %s: %w", f.Name, err)
+		}
+		t, err := readNPY(rc, int64(min(f.UncompressedSize64, math.MaxInt64)))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("npz: %s: %w", f.Name, err)
+		}
+		tensors[strings.TrimSuffix(f.Name, ".npy")] = t
+	}
+	return tensors, nil
+}
+
+// ReadFile reads the arrays of a .npy or .npz file; a .npy array is keyed
+// by the file name without extension
+func ReadFile(path string) (map[string]Tensor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".npz") {
+		return ReadNPZ(f, info.Size())
+	}
+	t, err := readNPY(bufio.NewReader(f), info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]Tensor{strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)): t}, nil
+}
+
+// WriteNPY writes t as a version 1.0 .npy file
+func WriteNPY(w io.Writer, t Tensor) error {
+	descr := npyDescr(t.DType)
+	if descr == "" {
+		return fmt.Errorf("npy: unsupported dtype %v", t.DType)
+	}
+	if len(t.Data) != t.Elements()*t.DType.Size() {
+		return fmt.Errorf("npy: %d data bytes do not match %v", len(t.Data), t)
+	}
+	dims := make([]string, len(t.Shape))
+	for i, d := range t.Shape {
+		dims[i] = strconv.Itoa(d)
+	}
+	shape := strings.Join(dims, ", ")
+	if len(dims) == 1 {
+		shape += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, shape)
+	// Pad with spaces and a newline so the data starts 64-byte aligned
+	pad := 63 - (len(npyMagic)+4+len(header))%64
+	header += strings.Repeat(" ", pad) + "\n"
+	if len(header) > 0xFFFF {
+		return fmt.Errorf("npy: rank %d header is too long", len(t.Shape))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(t.Data)
+	return err
+}
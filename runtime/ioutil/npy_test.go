@@ -0,0 +1,145 @@
+package ioutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+func floats(vs ...float32) []byte {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+	}
+	return b
+}
+
+func TestNPY(t *testing.T) {
+	t.Parallel()
+	want := Tensor{DType: model.Float32, Shape: []int{2, 2}, Data: floats(1, -2, 3, -4)}
+	var buf bytes.Buffer
+	if err := WriteNPY(&buf, want); err != nil {
+		t.Fatalf("WriteNPY failed: %v", err)
+	}
+	if data := buf.Bytes(); (len(data)-len(want.Data))%64 != 0 || !strings.Contains(string(data), "'shape': (2, 2)") {
+		t.Errorf("Expected a 64-byte aligned header with the shape, got %q", data[:len(data)-len(want.Data)])
+	}
+	got, err := ReadNPY(&buf)
+	if err != nil {
+		t.Fatalf("ReadNPY failed: %v", err)
+	}
+	if got.String() != "float32[2,2]" || !bytes.Equal(got.Data, want.Data) {
+		t.Errorf("Expected the tensor back, got %v %v", got, got.Data)
+	}
+
+	// A version 2 header and a 1-d uint8 array, as NumPy writes them
+	header := "{'descr': '|u1', 'fortran_order': False, 'shape': (3,), }\n"
+	v2 := []byte("\x93NUMPY\x02\x00")
+	v2 = binary.LittleEndian.AppendUint32(v2, uint32(len(header)))
+	v2 = append(append(v2, header...), 7, 8, 9)
+	if got, err := ReadNPY(bytes.NewReader(v2)); err != nil || got.DType != model.Uint8 || !slices.Equal(got.Shape, []int{3}) {
+		t.Errorf("Expected uint8[3], got %v (%v)", got, err)
+	}
+	if got, off, err := ReadNPYHeader(bytes.NewReader(v2)); err != nil || got.Data != nil || off != int64(len(v2)-3) {
+		t.Errorf("Expected the header with the data at %d, got %v at %d (%v)", len(v2)-3, got, off, err)
+	}
+
+	for _, bad := range []string{
+		"{'descr': '>f4', 'fortran_order': False, 'shape': (1,), }",
+		"{'descr': '<f8', 'fortran_order': False, 'shape': (1,), }",
+		"{'descr': '<f4', 'fortran_order': True, 'shape': (2, 2), }",
+		"{'descr': '<f4', 'fortran_order': False, 'shape': (4611686018427387904, 4), }",
+	} {
+		if _, err := parseNPYHeader(bad); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+
+	// A header claiming far more data than follows fails without
+	// allocating it, and more than the file holds fails up front
+	header = "{'descr': '<f4', 'fortran_order': False, 'shape': (17592186044416,), }\n"
+	huge := []byte("\x93NUMPY\x01\x00")
+	huge = binary.LittleEndian.AppendUint16(huge, uint16(len(header)))
+	huge = append(huge, header...)
+	if _, err := ReadNPY(bytes.NewReader(huge)); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("Expected truncated data, got %v", err)
+	}
+	if _, err := readNPY(bytes.NewReader(huge), int64(len(huge))); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Expected data exceeding the file, got %v", err)
+	}
+}
+
+func TestNPZ(t *testing.T) {
+	t.Parallel()
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, data := range map[string][]float32{"a": {1}, "b": {2, 3}} {
+		w, err := zw.Create(name + ".npy")
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		if err := WriteNPY(w, Tensor{DType: model.Float32, Shape: []int{len(data)}, Data: floats(data...)}); err != nil {
+			t.Fatalf("WriteNPY failed: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	tensors, err := ReadNPZ(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("ReadNPZ failed: %v", err)
+	}
+	if len(tensors) != 2 || tensors["b"].String() != "float32[2]" {
+		t.Errorf("Expected arrays a and b, got %v", tensors)
+	}
+}
+
+func TestBindInputs(t *testing.T) {
+	t.Parallel()
+	g := &model.Graph{
+		Payload: make([]byte, 64),
+		Nodes:   []model.Node{{ID: 0, Kernel: kernels.OpReLU, In: 0, Out: 16}},
+		IO: []model.IOSpec{
+			{Name: "x", Kind: model.Input, NodeID: 0, Shape: []int{4}},
+			{Name: "y", Kind: model.Output, NodeID: 0, Shape: []int{2, 2}},
+		},
+	}
+	if err := BindInputs(g, map[string]Tensor{"x": {DType: model.Float32, Shape: []int{2, 2}, Data: floats(1, 2, 3, 4)}}); err == nil {
+		t.Error("Expected a shape mismatch error")
+	}
+	if err := BindInputs(g, map[string]Tensor{"z": {}, "w": {}}); err == nil {
+		t.Error("Expected an error for unknown inputs")
+	}
+	// A lone tensor binds to the only input whatever its name
+	if err := BindInputs(g, map[string]Tensor{"data": {DType: model.Float32, Shape: []int{4}, Data: floats(1, -2, 3, -4)}}); err != nil {
+		t.Fatalf("BindInputs failed: %v", err)
+	}
+	if !bytes.Equal(g.Payload[:16], floats(1, -2, 3, -4)) {
+		t.Errorf("Expected the input in the payload of node 0, got %v", g.Payload[:16])
+	}
+
+	engine, err := runtime.NewEngine(g, &runtime.EngineOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	collector := NewOutputCollector(g)
+	engine.AddObserver(collector)
+	if err := engine.Execute(runtime.NewExecutionContext(len(g.Nodes))); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	outputs, err := collector.Outputs()
+	if err != nil {
+		t.Fatalf("Outputs failed: %v", err)
+	}
+	if y := outputs["y"]; y.String() != "float32[2,2]" || len(y.Data) != 16 {
+		t.Errorf("Expected the node data as float32[2,2], got %v with %d bytes", y, len(y.Data))
+	}
+}
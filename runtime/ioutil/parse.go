@@ -0,0 +1,214 @@
+package ioutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// FromValues encodes values as a tensor of the dtype and shape spec
+// declares. Integer dtypes take only whole values in their range.
+func FromValues(spec model.IOSpec, values []float64) (Tensor, error) {
+	t := Tensor{DType: spec.DType, Shape: slices.Clone(spec.Shape)}
+	if len(values) != t.Elements() {
+		return Tensor{}, fmt.Errorf("%v %q: got %d values, want %d for %v", spec.Kind, spec.Name, len(values), t.Elements(), t)
+	}
+	size := spec.DType.Size()
+	t.Data = make([]byte, len(values)*size)
+	for i, v := range values {
+		b := t.Data[i*size:]
+		switch spec.DType {
+		case model.Float32:
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+			continue
+		case model.Float16:
+			binary.LittleEndian.PutUint16(b, model.FloatToHalf(float32(v)))
+			continue
+		}
+		lo, hi := intRange(spec.DType)
+		if v != math.Trunc(v) || v < lo || v > hi {
+			return Tensor{}, fmt.Errorf("%v %q: element %d: %v does not fit %v", spec.Kind, spec.Name, i, v, spec.DType)
+		}
+		switch spec.DType {
+		case model.Int32:
+			binary.LittleEndian.PutUint32(b, uint32(int32(v)))
+		case model.Int8:
+			b[0] = byte(int8(v))
+		case model.Uint8:
+			b[0] = byte(v)
+		default:
+			return Tensor{}, fmt.Errorf("%v %q: unsupported dtype %v", spec.Kind, spec.Name, spec.DType)
+		}
+	}
+	return t, nil
+}
+
+// intRange returns the values an integer dtype holds
+func intRange(d model.DType) (lo, hi float64) {
+	switch d {
+	case model.Int32:
+		return math.MinInt32, math.MaxInt32
+	case model.Int8:
+		return math.MinInt8, math.MaxInt8
+	case model.Uint8:
+		return 0, math.MaxUint8
+	}
+	return 0, -1
+}
+
+// splitValues assigns values to inputs in declaration order, each taking
+// as many as its shape holds; the count must match exactly
+func splitValues(inputs []model.IOSpec, values []float64) (map[string]Tensor, error) {
+	want := 0
+	for _, s := range inputs {
+		want += s.Elements()
+	}
+	if len(values) != want {
+		return nil, fmt.Errorf("got %d values, the model inputs %s take %d", len(values), describeInputs(inputs), want)
+	}
+	tensors := make(map[string]Tensor, len(inputs))
+	for _, s := range inputs {
+		t, err := FromValues(s, values[:s.Elements()])
+		if err != nil {
+			return nil, err
+		}
+		tensors[s.Name] = t
+		values = values[s.Elements():]
+	}
+	return tensors, nil
+}
+
+// describeInputs lists input specs as name dtype[shape]
+func describeInputs(inputs []model.IOSpec) string {
+	descs := make([]string, len(inputs))
+	for i, s := range inputs {
+		descs[i] = fmt.Sprintf("%s %v", s.Name, Tensor{DType: s.DType, Shape: s.Shape})
+	}
+	return strings.Join(descs, ", ")
+}
+
+// ParseCSV parses numbers separated by commas, spaces or newlines, such
+// as "1.0,0.5,0.75", into the inputs in declaration order: the first input
+// takes as many values as its shape holds, the next one the following
+// values and so on. Lines starting with '#' are comments.
+func ParseCSV(data []byte, inputs []model.IOSpec) (map[string]Tensor, error) {
+	var values []float64
+	for n, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' })
+		for _, f := range fields {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, fmt.Errorf("csv: line %d: invalid number %q", n+1, f)
+			}
+			values = append(values, v)
+		}
+	}
+	tensors, err := splitValues(inputs, values)
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	return tensors, nil
+}
+
+// ParseJSON parses an object keyed by input name, each value an array of
+// numbers nested like the input's shape, or flat, or a tensor object as
+// Tensor.MarshalJSON writes it. A model with a single input also takes a
+// bare array. null stands for NaN.
+func ParseJSON(data []byte, inputs []model.IOSpec) (map[string]Tensor, error) {
+	var raw map[string]json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(inputs) == 1 && len(trimmed) > 0 && trimmed[0] == '[' {
+		raw = map[string]json.RawMessage{inputs[0].Name: trimmed}
+	} else if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	for name := range raw {
+		if !slices.ContainsFunc(inputs, func(s model.IOSpec) bool { return s.Name == name }) {
+			return nil, fmt.Errorf("json: model has no input %q", name)
+		}
+	}
+
+	tensors := make(map[string]Tensor, len(inputs))
+	for _, s := range inputs {
+		msg, ok := raw[s.Name]
+		if !ok {
+			return nil, fmt.Errorf("json: missing input %q", s.Name)
+		}
+		var obj struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(msg), []byte("{")) {
+			if err := json.Unmarshal(msg, &obj); err != nil {
+				return nil, fmt.Errorf("json: input %q: %w", s.Name, err)
+			}
+			msg = obj.Data
+		}
+		var nested any
+		if err := json.Unmarshal(msg, &nested); err != nil {
+			return nil, fmt.Errorf("json: input %q: %w", s.Name, err)
+		}
+		values, shape, err := flatten(nested)
+		if err != nil {
+			return nil, fmt.Errorf("json: input %q: %w", s.Name, err)
+		}
+		if len(shape) > 1 && !slices.Equal(shape, s.Shape) {
+			return nil, fmt.Errorf("json: input %q: got shape %v, want %v", s.Name, shape, s.Shape)
+		}
+		if tensors[s.Name], err = FromValues(s, values); err != nil {
+			return nil, fmt.Errorf("json: %w", err)
+		}
+	}
+	return tensors, nil
+}
+
+// flatten returns the numbers of nested JSON arrays in row-major order and
+// the shape of the nesting, which must be regular
+func flatten(v any) ([]float64, []int, error) {
+	switch v := v.(type) {
+	case float64:
+		return []float64{v}, nil, nil
+	case nil:
+		return []float64{math.NaN()}, nil, nil
+	case []any:
+		var values []float64
+		var inner []int
+		for i, item := range v {
+			vs, shape, err := flatten(item)
+			if err != nil {
+				return nil, nil, err
+			}
+			if i > 0 && !slices.Equal(shape, inner) {
+				return nil, nil, fmt.Errorf("ragged array: element %d has shape %v, element 0 %v", i, shape, inner)
+			}
+			values, inner = append(values, vs...), shape
+		}
+		return values, append([]int{len(v)}, inner...), nil
+	}
+	return nil, nil, fmt.Errorf("invalid element %v, want a number", v)
+}
+
+// ParseFloat32 splits little-endian float32 values into the inputs in
+// declaration order, like ParseCSV, converting them to the inputs' dtypes
+func ParseFloat32(data []byte, inputs []model.IOSpec) (map[string]Tensor, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("raw-f32: %d bytes are not a whole number of float32 values", len(data))
+	}
+	values := make([]float64, len(data)/4)
+	for i := range values {
+		values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])))
+	}
+	tensors, err := splitValues(inputs, values)
+	if err != nil {
+		return nil, fmt.Errorf("raw-f32: %w", err)
+	}
+	return tensors, nil
+}
@@ -0,0 +1,75 @@
+package ioutil
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestParseInputs(t *testing.T) {
+	t.Parallel()
+	inputs := []model.IOSpec{
+		{Name: "x", Kind: model.Input, DType: model.Float32, Shape: []int{2, 2}},
+		{Name: "ids", Kind: model.Input, DType: model.Int8, Shape: []int{2}},
+	}
+	want := map[string][]byte{"x": floats(1, 0.5, 0.75, 1), "ids": {3, 0xFE}}
+	check := func(name string, tensors map[string]Tensor, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for k, data := range want {
+			if !bytes.Equal(tensors[k].Data, data) {
+				t.Errorf("%s: expected %s = %v, got %v", name, k, data, tensors[k].Data)
+			}
+		}
+	}
+	tensors, err := ParseCSV([]byte("# x then ids\n1.0,0.5\n0.75 1.0\n3,-2\n"), inputs)
+	check("csv", tensors, err)
+	tensors, err = ParseJSON([]byte(`{"x": [[1, 0.5], [0.75, 1]], "ids": {"dtype": "int8", "data": [3, -2]}}`), inputs)
+	check("json", tensors, err)
+	tensors, err = ParseFloat32(floats(1, 0.5, 0.75, 1, 3, -2), inputs)
+	check("raw-f32", tensors, err)
+
+	// A lone input takes a bare array
+	tensors, err = ParseJSON([]byte("[1, 0.5, 0.75, 1]"), inputs[:1])
+	if err != nil || !bytes.Equal(tensors["x"].Data, want["x"]) {
+		t.Errorf("Expected x from a bare array, got %v (%v)", tensors, err)
+	}
+
+	invalid := map[string]struct {
+		parse func([]byte, []model.IOSpec) (map[string]Tensor, error)
+		data  string
+		want  string
+	}{
+		"count":   {ParseCSV, "1,2,3", "csv: got 3 values, the model inputs x float32[2,2], ids int8[2] take 6"},
+		"number":  {ParseCSV, "1,2\nx", `csv: line 2: invalid number "x"`},
+		"range":   {ParseCSV, "1,2,3,4,5,300", `input "ids": element 1: 300 does not fit int8`},
+		"whole":   {ParseCSV, "1,2,3,4,5,0.5", `input "ids": element 1: 0.5 does not fit int8`},
+		"shape":   {ParseJSON, `{"x": [[1, 2, 3, 4]], "ids": [1, 2]}`, `json: input "x": got shape [1 4], want [2 2]`},
+		"ragged":  {ParseJSON, `{"x": [[1, 2], [3]], "ids": [1, 2]}`, "ragged array"},
+		"missing": {ParseJSON, `{"x": [1, 2, 3, 4]}`, `json: missing input "ids"`},
+		"unknown": {ParseJSON, `{"x": [1, 2, 3, 4], "ids": [1, 2], "z": []}`, `json: model has no input "z"`},
+		"partial": {ParseFloat32, "abc", "raw-f32: 3 bytes are not a whole number of float32 values"},
+	}
+	for name, c := range invalid {
+		if _, err := c.parse([]byte(c.data), inputs); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.want, err)
+		}
+	}
+
+	// float16 inputs round to the nearest half, ties to even
+	half := model.IOSpec{Name: "h", Kind: model.Input, DType: model.Float16, Shape: []int{4}}
+	h, err := FromValues(half, []float64{1, -0.1, 65504, 1e6})
+	if err != nil {
+		t.Fatalf("FromValues failed: %v", err)
+	}
+	values, err := h.Values()
+	if err != nil || !slices.Equal(values, []float64{1, float64(float32(-0.0999755859375)), 65504, math.Inf(1)}) {
+		t.Errorf("Expected 1, -0.09998, 65504 and +Inf, got %v (%v)", values, err)
+	}
+}
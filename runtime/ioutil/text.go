@@ -0,0 +1,163 @@
+package ioutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// Values returns the elements of t converted to float64, in row-major order
+func (t Tensor) Values() ([]float64, error) {
+	size := t.DType.Size()
+	if size == 0 || len(t.Data) != t.Elements()*size {
+		return nil, fmt.Errorf("%d data bytes do not match %v", len(t.Data), t)
+	}
+	values := make([]float64, t.Elements())
+	for i := range values {
+		b := t.Data[i*size:]
+		switch t.DType {
+		case model.Float32:
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case model.Float16:
+			values[i] = float64(model.HalfToFloat(binary.LittleEndian.Uint16(b)))
+		case model.Int32:
+			values[i] = float64(int32(binary.LittleEndian.Uint32(b)))
+		case model.Int8:
+			values[i] = float64(int8(b[0]))
+		case model.Uint8:
+			values[i] = float64(b[0])
+		default:
+			return nil, fmt.Errorf("unsupported dtype %v", t.DType)
+		}
+	}
+	return values, nil
+}
+
+// formatValue formats an element of a tensor of dtype d in its shortest
+// form: integers without a fraction, floats as strconv's 'g' format of
+// their precision
+func formatValue(d model.DType, v float64) string {
+	switch d {
+	case model.Float32, model.Float16:
+		return strconv.FormatFloat(v, 'g', -1, 32)
+	}
+	return strconv.FormatInt(int64(v), 10)
+}
+
+// WriteCSV writes t as comma-separated values, one line per row of its
+// innermost dimension; a scalar or a vector is a single line
+func WriteCSV(w io.Writer, t Tensor) error {
+	values, err := t.Values()
+	if err != nil {
+		return err
+	}
+	row := len(values)
+	if len(t.Shape) > 1 {
+		row = t.Shape[len(t.Shape)-1]
+	}
+	var buf bytes.Buffer
+	for i, v := range values {
+		buf.WriteString(formatValue(t.DType, v))
+		if (i+1)%max(row, 1) == 0 {
+			buf.WriteByte('\n')
+		} else {
+			buf.WriteByte(',')
+		}
+	}
+	if len(values) == 0 {
+		buf.WriteByte('\n')
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// MarshalJSON encodes t as an object with its dtype, shape and data, the
+// data nested in arrays following the shape. NaN and infinities, which
+// JSON cannot represent, are null.
+func (t Tensor) MarshalJSON() ([]byte, error) {
+	values, err := t.Values()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"dtype":%q,"shape":[`, t.DType)
+	for i, d := range t.Shape {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.Itoa(d))
+	}
+	buf.WriteString(`],"data":`)
+	writeJSONArray(&buf, t.DType, t.Shape, values)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeJSONArray writes values as nested arrays of the given shape, or a
+// single number for a scalar
+func writeJSONArray(buf *bytes.Buffer, d model.DType, shape []int, values []float64) {
+	if len(shape) == 0 {
+		if v := values[0]; math.IsNaN(v) || math.IsInf(v, 0) {
+			buf.WriteString("null")
+		} else {
+			buf.WriteString(formatValue(d, v))
+		}
+		return
+	}
+	buf.WriteByte('[')
+	stride := len(values) / max(shape[0], 1)
+	for i := 0; i < shape[0]; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONArray(buf, d, shape[1:], values[i*stride:(i+1)*stride])
+	}
+	buf.WriteByte(']')
+}
+
+// WriteFloat32 writes the elements of t as little-endian float32 values,
+// converting other dtypes
+func WriteFloat32(w io.Writer, t Tensor) error {
+	values, err := t.Values()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(float32(v)))
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteNPZ writes tensors as an uncompressed .npz archive, as numpy.savez
+// does, each stored as <name>.npy in name order
+func WriteNPZ(w io.Writer, tensors map[string]Tensor) error {
+	names := make([]string, 0, len(tensors))
+	for name := range tensors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		if strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("npz: invalid array name %q", name)
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name + ".npy", Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if err := WriteNPY(f, tensors[name]); err != nil {
+			return fmt.Errorf("npz: %s: %w", name, err)
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,60 @@
+package ioutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestTextFormats(t *testing.T) {
+	t.Parallel()
+	m := Tensor{DType: model.Float32, Shape: []int{2, 3}, Data: floats(1, -2, 0.5, 4, 5, float32(math.Inf(1)))}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, m); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	if got := buf.String(); got != "1,-2,0.5\n4,5,+Inf\n" {
+		t.Errorf("Expected a CSV row per matrix row, got %q", got)
+	}
+	data, err := m.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %v", err)
+	}
+	if want := `{"dtype":"float32","shape":[2,3],"data":[[1,-2,0.5],[4,5,null]]}`; string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+
+	// Integer dtypes print without fractions; scalars are bare values
+	ints := Tensor{DType: model.Int8, Shape: []int{3}, Data: []byte{1, 0xFF, 7}}
+	buf.Reset()
+	if err := WriteCSV(&buf, ints); err != nil || buf.String() != "1,-1,7\n" {
+		t.Errorf("Expected 1,-1,7, got %q (%v)", buf.String(), err)
+	}
+	scalar := Tensor{DType: model.Int32, Data: binary.LittleEndian.AppendUint32(nil, 42)}
+	if data, err := scalar.MarshalJSON(); err != nil || string(data) != `{"dtype":"int32","shape":[],"data":42}` {
+		t.Errorf("Expected a scalar 42, got %s (%v)", data, err)
+	}
+	buf.Reset()
+	if err := WriteFloat32(&buf, ints); err != nil || !bytes.Equal(buf.Bytes(), floats(1, -1, 7)) {
+		t.Errorf("Expected the int8 values as float32, got %v (%v)", buf.Bytes(), err)
+	}
+	if _, err := (Tensor{DType: model.Float32, Shape: []int{2}, Data: floats(1)}).Values(); err == nil {
+		t.Error("Expected an error for data shorter than the shape")
+	}
+
+	buf.Reset()
+	if err := WriteNPZ(&buf, map[string]Tensor{"m": m, "i": ints}); err != nil {
+		t.Fatalf("WriteNPZ failed: %v", err)
+	}
+	got, err := ReadNPZ(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadNPZ failed: %v", err)
+	}
+	if len(got) != 2 || !bytes.Equal(got["m"].Data, m.Data) || !slices.Equal(got["i"].Shape, []int{3}) {
+		t.Errorf("Expected both arrays back, got %v", got)
+	}
+}
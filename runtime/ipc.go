@@ -0,0 +1,221 @@
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+)
+
+// errSharedMemoryUnsupported is returned by mapSharedMemory on platforms
+// without POSIX shared memory.
+var errSharedMemoryUnsupported = errors.New("shared memory not supported")
+
+// Shared-memory IPC protocol. The engine's whole arena lives in a POSIX
+// shared memory segment that producers map as well. Control messages are
+// fixed-size little-endian frames on a stream socket:
+//
+//	hello  (server, on connect)  magic u32 | version u16 | name length u16 |
+//	                             segment size u64 | input offset u64 |
+//	                             input capacity u64 | segment name
+//	request (client)             op u32 | input length u32
+//	reply   (server)             status u32 | length u32 | offset u64 |
+//	                             error text (status IPCStatusError only)
+//
+// To run the graph a producer writes its input at the input offset of the
+// segment, sends an IPCOpRun request with the input length and waits for the
+// reply, whose offset and length locate the output inside the segment. The
+// output stays valid until the next request. Inputs are never copied.
+const (
+	IPCMagic   = 0x53424950 // "SBIP"
+	IPCVersion = 1
+
+	IPCOpRun = 1 // Execute on the input at the input offset
+
+	IPCStatusOK    = 0
+	IPCStatusError = 1 // length bytes of error text follow the reply
+)
+
+// ipcHelloSize is the size of the hello frame before the segment name.
+const ipcHelloSize = 4 + 2 + 2 + 8 + 8 + 8
+
+// NewSharedEngine creates an engine whose arena is the POSIX shared memory
+// object name (/dev/shm/name on Linux), so producers in other processes can
+// exchange inputs and outputs with it without copying. The segment is
+// created exclusively and removed by Close. It is only available on Linux.
+func NewSharedEngine(graph *model.Graph, opts *EngineOptions, name string) (*Engine, error) {
+	if graph == nil {
+		return nil, errors.New("graph cannot be nil")
+	}
+	if name == "" || strings.ContainsRune(name, '/') || len(name) > 255 {
+		return nil, fmt.Errorf("invalid shared memory name %q", name)
+	}
+
+	o := DefaultEngineOptions()
+	if opts != nil {
+		o = *opts
+	}
+	if o.ArenaSize == 0 {
+		o.ArenaSize = max(calculateArenaSize(graph), explicitArenaSize(&o, graph))
+	}
+	length := core.AlignSize(int(core.AlignedSize(o.ArenaSize)), core.PageSize)
+	o.ArenaSize = uintptr(length)
+	o.Streaming = true
+
+	buf, unmap, err := mapSharedMemory(name, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map shared memory %q: %w", name, err)
+	}
+	engine, err := newEngine(graph, &o, buf)
+	if err != nil {
+		_ = unmap()
+		return nil, err
+	}
+	engine.unmapArena = unmap
+	engine.shmName = name
+	return engine, nil
+}
+
+// streamCommit marks n bytes already placed at the start of the streaming
+// window as written, as StreamWrite would after a reset, without copying.
+func (a *Arena) streamCommit(n int) {
+	a.ResetStream()
+	a.streamWrite = uintptr(n)
+	a.streamingHighWater = max(a.streamingHighWater, uintptr(n))
+}
+
+// executeShared runs the graph on n input bytes a producer placed at the
+// start of the streaming window and returns where the output lies in the
+// arena buffer: the declared outputs, as ExecuteStreaming returns them,
+// follow the input in the window.
+func (e *Engine) executeShared(n int) (offset, length int, err error) {
+	if err := e.enter(); err != nil {
+		return 0, 0, err
+	}
+	defer e.exit()
+
+	limit := int(e.arena.streamingInput.Size)
+	if n > limit {
+		return 0, 0, &InputTooLargeError{Size: n, Limit: limit}
+	}
+	size := e.OutputSize()
+	if n+size > limit {
+		return 0, 0, fmt.Errorf("no room for the %d output bytes after %d input bytes in the %d-byte streaming window", size, n, limit)
+	}
+	window := e.arena.buffer[e.arena.streamingInput.Offset : e.arena.streamingInput.Offset+e.arena.streamingInput.Size]
+
+	start := time.Now()
+	e.admission.acquire(PriorityNormal)
+	defer e.admission.release()
+
+	if err := e.bindInput(window[:n]); err != nil {
+		return 0, 0, err
+	}
+	e.arena.streamCommit(n)
+	if err := e.runResident(); err != nil {
+		return 0, 0, err
+	}
+	e.arena.StreamConsume(n)
+
+	if e.opts.EnableStats {
+		e.mu.Lock()
+		h := e.stats.ClassLatency[PriorityNormal]
+		h.observe(time.Since(start))
+		e.stats.ClassLatency[PriorityNormal] = h
+		e.mu.Unlock()
+	}
+
+	e.readOutput(window[n : n+size])
+	return int(e.arena.streamingInput.Offset) + n, size, nil
+}
+
+// ServeIPC accepts producer connections on l and answers their requests
+// until ctx ends or l fails. The engine must come from NewSharedEngine.
+// Producers share the input region, so connections are served one at a time.
+func (e *Engine) ServeIPC(ctx context.Context, l net.Listener) error {
+	if e.shmName == "" {
+		return errors.New("engine is not backed by shared memory")
+	}
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		stopConn := context.AfterFunc(ctx, func() { conn.Close() })
+		err = e.serveIPCConn(conn)
+		stopConn()
+		conn.Close()
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// serveIPCConn runs the protocol on one connection until the producer hangs up.
+func (e *Engine) serveIPCConn(conn net.Conn) error {
+	hello := make([]byte, ipcHelloSize+len(e.shmName))
+	binary.LittleEndian.PutUint32(hello[0:], IPCMagic)
+	binary.LittleEndian.PutUint16(hello[4:], IPCVersion)
+	binary.LittleEndian.PutUint16(hello[6:], uint16(len(e.shmName)))
+	binary.LittleEndian.PutUint64(hello[8:], uint64(len(e.arena.buffer)))
+	binary.LittleEndian.PutUint64(hello[16:], uint64(e.arena.streamingInput.Offset))
+	binary.LittleEndian.PutUint64(hello[24:], uint64(e.arena.streamingInput.Size))
+	copy(hello[ipcHelloSize:], e.shmName)
+	if _, err := conn.Write(hello); err != nil {
+		return err
+	}
+
+	var req [8]byte
+	var reply [16]byte
+	for {
+		if _, err := io.ReadFull(conn, req[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		op := binary.LittleEndian.Uint32(req[0:])
+		n := int(binary.LittleEndian.Uint32(req[4:]))
+
+		var offset, length int
+		var err error
+		if op == IPCOpRun {
+			offset, length, err = e.executeShared(n)
+		} else {
+			err = fmt.Errorf("unknown IPC op %d", op)
+		}
+
+		var text []byte
+		if err != nil {
+			text = []byte(err.Error())
+			binary.LittleEndian.PutUint32(reply[0:], IPCStatusError)
+			binary.LittleEndian.PutUint32(reply[4:], uint32(len(text)))
+			binary.LittleEndian.PutUint64(reply[8:], 0)
+		} else {
+			binary.LittleEndian.PutUint32(reply[0:], IPCStatusOK)
+			binary.LittleEndian.PutUint32(reply[4:], uint32(length))
+			binary.LittleEndian.PutUint64(reply[8:], uint64(offset))
+		}
+		if _, err := conn.Write(reply[:]); err != nil {
+			return err
+		}
+		if len(text) > 0 {
+			if _, err := conn.Write(text); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//go:build linux
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSharedMemoryIPC(t *testing.T) {
+	t.Parallel()
+	name := fmt.Sprintf("sublation-test-%d", os.Getpid())
+	engine, err := NewSharedEngine(reluSumGraph(), &EngineOptions{Workers: 1, DisableMemo: true}, name)
+	if err != nil {
+		t.Fatalf("NewSharedEngine failed: %v", err)
+	}
+	defer engine.Close(context.Background())
+	if _, err := NewSharedEngine(hostTestGraph(), nil, name); err == nil {
+		t.Error("Expected error creating a segment that already exists")
+	}
+
+	sock := filepath.Join(t.TempDir(), "engine.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- engine.ServeIPC(ctx, l) }()
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Handshake, then map the segment it names the way a foreign producer would
+	hello := make([]byte, ipcHelloSize)
+	if _, err := io.ReadFull(conn, hello); err != nil {
+		t.Fatalf("Reading hello failed: %v", err)
+	}
+	if binary.LittleEndian.Uint32(hello) != IPCMagic {
+		t.Fatalf("Bad hello magic %#x", binary.LittleEndian.Uint32(hello))
+	}
+	segName := make([]byte, binary.LittleEndian.Uint16(hello[6:]))
+	if _, err := io.ReadFull(conn, segName); err != nil || string(segName) != name {
+		t.Fatalf("Expected segment name %q, got %q (err %v)", name, segName, err)
+	}
+	size := int(binary.LittleEndian.Uint64(hello[8:]))
+	inOff := int(binary.LittleEndian.Uint64(hello[16:]))
+	inCap := int(binary.LittleEndian.Uint64(hello[24:]))
+
+	f, err := os.OpenFile(filepath.Join(shmDir, name), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Opening segment failed: %v", err)
+	}
+	seg, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	f.Close()
+	if err != nil {
+		t.Fatalf("Mapping segment failed: %v", err)
+	}
+	defer syscall.Munmap(seg)
+
+	request := func(n int) (status, length uint32, offset uint64, text string) {
+		var req [8]byte
+		binary.LittleEndian.PutUint32(req[0:], IPCOpRun)
+		binary.LittleEndian.PutUint32(req[4:], uint32(n))
+		if _, err := conn.Write(req[:]); err != nil {
+			t.Fatalf("Writing request failed: %v", err)
+		}
+		var reply [16]byte
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			t.Fatalf("Reading reply failed: %v", err)
+		}
+		status, length = binary.LittleEndian.Uint32(reply[0:]), binary.LittleEndian.Uint32(reply[4:])
+		offset = binary.LittleEndian.Uint64(reply[8:])
+		if status == IPCStatusError {
+			msg := make([]byte, length)
+			io.ReadFull(conn, msg)
+			text = string(msg)
+		}
+		return
+	}
+
+	// The declared output s = sum(relu(x)) follows the input x in the window
+	copy(seg[inOff:], float32Bytes(2, -1, 5, -3))
+	status, length, offset, text := request(16)
+	if status != IPCStatusOK {
+		t.Fatalf("Expected OK, got error %q", text)
+	}
+	if offset != uint64(inOff+16) || !bytes.Equal(seg[offset:offset+uint64(length)], float32Bytes(7)) {
+		t.Errorf("Expected s = 7 right after the input, got %v at %d", seg[offset:offset+uint64(length)], offset)
+	}
+	if status, _, _, text := request(8); status != IPCStatusError || text == "" {
+		t.Errorf("Expected an error for input shorter than x, got status %d", status)
+	}
+	if engine.arena.StreamBuffered() != 0 {
+		t.Errorf("Expected the input to be consumed, %d bytes left", engine.arena.StreamBuffered())
+	}
+
+	if status, _, _, text := request(inCap + 1); status != IPCStatusError || text == "" {
+		t.Errorf("Expected an error for input beyond the window, got status %d", status)
+	}
+
+	cancel()
+	if err := <-served; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected ServeIPC to stop with context.Canceled, got %v", err)
+	}
+}
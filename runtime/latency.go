@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// LatencyReport summarizes repeated runs of an execution, as measured by
+// MeasureLatency. Percentiles are exact, by nearest rank.
+type LatencyReport struct {
+	Runs           int
+	Min, Mean, Max time.Duration
+	P50, P90, P99  time.Duration
+
+	AllocsPerRun uint64 // Heap allocations per run
+	BytesPerRun  uint64 // Heap bytes allocated per run
+}
+
+// String summarises the report on one line.
+func (r LatencyReport) String() string {
+	return fmt.Sprintf("%d runs: min=%v mean=%v max=%v p50=%v p90=%v p99=%v, %d allocs/run, %d B/run",
+		r.Runs, r.Min, r.Mean, r.Max, r.P50, r.P90, r.P99, r.AllocsPerRun, r.BytesPerRun)
+}
+
+// MeasureLatency calls run n times, timing each call, and reports the
+// latency distribution along with the heap allocations per call, like a
+// Go benchmark with -benchmem would. It stops at the first error.
+func MeasureLatency(n int, run func() error) (LatencyReport, error) {
+	if n < 1 {
+		return LatencyReport{}, fmt.Errorf("invalid run count %d", n)
+	}
+	if run == nil {
+		return LatencyReport{}, errors.New("measure requires a run function")
+	}
+	times := make([]time.Duration, n)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := range times {
+		start := time.Now()
+		if err := run(); err != nil {
+			return LatencyReport{}, fmt.Errorf("run %d: %w", i, err)
+		}
+		times[i] = time.Since(start)
+	}
+	runtime.ReadMemStats(&after)
+
+	slices.Sort(times)
+	var total time.Duration
+	for _, d := range times {
+		total += d
+	}
+	return LatencyReport{
+		Runs:         n,
+		Min:          times[0],
+		Mean:         total / time.Duration(n),
+		Max:          times[n-1],
+		P50:          nearestRank(times, 0.50),
+		P90:          nearestRank(times, 0.90),
+		P99:          nearestRank(times, 0.99),
+		AllocsPerRun: (after.Mallocs - before.Mallocs) / uint64(n),
+		BytesPerRun:  (after.TotalAlloc - before.TotalAlloc) / uint64(n),
+	}, nil
+}
+
+// nearestRank returns the q-th quantile of sorted, which must not be empty
+func nearestRank(sorted []time.Duration, q float64) time.Duration {
+	return sorted[max(min(int(math.Ceil(q*float64(len(sorted))))-1, len(sorted)-1), 0)]
+}
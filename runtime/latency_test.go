@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMeasureLatency(t *testing.T) {
+	t.Parallel()
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if got := nearestRank(sorted[4:5], 0.99); got != 5 {
+		t.Errorf("nearestRank of one sample = %v, want 5", got)
+	}
+	for q, want := range map[float64]time.Duration{0: 1, 0.5: 5, 0.9: 9, 0.99: 10, 1: 10} {
+		if got := nearestRank(sorted, q); got != want {
+			t.Errorf("nearestRank(%v) = %v, want %v", q, got, want)
+		}
+	}
+
+	graph := memoGraph()
+	engine, err := NewEngine(graph, &EngineOptions{Workers: 1, ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	ctx := NewExecutionContext(len(graph.Nodes))
+	calls := 0
+	r, err := MeasureLatency(20, func() error {
+		calls++
+		return engine.Execute(ctx)
+	})
+	if err != nil {
+		t.Fatalf("MeasureLatency failed: %v", err)
+	}
+	if calls != 20 || r.Runs != 20 {
+		t.Errorf("got %d calls, Runs %d, want 20", calls, r.Runs)
+	}
+	if r.Min <= 0 || r.Min > r.P50 || r.P50 > r.P90 || r.P90 > r.P99 || r.P99 > r.Max || r.Mean < r.Min || r.Mean > r.Max {
+		t.Errorf("inconsistent report %v", r)
+	}
+
+	fail := errors.New("boom")
+	if _, err := MeasureLatency(3, func() error { return fail }); !errors.Is(err, fail) {
+		t.Errorf("MeasureLatency error = %v, want %v", err, fail)
+	}
+	if _, err := MeasureLatency(0, func() error { return nil }); err == nil {
+		t.Error("MeasureLatency accepted zero runs")
+	}
+}
@@ -0,0 +1,90 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by execution methods once Close has been called.
+var ErrClosed = errors.New("engine closed")
+
+// lifecycle counts in-flight calls so Close can wait for them to drain.
+type lifecycle struct {
+	mu       sync.Mutex
+	closed   bool
+	released bool
+	active   int
+	drained  chan struct{} // Closed when active reaches zero after Close
+}
+
+// enter registers an in-flight call, failing once the engine is closed.
+func (e *Engine) enter() error {
+	e.life.mu.Lock()
+	defer e.life.mu.Unlock()
+	if e.life.closed {
+		return ErrClosed
+	}
+	e.life.active++
+	return nil
+}
+
+// exit unregisters an in-flight call.
+func (e *Engine) exit() {
+	e.life.mu.Lock()
+	defer e.life.mu.Unlock()
+	e.life.active--
+	if e.life.closed && e.life.active == 0 {
+		close(e.life.drained)
+	}
+}
+
+// Close stops accepting work, waits for in-flight and queued executions to
+// finish, then releases the arena, sublates and scheduler. Calls made after
+// Close return ErrClosed. If ctx ends before the engine drains, Close returns
+// ctx.Err() and leaves resources in place; calling Close again resumes the wait.
+func (e *Engine) Close(ctx context.Context) error {
+	e.life.mu.Lock()
+	if !e.life.closed {
+		e.life.closed = true
+		e.life.drained = make(chan struct{})
+		if e.life.active == 0 {
+			close(e.life.drained)
+		}
+	}
+	drained := e.life.drained
+	e.life.mu.Unlock()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	e.life.mu.Lock()
+	defer e.life.mu.Unlock()
+	if !e.life.released {
+		e.release()
+		e.life.released = true
+	}
+	return nil
+}
+
+// release unmaps huge page memory and drops every reference to engine memory.
+// Streaming and pool workers only live for the duration of an execution, so
+// none remain once drained.
+func (e *Engine) release() {
+	if e.unmapArena != nil {
+		_ = e.unmapArena()
+		e.unmapArena = nil
+	}
+	e.arena = nil
+	e.backing = nil
+	e.sublates = nil
+	e.scheduler = nil
+	e.deps = nil
+	e.memo = nil
+	e.pool = nil
+	e.tracer = nil
+	e.trainBuf = nil
+}
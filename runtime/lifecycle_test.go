@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestEngineCloseDrains(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes:   []model.Node{{Kernel: 1, In: 0, Out: 128}},
+	}
+	engine, err := NewEngine(graph, &EngineOptions{Workers: 2, ArenaSize: 4096, Streaming: true})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	// Hold the engine so the next request queues behind us
+	engine.admission.acquire(PriorityNormal)
+	result := make(chan error, 1)
+	go func() {
+		result <- engine.ExecuteStreaming(make([]byte, 16), make([]byte, 16))
+	}()
+	for engine.admission.depth() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := engine.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to time out while a request is queued, got %v", err)
+	}
+	if err := engine.ExecuteStreaming(nil, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed for new request, got %v", err)
+	}
+
+	engine.admission.release()
+	if err := <-result; err != nil {
+		t.Errorf("Queued request failed during drain: %v", err)
+	}
+	if err := engine.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if engine.arena != nil || engine.scheduler != nil {
+		t.Error("Expected Close to release arena and scheduler")
+	}
+
+	if err := engine.Execute(NewExecutionContext(1)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Execute, got %v", err)
+	}
+	if err := engine.Run(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Run, got %v", err)
+	}
+	if err := engine.Close(context.Background()); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+}
+
+func TestHostClose(t *testing.T) {
+	t.Parallel()
+	host := NewHost(&HostOptions{Workers: 2, ArenaSize: 1 << 16, Streaming: true})
+	if err := host.Add("m", hostTestGraph()); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	engine, _ := host.Engine("m")
+
+	if err := host.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := engine.Execute(NewExecutionContext(2)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected hosted engine to be closed, got %v", err)
+	}
+	if err := host.Add("n", hostTestGraph()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed adding to closed host, got %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package runtime
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+)
+
+// LineageGranularity selects how finely EngineOptions.Lineage records what
+// each node's output derives from.
+type LineageGranularity int
+
+const (
+	// LineageOff records nothing.
+	LineageOff LineageGranularity = iota
+	// LineageNodes records the upstream nodes of each output.
+	LineageNodes
+	// LineageRegions adds the declared inputs, payload segments and other
+	// payload ranges those nodes read, each reported whole.
+	LineageRegions
+	// LineageBytes reports the regions clipped to the bytes the nodes read.
+	LineageBytes
+)
+
+// String returns the granularity name as used in flags and logs.
+func (g LineageGranularity) String() string {
+	switch g {
+	case LineageOff:
+		return "off"
+	case LineageNodes:
+		return "nodes"
+	case LineageRegions:
+		return "regions"
+	case LineageBytes:
+		return "bytes"
+	default:
+		return fmt.Sprintf("LineageGranularity(%d)", int(g))
+	}
+}
+
+// ParseLineageGranularity converts a granularity name ("off", "nodes",
+// "regions", "bytes") into a LineageGranularity.
+func ParseLineageGranularity(name string) (LineageGranularity, error) {
+	switch name {
+	case "", "off":
+		return LineageOff, nil
+	case "nodes":
+		return LineageNodes, nil
+	case "regions":
+		return LineageRegions, nil
+	case "bytes":
+		return LineageBytes, nil
+	default:
+		return LineageOff, fmt.Errorf("unknown lineage granularity %q (want off, nodes, regions or bytes)", name)
+	}
+}
+
+// ErrLineageOff is returned by Lineage on engines created without
+// EngineOptions.Lineage.
+var ErrLineageOff = errors.New("lineage tracking is off")
+
+// RegionKind tells what a LineageRegion of the payload holds.
+type RegionKind uint8
+
+const (
+	RegionInput   RegionKind = iota // A declared input, bound before execution
+	RegionSegment                   // A payload segment, such as weights
+	RegionPayload                   // Payload bytes outside any input or segment
+)
+
+// String returns the kind name.
+func (k RegionKind) String() string {
+	switch k {
+	case RegionInput:
+		return "input"
+	case RegionSegment:
+		return "segment"
+	case RegionPayload:
+		return "payload"
+	default:
+		return fmt.Sprintf("RegionKind(%d)", int(k))
+	}
+}
+
+// LineageRegion is a range of the model payload an output derives from.
+type LineageRegion struct {
+	Kind    RegionKind
+	Name    string // Of the input or segment; empty for unnamed segments and payload
+	Segment uint32 // Segment ID of a RegionSegment
+	Offset  uint32 // Payload byte offset
+	Length  uint32
+}
+
+// Lineage is the provenance of one node's output: the nodes upstream of it,
+// and at LineageRegions and finer the payload regions the node and its
+// upstream nodes run on. Run tells which execution produced the output.
+type Lineage struct {
+	NodeID   uint32
+	Run      uint64          // Execution that last produced the output, counting from 1; 0 before any
+	Current  bool            // Whether Run is the latest execution
+	Reused   bool            // The output was the previous one, reused because its input was unchanged
+	Upstream []uint32        // Transitive dependencies, in execution order
+	Regions  []LineageRegion // By payload offset
+}
+
+// lineageTracker records which execution produced each node's output. The
+// upstream nodes and regions follow from the graph, so they are derived
+// only when queried and executions record two atomics per node.
+type lineageTracker struct {
+	granularity LineageGranularity
+	index       map[uint32]int  // Node index by ID
+	produced    []atomic.Uint64 // Run that last produced each node's output
+	reused      []atomic.Bool
+	runs        atomic.Uint64 // Executions finished
+}
+
+// setupLineage enables lineage tracking when EngineOptions.Lineage asks for it.
+func (e *Engine) setupLineage() {
+	if e.opts.Lineage == LineageOff {
+		return
+	}
+	t := &lineageTracker{
+		granularity: e.opts.Lineage,
+		index:       make(map[uint32]int, len(e.graph.Nodes)),
+		produced:    make([]atomic.Uint64, len(e.graph.Nodes)),
+		reused:      make([]atomic.Bool, len(e.graph.Nodes)),
+	}
+	for i, n := range e.graph.Nodes {
+		if _, dup := t.index[n.ID]; !dup {
+			t.index[n.ID] = i
+		}
+	}
+	e.lineage = t
+}
+
+// recordLineage notes that the running execution produced the output of the
+// node with the given ID, marking its sublate FlagLineageTracked.
+func (e *Engine) recordLineage(id uint32, reused bool) {
+	i, ok := e.lineage.index[id]
+	if !ok {
+		return
+	}
+	e.lineage.produced[i].Store(e.lineage.runs.Load() + 1)
+	e.lineage.reused[i].Store(reused)
+	if s := e.sublates[i]; s != nil {
+		s.SetFlag(core.FlagLineageTracked)
+	}
+}
+
+// Lineage returns the provenance of the output of node id as of the latest
+// execution that produced it, at the granularity of EngineOptions.Lineage.
+// Nodes not yet executed report Run 0 and the provenance they will have.
+func (e *Engine) Lineage(id uint32) (Lineage, error) {
+	t := e.lineage
+	if t == nil {
+		return Lineage{}, ErrLineageOff
+	}
+	i, ok := t.index[id]
+	if !ok {
+		return Lineage{}, fmt.Errorf("no node %d", id)
+	}
+	l := Lineage{NodeID: id, Run: t.produced[i].Load(), Reused: t.reused[i].Load()}
+	l.Current = l.Run != 0 && l.Run == t.runs.Load()
+
+	upstream := e.upstream(i)
+	for k := range e.graph.Nodes {
+		if j := e.nodeIndex(k); upstream[j] {
+			l.Upstream = append(l.Upstream, e.graph.Nodes[j].ID)
+		}
+	}
+	if t.granularity >= LineageRegions {
+		upstream[i] = true
+		l.Regions = e.lineageRegions(upstream, t.granularity == LineageBytes)
+	}
+	return l, nil
+}
+
+// upstream marks the indices of the nodes node i transitively depends on
+func (e *Engine) upstream(i int) []bool {
+	marked := make([]bool, len(e.graph.Nodes))
+	for queue := []int{i}; len(queue) > 0; queue = queue[1:] {
+		for _, dep := range e.graph.Nodes[queue[0]].Topo {
+			j, ok := e.lineage.index[dep]
+			if dep == model.NoNeighbor || !ok || marked[j] || j == i {
+				continue
+			}
+			marked[j] = true
+			queue = append(queue, j)
+		}
+	}
+	return marked
+}
+
+// lineageRegions returns the inputs, segments and remaining payload ranges
+// the marked nodes run on: whole, or clipped to the bytes read when clip
+func (e *Engine) lineageRegions(nodes []bool, clip bool) []LineageRegion {
+	var read []span
+	for i, n := range e.graph.Nodes {
+		if nodes[i] && n.Out > n.In {
+			read = append(read, span{n.In, n.Out})
+		}
+	}
+	read = mergeSpans(read)
+
+	var regions []LineageRegion
+	var covered []span
+	add := func(r LineageRegion) {
+		for _, s := range read {
+			from, to := max(s.from, r.Offset), min(s.to, r.Offset+r.Length)
+			if from >= to {
+				continue
+			}
+			covered = append(covered, span{from, to})
+			if clip {
+				c := r
+				c.Offset, c.Length = from, to-from
+				regions = append(regions, c)
+			} else if len(regions) == 0 || regions[len(regions)-1] != r {
+				regions = append(regions, r)
+			}
+		}
+	}
+	for _, spec := range e.graph.Inputs() {
+		if j, ok := e.lineage.index[spec.NodeID]; ok {
+			n := e.graph.Nodes[j]
+			if n.Out > n.In {
+				add(LineageRegion{Kind: RegionInput, Name: spec.Name, Offset: n.In, Length: n.Out - n.In})
+			}
+		}
+	}
+	for _, s := range e.graph.Segments {
+		add(LineageRegion{Kind: RegionSegment, Name: s.Name, Segment: s.ID, Offset: s.Offset, Length: s.Length})
+	}
+
+	// Whatever no input or segment covers is reported as plain payload
+	covered = mergeSpans(covered)
+	for _, s := range read {
+		from := s.from
+		for _, c := range covered {
+			if c.to <= from || c.from >= s.to {
+				continue
+			}
+			if c.from > from {
+				regions = append(regions, LineageRegion{Kind: RegionPayload, Offset: from, Length: c.from - from})
+			}
+			from = max(from, c.to)
+		}
+		if from < s.to {
+			regions = append(regions, LineageRegion{Kind: RegionPayload, Offset: from, Length: s.to - from})
+		}
+	}
+	slices.SortStableFunc(regions, func(a, b LineageRegion) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	return regions
+}
+
+// span is a half-open range of payload bytes
+type span struct {
+	from, to uint32
+}
+
+// mergeSpans sorts spans and joins the overlapping and adjacent ones
+func mergeSpans(spans []span) []span {
+	slices.SortFunc(spans, func(a, b span) int { return cmp.Compare(a.from, b.from) })
+	var merged []span
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.from <= merged[n-1].to {
+			merged[n-1].to = max(merged[n-1].to, s.to)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
@@ -0,0 +1,90 @@
+package runtime
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// lineageGraph computes node 5 from the input x, part of the weight segment
+// w and unsegmented payload; node 6 is unrelated
+func lineageGraph() *model.Graph {
+	return &model.Graph{
+		Payload: make([]byte, 32),
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpNoop, In: 0, Out: 8},
+			{ID: 2, Kernel: kernels.OpNoop, In: 8, Out: 16, Segment: 1},
+			{ID: 3, Kernel: kernels.OpNoop, Topo: []uint32{1, 2}},
+			{ID: 4, Kernel: kernels.OpNoop, In: 20, Out: 24},
+			{ID: 5, Kernel: kernels.OpNoop, Topo: []uint32{3, 4}},
+			{ID: 6, Kernel: kernels.OpNoop, In: 24, Out: 32},
+		},
+		Segments: []model.Segment{{ID: 1, Offset: 8, Length: 12, DType: model.Float32, Role: model.RoleWeight, Name: "w"}},
+		IO:       []model.IOSpec{{Name: "x", Kind: model.Input, NodeID: 1, DType: model.Float32, Shape: []int{2}}},
+	}
+}
+
+func TestLineage(t *testing.T) {
+	t.Parallel()
+	off, err := NewEngine(lineageGraph(), &EngineOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if _, err := off.Lineage(5); !errors.Is(err, ErrLineageOff) {
+		t.Errorf("Lineage without tracking: got %v, want ErrLineageOff", err)
+	}
+
+	input := LineageRegion{Kind: RegionInput, Name: "x", Offset: 0, Length: 8}
+	payload := LineageRegion{Kind: RegionPayload, Offset: 20, Length: 4}
+	for _, tc := range []struct {
+		granularity LineageGranularity
+		regions     []LineageRegion
+	}{
+		{LineageNodes, nil},
+		{LineageRegions, []LineageRegion{input, {Kind: RegionSegment, Name: "w", Segment: 1, Offset: 8, Length: 12}, payload}},
+		{LineageBytes, []LineageRegion{input, {Kind: RegionSegment, Name: "w", Segment: 1, Offset: 8, Length: 8}, payload}},
+	} {
+		engine, err := NewEngine(lineageGraph(), &EngineOptions{Workers: 2, Lineage: tc.granularity})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		l, err := engine.Lineage(5)
+		if err != nil || l.Run != 0 || l.Current {
+			t.Fatalf("%v: Lineage before any execution = %+v, %v", tc.granularity, l, err)
+		}
+
+		// The resident run executes every node, the second reuses them all.
+		// The topological order runs the roots first.
+		for run := uint64(1); run <= 2; run++ {
+			if err := engine.Run(); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			l, err := engine.Lineage(5)
+			if err != nil {
+				t.Fatalf("Lineage failed: %v", err)
+			}
+			want := Lineage{NodeID: 5, Run: run, Current: true, Reused: run == 2, Upstream: []uint32{1, 2, 4, 3}, Regions: tc.regions}
+			if !reflect.DeepEqual(l, want) {
+				t.Errorf("%v: run %d: got lineage %+v, want %+v", tc.granularity, run, l, want)
+			}
+		}
+		if !engine.sublates[4].HasFlag(core.FlagLineageTracked) {
+			t.Errorf("%v: sublate of node 5 is not marked FlagLineageTracked", tc.granularity)
+		}
+
+		// Executions on the scheduler count as runs too
+		if err := engine.Execute(NewExecutionContext(0)); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if l, _ := engine.Lineage(6); l.Run != 3 || !l.Current || l.Reused || l.Upstream != nil {
+			t.Errorf("%v: lineage of node 6 after Execute = %+v", tc.granularity, l)
+		}
+	}
+	if _, err := ParseLineageGranularity("tensors"); err == nil {
+		t.Error("ParseLineageGranularity accepted an unknown granularity")
+	}
+}
@@ -0,0 +1,136 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// linkModule returns a module reading input in and writing output out
+// through a relu, with a weight segment W of the given byte value
+func linkModule(in, out string, weight byte) *model.Graph {
+	payload := make([]byte, 128)
+	for i := 64; i < 96; i++ {
+		payload[i] = weight
+	}
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 0, In: 0, Out: 32},
+			{ID: 1, Kernel: kernels.OpReLU, In: 32, Out: 64, Topo: []uint32{0}},
+			{ID: 2, Kernel: 0, In: 64, Out: 96, Segment: 1},
+		},
+		Segments: []model.Segment{{ID: 1, Offset: 64, Length: 32, Role: model.RoleWeight, Name: "W"}},
+		IO: []model.IOSpec{
+			{Name: in, Kind: model.Input, NodeID: 0, Shape: []int{8}},
+			{Name: out, Kind: model.Output, NodeID: 1, Shape: []int{8}},
+		},
+	}
+}
+
+func TestLink(t *testing.T) {
+	t.Parallel()
+	g, stats, err := model.Link([]model.LinkModule{
+		{Name: "encoder", Graph: linkModule("x", "h", 1)},
+		{Name: "decoder", Graph: linkModule("h", "y", 1)},
+	})
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	if err := g.Validate(); err != nil {
+		t.Fatalf("Linked graph is invalid: %v", err)
+	}
+	if stats != (model.LinkStats{Bindings: 1, Deduplicated: 1, SavedBytes: 32}) {
+		t.Errorf("Expected one binding and one shared segment, got %+v", stats)
+	}
+	if len(g.Nodes) != 6 || g.Nodes[5].ID != 5 || g.Nodes[4].Topo[0] != 3 {
+		t.Fatalf("Expected decoder nodes renumbered to 3-5, got %+v", g.Nodes)
+	}
+	if len(g.IO) != 2 || g.IO[0].Name != "x" || g.IO[1].Name != "y" || g.IO[1].NodeID != 4 {
+		t.Errorf("Expected the bound h specs to leave the IO table, got %+v", g.IO)
+	}
+	h, in := g.Nodes[1], g.Nodes[3]
+	if in.In != h.In || in.Out != h.Out || in.Flags&core.FlagShared == 0 || h.Flags&core.FlagShared == 0 || in.Topo[0] != 1 {
+		t.Errorf("Expected decoder input tied to encoder output %+v, got %+v", h, in)
+	}
+	if len(g.Segments) != 1 || g.Nodes[5].Segment != g.Nodes[2].Segment || g.Nodes[5].In != g.Nodes[2].In {
+		t.Errorf("Expected one W segment shared by nodes 2 and 5, got %+v", g.Segments)
+	}
+
+	engine, err := NewEngine(g, &EngineOptions{Workers: 1, ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Different weights keep both segments, the later one renamed
+	g, stats, err = model.Link([]model.LinkModule{
+		{Name: "encoder", Graph: linkModule("x", "h", 1)},
+		{Name: "decoder", Graph: linkModule("h", "y", 2)},
+	})
+	if err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	if stats.Deduplicated != 0 || len(g.Segments) != 2 || g.Segments[1].Name != "decoder.W" {
+		t.Errorf("Expected the decoder's W kept as decoder.W, got %+v", g.Segments)
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	t.Parallel()
+	mismatch := linkModule("h", "y", 1)
+	mismatch.IO[0].Shape = []int{4, 2}
+	avx := linkModule("h", "y", 1)
+	avx.Target = model.TargetAVX2
+	invalid := map[string]struct {
+		second *model.Graph
+		want   string
+	}{
+		"shape":  {mismatch, `input "h" of module b is float32 [4 2], the output of module a is float32 [8]`},
+		"input":  {linkModule("x", "y", 1), `input "x" is declared by modules a and b`},
+		"output": {linkModule("z", "h", 1), `output "h" is declared by modules a and b`},
+		"target": {avx, "module b is compiled for avx2, a for generic"},
+	}
+	for name, c := range invalid {
+		_, _, err := model.Link([]model.LinkModule{{Name: "a", Graph: linkModule("x", "h", 1)}, {Name: "b", Graph: c.second}})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, c.want, err)
+		}
+	}
+}
+
+func TestCompilerLink(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	var inputs []string
+	for _, m := range []struct{ name, in, out string }{{"encoder", "x", "h"}, {"decoder", "h", "y"}} {
+		data, err := linkModule(m.in, m.out, 1).MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON failed: %v", err)
+		}
+		path := filepath.Join(dir, m.name+".json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		inputs = append(inputs, path)
+	}
+	out := filepath.Join(dir, "combined.subl")
+	if err := compiler.Link(inputs, out, compiler.DefaultOptions()); err != nil {
+		t.Fatalf("Link failed: %v", err)
+	}
+	g, err := ReadGraph(out, nil)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+	if len(g.Nodes) != 6 || len(g.Inputs()) != 1 || len(g.Outputs()) != 1 {
+		t.Errorf("Expected 6 nodes, input x and output y, got %d nodes, IO %+v", len(g.Nodes), g.IO)
+	}
+}
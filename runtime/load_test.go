@@ -0,0 +1,672 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"hash/crc32"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/model"
+)
+
+func TestSerializeWideGraph(t *testing.T) {
+	t.Parallel()
+	const n = 70000 // Past the 16-bit id limit of version 1
+	graph := &model.Graph{Nodes: make([]model.Node, n), Payload: make([]byte, 1<<17)}
+	for i := range graph.Nodes {
+		graph.Nodes[i] = model.Node{ID: uint32(i), Kernel: 1, In: uint32(i), Out: 70000 + uint32(i)}
+	}
+	graph.Nodes[n-1].Topo = []uint32{0, 1, n - 2}
+
+	data, err := graph.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if v := binary.LittleEndian.Uint16(data[4:]); v != model.Version2 {
+		t.Errorf("Expected version %d, got %d", model.Version2, v)
+	}
+	got, err := model.Deserialize(data)
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if len(got.Nodes) != n || !bytes.Equal(got.Payload, graph.Payload) {
+		t.Fatalf("Expected %d nodes and %d payload bytes, got %d and %d", n, len(graph.Payload), len(got.Nodes), len(got.Payload))
+	}
+	last := got.Nodes[n-1]
+	if last.ID != n-1 || last.Out != 70000+n-1 || !slices.Equal(last.Topo, []uint32{0, 1, n - 2}) {
+		t.Errorf("Unexpected last node %+v", last)
+	}
+
+	if _, err := model.Deserialize(data[:len(data)/2]); err == nil {
+		t.Error("Expected an error for a truncated file")
+	}
+}
+
+func TestDeserializeVersion1(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	write := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	write(uint32(model.Magic))
+	write(uint16(model.Version1))
+	write(uint16(2))  // Nodes
+	write(uint32(64)) // Payload bytes
+	write([]uint16{0, 0, 32})
+	write([]uint8{1, 0})
+	write(uint32(0))
+	write([]uint16{0xFFFF, 0xFFFF})
+	write([]uint16{1, 32, 48})
+	write([]uint8{3, 1})
+	write(uint32(7))
+	write([]uint16{0, 0xFFFF})
+	buf.Write(make([]byte, 32-buf.Len()%32))
+	buf.Write(bytes.Repeat([]byte{0xAB}, 64))
+
+	graph, err := model.Deserialize(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+	if len(graph.Nodes) != 2 || len(graph.Payload) != 64 || graph.Payload[63] != 0xAB {
+		t.Fatalf("Unexpected graph: %d nodes, %d payload bytes", len(graph.Nodes), len(graph.Payload))
+	}
+	n := graph.Nodes[1]
+	if n.ID != 1 || n.Kernel != 3 || n.In != 32 || n.Out != 48 || n.Flags != 7 || !slices.Equal(n.Topo, []uint32{0}) {
+		t.Errorf("Unexpected node %+v", n)
+	}
+	if len(graph.Nodes[0].Topo) != 0 {
+		t.Errorf("Expected padding slots to be dropped, got %v", graph.Nodes[0].Topo)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	// compiler.Compile and CompileWithOptions both write the canonical format
+	src := filepath.Join(dir, "m.subs")
+	spec := "node 0 1 0 32\nnode 1 3 32 64\npayload " + string(bytes.Repeat([]byte("00"), 96)) + "\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	opts := compiler.DefaultOptions()
+	opts.DebugOutput = true
+	for name, compile := range map[string]func(string) error{
+		"compile": func(out string) error { return compiler.Compile(src, out) },
+		"with options": func(out string) error {
+			_, err := compiler.CompileWithOptions(src, out, opts)
+			return err
+		},
+	} {
+		out := filepath.Join(dir, name+".subl")
+		if err := compile(out); err != nil {
+			t.Fatalf("%s: compile failed: %v", name, err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		if binary.LittleEndian.Uint32(data) != model.Magic || binary.LittleEndian.Uint16(data[4:]) != model.Version2 {
+			t.Errorf("%s: expected a version %d header, got % x", name, model.Version2, data[:8])
+		}
+		engine, err := Load(out)
+		if err != nil {
+			t.Fatalf("%s: Load failed: %v", name, err)
+		}
+		// Layout optimization orders independent nodes arbitrarily
+		nodes := slices.Clone(engine.Graph().Nodes)
+		slices.SortFunc(nodes, func(a, b model.Node) int { return int(a.ID) - int(b.ID) })
+		if len(nodes) != 2 || nodes[1].ID != 1 || nodes[1].Kernel != 3 || nodes[1].In != 32 || nodes[1].Out != 64 {
+			t.Errorf("%s: unexpected nodes %+v", name, nodes)
+		}
+		if debug := engine.Graph().Flags&model.FlagDebug != 0; debug != (name == "with options") {
+			t.Errorf("%s: unexpected debug flag %v", name, debug)
+		}
+	}
+
+	// Headerless files from older compilers
+	var buf bytes.Buffer
+	write := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	write([]uint32{2, 96})
+	for _, n := range []model.Node{{ID: 0, Kernel: 1, In: 0, Out: 32}, {ID: 1, Kernel: 3, In: 32, Out: 64, Flags: 5}} {
+		write(uint16(n.ID))
+		write(n.Kernel)
+		write([]uint16{uint16(n.In), uint16(n.Out)})
+		write(n.Flags)
+		buf.Write(make([]byte, model.NodeSize()-11))
+	}
+	buf.Write(bytes.Repeat([]byte{0xCD}, 96))
+	legacy := filepath.Join(dir, "legacy.subl")
+	if err := os.WriteFile(legacy, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	engine, err := Load(legacy)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	graph := engine.Graph()
+	if n := graph.Nodes[1]; len(graph.Nodes) != 2 || n.Kernel != 3 || n.Out != 64 || n.Flags != 5 {
+		t.Errorf("Unexpected legacy nodes %+v", graph.Nodes)
+	}
+	if _, err := model.DeserializeLegacy(buf.Bytes()[:buf.Len()-1]); err == nil {
+		t.Error("Expected an error for a truncated legacy file")
+	}
+
+	// Version 2 with offsets past 64 KB
+	graph = &model.Graph{
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 100000, Kernel: 1, In: 70000, Out: 70064, Topo: []uint32{0}},
+		},
+		Payload: make([]byte, 70144),
+	}
+	data, err := graph.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	wide := filepath.Join(dir, "wide.subl")
+	if err := os.WriteFile(wide, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if engine, err = Load(wide); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := engine.Execute(NewExecutionContext(2)); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := engine.Graph().Nodes[1]; got.ID != 100000 || got.In != 70000 {
+		t.Errorf("Unexpected wide node %+v", got)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	t.Parallel()
+	for name, graph := range map[string]*model.Graph{
+		"empty":   {},
+		"no topo": {Nodes: []model.Node{{ID: 3, Kernel: 2, In: 0, Out: 32, Flags: 0xDEADBEEF}}, Payload: []byte{1, 2, 3}},
+		"fan-in": {
+			Nodes: []model.Node{
+				{ID: 0}, {ID: 1}, {ID: 2},
+				{ID: 0xFFFFFFFE, Kernel: 255, In: 1 << 31, Out: 0xFFFFFFFF, Topo: []uint32{0, 1, 2, model.NoNeighbor}},
+			},
+			Payload: bytes.Repeat([]byte{7}, 33),
+		},
+		"io and flags": {
+			Nodes:   []model.Node{{ID: 0, Out: 16}},
+			Payload: make([]byte, 64),
+			IO: []model.IOSpec{
+				{Name: "x", Kind: model.Input, DType: model.Int8, Shape: []int{}},
+				{Name: "y", Kind: model.Output, DType: model.Float16, Shape: []int{2, 3, 4}},
+			},
+			Flags: model.FlagDebug,
+		},
+	} {
+		data, err := graph.Serialize()
+		if err != nil {
+			t.Fatalf("%s: Serialize failed: %v", name, err)
+		}
+		if len(data)%32 != 0 {
+			t.Errorf("%s: expected a 32-byte multiple, got %d bytes", name, len(data))
+		}
+		got, err := model.Deserialize(data)
+		if err != nil {
+			t.Fatalf("%s: Deserialize failed: %v", name, err)
+		}
+		if got.Flags != graph.Flags || !bytes.Equal(got.Payload, graph.Payload) || len(got.Nodes) != len(graph.Nodes) || len(got.IO) != len(graph.IO) {
+			t.Errorf("%s: expected %+v, got %+v", name, graph, got)
+			continue
+		}
+		for i, n := range graph.Nodes {
+			g := got.Nodes[i]
+			if g.ID != n.ID || g.Kernel != n.Kernel || g.In != n.In || g.Out != n.Out || g.Flags != n.Flags || !slices.Equal(g.Topo, n.Topo) {
+				t.Errorf("%s: node %d: expected %+v, got %+v", name, i, n, g)
+			}
+		}
+		for i, s := range graph.IO {
+			if g := got.IO[i]; g.String() != s.String() || g.Kind != s.Kind {
+				t.Errorf("%s: IO %d: expected %v, got %v", name, i, s, g)
+			}
+		}
+		if again, err := got.Serialize(); err != nil || !bytes.Equal(again, data) {
+			t.Errorf("%s: expected a byte-identical re-encoding (err %v)", name, err)
+		}
+	}
+}
+
+func TestFormatChecksum(t *testing.T) {
+	t.Parallel()
+	graph := ioGraph()
+	graph.IO = []model.IOSpec{{Name: "x", NodeID: 1, Shape: []int{4}}}
+	data, err := graph.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+
+	// Flip one byte in the body of each section: NODE, IOSP, PAYL and SIGN
+	var bodies [][2]int
+	for off := 32; off < len(data); {
+		length := int(binary.LittleEndian.Uint64(data[off+8:]))
+		bodies = append(bodies, [2]int{off + 32, length})
+		off += 32 + (length+31)&^31
+	}
+	if len(bodies) != 4 {
+		t.Fatalf("Expected 4 sections, got %d", len(bodies))
+	}
+	for i, b := range bodies {
+		corrupt := bytes.Clone(data)
+		corrupt[b[0]+b[1]/2] ^= 0x40
+		if _, err := model.Deserialize(corrupt); !errors.Is(err, model.ErrChecksum) {
+			t.Errorf("Section %d: expected ErrChecksum, got %v", i, err)
+		}
+	}
+
+	// A tampered payload with a recomputed CRC still fails the file digest
+	payload := bodies[2]
+	data[payload[0]] ^= 1
+	binary.LittleEndian.PutUint32(data[payload[0]-32+16:], crc32.ChecksumIEEE(data[payload[0]:payload[0]+payload[1]]))
+	if _, err := model.Deserialize(data); !errors.Is(err, model.ErrChecksum) || !strings.Contains(err.Error(), "digest") {
+		t.Errorf("Expected a digest mismatch, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.subl")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := Load(path); !errors.Is(err, model.ErrChecksum) {
+		t.Errorf("Expected Load to report ErrChecksum, got %v", err)
+	}
+}
+
+func TestModelSigning(t *testing.T) {
+	t.Parallel()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+
+	// Keys round-trip through the PEM encodings sublc and sublrun read
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	if key, err := model.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil || !key.Equal(priv) {
+		t.Fatalf("ParsePrivateKey failed: %v", err)
+	}
+	der, _ = x509.MarshalPKIXPublicKey(pub)
+	if key, err := model.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err != nil || !key.Equal(pub) {
+		t.Fatalf("ParsePublicKey failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	if err := os.WriteFile(src, []byte("node 0 1 0 32\nnode 1 3 32 64\npayload "+strings.Repeat("00", 96)+"\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	signed, unsigned := filepath.Join(dir, "signed.subl"), filepath.Join(dir, "unsigned.subl")
+	opts := compiler.DefaultOptions()
+	if _, err := compiler.CompileWithOptions(src, unsigned, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	opts.SigningKey = priv
+	if _, err := compiler.CompileWithOptions(src, signed, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	if _, err := LoadSigned(signed, pub); err != nil {
+		t.Errorf("Expected the signed model to load, got %v", err)
+	}
+	if _, err := LoadSigned(signed, other); !errors.Is(err, model.ErrSignature) {
+		t.Errorf("Expected ErrSignature for the wrong key, got %v", err)
+	}
+	if _, err := LoadSigned(unsigned, pub); !errors.Is(err, model.ErrUnsigned) {
+		t.Errorf("Expected ErrUnsigned, got %v", err)
+	}
+	if _, err := Load(signed); err != nil {
+		t.Errorf("Expected Load to accept a signed model without a key, got %v", err)
+	}
+
+	// Signing covers the header too
+	data, _ := os.ReadFile(signed)
+	data[6] ^= model.FlagDebug
+	if err := model.Verify(data, pub); !errors.Is(err, model.ErrChecksum) {
+		t.Errorf("Expected a digest mismatch for a modified header, got %v", err)
+	}
+
+	host := NewHost(&HostOptions{Workers: 1, VerifyKey: pub})
+	defer host.Close(context.Background())
+	if err := host.Load("signed", signed); err != nil {
+		t.Errorf("Host.Load failed: %v", err)
+	}
+	if err := host.Load("unsigned", unsigned); !errors.Is(err, model.ErrUnsigned) {
+		t.Errorf("Expected Host.Load to reject an unsigned model, got %v", err)
+	}
+}
+
+func TestFormatCompression(t *testing.T) {
+	t.Parallel()
+	rng := rand.New(rand.NewPCG(1, 2))
+	noise := make([]byte, 4096)
+	for i := range noise {
+		noise[i] = byte(rng.Uint32())
+	}
+	weights := make([]byte, 1<<17)
+	for i := 0; i < len(weights); i += 4 { // Quantized weights repeat often
+		binary.LittleEndian.PutUint32(weights[i:], uint32(rng.IntN(16))<<20)
+	}
+	copy(weights[70000:], noise) // Matches past the 64 KB window must not be used
+
+	payloads := map[string][]byte{
+		"empty":    nil,
+		"short":    []byte("abcabcabcabcabc"),
+		"run":      bytes.Repeat([]byte{9}, 100000),
+		"noise":    noise,
+		"weights":  weights,
+		"overlaps": bytes.Repeat([]byte("xyz"), 700),
+	}
+	for name, payload := range payloads {
+		graph := &model.Graph{Nodes: []model.Node{{ID: 0, Kernel: 1, Topo: []uint32{}}}, Payload: payload}
+		plain, err := graph.Serialize()
+		if err != nil {
+			t.Fatalf("%s: Serialize failed: %v", name, err)
+		}
+		for _, c := range []model.Compression{model.CompressLZ4, model.CompressDeflate, model.CompressZstd} {
+			data, err := graph.SerializeWithOptions(model.SerializeOptions{Compression: c})
+			if err != nil {
+				t.Fatalf("%s/%v: Serialize failed: %v", name, c, err)
+			}
+			if len(data) > len(plain) {
+				t.Errorf("%s/%v: expected at most %d bytes, got %d", name, c, len(plain), len(data))
+			}
+			if name == "run" && len(data) > len(plain)/10 {
+				t.Errorf("%s/%v: expected compression, got %d of %d bytes", name, c, len(data), len(plain))
+			}
+			got, err := model.Deserialize(data)
+			if err != nil {
+				t.Fatalf("%s/%v: Deserialize failed: %v", name, c, err)
+			}
+			if !bytes.Equal(got.Payload, payload) || len(got.Nodes) != 1 || got.Nodes[0].Kernel != 1 {
+				t.Errorf("%s/%v: payload or nodes differ after round trip", name, c)
+			}
+		}
+	}
+
+	// Corrupt compressed streams fail cleanly even with a valid CRC
+	graph := &model.Graph{Nodes: []model.Node{{ID: 0}}, Payload: weights}
+	data, err := graph.SerializeWithOptions(model.SerializeOptions{Compression: model.CompressLZ4})
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	off := 32 + 32 + (int(binary.LittleEndian.Uint64(data[32+8:]))+31)&^31
+	if binary.LittleEndian.Uint32(data[off:]) != 0x4C594150 { // "PAYL"
+		t.Fatalf("Expected the payload section at offset %d", off)
+	}
+	body := data[off+32 : off+32+int(binary.LittleEndian.Uint64(data[off+8:]))]
+	sections, err := model.Sections(data)
+	if err != nil {
+		t.Fatalf("Sections failed: %v", err)
+	}
+	want := model.SectionInfo{Tag: "PAYL", Offset: off, Size: len(body), RawSize: len(weights), Compression: model.CompressLZ4}
+	if i := slices.IndexFunc(sections, func(s model.SectionInfo) bool { return s.Tag == "PAYL" }); i < 0 || sections[i] != want {
+		t.Errorf("Expected section %+v, got %+v", want, sections)
+	}
+	if _, err := model.Sections(data[4:]); err == nil {
+		t.Error("Expected Sections to reject a file without a header")
+	}
+	for i := 0; i < 50; i++ {
+		corrupt := bytes.Clone(data)
+		b := corrupt[off+32 : off+32+len(body)]
+		b[rng.IntN(len(b))] = byte(rng.Uint32())
+		binary.LittleEndian.PutUint32(corrupt[off+16:], crc32.ChecksumIEEE(b))
+		if got, err := model.Deserialize(corrupt); err == nil && !bytes.Equal(got.Payload, weights) {
+			t.Fatalf("Corruption %d decoded to a different payload without an error", i)
+		}
+	}
+
+	// Compression composes with signing
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	data, err = graph.SerializeWithOptions(model.SerializeOptions{Compression: model.CompressDeflate, SigningKey: priv})
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if err := model.Verify(data, pub); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	if c, err := model.ParseCompression("LZ4"); err != nil || c != model.CompressLZ4 {
+		t.Errorf("Expected lz4, got %v (err %v)", c, err)
+	}
+	if c, err := model.ParseCompression("zstd"); err != nil || c != model.CompressZstd {
+		t.Errorf("Expected zstd, got %v (err %v)", c, err)
+	}
+	if _, err := model.ParseCompression("brotli"); err == nil {
+		t.Error("Expected an error for an unsupported codec")
+	}
+}
+
+func TestCompileFanIn(t *testing.T) {
+	t.Parallel()
+	// Node 9 consumes five producers, one declared after it; node 0 fans out
+	spec := `node 9 0x00 192 224 <- 1 2,3 4 5
+node 0 0x00 0 32
+iterate i 1 5 {
+    node i 0x00 0 32 0x0 <- 0
+}
+node 6 0x00 0 32 <- 9
+payload ` + strings.Repeat("00", 256) + "\n"
+	dir := t.TempDir()
+	src, out := filepath.Join(dir, "fan.subs"), filepath.Join(dir, "fan.subl")
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	opts := compiler.DefaultOptions()
+	opts.OptimizeLayout = false // Keep the forward reference in the file
+	if _, err := compiler.CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	graph, err := ReadGraph(out, nil)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+	if err := graph.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if topo := graph.Nodes[0].Topo; graph.Nodes[0].ID != 9 || !slices.Equal(topo, []uint32{1, 2, 3, 4, 5}) {
+		t.Fatalf("Expected node 9 to keep all five dependencies, got %d <- %v", graph.Nodes[0].ID, topo)
+	}
+
+	engine, err := NewEngine(graph, &EngineOptions{Workers: 4, Streaming: true})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	var mu sync.Mutex
+	done := make(map[uint32]bool)
+	engine.AddObserver(ObserverFuncs{Before: func(ev NodeEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, n := range graph.Nodes {
+			if n.ID != ev.NodeID {
+				continue
+			}
+			for _, dep := range n.Topo {
+				if !done[dep] {
+					t.Errorf("Node %d ran before its dependency %d", n.ID, dep)
+				}
+			}
+		}
+	}, After: func(ev NodeEvent) {
+		mu.Lock()
+		done[ev.NodeID] = true
+		mu.Unlock()
+	}})
+	if err := engine.ExecuteStreaming(make([]byte, 32), make([]byte, 32)); err != nil {
+		t.Fatalf("ExecuteStreaming failed: %v", err)
+	}
+	if len(done) != 8 {
+		t.Errorf("Expected 8 nodes to run, got %d", len(done))
+	}
+
+	for name, bad := range map[string]string{
+		"undefined": "node 0 0 0 32 <- 7\npayload 00\n",
+		"duplicate": "node 0 0 0 32\nnode 1 0 0 32 <- 0,0\npayload 00\n",
+		"empty":     "node 0 0 0 32 <-\npayload 00\n",
+	} {
+		if err := os.WriteFile(src, []byte(bad), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := compiler.Compile(src, out); err == nil && name != "undefined" {
+			t.Errorf("%s: expected a compile error", name)
+		}
+		if _, err := compiler.CompileWithOptions(src, out, compiler.DefaultOptions()); err == nil {
+			t.Errorf("%s: expected a compile error", name)
+		}
+	}
+}
+
+func TestModelMetadata(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := "meta author Jane Doe\nmeta license MIT\nnode 0 1 0 32\npayload " + strings.Repeat("00", 64) + "\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Compile options override keys from the source
+	out := filepath.Join(dir, "m.subl")
+	opts := compiler.DefaultOptions()
+	opts.Metadata = model.Metadata{model.MetaLicense: "Apache-2.0", model.MetaGitCommit: "abc123"}
+	if _, err := compiler.CompileWithOptions(src, out, opts); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	graph, err := ReadGraph(out, nil)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+	want := model.Metadata{model.MetaAuthor: "Jane Doe", model.MetaLicense: "Apache-2.0", model.MetaGitCommit: "abc123"}
+	if got := graph.Metadata(); !maps.Equal(got, want) {
+		t.Errorf("Expected metadata %v, got %v", want, got)
+	}
+	if keys := graph.Metadata().Keys(); !slices.Equal(keys, []string{"author", "git_commit", "license"}) {
+		t.Errorf("Expected sorted keys, got %v", keys)
+	}
+
+	// Metadata survives both encodings, and equal metadata serializes equally
+	data, err := graph.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if again, _ := graph.Serialize(); !bytes.Equal(data, again) {
+		t.Error("Expected identical bytes from repeated serialization")
+	}
+	if g, err := model.Deserialize(data); err != nil || !maps.Equal(g.Metadata(), want) {
+		t.Errorf("Expected metadata to round-trip, got %v (%v)", g.Metadata(), err)
+	}
+	gob, err := graph.SerializeGob()
+	if err != nil {
+		t.Fatalf("SerializeGob failed: %v", err)
+	}
+	if g, err := model.DeserializeGob(gob); err != nil || !maps.Equal(g.Metadata(), want) {
+		t.Errorf("Expected metadata to round-trip through gob, got %v (%v)", g.Metadata(), err)
+	}
+
+	// Metadata returns a copy
+	graph.Metadata()[model.MetaAuthor] = "someone else"
+	if graph.Meta[model.MetaAuthor] != "Jane Doe" {
+		t.Error("Expected Metadata to return a copy")
+	}
+
+	if err := os.WriteFile(src, []byte("meta author a\nmeta author b\n"+spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := compiler.Compile(src, out); err == nil {
+		t.Error("Expected a duplicate meta key to fail compilation")
+	}
+}
+
+func TestStreamingLoad(t *testing.T) {
+	t.Parallel()
+	rng := rand.New(rand.NewPCG(3, 4))
+	payload := make([]byte, 9<<20+96) // Spans several read chunks
+	for i := 0; i < len(payload); i += 4 {
+		binary.LittleEndian.PutUint32(payload[i:], uint32(rng.IntN(64)))
+	}
+	graph := &model.Graph{
+		Nodes:    []model.Node{{ID: 0, Kernel: 1, In: 0, Out: 64, Segment: 1}, {ID: 1, Kernel: 3, Topo: []uint32{0}}},
+		Payload:  payload,
+		Meta:     model.Metadata{"name": "big"},
+		Segments: []model.Segment{{ID: 1, Length: 64, Role: model.RoleWeight}},
+	}
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	dir := t.TempDir()
+
+	for _, c := range []model.Compression{model.CompressNone, model.CompressLZ4} {
+		data, err := graph.SerializeWithOptions(model.SerializeOptions{Compression: c, SigningKey: priv})
+		if err != nil {
+			t.Fatalf("%v: Serialize failed: %v", c, err)
+		}
+		r, err := model.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%v: NewReader failed: %v", c, err)
+		}
+		if g := r.Graph(); len(g.Nodes) != 2 || g.Payload != nil || g.Meta["name"] != "big" || g.Nodes[0].Segment != 1 {
+			t.Errorf("%v: expected the sections before the payload, got %+v", c, g)
+		}
+		if r.PayloadSize() != int64(len(payload)) {
+			t.Errorf("%v: expected a %d byte payload, got %d", c, len(payload), r.PayloadSize())
+		}
+		if _, err := r.PayloadAt(); (c == model.CompressNone) != (err == nil) {
+			t.Errorf("%v: unexpected PayloadAt result %v", c, err)
+		}
+		g, err := r.Load()
+		if err != nil || !bytes.Equal(g.Payload, payload) {
+			t.Fatalf("%v: Load failed or payload differs: %v", c, err)
+		}
+		if err := r.Verify(pub); err != nil {
+			t.Errorf("%v: Verify failed: %v", c, err)
+		}
+
+		path := filepath.Join(dir, c.String()+".subl")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if g, err := ReadGraph(path, pub); err != nil || !bytes.Equal(g.Payload, payload) {
+			t.Errorf("%v: ReadGraph failed or payload differs: %v", c, err)
+		}
+		if g, err := DecodeGraph(data, pub); err != nil || !bytes.Equal(g.Payload, payload) {
+			t.Errorf("%v: DecodeGraph failed or payload differs: %v", c, err)
+		}
+	}
+
+	// Lazy reads see the stored bytes; a corrupted payload fails the checksum
+	data, _ := graph.Serialize()
+	r, err := model.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	sr, err := r.PayloadAt()
+	if err != nil {
+		t.Fatalf("PayloadAt failed: %v", err)
+	}
+	buf := make([]byte, 16)
+	if _, err := sr.ReadAt(buf, 8<<20); err != nil || !bytes.Equal(buf, payload[8<<20:8<<20+16]) {
+		t.Errorf("Expected lazy reads to match the payload, got %v", err)
+	}
+	data[len(data)-1<<20] ^= 0xFF
+	r, err = model.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if _, err := r.Load(); !errors.Is(err, model.ErrChecksum) {
+		t.Errorf("Expected a checksum error, got %v", err)
+	}
+}
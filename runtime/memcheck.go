@@ -0,0 +1,159 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+)
+
+// MemCheckMode selects what happens when an execution breaks the
+// zero-allocation invariant.
+type MemCheckMode int
+
+const (
+	// MemCheckOff skips memory accounting entirely.
+	MemCheckOff MemCheckMode = iota
+	// MemCheckLog logs each violation and counts it in ExecutionStats.
+	MemCheckLog
+	// MemCheckPanic panics with a *MemCheckError on the first violation.
+	MemCheckPanic
+)
+
+// String returns the mode name as used in flags and logs.
+func (m MemCheckMode) String() string {
+	switch m {
+	case MemCheckOff:
+		return "off"
+	case MemCheckLog:
+		return "log"
+	case MemCheckPanic:
+		return "panic"
+	default:
+		return fmt.Sprintf("MemCheckMode(%d)", int(m))
+	}
+}
+
+// ParseMemCheckMode converts a mode name ("off", "log", "panic") into a MemCheckMode.
+func ParseMemCheckMode(name string) (MemCheckMode, error) {
+	switch name {
+	case "", "off":
+		return MemCheckOff, nil
+	case "log":
+		return MemCheckLog, nil
+	case "panic":
+		return MemCheckPanic, nil
+	default:
+		return MemCheckOff, fmt.Errorf("unknown memcheck mode %q (want off, log or panic)", name)
+	}
+}
+
+// ErrMemoryLeak matches every MemCheckError.
+var ErrMemoryLeak = errors.New("zero-allocation invariant broken")
+
+// MemoryUsage is the memory one execution took and did not give back.
+type MemoryUsage struct {
+	NodePayloads uintptr // Node payload bytes allocated during the run
+	Scratch      uintptr // Scratch bytes, shared and per-worker, not reset by the end of the run
+	Growth       uintptr // FreeTail bytes newly lent to other regions by the end of the run
+	Heap         uint64  // Go heap bytes allocated by the whole process during the run
+}
+
+// String formats the usage for logs.
+func (u MemoryUsage) String() string {
+	return fmt.Sprintf("payloads=%d scratch=%d growth=%d heap=%d", u.NodePayloads, u.Scratch, u.Growth, u.Heap)
+}
+
+// MemCheckError reports an execution that left memory allocated.
+type MemCheckError struct {
+	Usage    MemoryUsage
+	Resident bool // Heap allocations count as a violation only for resident runs
+}
+
+func (e *MemCheckError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrMemoryLeak, e.Usage)
+}
+
+// Is reports whether target is ErrMemoryLeak.
+func (e *MemCheckError) Is(target error) bool {
+	return target == ErrMemoryLeak
+}
+
+// memSnapshot is the allocation state of an arena at the start of a run;
+// every region must be back at its snapshot once the run ends.
+type memSnapshot struct {
+	nodePayloads uintptr
+	scratch      uintptr
+	growth       uintptr
+	heap         uint64
+}
+
+// scratchInUse returns the scratch bytes allocated from the shared region
+// and every worker shard.
+func (a *Arena) scratchInUse() uintptr {
+	used := a.currentScratchOffset.Load() - a.scratch.Offset
+	for i := range a.shardCursors {
+		used += a.shardCursors[i].offset - a.workerShards[i].Offset
+	}
+	return used
+}
+
+// heapAllocated returns the cumulative bytes allocated on the Go heap.
+// ReadMemStats stops the world, which is acceptable for a diagnostic mode
+// and, unlike runtime/metrics, flushes per-P caches so small allocations
+// are not missed.
+func heapAllocated() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.TotalAlloc
+}
+
+// snapshotMemory records the allocation state of arena before a run.
+func (e *Engine) snapshotMemory(arena *Arena) memSnapshot {
+	return memSnapshot{
+		nodePayloads: arena.currentNodePayloadOffset.Load(),
+		scratch:      arena.scratchInUse(),
+		growth:       arena.Grown(),
+		heap:         heapAllocated(),
+	}
+}
+
+// grewBy returns how far a counter rose above its baseline; resets during
+// the run count as no growth.
+func grewBy[T uintptr | uint64](before, after T) T {
+	if after <= before {
+		return 0
+	}
+	return after - before
+}
+
+// checkMemory compares arena against the snapshot taken before the run,
+// records the usage and reports a violation according to the MemCheck mode.
+// Heap allocations only count against resident runs; Execute rebuilds its
+// sublates and scheduler state each call.
+func (e *Engine) checkMemory(before memSnapshot, arena *Arena, resident bool) {
+	heap := heapAllocated()
+	usage := MemoryUsage{
+		NodePayloads: grewBy(before.nodePayloads, arena.currentNodePayloadOffset.Load()),
+		Scratch:      grewBy(before.scratch, arena.scratchInUse()),
+		Growth:       grewBy(before.growth, arena.Grown()),
+		Heap:         grewBy(before.heap, heap),
+	}
+	leaked := usage.NodePayloads > 0 || usage.Scratch > 0 || usage.Growth > 0 || (resident && usage.Heap > 0)
+
+	e.mu.Lock()
+	e.stats.Memory = usage
+	if leaked {
+		e.stats.MemCheckViolations++
+	}
+	e.mu.Unlock()
+
+	if !leaked {
+		return
+	}
+	err := &MemCheckError{Usage: usage, Resident: resident}
+	if e.opts.MemCheck == MemCheckPanic {
+		panic(err)
+	}
+	log.Printf("memcheck: %v", err)
+}
@@ -0,0 +1,94 @@
+package runtime
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMemCheckMode(t *testing.T) {
+	t.Parallel()
+	for _, mode := range []MemCheckMode{MemCheckOff, MemCheckLog, MemCheckPanic} {
+		got, err := ParseMemCheckMode(mode.String())
+		if err != nil || got != mode {
+			t.Errorf("Expected %v, got %v (err %v)", mode, got, err)
+		}
+	}
+	if _, err := ParseMemCheckMode("strict"); err == nil {
+		t.Error("Expected error for unknown memcheck mode")
+	}
+}
+
+// Not parallel: heap accounting is process-wide, so concurrent tests would
+// show up as allocations of this engine.
+func TestMemCheckResidentRunIsClean(t *testing.T) {
+	engine, err := NewEngine(chainGraph(), &EngineOptions{
+		Workers:   1,
+		ArenaSize: 1 << 16,
+		MemCheck:  MemCheckPanic,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := engine.Run(); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	}
+
+	stats := engine.Stats()
+	if stats.MemCheckViolations != 0 {
+		t.Errorf("Expected no violations, got %d (%v)", stats.MemCheckViolations, stats.Memory)
+	}
+}
+
+func TestMemCheckDetectsScratchLeak(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(chainGraph(), &EngineOptions{
+		Workers:     1,
+		ArenaSize:   1 << 16,
+		MemCheck:    MemCheckLog,
+		DisableMemo: true,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	// Every node takes scratch and never resets it
+	engine.AddObserver(ObserverFuncs{After: func(NodeEvent) {
+		_, _ = engine.arena.AllocateScratch(16, 16)
+	}})
+
+	if err := engine.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	stats := engine.Stats()
+	if stats.MemCheckViolations != 1 {
+		t.Errorf("Expected 1 violation, got %d", stats.MemCheckViolations)
+	}
+	if stats.Memory.Scratch != 3*16 {
+		t.Errorf("Expected 48 leaked scratch bytes, got %d", stats.Memory.Scratch)
+	}
+}
+
+func TestMemCheckPanics(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(chainGraph(), &EngineOptions{
+		Workers:   1,
+		ArenaSize: 1 << 16,
+		MemCheck:  MemCheckPanic,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	engine.AddObserver(ObserverFuncs{After: func(NodeEvent) {
+		_, _ = engine.arena.AllocateScratch(16, 16)
+	}})
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrMemoryLeak) {
+			t.Errorf("Expected a MemCheckError panic, got %v", err)
+		}
+	}()
+	_ = engine.Run()
+	t.Error("Expected Run to panic")
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"hash/maphash"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+)
+
+// memoTable remembers the input of every node's last resident execution.
+// A node whose input bytes are unchanged and whose prerequisites were all
+// skipped would recompute the output it already holds, so the kernel is
+// skipped and the previous output reused. FlagDirty marks nodes that ran in
+// the latest execution, which is how skips propagate down a subtree.
+type memoTable struct {
+	seed    maphash.Seed
+	prereqs [][]int  // Prerequisite node indices of each node
+	inputs  []uint64 // Input hash at each node's last execution
+	valid   []bool   // Whether inputs holds a hash for the node
+}
+
+// newMemoTable builds an empty table for graph.
+func newMemoTable(graph *model.Graph) *memoTable {
+	s := &StreamScheduler{
+		nodes:      graph.Nodes,
+		inDegree:   make([]int32, len(graph.Nodes)),
+		dependents: make([][]int, len(graph.Nodes)),
+	}
+	s.buildDependencies()
+	return &memoTable{
+		seed:    maphash.MakeSeed(),
+		prereqs: s.prerequisites(),
+		inputs:  make([]uint64, len(graph.Nodes)),
+		valid:   make([]bool, len(graph.Nodes)),
+	}
+}
+
+// reuse reports whether node i can skip its kernel. On a hit the previous
+// output is copied into PayloadProp, leaving both buffers exactly as a real
+// execution followed by SwapBuffers would. On a miss the input is recorded
+// and the node marked dirty; the caller must then run the kernel.
+func (m *memoTable) reuse(i int, sublates []*core.Sublate) bool {
+	s := sublates[i]
+	h := maphash.Bytes(m.seed, s.PayloadProp)
+
+	// Tied nodes take turns on one buffer pair, so PayloadPrev need not
+	// hold this node's previous output
+	hit := m.valid[i] && m.inputs[i] == h && !s.HasFlag(core.FlagShared)
+	for _, p := range m.prereqs[i] {
+		if hit && sublates[p] != nil && sublates[p].HasFlag(core.FlagDirty) {
+			hit = false
+		}
+	}
+
+	if hit {
+		copy(s.PayloadProp, s.PayloadPrev)
+		s.ClearFlag(core.FlagDirty)
+		return true
+	}
+	m.inputs[i], m.valid[i] = h, true
+	s.SetFlag(core.FlagDirty)
+	return false
+}
+
+// setupMemo enables result caching unless EngineOptions.DisableMemo is set.
+func (e *Engine) setupMemo() {
+	if e.opts.DisableMemo || len(e.graph.Nodes) == 0 {
+		return
+	}
+	e.memo = newMemoTable(e.graph)
+}
+
+// forget drops node i's recorded input so its next run executes the kernel.
+func (m *memoTable) forget(i int) {
+	m.valid[i] = false
+}
+
+// reset forgets every recorded input, forcing the next run to execute all nodes.
+func (m *memoTable) reset() {
+	clear(m.valid)
+}
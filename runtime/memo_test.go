@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// memoGraph has a chain 0 -> 1 fed by non-zero data and an independent node 2
+// on zeros, which the square-plus-x kernel maps to zeros forever.
+func memoGraph() *model.Graph {
+	payload := make([]byte, 192)
+	for i := 0; i < 16; i++ {
+		binary.LittleEndian.PutUint32(payload[i*4:], math.Float32bits(float32(i)*0.25+0.5))
+	}
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+			{ID: 2, Kernel: 1, In: 128, Out: 192},
+		},
+	}
+}
+
+func TestMemoSkipsUnchangedNodes(t *testing.T) {
+	t.Parallel()
+	newEngine := func(disable bool) *Engine {
+		engine, err := NewEngine(memoGraph(), &EngineOptions{
+			Workers:     1,
+			ArenaSize:   1 << 16,
+			EnableStats: true,
+			DisableMemo: disable,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		return engine
+	}
+	memo, plain := newEngine(false), newEngine(true)
+
+	for run := 0; run < 2; run++ {
+		if err := memo.Run(); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		if err := plain.Run(); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		// Feed node 0 a new input for the next run
+		input := make([]byte, 64)
+		binary.LittleEndian.PutUint32(input, math.Float32bits(float32(run+2)))
+		for _, e := range []*Engine{memo, plain} {
+			if err := e.SetNodeData(0, input); err != nil {
+				t.Fatalf("SetNodeData failed: %v", err)
+			}
+		}
+	}
+
+	// Run 1 misses everywhere. In run 2 node 0 sees new input, so node 1
+	// reruns behind its dirty prerequisite while node 2 is reused.
+	stats := memo.Stats()
+	if stats.MemoHits != 1 || stats.MemoMisses != 5 {
+		t.Errorf("Expected 1 hit and 5 misses, got %d and %d", stats.MemoHits, stats.MemoMisses)
+	}
+	if stats := plain.Stats(); stats.MemoHits != 0 || stats.MemoMisses != 0 {
+		t.Errorf("Expected no memo activity when disabled, got %d hits, %d misses", stats.MemoHits, stats.MemoMisses)
+	}
+
+	for run := 0; run < 3; run++ {
+		_ = memo.Run()
+		_ = plain.Run()
+	}
+	for i := range memo.sublates {
+		m, p := memo.sublates[i], plain.sublates[i]
+		if !bytes.Equal(m.PayloadProp, p.PayloadProp) || !bytes.Equal(m.PayloadPrev, p.PayloadPrev) {
+			t.Errorf("Node %d buffers differ between memoized and plain runs", i)
+		}
+	}
+}
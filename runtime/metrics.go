@@ -0,0 +1,359 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds used for execution latency histograms.
+var DefaultLatencyBuckets = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// LatencyHistogram is a cumulative-friendly histogram of execution latencies.
+// Counts[i] holds observations <= Bounds[i]; the final slot counts overflow.
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []int64
+	Sum    time.Duration
+	Count  int64
+}
+
+// newLatencyHistogram creates an empty histogram over the default buckets.
+func newLatencyHistogram() LatencyHistogram {
+	return LatencyHistogram{
+		Bounds: DefaultLatencyBuckets,
+		Counts: make([]int64, len(DefaultLatencyBuckets)+1),
+	}
+}
+
+// observe records one latency sample.
+func (h *LatencyHistogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		*h = newLatencyHistogram()
+	}
+	i := sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })
+	h.Counts[i]++
+	h.Sum += d
+	h.Count++
+}
+
+// clone returns a deep copy safe to hand to callers.
+func (h LatencyHistogram) clone() LatencyHistogram {
+	out := h
+	out.Counts = append([]int64(nil), h.Counts...)
+	return out
+}
+
+// LatencyPercentiles summarizes a latency histogram.
+type LatencyPercentiles struct {
+	P50, P95, P99 time.Duration
+}
+
+// String renders the percentiles on one line.
+func (p LatencyPercentiles) String() string {
+	return fmt.Sprintf("p50=%v p95=%v p99=%v", p.P50, p.P95, p.P99)
+}
+
+// Quantile estimates the q-th quantile (0 <= q <= 1) by interpolating linearly
+// within the bucket that holds it. Observations past the last bound are
+// reported as that bound.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+	q = min(max(q, 0), 1)
+
+	rank := q * float64(h.Count)
+	cumulative := int64(0)
+	for i, n := range h.Counts {
+		if n == 0 || float64(cumulative+n) < rank {
+			cumulative += n
+			continue
+		}
+		if i == len(h.Bounds) {
+			break
+		}
+		lower := time.Duration(0)
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		}
+		fraction := (rank - float64(cumulative)) / float64(n)
+		return lower + time.Duration(fraction*float64(h.Bounds[i]-lower))
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// Percentiles returns the p50, p95 and p99 estimates of the histogram.
+func (h LatencyHistogram) Percentiles() LatencyPercentiles {
+	return LatencyPercentiles{
+		P50: h.Quantile(0.50),
+		P95: h.Quantile(0.95),
+		P99: h.Quantile(0.99),
+	}
+}
+
+// QueueDepths reports how many items sit in the scheduler queues.
+type QueueDepths struct {
+	Ready   int // Nodes queued for a worker
+	Waiting int // Nodes blocked on unfinished prerequisites or still running
+
+	Admission int // Streaming requests waiting for the engine
+}
+
+// QueueDepths returns the scheduler queue depths of the latest streaming
+// execution and the current admission backlog. Ready and Waiting are zero
+// when the engine runs without a streaming scheduler.
+func (e *Engine) QueueDepths() QueueDepths {
+	var depths QueueDepths
+	e.life.mu.Lock()
+	scheduler := e.scheduler
+	e.life.mu.Unlock()
+	if scheduler != nil {
+		depths = scheduler.depths()
+	}
+	depths.Admission = e.admission.depth()
+	return depths
+}
+
+// MetricType is the Prometheus metric type of a family.
+type MetricType string
+
+// Metric types used by the runtime.
+const (
+	MetricCounter   MetricType = "counter"
+	MetricGauge     MetricType = "gauge"
+	MetricHistogram MetricType = "histogram"
+)
+
+// MetricSample is a single labelled value. For histogram families the sample
+// carries the cumulative bucket counts instead of Value.
+type MetricSample struct {
+	Labels  map[string]string
+	Value   float64
+	Buckets []float64 // upper bounds in seconds, histogram only
+	Counts  []uint64  // cumulative counts per bucket, histogram only
+	Sum     float64   // histogram only
+	Count   uint64    // histogram only
+}
+
+// MetricFamily groups samples sharing a name, help text and type.
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    MetricType
+	Samples []MetricSample
+}
+
+// MetricsRegistry exposes the stats of one or more engines in Prometheus form.
+//
+// The registry does not import the Prometheus client. Gather returns plain
+// families that a prometheus.Collector adapter can translate with
+// MustNewConstMetric / MustNewConstHistogram inside Collect, while ServeHTTP
+// renders the text exposition format directly for scrape endpoints.
+type MetricsRegistry struct {
+	namespace string
+	mu        sync.RWMutex
+	engines   map[string]*Engine
+}
+
+// NewMetricsRegistry creates a registry whose metric names start with namespace
+// (defaults to "sublation").
+func NewMetricsRegistry(namespace string) *MetricsRegistry {
+	if namespace == "" {
+		namespace = "sublation"
+	}
+	return &MetricsRegistry{
+		namespace: namespace,
+		engines:   make(map[string]*Engine),
+	}
+}
+
+// Register adds an engine under the given model label. Stats are only
+// collected for engines created with EnableStats.
+func (r *MetricsRegistry) Register(model string, e *Engine) error {
+	if e == nil {
+		return fmt.Errorf("cannot register nil engine for model %q", model)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.engines[model]; exists {
+		return fmt.Errorf("model %q already registered", model)
+	}
+	r.engines[model] = e
+	return nil
+}
+
+// Unregister removes the engine registered under model.
+func (r *MetricsRegistry) Unregister(model string) {
+	r.mu.Lock()
+	delete(r.engines, model)
+	r.mu.Unlock()
+}
+
+// Gather snapshots all registered engines into metric families.
+func (r *MetricsRegistry) Gather() []MetricFamily {
+	r.mu.RLock()
+	models := make([]string, 0, len(r.engines))
+	for name := range r.engines {
+		models = append(models, name)
+	}
+	sort.Strings(models)
+	engines := make([]*Engine, len(models))
+	for i, name := range models {
+		engines[i] = r.engines[name]
+	}
+	r.mu.RUnlock()
+
+	executions := MetricFamily{Name: r.namespace + "_executions_total", Help: "Total graph executions.", Type: MetricCounter}
+	latency := MetricFamily{Name: r.namespace + "_execution_latency_seconds", Help: "Graph execution latency.", Type: MetricHistogram}
+	classLatency := MetricFamily{Name: r.namespace + "_request_latency_seconds", Help: "Streaming request latency including queueing, by QoS class.", Type: MetricHistogram}
+	kernelsFamily := MetricFamily{Name: r.namespace + "_kernel_executions_total", Help: "Kernel invocations by opcode.", Type: MetricCounter}
+	arena := MetricFamily{Name: r.namespace + "_arena_utilization_ratio", Help: "Fraction of the arena in use.", Type: MetricGauge}
+	queues := MetricFamily{Name: r.namespace + "_scheduler_queue_depth", Help: "Items waiting in scheduler queues.", Type: MetricGauge}
+
+	for i, e := range engines {
+		model := models[i]
+		stats := e.Stats()
+
+		executions.Samples = append(executions.Samples, MetricSample{
+			Labels: map[string]string{"model": model},
+			Value:  float64(stats.TotalExecutions),
+		})
+		latency.Samples = append(latency.Samples, histogramSample(model, stats.Latency))
+		for p := Priority(0); p < numPriorities; p++ {
+			if h, ok := stats.ClassLatency[p]; ok {
+				sample := histogramSample(model, h)
+				sample.Labels["class"] = p.String()
+				classLatency.Samples = append(classLatency.Samples, sample)
+			}
+		}
+
+		opcodes := make([]int, 0, len(stats.KernelExecutions))
+		for op := range stats.KernelExecutions {
+			opcodes = append(opcodes, int(op))
+		}
+		sort.Ints(opcodes)
+		for _, op := range opcodes {
+			kernelsFamily.Samples = append(kernelsFamily.Samples, MetricSample{
+				Labels: map[string]string{"model": model, "kernel": fmt.Sprintf("0x%02x", op)},
+				Value:  float64(stats.KernelExecutions[uint8(op)]),
+			})
+		}
+
+		arena.Samples = append(arena.Samples, MetricSample{
+			Labels: map[string]string{"model": model},
+			Value:  stats.ArenaUtilization,
+		})
+
+		depths := e.QueueDepths()
+		queues.Samples = append(queues.Samples,
+			MetricSample{Labels: map[string]string{"model": model, "queue": "ready"}, Value: float64(depths.Ready)},
+			MetricSample{Labels: map[string]string{"model": model, "queue": "waiting"}, Value: float64(depths.Waiting)},
+			MetricSample{Labels: map[string]string{"model": model, "queue": "admission"}, Value: float64(depths.Admission)},
+		)
+	}
+
+	return []MetricFamily{executions, latency, classLatency, kernelsFamily, arena, queues}
+}
+
+// histogramSample converts a latency histogram into cumulative Prometheus buckets.
+func histogramSample(model string, h LatencyHistogram) MetricSample {
+	sample := MetricSample{
+		Labels:  map[string]string{"model": model},
+		Buckets: make([]float64, len(h.Bounds)),
+		Counts:  make([]uint64, len(h.Bounds)),
+		Sum:     h.Sum.Seconds(),
+		Count:   uint64(h.Count),
+	}
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		if i < len(h.Counts) {
+			cumulative += uint64(h.Counts[i])
+		}
+		sample.Buckets[i] = bound.Seconds()
+		sample.Counts[i] = cumulative
+	}
+	return sample
+}
+
+// WriteText renders all families in the Prometheus text exposition format (0.0.4).
+func (r *MetricsRegistry) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, family := range r.Gather() {
+		fmt.Fprintf(&b, "# HELP %s %s\n", family.Name, family.Help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", family.Name, family.Type)
+		for _, sample := range family.Samples {
+			if family.Type == MetricHistogram {
+				writeHistogramText(&b, family.Name, sample)
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s %s\n", family.Name, formatLabels(sample.Labels, "", ""), formatFloat(sample.Value))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHistogramText emits the _bucket, _sum and _count series of one histogram sample.
+func writeHistogramText(b *strings.Builder, name string, sample MetricSample) {
+	for i, bound := range sample.Buckets {
+		fmt.Fprintf(b, "%s_bucket%s %d\n", name, formatLabels(sample.Labels, "le", formatFloat(bound)), sample.Counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket%s %d\n", name, formatLabels(sample.Labels, "le", "+Inf"), sample.Count)
+	fmt.Fprintf(b, "%s_sum%s %s\n", name, formatLabels(sample.Labels, "", ""), formatFloat(sample.Sum))
+	fmt.Fprintf(b, "%s_count%s %d\n", name, formatLabels(sample.Labels, "", ""), sample.Count)
+}
+
+// formatLabels renders a sorted label set, optionally appending one extra pair.
+func formatLabels(labels map[string]string, extraKey, extraValue string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, strconv.Quote(labels[k])))
+	}
+	if extraKey != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extraKey, strconv.Quote(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat prints a sample value the way the Prometheus client does.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ServeHTTP implements http.Handler so the registry can be mounted at /metrics.
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := r.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,73 @@
+package runtime
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestLatencyHistogramObserve(t *testing.T) {
+	t.Parallel()
+	h := newLatencyHistogram()
+	h.observe(10 * time.Microsecond)
+	h.observe(3 * time.Millisecond)
+	h.observe(2 * time.Second)
+
+	if h.Count != 3 {
+		t.Errorf("Expected 3 observations, got %d", h.Count)
+	}
+	if h.Counts[0] != 1 {
+		t.Errorf("Expected 1 sample in first bucket, got %d", h.Counts[0])
+	}
+	if h.Counts[len(h.Counts)-1] != 1 {
+		t.Errorf("Expected 1 overflow sample, got %d", h.Counts[len(h.Counts)-1])
+	}
+
+	sample := histogramSample("m", h)
+	if last := sample.Counts[len(sample.Counts)-1]; last != 2 {
+		t.Errorf("Expected cumulative count 2 at 1s bucket, got %d", last)
+	}
+}
+
+func TestMetricsRegistryExposition(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 128),
+		Nodes:   []model.Node{{Kernel: 1, In: 0, Out: 64}},
+	}
+	engine, err := NewEngine(graph, &EngineOptions{ArenaSize: 4096, EnableStats: true})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.Execute(NewExecutionContext(len(graph.Nodes))); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	registry := NewMetricsRegistry("")
+	if err := registry.Register("tiny", engine); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := registry.Register("tiny", engine); err == nil {
+		t.Error("Expected error registering duplicate model")
+	}
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE sublation_executions_total counter",
+		`sublation_executions_total{model="tiny"} 1`,
+		`sublation_execution_latency_seconds_bucket{model="tiny",le="+Inf"} 1`,
+		`sublation_execution_latency_seconds_count{model="tiny"} 1`,
+		`sublation_kernel_executions_total{kernel="0x01",model="tiny"} 1`,
+		`sublation_scheduler_queue_depth{model="tiny",queue="ready"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Exposition missing %q", want)
+		}
+	}
+}
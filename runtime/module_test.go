@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/model"
+)
+
+func TestModuleInstantiation(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	compile := func(spec string) (*model.Graph, error) {
+		src, out := filepath.Join(dir, "m.subs"), filepath.Join(dir, "m.subl")
+		if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := compiler.Compile(src, out); err != nil {
+			return nil, err
+		}
+		return ReadGraph(out, nil)
+	}
+
+	// A two-node layer whose last node reuses the first one's weights,
+	// chained three times after node 0 and once more beside the chain
+	spec := `module layer {
+    node 0 0x01 0 32
+    iterate i 1 1 {
+        node i 0x03 32 64 <- 0
+    }
+    node 2 0x01 0 0 <- 1
+    tie 0 2
+    payload ` + strings.Repeat("01", 64) + `
+    input 0
+    output 2
+}
+node 0 0x00 0 32
+payload ` + strings.Repeat("00", 32) + `
+use layer 10 x3 <- 0
+use layer 100 <- 0
+`
+	graph, err := compile(spec)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if len(graph.Nodes) != 13 || len(graph.Payload) != 32+4*64 {
+		t.Fatalf("Expected 13 nodes and %d payload bytes, got %d and %d", 32+4*64, len(graph.Nodes), len(graph.Payload))
+	}
+	if !bytes.Equal(graph.Payload[32:], bytes.Repeat([]byte{1}, 4*64)) {
+		t.Error("Expected every instance to carry a copy of the module payload")
+	}
+
+	nodes := make(map[uint32]model.Node)
+	for _, n := range graph.Nodes {
+		nodes[n.ID] = n
+	}
+	for k, tc := range []struct {
+		base, dep, offset uint32
+	}{
+		{10, 0, 32},
+		{13, 12, 96},
+		{16, 15, 160},
+		{100, 0, 224},
+	} {
+		in, mid, out := nodes[tc.base], nodes[tc.base+1], nodes[tc.base+2]
+		if !slices.Equal(in.Topo, []uint32{tc.dep}) || !slices.Equal(mid.Topo, []uint32{tc.base}) || !slices.Equal(out.Topo, []uint32{tc.base + 1}) {
+			t.Errorf("instance %d: unexpected topology %v %v %v", k, in.Topo, mid.Topo, out.Topo)
+		}
+		if in.In != tc.offset || mid.In != tc.offset+32 || out.In != in.In || out.Out != in.Out {
+			t.Errorf("instance %d: unexpected payload ranges %+v %+v %+v", k, in, mid, out)
+		}
+	}
+	if segs := graph.SharedSegments(); len(segs) != 4 || segs[1].In != 96 || !slices.Equal(segs[1].Nodes, []uint32{13, 15}) {
+		t.Errorf("Expected one tied segment per instance, got %+v", segs)
+	}
+
+	engine, err := NewEngine(graph, &EngineOptions{ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Errorf("Run failed: %v", err)
+	}
+
+	m := &model.Module{Name: "m", Nodes: []model.Node{{ID: 0, Out: 32}}, Payload: make([]byte, 32), Outputs: []uint32{0}}
+	g := &model.Graph{Nodes: []model.Node{{ID: 5}}}
+	if _, err := g.Instantiate(m, 5, nil); err == nil {
+		t.Error("Expected Instantiate to reject colliding node IDs")
+	}
+	m.Outputs = []uint32{1}
+	if _, err := g.Instantiate(m, 6, nil); err == nil {
+		t.Error("Expected Instantiate to reject an output that is not a node")
+	}
+
+	for _, tc := range []struct{ spec, want string }{
+		{"node 0 1 0 32\nuse layer 1\n", "undefined module"},
+		{"input 0\n", "only allowed in a module"},
+		{"module a {\nnode 0 1 0 32\noutput 0\n}\nmodule a {\nnode 0 1 0 32\noutput 0\n}\n", "duplicate module"},
+		{"module a {\nmodule b {\n}\n}\n", "cannot be nested"},
+		{"module a {\nnode 0 1 0 32\n}\n", "declares no outputs"},
+		{"module a {\nnode 0 1 0 32\noutput 0\n}\nuse a 1 x0\n", "instance count"},
+		{"module a {\nnode 0 1 0 32\noutput 0\n", "unterminated block"},
+	} {
+		if _, err := compile(tc.spec); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected an error containing %q, got %v", tc.spec, tc.want, err)
+		}
+	}
+}
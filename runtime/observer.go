@@ -0,0 +1,117 @@
+package runtime
+
+import "time"
+
+// NodeEvent describes one kernel call to an Observer.
+type NodeEvent struct {
+	NodeID   uint32
+	KernelID uint8
+	Worker   int
+	Payload  []byte        // Data the kernel runs on; valid only during the callback
+	Output   []byte        // The node's output within Payload, nil in BeforeNode
+	Duration time.Duration // Kernel time, zero in BeforeNode
+}
+
+// RunEvent describes one finished graph run to an Observer.
+type RunEvent struct {
+	Nodes    int // Nodes in the graph
+	Duration time.Duration
+	Err      error
+}
+
+// Observer receives callbacks around every kernel call and graph run. With
+// parallel workers BeforeNode and AfterNode are called concurrently, so
+// implementations must be safe for concurrent use. Callbacks run on the
+// execution path and should return quickly.
+type Observer interface {
+	BeforeNode(ev NodeEvent)
+	AfterNode(ev NodeEvent)
+	AfterRun(ev RunEvent)
+}
+
+// ObserverFuncs adapts optional functions to the Observer interface.
+type ObserverFuncs struct {
+	Before func(NodeEvent)
+	After  func(NodeEvent)
+	Run    func(RunEvent)
+}
+
+// BeforeNode implements Observer.
+func (o ObserverFuncs) BeforeNode(ev NodeEvent) {
+	if o.Before != nil {
+		o.Before(ev)
+	}
+}
+
+// AfterNode implements Observer.
+func (o ObserverFuncs) AfterNode(ev NodeEvent) {
+	if o.After != nil {
+		o.After(ev)
+	}
+}
+
+// AfterRun implements Observer.
+func (o ObserverFuncs) AfterRun(ev RunEvent) {
+	if o.Run != nil {
+		o.Run(ev)
+	}
+}
+
+// AddObserver installs an observer for subsequent executions. Like SetTracer,
+// it must not be called while an execution is in flight.
+func (e *Engine) AddObserver(o Observer) {
+	if o != nil {
+		e.observers = append(e.observers, o)
+	}
+}
+
+// callKernel runs the kernel of node i on payload under the watchdog,
+// reporting it to the tracer and observers.
+func (e *Engine) callKernel(worker, i int, kernelID uint8, kernel func([]byte), payload []byte) error {
+	nodeID := e.graph.Nodes[i].ID
+	if e.tracer == nil && len(e.observers) == 0 {
+		watch := e.watchNode(worker, nodeID, kernelID)
+		kernel(payload)
+		if e.lineage != nil {
+			e.recordLineage(nodeID, false)
+		}
+		return watch.finish()
+	}
+
+	ev := NodeEvent{NodeID: nodeID, KernelID: kernelID, Worker: worker, Payload: payload}
+	for _, o := range e.observers {
+		o.BeforeNode(ev)
+	}
+
+	watch := e.watchNode(worker, nodeID, kernelID)
+	start := time.Now()
+	kernel(payload)
+	ev.Duration = time.Since(start)
+	ev.Output = e.flows[i].of(payload)
+	if e.lineage != nil {
+		e.recordLineage(nodeID, false)
+	}
+	err := watch.finish()
+
+	if e.tracer != nil {
+		e.traceNode(worker, nodeID, kernelID, start)
+	}
+	for _, o := range e.observers {
+		o.AfterNode(ev)
+	}
+	return err
+}
+
+// observeRun reports a finished graph run to the observers.
+func (e *Engine) observeRun(start time.Time, err error) {
+	if e.lineage != nil {
+		e.lineage.runs.Add(1)
+	}
+	if len(e.observers) == 0 {
+		return
+	}
+	ev := RunEvent{Nodes: len(e.graph.Nodes), Duration: time.Since(start), Err: err}
+	for _, o := range e.observers {
+		o.AfterRun(ev)
+	}
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"sync"
+	"testing"
+)
+
+// countingObserver tallies callbacks from concurrent workers.
+type countingObserver struct {
+	mu     sync.Mutex
+	before map[uint32]int
+	after  map[uint32]int
+	runs   []RunEvent
+	empty  int // AfterNode events without a payload view
+}
+
+func newCountingObserver() *countingObserver {
+	return &countingObserver{before: make(map[uint32]int), after: make(map[uint32]int)}
+}
+
+func (o *countingObserver) BeforeNode(ev NodeEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.before[ev.NodeID]++
+}
+
+func (o *countingObserver) AfterNode(ev NodeEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.after[ev.NodeID]++
+	if len(ev.Payload) == 0 {
+		o.empty++
+	}
+}
+
+func (o *countingObserver) AfterRun(ev RunEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.runs = append(o.runs, ev)
+}
+
+func TestObservers(t *testing.T) {
+	t.Parallel()
+	for _, streaming := range []bool{false, true} {
+		engine, err := NewEngine(chainGraph(), &EngineOptions{
+			Workers:   2,
+			ArenaSize: 1 << 16,
+			Streaming: streaming,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+
+		observer := newCountingObserver()
+		var runs int
+		engine.AddObserver(observer)
+		engine.AddObserver(ObserverFuncs{Run: func(RunEvent) { runs++ }})
+
+		for i := 0; i < 2; i++ {
+			if err := engine.Execute(NewExecutionContext(3)); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+		}
+
+		for id := uint32(0); id < 3; id++ {
+			if observer.before[id] != 2 || observer.after[id] != 2 {
+				t.Errorf("streaming=%v: expected node %d observed twice, got before=%d after=%d",
+					streaming, id, observer.before[id], observer.after[id])
+			}
+		}
+		if observer.empty != 0 {
+			t.Errorf("streaming=%v: expected every node event to carry a payload, %d did not", streaming, observer.empty)
+		}
+		if len(observer.runs) != 2 || runs != 2 {
+			t.Fatalf("streaming=%v: expected 2 runs, got %d and %d", streaming, len(observer.runs), runs)
+		}
+		if ev := observer.runs[0]; ev.Nodes != 3 || ev.Err != nil || ev.Duration <= 0 {
+			t.Errorf("streaming=%v: unexpected run event %+v", streaming, ev)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package runtime
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority is the QoS class of a streaming request.
+type Priority int
+
+const (
+	// PriorityBatch is bulk work that tolerates queueing.
+	PriorityBatch Priority = iota
+	// PriorityNormal is the class used by ExecuteStreaming.
+	PriorityNormal
+	// PriorityCritical is latency-sensitive work served ahead of the others.
+	PriorityCritical
+
+	numPriorities
+)
+
+// DefaultStarvationLimit is how many times a waiting request may be bypassed
+// by higher classes before it is served regardless of priority.
+const DefaultStarvationLimit = 8
+
+// String returns the class name used in stats and metrics labels.
+func (p Priority) String() string {
+	switch p {
+	case PriorityBatch:
+		return "batch"
+	case PriorityNormal:
+		return "normal"
+	case PriorityCritical:
+		return "critical"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+// ParsePriority converts a class name into a Priority.
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "batch":
+		return PriorityBatch, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "critical":
+		return PriorityCritical, nil
+	}
+	return 0, fmt.Errorf("unknown priority %q", name)
+}
+
+// admissionQueue serializes streaming requests on an engine, granting the
+// engine to the highest waiting class. A class whose oldest request has been
+// bypassed limit times is served next, so bulk work cannot starve.
+type admissionQueue struct {
+	mu      sync.Mutex
+	busy    bool
+	waiting [numPriorities][]chan struct{}
+	skipped [numPriorities]int
+	limit   int
+}
+
+// newAdmissionQueue creates a queue with the given starvation limit.
+func newAdmissionQueue(limit int) *admissionQueue {
+	if limit <= 0 {
+		limit = DefaultStarvationLimit
+	}
+	return &admissionQueue{limit: limit}
+}
+
+// acquire blocks until the caller owns the engine.
+func (q *admissionQueue) acquire(p Priority) {
+	q.mu.Lock()
+	if !q.busy {
+		q.busy = true
+		q.mu.Unlock()
+		return
+	}
+	turn := make(chan struct{})
+	q.waiting[p] = append(q.waiting[p], turn)
+	q.mu.Unlock()
+	<-turn
+}
+
+// release hands the engine to the next request, or marks it idle.
+func (q *admissionQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	class, ok := q.next()
+	if !ok {
+		q.busy = false
+		return
+	}
+
+	turn := q.waiting[class][0]
+	q.waiting[class] = q.waiting[class][1:]
+	q.skipped[class] = 0
+	for lower := Priority(0); lower < class; lower++ {
+		if len(q.waiting[lower]) > 0 {
+			q.skipped[lower]++
+		}
+	}
+	close(turn)
+}
+
+// next picks the class to serve: the most-bypassed starving class if any,
+// otherwise the highest class with waiters.
+func (q *admissionQueue) next() (Priority, bool) {
+	starving, most := Priority(-1), 0
+	for p := Priority(0); p < numPriorities; p++ {
+		if len(q.waiting[p]) > 0 && q.skipped[p] >= q.limit && q.skipped[p] > most {
+			starving, most = p, q.skipped[p]
+		}
+	}
+	if starving >= 0 {
+		return starving, true
+	}
+	for p := numPriorities - 1; p >= 0; p-- {
+		if len(q.waiting[p]) > 0 {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// depth returns the number of queued requests.
+func (q *admissionQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	total := 0
+	for p := range q.waiting {
+		total += len(q.waiting[p])
+	}
+	return total
+}
+
+// ExecuteStreamingPriority runs one streaming request in the given QoS class.
+// Concurrent requests are serialized on the engine; higher classes are served
+// first, subject to EngineOptions.StarvationLimit.
+func (e *Engine) ExecuteStreamingPriority(p Priority, input, output []byte) error {
+	if p < 0 || p >= numPriorities {
+		return fmt.Errorf("invalid priority %d", int(p))
+	}
+	if !e.opts.Streaming {
+		return fmt.Errorf("engine not configured for streaming")
+	}
+
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+
+	// Reject oversized input before queueing rather than partway through a run
+	if err := e.checkInputSize(input); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	e.admission.acquire(p)
+	defer e.admission.release()
+
+	if e.opts.Replay != nil {
+		e.opts.Replay.begin(p, input)
+	}
+	err := e.executeStreaming(input, output)
+	if e.opts.Replay != nil {
+		e.opts.Replay.end(output[:min(len(output), e.OutputSize())], err, time.Since(start))
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.opts.EnableStats {
+		e.mu.Lock()
+		h := e.stats.ClassLatency[p]
+		h.observe(time.Since(start))
+		e.stats.ClassLatency[p] = h
+		e.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// enqueue starts a goroutine waiting on q in class p and blocks until it is queued.
+func enqueue(t *testing.T, q *admissionQueue, p Priority, granted chan<- Priority) {
+	t.Helper()
+	before := q.depth()
+	go func() {
+		q.acquire(p)
+		granted <- p
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for q.depth() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("Request was never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdmissionQueueOrder(t *testing.T) {
+	t.Parallel()
+	q := newAdmissionQueue(2)
+	granted := make(chan Priority)
+
+	q.acquire(PriorityNormal)
+	enqueue(t, q, PriorityBatch, granted)
+	enqueue(t, q, PriorityNormal, granted)
+	enqueue(t, q, PriorityCritical, granted)
+	enqueue(t, q, PriorityCritical, granted)
+	enqueue(t, q, PriorityCritical, granted)
+
+	// Batch and normal are both bypassed twice by critical work, then served
+	// ahead of the last critical request; ties go to the lower class
+	want := []Priority{PriorityCritical, PriorityCritical, PriorityBatch, PriorityNormal, PriorityCritical}
+	for i, w := range want {
+		q.release()
+		if got := <-granted; got != w {
+			t.Errorf("Grant %d: expected %s, got %s", i, w, got)
+		}
+	}
+
+	q.release()
+	if q.busy {
+		t.Error("Expected queue to be idle after final release")
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	t.Parallel()
+	for _, p := range []Priority{PriorityBatch, PriorityNormal, PriorityCritical} {
+		parsed, err := ParsePriority(p.String())
+		if err != nil {
+			t.Fatalf("ParsePriority(%q) failed: %v", p.String(), err)
+		}
+		if parsed != p {
+			t.Errorf("Round trip of %s produced %s", p, parsed)
+		}
+	}
+	if _, err := ParsePriority("urgent"); err == nil {
+		t.Error("Expected error for unknown priority")
+	}
+}
+
+func TestExecuteStreamingPriorityStats(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{Kernel: 1, In: 0, Out: 128},
+		},
+	}
+	engine, err := NewEngine(graph, &EngineOptions{
+		Workers:     2,
+		ArenaSize:   4096,
+		Streaming:   true,
+		EnableStats: true,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(p Priority) {
+			defer wg.Done()
+			output := make([]byte, 64)
+			if err := engine.ExecuteStreamingPriority(p, make([]byte, 64), output); err != nil {
+				t.Errorf("ExecuteStreamingPriority failed: %v", err)
+			}
+		}(Priority(i % int(numPriorities)))
+	}
+	wg.Wait()
+
+	stats := engine.Stats()
+	for p := Priority(0); p < numPriorities; p++ {
+		if got := stats.ClassLatency[p].Count; got != 4 {
+			t.Errorf("Expected 4 %s requests, got %d", p, got)
+		}
+	}
+
+	if err := engine.ExecuteStreamingPriority(Priority(7), nil, nil); err == nil {
+		t.Error("Expected error for invalid priority")
+	}
+}
@@ -0,0 +1,333 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	replayMagic   = 0x52425553 // "SUBR" in little endian
+	replayVersion = 1
+
+	// DefaultReplayNodeBytes is how much of each node output a replay log
+	// keeps when ReplayOptions.NodeBytes is zero.
+	DefaultReplayNodeBytes = 256
+)
+
+// ReplayOptions bounds what a replay log records per execution.
+type ReplayOptions struct {
+	NodeBytes   int // Leading bytes kept of each node output; 0 selects DefaultReplayNodeBytes, negative keeps none
+	SampleEvery int // Record node outputs for every Nth execution only; <= 1 records them for all
+}
+
+// ReplayNode is one kernel call of a recorded execution.
+type ReplayNode struct {
+	NodeID   uint32
+	KernelID uint8
+	Duration time.Duration
+	Size     int    // Full output size in bytes
+	Output   []byte // Leading bytes of the output; empty when the execution was not sampled
+}
+
+// ReplayRecord is one streaming execution in a replay log.
+type ReplayRecord struct {
+	Session  int64  // Identifies the writer, and so the engine, that recorded it; 0 in logs predating sessions
+	Seq      uint64 // Within the session, counting from 0
+	Time     time.Time
+	Priority Priority
+	Input    []byte
+	Output   []byte // Declared outputs, as ExecuteStreaming returns them
+	Err      string // Execution error text, empty on success
+	Duration time.Duration
+	Nodes    []ReplayNode // In completion order
+}
+
+// ReplayWriter records the streaming executions of one engine into an
+// append-only replay log, set through EngineOptions.Replay. Each record holds
+// the input, the output, per-node timing and, for sampled executions, the
+// leading bytes of every node output. Records are written synchronously
+// after each execution; the first write error stops recording and is
+// reported by Err. Every writer starts a new session, so a log appended to by
+// several runs tells apart the records of each.
+type ReplayWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	opts    ReplayOptions
+	session int64 // Creation time in Unix nanoseconds
+	seq     uint64
+	pending *ReplayRecord // Execution in progress, nil between executions
+	sampled bool
+	err     error
+}
+
+// NewReplayWriter starts a replay log on w by writing its header. opts nil
+// selects the defaults.
+func NewReplayWriter(w io.Writer, opts *ReplayOptions) (*ReplayWriter, error) {
+	if err := writeReplayHeader(w); err != nil {
+		return nil, err
+	}
+	return newReplayWriter(w, opts), nil
+}
+
+// OpenReplayLog opens the replay log at path for appending, creating it if
+// needed. Records are appended after any already in the file. Close closes
+// the file.
+func OpenReplayLog(path string, opts *ReplayOptions) (*ReplayWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		if info.Size() == 0 {
+			err = writeReplayHeader(f)
+		} else {
+			err = readReplayHeader(f)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("replay log %s: %w", path, err)
+	}
+	rw := newReplayWriter(f, opts)
+	rw.closer = f
+	return rw, nil
+}
+
+func newReplayWriter(w io.Writer, opts *ReplayOptions) *ReplayWriter {
+	rw := &ReplayWriter{w: w, session: time.Now().UnixNano()}
+	if opts != nil {
+		rw.opts = *opts
+	}
+	if rw.opts.NodeBytes == 0 {
+		rw.opts.NodeBytes = DefaultReplayNodeBytes
+	}
+	return rw
+}
+
+// Err returns the write error that stopped recording, if any.
+func (rw *ReplayWriter) Err() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.err
+}
+
+// Close closes the underlying file when the log was opened by OpenReplayLog
+// and returns any write error.
+func (rw *ReplayWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.closer != nil {
+		rw.err = errors.Join(rw.err, rw.closer.Close())
+		rw.closer = nil
+	}
+	return rw.err
+}
+
+// begin opens the record of an execution. Streaming executions are
+// serialized by the admission queue, so at most one is pending.
+func (rw *ReplayWriter) begin(p Priority, input []byte) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.err != nil {
+		return
+	}
+	rw.sampled = rw.opts.NodeBytes > 0 && (rw.opts.SampleEvery <= 1 || rw.seq%uint64(rw.opts.SampleEvery) == 0)
+	rw.pending = &ReplayRecord{
+		Session:  rw.session,
+		Seq:      rw.seq,
+		Time:     time.Now(),
+		Priority: p,
+		Input:    slices.Clone(input),
+	}
+	rw.seq++
+}
+
+// end completes the pending record and appends it to the log.
+func (rw *ReplayWriter) end(output []byte, err error, d time.Duration) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rec := rw.pending
+	rw.pending = nil
+	if rec == nil || rw.err != nil {
+		return
+	}
+	rec.Output = slices.Clone(output)
+	rec.Duration = d
+	if err != nil {
+		rec.Err = err.Error()
+	}
+
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(rec); err != nil {
+		rw.err = fmt.Errorf("failed to encode replay record: %w", err)
+		return
+	}
+	var frame [4]byte
+	binary.LittleEndian.PutUint32(frame[:], uint32(body.Len()))
+	if _, err := rw.w.Write(append(frame[:], body.Bytes()...)); err != nil {
+		rw.err = fmt.Errorf("failed to write replay record: %w", err)
+	}
+}
+
+// BeforeNode implements Observer.
+func (rw *ReplayWriter) BeforeNode(NodeEvent) {}
+
+// AfterNode implements Observer, recording the node's timing and, for
+// sampled executions, its output.
+func (rw *ReplayWriter) AfterNode(ev NodeEvent) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.pending == nil {
+		return
+	}
+	n := ReplayNode{NodeID: ev.NodeID, KernelID: ev.KernelID, Duration: ev.Duration, Size: len(ev.Payload)}
+	if rw.sampled {
+		n.Output = slices.Clone(ev.Payload[:min(len(ev.Payload), rw.opts.NodeBytes)])
+	}
+	rw.pending.Nodes = append(rw.pending.Nodes, n)
+}
+
+// AfterRun implements Observer.
+func (rw *ReplayWriter) AfterRun(RunEvent) {}
+
+// ReplayReader reads the records of a replay log in order.
+type ReplayReader struct {
+	r io.Reader
+}
+
+// NewReplayReader checks the replay log header on r.
+func NewReplayReader(r io.Reader) (*ReplayReader, error) {
+	if err := readReplayHeader(r); err != nil {
+		return nil, err
+	}
+	return &ReplayReader{r: r}, nil
+}
+
+// Next returns the next record, or io.EOF after the last one.
+func (rr *ReplayReader) Next() (*ReplayRecord, error) {
+	var frame [4]byte
+	if _, err := io.ReadFull(rr.r, frame[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated replay record: %w", err)
+		}
+		return nil, err
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(frame[:]))
+	if _, err := io.ReadFull(rr.r, body); err != nil {
+		return nil, fmt.Errorf("truncated replay record: %w", err)
+	}
+	rec := new(ReplayRecord)
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(rec); err != nil {
+		return nil, fmt.Errorf("failed to decode replay record: %w", err)
+	}
+	return rec, nil
+}
+
+func writeReplayHeader(w io.Writer) error {
+	var header [6]byte
+	binary.LittleEndian.PutUint32(header[0:], replayMagic)
+	binary.LittleEndian.PutUint16(header[4:], replayVersion)
+	if _, err := w.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to write replay header: %w", err)
+	}
+	return nil
+}
+
+func readReplayHeader(r io.Reader) error {
+	var header [6]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("failed to read replay header: %w", err)
+	}
+	if magic := binary.LittleEndian.Uint32(header[0:]); magic != replayMagic {
+		return fmt.Errorf("invalid replay magic: 0x%x", magic)
+	}
+	if version := binary.LittleEndian.Uint16(header[4:]); version != replayVersion {
+		return fmt.Errorf("unsupported replay version: %d", version)
+	}
+	return nil
+}
+
+// ReplayResult compares a re-executed record with its recording.
+type ReplayResult struct {
+	Seq            uint64
+	Duration       time.Duration // Replay wall time; the recording's is in the record
+	Err            error         // Error of the replayed execution
+	OutputMatch    bool
+	NodeMismatches []uint32 // Sampled nodes whose recorded output bytes differ
+}
+
+// Matches reports whether the replay reproduced the recorded output, node
+// outputs and error.
+func (r *ReplayResult) Matches(rec *ReplayRecord) bool {
+	errText := ""
+	if r.Err != nil {
+		errText = r.Err.Error()
+	}
+	return r.OutputMatch && len(r.NodeMismatches) == 0 && errText == rec.Err
+}
+
+// Replay re-executes rec on the engine and compares the result with the
+// recording. Engines carry state between streaming executions, so replaying
+// the records of a session in order on a fresh engine for the same model
+// reproduces them; with EngineOptions.Deterministic the replay is
+// bit-identical. Each session needs its own fresh engine. It must not be
+// called while another execution is in flight.
+func (e *Engine) Replay(rec *ReplayRecord) (*ReplayResult, error) {
+	if !e.opts.Streaming {
+		return nil, fmt.Errorf("engine not configured for streaming")
+	}
+	capture := &replayCapture{outputs: make(map[uint32][]byte)}
+	n := len(e.observers)
+	e.observers = append(e.observers, capture)
+	defer func() { e.observers = e.observers[:n] }()
+
+	output := make([]byte, e.OutputSize())
+	start := time.Now()
+	err := e.ExecuteStreamingPriority(rec.Priority, rec.Input, output)
+	if errors.Is(err, ErrClosed) {
+		return nil, err
+	}
+
+	common := min(len(output), len(rec.Output))
+	res := &ReplayResult{
+		Seq:         rec.Seq,
+		Duration:    time.Since(start),
+		Err:         err,
+		OutputMatch: bytes.Equal(output[:common], rec.Output[:common]),
+	}
+	for _, node := range rec.Nodes {
+		if len(node.Output) == 0 {
+			continue
+		}
+		got, ok := capture.outputs[node.NodeID]
+		if !ok || !bytes.HasPrefix(got, node.Output) {
+			res.NodeMismatches = append(res.NodeMismatches, node.NodeID)
+		}
+	}
+	return res, nil
+}
+
+// replayCapture collects node outputs during Engine.Replay.
+type replayCapture struct {
+	mu      sync.Mutex
+	outputs map[uint32][]byte
+}
+
+func (c *replayCapture) BeforeNode(NodeEvent) {}
+func (c *replayCapture) AfterRun(RunEvent)    {}
+
+func (c *replayCapture) AfterNode(ev NodeEvent) {
+	c.mu.Lock()
+	c.outputs[ev.NodeID] = slices.Clone(ev.Payload)
+	c.mu.Unlock()
+}
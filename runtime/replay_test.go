@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newReplayEngine(t *testing.T, rw *ReplayWriter) *Engine {
+	t.Helper()
+	engine, err := NewEngine(memoGraph(), &EngineOptions{
+		ArenaSize:     1 << 16,
+		Streaming:     true,
+		Deterministic: true,
+		DisableMemo:   true, // The graph reads no input, so memo reuse would skip every node after the first run
+		Replay:        rw,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	return engine
+}
+
+func readReplayLog(t *testing.T, r io.Reader) []*ReplayRecord {
+	t.Helper()
+	rr, err := NewReplayReader(r)
+	if err != nil {
+		t.Fatalf("NewReplayReader failed: %v", err)
+	}
+	var records []*ReplayRecord
+	for {
+		rec, err := rr.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestReplayReproducesRecording(t *testing.T) {
+	t.Parallel()
+	var log bytes.Buffer
+	rw, err := NewReplayWriter(&log, &ReplayOptions{NodeBytes: 32, SampleEvery: 2})
+	if err != nil {
+		t.Fatalf("NewReplayWriter failed: %v", err)
+	}
+	engine := newReplayEngine(t, rw)
+	output := make([]byte, engine.OutputSize())
+	for i := 0; i < 3; i++ {
+		if err := engine.ExecuteStreaming([]byte{byte(i), 1, 2, 3}, output); err != nil {
+			t.Fatalf("ExecuteStreaming failed: %v", err)
+		}
+	}
+	if err := rw.Err(); err != nil {
+		t.Fatalf("Recording failed: %v", err)
+	}
+
+	records := readReplayLog(t, &log)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	for i, rec := range records {
+		if rec.Seq != uint64(i) || rec.Input[0] != byte(i) || len(rec.Nodes) == 0 || len(records[0].Nodes) != 3 {
+			t.Errorf("Record %d: unexpected seq %d, input %v, %d nodes", i, rec.Seq, rec.Input, len(rec.Nodes))
+		}
+		sampled := i%2 == 0
+		if got := len(rec.Nodes[0].Output) == 32; got != sampled {
+			t.Errorf("Record %d: expected sampled=%v, got %d output bytes", i, sampled, len(rec.Nodes[0].Output))
+		}
+	}
+	if !bytes.Equal(records[2].Output, output) {
+		t.Error("Expected the last record to hold the returned output")
+	}
+
+	replay := newReplayEngine(t, nil)
+	for _, rec := range records {
+		res, err := replay.Replay(rec)
+		if err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		if !res.Matches(rec) {
+			t.Errorf("Record %d did not reproduce: %+v", rec.Seq, res)
+		}
+	}
+
+	// A recorded node output that no longer matches is reported
+	tampered := *records[2]
+	tampered.Nodes = append([]ReplayNode(nil), tampered.Nodes...)
+	tampered.Nodes[0].Output = bytes.Repeat([]byte{0xff}, 32)
+	res, err := newReplayEngine(t, nil).Replay(&tampered)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if res.Matches(&tampered) || len(res.NodeMismatches) == 0 {
+		t.Errorf("Expected a node mismatch, got %+v", res)
+	}
+}
+
+func TestOpenReplayLogAppends(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "run.replay")
+	for session := 0; session < 2; session++ {
+		rw, err := OpenReplayLog(path, nil)
+		if err != nil {
+			t.Fatalf("OpenReplayLog failed: %v", err)
+		}
+		engine := newReplayEngine(t, rw)
+		if err := engine.ExecuteStreaming(make([]byte, 8), make([]byte, engine.OutputSize())); err != nil {
+			t.Fatalf("ExecuteStreaming failed: %v", err)
+		}
+		if err := rw.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	rw, err := OpenReplayLog(path, nil)
+	if err != nil {
+		t.Fatalf("OpenReplayLog failed: %v", err)
+	}
+	rw.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	records := readReplayLog(t, bytes.NewReader(data))
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 appended records, got %d", len(records))
+	}
+	// Each run starts a session, replayed on its own engine
+	if records[0].Session == records[1].Session || records[1].Seq != 0 {
+		t.Errorf("Expected two sessions, got session %d seq %d and session %d seq %d",
+			records[0].Session, records[0].Seq, records[1].Session, records[1].Seq)
+	}
+	for _, rec := range records {
+		res, err := newReplayEngine(t, nil).Replay(rec)
+		if err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		if !res.Matches(rec) {
+			t.Errorf("Session %d did not reproduce: %+v", rec.Session, res)
+		}
+	}
+	if _, err := NewReplayReader(bytes.NewReader([]byte("SUBS\x01\x00"))); err == nil {
+		t.Error("Expected an error for a non-replay header")
+	}
+}
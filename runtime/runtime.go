@@ -24,40 +24,29 @@
 package runtime
 
 import (
+	"bytes"
+	"crypto/ed25519"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/sbl8/sublation/core"
 	"github.com/sbl8/sublation/kernels"
 	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/training"
 )
 
 // KernelFn operates in‑place on a Sublate payload with zero allocations
 type KernelFn func(data []byte)
 
-// Basic kernel catalog - will be populated with actual kernels
-var kernelCatalog = [256]KernelFn{
-	// Initialize with noop kernels to avoid nil panics
-}
-
-func init() {
-	// Simple noop kernel as fallback
-	noop := func(data []byte) {
-		// Do nothing - placeholder kernel
-	}
-
-	// Initialize all kernels with noop to avoid nil pointer issues
-	for i := range kernelCatalog {
-		kernelCatalog[i] = noop
-	}
-}
-
 // NewArenaCompat creates a new Arena using the arena.go constructor for backward compatibility
 func NewArenaCompat(totalSize int) *Arena {
 	arena, err := NewArena(uintptr(totalSize), nil, 0, uintptr(totalSize/4), uintptr(totalSize/4)) // Added kernelScratchSize
@@ -68,31 +57,40 @@ func NewArenaCompat(totalSize int) *Arena {
 	return arena
 }
 
-// TaskGroup represents a group of nodes that can execute concurrently
-type TaskGroup struct {
-	nodes    []model.Node
-	priority int
-}
-
-// StreamScheduler manages dependency-aware execution of graph nodes
-type StreamScheduler struct {
-	ready     chan *TaskGroup
-	completed chan uint16
-	deps      map[uint16][]uint16
-	waiting   map[uint16]*TaskGroup
-	workers   int
-}
-
 // Engine manages the execution of a Sublation graph with worker pools and arena management
 type Engine struct {
-	graph     *model.Graph
-	arena     *Arena
-	workers   int
-	sublates  []*core.Sublate
-	scheduler *StreamScheduler
-	opts      EngineOptions
-	stats     ExecutionStats
-	mu        sync.RWMutex
+	graph      *model.Graph
+	arena      *Arena
+	workers    int
+	sublates   []*core.Sublate
+	scheduler  *StreamScheduler
+	opts       EngineOptions
+	stats      ExecutionStats
+	mu         sync.RWMutex
+	cpus       []int // CPUs available for worker pinning
+	tracer     Tracer
+	observers  []Observer
+	deps       *StreamScheduler // Dependency graph for ExecuteNodes, built on first use
+	depsOnce   sync.Once
+	depsErr    error
+	memo       *memoTable      // Output reuse for resident runs, nil when disabled
+	lineage    *lineageTracker // Provenance of node outputs, nil when EngineOptions.Lineage is off
+	admission  *admissionQueue
+	backing    []byte       // Host-owned or mapped memory for the resident arena, nil if heap-allocated
+	pool       *workerPool  // Host-shared workers; nil runs a goroutine per worker
+	unmapArena func() error // Releases a huge page or shared memory mapping backing the arena
+	shmName    string       // Shared memory object holding the arena, see NewSharedEngine
+	order      []int        // Topological node order, nil when graph order is one
+	flows      []flow       // Where each node reads its operands and leaves its output
+	inPorts    []port       // Declared inputs, in declaration order
+	outPorts   []port       // Declared outputs, or the last node of a model declaring none
+	tied       [][]int      // Indices of the nodes sharing each node's buffers, nil without tied nodes
+	rng        *rand.Rand
+	warming    atomic.Bool // Executions are recorded as warmup, see Warmup
+	life       lifecycle
+	backward   *training.Backward // Backward graph of EngineOptions.Training, nil when not training
+	trainBuf   []byte             // Training buffer in the scratch region
+	trainMu    sync.Mutex         // Serializes Backward and the gradient accessors over trainBuf
 }
 
 // Graph returns the engine's underlying graph.
@@ -106,14 +104,97 @@ type EngineOptions struct {
 	ArenaSize   uintptr
 	EnableStats bool
 	Streaming   bool
+	PinWorkers  bool           // Lock each worker to an OS thread pinned to one CPU
+	NUMAPolicy  NUMAPolicy     // Placement of per-worker arena shards (Linux only)
+	HugePages   HugePagePolicy // Back the arena with huge pages (Linux only)
+	Tracer      Tracer         // Receives per-node timing events; nil disables tracing
+	Scheduler   SchedulerKind  // Streaming dispatch strategy; empty selects SchedulerLevels
+
+	StarvationLimit int  // Bypasses before a waiting request is served regardless of class
+	ChunkedInput    bool // Run inputs larger than the streaming window one window-sized chunk at a time
+	DisableMemo     bool // Always run every kernel instead of reusing outputs of unchanged nodes
+	GuardNonFinite  bool // Fail the run with a NonFiniteError as soon as a kernel outputs NaN or Inf
+
+	// Replay records every streaming execution, its input, output and node
+	// timings, so Engine.Replay can reproduce it offline. nil disables it.
+	Replay *ReplayWriter
+
+	// MemCheck accounts the arena and heap bytes each execution allocates
+	// and flags runs that do not return every region to its baseline. It
+	// stops the world twice per run, so it is meant for debugging only.
+	MemCheck MemCheckMode
+
+	// Speculative validates every node's proposed output before committing
+	// it with SwapBuffers; rejected proposals are rolled back to PayloadPrev.
+	// It applies to resident runs and non-streaming Execute, the paths that
+	// use the sublate double buffers. Validator nil selects FiniteValidator.
+	Speculative bool
+	Validator   Validator
+
+	// AllowArenaGrowth lets node payload and scratch allocations borrow the
+	// FreeTail region when their own region is full, instead of failing the
+	// run. Borrowed bytes show up in ArenaReport and ExecutionStats.ArenaGrowth.
+	AllowArenaGrowth bool
+
+	// Deterministic runs every node on one goroutine in a fixed topological
+	// order and reseeds Rand from Seed before each execution, so repeated
+	// runs are bit-identical. It forces Workers to 1.
+	Deterministic bool
+	Seed          uint64 // Random source seed; 0 selects DefaultSeed
+
+	// Watchdog: kernel calls running longer than their limit are recorded as
+	// stragglers. Kernels cannot be interrupted, so AbortOnTimeout skips the
+	// nodes still pending and fails the run once the overrunning call returns.
+	NodeTimeout    time.Duration            // Limit per kernel call; 0 disables the watchdog
+	NodeTimeouts   map[uint32]time.Duration // Per-node overrides of NodeTimeout, by node ID
+	AbortOnTimeout bool
+	OnStraggler    func(Straggler) // Called from the watchdog as soon as a limit passes
+
+	// OnTargetMismatch is called when the graph was compiled for an ISA
+	// profile other than HostTarget; nil logs a warning instead
+	OnTargetMismatch func(compiled, host model.Target)
+
+	// Per-region arena sizing; the zero value auto-calculates the region
+	NodePayloadBytes RegionSize
+	ScratchBytes     RegionSize
+	StreamingBytes   RegionSize
+
+	// Lineage records which execution produced each node's output, so
+	// Engine.Lineage can report the upstream nodes and payload regions it
+	// derives from at this granularity. LineageOff disables it.
+	Lineage LineageGranularity
+
+	// Training makes the engine differentiable for Backward: the backward
+	// graph of the loss node is generated at creation and its training
+	// buffer, node outputs and gradients, carved from the scratch region,
+	// which an automatic ScratchBytes sizes to fit. nil disables training.
+	Training *TrainingOptions
 }
 
 // ExecutionStats tracks runtime performance metrics
 type ExecutionStats struct {
 	TotalExecutions  int64
 	AverageLatency   time.Duration
+	Latency          LatencyHistogram              // Steady-state executions; Warmup runs are kept apart
+	Percentiles      LatencyPercentiles            // Estimated from Latency
+	ClassLatency     map[Priority]LatencyHistogram // Queueing plus execution time per QoS class
 	KernelExecutions map[uint8]int64
 	ArenaUtilization float64
+	ArenaGrowth      uintptr        // Peak FreeTail bytes lent to exhausted regions
+	ArenaHugePages   HugePagePolicy // Huge page backing actually obtained for the arena
+
+	WarmupExecutions  int64
+	WarmupLatency     LatencyHistogram
+	WarmupPercentiles LatencyPercentiles // Estimated from WarmupLatency
+
+	Stragglers  map[uint32]int64            // Watchdog overruns per node ID, recorded even without EnableStats
+	Speculation map[uint32]SpeculationStats // Speculative commit decisions per node ID, recorded even without EnableStats
+
+	MemoHits   int64 // Resident node executions skipped because their input was unchanged
+	MemoMisses int64 // Resident node executions that ran their kernel
+
+	Memory             MemoryUsage // Latest execution under MemCheck, recorded even without EnableStats
+	MemCheckViolations int64       // Executions that broke the zero-allocation invariant
 }
 
 // DefaultEngineOptions provides sensible runtime defaults
@@ -126,159 +207,13 @@ func DefaultEngineOptions() EngineOptions {
 	}
 }
 
-// NewStreamScheduler creates a scheduler with dependency analysis
-func NewStreamScheduler(graph *model.Graph, workers int) *StreamScheduler {
-	s := &StreamScheduler{
-		ready:     make(chan *TaskGroup, len(graph.Nodes)), // Buffered channel
-		completed: make(chan uint16, len(graph.Nodes)),     // Buffered channel
-		deps:      make(map[uint16][]uint16),
-		waiting:   make(map[uint16]*TaskGroup),
-		workers:   workers,
-	}
-	s.buildDependencies(graph)
-	s.createTaskGroups(graph) // This will populate s.waiting
-	return s
-}
-
-// buildDependencies analyzes the graph to build execution dependencies
-func (s *StreamScheduler) buildDependencies(graph *model.Graph) {
-	// Build dependency mapping from topology connections
-	// For each node, its dependencies are the nodes listed in its Topo field.
-	// The deps map should store: nodeID -> list of nodes that depend on nodeID.
-	// However, the current scheduler logic seems to expect deps[nodeID] to be
-	// the list of nodes that *nodeID depends on*. Let's clarify.
-	// Based on scheduleReady: `for _, depID := range e.scheduler.deps[node.ID]`
-	// This means deps[node.ID] are the nodes that node.ID depends on (its inputs).
-
-	// Initialize deps for all nodes
-	for _, node := range graph.Nodes {
-		s.deps[node.ID] = []uint16{} // Initialize with empty slice
-	}
-
-	// Populate dependencies. A node depends on the nodes in its `Topo` field if `Topo` represents inputs.
-	// Or, if `Topo` represents outputs, then other nodes depend on it.
-	// Assuming `node.Topo` are the IDs of nodes that *this node sends output to* (i.e., nodes that depend on this node).
-	// The `graph.topologicalSort` and `model.Node.Topo` usage suggests `Topo` might be outgoing connections.
-	// Let's assume `node.Topo` are nodes that *depend* on the current node.
-	// The scheduler logic `e.scheduler.deps[node.ID]` expects a list of prerequisites for `node.ID`.
-
-	// Let's re-evaluate: `model.Node.Topo` are "neighbor indices for message passing".
-	// If a node A has node B in its Topo, does A depend on B, or B depend on A?
-	// The `graph.topologicalSort` uses `inDegree` and `adj` where `adj[dep]` gets `node.ID`.
-	// This implies `dep` is a prerequisite for `node.ID`. So, `node.Topo` might be outgoing connections.
-	// For now, let's assume `node.Topo` are nodes that *depend* on the current node.
-
-	// Correct interpretation: `node.Topo` lists the IDs of nodes that are *inputs* to the current node.
-	// So, `s.deps[node.ID]` should be `node.Topo`.
-	for _, node := range graph.Nodes {
-		// Ensure node.ID exists as a key
-		if _, ok := s.deps[node.ID]; !ok {
-			s.deps[node.ID] = []uint16{}
-		}
-		// Add dependencies from node.Topo
-		// Defensive copy, though node.Topo should be correct from graph construction.
-		s.deps[node.ID] = append(s.deps[node.ID], node.Topo...)
-	}
-}
-
-// createTaskGroups organizes nodes into concurrent execution groups
-// This populates the s.waiting map.
-func (s *StreamScheduler) createTaskGroups(graph *model.Graph) {
-	// Group nodes by dependency level for parallel execution.
-	// Nodes with no dependencies are level 0.
-	// Nodes that depend only on level 0 nodes are level 1, and so on.
-
-	// This is a simplified way to create initial task groups.
-	// A more sophisticated approach might consider actual parallelism and priorities.
-	// For now, let's group by "readiness" based on dependencies.
-	// We can iterate and find all nodes whose dependencies are met.
-
-	// For simplicity, we can initially put all nodes into a single "level"
-	// and let `scheduleReady` figure out which ones can run.
-	// Or, group them by some heuristic.
-	// Let's try to group them by the number of dependencies as a proxy for levels.
-
-	levels := make(map[int][]*model.Node)
-	maxLevel := 0
-
-	nodeMap := make(map[uint16]model.Node)
-	for _, n := range graph.Nodes {
-		nodeMap[n.ID] = n
-	}
-
-	// Calculate levels (this is a simple depth-first search style level assignment)
-	// This is not a perfect level calculation for parallel execution groups but a starting point.
-	// A true level-based approach (like Coffman-Graham or similar) is more complex.
-	// For now, we'll use a placeholder: group all nodes into one task group at level 0.
-	// `scheduleReady` will then pick those that are actually ready.
-
-	// A more direct approach for `s.waiting`:
-	// Create task groups where each group corresponds to a "level" of execution.
-	// Level 0: nodes with no dependencies.
-	// Level 1: nodes whose dependencies are all in Level 0.
-	// ... and so on.
-
-	nodeLevels := make(map[uint16]int)
-	visited := make(map[uint16]bool)
-
-	var calculateLevel func(nodeID uint16) int
-	calculateLevel = func(nodeID uint16) int {
-		if level, ok := nodeLevels[nodeID]; ok {
-			return level
-		}
-		if visited[nodeID] { // Cycle detection or already processed
-			return 0 // Or handle error
-		}
-		visited[nodeID] = true
-
-		maxDepLevel := -1
-		for _, depID := range s.deps[nodeID] {
-			depLevel := calculateLevel(depID)
-			if depLevel > maxDepLevel {
-				maxDepLevel = depLevel
-			}
-		}
-
-		currentLevel := maxDepLevel + 1
-		nodeLevels[nodeID] = currentLevel
-		delete(visited, nodeID) // Allow re-calculation if part of different paths in complex graphs
-		return currentLevel
-	}
-
-	for _, node := range graph.Nodes {
-		level := calculateLevel(node.ID)
-		if _, ok := levels[level]; !ok {
-			levels[level] = []*model.Node{}
-		}
-		// Store pointer to node from graph.Nodes to avoid copying large structs
-		// Find the original node pointer
-		var originalNode model.Node
-		for _, n := range graph.Nodes {
-			if n.ID == node.ID {
-				originalNode = n
-				break
-			}
-		}
-		levels[level] = append(levels[level], &originalNode)
-		if level > maxLevel {
-			maxLevel = level
-		}
-	}
-
-	for i := 0; i <= maxLevel; i++ {
-		if nodesInLevel, ok := levels[i]; ok && len(nodesInLevel) > 0 {
-			// Convert []*model.Node to []model.Node for TaskGroup
-			taskGroupNodes := make([]model.Node, len(nodesInLevel))
-			for j, nodePtr := range nodesInLevel {
-				taskGroupNodes[j] = *nodePtr
-			}
-			s.waiting[uint16(i)] = &TaskGroup{nodes: taskGroupNodes, priority: i}
-		}
-	}
-}
-
 // NewEngine creates a new runtime engine with optimal configuration
 func NewEngine(graph *model.Graph, opts *EngineOptions) (*Engine, error) {
+	return newEngine(graph, opts, nil)
+}
+
+// newEngine creates an engine whose resident arena lives in backing when non-nil
+func newEngine(graph *model.Graph, opts *EngineOptions, backing []byte) (*Engine, error) {
 	if graph == nil {
 		return nil, errors.New("graph cannot be nil")
 	}
@@ -287,6 +222,9 @@ func NewEngine(graph *model.Graph, opts *EngineOptions) (*Engine, error) {
 	if err != nil {
 		return nil, err
 	}
+	engine.backing = backing
+	engine.checkTarget()
+	engine.setupHugePages()
 
 	if err := setupEngineArena(engine); err != nil {
 		return nil, err
@@ -295,6 +233,9 @@ func NewEngine(graph *model.Graph, opts *EngineOptions) (*Engine, error) {
 	if err := initializeEngineComponents(engine); err != nil {
 		return nil, err
 	}
+	if err := engine.setupTraining(); err != nil {
+		return nil, err
+	}
 
 	return engine, nil
 }
@@ -309,22 +250,54 @@ func createBaseEngine(graph *model.Graph, opts *EngineOptions) (*Engine, error)
 		}
 	}
 
+	if err := engineOpts.validateRegionSizes(); err != nil {
+		return nil, err
+	}
+	backward, err := differentiate(graph, &engineOpts)
+	if err != nil {
+		return nil, err
+	}
+
 	arenaSize := engineOpts.ArenaSize
 	if arenaSize == 0 {
-		arenaSize = calculateArenaSize(graph)
+		arenaSize = EstimateArenaSize(graph, &engineOpts)
 		if arenaSize == 0 && len(graph.Nodes) > 0 {
 			return nil, errors.New("calculated arena size is zero for a non-empty graph")
 		}
 	}
 	engineOpts.ArenaSize = arenaSize
 
-	return &Engine{
-		graph:    graph,
-		workers:  engineOpts.Workers,
-		opts:     engineOpts,
-		stats:    ExecutionStats{KernelExecutions: make(map[uint8]int64)},
-		sublates: make([]*core.Sublate, len(graph.Nodes)),
-	}, nil
+	if err := engineOpts.Scheduler.validate(); err != nil {
+		return nil, err
+	}
+	if err := engineOpts.validateDeterminism(); err != nil {
+		return nil, err
+	}
+
+	engine := &Engine{
+		graph:   graph,
+		workers: engineOpts.Workers,
+		opts:    engineOpts,
+		stats: ExecutionStats{
+			KernelExecutions: make(map[uint8]int64),
+			Latency:          newLatencyHistogram(),
+			WarmupLatency:    newLatencyHistogram(),
+			Stragglers:       make(map[uint32]int64),
+			Speculation:      make(map[uint32]SpeculationStats),
+			ClassLatency:     make(map[Priority]LatencyHistogram),
+		},
+		sublates:  make([]*core.Sublate, len(graph.Nodes)),
+		tracer:    engineOpts.Tracer,
+		admission: newAdmissionQueue(engineOpts.StarvationLimit),
+		backward:  backward,
+	}
+	if engineOpts.PinWorkers || engineOpts.NUMAPolicy != NUMANone {
+		engine.cpus = allowedCPUs()
+	}
+	if engineOpts.Replay != nil {
+		engine.observers = append(engine.observers, engineOpts.Replay)
+	}
+	return engine, nil
 }
 
 // setupEngineArena creates and configures the engine's arena
@@ -335,72 +308,30 @@ func setupEngineArena(engine *Engine) error {
 		return nil
 	}
 
-	arenaSizes, err := calculateArenaSizes(arenaSize, engine.opts.Streaming, engine.graph)
+	arenaSizes, err := calculateArenaSizes(&engine.opts, engine.graph)
 	if err != nil {
 		return err
 	}
 
-	arena, err := createArenaWithFallback(arenaSize, engine.graph, arenaSizes)
+	arena, err := createArenaWithFallback(arenaSize, engine.graph, arenaSizes, engine.backing)
 	if err != nil {
 		return fmt.Errorf("failed to create arena: %w", err)
 	}
 
 	engine.arena = arena
-	return nil
-}
-
-// calculateArenaSizes computes scratch, streaming, and node payloads sizes
-func calculateArenaSizes(totalSize uintptr, streaming bool, graph *model.Graph) (struct{ scratch, streaming, nodePayloads uintptr }, error) {
-	var sizes struct{ scratch, streaming, nodePayloads uintptr }
-
-	// Calculate node payloads size based on graph nodes
-	if len(graph.Nodes) > 0 {
-		totalNodeDataSize := uintptr(0)
-		for i := range graph.Nodes {
-			node := graph.Nodes[i]
-			nodePayload := uintptr(calculateNodePayloadSize(&node, graph))
-			totalNodeDataSize += nodePayload * 2 // For Prev and Prop
-		}
-		sizes.nodePayloads = core.AlignedSize(totalNodeDataSize)
-	}
-
-	// Calculate remaining size after node payloads
-	var remainingSize uintptr
-	if sizes.nodePayloads < totalSize {
-		remainingSize = totalSize - sizes.nodePayloads
-	} else {
-		// If node payloads exceed total size, use minimal allocation
-		sizes.nodePayloads = totalSize / 2
-		remainingSize = totalSize - sizes.nodePayloads
-	}
-
-	if streaming {
-		sizes.streaming = remainingSize / 4 // 25% of remaining for streaming
-		sizes.scratch = remainingSize / 4   // 25% of remaining for scratch
-	} else {
-		sizes.streaming = 0
-		sizes.scratch = remainingSize / 2 // 50% of remaining for scratch
-	}
-
-	// Validate total doesn't exceed arena size
-	total := sizes.nodePayloads + sizes.streaming + sizes.scratch
-	if total > totalSize {
-		// Scale down proportionally
-		scale := float64(totalSize) / float64(total)
-		sizes.nodePayloads = uintptr(float64(sizes.nodePayloads) * scale)
-		sizes.streaming = uintptr(float64(sizes.streaming) * scale)
-		sizes.scratch = uintptr(float64(sizes.scratch) * scale)
-	}
-
-	return sizes, nil
+	return engine.configureArena(arena)
 }
 
 // createArenaWithFallback attempts arena creation with fallback
-func createArenaWithFallback(totalSize uintptr, graph *model.Graph, sizes struct{ scratch, streaming, nodePayloads uintptr }) (*Arena, error) {
-	arena, err := NewArena(totalSize, graph, sizes.nodePayloads, sizes.streaming, sizes.scratch)
+func createArenaWithFallback(totalSize uintptr, graph *model.Graph, sizes arenaSizes, backing []byte) (*Arena, error) {
+	arena, err := newArena(backing, totalSize, graph, sizes.nodePayloads, sizes.streaming, sizes.scratch)
 	if err != nil {
+		if sizes.explicit {
+			// Caller-chosen sizes were validated; don't silently replace them
+			return nil, err
+		}
 		// Fallback with minimal scratch/streaming
-		arena, err = NewArena(totalSize, graph, 0, 0, 0)
+		arena, err = newArena(backing, totalSize, graph, 0, 0, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -418,7 +349,13 @@ func initializeEngineComponents(engine *Engine) error {
 		return err
 	}
 
-	return nil
+	engine.setupFlows()
+	engine.setupPorts()
+	engine.setupMemo()
+	engine.setupLineage()
+	engine.setupOrder()
+	engine.setupTied()
+	return engine.setupDeterminism()
 }
 
 // initializeSublatesIfNeeded initializes sublates in arena if required
@@ -436,7 +373,11 @@ func initializeSublatesIfNeeded(engine *Engine) error {
 // initializeSchedulerIfNeeded sets up scheduler for streaming mode
 func initializeSchedulerIfNeeded(engine *Engine) error {
 	if engine.opts.Streaming && engine.workers > 0 {
-		engine.scheduler = NewStreamScheduler(engine.graph, engine.workers)
+		scheduler, err := NewStreamScheduler(engine.graph, engine.workers)
+		if err != nil {
+			return fmt.Errorf("failed to create stream scheduler: %w", err)
+		}
+		engine.scheduler = scheduler
 	}
 	return nil
 }
@@ -454,17 +395,7 @@ func calculateArenaSize(graph *model.Graph) uintptr {
 	}
 
 	// Add space for actual sublate payloads (Prev and Prop data)
-	// This requires iterating nodes and summing their estimated payload sizes.
-	totalNodeDataSize := uintptr(0)
-	for i := range graph.Nodes {
-		// Use a temporary node variable to pass to calculateNodePayloadSize if it expects a pointer
-		node := graph.Nodes[i]
-		// Each sublate has PayloadPrev and PayloadProp.
-		// calculateNodePayloadSize should return the size for *one* such buffer.
-		nodePayload := uintptr(calculateNodePayloadSize(&node, graph))
-		totalNodeDataSize += nodePayload * 2 // For Prev and Prop
-	}
-	size += core.AlignedSize(totalNodeDataSize)
+	size += nodePayloadDemand(graph)
 
 	// Add scratch space (e.g., 25% of the sum of graph payload, sublate metadata, and sublate data)
 	// This is a heuristic and might need refinement.
@@ -495,7 +426,22 @@ func calculateArenaSize(graph *model.Graph) uintptr {
 }
 
 // Run executes the graph using the engine's default arena and pre-initialized sublates.
-func (e *Engine) Run() error { // Parameter arena removed
+func (e *Engine) Run() error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	return e.runResident()
+}
+
+// runResident executes every sublate of the resident arena in order
+func (e *Engine) runResident() error {
+	return e.runResidentNodes(nil)
+}
+
+// runResidentNodes executes the sublates at the given node indices, or every
+// sublate when indices is nil
+func (e *Engine) runResidentNodes(indices []int) (err error) {
 	if e.arena == nil && len(e.sublates) > 0 { // Check if sublates exist but arena doesn't
 		return errors.New("engine arena is nil but sublates exist, inconsistent state")
 	}
@@ -503,9 +449,29 @@ func (e *Engine) Run() error { // Parameter arena removed
 	// If e.arena is nil but there are no sublates, it might be fine (e.g. empty graph).
 
 	start := time.Now()
+	defer func() { e.observeRun(start, err) }()
+	if e.opts.Deterministic {
+		e.reseed()
+	}
+
+	steps := len(e.sublates)
+	if indices != nil {
+		steps = len(indices)
+	}
+	payload := e.modelPayload(e.arena)
+	var hits, misses int64
+	if e.opts.MemCheck != MemCheckOff && e.arena != nil {
+		snap := e.snapshotMemory(e.arena)
+		defer func() { e.checkMemory(snap, e.arena, true) }()
+	}
 
 	// Execute each sublate in topological order
-	for i, sublate := range e.sublates {
+	for k := 0; k < steps; k++ {
+		i := e.nodeIndex(k)
+		if indices != nil {
+			i = indices[k]
+		}
+		sublate := e.sublates[i]
 		if sublate == nil {
 			continue
 		}
@@ -515,8 +481,26 @@ func (e *Engine) Run() error { // Parameter arena removed
 			return fmt.Errorf("unknown kernel ID: %d for sublate %d", sublate.KernelID, i)
 		}
 
+		// Reuse the previous output when nothing feeding the node changed
+		input := sublate.PayloadProp[:e.gather(i, payload)]
+		if e.memo != nil {
+			if e.memo.reuse(i, e.sublates) {
+				hits++
+				if e.lineage != nil {
+					e.recordLineage(e.graph.Nodes[i].ID, true)
+				}
+				continue
+			}
+			misses++
+		}
+
 		// Execute kernel on PayloadProp
-		kernelFn(sublate.PayloadProp)
+		if err := e.callKernel(0, i, sublate.KernelID, kernelFn, input); err != nil {
+			return err
+		}
+		if err := e.guardOutput(e.graph.Nodes[i].ID, sublate.KernelID, input); err != nil {
+			return err
+		}
 
 		// Update stats
 		if e.opts.EnableStats {
@@ -525,58 +509,84 @@ func (e *Engine) Run() error { // Parameter arena removed
 			e.mu.Unlock()
 		}
 
-		// Swap buffers for next iteration
-		sublate.SwapBuffers()
+		// Commit the proposal, or roll it back in speculative mode
+		e.commit(i, sublate)
 	}
 
 	// Update execution stats
 	if e.opts.EnableStats {
 		e.mu.Lock()
-		e.stats.TotalExecutions++
-		duration := time.Since(start)
-		e.stats.AverageLatency = time.Duration(
-			(int64(e.stats.AverageLatency)*e.stats.TotalExecutions + int64(duration)) /
-				(e.stats.TotalExecutions + 1),
-		)
+		e.stats.MemoHits += hits
+		e.stats.MemoMisses += misses
 		e.mu.Unlock()
+		e.recordExecution(time.Since(start), e.arena)
 	}
 
 	return nil
 }
 
-// ExecuteStreaming processes streaming input data
+// ExecuteStreaming processes streaming input data in the PriorityNormal class
 func (e *Engine) ExecuteStreaming(input, output []byte) error {
-	if !e.opts.Streaming {
-		return fmt.Errorf("engine not configured for streaming")
-	}
-
-	// Write input to streaming window
-	if err := e.arena.WriteToStreamingInput(input); err != nil {
-		return fmt.Errorf("failed to write streaming input: %w", err)
-	}
+	return e.ExecuteStreamingPriority(PriorityNormal, input, output)
+}
 
-	// Execute the graph
-	if err := e.Run(); err != nil { // Changed from e.Run(nil)
+// executeStreaming runs one request; the caller must hold the admission queue.
+// input carries the data of the declared inputs back to back, which reach
+// their nodes' payload segments, and output receives the declared outputs.
+func (e *Engine) executeStreaming(input, output []byte) error {
+	if err := e.bindInput(input); err != nil {
 		return err
 	}
+	if e.opts.ChunkedInput && len(input) > int(e.arena.streamingInput.Size) {
+		e.arena.ResetStream()
+		if err := e.ingestChunked(input); err != nil {
+			return err
+		}
+	} else {
+		// Write input to streaming window
+		if err := e.arena.WriteToStreamingInput(input); err != nil {
+			return fmt.Errorf("failed to write streaming input: %w", err)
+		}
 
-	// Read output from first sublate's PayloadProp
-	if len(e.sublates) > 0 && e.sublates[0] != nil {
-		outputSize := len(e.sublates[0].PayloadProp)
-		if outputSize > len(output) {
-			outputSize = len(output)
+		// Execute the graph
+		if err := e.runResident(); err != nil {
+			return err
 		}
-		copy(output[:outputSize], e.sublates[0].PayloadProp[:outputSize])
+		e.arena.StreamConsume(len(input))
 	}
 
+	e.readOutput(output)
 	return nil
 }
 
+// OutputSize returns the bytes ExecuteStreaming copies into its output
+// buffer: the declared outputs back to back in declaration order, or for a
+// model declaring none the output of its last node. It is derived from the
+// graph, so it is safe to call while an execution swaps the node buffers.
+func (e *Engine) OutputSize() int {
+	total := 0
+	for _, p := range e.outPorts {
+		total += p.bytes
+	}
+	return total
+}
+
 // ArenaBytes returns the arena size in bytes
 func (e *Engine) ArenaBytes() int {
+	if e.arena == nil {
+		return 0
+	}
 	return int(e.arena.TotalSize())
 }
 
+// ArenaReport returns region usage of the engine's resident arena
+func (e *Engine) ArenaReport() ArenaReport {
+	if e.arena == nil {
+		return ArenaReport{}
+	}
+	return e.arena.Report()
+}
+
 // Stats returns current execution statistics
 func (e *Engine) Stats() ExecutionStats {
 	e.mu.RLock()
@@ -588,61 +598,40 @@ func (e *Engine) Stats() ExecutionStats {
 	for k, v := range e.stats.KernelExecutions {
 		stats.KernelExecutions[k] = v
 	}
-
-	return stats
-}
-
-// nodesAsBytes converts a slice of nodes to a byte slice for direct memory operations.
-// It assumes model.NodeSize() returns the size of a single model.Node in bytes.
-func nodesAsBytes(nodes []model.Node) []byte {
-	if len(nodes) == 0 {
-		return nil
+	stats.Latency = e.stats.Latency.clone()
+	stats.Percentiles = stats.Latency.Percentiles()
+	stats.WarmupLatency = e.stats.WarmupLatency.clone()
+	stats.WarmupPercentiles = stats.WarmupLatency.Percentiles()
+	stats.Stragglers = make(map[uint32]int64, len(e.stats.Stragglers))
+	for id, n := range e.stats.Stragglers {
+		stats.Stragglers[id] = n
+	}
+	stats.Speculation = make(map[uint32]SpeculationStats, len(e.stats.Speculation))
+	for id, s := range e.stats.Speculation {
+		stats.Speculation[id] = s
+	}
+	stats.ClassLatency = make(map[Priority]LatencyHistogram, len(e.stats.ClassLatency))
+	for p, h := range e.stats.ClassLatency {
+		stats.ClassLatency[p] = h.clone()
 	}
-	// Calculate the total size in bytes. model.NodeSize() is expected to return int.
-	// This size must match the expected size for memory operations like copy.
-	totalBytes := len(nodes) * model.NodeSize()
-
-	// Get a pointer to the first element of the slice.
-	ptr := unsafe.Pointer(&nodes[0])
 
-	// Use unsafe.Slice to create a []byte view over the []model.Node data.
-	// This requires Go 1.17+.
-	// The returned slice shares the underlying memory with the original nodes slice.
-	// Modifications to this byteSlice will modify the original nodes slice and vice-versa.
-	byteSlice := unsafe.Slice((*byte)(ptr), totalBytes)
-	return byteSlice
+	return stats
 }
 
 // Load reads a .subl file and constructs an Engine
 func Load(path string) (*Engine, error) {
-	buf, err := os.ReadFile(path)
+	return LoadSigned(path, nil)
+}
+
+// LoadSigned is Load for deployments that only run signed models: it fails
+// with model.ErrUnsigned or model.ErrSignature unless the file is signed by
+// key. A nil key accepts any intact model, like Load.
+func LoadSigned(path string, key ed25519.PublicKey) (*Engine, error) {
+	graph, err := ReadGraph(path, key)
 	if err != nil {
 		return nil, err
 	}
 
-	read := 0
-	if len(buf) < 8 {
-		return nil, errors.New("invalid model file: too small")
-	}
-
-	nodeCnt := int(binary.LittleEndian.Uint32(buf[read:]))
-	read += 4
-	payloadLen := int(binary.LittleEndian.Uint32(buf[read:]))
-	read += 4
-
-	nodes := make([]model.Node, nodeCnt)
-	copySize := nodeCnt * model.NodeSize()
-	if len(buf) < read+copySize+payloadLen {
-		return nil, errors.New("invalid model file: inconsistent sizes")
-	}
-
-	copy(nodesAsBytes(nodes), buf[read:read+copySize])
-	read += copySize
-
-	payload := make([]byte, payloadLen)
-	copy(payload, buf[read:read+payloadLen])
-
-	graph := &model.Graph{Nodes: nodes, Payload: payload}
 	opts := DefaultEngineOptions()
 	// Ensure NewEngine calculates arena size based on the full graph structure,
 	// not just payload length. calculateArenaSize considers node data, metadata, and scratch.
@@ -651,144 +640,109 @@ func Load(path string) (*Engine, error) {
 	return NewEngine(graph, &opts)
 }
 
-// LoadFromFile reads a .subl file and constructs a Graph (alias for Load for compatibility)
-func LoadFromFile(path string) (*model.Graph, error) {
-	engine, err := Load(path)
+// ReadGraph reads a .subl file without building an engine. Section
+// checksums are always verified; a non-nil key also requires a valid
+// signature by that key. Version 2 files are streamed so only the payload,
+// not the whole file, is held in memory.
+func ReadGraph(path string, key ed25519.PublicKey) (*model.Graph, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	return engine.graph, nil
-}
-
-// SetWorkers configures the number of worker goroutines for parallel execution
-func (e *Engine) SetWorkers(n int) {
-	if n > 0 {
-		e.workers = n
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
+	return readGraph(f, info.Size(), key)
 }
 
-// runStreaming executes using the dependency-aware scheduler
-func (e *Engine) runStreaming(arena *Arena) {
-	var wg sync.WaitGroup
-
-	// Start worker goroutines
-	for i := 0; i < e.workers; i++ {
-		wg.Add(1)
-		go e.worker(arena, &wg)
-	}
-
-	// Schedule initial ready tasks
-	e.scheduleReady()
-
-	// Wait for completion
-	wg.Wait()
+// DecodeGraph is ReadGraph for a model already in memory, such as one
+// fetched by a browser.
+func DecodeGraph(data []byte, key ed25519.PublicKey) (*model.Graph, error) {
+	return readGraph(bytes.NewReader(data), int64(len(data)), key)
 }
 
-// worker processes tasks from the ready queue
-func (e *Engine) worker(arena *Arena, wg *sync.WaitGroup) {
-	defer wg.Done()
-	buffer := arena.Buffer()
-
-	for taskGroup := range e.scheduler.ready {
-		// Process all nodes in the task group concurrently
-		var groupWg sync.WaitGroup
-
-		for _, node := range taskGroup.nodes {
-			groupWg.Add(1)
-
-			go func(n model.Node) {
-				defer groupWg.Done()
-
-				kernel := kernelCatalog[n.Kernel]
-				if kernel == nil {
-					return
-				}
-
-				offset := int(n.Out)
-				if offset < len(buffer) {
-					kernel(buffer[offset:])
-				}
-			}(node)
-		}
-
-		// Wait for all nodes in group to complete
-		groupWg.Wait()
-
-		// Signal completion to scheduler
-		for _, node := range taskGroup.nodes {
-			e.scheduler.completed <- node.ID
-		}
+// readGraph decodes a .subl image of the given size
+func readGraph(r io.ReaderAt, size int64, key ed25519.PublicKey) (*model.Graph, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, errors.New("invalid model file: too small")
+	}
+	if binary.LittleEndian.Uint32(header[:]) == model.Magic && binary.LittleEndian.Uint16(header[4:]) == model.Version2 {
+		return streamGraph(r, size, key)
 	}
-}
-
-// scheduleReady moves ready task groups to the execution queue
-func (e *Engine) scheduleReady() {
-	scheduled := make(map[uint16]bool)
-
-	e.scheduleInitialReady(scheduled)
-	e.startCompletionHandler(scheduled)
-}
 
-// scheduleInitialReady schedules tasks with no dependencies
-func (e *Engine) scheduleInitialReady(scheduled map[uint16]bool) {
-	for level, taskGroup := range e.scheduler.waiting {
-		if len(taskGroup.nodes) == 0 {
-			continue
+	buf, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if err := model.Verify(buf, key); err != nil {
+			return nil, fmt.Errorf("invalid model file: %w", err)
 		}
+	}
 
-		if e.isTaskGroupReady(taskGroup, scheduled) {
-			e.scheduleTaskGroup(level, taskGroup, scheduled)
-		}
+	// Files written by model.Graph.Serialize start with the magic; older
+	// compiler output is headerless
+	var graph *model.Graph
+	if binary.LittleEndian.Uint32(buf) == model.Magic {
+		graph, err = model.Deserialize(buf)
+	} else {
+		graph, err = model.DeserializeLegacy(buf)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid model file: %w", err)
+	}
+	return graph, nil
 }
 
-// isTaskGroupReady checks if all dependencies for a task group are satisfied
-func (e *Engine) isTaskGroupReady(taskGroup *TaskGroup, scheduled map[uint16]bool) bool {
-	for _, node := range taskGroup.nodes {
-		for _, depID := range e.scheduler.deps[node.ID] {
-			if !scheduled[depID] {
-				return false
-			}
+// streamGraph loads a version 2 file through a model.Reader, checking the
+// signature against the digest computed while streaming the payload
+func streamGraph(r io.ReaderAt, size int64, key ed25519.PublicKey) (*model.Graph, error) {
+	mr, err := model.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model file: %w", err)
+	}
+	graph, err := mr.Load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid model file: %w", err)
+	}
+	if key != nil {
+		if err := mr.Verify(key); err != nil {
+			return nil, fmt.Errorf("invalid model file: %w", err)
 		}
 	}
-	return true
+	return graph, nil
 }
 
-// scheduleTaskGroup moves a task group to ready queue and marks nodes as scheduled
-func (e *Engine) scheduleTaskGroup(level uint16, taskGroup *TaskGroup, scheduled map[uint16]bool) {
-	e.scheduler.ready <- taskGroup
-	for _, node := range taskGroup.nodes {
-		scheduled[node.ID] = true
+// LoadFromFile reads a .subl file and constructs a Graph (alias for Load for compatibility)
+func LoadFromFile(path string) (*model.Graph, error) {
+	engine, err := Load(path)
+	if err != nil {
+		return nil, err
 	}
-	delete(e.scheduler.waiting, level)
-}
-
-// startCompletionHandler manages task completion and schedules new ready tasks
-func (e *Engine) startCompletionHandler(scheduled map[uint16]bool) {
-	go func() {
-		defer close(e.scheduler.ready)
-
-		for len(e.scheduler.waiting) > 0 {
-			nodeID := <-e.scheduler.completed
-			scheduled[nodeID] = true
-
-			e.checkAndScheduleNewReady(scheduled)
-		}
-	}()
+	return engine.graph, nil
 }
 
-// checkAndScheduleNewReady checks for newly ready tasks after completion
-func (e *Engine) checkAndScheduleNewReady(scheduled map[uint16]bool) {
-	for level, taskGroup := range e.scheduler.waiting {
-		if e.isTaskGroupReady(taskGroup, scheduled) {
-			e.scheduleTaskGroup(level, taskGroup, scheduled)
-			break // Process one at a time to avoid concurrent map modification
-		}
+// SetWorkers configures the number of worker goroutines for parallel execution
+func (e *Engine) SetWorkers(n int) {
+	if n > 0 {
+		e.workers = n
 	}
 }
 
 // Execute runs the model with enhanced execution context
 func (e *Engine) Execute(ctx *ExecutionContext) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	return e.execute()
+}
+
+// execute runs one execution on a freshly prepared arena
+func (e *Engine) execute() error {
 	arena, err := e.setupExecutionArena()
 	if err != nil {
 		return err
@@ -798,20 +752,42 @@ func (e *Engine) Execute(ctx *ExecutionContext) error {
 		return err
 	}
 
+	if e.opts.MemCheck != MemCheckOff {
+		snap := e.snapshotMemory(arena)
+		defer e.checkMemory(snap, arena, false)
+	}
+
 	start := time.Now()
+	if e.opts.Deterministic {
+		e.reseed()
+	}
 
-	if err := e.runExecution(arena); err != nil {
+	err = e.runExecution(arena)
+	e.observeRun(start, err)
+	if err != nil {
 		return err
 	}
 
-	return e.updateExecutionStats(start)
+	return e.updateExecutionStats(start, arena)
 }
 
 // setupExecutionArena creates and configures arena for execution
 func (e *Engine) setupExecutionArena() (*Arena, error) {
+	if e.backing != nil {
+		// Hosted and huge-page engines reuse their resident arena
+		e.arena.ResetNodePayloads()
+		e.arena.ResetScratch()
+		if e.backward != nil {
+			if _, err := e.reserveTraining(); err != nil {
+				return nil, err
+			}
+		}
+		return e.arena, nil
+	}
+
 	arenaTotalSize := e.opts.ArenaSize
 
-	sizes, err := calculateArenaSizes(arenaTotalSize, e.opts.Streaming, e.graph)
+	sizes, err := calculateArenaSizes(&e.opts, e.graph)
 	if err != nil {
 		return nil, err
 	}
@@ -825,6 +801,10 @@ func (e *Engine) setupExecutionArena() (*Arena, error) {
 		return nil, errors.New("failed to create arena for execution (arena is nil despite no error)")
 	}
 
+	if err := e.configureArena(arena); err != nil {
+		return nil, err
+	}
+
 	return arena, nil
 }
 
@@ -849,7 +829,7 @@ func (e *Engine) runExecution(arena *Arena) error {
 	if e.opts.Streaming {
 		return e.runStreamingExecution(arena)
 	}
-	return e.runSequentialExecution()
+	return e.runSequentialExecution(arena)
 }
 
 // runStreamingExecution handles streaming mode execution
@@ -857,34 +837,43 @@ func (e *Engine) runStreamingExecution(arena *Arena) error {
 	if e.scheduler == nil {
 		return fmt.Errorf("engine is configured for streaming but scheduler is not initialized (workers: %d)", e.workers)
 	}
-	e.runStreaming(arena)
-	return nil
+	return e.runStreaming(arena)
 }
 
 // runSequentialExecution handles non-streaming sequential execution
-func (e *Engine) runSequentialExecution() error {
-	for i, sublate := range e.sublates {
+func (e *Engine) runSequentialExecution(arena *Arena) error {
+	payload := e.modelPayload(arena)
+	for k := range e.sublates {
+		i := e.nodeIndex(k)
+		sublate := e.sublates[i]
 		if sublate == nil {
 			continue
 		}
 
-		if err := e.executeSublate(i, sublate); err != nil {
+		if err := e.executeSublate(i, sublate, payload); err != nil {
 			return err
 		}
 
-		sublate.SwapBuffers()
+		e.commit(i, sublate)
 	}
 	return nil
 }
 
-// executeSublate runs a single sublate's kernel
-func (e *Engine) executeSublate(index int, sublate *core.Sublate) error {
+// executeSublate runs a single sublate's kernel on its input, gathered from
+// payload and the outputs of its dependencies
+func (e *Engine) executeSublate(index int, sublate *core.Sublate, payload []byte) error {
 	kernelFn := kernels.GetKernel(sublate.KernelID)
 	if kernelFn == nil {
 		return fmt.Errorf("unknown kernel ID: %d for sublate %d", sublate.KernelID, index)
 	}
 
-	kernelFn(sublate.PayloadProp)
+	input := sublate.PayloadProp[:e.gather(index, payload)]
+	if err := e.callKernel(0, index, sublate.KernelID, kernelFn, input); err != nil {
+		return err
+	}
+	if err := e.guardOutput(e.graph.Nodes[index].ID, sublate.KernelID, input); err != nil {
+		return err
+	}
 
 	if e.opts.EnableStats {
 		e.updateKernelStats(sublate.KernelID)
@@ -905,28 +894,33 @@ func (e *Engine) updateKernelStats(kernelID uint8) {
 }
 
 // updateExecutionStats updates total executions and average latency
-func (e *Engine) updateExecutionStats(start time.Time) error {
+func (e *Engine) updateExecutionStats(start time.Time, arena *Arena) error {
 	if !e.opts.EnableStats {
 		return nil
 	}
 
+	e.recordExecution(time.Since(start), arena)
+	return nil
+}
+
+// recordExecution adds one execution to the steady-state stats, or to the
+// warmup stats while Warmup is running
+func (e *Engine) recordExecution(duration time.Duration, arena *Arena) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.stats.TotalExecutions++
-	duration := time.Since(start)
-
-	if e.stats.TotalExecutions == 1 {
-		e.stats.AverageLatency = duration
-	} else {
-		oldTotal := e.stats.TotalExecutions - 1
-		if oldTotal < 0 {
-			oldTotal = 0
-		}
-		e.stats.AverageLatency = time.Duration((int64(e.stats.AverageLatency)*oldTotal + int64(duration)) / e.stats.TotalExecutions)
+	e.stats.ArenaUtilization = arena.Utilization()
+	e.stats.ArenaGrowth = arena.growthPeak()
+	if e.warming.Load() {
+		e.stats.WarmupExecutions++
+		e.stats.WarmupLatency.observe(duration)
+		return
 	}
 
-	return nil
+	e.stats.TotalExecutions++
+	e.stats.Latency.observe(duration)
+	oldTotal := e.stats.TotalExecutions - 1
+	e.stats.AverageLatency = time.Duration((int64(e.stats.AverageLatency)*oldTotal + int64(duration)) / e.stats.TotalExecutions)
 }
 
 // initializeSublates creates sublates from the graph model
@@ -944,6 +938,7 @@ func (e *Engine) initializeSublates(graph *model.Graph, arena *Arena) error {
 		return fmt.Errorf("could not get model payload view from arena: %w", err)
 	}
 
+	owners := bufferOwners(graph)
 	for i, node := range graph.Nodes {
 		sublatePtr, err := arena.GetSublateAtIndex(i)
 		if err != nil {
@@ -951,6 +946,14 @@ func (e *Engine) initializeSublates(graph *model.Graph, arena *Arena) error {
 		}
 		e.sublates[i] = sublatePtr
 
+		// Tied nodes reuse the buffers, and so the data, of their segment's first node
+		if owner := owners[i]; owner != i {
+			e.initializeSublateMeta(sublatePtr, &node)
+			sublatePtr.PayloadPrev = e.sublates[owner].PayloadPrev
+			sublatePtr.PayloadProp = e.sublates[owner].PayloadProp
+			continue
+		}
+
 		if err := e.initializeSublateFields(sublatePtr, &node, graph, modelPayloadBytes, arena); err != nil {
 			return fmt.Errorf("failed to initialize fields for sublate %d: %w", i, err)
 		}
@@ -959,20 +962,24 @@ func (e *Engine) initializeSublates(graph *model.Graph, arena *Arena) error {
 }
 
 func (e *Engine) initializeSublateFields(sublatePtr *core.Sublate, node *model.Node, graph *model.Graph, modelPayloadBytes []byte, arena *Arena) error {
+	e.initializeSublateMeta(sublatePtr, node)
+	if err := e.allocateSublatePayloads(sublatePtr, node, graph, arena); err != nil {
+		return err
+	}
+
+	return e.copyInitialPayloadData(sublatePtr, node, modelPayloadBytes)
+}
+
+// initializeSublateMeta sets the kernel, flags and topology of a sublate
+func (e *Engine) initializeSublateMeta(sublatePtr *core.Sublate, node *model.Node) {
 	sublatePtr.KernelID = node.Kernel
 	sublatePtr.Flags = node.Flags
 	if len(node.Topo) > 0 {
-		sublatePtr.Topology = make([]uint16, len(node.Topo))
+		sublatePtr.Topology = make([]uint32, len(node.Topo))
 		copy(sublatePtr.Topology, node.Topo)
 	} else {
 		sublatePtr.Topology = nil
 	}
-
-	if err := e.allocateSublatePayloads(sublatePtr, node, graph, arena); err != nil {
-		return err
-	}
-
-	return e.copyInitialPayloadData(sublatePtr, node, modelPayloadBytes)
 }
 
 func (e *Engine) allocateSublatePayloads(sublatePtr *core.Sublate, node *model.Node, graph *model.Graph, arena *Arena) error {
@@ -982,13 +989,13 @@ func (e *Engine) allocateSublatePayloads(sublatePtr *core.Sublate, node *model.N
 	if alignedPayloadSize > 0 {
 		prevPayload, err := arena.AllocateNodePayload(alignedPayloadSize, core.CacheLineSize)
 		if err != nil {
-			return fmt.Errorf("failed to allocate PayloadPrev from arena node payloads: %w", err)
+			return fmt.Errorf("failed to allocate PayloadPrev from arena node payloads: %w", withNodeID(err, node.ID))
 		}
 		sublatePtr.PayloadPrev = prevPayload
 
 		propPayload, err := arena.AllocateNodePayload(alignedPayloadSize, core.CacheLineSize)
 		if err != nil {
-			return fmt.Errorf("failed to allocate PayloadProp from arena node payloads: %w", err)
+			return fmt.Errorf("failed to allocate PayloadProp from arena node payloads: %w", withNodeID(err, node.ID))
 		}
 		sublatePtr.PayloadProp = propPayload
 	} else {
@@ -1014,97 +1021,38 @@ func (e *Engine) copyInitialPayloadData(sublatePtr *core.Sublate, node *model.No
 	return nil
 }
 
-// calculateNodePayloadSize determines buffer size needed for a node
-// This is a placeholder function. The actual logic would be more complex.
-func calculateNodePayloadSize(node *model.Node, _ *model.Graph) int { // graph parameter marked as unused
-	// A more robust implementation would:
-	// 1. Look up kernel properties associated with node.Kernel. Some kernels might have fixed input/output sizes.
-	// 2. Consider node.Flags if they influence size.
-	// 3. If node.In and node.Out define a segment in graph.Payload, that's a strong hint for input size.
-	//    The output size might be the same or different depending on the kernel.
-	// 4. For now, use a simple heuristic: if In/Out are valid, use that length. Otherwise, a default.
-
-	if node.Out > node.In {
-		// This assumes In/Out are byte offsets for this node's primary data segment.
+// calculateNodePayloadSize determines buffer size needed for a node: its
+// payload segment, grown to hold the outputs of its dependencies where its
+// kernel reads them and its output shape, as inferred at compile time
+func calculateNodePayloadSize(node *model.Node, graph *model.Graph) int {
+	size := 0
+	if s, ok := graph.Segment(node.Segment); node.Segment != 0 && ok {
+		size = int(s.Length)
+	} else if node.Out > node.In {
+		// In/Out are byte offsets of this node's primary data segment.
 		// The Sublate architecture implies dual buffers, usually of the same size.
-		size := int(node.Out - node.In)
-		if size > 0 {
-			return size
-		}
-	}
-
-	// Fallback to a default size if In/Out don't yield a positive size.
-	// This default should be large enough for typical operations or based on some global config.
-	// As per instructions, memory is statically planned, so this should ideally not be a "guess".
-	// For testing, a small default might work.
-	// The original placeholder in the prompt used 256.
-	// Let's use a value that might be common, e.g., if nodes operate on vectors of a certain length.
-	// If a node represents a vector of 64 float32s: 64 * 4 = 256 bytes.
-	return 256 // Default fallback size in bytes.
-}
-
-// WorkStealingScheduler implements work-stealing for load balancing
-type WorkStealingScheduler struct {
-	localQueues []chan *core.Sublate
-	globalQueue chan *core.Sublate
-	workers     int
-}
-
-// NewWorkStealingScheduler creates a work-stealing scheduler for fine-grained tasks
-func NewWorkStealingScheduler(workers int) *WorkStealingScheduler {
-	ws := &WorkStealingScheduler{
-		localQueues: make([]chan *core.Sublate, workers),
-		globalQueue: make(chan *core.Sublate, workers*4),
-		workers:     workers,
+		size = int(node.Out - node.In)
 	}
-
-	for i := range ws.localQueues {
-		ws.localQueues[i] = make(chan *core.Sublate, 16)
-	}
-
-	return ws
-}
-
-// SubmitWork adds work to a worker's local queue
-func (ws *WorkStealingScheduler) SubmitWork(workerID int, sublate *core.Sublate) {
-	select {
-	case ws.localQueues[workerID] <- sublate:
-	default:
-		// Local queue full, submit to global queue
-		ws.globalQueue <- sublate
+	operands, output := kernels.Ports(node.Kernel, nodeSegment(node, graph.Payload))
+	if shape, ok := graph.Shapes[node.ID]; ok {
+		size = max(size, output+kernels.Elements(shape)*4)
 	}
-}
-
-// GetWork attempts to get work from local queue, then steals from others
-func (ws *WorkStealingScheduler) GetWork(workerID int) *core.Sublate {
-	// Try local queue first
-	select {
-	case work := <-ws.localQueues[workerID]:
-		return work
-	default:
+	packed := operands
+	for _, dep := range node.Topo {
+		if shape, ok := graph.Shapes[dep]; ok && dep != model.NoNeighbor {
+			packed += kernels.Elements(shape) * 4
+		}
 	}
-
-	// Try global queue
-	select {
-	case work := <-ws.globalQueue:
-		return work
-	default:
+	if packed > operands {
+		size = max(size, packed)
 	}
-
-	// Try to steal from other workers
-	for i := 0; i < ws.workers; i++ {
-		if i == workerID {
-			continue
-		}
-
-		select {
-		case work := <-ws.localQueues[i]:
-			return work
-		default:
-		}
+	if size > 0 {
+		return size
 	}
 
-	return nil
+	// Nodes with neither a segment nor an inferred shape get room for a
+	// vector of 64 float32s
+	return 256 // Default fallback size in bytes.
 }
 
 // ArenaAllocator manages memory allocation within a fixed arena
@@ -133,6 +133,52 @@ func TestStreamingExecution(t *testing.T) {
 	}
 }
 
+func TestPinnedWorkersNUMALocal(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 128},
+			{ID: 1, Kernel: 3, In: 128, Out: 256},
+		},
+	}
+
+	opts := &EngineOptions{
+		Workers:    2,
+		ArenaSize:  1 << 20,
+		Streaming:  true,
+		PinWorkers: true,
+		NUMAPolicy: NUMALocal,
+	}
+	engine, err := NewEngine(graph, opts)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if engine.arena.WorkerShardCount() != 2 {
+		t.Errorf("Expected 2 worker shards, got %d", engine.arena.WorkerShardCount())
+	}
+
+	if err := engine.Execute(NewExecutionContext(len(graph.Nodes))); err != nil {
+		t.Errorf("Execute with pinned workers failed: %v", err)
+	}
+}
+
+func TestParseNUMAPolicy(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"none", "local"} {
+		p, err := ParseNUMAPolicy(name)
+		if err != nil {
+			t.Fatalf("ParseNUMAPolicy(%q) failed: %v", name, err)
+		}
+		if p.String() != name {
+			t.Errorf("Round trip of %q produced %q", name, p.String())
+		}
+	}
+	if _, err := ParseNUMAPolicy("interleave"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
 func TestWorkStealingScheduler(t *testing.T) {
 	t.Parallel()
 	scheduler := NewWorkStealingScheduler(4)
@@ -244,6 +290,9 @@ func TestEngineStats(t *testing.T) {
 	if stats.TotalExecutions != 1 {
 		t.Errorf("Expected 1 execution, got %d", stats.TotalExecutions)
 	}
+	if stats.ArenaUtilization <= 0 {
+		t.Errorf("Expected arena utilization > 0, got %f", stats.ArenaUtilization)
+	}
 }
 
 func BenchmarkEngineExecution(b *testing.B) {
@@ -0,0 +1,77 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+)
+
+// safetensorsFile builds a safetensors file from a JSON header, padded as
+// the reference writer does, and the tensor data
+func safetensorsFile(header string, data []byte) []byte {
+	header += strings.Repeat(" ", (8-len(header)%8)%8)
+	file := binary.LittleEndian.AppendUint64(nil, uint64(len(header)))
+	return append(append(file, header...), data...)
+}
+
+func TestSafetensorsWeights(t *testing.T) {
+	t.Parallel()
+	var data []byte
+	for _, v := range []float32{1, 2, 3, 4} {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+	data = append(data, 0x00, 0x3C, 0x00, 0xC0) // F16 1, -2
+	file := safetensorsFile(`{"__metadata__":{"format":"pt"},`+
+		`"fc.weight":{"dtype":"F32","shape":[2,2],"data_offsets":[0,16]},`+
+		`"fc.bias":{"dtype":"F16","shape":[2],"data_offsets":[16,20]},`+
+		`"unused":{"dtype":"U8","shape":[0],"data_offsets":[20,20]}}`, data)
+
+	dir := t.TempDir()
+	weights := filepath.Join(dir, "m.safetensors")
+	if err := os.WriteFile(weights, file, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	compile := func(spec string) (string, error) {
+		src, out := filepath.Join(dir, "m.subs"), filepath.Join(dir, "m.subl")
+		if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		opts := compiler.DefaultOptions()
+		opts.Weights = weights
+		_, err := compiler.CompileWithOptions(src, out, opts)
+		return out, err
+	}
+
+	// No payload bytes: the segments are backed by zeros and then loaded
+	out, err := compile("segment 1 0 16 weight float32 fc.weight\nsegment 2 32 8 bias float32 fc.bias\n" +
+		"node 0 0 @1\nnode 1 0 @2 <- 0\n")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	g, err := ReadGraph(out, nil)
+	if err != nil {
+		t.Fatalf("ReadGraph failed: %v", err)
+	}
+	if !bytes.Equal(g.Payload[:16], data[:16]) {
+		t.Errorf("Expected fc.weight in segment 1, got %v", g.Payload[:16])
+	}
+	if a, b := math.Float32frombits(binary.LittleEndian.Uint32(g.Payload[32:])), math.Float32frombits(binary.LittleEndian.Uint32(g.Payload[36:])); a != 1 || b != -2 {
+		t.Errorf("Expected fc.bias widened to [1 -2], got [%v %v]", a, b)
+	}
+
+	for spec, want := range map[string]string{
+		"segment 1 0 32 weight float32 fc.weight\nnode 0 0 @1\n": "elements",
+		"segment 1 0 16 weight int32 fc.weight\nnode 0 0 @1\n":   "cannot load",
+		"segment 1 0 16 weight float32 fc.w\nnode 0 0 @1\n":      "no tensor",
+	} {
+		if _, err := compile(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected a %q error for %q, got %v", want, spec, err)
+		}
+	}
+}
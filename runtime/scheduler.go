@@ -0,0 +1,283 @@
+package runtime
+
+import (
+	"cmp"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// StreamScheduler manages dependency-aware execution of graph nodes.
+//
+// A node's Topo lists the IDs of the nodes it consumes. The scheduler keeps
+// the static shape of the graph (per-node in-degree and dependents); every
+// execution gets a fresh streamRun holding the mutable counters, so one
+// scheduler can drive any number of sequential executions.
+type StreamScheduler struct {
+	nodes      []model.Node
+	inDegree   []int32 // Number of prerequisites of each node
+	dependents [][]int // Indices of the nodes waiting on each node
+	roots      []int   // Nodes with no prerequisites
+	order      []int   // Topological order found by checkAcyclic
+	workers    int
+
+	current atomic.Pointer[streamRun]
+}
+
+// streamRun is the per-execution state of the scheduler.
+type streamRun struct {
+	pending []int32               // Prerequisites still outstanding, per node
+	ready   chan int              // Shared ready queue (SchedulerLevels)
+	queues  *stealQueues[int]     // Per-worker deques (SchedulerWorkSteal)
+	done    int32                 // Nodes that finished executing
+	err     atomic.Pointer[error] // First node failure; later nodes are skipped
+}
+
+// fail records the first error of the run.
+func (r *streamRun) fail(err error) {
+	r.err.CompareAndSwap(nil, &err)
+}
+
+// failure returns the error that aborted the run, if any.
+func (r *streamRun) failure() error {
+	if err := r.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// NewStreamScheduler creates a scheduler for graph, returning an error when the
+// node topology contains a cycle.
+func NewStreamScheduler(graph *model.Graph, workers int) (*StreamScheduler, error) {
+	s := &StreamScheduler{
+		nodes:      graph.Nodes,
+		inDegree:   make([]int32, len(graph.Nodes)),
+		dependents: make([][]int, len(graph.Nodes)),
+		workers:    workers,
+	}
+	s.buildDependencies()
+	if err := s.checkAcyclic(); err != nil {
+		return nil, err
+	}
+	if len(graph.Costs) > 0 {
+		s.prioritize(graph.Costs)
+	}
+	return s, nil
+}
+
+// buildDependencies derives in-degrees and dependent lists from node topology.
+// A Topo entry naming an ID shared by several nodes waits on all of them;
+// entries naming unknown IDs are ignored.
+func (s *StreamScheduler) buildDependencies() {
+	byID := make(map[uint32][]int, len(s.nodes))
+	for i, n := range s.nodes {
+		byID[n.ID] = append(byID[n.ID], i)
+	}
+
+	for i, n := range s.nodes {
+		for _, depID := range n.Topo {
+			for _, dep := range byID[depID] {
+				s.dependents[dep] = append(s.dependents[dep], i)
+				s.inDegree[i]++
+			}
+		}
+	}
+
+	for i, degree := range s.inDegree {
+		if degree == 0 {
+			s.roots = append(s.roots, i)
+		}
+	}
+}
+
+// checkAcyclic runs Kahn's algorithm over the static counts to make sure
+// every node eventually becomes ready, recording the order nodes were visited.
+func (s *StreamScheduler) checkAcyclic() error {
+	pending := append([]int32(nil), s.inDegree...)
+	queue := append([]int(nil), s.roots...)
+	visited := 0
+	s.order = make([]int, 0, len(s.nodes))
+
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		visited++
+		s.order = append(s.order, i)
+		for _, d := range s.dependents[i] {
+			pending[d]--
+			if pending[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	if visited != len(s.nodes) {
+		graph := model.Graph{Nodes: s.nodes}
+		_, err := graph.TopologicalOrder()
+		return fmt.Errorf("graph topology contains a cycle, %d of %d nodes unreachable: %w", len(s.nodes)-visited, len(s.nodes), err)
+	}
+	return nil
+}
+
+// prioritize orders the roots and every dependent list by decreasing
+// critical path cost, the node's own weight plus the costliest chain of
+// dependents after it, so nodes released together start longest-first and
+// levels finish together instead of waiting on one expensive straggler.
+// Nodes without a cost weigh 1.
+func (s *StreamScheduler) prioritize(costs map[uint32]model.NodeCost) {
+	rank := make([]uint64, len(s.nodes))
+	for k := len(s.order) - 1; k >= 0; k-- {
+		i := s.order[k]
+		var tail uint64
+		for _, d := range s.dependents[i] {
+			tail = max(tail, rank[d])
+		}
+		weight := uint64(1)
+		if c, ok := costs[s.nodes[i].ID]; ok && c.Weight() > 0 {
+			weight = c.Weight()
+		}
+		rank[i] = weight + tail
+	}
+	byRank := func(a, b int) int { return cmp.Compare(rank[b], rank[a]) }
+	slices.SortStableFunc(s.roots, byRank)
+	for _, deps := range s.dependents {
+		slices.SortStableFunc(deps, byRank)
+	}
+}
+
+// begin starts a new execution with all roots queued.
+func (s *StreamScheduler) begin() *streamRun {
+	run := &streamRun{
+		pending: append([]int32(nil), s.inDegree...),
+		// Every node is queued exactly once, so sends never block
+		ready: make(chan int, len(s.nodes)),
+	}
+	for _, i := range s.roots {
+		run.ready <- i
+	}
+	if len(s.nodes) == 0 {
+		close(run.ready)
+	}
+	s.current.Store(run)
+	return run
+}
+
+// complete records that node i finished, releases dependents whose last
+// prerequisite it was, and closes the ready queue after the final node.
+func (s *StreamScheduler) complete(run *streamRun, i int) {
+	for _, d := range s.dependents[i] {
+		if atomic.AddInt32(&run.pending[d], -1) == 0 {
+			run.ready <- d
+		}
+	}
+	if int(atomic.AddInt32(&run.done, 1)) == len(s.nodes) {
+		close(run.ready)
+	}
+}
+
+// depths reports the queue state of the most recent execution.
+func (s *StreamScheduler) depths() QueueDepths {
+	run := s.current.Load()
+	if run == nil {
+		return QueueDepths{}
+	}
+	done := int(atomic.LoadInt32(&run.done))
+	ready := len(run.ready)
+	if run.queues != nil {
+		ready = run.queues.len()
+	}
+	return QueueDepths{
+		Ready:   ready,
+		Waiting: max(len(s.nodes)-done-ready, 0),
+	}
+}
+
+// runStreaming executes using the dependency-aware scheduler
+func (e *Engine) runStreaming(arena *Arena) error {
+	if e.opts.Deterministic {
+		return e.runDeterministic(arena)
+	}
+	if e.pool != nil {
+		return e.runOnPool(arena)
+	}
+	if e.opts.Scheduler == SchedulerWorkSteal {
+		return e.runWorkStealing(arena)
+	}
+
+	run := e.scheduler.begin()
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.workers; i++ {
+		wg.Add(1)
+		go e.worker(i, run, arena, &wg)
+	}
+	wg.Wait()
+	return run.failure()
+}
+
+// worker executes ready nodes until the run's queue is closed
+func (e *Engine) worker(id int, run *streamRun, arena *Arena, wg *sync.WaitGroup) {
+	defer wg.Done()
+	payload := e.modelPayload(arena)
+	e.pinWorker(id)
+
+	for i := range run.ready {
+		e.execNode(run, id, i, payload)
+		e.scheduler.complete(run, i)
+	}
+}
+
+// execNode runs node i of run unless an earlier node aborted it. Aborted
+// nodes are still completed so the run drains.
+func (e *Engine) execNode(run *streamRun, worker, i int, payload []byte) {
+	if run.err.Load() != nil {
+		return
+	}
+	if err := e.runNode(worker, i, payload); err != nil {
+		run.fail(err)
+	}
+}
+
+// pinWorker locks the calling worker goroutine to its CPU when PinWorkers is set
+func (e *Engine) pinWorker(id int) {
+	if !e.opts.PinWorkers {
+		return
+	}
+	// The thread is deliberately never unlocked: a goroutine that exits while
+	// locked takes its thread with it, so the narrowed affinity mask cannot
+	// leak back into the Go scheduler's thread pool.
+	runtime.LockOSThread()
+	if cpu := workerCPU(id, e.cpus); cpu >= 0 {
+		_ = pinThread(cpu) // best-effort: cgroups may forbid the CPU
+	}
+}
+
+// runNode applies node i's kernel to its input, gathered from payload and
+// the outputs of its dependencies, and commits the output. The scheduler
+// runs a node only once its dependencies completed.
+func (e *Engine) runNode(worker, i int, payload []byte) error {
+	n := &e.scheduler.nodes[i]
+	sublate := e.sublates[i]
+	if sublate == nil {
+		return nil
+	}
+	kernel := kernels.GetKernel(n.Kernel)
+	if kernel == nil {
+		return fmt.Errorf("unknown kernel ID: %d for sublate %d", n.Kernel, i)
+	}
+
+	input := sublate.PayloadProp[:e.gather(i, payload)]
+	if err := e.callKernel(worker, i, n.Kernel, kernel, input); err != nil {
+		return err
+	}
+	if err := e.guardOutput(n.ID, n.Kernel, input); err != nil {
+		return err
+	}
+	e.commit(i, sublate)
+	return nil
+}
@@ -0,0 +1,161 @@
+package runtime
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// drainScheduler runs one execution of s with the given number of workers and
+// fails if a node is dequeued before all of its prerequisites have completed.
+func drainScheduler(t *testing.T, s *StreamScheduler, workers int) {
+	t.Helper()
+	run := s.begin()
+
+	var mu sync.Mutex
+	finished := make(map[int]bool)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range run.ready {
+				mu.Lock()
+				for dep, dependents := range s.dependents {
+					for _, d := range dependents {
+						if d == i && !finished[dep] {
+							t.Errorf("Node %d ran before prerequisite %d", i, dep)
+						}
+					}
+				}
+				mu.Unlock()
+
+				mu.Lock()
+				finished[i] = true
+				mu.Unlock()
+				s.complete(run, i)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Scheduler deadlocked")
+	}
+
+	if len(finished) != len(s.nodes) {
+		t.Errorf("Expected %d nodes to finish, got %d", len(s.nodes), len(finished))
+	}
+}
+
+func TestStreamSchedulerTopologies(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		nodes []model.Node
+	}{
+		{"single", []model.Node{{ID: 0}}},
+		{"chain", []model.Node{
+			{ID: 0},
+			{ID: 1, Topo: []uint32{0}},
+			{ID: 2, Topo: []uint32{1}},
+			{ID: 3, Topo: []uint32{2}},
+		}},
+		{"diamond", []model.Node{
+			{ID: 0},
+			{ID: 1, Topo: []uint32{0}},
+			{ID: 2, Topo: []uint32{0}},
+			{ID: 3, Topo: []uint32{1, 2}},
+		}},
+		{"disconnected", []model.Node{
+			{ID: 0},
+			{ID: 1, Topo: []uint32{0}},
+			{ID: 2},
+			{ID: 3, Topo: []uint32{2}},
+			{ID: 4},
+		}},
+		{"unordered", []model.Node{
+			{ID: 3, Topo: []uint32{1, 2}},
+			{ID: 2, Topo: []uint32{0}},
+			{ID: 1, Topo: []uint32{0}},
+			{ID: 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s, err := NewStreamScheduler(&model.Graph{Nodes: tt.nodes}, 4)
+			if err != nil {
+				t.Fatalf("NewStreamScheduler failed: %v", err)
+			}
+			for _, workers := range []int{1, 4} {
+				drainScheduler(t, s, workers)
+			}
+		})
+	}
+}
+
+func TestStreamSchedulerRejectsCycle(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{Nodes: []model.Node{
+		{ID: 0, Topo: []uint32{2}},
+		{ID: 1, Topo: []uint32{0}},
+		{ID: 2, Topo: []uint32{1}},
+	}}
+	if _, err := NewStreamScheduler(graph, 2); err == nil {
+		t.Error("Expected error for cyclic topology")
+	}
+}
+
+func TestStreamSchedulerEmptyGraph(t *testing.T) {
+	t.Parallel()
+	s, err := NewStreamScheduler(&model.Graph{}, 2)
+	if err != nil {
+		t.Fatalf("NewStreamScheduler failed: %v", err)
+	}
+	drainScheduler(t, s, 2)
+}
+
+func TestStreamingExecuteRepeated(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+			{ID: 2, Kernel: 1, In: 128, Out: 192, Topo: []uint32{0}},
+			{ID: 3, Kernel: 1, In: 192, Out: 256, Topo: []uint32{1, 2}},
+		},
+	}
+	recorder := NewTraceRecorder(0)
+	engine, err := NewEngine(graph, &EngineOptions{
+		Workers:   3,
+		ArenaSize: 1 << 16,
+		Streaming: true,
+		Tracer:    recorder,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := engine.Execute(NewExecutionContext(len(graph.Nodes))); err != nil {
+			t.Fatalf("Execute %d failed: %v", i, err)
+		}
+	}
+	if got := len(recorder.Events()); got != 3*len(graph.Nodes) {
+		t.Errorf("Expected %d traced nodes, got %d", 3*len(graph.Nodes), got)
+	}
+	if depths := engine.QueueDepths(); depths.Ready != 0 || depths.Waiting != 0 {
+		t.Errorf("Expected empty queues after execution, got %+v", depths)
+	}
+}
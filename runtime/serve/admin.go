@@ -0,0 +1,58 @@
+package serve
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// NewAdminHandler serves health checks and statistics for s:
+//
+//	GET /healthz[?model=name]     serving state, 503 when not serving
+//	GET /v1/models                hosted model names
+//	GET /v1/models/{model}/stats  runtime.ExecutionStats of one model
+func NewAdminHandler(s *Service) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		status := s.Health(r.URL.Query().Get("model"))
+		code := http.StatusOK
+		switch status {
+		case HealthUnknown:
+			code = http.StatusNotFound
+		case HealthNotServing:
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, map[string]string{"status": status.String()})
+	})
+	mux.HandleFunc("GET /v1/models", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string][]string{"models": s.Models()})
+	})
+	mux.HandleFunc("GET /v1/models/{model}/stats", func(w http.ResponseWriter, r *http.Request) {
+		stats, err := s.Stats(r.PathValue("model"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+	})
+	return mux
+}
+
+// writeJSON encodes v as the response body.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps service errors onto HTTP status codes.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrUnknownModel):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrNotServing):
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
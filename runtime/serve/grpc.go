@@ -0,0 +1,338 @@
+package serve
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sbl8/sublation/runtime"
+)
+
+// gRPC methods served by NewGRPCHandler, as declared in serve.proto and by
+// the standard health checking protocol.
+const (
+	grpcPredict       = "/sublation.serve.v1.Inference/Predict"
+	grpcBatchPredict  = "/sublation.serve.v1.Inference/BatchPredict"
+	grpcPredictStream = "/sublation.serve.v1.Inference/PredictStream"
+	grpcHealthCheck   = "/grpc.health.v1.Health/Check"
+)
+
+// grpcCode is a gRPC status code.
+type grpcCode int
+
+const (
+	grpcOK                grpcCode = 0
+	grpcCanceled          grpcCode = 1
+	grpcUnknown           grpcCode = 2
+	grpcInvalidArgument   grpcCode = 3
+	grpcDeadlineExceeded  grpcCode = 4
+	grpcNotFound          grpcCode = 5
+	grpcResourceExhausted grpcCode = 8
+	grpcUnimplemented     grpcCode = 12
+	grpcUnavailable       grpcCode = 14
+)
+
+// grpcError is a failure with the status code it is reported with.
+type grpcError struct {
+	code grpcCode
+	err  error
+}
+
+func (e *grpcError) Error() string { return e.err.Error() }
+func (e *grpcError) Unwrap() error { return e.err }
+
+// grpcErrorf returns a grpcError with code and a formatted message.
+func grpcErrorf(code grpcCode, format string, args ...any) error {
+	return &grpcError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// NewGRPCHandler serves s as the gRPC service sublation.serve.v1.Inference
+// of serve.proto, whose Predict, BatchPredict and PredictStream RPCs call
+// the Service methods of the same name, and grpc.health.v1.Health/Check
+// on s.Health. gRPC runs on HTTP/2, which net/http serves over TLS, so
+// mount the handler on a server started with ServeTLS or ListenAndServeTLS.
+// Messages are uncompressed and at most 32 MiB.
+func NewGRPCHandler(s *Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "gRPC requires POST over HTTP/2 with an application/grpc content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+
+		var err error
+		switch r.URL.Path {
+		case grpcPredict:
+			err = grpcUnary(w, r, func(msg []byte) ([]byte, error) {
+				req, err := decodeRequest(msg)
+				if err != nil {
+					return nil, err
+				}
+				resp, err := s.Predict(r.Context(), req)
+				return encodeResponse(resp).b, err
+			})
+		case grpcBatchPredict:
+			err = grpcUnary(w, r, func(msg []byte) ([]byte, error) {
+				return batchPredict(r.Context(), s, msg)
+			})
+		case grpcPredictStream:
+			err = predictStream(w, r, s)
+		case grpcHealthCheck:
+			err = grpcUnary(w, r, func(msg []byte) ([]byte, error) {
+				return healthCheck(s, msg)
+			})
+		default:
+			err = grpcErrorf(grpcUnimplemented, "unknown method %s", r.URL.Path)
+		}
+		writeStatus(w, err)
+	})
+}
+
+// grpcUnary answers a unary call: call gets the one request message and
+// returns the response message.
+func grpcUnary(w http.ResponseWriter, r *http.Request, call func([]byte) ([]byte, error)) error {
+	msg, err := readMessage(r.Body)
+	if errors.Is(err, io.EOF) {
+		return grpcErrorf(grpcInvalidArgument, "no request message")
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := call(msg)
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, resp)
+}
+
+// batchPredict decodes a BatchPredictRequest, runs it with
+// Service.BatchPredict and encodes the BatchPredictResponse.
+func batchPredict(ctx context.Context, s *Service, msg []byte) ([]byte, error) {
+	var reqs []Request
+	err := protoFields(msg, func(f protoField) error {
+		if f.num != 1 {
+			return nil
+		}
+		if err := f.wantWire(2); err != nil {
+			return err
+		}
+		req, err := decodeRequest(f.data)
+		reqs = append(reqs, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	resps, err := s.BatchPredict(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+	var out protoBuf
+	for _, resp := range resps {
+		out.message(1, encodeResponse(resp))
+	}
+	return out.b, nil
+}
+
+// predictStream answers a PredictStream call with Service.PredictStream,
+// writing each response as soon as it is computed.
+func predictStream(w http.ResponseWriter, r *http.Request, s *Service) error {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	in, out := make(chan Request), make(chan Response)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(in)
+		for {
+			msg, err := readMessage(r.Body)
+			var req Request
+			if err == nil {
+				req, err = decodeRequest(msg)
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr <- err
+					cancel()
+				}
+				return
+			}
+			select {
+			case in <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.PredictStream(ctx, in, out)
+		close(out)
+	}()
+
+	var writeErr error
+	for resp := range out {
+		if writeErr == nil {
+			if writeErr = writeMessage(w, encodeResponse(resp).b); writeErr != nil {
+				cancel()
+			}
+		}
+	}
+	err := <-done
+	select {
+	case err := <-readErr:
+		return err
+	default:
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// healthCheck answers a grpc.health.v1 HealthCheckRequest, whose service
+// is a model name or empty for the whole service. Unknown models fail with
+// NOT_FOUND, as the protocol asks.
+func healthCheck(s *Service, msg []byte) ([]byte, error) {
+	var model string
+	err := protoFields(msg, func(f protoField) error {
+		if f.num != 1 {
+			return nil
+		}
+		model = string(f.data)
+		return f.wantWire(2)
+	})
+	if err != nil {
+		return nil, err
+	}
+	status := s.Health(model)
+	if status == HealthUnknown {
+		return nil, grpcErrorf(grpcNotFound, "%v %q", ErrUnknownModel, model)
+	}
+	// grpc.health.v1 numbers SERVING 1 and NOT_SERVING 2, as HealthStatus does
+	var out protoBuf
+	out.varint(1, uint64(status))
+	return out.b, nil
+}
+
+// decodeRequest decodes a PredictRequest.
+func decodeRequest(msg []byte) (Request, error) {
+	var req Request
+	err := protoFields(msg, func(f protoField) error {
+		switch f.num {
+		case 1:
+			req.Model = string(f.data)
+			return f.wantWire(2)
+		case 2:
+			req.Priority = runtime.Priority(int32(f.v))
+			if req.Priority < runtime.PriorityBatch || req.Priority > runtime.PriorityCritical {
+				return grpcErrorf(grpcInvalidArgument, "invalid priority %d", int32(f.v))
+			}
+			return f.wantWire(0)
+		case 3:
+			req.Input = f.data
+			return f.wantWire(2)
+		}
+		return nil
+	})
+	return req, err
+}
+
+// encodeResponse encodes a PredictResponse.
+func encodeResponse(resp Response) *protoBuf {
+	var out protoBuf
+	out.string(1, resp.Model)
+	out.bytes(2, resp.Output)
+	return &out
+}
+
+// readMessage reads one length-prefixed message, io.EOF at the end of the
+// request stream.
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, grpcErrorf(grpcInvalidArgument, "truncated message prefix")
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxRequestBytes {
+		return nil, grpcErrorf(grpcResourceExhausted, "message of %d bytes exceeds the %d-byte limit", size, maxRequestBytes)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "truncated message: %v", err)
+	}
+	return msg, nil
+}
+
+// writeMessage writes one length-prefixed message and flushes it.
+func writeMessage(w http.ResponseWriter, msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// writeStatus sets the trailers that end a call with the status of err.
+func writeStatus(w http.ResponseWriter, err error) {
+	code := grpcStatus(err)
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	if err != nil {
+		w.Header().Set("Grpc-Message", percentEncode(err.Error()))
+	}
+}
+
+// grpcStatus maps service and engine errors onto gRPC status codes.
+func grpcStatus(err error) grpcCode {
+	var ge *grpcError
+	switch {
+	case err == nil:
+		return grpcOK
+	case errors.As(err, &ge):
+		return ge.code
+	case errors.Is(err, errProto), errors.Is(err, runtime.ErrInputTooLarge), errors.Is(err, runtime.ErrInputTooShort):
+		return grpcInvalidArgument
+	case errors.Is(err, ErrUnknownModel):
+		return grpcNotFound
+	case errors.Is(err, ErrNotServing), errors.Is(err, runtime.ErrClosed):
+		return grpcUnavailable
+	case errors.Is(err, context.Canceled):
+		return grpcCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcDeadlineExceeded
+	case errors.Is(err, runtime.ErrArenaExhausted):
+		return grpcResourceExhausted
+	}
+	return grpcUnknown
+}
+
+// percentEncode escapes a Grpc-Message value as the protocol requires:
+// bytes outside printable ASCII, and '%', become %XX.
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,236 @@
+package serve
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+// sumGraph computes s = sum(relu(x)) of its input x, four float32 values
+func sumGraph() *model.Graph {
+	return &model.Graph{
+		Payload: make([]byte, 16),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: kernels.OpNoop, In: 0, Out: 16},
+			{ID: 1, Kernel: kernels.OpReLU, In: 16, Out: 16, Topo: []uint32{0}},
+			{ID: 2, Kernel: kernels.OpSum, In: 16, Out: 16, Topo: []uint32{1}},
+		},
+		IO: []model.IOSpec{
+			{Name: "x", Kind: model.Input, NodeID: 0, DType: model.Float32, Shape: []int{4}},
+			{Name: "s", Kind: model.Output, NodeID: 2, DType: model.Float32, Shape: []int{1}},
+		},
+	}
+}
+
+// float32Bytes encodes v little endian
+func float32Bytes(v ...float32) []byte {
+	var b []byte
+	for _, f := range v {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+	}
+	return b
+}
+
+// frame length-prefixes a gRPC message
+func frame(msg []byte) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg))), msg...)
+}
+
+// predictRequestMsg encodes a PredictRequest for model m
+func predictRequestMsg(m string, priority runtime.Priority, input []byte) []byte {
+	var p protoBuf
+	p.string(1, m)
+	p.varint(2, uint64(priority))
+	p.bytes(3, input)
+	return p.b
+}
+
+// newGRPCServer serves the gRPC handler of a service hosting sumGraph as
+// "sum" over TLS with HTTP/2
+func newGRPCServer(t *testing.T) (*httptest.Server, *Service) {
+	t.Helper()
+	host := runtime.NewHost(&runtime.HostOptions{Workers: 2, Streaming: true})
+	t.Cleanup(func() { host.Close(context.Background()) })
+	if err := host.Add("sum", sumGraph()); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	s := NewService(host)
+	ts := httptest.NewUnstartedServer(NewGRPCHandler(s))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts, s
+}
+
+// call posts body to method and returns the response messages and the
+// grpc-status trailer
+func call(t *testing.T, ts *httptest.Server, method string, body io.Reader) ([][]byte, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, ts.URL+method, body)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("%s: expected HTTP/2, got %s", method, resp.Proto)
+	}
+	var msgs [][]byte
+	for {
+		msg, err := readMessage(resp.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s: reading response failed: %v", method, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, resp.Trailer.Get("Grpc-Status")
+}
+
+// sumOf decodes a PredictResponse of model sum and returns its output value
+func sumOf(t *testing.T, msg []byte) float32 {
+	t.Helper()
+	var m string
+	var output []byte
+	err := protoFields(msg, func(f protoField) error {
+		switch f.num {
+		case 1:
+			m = string(f.data)
+		case 2:
+			output = f.data
+		}
+		return nil
+	})
+	if err != nil || m != "sum" || len(output) != 4 {
+		t.Fatalf("Expected 4 output bytes of model sum, got %q with %v (%v)", m, output, err)
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(output))
+}
+
+func TestGRPCPredict(t *testing.T) {
+	t.Parallel()
+	ts, s := newGRPCServer(t)
+
+	msgs, status := call(t, ts, grpcPredict, bytes.NewReader(frame(predictRequestMsg("sum", runtime.PriorityCritical, float32Bytes(1, -2, 3, -4)))))
+	if status != "0" || len(msgs) != 1 || sumOf(t, msgs[0]) != 4 {
+		t.Errorf("Expected sum 4 with status 0, got %d messages with status %s", len(msgs), status)
+	}
+
+	var batch protoBuf
+	for _, x := range [][]float32{{1, 1, 1, 1}, {-1, 5, -1, 0.5}} {
+		batch.bytes(1, predictRequestMsg("", runtime.PriorityBatch, float32Bytes(x...)))
+	}
+	msgs, status = call(t, ts, grpcBatchPredict, bytes.NewReader(frame(batch.b)))
+	if status != "0" || len(msgs) != 1 {
+		t.Fatalf("Expected one BatchPredictResponse with status 0, got %d with status %s", len(msgs), status)
+	}
+	var sums []float32
+	protoFields(msgs[0], func(f protoField) error {
+		sums = append(sums, sumOf(t, f.data))
+		return nil
+	})
+	if len(sums) != 2 || sums[0] != 4 || sums[1] != 5.5 {
+		t.Errorf("Expected sums [4 5.5] in request order, got %v", sums)
+	}
+
+	for method, c := range map[string]struct {
+		body   []byte
+		status string
+	}{
+		"unknown model": {frame(predictRequestMsg("missing", 0, nil)), "5"},
+		"short input":   {frame(predictRequestMsg("sum", 0, make([]byte, 8))), "3"},
+		"priority":      {frame(predictRequestMsg("sum", 7, float32Bytes(1, 2, 3, 4))), "3"},
+		"malformed":     {frame([]byte{0xff}), "3"},
+		"no message":    {nil, "3"},
+	} {
+		if _, status := call(t, ts, grpcPredict, bytes.NewReader(c.body)); status != c.status {
+			t.Errorf("%s: expected status %s, got %s", method, c.status, status)
+		}
+	}
+	if _, status := call(t, ts, "/sublation.serve.v1.Inference/Train", bytes.NewReader(nil)); status != "12" {
+		t.Errorf("Expected UNIMPLEMENTED for an unknown method, got %s", status)
+	}
+
+	// Health follows grpc.health.v1: SERVING is 1, NOT_SERVING 2
+	health := func(service string) ([][]byte, string) {
+		var p protoBuf
+		p.string(1, service)
+		return call(t, ts, grpcHealthCheck, bytes.NewReader(frame(p.b)))
+	}
+	if msgs, status := health("sum"); status != "0" || len(msgs) != 1 || !bytes.Equal(msgs[0], []byte{8, 1}) {
+		t.Errorf("Expected SERVING, got %v with status %s", msgs, status)
+	}
+	if _, status := health("missing"); status != "5" {
+		t.Errorf("Expected NOT_FOUND for an unknown model, got %s", status)
+	}
+	s.Drain()
+	if msgs, status := health(""); status != "0" || len(msgs) != 1 || !bytes.Equal(msgs[0], []byte{8, 2}) {
+		t.Errorf("Expected NOT_SERVING after Drain, got %v with status %s", msgs, status)
+	}
+	if _, status := call(t, ts, grpcPredict, bytes.NewReader(frame(predictRequestMsg("sum", 0, float32Bytes(1, 2, 3, 4))))); status != "14" {
+		t.Errorf("Expected UNAVAILABLE after Drain, got %s", status)
+	}
+}
+
+func TestGRPCPredictStream(t *testing.T) {
+	t.Parallel()
+	ts, _ := newGRPCServer(t)
+
+	// Every response arrives before the next request is sent
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, ts.URL+grpcPredictStream, pr)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	result := make(chan *http.Response, 1)
+	go func() {
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Errorf("PredictStream failed: %v", err)
+			pr.Close()
+		}
+		result <- resp
+	}()
+	var resp *http.Response
+	for i, x := range [][]float32{{1, -2, 3, -4}, {2, 2, 2, 2}, {-1, -1, -1, 9}} {
+		if _, err := pw.Write(frame(predictRequestMsg("sum", runtime.PriorityNormal, float32Bytes(x...)))); err != nil {
+			t.Fatalf("Sending request %d failed: %v", i, err)
+		}
+		if resp == nil {
+			if resp = <-result; resp == nil {
+				return
+			}
+			defer resp.Body.Close()
+		}
+		msg, err := readMessage(resp.Body)
+		if err != nil {
+			t.Fatalf("Reading response %d failed: %v", i, err)
+		}
+		if got, want := sumOf(t, msg), []float32{4, 8, 9}[i]; got != want {
+			t.Errorf("Response %d: expected sum %v, got %v", i, want, got)
+		}
+	}
+	pw.Close()
+	if _, err := readMessage(resp.Body); err != io.EOF {
+		t.Errorf("Expected the stream to end after the requests, got %v", err)
+	}
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("Expected status 0, got %s", status)
+	}
+}
@@ -0,0 +1,125 @@
+package serve
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/sbl8/sublation/runtime"
+)
+
+// maxRequestBytes bounds the JSON body a predict request may send.
+const maxRequestBytes = 32 << 20
+
+// predictRequest is the JSON body of a REST predict call. Exactly one of
+// Inputs and InputB64 must be set.
+type predictRequest struct {
+	Inputs   []float32 `json:"inputs,omitempty"`
+	InputB64 string    `json:"input_b64,omitempty"` // Little-endian float32 buffer
+	Priority string    `json:"priority,omitempty"`  // runtime.ParsePriority name; empty is normal
+}
+
+// predictResponse answers in the encoding the request used.
+type predictResponse struct {
+	Outputs   []float32 `json:"outputs,omitempty"`
+	OutputB64 string    `json:"output_b64,omitempty"`
+}
+
+// NewHTTPHandler serves POST predict requests for engine. The body is a JSON
+// object holding either "inputs", an array of numbers, or "input_b64", a
+// base64 little-endian float32 buffer; the response carries "outputs" or
+// "output_b64" to match. The handler answers on every path, so it can be
+// mounted anywhere or placed directly behind a reverse proxy.
+func NewHTTPHandler(engine *runtime.Engine) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "predict requires POST"})
+			return
+		}
+
+		var req predictRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request body: %v", err)})
+			return
+		}
+		input, err := req.input()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		priority := runtime.PriorityNormal
+		if req.Priority != "" {
+			if priority, err = runtime.ParsePriority(req.Priority); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+		}
+
+		output := make([]byte, engine.OutputSize())
+		if err := engine.ExecuteStreamingPriority(priority, input, output); err != nil {
+			writeEngineError(w, err)
+			return
+		}
+
+		var resp predictResponse
+		if req.InputB64 != "" {
+			resp.OutputB64 = base64.StdEncoding.EncodeToString(output)
+		} else {
+			resp.Outputs = decodeFloats(output)
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// input returns the request payload as raw float32 bytes.
+func (r *predictRequest) input() ([]byte, error) {
+	switch {
+	case r.InputB64 != "" && r.Inputs != nil:
+		return nil, errors.New("set only one of inputs and input_b64")
+	case r.InputB64 != "":
+		b, err := base64.StdEncoding.DecodeString(r.InputB64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input_b64: %w", err)
+		}
+		if len(b)%4 != 0 {
+			return nil, fmt.Errorf("input_b64 holds %d bytes, not a whole number of float32 values", len(b))
+		}
+		return b, nil
+	default:
+		b := make([]byte, 4*len(r.Inputs))
+		for i, v := range r.Inputs {
+			binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(v))
+		}
+		return b, nil
+	}
+}
+
+// decodeFloats reads b as little-endian float32 values.
+func decodeFloats(b []byte) []float32 {
+	values := make([]float32, len(b)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return values
+}
+
+// writeEngineError maps execution errors onto HTTP status codes.
+func writeEngineError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, runtime.ErrInputTooLarge):
+		code = http.StatusRequestEntityTooLarge
+	case errors.Is(err, runtime.ErrInputTooShort):
+		code = http.StatusBadRequest
+	case errors.Is(err, runtime.ErrClosed):
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,60 @@
+package serve
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	t.Parallel()
+	s := newTestService(t, "m")
+	engine, _ := s.host.Engine("m")
+	h := NewHTTPHandler(engine)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"inputs": [1, 0.5, 0.75, 1]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var floats predictResponse
+	if err := json.NewDecoder(rec.Body).Decode(&floats); err != nil || len(floats.Outputs) != 16 {
+		t.Errorf("Expected 16 float outputs, got %d (err %v)", len(floats.Outputs), err)
+	}
+
+	raw := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	rec = post(`{"input_b64": "` + raw + `", "priority": "critical"}`)
+	var encoded predictResponse
+	if err := json.NewDecoder(rec.Body).Decode(&encoded); err != nil || encoded.Outputs != nil {
+		t.Fatalf("Expected a base64 response, got %+v (err %v)", encoded, err)
+	}
+	if out, err := base64.StdEncoding.DecodeString(encoded.OutputB64); err != nil || len(out) != 64 {
+		t.Errorf("Expected 64 output bytes, got %d (err %v)", len(out), err)
+	}
+
+	for _, body := range []string{
+		`not json`,
+		`{"input_b64": "AAA="}`,
+		`{"inputs": [1], "input_b64": "AAAAAA=="}`,
+		`{"inputs": [1], "priority": "urgent"}`,
+		`{"unknown": 1}`,
+	} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package serve
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errProto reports a malformed protobuf message.
+var errProto = errors.New("malformed protobuf message")
+
+// protoBuf appends protobuf fields to an encoded message.
+type protoBuf struct{ b []byte }
+
+// varint appends a varint field (wire type 0).
+func (p *protoBuf) varint(field int, v uint64) {
+	p.b = binary.AppendUvarint(p.b, uint64(field)<<3)
+	p.b = binary.AppendUvarint(p.b, v)
+}
+
+// bytes appends a length-delimited field (wire type 2).
+func (p *protoBuf) bytes(field int, b []byte) {
+	p.b = binary.AppendUvarint(p.b, uint64(field)<<3|2)
+	p.b = binary.AppendUvarint(p.b, uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+func (p *protoBuf) string(field int, s string) { p.bytes(field, []byte(s)) }
+
+func (p *protoBuf) message(field int, m *protoBuf) { p.bytes(field, m.b) }
+
+// protoField is one decoded field: v holds varints, data length-delimited
+// values.
+type protoField struct {
+	num  int
+	wire int
+	v    uint64
+	data []byte
+}
+
+// protoFields calls f for every field of the message b in order. Fixed
+// width fields, which no message of the service has, are skipped.
+func protoFields(b []byte, f func(protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 || key>>3 == 0 {
+			return errProto
+		}
+		b = b[n:]
+		field := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch field.wire {
+		case 0:
+			if field.v, n = binary.Uvarint(b); n <= 0 {
+				return errProto
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if field.wire == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return errProto
+			}
+			b = b[size:]
+			continue
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errProto
+			}
+			field.data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return fmt.Errorf("%w: wire type %d", errProto, field.wire)
+		}
+		if err := f(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wantWire checks that a known field has the wire type the schema gives it.
+func (f protoField) wantWire(wire int) error {
+	if f.wire != wire {
+		return fmt.Errorf("%w: field %d has wire type %d, want %d", errProto, f.num, f.wire, wire)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package serve exposes the models of a runtime.Host as an inference
+// service.
+//
+// Service answers Predict, BatchPredict, streaming Predict and health
+// requests as Go calls, routing each to a hosted model by name.
+// NewGRPCHandler serves it as the gRPC service of serve.proto, with the
+// standard health check, on net/http's HTTP/2 without generated bindings;
+// NewHTTPHandler serves one engine as a JSON REST endpoint, and
+// NewAdminHandler serves health and execution statistics over plain HTTP.
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sbl8/sublation/runtime"
+)
+
+// ErrUnknownModel is returned for requests naming a model the host does not serve.
+var ErrUnknownModel = errors.New("unknown model")
+
+// ErrNotServing is returned once the service has been drained.
+var ErrNotServing = errors.New("service not serving")
+
+// Request is one inference call.
+type Request struct {
+	Model    string           // Hosted model name; empty selects the only model
+	Priority runtime.Priority // QoS class the request is admitted in; zero is PriorityBatch
+	Input    []byte
+}
+
+// Response carries the output of one inference call.
+type Response struct {
+	Model  string
+	Output []byte
+}
+
+// HealthStatus is the serving state of the service or of one model.
+type HealthStatus int
+
+const (
+	// HealthUnknown is reported for models the host does not serve.
+	HealthUnknown HealthStatus = iota
+	// HealthServing means requests are being accepted.
+	HealthServing
+	// HealthNotServing means the service is draining or has no models.
+	HealthNotServing
+)
+
+// String returns the status name, spelled as health checkers expect.
+func (h HealthStatus) String() string {
+	switch h {
+	case HealthUnknown:
+		return "SERVICE_UNKNOWN"
+	case HealthServing:
+		return "SERVING"
+	case HealthNotServing:
+		return "NOT_SERVING"
+	default:
+		return fmt.Sprintf("HealthStatus(%d)", int(h))
+	}
+}
+
+// Service routes inference requests to the models of a Host.
+type Service struct {
+	host     *runtime.Host
+	draining atomic.Bool
+}
+
+// NewService creates a service over the models of host. Models added to the
+// host later are served as well.
+func NewService(host *runtime.Host) *Service {
+	return &Service{host: host}
+}
+
+// Models returns the served model names in sorted order.
+func (s *Service) Models() []string {
+	return s.host.Models()
+}
+
+// engine resolves a request's model name.
+func (s *Service) engine(name string) (string, *runtime.Engine, error) {
+	if s.draining.Load() {
+		return "", nil, ErrNotServing
+	}
+	if name == "" {
+		models := s.host.Models()
+		if len(models) != 1 {
+			return "", nil, fmt.Errorf("%w: model name required with %d models loaded", ErrUnknownModel, len(models))
+		}
+		name = models[0]
+	}
+	e, ok := s.host.Engine(name)
+	if !ok {
+		return "", nil, fmt.Errorf("%w %q", ErrUnknownModel, name)
+	}
+	return name, e, nil
+}
+
+// Predict runs one request on its model.
+func (s *Service) Predict(ctx context.Context, req Request) (Response, error) {
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+	name, e, err := s.engine(req.Model)
+	if err != nil {
+		return Response{}, err
+	}
+	output := make([]byte, e.OutputSize())
+	if err := e.ExecuteStreamingPriority(req.Priority, req.Input, output); err != nil {
+		return Response{}, fmt.Errorf("model %q: %w", name, err)
+	}
+	return Response{Model: name, Output: output}, nil
+}
+
+// BatchPredict runs the requests concurrently, at most as many at once as
+// the host has workers, and returns the responses in request order.
+// Requests for the same model are still serialized by its engine. The first
+// error fails the batch; requests not yet started are then skipped.
+func (s *Service) BatchPredict(ctx context.Context, reqs []Request) ([]Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resps := make([]Response, len(reqs))
+	var (
+		fail  sync.Once
+		first error
+	)
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := min(len(reqs), s.host.Workers()); w > 0; w-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				resp, err := s.Predict(ctx, reqs[i])
+				if err != nil {
+					fail.Do(func() {
+						first = fmt.Errorf("request %d: %w", i, err)
+						cancel()
+					})
+				}
+				resps[i] = resp
+			}
+		}()
+	}
+	for i := range reqs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if first != nil {
+		return nil, first
+	}
+	return resps, nil
+}
+
+// PredictStream answers requests from in on out, in order, until in is
+// closed or ctx ends. It returns the first failing request's error.
+func (s *Service) PredictStream(ctx context.Context, in <-chan Request, out chan<- Response) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case req, ok := <-in:
+			if !ok {
+				return nil
+			}
+			resp, err := s.Predict(ctx, req)
+			if err != nil {
+				return err
+			}
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Health reports the serving state of model, or of the whole service when
+// model is empty.
+func (s *Service) Health(model string) HealthStatus {
+	if model != "" {
+		if _, ok := s.host.Engine(model); !ok {
+			return HealthUnknown
+		}
+	} else if len(s.host.Models()) == 0 {
+		return HealthNotServing
+	}
+	if s.draining.Load() {
+		return HealthNotServing
+	}
+	return HealthServing
+}
+
+// Stats returns the execution statistics of model.
+func (s *Service) Stats(model string) (runtime.ExecutionStats, error) {
+	e, ok := s.host.Engine(model)
+	if !ok {
+		return runtime.ExecutionStats{}, fmt.Errorf("%w %q", ErrUnknownModel, model)
+	}
+	return e.Stats(), nil
+}
+
+// Drain marks the service not serving; later requests fail with
+// ErrNotServing while those in flight complete. Health checks report
+// NOT_SERVING so load balancers stop routing before the host is closed.
+func (s *Service) Drain() {
+	s.draining.Store(true)
+}
@@ -0,0 +1,180 @@
+package serve
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+func testGraph() *model.Graph {
+	return &model.Graph{
+		Payload: make([]byte, 128),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+		},
+	}
+}
+
+// newTestService serves the named test models from one host.
+func newTestService(t *testing.T, names ...string) *Service {
+	t.Helper()
+	host := runtime.NewHost(&runtime.HostOptions{Workers: 2, EnableStats: true, Streaming: true})
+	t.Cleanup(func() { host.Close(context.Background()) })
+	for _, name := range names {
+		if err := host.Add(name, testGraph()); err != nil {
+			t.Fatalf("Add(%q) failed: %v", name, err)
+		}
+	}
+	return NewService(host)
+}
+
+func TestPredictRouting(t *testing.T) {
+	t.Parallel()
+	s := newTestService(t, "a", "b")
+	ctx := context.Background()
+
+	resp, err := s.Predict(ctx, Request{Model: "b", Priority: runtime.PriorityNormal, Input: make([]byte, 16)})
+	if err != nil {
+		t.Fatalf("Predict failed: %v", err)
+	}
+	if resp.Model != "b" || len(resp.Output) != 64 {
+		t.Errorf("Expected 64 output bytes from b, got %d from %q", len(resp.Output), resp.Model)
+	}
+
+	if _, err := s.Predict(ctx, Request{Model: "missing"}); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("Expected ErrUnknownModel, got %v", err)
+	}
+	if _, err := s.Predict(ctx, Request{}); !errors.Is(err, ErrUnknownModel) {
+		t.Errorf("Expected an unnamed request to be ambiguous with two models, got %v", err)
+	}
+
+	if stats, err := s.Stats("b"); err != nil || stats.TotalExecutions != 1 {
+		t.Errorf("Expected 1 execution of b, got %d (err %v)", stats.TotalExecutions, err)
+	}
+}
+
+func TestBatchAndStreamPredict(t *testing.T) {
+	t.Parallel()
+	s := newTestService(t, "only")
+	ctx := context.Background()
+
+	reqs := make([]Request, 5)
+	resps, err := s.BatchPredict(ctx, reqs)
+	if err != nil {
+		t.Fatalf("BatchPredict failed: %v", err)
+	}
+	for i, resp := range resps {
+		if resp.Model != "only" {
+			t.Errorf("Response %d: expected model only, got %q", i, resp.Model)
+		}
+	}
+
+	in, out := make(chan Request), make(chan Response, 3)
+	go func() {
+		for i := 0; i < 3; i++ {
+			in <- Request{Input: make([]byte, 8)}
+		}
+		close(in)
+	}()
+	if err := s.PredictStream(ctx, in, out); err != nil {
+		t.Fatalf("PredictStream failed: %v", err)
+	}
+	if len(out) != 3 {
+		t.Errorf("Expected 3 streamed responses, got %d", len(out))
+	}
+}
+
+func TestBatchPredictLargeBatch(t *testing.T) {
+	t.Parallel()
+	host := runtime.NewHost(&runtime.HostOptions{Workers: 2, Streaming: true})
+	t.Cleanup(func() { host.Close(context.Background()) })
+	if err := host.Add("sum", sumGraph()); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	s := NewService(host)
+	ctx := context.Background()
+
+	// Far more requests than workers, answered in request order
+	reqs := make([]Request, 64)
+	for i := range reqs {
+		reqs[i].Input = float32Bytes(float32(i), -1, 0, 0)
+	}
+	resps, err := s.BatchPredict(ctx, reqs)
+	if err != nil {
+		t.Fatalf("BatchPredict failed: %v", err)
+	}
+	for i, resp := range resps {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(resp.Output)); got != float32(i) {
+			t.Errorf("Response %d: expected sum %d, got %v", i, i, got)
+		}
+	}
+
+	reqs[40].Input = nil
+	if _, err := s.BatchPredict(ctx, reqs); !errors.Is(err, runtime.ErrInputTooShort) || !strings.HasPrefix(err.Error(), "request 40:") {
+		t.Errorf("Expected request 40 to fail the batch with ErrInputTooShort, got %v", err)
+	}
+}
+
+func TestHealthAndDrain(t *testing.T) {
+	t.Parallel()
+	if got := newTestService(t).Health(""); got != HealthNotServing {
+		t.Errorf("Expected NOT_SERVING without models, got %v", got)
+	}
+
+	s := newTestService(t, "m")
+	if got := s.Health("m"); got != HealthServing {
+		t.Errorf("Expected SERVING, got %v", got)
+	}
+	if got := s.Health("missing"); got != HealthUnknown {
+		t.Errorf("Expected SERVICE_UNKNOWN, got %v", got)
+	}
+
+	s.Drain()
+	if got := s.Health(""); got != HealthNotServing {
+		t.Errorf("Expected NOT_SERVING after Drain, got %v", got)
+	}
+	if _, err := s.Predict(context.Background(), Request{}); !errors.Is(err, ErrNotServing) {
+		t.Errorf("Expected ErrNotServing after Drain, got %v", err)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	t.Parallel()
+	s := newTestService(t, "m")
+	h := NewAdminHandler(s)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("Expected healthz 200, got %d", rec.Code)
+	}
+	if rec := get("/healthz?model=missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected healthz 404 for unknown model, got %d", rec.Code)
+	}
+
+	var models struct{ Models []string }
+	if err := json.NewDecoder(get("/v1/models").Body).Decode(&models); err != nil || len(models.Models) != 1 {
+		t.Errorf("Expected one model, got %v (err %v)", models.Models, err)
+	}
+
+	if rec := get("/v1/models/m/stats"); rec.Code != http.StatusOK {
+		t.Errorf("Expected stats 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := get("/v1/models/missing/stats"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected stats 404 for unknown model, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// shapeGraph feeds a [2, 3] input through relu into a 2x3 by 3x4 matmul
+// whose header and operands fill the first 80 payload bytes, then sums it
+func shapeGraph(cols uint16) *model.Graph {
+	payload := make([]byte, 96)
+	binary.LittleEndian.PutUint16(payload[0:], 2)
+	binary.LittleEndian.PutUint16(payload[2:], cols)
+	binary.LittleEndian.PutUint16(payload[4:], 4)
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 0, Kernel: kernels.OpNoop},
+			{ID: 1, Kernel: kernels.OpReLU, Topo: []uint32{0}},
+			{ID: 2, Kernel: kernels.OpMatMul, In: 0, Out: 80, Topo: []uint32{1}},
+			{ID: 3, Kernel: kernels.OpSum, Topo: []uint32{2}},
+		},
+		IO: []model.IOSpec{
+			{Name: "x", Kind: model.Input, NodeID: 0, Shape: []int{2, 3}},
+			{Name: "y", Kind: model.Output, NodeID: 3, Shape: []int{1}},
+		},
+	}
+}
+
+func TestInferShapes(t *testing.T) {
+	t.Parallel()
+	graph := shapeGraph(3)
+	if err := graph.InferShapes(); err != nil {
+		t.Fatalf("InferShapes failed: %v", err)
+	}
+	want := map[uint32][]int{0: {2, 3}, 1: {2, 3}, 2: {2, 4}, 3: {1}}
+	if !maps.EqualFunc(graph.Shapes, want, slices.Equal) {
+		t.Errorf("Expected shapes %v, got %v", want, graph.Shapes)
+	}
+	if inputs, ok := graph.InputShapes(2); !ok || len(inputs) != 1 || !slices.Equal(inputs[0], []int{2, 3}) {
+		t.Errorf("Expected node 2 to consume [2 3], got %v", inputs)
+	}
+
+	// Shapes survive both encodings and size node buffers
+	data, err := graph.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if g, err := model.Deserialize(data); err != nil || !maps.EqualFunc(g.Shapes, want, slices.Equal) {
+		t.Errorf("Expected shapes to round-trip, got %v (%v)", g.Shapes, err)
+	}
+	gob, err := graph.SerializeGob()
+	if err != nil {
+		t.Fatalf("SerializeGob failed: %v", err)
+	}
+	if g, err := model.DeserializeGob(gob); err != nil || !maps.EqualFunc(g.Shapes, want, slices.Equal) {
+		t.Errorf("Expected shapes to round-trip through gob, got %v (%v)", g.Shapes, err)
+	}
+	// The sum reads the 2x4 product packed into its buffer
+	for i, size := range []int{24, 24, 80, 32} {
+		if got := calculateNodePayloadSize(&graph.Nodes[i], graph); got != size {
+			t.Errorf("node %d: expected a %d byte buffer, got %d", i, size, got)
+		}
+	}
+	engine, err := NewEngine(graph, &EngineOptions{ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if size := len(engine.sublates[0].PayloadProp); size != 64 {
+		t.Errorf("Expected the input node buffer to be one cache line, got %d bytes", size)
+	}
+
+	mismatched := shapeGraph(4)
+	if err := mismatched.InferShapes(); err == nil || !strings.Contains(err.Error(), "node 2 (matmul)") {
+		t.Errorf("Expected a matmul operand mismatch, got %v", err)
+	}
+	wrongOutput := shapeGraph(3)
+	wrongOutput.IO[1].Shape = []int{2}
+	if err := wrongOutput.InferShapes(); err == nil || !strings.Contains(err.Error(), `output "y"`) {
+		t.Errorf("Expected an output size mismatch, got %v", err)
+	}
+
+	// The compiler rejects fan-in of differently shaped tensors
+	src := filepath.Join(t.TempDir(), "m.subs")
+	spec := "node 0 3 0 32\nnode 1 3 32 48\nnode 2 6 0 0 <- 0 1\npayload " + strings.Repeat("00", 64) + "\n"
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	_, err = compiler.CompileWithOptions(src, src+"l", compiler.DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "shape error") {
+		t.Errorf("Expected a shape error, got %v", err)
+	}
+}
+
+func TestSegmentNodeBufferSize(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload:  make([]byte, 96),
+		Segments: []model.Segment{{ID: 2, Offset: 32, Length: 64, DType: model.Float32, Role: model.RoleActivation}},
+		Nodes:    []model.Node{{ID: 1, Kernel: kernels.OpReLU, In: 32, Out: 96, Segment: 2}},
+	}
+	if size := calculateNodePayloadSize(&graph.Nodes[0], graph); size != 64 {
+		t.Errorf("Expected the 64 byte segment as the buffer of node 1, got %d", size)
+	}
+}
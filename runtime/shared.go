@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+)
+
+// bufferOwners returns, for every node index, the index of the node whose
+// Prev and Prop buffers it uses: itself, or for a node flagged
+// core.FlagShared the first node in graph order with the same segment.
+func bufferOwners(graph *model.Graph) []int {
+	owners := make([]int, len(graph.Nodes))
+	first := make(map[[2]uint32]int)
+	for i, n := range graph.Nodes {
+		owners[i] = i
+		if n.Flags&core.FlagShared == 0 {
+			continue
+		}
+		key := [2]uint32{n.In, n.Out}
+		if j, ok := first[key]; ok {
+			owners[i] = j
+		} else {
+			first[key] = i
+		}
+	}
+	return owners
+}
+
+// setupTied records the nodes that share buffers, so commits of one node
+// of a tied group keep the buffers of the others in step. It must run
+// after initializeSublates aliased the buffers.
+func (e *Engine) setupTied() {
+	groups := make(map[int][]int)
+	for i, owner := range bufferOwners(e.graph) {
+		if e.graph.Nodes[i].Flags&core.FlagShared != 0 {
+			groups[owner] = append(groups[owner], i)
+		}
+	}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		if e.tied == nil {
+			e.tied = make([][]int, len(e.graph.Nodes))
+		}
+		for _, i := range group {
+			e.tied[i] = group
+		}
+	}
+}
+
+// syncTied points every node tied to node i at its buffers after a swap
+func (e *Engine) syncTied(i int, sublate *core.Sublate) {
+	if e.tied == nil {
+		return
+	}
+	for _, j := range e.tied[i] {
+		if s := e.sublates[j]; s != nil && j != i {
+			s.PayloadPrev, s.PayloadProp = sublate.PayloadPrev, sublate.PayloadProp
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+)
+
+func TestTiedPayloads(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	compile := func(spec string) (*model.Graph, error) {
+		src, out := filepath.Join(dir, "m.subs"), filepath.Join(dir, "m.subl")
+		if err := os.WriteFile(src, []byte(spec+"payload "+strings.Repeat("00", 96)+"\n"), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := compiler.Compile(src, out); err != nil {
+			return nil, err
+		}
+		return ReadGraph(out, nil)
+	}
+
+	// An embedding whose weights the output projection reuses
+	graph, err := compile("node 0 1 0 32\nnode 1 3 32 64 <- 0\nnode 2 1 0 0 <- 1\ntie 0 2\n")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	segs := graph.SharedSegments()
+	if len(segs) != 1 || segs[0].In != 0 || segs[0].Out != 32 || segs[0].Refs() != 2 || !slices.Equal(segs[0].Nodes, []uint32{0, 2}) {
+		t.Fatalf("Expected one segment [0, 32) shared by nodes 0 and 2, got %+v", segs)
+	}
+
+	untied := &model.Graph{Nodes: slices.Clone(graph.Nodes), Payload: graph.Payload}
+	for i := range untied.Nodes {
+		untied.Nodes[i].Flags &^= core.FlagShared
+	}
+	if tied, plain := nodePayloadDemand(graph), nodePayloadDemand(untied); tied != plain-2*core.AlignedSize(32) {
+		t.Errorf("Expected tying to save one buffer pair, got %d bytes against %d", tied, plain)
+	}
+
+	for _, speculative := range []bool{false, true} {
+		engine, err := NewEngine(graph, &EngineOptions{ArenaSize: 1 << 16, Speculative: speculative})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		index := make(map[uint32]int)
+		for i, n := range engine.Graph().Nodes {
+			index[n.ID] = i
+		}
+		a, b := engine.sublates[index[0]], engine.sublates[index[2]]
+		for run := 0; run < 3; run++ {
+			if &a.PayloadPrev[0] != &b.PayloadPrev[0] || &a.PayloadProp[0] != &b.PayloadProp[0] {
+				t.Fatalf("speculative %v, run %d: expected tied nodes to share buffers", speculative, run)
+			}
+			if err := engine.Run(); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+		}
+	}
+
+	for _, tc := range []struct{ spec, want string }{
+		{"node 0 1 0 32\nnode 1 1 32 64\ntie 0 5\n", "undefined node 5"},
+		{"node 0 1 0 32\nnode 1 1 0 0\nnode 2 1 0 0\ntie 0 1\ntie 2 0\n", "tied more than once"},
+		{"node 0 1 0 32\nnode 1 1 32 64\ntie 0 1\n", "differs"},
+		{"node 0 1 0 32\ntie 0\n", "at least two"},
+		{"node 0 1 0 0\nnode 1 1 0 0\ntie 0 1\n", "empty payload range"},
+	} {
+		if _, err := compile(tc.spec); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected an error containing %q, got %v", tc.spec, tc.want, err)
+		}
+	}
+
+	overlap := &model.Graph{
+		Payload: make([]byte, 96),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 32, Flags: core.FlagShared},
+			{ID: 1, Kernel: 1, In: 16, Out: 48, Flags: core.FlagShared},
+		},
+	}
+	if err := overlap.Validate(); err == nil {
+		t.Error("Expected Validate to reject partially overlapping shared segments")
+	}
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package runtime
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// shmDir is where Linux exposes POSIX shared memory objects (shm_open).
+const shmDir = "/dev/shm"
+
+// mapSharedMemory creates the POSIX shared memory object name, sizes it to
+// length bytes and maps it shared. The returned function unmaps and unlinks it.
+func mapSharedMemory(name string, length int) ([]byte, func() error, error) {
+	path := filepath.Join(shmDir, name)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(int64(length)); err != nil {
+		_ = os.Remove(path)
+		return nil, nil, err
+	}
+	buf, err := syscall.Mmap(int(f.Fd()), 0, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, nil, err
+	}
+
+	return buf, func() error {
+		return errors.Join(syscall.Munmap(buf), os.Remove(path))
+	}, nil
+}
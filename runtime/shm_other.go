@@ -0,0 +1,8 @@
+//go:build !linux
+
+package runtime
+
+// mapSharedMemory is not available outside Linux.
+func mapSharedMemory(name string, length int) ([]byte, func() error, error) {
+	return nil, nil, errSharedMemoryUnsupported
+}
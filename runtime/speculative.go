@@ -0,0 +1,64 @@
+package runtime
+
+import (
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+)
+
+// Validator decides whether the output a node proposed in PayloadProp may
+// be committed. It must not retain or modify proposal.
+type Validator func(nodeID uint32, proposal []byte) bool
+
+// SpeculationStats counts the commit decisions made for one node.
+type SpeculationStats struct {
+	Accepted int64
+	Rejected int64
+}
+
+// FiniteValidator accepts proposals whose float32 values are all finite.
+func FiniteValidator(_ uint32, proposal []byte) bool {
+	return kernels.FirstNonFinite(asFloat32(proposal)) < 0
+}
+
+// commit finishes node i after its kernel ran into PayloadProp. Outside
+// speculative mode the proposal is always committed with SwapBuffers. In
+// speculative mode a proposal the validator rejects is rolled back instead:
+// PayloadProp is restored from the committed PayloadPrev, so the node keeps
+// the output of its last accepted execution.
+func (e *Engine) commit(i int, sublate *core.Sublate) {
+	if !e.opts.Speculative {
+		sublate.SwapBuffers()
+		e.syncTied(i, sublate)
+		return
+	}
+
+	validate := e.opts.Validator
+	if validate == nil {
+		validate = FiniteValidator
+	}
+	id := e.graph.Nodes[i].ID
+	accepted := validate(id, sublate.PayloadProp)
+
+	if accepted {
+		sublate.SwapBuffers()
+		e.syncTied(i, sublate)
+	} else {
+		copy(sublate.PayloadProp, sublate.PayloadPrev)
+		// The output did not change, so dependents need not rerun for it,
+		// but the recorded input must not let the node skip its next run.
+		sublate.ClearFlag(core.FlagDirty)
+		if e.memo != nil {
+			e.memo.forget(i)
+		}
+	}
+
+	e.mu.Lock()
+	s := e.stats.Speculation[id]
+	if accepted {
+		s.Accepted++
+	} else {
+		s.Rejected++
+	}
+	e.stats.Speculation[id] = s
+	e.mu.Unlock()
+}
@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// overflowGraph feeds node 0 values the square-plus-x kernel overflows to
+// +Inf, and node 1 small values that stay finite.
+func overflowGraph() *model.Graph {
+	payload := make([]byte, 128)
+	for i := 0; i < 16; i++ {
+		binary.LittleEndian.PutUint32(payload[i*4:], math.Float32bits(1e30))
+		binary.LittleEndian.PutUint32(payload[64+i*4:], math.Float32bits(0.5))
+	}
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128},
+		},
+	}
+}
+
+func TestFiniteValidator(t *testing.T) {
+	t.Parallel()
+	buf := make([]byte, 12)
+	if !FiniteValidator(0, buf) {
+		t.Error("Expected zeros to be accepted")
+	}
+	for _, v := range []float32{float32(math.NaN()), float32(math.Inf(1)), float32(math.Inf(-1))} {
+		binary.LittleEndian.PutUint32(buf[8:], math.Float32bits(v))
+		if FiniteValidator(0, buf) {
+			t.Errorf("Expected %v to be rejected", v)
+		}
+	}
+}
+
+func TestSpeculativeRollback(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(overflowGraph(), &EngineOptions{
+		Workers:     1,
+		ArenaSize:   1 << 16,
+		Speculative: true,
+		DisableMemo: true,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	// The first run reads values node 0 keeps finite and commits; the
+	// second reads the overflowing graph payload again.
+	payload := engine.modelPayload(engine.arena)
+	copy(payload[:64], payload[64:])
+	if err := engine.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	committed := append([]byte(nil), engine.sublates[0].PayloadPrev...)
+	copy(payload, engine.graph.Payload)
+	if err := engine.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	bad, good := engine.sublates[0], engine.sublates[1]
+	if !bytes.Equal(bad.PayloadPrev, committed) || !bytes.Equal(bad.PayloadProp, committed) {
+		t.Error("Expected the rejected node to keep its committed output in both buffers")
+	}
+	if got := good.AsFloat32Prev()[0]; got != 0.75 {
+		t.Errorf("Expected the accepted node to commit 0.75, got %v", got)
+	}
+
+	stats := engine.Stats()
+	if s := stats.Speculation[0]; s.Accepted != 1 || s.Rejected != 1 {
+		t.Errorf("Expected node 0 accepted then rejected, got %+v", s)
+	}
+	if s := stats.Speculation[1]; s.Accepted != 2 || s.Rejected != 0 {
+		t.Errorf("Expected node 1 accepted twice, got %+v", s)
+	}
+}
+
+func TestSpeculativeCustomValidator(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(chainGraph(), &EngineOptions{
+		Workers:     1,
+		ArenaSize:   1 << 16,
+		Speculative: true,
+		DisableMemo: true,
+		Validator:   func(id uint32, _ []byte) bool { return id != 2 },
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := engine.Run(); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	}
+
+	stats := engine.Stats()
+	want := map[uint32]SpeculationStats{0: {Accepted: 3}, 1: {Accepted: 3}, 2: {Rejected: 3}}
+	for id, w := range want {
+		if got := stats.Speculation[id]; got != w {
+			t.Errorf("Expected node %d stats %+v, got %+v", id, w, got)
+		}
+	}
+}
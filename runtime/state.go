@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sbl8/sublation/core"
+)
+
+const (
+	stateMagic   = 0x53425553 // "SUBS" in little endian
+	stateVersion = 2
+)
+
+// engineState is the gob-encoded body of a state snapshot.
+type engineState struct {
+	Sublates [][]byte // core.SerializeSublate output, one per node
+	Stats    ExecutionStats
+
+	StreamRead, StreamWrite uint64 // Streaming ring cursors
+	StreamBuffered          []byte // Bytes written to the ring but not yet consumed
+}
+
+// SaveState writes a snapshot of every sublate payload, the streaming ring
+// and the execution stats to w. It waits for queued streaming requests, so
+// the snapshot falls between executions. Restoring it with LoadState in a new
+// engine for the same model resumes a stream where this one stopped.
+func (e *Engine) SaveState(w io.Writer) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	e.admission.acquire(PriorityCritical)
+	defer e.admission.release()
+
+	state := engineState{
+		Sublates: make([][]byte, len(e.sublates)),
+		Stats:    e.Stats(),
+	}
+	for i, s := range e.sublates {
+		if s == nil {
+			continue
+		}
+		b, err := core.SerializeSublate(s)
+		if err != nil {
+			return fmt.Errorf("failed to serialize sublate %d: %w", i, err)
+		}
+		state.Sublates[i] = b
+	}
+	if e.arena != nil && e.arena.streamingInput.Size > 0 {
+		state.StreamRead, state.StreamWrite = uint64(e.arena.streamRead), uint64(e.arena.streamWrite)
+		first, second := e.arena.StreamPeek()
+		state.StreamBuffered = append(append([]byte(nil), first...), second...)
+	}
+
+	header := [6]byte{}
+	binary.LittleEndian.PutUint32(header[0:], stateMagic)
+	binary.LittleEndian.PutUint16(header[4:], stateVersion)
+	if _, err := w.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to write state header: %w", err)
+	}
+	if err := gob.NewEncoder(w).Encode(&state); err != nil {
+		return fmt.Errorf("failed to encode engine state: %w", err)
+	}
+	return nil
+}
+
+// LoadState restores a snapshot written by SaveState. The engine must run the
+// same model: node count, kernels and payload sizes are checked before
+// anything is overwritten.
+func (e *Engine) LoadState(r io.Reader) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	e.admission.acquire(PriorityCritical)
+	defer e.admission.release()
+
+	header := [6]byte{}
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("failed to read state header: %w", err)
+	}
+	if magic := binary.LittleEndian.Uint32(header[0:]); magic != stateMagic {
+		return fmt.Errorf("invalid state magic number: %x", magic)
+	}
+	if version := binary.LittleEndian.Uint16(header[4:]); version != stateVersion {
+		return fmt.Errorf("unsupported state version %d", version)
+	}
+
+	var state engineState
+	if err := gob.NewDecoder(r).Decode(&state); err != nil {
+		return fmt.Errorf("failed to decode engine state: %w", err)
+	}
+
+	restored, err := e.checkState(&state)
+	if err != nil {
+		return err
+	}
+
+	for i, s := range restored {
+		if s == nil {
+			continue
+		}
+		dst := e.sublates[i]
+		copy(dst.PayloadPrev, s.PayloadPrev)
+		copy(dst.PayloadProp, s.PayloadProp)
+		dst.Flags = s.Flags
+	}
+	if e.arena != nil && e.arena.streamingInput.Size > 0 {
+		// Rewrite the unconsumed bytes at their original ring positions
+		e.arena.streamRead = uintptr(state.StreamRead)
+		e.arena.streamWrite = uintptr(state.StreamRead)
+		e.arena.StreamWrite(state.StreamBuffered)
+	}
+	if e.memo != nil {
+		e.memo.reset()
+	}
+
+	e.mu.Lock()
+	e.stats = state.Stats
+	if e.stats.KernelExecutions == nil {
+		e.stats.KernelExecutions = make(map[uint8]int64)
+	}
+	if e.stats.ClassLatency == nil {
+		e.stats.ClassLatency = make(map[Priority]LatencyHistogram)
+	}
+	if e.stats.Stragglers == nil {
+		e.stats.Stragglers = make(map[uint32]int64)
+	}
+	if e.stats.Speculation == nil {
+		e.stats.Speculation = make(map[uint32]SpeculationStats)
+	}
+	e.mu.Unlock()
+	return nil
+}
+
+// checkState decodes the snapshot sublates and verifies they fit this engine.
+func (e *Engine) checkState(state *engineState) ([]*core.Sublate, error) {
+	if len(state.Sublates) != len(e.sublates) {
+		return nil, fmt.Errorf("state has %d nodes, engine has %d", len(state.Sublates), len(e.sublates))
+	}
+	if e.arena != nil && len(state.StreamBuffered) > int(e.arena.streamingInput.Size) {
+		return nil, &InputTooLargeError{Size: len(state.StreamBuffered), Limit: int(e.arena.streamingInput.Size)}
+	}
+
+	restored := make([]*core.Sublate, len(state.Sublates))
+	for i, b := range state.Sublates {
+		dst := e.sublates[i]
+		if (b == nil) != (dst == nil) {
+			return nil, fmt.Errorf("state and engine disagree on sublate %d", i)
+		}
+		if b == nil {
+			continue
+		}
+		s, err := core.DeserializeSublate(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode sublate %d: %w", i, err)
+		}
+		if s.KernelID != dst.KernelID || len(s.PayloadPrev) != len(dst.PayloadPrev) || len(s.PayloadProp) != len(dst.PayloadProp) {
+			return nil, errors.New("state was saved from a different model")
+		}
+		restored[i] = s
+	}
+	return restored, nil
+}
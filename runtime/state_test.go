@@ -0,0 +1,67 @@
+package runtime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestSaveLoadState(t *testing.T) {
+	t.Parallel()
+	newEngine := func(graph *model.Graph) *Engine {
+		engine, err := NewEngine(graph, &EngineOptions{
+			Workers:     1,
+			ArenaSize:   1 << 16,
+			EnableStats: true,
+			Streaming:   true,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		return engine
+	}
+
+	original := newEngine(memoGraph())
+	for i := 0; i < 3; i++ {
+		if err := original.ExecuteStreaming([]byte{1, 2, 3}, nil); err != nil {
+			t.Fatalf("ExecuteStreaming failed: %v", err)
+		}
+	}
+	original.arena.StreamWrite([]byte("pending"))
+
+	var snapshot bytes.Buffer
+	if err := original.SaveState(&snapshot); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	restored := newEngine(memoGraph())
+	if err := restored.LoadState(bytes.NewReader(snapshot.Bytes())); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if got := restored.Stats().TotalExecutions; got != 3 {
+		t.Errorf("Expected 3 restored executions, got %d", got)
+	}
+	if first, _ := restored.arena.StreamPeek(); string(first) != "pending" {
+		t.Errorf("Expected buffered stream input to survive, got %q", first)
+	}
+
+	for i := 0; i < 2; i++ {
+		_ = original.Run()
+		_ = restored.Run()
+	}
+	for i := range original.sublates {
+		a, b := original.sublates[i], restored.sublates[i]
+		if !bytes.Equal(a.PayloadProp, b.PayloadProp) || !bytes.Equal(a.PayloadPrev, b.PayloadPrev) {
+			t.Errorf("Node %d diverged after restore", i)
+		}
+	}
+
+	other := newEngine(unorderedGraph())
+	if err := other.LoadState(bytes.NewReader(snapshot.Bytes())); err == nil {
+		t.Error("Expected error restoring state from a different model")
+	}
+	if err := other.LoadState(bytes.NewReader([]byte("garbage!"))); err == nil {
+		t.Error("Expected error for a corrupt snapshot")
+	}
+}
@@ -0,0 +1,120 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+)
+
+// Stepper runs the resident graph of an engine one node at a time, in the
+// order Run executes them, for interactive debuggers. Every step runs the
+// node's kernel, bypassing output reuse, and commits it like Run does.
+// The engine must not execute anything else while a stepper is in use.
+type Stepper struct {
+	e   *Engine
+	pos int // Position of the next node in the execution order
+}
+
+// NewStepper returns a stepper positioned before the first node
+func (e *Engine) NewStepper() *Stepper {
+	return &Stepper{e: e}
+}
+
+// Order returns the IDs of the nodes in the order Step runs them
+func (s *Stepper) Order() []uint32 {
+	ids := make([]uint32, len(s.e.sublates))
+	for k := range ids {
+		ids[k] = s.e.graph.Nodes[s.e.nodeIndex(k)].ID
+	}
+	return ids
+}
+
+// Next returns the ID of the node Step runs next, or false once every
+// node has run
+func (s *Stepper) Next() (uint32, bool) {
+	if s.pos >= len(s.e.sublates) {
+		return 0, false
+	}
+	return s.e.graph.Nodes[s.e.nodeIndex(s.pos)].ID, true
+}
+
+// Step runs the next node and returns its ID, or io.EOF once every node
+// has run
+func (s *Stepper) Step() (uint32, error) {
+	if s.pos >= len(s.e.sublates) {
+		return 0, io.EOF
+	}
+	if err := s.e.enter(); err != nil {
+		return 0, err
+	}
+	defer s.e.exit()
+
+	if s.pos == 0 && s.e.opts.Deterministic {
+		s.e.reseed()
+	}
+	i := s.e.nodeIndex(s.pos)
+	id := s.e.graph.Nodes[i].ID
+	if sublate := s.e.sublates[i]; sublate != nil {
+		if err := s.e.executeSublate(i, sublate, s.e.modelPayload(s.e.arena)); err != nil {
+			return id, err
+		}
+		s.e.commit(i, sublate)
+	}
+	s.pos++
+	return id, nil
+}
+
+// Continue runs the remaining nodes
+func (s *Stepper) Continue() error {
+	for {
+		if _, err := s.Step(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Reset positions the stepper before the first node again, keeping the
+// node buffers as they are
+func (s *Stepper) Reset() {
+	s.pos = 0
+}
+
+// NodeBuffers returns the resident buffers of node id: prev holds the
+// last committed output, prop what the next run of the kernel starts from.
+// They alias the arena and change with every execution.
+func (e *Engine) NodeBuffers(id uint32) (prev, prop []byte, err error) {
+	for i, n := range e.graph.Nodes {
+		if n.ID != id {
+			continue
+		}
+		if e.sublates[i] == nil {
+			return nil, nil, fmt.Errorf("node %d has no sublate", id)
+		}
+		return e.sublates[i].PayloadPrev, e.sublates[i].PayloadProp, nil
+	}
+	return nil, nil, fmt.Errorf("node %d not in graph", id)
+}
+
+// SetNodeData copies data into both resident buffers of node id and into
+// its payload segment in the resident arena, so the node reads as data and
+// its kernel next runs on it. Nodes sharing the buffers through a tied
+// segment see it too.
+func (e *Engine) SetNodeData(id uint32, data []byte) error {
+	prev, prop, err := e.NodeBuffers(id)
+	if err != nil {
+		return err
+	}
+	if len(data) > len(prev) || len(data) > len(prop) {
+		return fmt.Errorf("%d bytes do not fit the %d-byte buffers of node %d", len(data), min(len(prev), len(prop)), id)
+	}
+	copy(prev, data)
+	copy(prop, data)
+	for i := range e.graph.Nodes {
+		if e.graph.Nodes[i].ID == id {
+			copy(nodeSegment(&e.graph.Nodes[i], e.modelPayload(e.arena)), data)
+			break
+		}
+	}
+	return nil
+}
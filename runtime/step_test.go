@@ -0,0 +1,78 @@
+package runtime
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestStepper(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(memoGraph(), &EngineOptions{Workers: 1, ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	floats := func(b []byte, n int) []float32 {
+		out := make([]float32, n)
+		for i := range out {
+			out[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+		return out
+	}
+
+	input := make([]byte, 8)
+	binary.LittleEndian.PutUint32(input, math.Float32bits(1))
+	binary.LittleEndian.PutUint32(input[4:], math.Float32bits(2))
+	if err := engine.SetNodeData(0, input); err != nil {
+		t.Fatalf("SetNodeData failed: %v", err)
+	}
+	prev1, _, err := engine.NodeBuffers(1)
+	if err != nil {
+		t.Fatalf("NodeBuffers failed: %v", err)
+	}
+	before := floats(prev1, 2)
+
+	s := engine.NewStepper()
+	order := s.Order()
+	sorted := slices.Clone(order)
+	slices.Sort(sorted)
+	if order[0] != 0 || !slices.Equal(sorted, []uint32{0, 1, 2}) {
+		t.Errorf("Order = %v, want every node, node 0 first", order)
+	}
+	if id, ok := s.Next(); !ok || id != 0 {
+		t.Fatalf("Next = %d, %t, want node 0", id, ok)
+	}
+	if id, err := s.Step(); err != nil || id != 0 {
+		t.Fatalf("Step = %d, %v, want node 0", id, err)
+	}
+	prev0, _, _ := engine.NodeBuffers(0)
+	if got := floats(prev0, 2); got[0] != 2 || got[1] != 6 {
+		t.Errorf("node 0 after one step = %v, want x*x+x of [1 2]", got)
+	}
+	if got := floats(prev1, 2); got[0] != before[0] || got[1] != before[1] {
+		t.Errorf("node 1 changed to %v before it ran", got)
+	}
+
+	if err := s.Continue(); err != nil {
+		t.Fatalf("Continue failed: %v", err)
+	}
+	if _, ok := s.Next(); ok {
+		t.Error("Next reports a node after Continue")
+	}
+	if _, err := s.Step(); err != io.EOF {
+		t.Errorf("Step after the last node = %v, want io.EOF", err)
+	}
+	s.Reset()
+	if id, ok := s.Next(); !ok || id != 0 {
+		t.Errorf("Next after Reset = %d, %t, want node 0", id, ok)
+	}
+
+	if _, _, err := engine.NodeBuffers(99); err == nil {
+		t.Error("NodeBuffers accepted a missing node")
+	}
+	if err := engine.SetNodeData(0, make([]byte, 1<<12)); err == nil {
+		t.Error("SetNodeData accepted data larger than the buffers")
+	}
+}
@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInputTooLarge is matched by every InputTooLargeError.
+var ErrInputTooLarge = errors.New("input exceeds streaming window")
+
+// ErrInputTooShort reports a streaming input that ends before the data of
+// the inputs the model declares.
+var ErrInputTooShort = errors.New("input shorter than the declared inputs")
+
+// InputTooLargeError reports a streaming input that does not fit the window.
+type InputTooLargeError struct {
+	Size  int // Bytes offered
+	Limit int // Streaming window size
+}
+
+// Error implements error.
+func (e *InputTooLargeError) Error() string {
+	return fmt.Sprintf("input of %d bytes exceeds the %d-byte streaming window", e.Size, e.Limit)
+}
+
+// Is lets errors.Is match ErrInputTooLarge.
+func (e *InputTooLargeError) Is(target error) bool {
+	return target == ErrInputTooLarge
+}
+
+// StreamWrite appends as much of data as fits in the streaming ring,
+// wrapping at the end of the window, and returns the number of bytes written.
+// Not safe for concurrent use.
+func (a *Arena) StreamWrite(data []byte) int {
+	n := min(len(data), a.StreamFree())
+	window := a.buffer[a.streamingInput.Offset : a.streamingInput.Offset+a.streamingInput.Size]
+	for written := 0; written < n; {
+		pos := (a.streamWrite + uintptr(written)) % a.streamingInput.Size
+		written += copy(window[pos:], data[written:n])
+	}
+	a.streamWrite += uintptr(n)
+	a.streamingHighWater = max(a.streamingHighWater, uintptr(a.StreamBuffered()))
+	return n
+}
+
+// StreamPeek returns the buffered bytes in order without consuming them. The
+// second slice is non-empty when the data wraps around the window end.
+func (a *Arena) StreamPeek() (first, second []byte) {
+	buffered := uintptr(a.StreamBuffered())
+	if buffered == 0 {
+		return nil, nil
+	}
+	window := a.buffer[a.streamingInput.Offset : a.streamingInput.Offset+a.streamingInput.Size]
+	start := a.streamRead % a.streamingInput.Size
+	if start+buffered <= a.streamingInput.Size {
+		return window[start : start+buffered], nil
+	}
+	return window[start:], window[:start+buffered-a.streamingInput.Size]
+}
+
+// StreamConsume marks n buffered bytes as read, freeing their space.
+func (a *Arena) StreamConsume(n int) {
+	a.streamRead += uintptr(min(max(n, 0), a.StreamBuffered()))
+}
+
+// StreamBuffered returns the number of bytes written but not yet consumed.
+func (a *Arena) StreamBuffered() int {
+	return int(a.streamWrite - a.streamRead)
+}
+
+// StreamFree returns the number of bytes StreamWrite can accept.
+func (a *Arena) StreamFree() int {
+	return int(a.streamingInput.Size) - a.StreamBuffered()
+}
+
+// ResetStream discards buffered data and rewinds both cursors to the window start.
+func (a *Arena) ResetStream() {
+	a.streamRead, a.streamWrite = 0, 0
+}
+
+// InputSize returns the size of the streaming window, the largest input
+// ExecuteStreaming accepts unless EngineOptions.ChunkedInput is set.
+func (e *Engine) InputSize() int {
+	if e.arena == nil {
+		return 0
+	}
+	return int(e.arena.streamingInput.Size)
+}
+
+// StreamingWindow returns the memory of the streaming window, for callers
+// staging data in the arena between executions, such as a training loader
+// reading batches into it. Streaming executions overwrite it.
+func (e *Engine) StreamingWindow() ([]byte, error) {
+	if e.arena == nil {
+		return nil, errors.New("engine has no arena")
+	}
+	return e.arena.StreamingInputWindow()
+}
+
+// checkInputSize rejects a streaming input the engine cannot take in one
+// window, unless ChunkedInput lets it be processed in pieces.
+func (e *Engine) checkInputSize(input []byte) error {
+	if e.arena == nil {
+		return nil
+	}
+	limit := int(e.arena.streamingInput.Size)
+	if len(input) <= limit || (e.opts.ChunkedInput && limit > 0) {
+		return nil
+	}
+	if limit == 0 {
+		return errors.New("no streaming input region defined")
+	}
+	return &InputTooLargeError{Size: len(input), Limit: limit}
+}
+
+// ingestChunked feeds input through the streaming ring one window at a time,
+// running the graph on each chunk. Sublate state carries from chunk to chunk,
+// so the output reflects the whole input.
+func (e *Engine) ingestChunked(input []byte) error {
+	for len(input) > 0 {
+		n := e.arena.StreamWrite(input)
+		input = input[n:]
+		if err := e.runResident(); err != nil {
+			return err
+		}
+		e.arena.StreamConsume(e.arena.StreamBuffered())
+	}
+	return nil
+}
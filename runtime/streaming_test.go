@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestStreamRing(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 32),
+		Nodes:   []model.Node{{Kernel: 1}},
+	}
+	arena, err := NewArena(512, graph, 128, 64, 64)
+	if err != nil {
+		t.Fatalf("NewArena failed: %v", err)
+	}
+
+	data := make([]byte, 112)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	if n := arena.StreamWrite(data[:48]); n != 48 {
+		t.Fatalf("Expected 48 bytes written, got %d", n)
+	}
+	arena.StreamConsume(40)
+	if n := arena.StreamWrite(data[48:]); n != 56 {
+		t.Fatalf("Expected the write to stop at the 56 free bytes, got %d", n)
+	}
+	if arena.StreamFree() != 0 || arena.StreamBuffered() != 64 {
+		t.Errorf("Expected a full ring, got %d buffered, %d free", arena.StreamBuffered(), arena.StreamFree())
+	}
+
+	first, second := arena.StreamPeek()
+	if len(second) == 0 {
+		t.Fatal("Expected buffered data to wrap around the window end")
+	}
+	if got := append(append([]byte(nil), first...), second...); !bytes.Equal(got, data[40:104]) {
+		t.Errorf("Expected ring to hold bytes 40..103 in order, got %v", got)
+	}
+
+	arena.ResetStream()
+	if arena.StreamBuffered() != 0 || arena.StreamFree() != 64 {
+		t.Errorf("Expected an empty ring after reset, got %d buffered", arena.StreamBuffered())
+	}
+
+	err = arena.WriteToStreamingInput(data)
+	var tooLarge *InputTooLargeError
+	if !errors.Is(err, ErrInputTooLarge) || !errors.As(err, &tooLarge) || tooLarge.Limit != 64 || tooLarge.Size != 112 {
+		t.Errorf("Expected InputTooLargeError{112, 64}, got %v", err)
+	}
+}
+
+func TestChunkedStreamingInput(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 64),
+		Nodes:   []model.Node{{Kernel: 1}},
+	}
+	input := make([]byte, 150)
+
+	engine, err := NewEngine(graph, &EngineOptions{
+		Workers:        1,
+		Streaming:      true,
+		StreamingBytes: RegionBytes(64),
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if engine.InputSize() != 64 {
+		t.Errorf("Expected a 64-byte input window, got %d", engine.InputSize())
+	}
+	if err := engine.ExecuteStreaming(input, nil); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("Expected ErrInputTooLarge without ChunkedInput, got %v", err)
+	}
+
+	recorder := NewTraceRecorder(0)
+	engine, err = NewEngine(graph, &EngineOptions{
+		Workers:        1,
+		Streaming:      true,
+		StreamingBytes: RegionBytes(64),
+		ChunkedInput:   true,
+		Tracer:         recorder,
+		DisableMemo:    true, // Count every kernel call
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.ExecuteStreaming(input, nil); err != nil {
+		t.Fatalf("ExecuteStreaming failed: %v", err)
+	}
+	// 150 bytes through a 64-byte window take three runs
+	if got := len(recorder.Events()); got != 3 {
+		t.Errorf("Expected 3 chunk runs, got %d", got)
+	}
+	if engine.arena.StreamBuffered() != 0 {
+		t.Errorf("Expected every chunk to be consumed, %d bytes left", engine.arena.StreamBuffered())
+	}
+}
@@ -0,0 +1,86 @@
+package runtime
+
+import "fmt"
+
+// ExecuteNodes runs only the nodes with the given IDs and their ancestors on
+// the resident arena, skipping branches the targets do not depend on. Nodes
+// run in topological order on the calling goroutine. It is the cheap way to
+// read one head of a multi-head model.
+func (e *Engine) ExecuteNodes(targetIDs []uint32) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+
+	plan, err := e.ancestorPlan(targetIDs)
+	if err != nil {
+		return err
+	}
+	return e.runResidentNodes(plan)
+}
+
+// dependencies returns the engine's dependency graph, reusing the streaming
+// scheduler when there is one.
+func (e *Engine) dependencies() (*StreamScheduler, error) {
+	if e.scheduler != nil {
+		return e.scheduler, nil
+	}
+	e.depsOnce.Do(func() {
+		e.deps, e.depsErr = NewStreamScheduler(e.graph, 1)
+	})
+	return e.deps, e.depsErr
+}
+
+// prerequisites inverts the dependent lists: entry i holds the indices of the
+// nodes node i waits on.
+func (s *StreamScheduler) prerequisites() [][]int {
+	prerequisites := make([][]int, len(s.nodes))
+	for i, dependents := range s.dependents {
+		for _, d := range dependents {
+			prerequisites[d] = append(prerequisites[d], i)
+		}
+	}
+	return prerequisites
+}
+
+// ancestorPlan returns, in topological order, the indices of the nodes named
+// by targetIDs and of every node they transitively depend on.
+func (e *Engine) ancestorPlan(targetIDs []uint32) ([]int, error) {
+	s, err := e.dependencies()
+	if err != nil {
+		return nil, err
+	}
+
+	prerequisites := s.prerequisites()
+	needed := make([]bool, len(s.nodes))
+	var stack []int
+	for _, id := range targetIDs {
+		found := false
+		for i, n := range s.nodes {
+			if n.ID == id {
+				found = true
+				stack = append(stack, i)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("target node %d not in graph", id)
+		}
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if needed[i] {
+			continue
+		}
+		needed[i] = true
+		stack = append(stack, prerequisites[i]...)
+	}
+
+	plan := make([]int, 0, len(s.order))
+	for _, i := range s.order {
+		if needed[i] {
+			plan = append(plan, i)
+		}
+	}
+	return plan, nil
+}
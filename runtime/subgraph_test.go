@@ -0,0 +1,68 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestExecuteNodes(t *testing.T) {
+	t.Parallel()
+	// Two heads sharing a trunk: 0 -> 1 and 0 -> 2 -> 3
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+			{ID: 2, Kernel: 1, In: 128, Out: 192, Topo: []uint32{0}},
+			{ID: 3, Kernel: 1, In: 192, Out: 256, Topo: []uint32{2}},
+		},
+	}
+
+	for _, streaming := range []bool{false, true} {
+		recorder := NewTraceRecorder(0)
+		engine, err := NewEngine(graph, &EngineOptions{
+			Workers:   2,
+			ArenaSize: 1 << 16,
+			Streaming: streaming,
+			Tracer:    recorder,
+
+			DisableMemo: true, // Count every kernel call
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+
+		cases := []struct {
+			targets []uint32
+			want    []uint32
+		}{
+			{[]uint32{1}, []uint32{0, 1}},
+			{[]uint32{3}, []uint32{0, 2, 3}},
+			{[]uint32{3, 1}, []uint32{0, 1, 2, 3}},
+			{nil, nil},
+		}
+		for _, tc := range cases {
+			recorder.Reset()
+			if err := engine.ExecuteNodes(tc.targets); err != nil {
+				t.Fatalf("ExecuteNodes(%v) failed: %v", tc.targets, err)
+			}
+			events := recorder.Events()
+			if len(events) != len(tc.want) {
+				t.Errorf("streaming=%v: ExecuteNodes(%v) ran %d nodes, expected %v",
+					streaming, tc.targets, len(events), tc.want)
+				continue
+			}
+			for i, ev := range events {
+				if ev.NodeID != tc.want[i] {
+					t.Errorf("streaming=%v: ExecuteNodes(%v) step %d ran node %d, expected %d",
+						streaming, tc.targets, i, ev.NodeID, tc.want[i])
+				}
+			}
+		}
+
+		if err := engine.ExecuteNodes([]uint32{9}); err == nil {
+			t.Error("Expected error for an unknown target node")
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package runtime
+
+import (
+	"log"
+
+	"github.com/sbl8/sublation/model"
+)
+
+var hostTarget = detectTarget()
+
+// HostTarget returns the ISA profile matching the CPU the process runs on:
+// avx512 or avx2 on amd64 when both the CPU and the OS support it, neon on
+// arm64 and generic otherwise
+func HostTarget() model.Target {
+	return hostTarget
+}
+
+// checkTarget reports a model compiled for an ISA profile other than the
+// host's. Generic models run alike everywhere and are never reported.
+func (e *Engine) checkTarget() {
+	compiled := e.graph.Target
+	if compiled == model.TargetGeneric || compiled == hostTarget {
+		return
+	}
+	if e.opts.OnTargetMismatch != nil {
+		e.opts.OnTargetMismatch(compiled, hostTarget)
+		return
+	}
+	log.Printf("model compiled for target %v, host is %v: kernel variants and alignment may not suit this CPU", compiled, hostTarget)
+}
@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/compiler"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+func TestCompileTarget(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "m.subs")
+	spec := `node 1 noop 0 16
+payload @floats(1, 2, 3, 4)
+node 2 matmul 16 54 <- 1
+payload 020002000200
+payload @floats(1, 2, 3, 4)
+payload @floats(5, 6, 7, 8)
+`
+	if err := os.WriteFile(src, []byte(spec), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	compile := func(target model.Target) *model.Graph {
+		opts := compiler.DefaultOptions()
+		opts.Target = target
+		out := filepath.Join(dir, target.String()+".subl")
+		if _, err := compiler.CompileWithOptions(src, out, opts); err != nil {
+			t.Fatalf("Compile for %v failed: %v", target, err)
+		}
+		graph, err := ReadGraph(out, nil)
+		if err != nil {
+			t.Fatalf("ReadGraph failed: %v", err)
+		}
+		return graph
+	}
+
+	generic := compile(model.TargetGeneric)
+	if generic.Target != model.TargetGeneric || generic.Nodes[1].Kernel != kernels.OpMatMul {
+		t.Errorf("Expected a generic graph keeping matmul, got %v with %s", generic.Target, kernels.OpName(generic.Nodes[1].Kernel))
+	}
+
+	graph := compile(model.TargetNEON)
+	if graph.Target != model.TargetNEON {
+		t.Fatalf("Expected the header to record neon, got %v", graph.Target)
+	}
+	n := graph.Nodes[1]
+	if n.Kernel != kernels.OpMatMulTiled || !slices.Equal(graph.Shapes[2], []int{2, 2}) {
+		t.Fatalf("Expected a [2, 2] matmul_tiled node, got %s with shape %v", kernels.OpName(n.Kernel), graph.Shapes[2])
+	}
+	for _, n := range graph.Nodes {
+		if n.In%128 != 0 {
+			t.Errorf("Node %d: expected its payload 128-byte aligned, starts at %d", n.ID, n.In)
+		}
+	}
+	data := slices.Clone(graph.Payload[n.In:n.Out])
+	if tile := binary.LittleEndian.Uint16(data[6:]); tile != 32 {
+		t.Errorf("Expected the neon tile size 32, got %d", tile)
+	}
+	kernels.Catalog[n.Kernel](data)
+	for i, want := range []float32{19, 22, 43, 50} {
+		off := kernels.MatMulTiledHeader + 32 + 4*i
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(data[off:])); got != want {
+			t.Errorf("Element %d: expected %v, got %v", i, want, got)
+		}
+	}
+
+	other := model.TargetAVX2
+	if HostTarget() == other {
+		other = model.TargetNEON
+	}
+	graph.Target = other
+	var compiled, host model.Target
+	engine, err := NewEngine(graph, &EngineOptions{Workers: 1, OnTargetMismatch: func(c, h model.Target) { compiled, host = c, h }})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	engine.Close(context.Background())
+	if compiled != other || host != HostTarget() {
+		t.Errorf("Expected a mismatch between %v and %v, got %v and %v", other, HostTarget(), compiled, host)
+	}
+
+	if _, err := model.ParseTarget("sse2"); err == nil {
+		t.Error("Expected an error for an unknown target")
+	}
+}
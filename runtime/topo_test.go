@@ -0,0 +1,20 @@
+package runtime
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestSchedulerNamesCycle(t *testing.T) {
+	t.Parallel()
+	cyclic := &model.Graph{Nodes: []model.Node{
+		{ID: 0}, {ID: 1, Topo: []uint32{0, 2}}, {ID: 2, Topo: []uint32{1}},
+	}}
+	var cycle *model.CycleError
+	if _, err := NewStreamScheduler(cyclic, 1); !errors.As(err, &cycle) || !slices.Equal(cycle.Path, []uint32{1, 2, 1}) {
+		t.Errorf("Expected the scheduler to name the cycle 1 -> 2 -> 1, got %v", err)
+	}
+}
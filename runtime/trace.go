@@ -0,0 +1,285 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// TraceEvent records a single kernel invocation on one worker.
+type TraceEvent struct {
+	NodeID   uint32    `json:"node"`
+	NodeName string    `json:"name,omitempty"` // From the model's debug section, "" without one
+	KernelID uint8     `json:"kernel"`
+	Worker   int       `json:"worker"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+// Duration returns how long the kernel ran.
+func (ev TraceEvent) Duration() time.Duration {
+	return ev.End.Sub(ev.Start)
+}
+
+// Tracer receives node execution events from the scheduler.
+// Implementations are called from worker goroutines and must be safe for concurrent use.
+type Tracer interface {
+	TraceNode(ev TraceEvent)
+}
+
+// TraceRecorder is a Tracer that buffers events in memory for later export.
+type TraceRecorder struct {
+	mu      sync.Mutex
+	events  []TraceEvent
+	limit   int
+	dropped int64
+}
+
+// NewTraceRecorder creates a recorder that keeps at most limit events.
+// A limit <= 0 keeps every event.
+func NewTraceRecorder(limit int) *TraceRecorder {
+	capacity := limit
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &TraceRecorder{
+		events: make([]TraceEvent, 0, capacity),
+		limit:  limit,
+	}
+}
+
+// TraceNode implements Tracer.
+func (r *TraceRecorder) TraceNode(ev TraceEvent) {
+	r.mu.Lock()
+	if r.limit > 0 && len(r.events) >= r.limit {
+		r.dropped++
+	} else {
+		r.events = append(r.events, ev)
+	}
+	r.mu.Unlock()
+}
+
+// Events returns a copy of the recorded events in arrival order.
+func (r *TraceRecorder) Events() []TraceEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]TraceEvent, len(r.events))
+	copy(out, r.events)
+	return out
+}
+
+// Dropped returns the number of events discarded because the limit was reached.
+func (r *TraceRecorder) Dropped() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Reset discards all recorded events.
+func (r *TraceRecorder) Reset() {
+	r.mu.Lock()
+	r.events = r.events[:0]
+	r.dropped = 0
+	r.mu.Unlock()
+}
+
+// chromeTraceEvent is one entry of the Chrome trace event format ("X" = complete event).
+type chromeTraceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat"`
+	Ph   string         `json:"ph"`
+	Ts   float64        `json:"ts"`
+	Dur  float64        `json:"dur"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	Args map[string]int `json:"args"`
+}
+
+// WriteChromeTrace writes the recorded events as Chrome trace JSON, loadable in
+// chrome://tracing or Perfetto. Each worker is rendered as its own thread lane.
+func (r *TraceRecorder) WriteChromeTrace(w io.Writer) error {
+	return WriteChromeTrace(w, r.Events())
+}
+
+// WriteChromeTrace writes events as Chrome trace JSON. Timestamps are relative to
+// the earliest event start.
+func WriteChromeTrace(w io.Writer, events []TraceEvent) error {
+	var origin time.Time
+	for i, ev := range events {
+		if i == 0 || ev.Start.Before(origin) {
+			origin = ev.Start
+		}
+	}
+
+	out := struct {
+		TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string             `json:"displayTimeUnit"`
+	}{
+		TraceEvents:     make([]chromeTraceEvent, 0, len(events)),
+		DisplayTimeUnit: "ns",
+	}
+
+	for _, ev := range events {
+		out.TraceEvents = append(out.TraceEvents, chromeTraceEvent{
+			Name: model.NodeLabel(ev.NodeID, ev.NodeName),
+			Cat:  fmt.Sprintf("kernel 0x%02x", ev.KernelID),
+			Ph:   "X",
+			Ts:   float64(ev.Start.Sub(origin).Nanoseconds()) / 1e3,
+			Dur:  float64(ev.Duration().Nanoseconds()) / 1e3,
+			Pid:  1,
+			Tid:  ev.Worker,
+			Args: map[string]int{"node": int(ev.NodeID), "kernel": int(ev.KernelID)},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	return enc.Encode(out)
+}
+
+// WriteTrace writes the recorded events as a trace file, see WriteTrace.
+func (r *TraceRecorder) WriteTrace(w io.Writer) error {
+	return WriteTrace(w, r.Events())
+}
+
+// WriteTrace writes events as a trace file: one JSON object per line with
+// the node, debug name, kernel, worker and absolute start and end times.
+// ReadTrace reads it back and subltrace analyzes it.
+func WriteTrace(w io.Writer, events []TraceEvent) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadTrace reads the events of a trace file WriteTrace wrote, or of a
+// Chrome trace WriteChromeTrace wrote. Chrome traces keep only relative
+// times, so their events start at the Unix epoch.
+func ReadTrace(r io.Reader) ([]TraceEvent, error) {
+	dec := json.NewDecoder(r)
+	var events []TraceEvent
+	for line := 1; ; line++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("trace event %d: %w", line, err)
+		}
+		var chrome struct {
+			TraceEvents []chromeTraceEvent `json:"traceEvents"`
+		}
+		if line == 1 && json.Unmarshal(raw, &chrome) == nil && chrome.TraceEvents != nil {
+			return fromChromeTrace(chrome.TraceEvents), nil
+		}
+		var ev TraceEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, fmt.Errorf("trace event %d: %w", line, err)
+		}
+		events = append(events, ev)
+	}
+}
+
+// fromChromeTrace converts the complete events of a Chrome trace back,
+// recovering debug names from the node labels
+func fromChromeTrace(chrome []chromeTraceEvent) []TraceEvent {
+	events := make([]TraceEvent, 0, len(chrome))
+	for _, c := range chrome {
+		if c.Ph != "X" {
+			continue
+		}
+		ev := TraceEvent{
+			NodeID:   uint32(c.Args["node"]),
+			KernelID: uint8(c.Args["kernel"]),
+			Worker:   c.Tid,
+			Start:    time.Unix(0, int64(math.Round(c.Ts*1e3))),
+		}
+		ev.End = ev.Start.Add(time.Duration(math.Round(c.Dur * 1e3)))
+		if name := strings.TrimPrefix(c.Name, "node "); c.Name != model.NodeLabel(ev.NodeID, "") {
+			ev.NodeName = name
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// Span is an exporter-neutral view of a traced kernel invocation, shaped after
+// OpenTelemetry spans so it can be forwarded to an OTLP pipeline.
+type Span struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]int64
+}
+
+// SpanExporter mirrors the OpenTelemetry SDK exporter contract. An adapter that
+// converts Span into SDK read-only spans lets the runtime feed any OTel backend
+// without the runtime itself depending on the OTel modules.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []Span) error
+}
+
+// ExportSpans converts the recorded events into spans sharing one trace id and
+// hands them to exp in a single batch.
+func (r *TraceRecorder) ExportSpans(ctx context.Context, exp SpanExporter) error {
+	events := r.Events()
+	if len(events) == 0 {
+		return nil
+	}
+
+	var traceID [16]byte
+	if _, err := rand.Read(traceID[:]); err != nil {
+		return fmt.Errorf("failed to generate trace id: %w", err)
+	}
+
+	spans := make([]Span, len(events))
+	for i, ev := range events {
+		spans[i] = Span{
+			TraceID: traceID,
+			Name:    model.NodeLabel(ev.NodeID, ev.NodeName),
+			Start:   ev.Start,
+			End:     ev.End,
+			Attributes: map[string]int64{
+				"sublation.node":   int64(ev.NodeID),
+				"sublation.kernel": int64(ev.KernelID),
+				"sublation.worker": int64(ev.Worker),
+			},
+		}
+		if _, err := rand.Read(spans[i].SpanID[:]); err != nil {
+			return fmt.Errorf("failed to generate span id: %w", err)
+		}
+	}
+
+	return exp.ExportSpans(ctx, spans)
+}
+
+// SetTracer installs a tracer for subsequent executions; nil disables tracing.
+// It must not be called while an execution is in flight.
+func (e *Engine) SetTracer(t Tracer) {
+	e.tracer = t
+}
+
+// traceNode reports a finished kernel to the installed tracer.
+func (e *Engine) traceNode(worker int, nodeID uint32, kernelID uint8, start time.Time) {
+	e.tracer.TraceNode(TraceEvent{
+		NodeID:   nodeID,
+		NodeName: e.graph.NodeName(nodeID),
+		KernelID: kernelID,
+		Worker:   worker,
+		Start:    start,
+		End:      time.Now(),
+	})
+}
@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+type captureExporter struct {
+	spans []Span
+}
+
+func (c *captureExporter) ExportSpans(_ context.Context, spans []Span) error {
+	c.spans = append(c.spans, spans...)
+	return nil
+}
+
+func TestTraceRecorderSequential(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 7, Kernel: 1, In: 0, Out: 128},
+			{ID: 9, Kernel: 3, In: 128, Out: 256},
+		},
+	}
+
+	recorder := NewTraceRecorder(0)
+	engine, err := NewEngine(graph, &EngineOptions{ArenaSize: 8192, Tracer: recorder})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	if err := engine.Execute(NewExecutionContext(len(graph.Nodes))); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	events := recorder.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 trace events, got %d", len(events))
+	}
+	if events[0].NodeID != 7 || events[1].NodeID != 9 {
+		t.Errorf("Unexpected node ids: %d, %d", events[0].NodeID, events[1].NodeID)
+	}
+	if events[1].KernelID != 3 {
+		t.Errorf("Expected kernel 3, got %d", events[1].KernelID)
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.WriteChromeTrace(&buf); err != nil {
+		t.Fatalf("WriteChromeTrace failed: %v", err)
+	}
+	var decoded struct {
+		TraceEvents []map[string]interface{} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Chrome trace is not valid JSON: %v", err)
+	}
+	if len(decoded.TraceEvents) != 2 || decoded.TraceEvents[0]["ph"] != "X" {
+		t.Errorf("Unexpected chrome trace contents: %s", buf.String())
+	}
+
+	for _, write := range []func(*bytes.Buffer) error{
+		func(b *bytes.Buffer) error { return recorder.WriteTrace(b) },
+		func(b *bytes.Buffer) error { return recorder.WriteChromeTrace(b) },
+	} {
+		buf.Reset()
+		if err := write(&buf); err != nil {
+			t.Fatalf("writing the trace failed: %v", err)
+		}
+		read, err := ReadTrace(&buf)
+		if err != nil {
+			t.Fatalf("ReadTrace failed: %v", err)
+		}
+		// Durations are read back from wall clock times, which the
+		// monotonic readings of the recorded events may differ from
+		if len(read) != 2 || read[1].NodeID != 9 || read[1].KernelID != 3 || (read[1].Duration()-events[1].Duration()).Abs() > time.Microsecond {
+			t.Errorf("ReadTrace = %+v, want %+v", read, events)
+		}
+	}
+	if _, err := ReadTrace(bytes.NewBufferString("{\"node\": 1}\nnot json\n")); err == nil {
+		t.Error("ReadTrace accepted a broken trace")
+	}
+
+	exp := &captureExporter{}
+	if err := recorder.ExportSpans(context.Background(), exp); err != nil {
+		t.Fatalf("ExportSpans failed: %v", err)
+	}
+	if len(exp.spans) != 2 || exp.spans[0].TraceID != exp.spans[1].TraceID {
+		t.Error("Expected two spans sharing a trace id")
+	}
+}
+
+func TestTraceRecorderLimit(t *testing.T) {
+	t.Parallel()
+	recorder := NewTraceRecorder(1)
+	recorder.TraceNode(TraceEvent{NodeID: 1})
+	recorder.TraceNode(TraceEvent{NodeID: 2})
+
+	if got := len(recorder.Events()); got != 1 {
+		t.Errorf("Expected 1 retained event, got %d", got)
+	}
+	if recorder.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", recorder.Dropped())
+	}
+
+	recorder.Reset()
+	if len(recorder.Events()) != 0 || recorder.Dropped() != 0 {
+		t.Error("Reset did not clear recorder")
+	}
+}
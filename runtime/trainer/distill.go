@@ -0,0 +1,147 @@
+package trainer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// Teacher runs a trained model, the teacher, to produce the soft targets
+// another model, the student, learns from: knowledge distillation. Distill
+// wraps a dataset so every sample carries the teacher's output on it as an
+// input of the student, which composes with Fit, Replicas and Evaluate. The
+// teacher runs on the forward pass of training, so every node its output
+// depends on needs a kernel with a gradient, as for a loss.
+type Teacher struct {
+	engine *runtime.Engine
+	output uint32
+
+	// Temperature, when positive, softens the output of a teacher producing
+	// logits into the probabilities softmax(output / Temperature); zero
+	// passes the output on as it is
+	Temperature float32
+}
+
+// NewTeacher creates a teacher producing the output of node output of
+// graph
+func NewTeacher(graph *model.Graph, output uint32) (*Teacher, error) {
+	engine, err := runtime.NewEngine(graph, &runtime.EngineOptions{
+		Workers:  1,
+		Training: &runtime.TrainingOptions{Loss: output},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("trainer: teacher: %w", err)
+	}
+	return &Teacher{engine: engine, output: output}, nil
+}
+
+// Predict binds the inputs of sample the teacher declares, ignoring the
+// others, runs its forward pass and returns its output, softened by the
+// Temperature. Inputs the sample lacks, such as the targets the teacher was
+// trained on, keep their payload, so the output should not depend on them.
+func (t *Teacher) Predict(sample Sample) ([]float32, error) {
+	// Bind through a view of the graph declaring only the given inputs
+	view := *t.engine.Graph()
+	view.IO = nil
+	inputs := make(Sample, len(sample))
+	for _, spec := range t.engine.Graph().Inputs() {
+		if tensor, ok := sample[spec.Name]; ok {
+			view.IO = append(view.IO, spec)
+			inputs[spec.Name] = tensor
+		}
+	}
+	if err := ioutil.BindInputs(&view, inputs); err != nil {
+		return nil, fmt.Errorf("teacher: %w", err)
+	}
+	if _, err := t.engine.Forward(); err != nil {
+		return nil, fmt.Errorf("teacher: %w", err)
+	}
+	out, err := t.engine.Value(t.output)
+	if err != nil {
+		return nil, fmt.Errorf("teacher: %w", err)
+	}
+	if t.Temperature > 0 {
+		soften(out, t.Temperature)
+	}
+	return out, nil
+}
+
+// soften replaces logits with softmax(logits / temperature)
+func soften(logits []float32, temperature float32) {
+	peak := float32(math.Inf(-1))
+	for _, v := range logits {
+		peak = max(peak, v)
+	}
+	var sum float64
+	for i, v := range logits {
+		e := math.Exp(float64((v - peak) / temperature))
+		logits[i] = float32(e)
+		sum += e
+	}
+	for i := range logits {
+		logits[i] = float32(float64(logits[i]) / sum)
+	}
+}
+
+// Distill returns a Dataset yielding the batches of data with the
+// teacher's prediction on every sample added as the student input target,
+// replacing any tensor of that name. The prediction must have the elements
+// target declares; it is converted to its dtype. The teacher runs as each
+// batch is read.
+func (t *Teacher) Distill(data Dataset, target model.IOSpec) Dataset {
+	return &distilled{data: data, teacher: t, target: target}
+}
+
+// Close closes the teacher's engine
+func (t *Teacher) Close(ctx context.Context) error {
+	return t.engine.Close(ctx)
+}
+
+// distilled is the Dataset of Teacher.Distill
+type distilled struct {
+	data    Dataset
+	teacher *Teacher
+	target  model.IOSpec
+	samples int // Read this epoch, numbering errors
+}
+
+// Next implements Dataset.
+func (d *distilled) Next() ([]Sample, error) {
+	batch, err := d.data.Next()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Sample, len(batch))
+	for i, sample := range batch {
+		pred, err := d.teacher.Predict(sample)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", d.samples+i, err)
+		}
+		values := make([]float64, len(pred))
+		for j, v := range pred {
+			values[j] = float64(v)
+		}
+		soft, err := ioutil.FromValues(d.target, values)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: teacher output: %w", d.samples+i, err)
+		}
+		out[i] = maps.Clone(sample)
+		if out[i] == nil {
+			out[i] = make(Sample, 1)
+		}
+		out[i][d.target.Name] = soft
+	}
+	d.samples += len(batch)
+	return out, nil
+}
+
+// Reset implements Dataset.
+func (d *distilled) Reset() error {
+	d.samples = 0
+	return d.data.Reset()
+}
@@ -0,0 +1,149 @@
+package trainer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+)
+
+// Replicas trains a model data-parallel: n training engines over copies of
+// it each run the forward and backward passes of a shard of every batch in
+// a goroutine of their own. A tree reduction sums their gradients into the
+// first engine, the primary, which alone averages them and takes the
+// optimizer step, keeping the optimizer state; its parameters are then
+// copied to the others. The result matches training on one engine, up to
+// the order the gradients of a batch are summed in.
+type Replicas struct {
+	engines []*runtime.Engine
+}
+
+// NewReplicas creates n training engines with opts. The primary runs on
+// graph, whose payload the training updates, and the others on copies of
+// its payload.
+func NewReplicas(graph *model.Graph, opts *runtime.EngineOptions, n int) (*Replicas, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("trainer: %d replicas, want at least 1", n)
+	}
+	if opts == nil || opts.Training == nil {
+		return nil, runtime.ErrNotTrainable
+	}
+	r := &Replicas{engines: make([]*runtime.Engine, n)}
+	for i := range r.engines {
+		g := graph
+		if i > 0 {
+			c := *graph
+			c.Payload = slices.Clone(graph.Payload)
+			g = &c
+		}
+		engine, err := runtime.NewEngine(g, opts)
+		if err != nil {
+			r.Close(context.Background())
+			return nil, fmt.Errorf("trainer: replica %d: %w", i, err)
+		}
+		r.engines[i] = engine
+	}
+	return r, nil
+}
+
+// Primary returns the engine taking the optimizer steps, whose graph holds
+// the trained parameters
+func (r *Replicas) Primary() *runtime.Engine {
+	return r.engines[0]
+}
+
+// Engines returns every replica, the primary first
+func (r *Replicas) Engines() []*runtime.Engine {
+	return r.engines
+}
+
+// Fit trains the replicas for epochs passes over data with learning rate
+// lr, as the package function Fit trains one engine
+func (r *Replicas) Fit(data Dataset, epochs int, lr float32) ([]Epoch, error) {
+	var history []Epoch
+	for epoch := 0; epoch < epochs; epoch++ {
+		e, err := r.TrainEpoch(data, lr)
+		if err != nil {
+			return history, fmt.Errorf("epoch %d: %w", epoch+1, err)
+		}
+		history = append(history, e)
+	}
+	return history, nil
+}
+
+// TrainEpoch trains the replicas for one pass over data. A batch is split
+// into shards of equal size, the last possibly smaller, so batches smaller
+// than the replicas leave the last ones idle.
+func (r *Replicas) TrainEpoch(data Dataset, lr float32) (Epoch, error) {
+	losses := make([]float64, len(r.engines))
+	errs := make([]error, len(r.engines))
+	return trainEpoch(data, func(batch []Sample) (float64, error) {
+		size := (len(batch) + len(r.engines) - 1) / len(r.engines)
+		active := (len(batch) + size - 1) / size
+		var wg sync.WaitGroup
+		for i, engine := range r.engines[:active] {
+			first := i * size
+			shard := batch[first:min(first+size, len(batch))]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				losses[i], errs[i] = backwardShard(engine, shard, first)
+			}()
+		}
+		wg.Wait()
+		if err := errors.Join(errs[:active]...); err != nil {
+			return 0, err
+		}
+		if err := r.reduce(active); err != nil {
+			return 0, err
+		}
+		if err := step(r.Primary(), len(batch), lr); err != nil {
+			return 0, err
+		}
+		if err := r.Primary().BroadcastParameters(r.engines[1:]...); err != nil {
+			return 0, err
+		}
+		var total float64
+		for _, loss := range losses[:active] {
+			total += loss
+		}
+		return total, nil
+	})
+}
+
+// reduce sums the gradients of the first active replicas into the
+// primary, in rounds halving the replicas holding partial sums, the pairs
+// of a round reducing concurrently
+func (r *Replicas) reduce(active int) error {
+	for stride := 1; stride < active; stride *= 2 {
+		var wg sync.WaitGroup
+		errs := make([]error, active)
+		for i := 0; i+stride < active; i += 2 * stride {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = r.engines[i].ReduceGradients(r.engines[i+stride])
+			}()
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every replica
+func (r *Replicas) Close(ctx context.Context) error {
+	var errs []error
+	for _, engine := range r.engines {
+		if engine != nil {
+			errs = append(errs, engine.Close(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
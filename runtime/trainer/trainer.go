@@ -0,0 +1,242 @@
+// Package trainer runs training loops on an engine created with
+// runtime.EngineOptions.Training. Each batch binds the inputs of every
+// sample in turn and runs the forward and backward passes, summing the
+// gradient of the batch in the engine's arena, then averages it and takes
+// one optimizer step: activations, gradients and optimizer state never
+// leave the arena, and the parameters are updated in the graph payload.
+// Replicas trains data-parallel, sharding every batch across engines over
+// copies of the model, and Teacher feeds the predictions of a trained
+// model to another as its targets. Evaluate scores the model on held-out samples with
+// the forward pass alone.
+package trainer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/sbl8/sublation/metrics"
+	"github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/data"
+	"github.com/sbl8/sublation/runtime/ioutil"
+)
+
+// Sample is the input tensors of one forward pass, by input name
+type Sample = data.Sample
+
+// Dataset yields the samples of an epoch in batches. A data.Loader reads
+// them from files; Samples holds them in memory.
+type Dataset interface {
+	// Next returns the next batch of the epoch, or io.EOF after the last
+	Next() ([]Sample, error)
+	// Reset rewinds to the first batch, starting another epoch
+	Reset() error
+}
+
+// Samples is an in-memory Dataset over its samples, in order
+type Samples struct {
+	data      []Sample
+	batchSize int
+	pos       int
+}
+
+// NewSamples returns a Dataset yielding data in batches of batchSize
+// samples, the last possibly smaller
+func NewSamples(data []Sample, batchSize int) *Samples {
+	return &Samples{data: data, batchSize: max(batchSize, 1)}
+}
+
+// Next implements Dataset.
+func (s *Samples) Next() ([]Sample, error) {
+	if s.pos >= len(s.data) {
+		return nil, io.EOF
+	}
+	end := min(s.pos+s.batchSize, len(s.data))
+	batch := s.data[s.pos:end]
+	s.pos = end
+	return batch, nil
+}
+
+// Reset implements Dataset.
+func (s *Samples) Reset() error {
+	s.pos = 0
+	return nil
+}
+
+// Epoch summarizes one pass over a dataset
+type Epoch struct {
+	Loss     float32 // Mean loss of the samples, before their batch's update
+	Samples  int
+	Batches  int
+	Duration time.Duration
+}
+
+// ErrDiverged is returned by Fit when the loss stops being finite
+var ErrDiverged = errors.New("training diverged")
+
+// Fit trains engine for epochs passes over data with learning rate lr,
+// stepping with the optimizer of the engine's TrainingOptions on the mean
+// gradient of each batch. It returns the summary of every completed epoch,
+// and fails with ErrDiverged on a NaN or infinite loss.
+func Fit(engine *runtime.Engine, data Dataset, epochs int, lr float32) ([]Epoch, error) {
+	var history []Epoch
+	for epoch := 0; epoch < epochs; epoch++ {
+		e, err := TrainEpoch(engine, data, lr)
+		if err != nil {
+			return history, fmt.Errorf("epoch %d: %w", epoch+1, err)
+		}
+		history = append(history, e)
+	}
+	return history, nil
+}
+
+// TrainEpoch trains engine for one pass over data as Fit does, for loops
+// that do more between epochs, such as validating the model
+func TrainEpoch(engine *runtime.Engine, data Dataset, lr float32) (Epoch, error) {
+	return trainEpoch(data, func(batch []Sample) (float64, error) {
+		total, err := backwardShard(engine, batch, 0)
+		if err != nil {
+			return 0, err
+		}
+		return total, step(engine, len(batch), lr)
+	})
+}
+
+// trainEpoch runs one pass over data, training on each batch with train,
+// which returns the summed loss of its samples
+func trainEpoch(data Dataset, train func(batch []Sample) (float64, error)) (Epoch, error) {
+	start := time.Now()
+	var e Epoch
+	if err := data.Reset(); err != nil {
+		return e, err
+	}
+	var total float64
+	for {
+		batch, err := data.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return e, err
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		loss, err := train(batch)
+		if err != nil {
+			return e, fmt.Errorf("batch %d: %w", e.Batches+1, err)
+		}
+		total += loss
+		e.Samples += len(batch)
+		e.Batches++
+	}
+	if e.Samples > 0 {
+		e.Loss = float32(total / float64(e.Samples))
+	}
+	e.Duration = time.Since(start)
+	return e, nil
+}
+
+// backwardShard runs the forward and backward passes of the samples of a
+// batch from its sample first on, summing their gradients, and returns the
+// summed loss
+func backwardShard(engine *runtime.Engine, shard []Sample, first int) (float64, error) {
+	var total float64
+	for i, sample := range shard {
+		loss, err := backward(engine, sample, i > 0)
+		if err != nil {
+			return 0, fmt.Errorf("sample %d: %w", first+i, err)
+		}
+		if math.IsNaN(float64(loss)) || math.IsInf(float64(loss), 0) {
+			return 0, fmt.Errorf("sample %d: loss %v: %w", first+i, loss, ErrDiverged)
+		}
+		total += float64(loss)
+	}
+	return total, nil
+}
+
+// step averages the gradient summed over a batch of n samples and takes
+// an optimizer step on it
+func step(engine *runtime.Engine, n int, lr float32) error {
+	if err := engine.ScaleGradients(1 / float32(n)); err != nil {
+		return err
+	}
+	return engine.ApplyGradients(lr)
+}
+
+// backward binds the inputs of sample and runs the forward and backward
+// passes, adding to the gradient of the previous samples when accumulate
+func backward(engine *runtime.Engine, sample Sample, accumulate bool) (float32, error) {
+	if err := ioutil.BindInputs(engine.Graph(), sample); err != nil {
+		return 0, err
+	}
+	if accumulate {
+		return engine.BackwardAccumulate()
+	}
+	return engine.Backward()
+}
+
+// Evaluate runs the forward pass over one pass of data without training,
+// adding the output of node output, the prediction, and the sample's
+// label input to scores. It returns the mean loss, or NaN for no samples.
+// The output must be a node the loss depends on.
+func Evaluate(engine *runtime.Engine, data Dataset, output uint32, label string, scores metrics.Set) (float32, error) {
+	if err := data.Reset(); err != nil {
+		return 0, err
+	}
+	var total float64
+	n := 0
+	for {
+		batch, err := data.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, sample := range batch {
+			if err := ioutil.BindInputs(engine.Graph(), sample); err != nil {
+				return 0, fmt.Errorf("sample %d: %w", n, err)
+			}
+			loss, err := engine.Forward()
+			if err != nil {
+				return 0, fmt.Errorf("sample %d: %w", n, err)
+			}
+			total += float64(loss)
+			if len(scores) > 0 {
+				if err := score(engine, sample, output, label, scores); err != nil {
+					return 0, fmt.Errorf("sample %d: %w", n, err)
+				}
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return float32(math.NaN()), nil
+	}
+	return float32(total / float64(n)), nil
+}
+
+// score adds the prediction of the latest forward pass and the label of
+// sample to scores
+func score(engine *runtime.Engine, sample Sample, output uint32, label string, scores metrics.Set) error {
+	pred, err := engine.Value(output)
+	if err != nil {
+		return err
+	}
+	t, ok := sample[label]
+	if !ok {
+		return fmt.Errorf("no label input %q", label)
+	}
+	want, err := t.Values()
+	if err != nil {
+		return err
+	}
+	got := make([]float64, len(pred))
+	for i, v := range pred {
+		got[i] = float64(v)
+	}
+	return scores.Add(got, want)
+}
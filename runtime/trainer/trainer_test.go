@@ -0,0 +1,277 @@
+package trainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/metrics"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/runtime"
+	"github.com/sbl8/sublation/runtime/data"
+	"github.com/sbl8/sublation/runtime/ioutil"
+	"github.com/sbl8/sublation/training"
+)
+
+// lineGraph fits w·x + b to the targets t with the loss sum((w·x + b - t)²)
+// of node 9, x and -t being inputs
+func lineGraph() *model.Graph {
+	payload := make([]byte, 16)
+	binary.LittleEndian.PutUint32(payload[4:], math.Float32bits(0.1))
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpNoop, In: 0, Out: 4},
+			{ID: 2, Kernel: kernels.OpNoop, In: 4, Out: 8},
+			{ID: 3, Kernel: kernels.OpMul, Topo: []uint32{1, 2}},
+			{ID: 4, Kernel: kernels.OpNoop, In: 8, Out: 12},
+			{ID: 5, Kernel: kernels.OpAdd, Topo: []uint32{3, 4}},
+			{ID: 6, Kernel: kernels.OpNoop, In: 12, Out: 16},
+			{ID: 7, Kernel: kernels.OpAdd, Topo: []uint32{5, 6}},
+			{ID: 8, Kernel: kernels.OpMul, Topo: []uint32{7, 7}},
+			{ID: 9, Kernel: kernels.OpSum, Topo: []uint32{8}},
+		},
+		IO: []model.IOSpec{
+			{Name: "x", Kind: model.Input, NodeID: 1, DType: model.Float32, Shape: []int{1}},
+			{Name: "neg_t", Kind: model.Input, NodeID: 6, DType: model.Float32, Shape: []int{1}},
+		},
+	}
+}
+
+func scalar(v float32) ioutil.Tensor {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, math.Float32bits(v))
+	return ioutil.Tensor{DType: model.Float32, Shape: []int{1}, Data: data}
+}
+
+// lineSamples samples t = 2x + 1
+func lineSamples() []Sample {
+	var samples []Sample
+	for x := float32(-1); x <= 1; x += 0.25 {
+		samples = append(samples, Sample{"x": scalar(x), "neg_t": scalar(-(2*x + 1))})
+	}
+	return samples
+}
+
+func TestFit(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		opt    training.Optimizer
+		lr     float32
+		epochs int
+	}{
+		{training.Optimizer{Kind: training.SGD}, 0.2, 60},
+		{training.Optimizer{Kind: training.Momentum}, 0.05, 60},
+		{training.Optimizer{Kind: training.Adam}, 0.1, 100},
+	} {
+		graph := lineGraph()
+		engine, err := runtime.NewEngine(graph, &runtime.EngineOptions{
+			Workers:  1,
+			Training: &runtime.TrainingOptions{Loss: 9, Optimizer: tc.opt},
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+		history, err := Fit(engine, NewSamples(lineSamples(), 3), tc.epochs, tc.lr)
+		if err != nil {
+			t.Fatalf("%v: Fit failed: %v", tc.opt.Kind, err)
+		}
+		if len(history) != tc.epochs || history[0].Samples != 9 || history[0].Batches != 3 {
+			t.Fatalf("%v: got history %+v", tc.opt.Kind, history[0])
+		}
+		first, last := history[0].Loss, history[len(history)-1].Loss
+		w := math.Float32frombits(binary.LittleEndian.Uint32(graph.Payload[4:]))
+		b := math.Float32frombits(binary.LittleEndian.Uint32(graph.Payload[8:]))
+		if last >= first || last > 1e-3 || math.Abs(float64(w-2)) > 0.05 || math.Abs(float64(b-1)) > 0.05 {
+			t.Errorf("%v: loss %v -> %v, fitted w = %v and b = %v, want 2 and 1", tc.opt.Kind, first, last, w, b)
+		}
+	}
+}
+
+func TestFitLoader(t *testing.T) {
+	t.Parallel()
+	graph := lineGraph()
+	engine, err := runtime.NewEngine(graph, &runtime.EngineOptions{
+		Workers:        1,
+		Streaming:      true,
+		StreamingBytes: runtime.RegionBytes(64),
+		Training:       &runtime.TrainingOptions{Loss: 9},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	// The samples as binary records of x and neg_t, batched into the arena
+	var records []byte
+	for _, s := range lineSamples() {
+		records = append(append(records, s["x"].Data...), s["neg_t"].Data...)
+	}
+	src, err := data.NewRecords(bytes.NewReader(records), int64(len(records)), graph.Inputs())
+	if err != nil {
+		t.Fatalf("NewRecords failed: %v", err)
+	}
+	window, err := engine.StreamingWindow()
+	if err != nil {
+		t.Fatalf("StreamingWindow failed: %v", err)
+	}
+	loader, err := data.NewLoader(src, data.Options{BatchSize: 3, Shuffle: true, Seed: 7, Buffer: window})
+	if err != nil {
+		t.Fatalf("NewLoader failed: %v", err)
+	}
+	history, err := Fit(engine, loader, 60, 0.2)
+	if err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+	if p := loader.Progress(); p.Epoch != 60 || p.Batches != 3 || p.Samples != 9 {
+		t.Errorf("got progress %+v, want 60 epochs of 3 batches", p)
+	}
+	if last := history[len(history)-1].Loss; last > 1e-3 {
+		t.Errorf("loss %v -> %v, want under 1e-3", history[0].Loss, last)
+	}
+
+	// The prediction w·x + b of node 5 against the label -t is off by 2t,
+	// |4x + 2| averaging 8/3 over the samples
+	scores, err := metrics.Parse("mae")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loss, err := Evaluate(engine, loader, 5, "neg_t", scores)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if mae := scores[0].Value(); loss > 1e-3 || math.Abs(mae-8.0/3) > 0.05 {
+		t.Errorf("Evaluate = loss %v, mae %v, want under 1e-3 and 8/3", loss, mae)
+	}
+}
+
+func TestFitDiverges(t *testing.T) {
+	t.Parallel()
+	engine, err := runtime.NewEngine(lineGraph(), &runtime.EngineOptions{
+		Workers:  1,
+		Training: &runtime.TrainingOptions{Loss: 9},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if _, err := Fit(engine, NewSamples(lineSamples(), 9), 200, 10); !errors.Is(err, ErrDiverged) {
+		t.Errorf("Expected ErrDiverged with a huge learning rate, got %v", err)
+	}
+}
+
+func TestReplicas(t *testing.T) {
+	t.Parallel()
+	opts := &runtime.EngineOptions{
+		Workers:  1,
+		Training: &runtime.TrainingOptions{Loss: 9, Optimizer: training.Optimizer{Kind: training.Momentum}},
+	}
+	single := lineGraph()
+	engine, err := runtime.NewEngine(single, opts)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	want, err := Fit(engine, NewSamples(lineSamples(), 4), 20, 0.05)
+	if err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+
+	// Batches of 4 over 3 replicas run shards of 2, 2 and none, and the
+	// last batch of 1 only on the primary
+	graph := lineGraph()
+	replicas, err := NewReplicas(graph, opts, 3)
+	if err != nil {
+		t.Fatalf("NewReplicas failed: %v", err)
+	}
+	defer replicas.Close(context.Background())
+	got, err := replicas.Fit(NewSamples(lineSamples(), 4), 20, 0.05)
+	if err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+	for i := range want {
+		if got[i].Samples != 9 || got[i].Batches != 3 || math.Abs(float64(got[i].Loss-want[i].Loss)) > 1e-4 {
+			t.Fatalf("epoch %d: got %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+	for _, e := range replicas.Engines() {
+		if p := e.Graph().Payload; !bytes.Equal(p[4:12], graph.Payload[4:12]) {
+			t.Errorf("replica parameters %v differ from the primary's %v", p[4:12], graph.Payload[4:12])
+		}
+	}
+	for off := 4; off < 12; off += 4 {
+		a := math.Float32frombits(binary.LittleEndian.Uint32(graph.Payload[off:]))
+		b := math.Float32frombits(binary.LittleEndian.Uint32(single.Payload[off:]))
+		if math.Abs(float64(a-b)) > 1e-4 {
+			t.Errorf("parameter at %d: got %v, want %v as trained on one engine", off, a, b)
+		}
+	}
+
+	if err := engine.ReduceGradients(engine); err == nil {
+		t.Error("ReduceGradients of the engine into itself succeeded")
+	}
+	other, _ := runtime.NewEngine(lineGraph(), &runtime.EngineOptions{Workers: 1, Training: &runtime.TrainingOptions{Loss: 8}})
+	if err := engine.ReduceGradients(other); err == nil {
+		t.Error("ReduceGradients of a replica of another loss succeeded")
+	}
+}
+
+func TestTeacher(t *testing.T) {
+	t.Parallel()
+	// The teacher predicts -(2x + 1), the student's neg_t, from x alone
+	teacherGraph := lineGraph()
+	teacherGraph.IO = teacherGraph.IO[:1]
+	binary.LittleEndian.PutUint32(teacherGraph.Payload[4:], math.Float32bits(-2))
+	binary.LittleEndian.PutUint32(teacherGraph.Payload[8:], math.Float32bits(-1))
+	teacher, err := NewTeacher(teacherGraph, 5)
+	if err != nil {
+		t.Fatalf("NewTeacher failed: %v", err)
+	}
+	defer teacher.Close(context.Background())
+
+	var samples []Sample
+	for _, s := range lineSamples() {
+		samples = append(samples, Sample{"x": s["x"]})
+	}
+	graph := lineGraph()
+	engine, err := runtime.NewEngine(graph, &runtime.EngineOptions{
+		Workers:  1,
+		Training: &runtime.TrainingOptions{Loss: 9},
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if _, err := Fit(engine, teacher.Distill(NewSamples(samples, 3), graph.IO[1]), 60, 0.2); err != nil {
+		t.Fatalf("Fit failed: %v", err)
+	}
+	w := math.Float32frombits(binary.LittleEndian.Uint32(graph.Payload[4:]))
+	b := math.Float32frombits(binary.LittleEndian.Uint32(graph.Payload[8:]))
+	if math.Abs(float64(w-2)) > 0.05 || math.Abs(float64(b-1)) > 0.05 {
+		t.Errorf("student fitted w = %v and b = %v, want the teacher's 2 and 1", w, b)
+	}
+
+	// A softened output sums to one, and a prediction must fit the target
+	teacher.Temperature = 2
+	pred, err := teacher.Predict(samples[0])
+	if err != nil || len(pred) != 1 || pred[0] != 1 {
+		t.Errorf("Predict softened = %v, %v, want [1]", pred, err)
+	}
+	wide := model.IOSpec{Name: "neg_t", Kind: model.Input, NodeID: 6, DType: model.Float32, Shape: []int{2}}
+	if _, err := teacher.Distill(NewSamples(samples, 3), wide).Next(); err == nil {
+		t.Error("Distill into a target of 2 elements from an output of 1 succeeded")
+	}
+}
+
+func TestSoften(t *testing.T) {
+	t.Parallel()
+	logits := []float32{1, 2, 3}
+	soften(logits, 1)
+	if sum := logits[0] + logits[1] + logits[2]; math.Abs(float64(sum-1)) > 1e-6 || math.Abs(float64(logits[2]/logits[1])-math.E) > 1e-4 {
+		t.Errorf("softmax(1, 2, 3) = %v", logits)
+	}
+	logits = []float32{1, 2, 3}
+	soften(logits, 100)
+	if logits[2]-logits[0] > 0.01 {
+		t.Errorf("softmax((1, 2, 3) / 100) = %v, want nearly uniform", logits)
+	}
+}
@@ -0,0 +1,272 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/training"
+)
+
+// ErrNotTrainable is returned by Backward and the gradient accessors of an
+// engine created without EngineOptions.Training.
+var ErrNotTrainable = errors.New("engine not created for training")
+
+// TrainingOptions makes an engine differentiable, see EngineOptions.Training
+type TrainingOptions struct {
+	Loss      uint32             // Node whose first output element is the loss
+	Optimizer training.Optimizer // Update rule of ApplyGradients; the zero value is SGD
+}
+
+// differentiate generates the backward graph of the loss node of
+// opts.Training, nil without one, and sizes the scratch region for its
+// training buffer when left automatic
+func differentiate(graph *model.Graph, opts *EngineOptions) (*training.Backward, error) {
+	if opts.Training == nil {
+		return nil, nil
+	}
+	if err := opts.Training.Optimizer.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.NUMAPolicy != NUMANone {
+		return nil, errors.New("training is not supported with a NUMA policy, whose worker shards take the scratch region")
+	}
+	backward, err := training.Differentiate(graph, opts.Training.Loss)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ScratchBytes.IsAuto() {
+		opts.ScratchBytes = RegionBytes(core.AlignedSize(uintptr(backward.Size)) + core.CacheLineSize)
+	}
+	return backward, nil
+}
+
+// setupTraining carves the training buffer from the scratch region
+func (e *Engine) setupTraining() error {
+	if e.backward == nil {
+		return nil
+	}
+	buf, err := e.reserveTraining()
+	if err != nil {
+		return err
+	}
+	e.backward.ResetState(buf)
+	e.trainBuf = buf
+	return nil
+}
+
+// reserveTraining allocates the training buffer at the start of the scratch
+// region; hosted engines reserve it again after every scratch reset
+func (e *Engine) reserveTraining() ([]byte, error) {
+	buf, err := e.arena.AllocateScratch(uintptr(e.backward.Size), core.CacheLineSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate the %d byte training buffer: %w", e.backward.Size, err)
+	}
+	return buf, nil
+}
+
+// Backward runs the model forward over its payload and back-propagates the
+// gradient of the loss node through every node it depends on, leaving the
+// gradients in the arena for Gradient, PayloadGradient and ApplyGradients.
+// It returns the loss. The forward pass follows the data flow of the graph,
+// each node consuming the outputs of its dependencies, and reads inputs and
+// parameters from the graph payload rather than the node buffers Execute
+// runs on.
+func (e *Engine) Backward() (float32, error) {
+	if err := e.enter(); err != nil {
+		return 0, err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return 0, ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	return e.backward.Run(e.trainBuf)
+}
+
+// BackwardAccumulate is Backward adding the payload gradient to that of the
+// previous call instead of replacing it, so ApplyGradients after a Backward
+// and a BackwardAccumulate per further sample steps on the summed gradient
+// of a batch.
+func (e *Engine) BackwardAccumulate() (float32, error) {
+	if err := e.enter(); err != nil {
+		return 0, err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return 0, ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	return e.backward.Accumulate(e.trainBuf)
+}
+
+// Forward runs only the forward pass of Backward, for evaluating the model
+// on held-out samples without touching the gradients, and returns the loss
+func (e *Engine) Forward() (float32, error) {
+	if err := e.enter(); err != nil {
+		return 0, err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return 0, ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	return e.backward.Forward(e.trainBuf)
+}
+
+// Value returns a copy of the output of node id, one the loss depends on,
+// as computed by the latest Forward or Backward
+func (e *Engine) Value(id uint32) ([]float32, error) {
+	if err := e.enter(); err != nil {
+		return nil, err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return nil, ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	value, ok := e.backward.Value(e.trainBuf, id)
+	if !ok {
+		return nil, fmt.Errorf("loss does not depend on node %d", id)
+	}
+	return value, nil
+}
+
+// Gradient returns a copy of the gradient of the loss with respect to the
+// output of node id, as computed by the latest Backward
+func (e *Engine) Gradient(id uint32) ([]float32, error) {
+	if err := e.enter(); err != nil {
+		return nil, err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return nil, ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	grad, ok := e.backward.Gradient(e.trainBuf, id)
+	if !ok {
+		return nil, fmt.Errorf("loss does not depend on node %d", id)
+	}
+	return grad, nil
+}
+
+// PayloadGradient returns a copy of the gradient of the loss with respect
+// to the graph payload, as computed by the latest Backward, laid out like
+// the payload: zero except at the float32 operands nodes read from it.
+func (e *Engine) PayloadGradient() ([]byte, error) {
+	if err := e.enter(); err != nil {
+		return nil, err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return nil, ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	return append([]byte(nil), e.backward.PayloadGradient(e.trainBuf)...), nil
+}
+
+// ScaleGradients multiplies the parameter gradients of the latest Backward
+// by s, such as 1/n to average those summed over n samples
+func (e *Engine) ScaleGradients(s float32) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	e.backward.Scale(e.trainBuf, s)
+	return nil
+}
+
+// ApplyGradients updates every parameter, a payload operand of a node not
+// bound to a model input, from its gradient of the latest Backward with
+// TrainingOptions.Optimizer and learning rate rate, whose state stays in
+// the arena between calls. Like LoadWeights, it waits for queued streaming
+// requests and updates the graph payload, which the next Backward reads, and
+// the resident node buffers, so the engine runs the trained model.
+func (e *Engine) ApplyGradients(rate float32) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return ErrNotTrainable
+	}
+	e.admission.acquire(PriorityCritical)
+	defer e.admission.release()
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	if err := e.backward.Update(e.trainBuf, e.opts.Training.Optimizer, rate); err != nil {
+		return err
+	}
+	var changed []span
+	e.backward.EachParameter(func(offset, length int) {
+		changed = append(changed, span{uint32(offset), uint32(offset + length)})
+	})
+	e.syncPayload(changed)
+	return nil
+}
+
+// ReduceGradients adds the parameter gradients of the latest Backward of
+// every replica, an engine training the same loss over another copy of the
+// model, to those of e: the reduction of data-parallel training, summing
+// the gradients of the shards of a batch into the engine that steps.
+// Replicas must not reduce into each other concurrently.
+func (e *Engine) ReduceGradients(replicas ...*Engine) error {
+	return e.withReplicas(replicas, func(r *Engine) {
+		e.backward.AddGradients(e.trainBuf, r.trainBuf)
+	})
+}
+
+// BroadcastParameters copies the parameters of e into the graph payload of
+// every replica, so after ApplyGradients they all run the updated model
+func (e *Engine) BroadcastParameters(replicas ...*Engine) error {
+	return e.withReplicas(replicas, func(r *Engine) {
+		e.backward.CopyParameters(r.graph.Payload)
+	})
+}
+
+// withReplicas calls f for every replica, holding the training locks of e
+// and the replica, once all are checked to train the same loss of the same
+// model
+func (e *Engine) withReplicas(replicas []*Engine, f func(r *Engine)) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	if e.backward == nil {
+		return ErrNotTrainable
+	}
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+	for i, r := range replicas {
+		switch {
+		case r == e:
+			return fmt.Errorf("replica %d is the engine itself", i)
+		case r.backward == nil:
+			return fmt.Errorf("replica %d: %w", i, ErrNotTrainable)
+		case r.backward.Loss != e.backward.Loss || r.backward.Size != e.backward.Size || len(r.graph.Payload) != len(e.graph.Payload):
+			return fmt.Errorf("replica %d trains another loss or model", i)
+		}
+	}
+	for i, r := range replicas {
+		if err := r.enter(); err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
+		r.trainMu.Lock()
+		f(r)
+		r.trainMu.Unlock()
+		r.exit()
+	}
+	return nil
+}
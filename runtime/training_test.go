@@ -0,0 +1,182 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+	"github.com/sbl8/sublation/training"
+)
+
+// regressionGraph computes the loss sum((x·w - t)²) of node 7 over the
+// inputs x and -t and the weights w
+func regressionGraph() *model.Graph {
+	payload := make([]byte, 48)
+	for i, v := range []float32{1, 2, 3, 4, 0.5, 0.5, 0.5, 0.5, -2, -4, -6, -8} {
+		binary.LittleEndian.PutUint32(payload[4*i:], math.Float32bits(v))
+	}
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpNoop, In: 0, Out: 16},
+			{ID: 2, Kernel: kernels.OpNoop, In: 16, Out: 32},
+			{ID: 3, Kernel: kernels.OpMul, In: 48, Out: 48, Topo: []uint32{1, 2}},
+			{ID: 4, Kernel: kernels.OpNoop, In: 32, Out: 48},
+			{ID: 5, Kernel: kernels.OpAdd, In: 48, Out: 48, Topo: []uint32{3, 4}},
+			{ID: 6, Kernel: kernels.OpMul, In: 48, Out: 48, Topo: []uint32{5, 5}},
+			{ID: 7, Kernel: kernels.OpSum, In: 48, Out: 48, Topo: []uint32{6}},
+		},
+		IO: []model.IOSpec{
+			{Name: "x", Kind: model.Input, NodeID: 1, DType: model.Float32, Shape: []int{4}},
+			{Name: "neg_target", Kind: model.Input, NodeID: 4, DType: model.Float32, Shape: []int{4}},
+			{Name: "loss", Kind: model.Output, NodeID: 7, DType: model.Float32, Shape: []int{1}},
+		},
+	}
+}
+
+func TestEngineBackward(t *testing.T) {
+	t.Parallel()
+	graph := regressionGraph()
+	engine, err := NewEngine(graph, &EngineOptions{Workers: 1, Training: &TrainingOptions{Loss: 7}})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	loss, err := engine.Backward()
+	if err != nil {
+		t.Fatalf("Backward failed: %v", err)
+	}
+	// (0.5x - 2x)² summed over x = 1..4 is 2.25·30
+	if loss != 67.5 {
+		t.Errorf("Expected loss 67.5, got %v", loss)
+	}
+	if grad, err := engine.Gradient(7); err != nil || !slices.Equal(grad, []float32{1}) {
+		t.Errorf("Expected loss gradient [1], got %v, %v", grad, err)
+	}
+	// d/dw of (xw - 2x)² is 2x(xw - 2x) = -3x²
+	if grad, err := engine.Gradient(2); err != nil || !slices.Equal(grad, []float32{-3, -12, -27, -48}) {
+		t.Errorf("Expected weight gradient [-3 -12 -27 -48], got %v, %v", grad, err)
+	}
+	payloadGrad, err := engine.PayloadGradient()
+	if err != nil || math.Float32frombits(binary.LittleEndian.Uint32(payloadGrad[16:])) != -3 {
+		t.Errorf("Expected the payload gradient of the first weight to be -3, got %v, %v", payloadGrad, err)
+	}
+	// A forward pass with another target keeps the gradients
+	binary.LittleEndian.PutUint32(graph.Payload[32:], math.Float32bits(-0.5))
+	if loss, err := engine.Forward(); err != nil || loss != 65.25 {
+		t.Errorf("Expected forward loss 65.25, got %v, %v", loss, err)
+	}
+	if value, err := engine.Value(5); err != nil || !slices.Equal(value, []float32{0, -3, -4.5, -6}) {
+		t.Errorf("Expected residuals [0 -3 -4.5 -6], got %v, %v", value, err)
+	}
+	if grad, err := engine.Gradient(2); err != nil || grad[0] != -3 {
+		t.Errorf("Expected Forward to keep the weight gradient, got %v, %v", grad, err)
+	}
+	binary.LittleEndian.PutUint32(graph.Payload[32:], math.Float32bits(-2))
+
+	for i := 0; i < 20; i++ {
+		if err := engine.ApplyGradients(0.02); err != nil {
+			t.Fatalf("ApplyGradients failed: %v", err)
+		}
+		next, err := engine.Backward()
+		if err != nil {
+			t.Fatalf("Backward failed: %v", err)
+		}
+		if next >= loss {
+			t.Fatalf("Step %d: loss went from %v to %v", i, loss, next)
+		}
+		loss = next
+	}
+	if loss > 1 {
+		t.Errorf("Expected training to fit the weights, loss is %v", loss)
+	}
+	// Inputs are not parameters
+	if x := math.Float32frombits(binary.LittleEndian.Uint32(graph.Payload[0:])); x != 1 {
+		t.Errorf("Expected input x to stay 1, got %v", x)
+	}
+	// The node buffers the engine executes on hold the trained weights
+	prev, prop, err := engine.NodeBuffers(2)
+	if err != nil || !bytes.Equal(prev[:16], graph.Payload[16:32]) || !bytes.Equal(prop[:16], graph.Payload[16:32]) {
+		t.Errorf("Expected the trained weights %v in the buffers of node 2, got %v and %v, %v", graph.Payload[16:32], prev[:16], prop[:16], err)
+	}
+}
+
+func TestEngineBackwardErrors(t *testing.T) {
+	t.Parallel()
+	engine, err := NewEngine(regressionGraph(), &EngineOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if _, err := engine.Backward(); !errors.Is(err, ErrNotTrainable) {
+		t.Errorf("Expected ErrNotTrainable, got %v", err)
+	}
+	if _, err := NewEngine(regressionGraph(), &EngineOptions{Workers: 1, Training: &TrainingOptions{Loss: 9}}); err == nil {
+		t.Error("Expected NewEngine to reject a missing loss node")
+	}
+}
+
+func TestTrainedModelInference(t *testing.T) {
+	t.Parallel()
+	for mode, opts := range map[string]EngineOptions{
+		"sequential": {Workers: 1},
+		"streaming":  {Workers: 4, Streaming: true},
+	} {
+		graph := regressionGraph()
+		opts.Training = &TrainingOptions{Loss: 7}
+		engine, err := NewEngine(graph, &opts)
+		if err != nil {
+			t.Fatalf("%s: NewEngine failed: %v", mode, err)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := engine.Backward(); err != nil {
+				t.Fatalf("%s: Backward failed: %v", mode, err)
+			}
+			if err := engine.ApplyGradients(0.02); err != nil {
+				t.Fatalf("%s: ApplyGradients failed: %v", mode, err)
+			}
+		}
+
+		// The loss of the trained weights, as the training forward pass computes it
+		b, err := training.Differentiate(graph, 7)
+		if err != nil {
+			t.Fatalf("%s: Differentiate failed: %v", mode, err)
+		}
+		want, err := b.Forward(make([]byte, b.Size))
+		if err != nil {
+			t.Fatalf("%s: Forward failed: %v", mode, err)
+		}
+		if want >= 67.5 {
+			t.Fatalf("%s: expected training to lower the loss from 67.5, got %v", mode, want)
+		}
+		loss := func() float32 { return math.Float32frombits(binary.LittleEndian.Uint32(engine.output(6))) }
+
+		if err := engine.Run(); err != nil {
+			t.Fatalf("%s: Run failed: %v", mode, err)
+		}
+		if got := loss(); math.Abs(float64(got-want)) > 1e-4*float64(want) {
+			t.Errorf("%s: Run gives loss %v, training forward %v", mode, got, want)
+		}
+		if err := engine.Execute(nil); err != nil {
+			t.Fatalf("%s: Execute failed: %v", mode, err)
+		}
+		if got := loss(); math.Abs(float64(got-want)) > 1e-4*float64(want) {
+			t.Errorf("%s: Execute gives loss %v, training forward %v", mode, got, want)
+		}
+		if !opts.Streaming {
+			continue
+		}
+		// The streaming input is x then neg_target, the output the loss
+		input := append(slices.Clone(graph.Payload[0:16]), graph.Payload[32:48]...)
+		output := make([]byte, engine.OutputSize())
+		if err := engine.ExecuteStreaming(input, output); err != nil {
+			t.Fatalf("%s: ExecuteStreaming failed: %v", mode, err)
+		}
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(output)); math.Abs(float64(got-want)) > 1e-4*float64(want) {
+			t.Errorf("%s: ExecuteStreaming gives loss %v, training forward %v", mode, got, want)
+		}
+	}
+}
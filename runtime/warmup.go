@@ -0,0 +1,64 @@
+package runtime
+
+import "fmt"
+
+// Warmup pages in the arena and runs n executions on zero input so caches,
+// branch predictors and the Go heap settle before traffic arrives. The runs
+// are recorded under ExecutionStats.WarmupLatency, keeping Latency and its
+// percentiles to steady state. Streaming engines warm the ExecuteStreaming
+// path, others the Execute path.
+func (e *Engine) Warmup(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid warmup count %d", n)
+	}
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+
+	e.admission.acquire(PriorityNormal)
+	defer e.admission.release()
+
+	e.warming.Store(true)
+	defer e.warming.Store(false)
+
+	e.arena.prefault()
+	var input []byte
+	if e.opts.Streaming && e.arena != nil {
+		input = make([]byte, e.arena.streamingInput.Size)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := e.warmupOnce(input); err != nil {
+			return fmt.Errorf("warmup execution %d failed: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// warmupOnce runs a single dummy execution.
+func (e *Engine) warmupOnce(input []byte) error {
+	if !e.opts.Streaming {
+		return e.execute()
+	}
+	if len(input) > 0 {
+		if err := e.arena.WriteToStreamingInput(input); err != nil {
+			return err
+		}
+		defer e.arena.StreamConsume(len(input))
+	}
+	return e.runResident()
+}
+
+// prefault zeroes the regions no execution has written yet (scratch, worker
+// shards, streaming window and free tail) so their pages are faulted in
+// before the first request. It must not run concurrently with an execution.
+func (a *Arena) prefault() {
+	if a == nil {
+		return
+	}
+	regions := append([]ArenaRegion{a.scratch, a.streamingInput, a.freeTail}, a.workerShards...)
+	for _, region := range regions {
+		clear(a.buffer[region.Offset : region.Offset+region.Size])
+	}
+}
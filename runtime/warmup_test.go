@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestLatencyHistogramQuantile(t *testing.T) {
+	t.Parallel()
+	h := newLatencyHistogram()
+	if got := h.Quantile(0.5); got != 0 {
+		t.Errorf("Expected 0 for an empty histogram, got %v", got)
+	}
+
+	// 90 fast samples in (0, 50µs], 10 slow ones in (1ms, 2.5ms]
+	for i := 0; i < 90; i++ {
+		h.observe(20 * time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(2 * time.Millisecond)
+	}
+
+	p := h.Percentiles()
+	if p.P50 <= 0 || p.P50 > 50*time.Microsecond {
+		t.Errorf("Expected p50 within the first bucket, got %v", p.P50)
+	}
+	if p.P95 <= time.Millisecond || p.P95 > 2500*time.Microsecond {
+		t.Errorf("Expected p95 within (1ms, 2.5ms], got %v", p.P95)
+	}
+	if p.P99 < p.P95 {
+		t.Errorf("Expected p99 >= p95, got %v < %v", p.P99, p.P95)
+	}
+
+	h.observe(time.Hour)
+	if got := h.Quantile(1); got != time.Second {
+		t.Errorf("Expected overflow to report the last bound, got %v", got)
+	}
+}
+
+func TestEngineWarmup(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 64),
+		Nodes:   []model.Node{{Kernel: 1}},
+	}
+
+	for _, streaming := range []bool{false, true} {
+		engine, err := NewEngine(graph, &EngineOptions{
+			Workers:     2,
+			ArenaSize:   1 << 16,
+			EnableStats: true,
+			Streaming:   streaming,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+
+		if err := engine.Warmup(5); err != nil {
+			t.Fatalf("Warmup failed: %v", err)
+		}
+		if streaming {
+			if err := engine.ExecuteStreaming(make([]byte, 16), make([]byte, 16)); err != nil {
+				t.Fatalf("ExecuteStreaming failed: %v", err)
+			}
+		} else if err := engine.Execute(NewExecutionContext(1)); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+
+		stats := engine.Stats()
+		if stats.WarmupExecutions != 5 || stats.WarmupLatency.Count != 5 {
+			t.Errorf("streaming=%v: expected 5 warmup executions, got %d (%d observed)",
+				streaming, stats.WarmupExecutions, stats.WarmupLatency.Count)
+		}
+		if stats.TotalExecutions != 1 || stats.Latency.Count != 1 {
+			t.Errorf("streaming=%v: expected 1 steady-state execution, got %d (%d observed)",
+				streaming, stats.TotalExecutions, stats.Latency.Count)
+		}
+		if stats.Percentiles.P50 <= 0 || stats.WarmupPercentiles.P99 <= 0 {
+			t.Errorf("streaming=%v: expected non-zero percentiles, got steady %v, warmup %v",
+				streaming, stats.Percentiles, stats.WarmupPercentiles)
+		}
+	}
+
+	engine, err := NewEngine(graph, &EngineOptions{ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.Warmup(-1); err == nil {
+		t.Error("Expected error for a negative warmup count")
+	}
+}
@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// ErrNodeTimeout is matched by every NodeTimeoutError.
+var ErrNodeTimeout = errors.New("node exceeded its timeout")
+
+// NodeTimeoutError aborts a run whose node overran its watchdog limit while
+// EngineOptions.AbortOnTimeout is set.
+type NodeTimeoutError struct {
+	NodeID   uint32
+	NodeName string // From the model's debug section, "" without one
+	KernelID uint8
+	Limit    time.Duration
+	Elapsed  time.Duration
+}
+
+// Error implements error.
+func (e *NodeTimeoutError) Error() string {
+	return fmt.Sprintf("%s (kernel 0x%02x) ran for %v, limit %v", model.NodeLabel(e.NodeID, e.NodeName), e.KernelID, e.Elapsed, e.Limit)
+}
+
+// Is lets errors.Is match ErrNodeTimeout.
+func (e *NodeTimeoutError) Is(target error) bool {
+	return target == ErrNodeTimeout
+}
+
+// Straggler describes a kernel call that exceeded its watchdog limit.
+type Straggler struct {
+	NodeID   uint32
+	NodeName string // From the model's debug section, "" without one
+	KernelID uint8
+	Worker   int
+	Limit    time.Duration
+	Elapsed  time.Duration // Time running when the straggler was reported
+}
+
+// nodeWatch is the armed watchdog of one kernel call.
+type nodeWatch struct {
+	e         *Engine
+	straggler Straggler
+	start     time.Time
+	timer     *time.Timer
+}
+
+// nodeTimeout returns the watchdog limit for a node, 0 if unwatched.
+func (e *Engine) nodeTimeout(nodeID uint32) time.Duration {
+	if limit, ok := e.opts.NodeTimeouts[nodeID]; ok {
+		return limit
+	}
+	return e.opts.NodeTimeout
+}
+
+// watchNode arms the watchdog for one kernel call. It returns nil when the
+// node has no limit. OnStraggler fires from the timer while the kernel is
+// still running, so runaway loops are reported before they finish.
+func (e *Engine) watchNode(worker int, nodeID uint32, kernelID uint8) *nodeWatch {
+	limit := e.nodeTimeout(nodeID)
+	if limit <= 0 {
+		return nil
+	}
+	w := &nodeWatch{
+		e:     e,
+		start: time.Now(),
+		straggler: Straggler{
+			NodeID:   nodeID,
+			NodeName: e.graph.NodeName(nodeID),
+			KernelID: kernelID,
+			Worker:   worker,
+			Limit:    limit,
+		},
+	}
+	if e.opts.OnStraggler != nil {
+		w.timer = time.AfterFunc(limit, func() { w.report() })
+	}
+	return w
+}
+
+// report hands the straggler to the OnStraggler callback.
+func (w *nodeWatch) report() {
+	s := w.straggler
+	s.Elapsed = time.Since(w.start)
+	w.e.opts.OnStraggler(s)
+}
+
+// finish disarms the watchdog once the kernel returns. An overrun is counted
+// in ExecutionStats.Stragglers and, with AbortOnTimeout, returned as a
+// NodeTimeoutError.
+func (w *nodeWatch) finish() error {
+	if w == nil {
+		return nil
+	}
+	elapsed := time.Since(w.start)
+	stopped := w.timer != nil && w.timer.Stop()
+	if elapsed <= w.straggler.Limit {
+		return nil
+	}
+	if stopped {
+		// The kernel overran but returned before the timer fired
+		w.report()
+	}
+
+	e := w.e
+	e.mu.Lock()
+	e.stats.Stragglers[w.straggler.NodeID]++
+	e.mu.Unlock()
+
+	if !e.opts.AbortOnTimeout {
+		return nil
+	}
+	return &NodeTimeoutError{
+		NodeID:   w.straggler.NodeID,
+		NodeName: w.straggler.NodeName,
+		KernelID: w.straggler.KernelID,
+		Limit:    w.straggler.Limit,
+		Elapsed:  elapsed,
+	}
+}
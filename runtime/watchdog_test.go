@@ -0,0 +1,100 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func chainGraph() *model.Graph {
+	return &model.Graph{
+		Payload: make([]byte, 192),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+			{ID: 2, Kernel: 1, In: 128, Out: 192, Topo: []uint32{1}},
+		},
+	}
+}
+
+func TestWatchdogRecordsStragglers(t *testing.T) {
+	t.Parallel()
+	for _, streaming := range []bool{false, true} {
+		var mu sync.Mutex
+		reported := make(map[uint32]int)
+		engine, err := NewEngine(chainGraph(), &EngineOptions{
+			Workers:      2,
+			ArenaSize:    1 << 16,
+			Streaming:    streaming,
+			NodeTimeout:  time.Nanosecond, // Every kernel call overruns
+			NodeTimeouts: map[uint32]time.Duration{1: time.Hour},
+			OnStraggler: func(s Straggler) {
+				mu.Lock()
+				reported[s.NodeID]++
+				mu.Unlock()
+			},
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+
+		if err := engine.Execute(NewExecutionContext(3)); err != nil {
+			t.Fatalf("streaming=%v: Execute failed: %v", streaming, err)
+		}
+
+		stragglers := engine.Stats().Stragglers
+		if stragglers[0] != 1 || stragglers[2] != 1 || stragglers[1] != 0 {
+			t.Errorf("streaming=%v: expected nodes 0 and 2 to straggle once, got %v", streaming, stragglers)
+		}
+		// Timer callbacks run on their own goroutine and may land after Execute
+		deadline := time.Now().Add(time.Second)
+		for {
+			mu.Lock()
+			ok := reported[0] == 1 && reported[2] == 1 && reported[1] == 0
+			got := fmt.Sprint(reported)
+			mu.Unlock()
+			if ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Errorf("streaming=%v: expected one report for nodes 0 and 2, got %s", streaming, got)
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestWatchdogAbort(t *testing.T) {
+	t.Parallel()
+	for _, streaming := range []bool{false, true} {
+		recorder := NewTraceRecorder(0)
+		engine, err := NewEngine(chainGraph(), &EngineOptions{
+			Workers:        2,
+			ArenaSize:      1 << 16,
+			Streaming:      streaming,
+			Tracer:         recorder,
+			NodeTimeout:    time.Nanosecond,
+			AbortOnTimeout: true,
+		})
+		if err != nil {
+			t.Fatalf("NewEngine failed: %v", err)
+		}
+
+		err = engine.Execute(NewExecutionContext(3))
+		var timeout *NodeTimeoutError
+		if !errors.Is(err, ErrNodeTimeout) || !errors.As(err, &timeout) {
+			t.Fatalf("streaming=%v: expected NodeTimeoutError, got %v", streaming, err)
+		}
+		if timeout.NodeID != 0 || timeout.Elapsed <= timeout.Limit {
+			t.Errorf("streaming=%v: unexpected timeout %+v", streaming, timeout)
+		}
+		if got := len(recorder.Events()); got != 1 {
+			t.Errorf("streaming=%v: expected the run to stop after 1 node, got %d", streaming, got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// LoadWeights hot-reloads a weights checkpoint, as written by sublc
+// -extract-weights or model.Weights.Serialize, into the parameter segments
+// of the running engine. The checkpoint must come from a model of the same
+// architecture; it is checked before anything is overwritten. The reload
+// waits for queued streaming requests and training calls, so it falls
+// between executions, and updates the graph payload, which Execute and
+// Backward read, and the resident node buffers, which Run and
+// ExecuteStreaming run on. Outputs cached for reuse are forgotten.
+func (e *Engine) LoadWeights(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	w, err := model.ReadWeights(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return e.applyWeights(w)
+}
+
+// applyWeights copies the checkpoint into the graph payload, the model
+// payload region of the arena and every node buffer covering a parameter
+func (e *Engine) applyWeights(w *model.Weights) error {
+	if err := e.enter(); err != nil {
+		return err
+	}
+	defer e.exit()
+	e.admission.acquire(PriorityCritical)
+	defer e.admission.release()
+	e.trainMu.Lock()
+	defer e.trainMu.Unlock()
+
+	if err := e.graph.ApplyWeights(w); err != nil {
+		return err
+	}
+	var changed []span
+	for _, s := range e.graph.ParameterSegments() {
+		changed = append(changed, span{s.Offset, s.End()})
+	}
+	e.syncPayload(changed)
+	return nil
+}
+
+// syncPayload copies the changed ranges of the graph payload into the model
+// payload region of the arena and every node buffer covering them, and
+// forgets the outputs cached for reuse. The caller holds the admission queue
+// and the training lock.
+func (e *Engine) syncPayload(changed []span) {
+	var modelPayload []byte
+	if e.arena != nil {
+		modelPayload, _ = e.arena.ModelPayload(uintptr(len(e.graph.Payload)))
+	}
+	for _, s := range changed {
+		data := e.graph.Payload[s.from:s.to]
+		if len(modelPayload) >= int(s.to) {
+			copy(modelPayload[s.from:], data)
+		}
+		for i, n := range e.graph.Nodes {
+			// The part of the range inside the node's range
+			from, to := max(n.In, s.from), min(n.Out, s.to)
+			sublate := e.sublates[i]
+			if from >= to || sublate == nil {
+				continue
+			}
+			part := data[from-s.from : to-s.from]
+			if int(to-n.In) <= len(sublate.PayloadPrev) && int(to-n.In) <= len(sublate.PayloadProp) {
+				copy(sublate.PayloadPrev[from-n.In:], part)
+				copy(sublate.PayloadProp[from-n.In:], part)
+			}
+		}
+	}
+	if e.memo != nil {
+		e.memo.reset()
+	}
+}
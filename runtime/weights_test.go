@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// weightsGraph builds a noop over a weight segment w of four floats,
+// feeding a relu over an activation segment x
+func weightsGraph(w ...float32) *model.Graph {
+	payload := make([]byte, 32)
+	for i, v := range w {
+		binary.LittleEndian.PutUint32(payload[4*i:], math.Float32bits(v))
+	}
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpNoop, In: 0, Out: 16, Segment: 1},
+			{ID: 2, Kernel: kernels.OpReLU, In: 16, Out: 32, Segment: 2, Topo: []uint32{1}},
+		},
+		Segments: []model.Segment{
+			{ID: 1, Offset: 0, Length: 16, DType: model.Float32, Role: model.RoleWeight, Name: "w"},
+			{ID: 2, Offset: 16, Length: 16, DType: model.Float32, Role: model.RoleActivation, Name: "x"},
+		},
+		Meta: model.Metadata{"version": "1"},
+	}
+}
+
+func TestLoadWeights(t *testing.T) {
+	t.Parallel()
+	trained := weightsGraph(1, 2, 3, 4)
+	trained.Meta["version"] = "2"
+	w, err := trained.ExtractWeights()
+	if err != nil {
+		t.Fatalf("ExtractWeights failed: %v", err)
+	}
+	data, err := w.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize failed: %v", err)
+	}
+	if len(data) != 8+32+4+12+1+16+4 {
+		t.Errorf("Expected a %d-byte checkpoint of segment w alone, got %d bytes", 8+32+4+12+1+16+4, len(data))
+	}
+	path := filepath.Join(t.TempDir(), "m.sublw")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	graph := weightsGraph()
+	engine, err := NewEngine(graph, &EngineOptions{Workers: 1, ArenaSize: 1 << 16})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.LoadWeights(path); err != nil {
+		t.Fatalf("LoadWeights failed: %v", err)
+	}
+	if !bytes.Equal(graph.Payload, trained.Payload) {
+		t.Errorf("Expected the trained payload, got %v", graph.Payload)
+	}
+	prev, prop, _ := engine.NodeBuffers(1)
+	if !bytes.Equal(prev[:16], trained.Payload[:16]) || !bytes.Equal(prop[:16], trained.Payload[:16]) {
+		t.Errorf("Expected the weights in the resident buffers of node 1, got %v and %v", prev[:16], prop[:16])
+	}
+	if region, _ := engine.arena.ModelPayload(32); !bytes.Equal(region, trained.Payload) {
+		t.Errorf("Expected the weights in the model payload region, got %v", region)
+	}
+
+	// Another architecture: the activation segment is a weight too
+	other := weightsGraph()
+	other.Segments[1].Role = model.RoleWeight
+	if err := other.ApplyWeights(w); !errors.Is(err, model.ErrArchitectureMismatch) {
+		t.Errorf("Expected ErrArchitectureMismatch, got %v", err)
+	}
+	data[len(data)-5] ^= 1
+	if _, err := model.ReadWeights(data); !errors.Is(err, model.ErrChecksum) {
+		t.Errorf("Expected ErrChecksum for a corrupt checkpoint, got %v", err)
+	}
+	if _, err := weightsGraph().ExtractWeights(); err != nil {
+		t.Errorf("ExtractWeights of a zeroed model failed: %v", err)
+	}
+	if _, err := (&model.Graph{Payload: make([]byte, 4)}).ExtractWeights(); err == nil {
+		t.Error("ExtractWeights of a model without weight segments succeeded")
+	}
+}
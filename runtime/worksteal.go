@@ -0,0 +1,204 @@
+package runtime
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sbl8/sublation/core"
+)
+
+// SchedulerKind selects how streaming execution dispatches ready nodes.
+type SchedulerKind string
+
+const (
+	// SchedulerLevels releases nodes onto one shared ready queue.
+	SchedulerLevels SchedulerKind = "levels"
+	// SchedulerWorkSteal keeps a deque per worker; a finished node's dependents
+	// stay on the same worker and idle workers steal from the others.
+	SchedulerWorkSteal SchedulerKind = "worksteal"
+)
+
+// validate reports whether k names a known scheduler.
+func (k SchedulerKind) validate() error {
+	switch k {
+	case "", SchedulerLevels, SchedulerWorkSteal:
+		return nil
+	}
+	return fmt.Errorf("unknown scheduler %q (want %q or %q)", string(k), SchedulerLevels, SchedulerWorkSteal)
+}
+
+// workDeque is a worker-local double-ended queue. The owner pushes and pops
+// at the tail so freshly released work runs while its inputs are still in
+// cache; thieves take the oldest item from the head.
+type workDeque[T any] struct {
+	mu    sync.Mutex
+	items []T
+	head  int
+}
+
+// push appends an item at the tail.
+func (d *workDeque[T]) push(v T) {
+	d.mu.Lock()
+	if d.head > 0 && d.head == len(d.items) {
+		d.items, d.head = d.items[:0], 0
+	}
+	d.items = append(d.items, v)
+	d.mu.Unlock()
+}
+
+// pop removes the newest item; only the owning worker calls it.
+func (d *workDeque[T]) pop() (T, bool) {
+	var zero T
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == d.head {
+		return zero, false
+	}
+	v := d.items[len(d.items)-1]
+	d.items = d.items[:len(d.items)-1]
+	return v, true
+}
+
+// steal removes the oldest item.
+func (d *workDeque[T]) steal() (T, bool) {
+	var zero T
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.items) == d.head {
+		return zero, false
+	}
+	v := d.items[d.head]
+	d.items[d.head] = zero
+	d.head++
+	return v, true
+}
+
+// len returns the number of queued items.
+func (d *workDeque[T]) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.items) - d.head
+}
+
+// stealQueues is a set of per-worker deques with stealing between them.
+type stealQueues[T any] struct {
+	deques []workDeque[T]
+}
+
+// newStealQueues creates one deque per worker.
+func newStealQueues[T any](workers int) *stealQueues[T] {
+	return &stealQueues[T]{deques: make([]workDeque[T], workers)}
+}
+
+// push queues v on the given worker's deque.
+func (q *stealQueues[T]) push(worker int, v T) {
+	q.deques[worker].push(v)
+}
+
+// next pops from the worker's own deque, then steals round-robin from the others.
+func (q *stealQueues[T]) next(worker int) (T, bool) {
+	if v, ok := q.deques[worker].pop(); ok {
+		return v, true
+	}
+	for i := 1; i < len(q.deques); i++ {
+		if v, ok := q.deques[(worker+i)%len(q.deques)].steal(); ok {
+			return v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// len returns the total number of queued items.
+func (q *stealQueues[T]) len() int {
+	total := 0
+	for i := range q.deques {
+		total += q.deques[i].len()
+	}
+	return total
+}
+
+// WorkStealingScheduler implements work-stealing for load balancing
+type WorkStealingScheduler struct {
+	queues  *stealQueues[*core.Sublate]
+	workers int
+}
+
+// NewWorkStealingScheduler creates a work-stealing scheduler for fine-grained tasks
+func NewWorkStealingScheduler(workers int) *WorkStealingScheduler {
+	return &WorkStealingScheduler{
+		queues:  newStealQueues[*core.Sublate](workers),
+		workers: workers,
+	}
+}
+
+// SubmitWork adds work to a worker's local queue
+func (ws *WorkStealingScheduler) SubmitWork(workerID int, sublate *core.Sublate) {
+	ws.queues.push(workerID, sublate)
+}
+
+// GetWork attempts to get work from local queue, then steals from others
+func (ws *WorkStealingScheduler) GetWork(workerID int) *core.Sublate {
+	work, _ := ws.queues.next(workerID)
+	return work
+}
+
+// beginStealing starts a work-stealing execution with the roots spread
+// round-robin across the worker deques.
+func (s *StreamScheduler) beginStealing(workers int) *streamRun {
+	run := &streamRun{
+		pending: append([]int32(nil), s.inDegree...),
+		queues:  newStealQueues[int](workers),
+	}
+	for n, i := range s.roots {
+		run.queues.push(n%workers, i)
+	}
+	s.current.Store(run)
+	return run
+}
+
+// completeLocal records that node i finished on worker and queues the
+// dependents it released on that worker's own deque.
+func (s *StreamScheduler) completeLocal(run *streamRun, worker, i int) {
+	for _, d := range s.dependents[i] {
+		if atomic.AddInt32(&run.pending[d], -1) == 0 {
+			run.queues.push(worker, d)
+		}
+	}
+	atomic.AddInt32(&run.done, 1)
+}
+
+// runWorkStealing executes the graph with per-worker deques
+func (e *Engine) runWorkStealing(arena *Arena) error {
+	run := e.scheduler.beginStealing(e.workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.workers; i++ {
+		wg.Add(1)
+		go e.stealingWorker(i, run, arena, &wg)
+	}
+	wg.Wait()
+	return run.failure()
+}
+
+// stealingWorker drains its own deque, steals when empty, and exits once
+// every node of the run has completed.
+func (e *Engine) stealingWorker(id int, run *streamRun, arena *Arena, wg *sync.WaitGroup) {
+	defer wg.Done()
+	payload := e.modelPayload(arena)
+	e.pinWorker(id)
+
+	total := int32(len(e.scheduler.nodes))
+	for atomic.LoadInt32(&run.done) < total {
+		i, ok := run.queues.next(id)
+		if !ok {
+			// Nothing runnable yet: another worker holds the prerequisites
+			runtime.Gosched()
+			continue
+		}
+		e.execNode(run, id, i, payload)
+		e.scheduler.completeLocal(run, id, i)
+	}
+}
@@ -0,0 +1,139 @@
+package runtime
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sbl8/sublation/model"
+)
+
+func TestWorkDequeOrder(t *testing.T) {
+	t.Parallel()
+	var d workDeque[int]
+	for i := 0; i < 4; i++ {
+		d.push(i)
+	}
+
+	if v, _ := d.pop(); v != 3 {
+		t.Errorf("Expected owner pop to return newest item 3, got %d", v)
+	}
+	if v, _ := d.steal(); v != 0 {
+		t.Errorf("Expected steal to return oldest item 0, got %d", v)
+	}
+	if d.len() != 2 {
+		t.Errorf("Expected 2 items left, got %d", d.len())
+	}
+
+	d.pop()
+	d.pop()
+	if _, ok := d.steal(); ok {
+		t.Error("Expected steal from empty deque to fail")
+	}
+}
+
+func TestWorkStealingExecution(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{
+		Payload: make([]byte, 256),
+		Nodes: []model.Node{
+			{ID: 0, Kernel: 1, In: 0, Out: 64},
+			{ID: 1, Kernel: 1, In: 64, Out: 128, Topo: []uint32{0}},
+			{ID: 2, Kernel: 1, In: 128, Out: 192, Topo: []uint32{0}},
+			{ID: 3, Kernel: 1, In: 192, Out: 256, Topo: []uint32{1, 2}},
+		},
+	}
+	recorder := NewTraceRecorder(0)
+	engine, err := NewEngine(graph, &EngineOptions{
+		Workers:   4,
+		ArenaSize: 1 << 16,
+		Streaming: true,
+		Scheduler: SchedulerWorkSteal,
+		Tracer:    recorder,
+	})
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		recorder.Reset()
+		if err := engine.Execute(NewExecutionContext(len(graph.Nodes))); err != nil {
+			t.Fatalf("Execute %d failed: %v", i, err)
+		}
+
+		events := recorder.Events()
+		if len(events) != len(graph.Nodes) {
+			t.Fatalf("Expected %d traced nodes, got %d", len(graph.Nodes), len(events))
+		}
+		byNode := make(map[uint32]TraceEvent, len(events))
+		for _, ev := range events {
+			byNode[ev.NodeID] = ev
+		}
+		for _, n := range graph.Nodes {
+			for _, dep := range n.Topo {
+				if byNode[n.ID].Start.Before(byNode[dep].End) {
+					t.Errorf("Node %d started before prerequisite %d finished", n.ID, dep)
+				}
+			}
+		}
+	}
+}
+
+func TestUnknownSchedulerKind(t *testing.T) {
+	t.Parallel()
+	graph := &model.Graph{Payload: make([]byte, 64), Nodes: []model.Node{{Kernel: 1}}}
+	if _, err := NewEngine(graph, &EngineOptions{ArenaSize: 4096, Scheduler: "fifo"}); err == nil {
+		t.Error("Expected error for unknown scheduler kind")
+	}
+}
+
+// benchmarkGraph builds a graph of width independent chains, each depth nodes long.
+func benchmarkGraph(width, depth int) *model.Graph {
+	graph := &model.Graph{Payload: make([]byte, 64)}
+	for c := 0; c < width; c++ {
+		for d := 0; d < depth; d++ {
+			id := uint32(c*depth + d)
+			n := model.Node{ID: id, Kernel: 1}
+			if d > 0 {
+				n.Topo = []uint32{id - 1}
+			}
+			graph.Nodes = append(graph.Nodes, n)
+		}
+	}
+	return graph
+}
+
+func benchmarkScheduler(b *testing.B, kind SchedulerKind, width, depth int) {
+	graph := benchmarkGraph(width, depth)
+	engine, err := NewEngine(graph, &EngineOptions{
+		Workers:   4,
+		ArenaSize: 1 << 20,
+		Streaming: true,
+		Scheduler: kind,
+	})
+	if err != nil {
+		b.Fatalf("NewEngine failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.runStreaming(engine.arena)
+	}
+}
+
+func BenchmarkSchedulers(b *testing.B) {
+	shapes := []struct {
+		name         string
+		width, depth int
+	}{
+		{"wide", 256, 1},
+		{"deep", 1, 256},
+		{"chains", 16, 16},
+	}
+	for _, shape := range shapes {
+		for _, kind := range []SchedulerKind{SchedulerLevels, SchedulerWorkSteal} {
+			b.Run(fmt.Sprintf("%s/%s", shape.name, kind), func(b *testing.B) {
+				benchmarkScheduler(b, kind, shape.width, shape.depth)
+			})
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package training
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/sbl8/sublation/model"
+)
+
+// gradCheckSamples is the number of payload floats GradCheck perturbs;
+// payloads with fewer are checked whole
+const gradCheckSamples = 64
+
+// GradSample compares the gradient of the loss with respect to one
+// payload float
+type GradSample struct {
+	Offset   int     // Payload offset of the float
+	Analytic float64 // Gradient of the backward pass
+	Numeric  float64 // Central difference of the loss
+	RelError float64 // |Analytic - Numeric| over the larger magnitude, or absolute below 1
+}
+
+// GradCheckResult is the outcome of GradCheck
+type GradCheckResult struct {
+	Samples     []GradSample // By payload offset
+	MaxRelError float64
+	Worst       int // Index of the sample of MaxRelError
+}
+
+// GradCheck compares the payload gradient the backward pass of the loss
+// node computes with central finite differences of the loss, perturbing
+// randomly sampled floats of the payload operands the loss depends on,
+// parameters and bound inputs alike, by ±eps. The sample is the same for
+// every call on the same graph. The errors are relative to the larger
+// gradient, or absolute for gradients below 1, where the float32 rounding
+// of the loss would dominate a relative error; kernels with kinks, such as
+// relu and max, disagree when eps crosses one. g is not modified.
+func GradCheck(g *model.Graph, loss uint32, eps float32) (*GradCheckResult, error) {
+	if !(eps > 0) {
+		return nil, fmt.Errorf("training: gradient check step %v is not positive", eps)
+	}
+	// Perturb a copy of the payload, which leaves the caller's graph alone
+	c := *g
+	c.Payload = slices.Clone(g.Payload)
+	b, err := Differentiate(&c, loss)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, b.Size)
+	if _, err := b.Run(buf); err != nil {
+		return nil, err
+	}
+	grad := slices.Clone(b.PayloadGradient(buf))
+
+	var operands []span
+	for _, st := range b.steps {
+		for _, op := range st.operands {
+			if op.step < 0 {
+				operands = append(operands, span{op.offset, op.length})
+			}
+		}
+	}
+	operands = mergeSpans(operands)
+	var offsets []int
+	for _, s := range operands {
+		for off := s.offset; off+4 <= s.offset+s.length; off += 4 {
+			offsets = append(offsets, off)
+		}
+	}
+	if len(offsets) > gradCheckSamples {
+		rng := rand.New(rand.NewPCG(uint64(len(offsets)), uint64(loss)))
+		rng.Shuffle(len(offsets), func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
+		offsets = offsets[:gradCheckSamples]
+		slices.Sort(offsets)
+	}
+
+	r := &GradCheckResult{Samples: make([]GradSample, 0, len(offsets))}
+	for _, off := range offsets {
+		v := getFloat(c.Payload, off)
+		hi, lo := v+eps, v-eps
+		putFloat(c.Payload, off, hi)
+		up, err := b.Forward(buf)
+		if err != nil {
+			return nil, err
+		}
+		putFloat(c.Payload, off, lo)
+		down, _ := b.Forward(buf)
+		putFloat(c.Payload, off, v)
+
+		// Divide by the step the floats took, which rounding can change
+		s := GradSample{
+			Offset:   off,
+			Analytic: float64(getFloat(grad, off)),
+			Numeric:  (float64(up) - float64(down)) / float64(hi-lo),
+		}
+		s.RelError = math.Abs(s.Analytic-s.Numeric) / max(1, math.Abs(s.Analytic), math.Abs(s.Numeric))
+		if math.IsNaN(s.RelError) {
+			s.RelError = math.Inf(1)
+		}
+		if s.RelError > r.MaxRelError {
+			r.MaxRelError, r.Worst = s.RelError, len(r.Samples)
+		}
+		r.Samples = append(r.Samples, s)
+	}
+	return r, nil
+}
@@ -0,0 +1,176 @@
+package training
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/sbl8/sublation/kernels"
+)
+
+// OptimizerKind selects the update rule of an Optimizer
+type OptimizerKind uint8
+
+const (
+	SGD      OptimizerKind = iota // p -= lr·g
+	Momentum                      // SGD on a velocity decayed by Momentum
+	Adam                          // Adaptive moments, bias corrected
+)
+
+var optimizerNames = [...]string{SGD: "sgd", Momentum: "momentum", Adam: "adam"}
+
+// optimizerKernels maps each optimizer to its kernel, header bytes and
+// float32 arrays: parameters, gradients and state
+var optimizerKernels = [...]struct {
+	op             byte
+	header, arrays int
+}{
+	SGD:      {kernels.OpSGD, kernels.SGDHeader, 2},
+	Momentum: {kernels.OpMomentum, kernels.MomentumHeader, 3},
+	Adam:     {kernels.OpAdam, kernels.AdamHeader, 4},
+}
+
+// String returns the optimizer name
+func (k OptimizerKind) String() string {
+	if int(k) < len(optimizerNames) {
+		return optimizerNames[k]
+	}
+	return fmt.Sprintf("OptimizerKind(%d)", k)
+}
+
+// ParseOptimizer returns the optimizer kind of a name String returns
+func ParseOptimizer(name string) (OptimizerKind, error) {
+	if i := slices.Index(optimizerNames[:], name); i >= 0 {
+		return OptimizerKind(i), nil
+	}
+	return 0, fmt.Errorf("unknown optimizer %q, want sgd, momentum or adam", name)
+}
+
+// Optimizer configures the parameter updates of Update. Zero
+// hyperparameters select the usual defaults; the zero Optimizer is SGD.
+type Optimizer struct {
+	Kind     OptimizerKind
+	Momentum float32 // Velocity decay of Momentum; 0.9 when 0
+	Beta1    float32 // Decay of Adam's first moment; 0.9 when 0
+	Beta2    float32 // Decay of Adam's second moment; 0.999 when 0
+	Epsilon  float32 // Adam's denominator floor; 1e-8 when 0
+}
+
+// Validate checks the kind and hyperparameters: the decays in [0, 1) and
+// a non-negative epsilon
+func (o Optimizer) Validate() error {
+	if int(o.Kind) >= len(optimizerKernels) {
+		return fmt.Errorf("training: unknown optimizer %v", o.Kind)
+	}
+	for name, v := range map[string]float32{"momentum": o.Momentum, "beta1": o.Beta1, "beta2": o.Beta2} {
+		if v < 0 || v >= 1 {
+			return fmt.Errorf("training: %s %v outside [0, 1)", name, v)
+		}
+	}
+	if o.Epsilon < 0 {
+		return fmt.Errorf("training: negative epsilon %v", o.Epsilon)
+	}
+	return nil
+}
+
+// slabSize returns the bytes of the optimizer slab of a parameter range of
+// length bytes, room for the header, parameters, gradients and state of
+// the most demanding optimizer, Adam
+func slabSize(length int) int {
+	return kernels.AdamHeader + 4*length
+}
+
+// mergeSpans sorts payload ranges and merges the overlapping ones, so
+// every parameter is updated once
+func mergeSpans(spans []span) []span {
+	slices.SortFunc(spans, func(a, b span) int { return a.offset - b.offset })
+	var merged []span
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.offset < merged[n-1].offset+merged[n-1].length {
+			last := &merged[n-1]
+			last.length = max(last.length, s.offset+s.length-last.offset)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// Update moves every parameter, a payload operand of a node not bound to a
+// model input, against its gradient in buf as left by Run, following opt
+// with learning rate rate. The optimizer kernels run on the slabs of buf,
+// where Momentum and Adam keep their state across updates; ResetState
+// clears it, as switching optimizers requires.
+func (b *Backward) Update(buf []byte, opt Optimizer, rate float32) error {
+	if err := opt.Validate(); err != nil {
+		return err
+	}
+	k := optimizerKernels[opt.Kind]
+	grad := seg(buf, b.payloadGrad)
+	for i, p := range b.params {
+		slab := seg(buf, b.state[i])
+		putFloat(slab, 0, rate)
+		switch opt.Kind {
+		case Momentum:
+			putFloat(slab, 4, cmp.Or(opt.Momentum, 0.9))
+		case Adam:
+			// The step count at 16 is state, which the kernel increments
+			putFloat(slab, 4, cmp.Or(opt.Beta1, 0.9))
+			putFloat(slab, 8, cmp.Or(opt.Beta2, 0.999))
+			putFloat(slab, 12, cmp.Or(opt.Epsilon, 1e-8))
+		}
+		params := slab[k.header : k.header+p.length]
+		copy(params, b.graph.Payload[p.offset:p.offset+p.length])
+		copy(slab[k.header+p.length:], grad[p.offset:p.offset+p.length])
+		kernels.Catalog[k.op](slab[:k.header+k.arrays*p.length])
+		copy(b.graph.Payload[p.offset:], params)
+	}
+	return nil
+}
+
+// Scale multiplies the gradients of the parameters in buf by s, such as 1/n
+// to average the gradient Accumulate summed over n samples
+func (b *Backward) Scale(buf []byte, s float32) {
+	grad := seg(buf, b.payloadGrad)
+	for _, p := range b.params {
+		for i := p.offset; i+4 <= p.offset+p.length; i += 4 {
+			putFloat(grad, i, s*getFloat(grad, i))
+		}
+	}
+}
+
+// AddGradients adds the parameter gradients in from, the training buffer
+// of a Backward of the same loss and model, to those in buf, summing the
+// gradients of samples run by different replicas
+func (b *Backward) AddGradients(buf, from []byte) {
+	grad, other := seg(buf, b.payloadGrad), seg(from, b.payloadGrad)
+	for _, p := range b.params {
+		for i := p.offset; i+4 <= p.offset+p.length; i += 4 {
+			putFloat(grad, i, getFloat(grad, i)+getFloat(other, i))
+		}
+	}
+}
+
+// CopyParameters copies the parameters of the graph payload into payload,
+// the payload of another copy of the model
+func (b *Backward) CopyParameters(payload []byte) {
+	for _, p := range b.params {
+		copy(payload[p.offset:p.offset+p.length], b.graph.Payload[p.offset:])
+	}
+}
+
+// EachParameter calls f with the payload offset and length of every range
+// of parameters Update moves, in payload order
+func (b *Backward) EachParameter(f func(offset, length int)) {
+	for _, p := range b.params {
+		f(p.offset, p.length)
+	}
+}
+
+// ResetState clears the optimizer state in buf: Momentum's velocities and
+// Adam's moments and step count
+func (b *Backward) ResetState(buf []byte) {
+	for _, s := range b.state {
+		clear(seg(buf, s))
+	}
+}
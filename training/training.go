@@ -0,0 +1,570 @@
+// Package training differentiates models, so their parameters can be
+// trained rather than only run. Differentiate generates the backward graph
+// of a loss node: one gradient kernel per node the loss depends on, run in
+// reverse topological order, turning the gradient of the loss into the
+// gradients of every node output and of the payload operands the nodes
+// read, the model's parameters.
+//
+// Differentiation follows the data flow model.Graph.InferShapes and Fold
+// assume: a node consumes the outputs of its dependencies in Topo order,
+// and a node without dependencies the operands in its payload, laid out as
+// its kernel reads them. The loss is the first float32 of the loss node's
+// output, such as the result of a sum.
+//
+// Backward runs in a training buffer the caller provides, which the
+// runtime carves from the arena: the output of every node, recorded by the
+// forward pass, the gradient of each output, the gradient of the payload
+// and room for the operands of the kernel being called. Run allocates
+// nothing.
+package training
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/sbl8/sublation/core"
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// SegmentKind tells what a segment of the training buffer holds
+type SegmentKind uint8
+
+const (
+	SegmentValue       SegmentKind = iota // A node's output, recorded by the forward pass
+	SegmentGrad                           // Gradient of the loss with respect to a node's output
+	SegmentPayloadGrad                    // Gradient with respect to the model payload, laid out like it
+	SegmentWork                           // Operands of the kernel being called
+	SegmentState                          // Optimizer slab of a parameter range: its state, kept across updates
+)
+
+var segmentKindNames = [...]string{
+	SegmentValue:       "value",
+	SegmentGrad:        "grad",
+	SegmentPayloadGrad: "payload_grad",
+	SegmentWork:        "work",
+	SegmentState:       "state",
+}
+
+// String returns the kind name
+func (k SegmentKind) String() string {
+	if int(k) < len(segmentKindNames) {
+		return segmentKindNames[k]
+	}
+	return fmt.Sprintf("SegmentKind(%d)", k)
+}
+
+// Segment is a range of the training buffer
+type Segment struct {
+	Kind   SegmentKind
+	Node   uint32 // Node of a value or grad segment, payload offset of a state slab
+	Offset int
+	Length int
+}
+
+// Op is a node of the backward graph, differentiating one forward node
+type Op struct {
+	Node   uint32   // Forward node whose operands get gradients
+	Kernel byte     // Gradient kernel; noop passes the gradient on, as for add, and mul scales it
+	Deps   []uint32 // Forward nodes consuming Node's output, whose ops run first
+}
+
+// Backward is the backward graph of a loss node and the layout of the
+// training buffer it runs in
+type Backward struct {
+	Loss     uint32
+	Ops      []Op      // In execution order, the loss node's first
+	Segments []Segment // Layout of the training buffer
+	Size     int       // Bytes of the training buffer
+
+	graph       *model.Graph
+	steps       []step    // Forward nodes the loss depends on, in topological order
+	params      []span    // Disjoint payload ranges of the parameters, rather than inputs, by offset
+	state       []Segment // Optimizer slab of each parameter range
+	work        Segment
+	payloadGrad Segment
+}
+
+// step is a forward node of the backward graph
+type step struct {
+	node     model.Node
+	operands []operand
+	size     int // Output bytes
+	value    Segment
+	grad     Segment
+
+	rows, cols, bCols int // Of a matmul
+}
+
+// operand is an input of a step: the output of another step, or a range
+// of the payload
+type operand struct {
+	step   int // Index of the step computing it, -1 for a payload range
+	offset int // Payload offset of a payload range
+	length int // Bytes
+}
+
+// span is a payload range
+type span struct {
+	offset, length int
+}
+
+// Differentiate generates the backward graph of g for the loss node. Every
+// node the loss depends on needs an inferred shape and a kernel with a
+// gradient: noop, sqrplusx, relu, sigmoid, tanh, softmax, add, mul, sum,
+// max, matmul or softmax_cross_entropy. g is not modified, and Run reads its payload as it is
+// then, with the inputs bound to it.
+func Differentiate(g *model.Graph, loss uint32) (*Backward, error) {
+	// Infer shapes on a copy, which leaves the caller's graph alone
+	c := *g
+	c.Shapes = maps.Clone(g.Shapes)
+	if err := c.InferShapes(); err != nil {
+		return nil, err
+	}
+	order, err := c.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint32]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		if _, dup := byID[n.ID]; dup {
+			return nil, fmt.Errorf("training: duplicate node ID %d", n.ID)
+		}
+		byID[n.ID] = i
+	}
+	if _, ok := byID[loss]; !ok {
+		return nil, fmt.Errorf("training: no loss node %d", loss)
+	}
+
+	// The nodes the loss depends on, itself included
+	needed := map[uint32]bool{loss: true}
+	for queue := []uint32{loss}; len(queue) > 0; queue = queue[1:] {
+		for _, dep := range g.Nodes[byID[queue[0]]].Topo {
+			if dep != model.NoNeighbor && !needed[dep] {
+				needed[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	b := &Backward{Loss: loss, graph: g}
+	stepOf := make(map[uint32]int, len(needed))
+	inputs := make(map[uint32]bool)
+	for _, s := range g.Inputs() {
+		inputs[s.NodeID] = true
+	}
+	for _, i := range order {
+		n := g.Nodes[i]
+		if !needed[n.ID] {
+			continue
+		}
+		st, err := newStep(n, c.Shapes[n.ID], c.Payload, stepOf, b.steps)
+		if err != nil {
+			return nil, fmt.Errorf("training: node %d (%s): %w", n.ID, kernels.OpName(n.Kernel), err)
+		}
+		for _, op := range st.operands {
+			if op.step < 0 && !inputs[n.ID] {
+				b.params = append(b.params, span{op.offset, op.length})
+			}
+		}
+		stepOf[n.ID] = len(b.steps)
+		b.steps = append(b.steps, st)
+	}
+	b.params = mergeSpans(b.params)
+	b.layout()
+
+	for k := len(b.steps) - 1; k >= 0; k-- {
+		st := b.steps[k]
+		op := Op{Node: st.node.ID, Kernel: st.node.Kernel}
+		if grad, ok := kernels.Gradient(st.node.Kernel); ok {
+			op.Kernel = grad
+		} else if st.node.Kernel == kernels.OpAdd {
+			op.Kernel = kernels.OpNoop
+		}
+		for _, other := range b.steps[k+1:] {
+			if slices.Contains(other.node.Topo, st.node.ID) {
+				op.Deps = append(op.Deps, other.node.ID)
+			}
+		}
+		b.Ops = append(b.Ops, op)
+	}
+	return b, nil
+}
+
+// newStep resolves the operands of node n with output shape, the steps
+// before it already resolved
+func newStep(n model.Node, shape []int, payload []byte, stepOf map[uint32]int, steps []step) (step, error) {
+	if shape == nil {
+		return step{}, errors.New("output shape is unknown")
+	}
+	st := step{node: n, size: 4 * kernels.Elements(shape)}
+	var deps []int
+	for _, dep := range n.Topo {
+		if dep != model.NoNeighbor {
+			deps = append(deps, stepOf[dep])
+		}
+	}
+	in := int(n.In)
+	payloadLen := max(int(n.Out)-in, 0)
+
+	switch n.Kernel {
+	case kernels.OpNoop, kernels.OpSqrPlusX, kernels.OpReLU, kernels.OpSigmoid, kernels.OpTanh, kernels.OpSoftmax:
+		switch len(deps) {
+		case 0:
+			return st, st.fromPayload(payload, in, st.size)
+		case 1:
+			st.fromStep(steps, deps[0])
+		default:
+			return step{}, fmt.Errorf("takes 1 operand, got %d", len(deps))
+		}
+	case kernels.OpAdd, kernels.OpMul:
+		switch len(deps) {
+		case 0:
+			if err := st.fromPayload(payload, in, st.size); err != nil {
+				return step{}, err
+			}
+			return st, st.fromPayload(payload, in+st.size, st.size)
+		case 2:
+			st.fromStep(steps, deps[0])
+			st.fromStep(steps, deps[1])
+		default:
+			return step{}, fmt.Errorf("takes 2 operands, got %d", len(deps))
+		}
+	case kernels.OpSoftmaxCrossEntropy:
+		switch len(deps) {
+		case 0:
+			half := payloadLen / 2 &^ 3
+			if err := st.fromPayload(payload, in, half); err != nil {
+				return step{}, err
+			}
+			return st, st.fromPayload(payload, in+half, half)
+		case 2:
+			st.fromStep(steps, deps[0])
+			st.fromStep(steps, deps[1])
+		default:
+			return step{}, fmt.Errorf("takes 2 operands, got %d", len(deps))
+		}
+	case kernels.OpSum, kernels.OpMax:
+		switch len(deps) {
+		case 0:
+			if payloadLen < 4 {
+				return step{}, errors.New("payload holds no operand")
+			}
+			return st, st.fromPayload(payload, in, payloadLen&^3)
+		case 1:
+			st.fromStep(steps, deps[0])
+		default:
+			return step{}, fmt.Errorf("takes 1 operand, got %d", len(deps))
+		}
+	case kernels.OpMatMul:
+		if err := st.matMulOperands(shape, payload, deps, steps); err != nil {
+			return step{}, err
+		}
+	default:
+		return step{}, errors.New("kernel has no gradient")
+	}
+	return st, nil
+}
+
+// matMulOperands resolves the operands of a matmul step: a payload header
+// with the left operand from the payload or a node and the right one from
+// the payload, or without a header two matrix operands from nodes
+func (st *step) matMulOperands(shape []int, payload []byte, deps []int, steps []step) error {
+	in := int(st.node.In)
+	if max(int(st.node.Out)-in, 0) >= 6 {
+		st.rows = int(binary.LittleEndian.Uint16(payload[in:]))
+		st.cols = int(binary.LittleEndian.Uint16(payload[in+2:]))
+		st.bCols = int(binary.LittleEndian.Uint16(payload[in+4:]))
+		aLen := 4 * st.rows * st.cols
+		switch len(deps) {
+		case 0:
+			if err := st.fromPayload(payload, in+6, aLen); err != nil {
+				return err
+			}
+		case 1:
+			st.fromStep(steps, deps[0])
+		default:
+			return fmt.Errorf("takes the left operand from 1 node, got %d", len(deps))
+		}
+		return st.fromPayload(payload, in+6+aLen, 4*st.cols*st.bCols)
+	}
+	if len(deps) != 2 || len(shape) != 2 {
+		return errors.New("needs a payload header or two matrix operands")
+	}
+	st.rows, st.bCols = shape[0], shape[1]
+	st.cols = steps[deps[0]].size / 4 / max(st.rows, 1)
+	st.fromStep(steps, deps[0])
+	st.fromStep(steps, deps[1])
+	return nil
+}
+
+// fromPayload adds the operand [offset, offset+length) of payload
+func (st *step) fromPayload(payload []byte, offset, length int) error {
+	if offset < 0 || offset+length > len(payload) {
+		return fmt.Errorf("payload operand [%d, %d) is past the %d byte payload", offset, offset+length, len(payload))
+	}
+	st.operands = append(st.operands, operand{step: -1, offset: offset, length: length})
+	return nil
+}
+
+// fromStep adds the output of steps[k] as an operand
+func (st *step) fromStep(steps []step, k int) {
+	st.operands = append(st.operands, operand{step: k, length: steps[k].size})
+}
+
+// layout places the value and grad segments of every step, the payload
+// gradient, the work segment and the optimizer slabs in the training buffer
+func (b *Backward) layout() {
+	offset := 0
+	add := func(kind SegmentKind, node uint32, length int) Segment {
+		s := Segment{Kind: kind, Node: node, Offset: offset, Length: length}
+		b.Segments = append(b.Segments, s)
+		offset += int(core.AlignedSize(uintptr(length)))
+		return s
+	}
+	work := 0
+	for i := range b.steps {
+		st := &b.steps[i]
+		st.value = add(SegmentValue, st.node.ID, st.size)
+		st.grad = add(SegmentGrad, st.node.ID, st.size)
+		work = max(work, st.workSize())
+	}
+	b.payloadGrad = add(SegmentPayloadGrad, 0, len(b.graph.Payload))
+	b.work = add(SegmentWork, 0, work)
+	for _, p := range b.params {
+		b.state = append(b.state, add(SegmentState, uint32(p.offset), slabSize(p.length)))
+	}
+	b.Size = offset
+}
+
+// workSize returns the bytes the kernels of the forward and backward pass
+// of a step need for their operands
+func (st *step) workSize() int {
+	total := 0
+	for _, op := range st.operands {
+		total += op.length
+	}
+	if st.node.Kernel == kernels.OpMatMul {
+		a, bb, c := 4*st.rows*st.cols, 4*st.cols*st.bCols, 4*st.rows*st.bCols
+		return max(kernels.MatMulTiledHeader+a+bb+c, kernels.MatMulGradSize(st.rows, st.cols, st.bCols))
+	}
+	return max(total, 2*st.size) + 4
+}
+
+// Run runs the forward pass over the graph payload, recording every
+// node's output in buf, then back-propagates the gradient of the loss,
+// which it returns. buf must hold Size bytes and keeps the gradients for
+// Gradient, PayloadGradient and Update.
+func (b *Backward) Run(buf []byte) (float32, error) {
+	return b.run(buf, false)
+}
+
+// Accumulate is Run adding the payload gradient to the one in buf rather
+// than replacing it, summing the gradients of the samples of a batch
+func (b *Backward) Accumulate(buf []byte) (float32, error) {
+	return b.run(buf, true)
+}
+
+// Forward runs only the forward pass, recording every node's output in
+// buf for Value, and returns the loss. The gradients in buf are kept.
+func (b *Backward) Forward(buf []byte) (float32, error) {
+	if len(buf) < b.Size {
+		return 0, fmt.Errorf("training buffer of %d bytes is smaller than the %d the backward graph needs", len(buf), b.Size)
+	}
+	work := seg(buf, b.work)
+	for i := range b.steps {
+		b.forward(buf, work, &b.steps[i])
+	}
+	return getFloat(seg(buf, b.steps[len(b.steps)-1].value), 0), nil
+}
+
+func (b *Backward) run(buf []byte, accumulate bool) (float32, error) {
+	if _, err := b.Forward(buf); err != nil {
+		return 0, err
+	}
+	work := seg(buf, b.work)
+
+	for i := range b.steps {
+		clear(seg(buf, b.steps[i].grad))
+	}
+	if !accumulate {
+		clear(seg(buf, b.payloadGrad))
+	}
+	last := &b.steps[len(b.steps)-1]
+	putFloat(seg(buf, last.grad), 0, 1)
+	for k := len(b.steps) - 1; k >= 0; k-- {
+		b.backward(buf, work, &b.steps[k])
+	}
+	return getFloat(seg(buf, last.value), 0), nil
+}
+
+// operandBytes returns the data of an operand of a step
+func (b *Backward) operandBytes(buf []byte, op operand) []byte {
+	if op.step < 0 {
+		return b.graph.Payload[op.offset : op.offset+op.length]
+	}
+	return seg(buf, b.steps[op.step].value)[:op.length]
+}
+
+// forward computes the output of st into its value segment with its
+// forward kernel
+func (b *Backward) forward(buf, work []byte, st *step) {
+	value := seg(buf, st.value)
+	if st.node.Kernel == kernels.OpMatMul {
+		// matmul_tiled leaves its operands alone and writes C after them
+		w := work[:kernels.MatMulTiledHeader]
+		binary.LittleEndian.PutUint16(w[0:], uint16(st.rows))
+		binary.LittleEndian.PutUint16(w[2:], uint16(st.cols))
+		binary.LittleEndian.PutUint16(w[4:], uint16(st.bCols))
+		binary.LittleEndian.PutUint16(w[6:], 0)
+		n := b.pack(buf, work[kernels.MatMulTiledHeader:], st.operands...)
+		c := work[kernels.MatMulTiledHeader+n : kernels.MatMulTiledHeader+n+st.size]
+		clear(c)
+		kernels.Catalog[kernels.OpMatMulTiled](work[:kernels.MatMulTiledHeader+n+st.size])
+		copy(value, c)
+		return
+	}
+	n := b.pack(buf, work, st.operands...)
+	kernels.Catalog[st.node.Kernel](work[:n])
+	copy(value, work[:st.size])
+}
+
+// backward adds the gradients of the operands of st, from the gradient of
+// its output, to the gradients of the steps or payload ranges they come from
+func (b *Backward) backward(buf, work []byte, st *step) {
+	dy := seg(buf, st.grad)
+	ops := st.operands
+	switch st.node.Kernel {
+	case kernels.OpNoop, kernels.OpAdd:
+		for _, op := range ops {
+			b.accumulate(buf, op, dy)
+		}
+	case kernels.OpMul:
+		for i, op := range ops {
+			copy(work, dy)
+			copy(work[st.size:], b.operandBytes(buf, ops[1-i]))
+			kernels.Catalog[kernels.OpMul](work[:2*st.size])
+			b.accumulate(buf, op, work[:st.size])
+		}
+	case kernels.OpSum, kernels.OpMax:
+		grad, _ := kernels.Gradient(st.node.Kernel)
+		copy(work, dy[:4])
+		n := copy(work[4:], b.operandBytes(buf, ops[0]))
+		kernels.Catalog[grad](work[:4+n])
+		b.accumulate(buf, ops[0], work[4:4+n])
+	case kernels.OpMatMul:
+		grad, _ := kernels.Gradient(st.node.Kernel)
+		binary.LittleEndian.PutUint16(work[0:], uint16(st.rows))
+		binary.LittleEndian.PutUint16(work[2:], uint16(st.cols))
+		binary.LittleEndian.PutUint16(work[4:], uint16(st.bCols))
+		n := 6 + b.pack(buf, work[6:], ops...)
+		n += copy(work[n:], dy)
+		aLen, bLen := ops[0].length, ops[1].length
+		kernels.Catalog[grad](work[:kernels.MatMulGradSize(st.rows, st.cols, st.bCols)])
+		b.accumulate(buf, ops[0], work[n:n+aLen])
+		b.accumulate(buf, ops[1], work[n+aLen:n+aLen+bLen])
+	case kernels.OpSoftmaxCrossEntropy:
+		grad, _ := kernels.Gradient(st.node.Kernel)
+		copy(work, dy[:4])
+		n := 4 + b.pack(buf, work[4:], ops...)
+		kernels.Catalog[grad](work[:n])
+		zLen := ops[0].length
+		b.accumulate(buf, ops[0], work[4:4+zLen])
+		b.accumulate(buf, ops[1], work[4+zLen:n])
+	default:
+		// Elementwise kernels take [dy][x], softmax its output for x
+		grad, _ := kernels.Gradient(st.node.Kernel)
+		x := b.operandBytes(buf, ops[0])
+		if st.node.Kernel == kernels.OpSoftmax {
+			x = seg(buf, st.value)
+		}
+		copy(work, dy)
+		copy(work[st.size:], x)
+		kernels.Catalog[grad](work[:2*st.size])
+		b.accumulate(buf, ops[0], work[:st.size])
+	}
+}
+
+// pack copies the operands back to back into w and returns their length
+func (b *Backward) pack(buf, w []byte, ops ...operand) int {
+	n := 0
+	for _, op := range ops {
+		n += copy(w[n:], b.operandBytes(buf, op))
+	}
+	return n
+}
+
+// accumulate adds the float32 gradients g to the gradient of op
+func (b *Backward) accumulate(buf []byte, op operand, g []byte) {
+	dst := seg(buf, b.payloadGrad)[op.offset:]
+	if op.step >= 0 {
+		dst = seg(buf, b.steps[op.step].grad)
+	}
+	for i := 0; i+4 <= op.length && i+4 <= len(g); i += 4 {
+		putFloat(dst, i, getFloat(dst, i)+getFloat(g, i))
+	}
+}
+
+// Gradient returns the gradient of the loss with respect to the output of
+// node id, as left in buf by Run; ok is false for nodes the loss does not
+// depend on
+func (b *Backward) Gradient(buf []byte, id uint32) (grad []float32, ok bool) {
+	for _, st := range b.steps {
+		if st.node.ID == id {
+			return floats(seg(buf, st.grad)), true
+		}
+	}
+	return nil, false
+}
+
+// Value returns the output of node id as computed by the latest forward
+// pass in buf; ok is false for nodes the loss does not depend on
+func (b *Backward) Value(buf []byte, id uint32) (value []float32, ok bool) {
+	for _, st := range b.steps {
+		if st.node.ID == id {
+			return floats(seg(buf, st.value)), true
+		}
+	}
+	return nil, false
+}
+
+// PayloadGradient returns the gradient of the loss with respect to the
+// model payload, as left in buf by Run, laid out like the payload: the
+// float32 at the offset of each float32 operand a node reads from its
+// payload is the gradient of the loss with respect to it, other bytes are
+// zero. The slice aliases buf.
+func (b *Backward) PayloadGradient(buf []byte) []byte {
+	return seg(buf, b.payloadGrad)
+}
+
+// Apply takes a plain gradient descent step of the given learning rate,
+// Update with the zero Optimizer
+func (b *Backward) Apply(buf []byte, rate float32) {
+	_ = b.Update(buf, Optimizer{}, rate)
+}
+
+// seg returns the bytes of a segment of buf
+func seg(buf []byte, s Segment) []byte {
+	return buf[s.Offset : s.Offset+s.Length]
+}
+
+func getFloat(b []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[i:]))
+}
+
+func putFloat(b []byte, i int, v float32) {
+	binary.LittleEndian.PutUint32(b[i:], math.Float32bits(v))
+}
+
+// floats returns a copy of the float32 values of b
+func floats(b []byte) []float32 {
+	f := make([]float32, len(b)/4)
+	for i := range f {
+		f[i] = getFloat(b, 4*i)
+	}
+	return f
+}
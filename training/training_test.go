@@ -0,0 +1,268 @@
+package training
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sbl8/sublation/kernels"
+	"github.com/sbl8/sublation/model"
+)
+
+// testGraph builds a 2x3 by 3x2 matmul from its payload feeding every
+// differentiable kernel, down to the scalar loss of node 11
+func testGraph() *model.Graph {
+	payload := make([]byte, 6+4*12)
+	binary.LittleEndian.PutUint16(payload[0:], 2)
+	binary.LittleEndian.PutUint16(payload[2:], 3)
+	binary.LittleEndian.PutUint16(payload[4:], 2)
+	for i, v := range []float32{0.5, -0.3, 0.8, 0.2, 0.7, -0.4, 0.9, 0.1, -0.6, 0.4, 0.3, 0.8} {
+		binary.LittleEndian.PutUint32(payload[6+4*i:], math.Float32bits(v))
+	}
+	node := func(id uint32, kernel byte, topo ...uint32) model.Node {
+		return model.Node{ID: id, Kernel: kernel, Topo: topo}
+	}
+	return &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpMatMul, In: 0, Out: uint32(len(payload))},
+			node(2, kernels.OpTanh, 1),
+			node(3, kernels.OpSigmoid, 1),
+			node(4, kernels.OpAdd, 2, 3),
+			node(5, kernels.OpSqrPlusX, 4),
+			node(6, kernels.OpSoftmax, 5),
+			node(7, kernels.OpReLU, 1),
+			node(8, kernels.OpMul, 6, 7),
+			node(9, kernels.OpSum, 8),
+			node(10, kernels.OpMax, 4),
+			node(11, kernels.OpAdd, 9, 10),
+		},
+	}
+}
+
+func TestDifferentiate(t *testing.T) {
+	t.Parallel()
+	g := testGraph()
+	b, err := Differentiate(g, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Shapes != nil {
+		t.Error("Differentiate set the shapes of the caller's graph")
+	}
+	var order []uint32
+	for _, op := range b.Ops {
+		order = append(order, op.Node)
+	}
+	if order[0] != 11 || order[len(order)-1] != 1 || len(order) != 11 {
+		t.Errorf("got op order %v, want 11 nodes from the loss 11 down to 1", order)
+	}
+	for _, op := range b.Ops {
+		switch op.Node {
+		case 1:
+			if op.Kernel != kernels.OpMatMulGrad || !slices.Equal(op.Deps, []uint32{2, 3, 7}) {
+				t.Errorf("got op %+v for the matmul, want matmul_grad after 2, 3 and 7", op)
+			}
+		case 4:
+			if op.Kernel != kernels.OpNoop || !slices.Equal(op.Deps, []uint32{5, 10}) {
+				t.Errorf("got op %+v for the add, want noop after 5 and 10", op)
+			}
+		}
+	}
+	if b.Size%64 != 0 || b.Size < len(g.Payload) {
+		t.Errorf("got a training buffer of %d bytes", b.Size)
+	}
+}
+
+func TestRunMatchesFiniteDifferences(t *testing.T) {
+	t.Parallel()
+	g := testGraph()
+	b, err := Differentiate(g, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, b.Size)
+	loss, err := b.Run(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grad, ok := b.Gradient(buf, 11); !ok || !slices.Equal(grad, []float32{1}) {
+		t.Errorf("got loss gradient %v, %v, want [1]", grad, ok)
+	}
+	grad := slices.Clone(b.PayloadGradient(buf))
+	if !slices.Equal(grad[:6], make([]byte, 6)) {
+		t.Errorf("got a gradient for the matmul header: %v", grad[:6])
+	}
+
+	checkGradient(t, b, grad, 6, len(g.Payload))
+
+	b.Apply(buf, 0.05)
+	if after, _ := b.Run(make([]byte, b.Size)); after >= loss {
+		t.Errorf("loss went from %v to %v after a gradient step", loss, after)
+	}
+}
+
+// checkGradient compares the payload gradient of the floats in [from, to)
+// with central differences of the loss
+func checkGradient(t *testing.T, b *Backward, grad []byte, from, to int) {
+	t.Helper()
+	const eps = 1e-2
+	payload := b.graph.Payload
+	scratch := make([]byte, b.Size)
+	for off := from; off < to; off += 4 {
+		v := getFloat(payload, off)
+		putFloat(payload, off, v+eps)
+		up, _ := b.Run(scratch)
+		putFloat(payload, off, v-eps)
+		down, _ := b.Run(scratch)
+		putFloat(payload, off, v)
+
+		want := (up - down) / (2 * eps)
+		if got := getFloat(grad, off); math.Abs(float64(got-want)) > 1e-2*max(1, math.Abs(float64(want))) {
+			t.Errorf("payload float at %d: got gradient %v, finite difference %v", off, got, want)
+		}
+	}
+}
+
+func TestSoftmaxCrossEntropyLoss(t *testing.T) {
+	t.Parallel()
+	// Logits of a 1x3 by 3x3 matmul against a one-hot target
+	payload := make([]byte, 6+4*12+4*3)
+	binary.LittleEndian.PutUint16(payload[0:], 1)
+	binary.LittleEndian.PutUint16(payload[2:], 3)
+	binary.LittleEndian.PutUint16(payload[4:], 3)
+	for i, v := range []float32{1, -0.5, 2, 0.3, -0.2, 0.1, 0.4, 0.6, -0.3, -0.1, 0.2, 0.5, 0, 0, 1} {
+		putFloat(payload, 6+4*i, v)
+	}
+	g := &model.Graph{
+		Payload: payload,
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpMatMul, In: 0, Out: 54},
+			{ID: 2, Kernel: kernels.OpNoop, In: 54, Out: 66},
+			{ID: 3, Kernel: kernels.OpSoftmaxCrossEntropy, Topo: []uint32{1, 2}},
+		},
+		IO: []model.IOSpec{{Name: "target", Kind: model.Input, NodeID: 2, DType: model.Float32, Shape: []int{1, 3}}},
+	}
+	b, err := Differentiate(g, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, b.Size)
+	if _, err := b.Run(buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGradient(t, b, slices.Clone(b.PayloadGradient(buf)), 6, 54)
+
+	// The target is an input, not a parameter
+	b.Apply(buf, 0.1)
+	if v := getFloat(g.Payload, 62); v != 1 {
+		t.Errorf("Apply moved the target to %v", v)
+	}
+}
+
+func TestDifferentiateErrors(t *testing.T) {
+	t.Parallel()
+	g := testGraph()
+	if _, err := Differentiate(g, 42); err == nil || !strings.Contains(err.Error(), "no loss node 42") {
+		t.Errorf("Differentiate of a missing loss = %v", err)
+	}
+	g.Nodes[7].Kernel = kernels.OpBatchNorm
+	if _, err := Differentiate(g, 11); err == nil || !strings.Contains(err.Error(), "no gradient") {
+		t.Errorf("Differentiate through batchnorm = %v, want no gradient", err)
+	}
+	// Nodes the loss does not depend on need no gradient
+	if _, err := Differentiate(g, 10); err != nil {
+		t.Errorf("Differentiate of node 10 = %v", err)
+	}
+}
+
+func TestUpdateKeepsOptimizerState(t *testing.T) {
+	t.Parallel()
+	g := testGraph()
+	b, err := Differentiate(g, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(b.params, []span{{6, 24}, {30, 24}}) {
+		t.Fatalf("got parameter ranges %v, want the matmul operands A and B", b.params)
+	}
+	buf := make([]byte, b.Size)
+	if _, err := b.Run(buf); err != nil {
+		t.Fatal(err)
+	}
+	before := getFloat(g.Payload, 6)
+	grad := getFloat(b.PayloadGradient(buf), 6)
+
+	// Two momentum steps on the same gradient: v = g, then 0.5g + g
+	opt := Optimizer{Kind: Momentum, Momentum: 0.5}
+	for range 2 {
+		if err := b.Update(buf, opt, 0.1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := getFloat(g.Payload, 6), before-0.1*grad-0.1*1.5*grad; math.Abs(float64(got-want)) > 1e-6 {
+		t.Errorf("got parameter %v after two momentum steps, want %v", got, want)
+	}
+	if err := b.Update(buf, Optimizer{Kind: Adam, Beta1: 1}, 0.1); err == nil {
+		t.Error("Update accepted beta1 = 1")
+	}
+}
+
+func TestMergeSpans(t *testing.T) {
+	t.Parallel()
+	got := mergeSpans([]span{{16, 8}, {0, 8}, {4, 8}, {32, 4}, {16, 4}})
+	if want := []span{{0, 12}, {16, 8}, {32, 4}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGradCheck(t *testing.T) {
+	t.Parallel()
+	g := testGraph()
+	payload := slices.Clone(g.Payload)
+	r, err := GradCheck(g, 11, 1e-2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(g.Payload, payload) {
+		t.Error("GradCheck modified the caller's payload")
+	}
+	if len(r.Samples) != 12 || r.Samples[0].Offset != 6 || r.Samples[11].Offset != 50 {
+		t.Fatalf("got %d samples from %d, want the 12 matmul operands", len(r.Samples), r.Samples[0].Offset)
+	}
+	if worst := r.Samples[r.Worst]; r.MaxRelError > 1e-2 || worst.RelError != r.MaxRelError {
+		t.Errorf("got max relative error %v at %+v", r.MaxRelError, worst)
+	}
+
+	// A 10x10 by 10x10 matmul has more floats than are sampled
+	big := make([]byte, 6+4*200)
+	for i := range 3 {
+		binary.LittleEndian.PutUint16(big[2*i:], 10)
+	}
+	for i := range 200 {
+		putFloat(big, 6+4*i, float32(i%7)/7-0.4)
+	}
+	g = &model.Graph{
+		Payload: big,
+		Nodes: []model.Node{
+			{ID: 1, Kernel: kernels.OpMatMul, In: 0, Out: uint32(len(big))},
+			{ID: 2, Kernel: kernels.OpSum, Topo: []uint32{1}},
+		},
+	}
+	a, err := GradCheck(g, 2, 1e-2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GradCheck(g, 2, 1e-2)
+	if len(a.Samples) != gradCheckSamples || !slices.Equal(a.Samples, b.Samples) {
+		t.Errorf("got %d samples, then %d others, want the same %d", len(a.Samples), len(b.Samples), gradCheckSamples)
+	}
+	if !slices.IsSortedFunc(a.Samples, func(x, y GradSample) int { return x.Offset - y.Offset }) || a.MaxRelError > 1e-2 {
+		t.Errorf("got unsorted samples or max relative error %v", a.MaxRelError)
+	}
+	if _, err := GradCheck(g, 2, 0); err == nil {
+		t.Error("GradCheck accepted a zero step")
+	}
+}